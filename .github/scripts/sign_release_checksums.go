@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Writes checksums.txt with the SHA-256 checksums of the server archives and
+// checksums.txt.sig with its base64 Ed25519 signature.
+// The self-updater refuses to install archives that don't match the signed checksums.
+//
+// RELEASE_SIGNING_KEY is the base64 private key, the matching public key is
+// embedded in the binaries with -X seanime/internal/updater.releasePublicKey=<key>.
+// Run with -keygen to generate a key pair.
+func main() {
+	keygen := flag.Bool("keygen", false, "Generate a signing key pair")
+	flag.Parse()
+
+	if *keygen {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Println("Private key (RELEASE_SIGNING_KEY secret):", base64.StdEncoding.EncodeToString(privateKey))
+		fmt.Println("Public key (RELEASE_PUBLIC_KEY variable):", base64.StdEncoding.EncodeToString(publicKey))
+		return
+	}
+
+	version := os.Getenv("APP_VERSION")
+	if version == "" {
+		fail(fmt.Errorf("APP_VERSION is not set"))
+	}
+
+	privateKey, err := base64.StdEncoding.DecodeString(strings.TrimSpace(os.Getenv("RELEASE_SIGNING_KEY")))
+	if err != nil || len(privateKey) != ed25519.PrivateKeySize {
+		fail(fmt.Errorf("RELEASE_SIGNING_KEY is not a valid Ed25519 private key"))
+	}
+
+	// Server archives, e.g. seanime-2.0.0_Linux_x86_64.tar.gz
+	var files []string
+	for _, pattern := range []string{"seanime-" + version + "_*.tar.gz", "seanime-" + version + "_*.zip"} {
+		matches, _ := filepath.Glob(pattern)
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		fail(fmt.Errorf("no server archives found for version %s", version))
+	}
+	sort.Strings(files)
+
+	var checksums strings.Builder
+	for _, file := range files {
+		sum, err := fileSHA256(file)
+		if err != nil {
+			fail(err)
+		}
+		checksums.WriteString(fmt.Sprintf("%s  %s\n", sum, file))
+	}
+
+	signature := ed25519.Sign(privateKey, []byte(checksums.String()))
+
+	if err := os.WriteFile("checksums.txt", []byte(checksums.String()), 0644); err != nil {
+		fail(err)
+	}
+	if err := os.WriteFile("checksums.txt.sig", []byte(base64.StdEncoding.EncodeToString(signature)), 0644); err != nil {
+		fail(err)
+	}
+
+	fmt.Printf("Signed the checksums of %d files\n", len(files))
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fail(err error) {
+	fmt.Println("Error:", err)
+	os.Exit(1)
+}
@@ -268,6 +268,7 @@ func (ac *AnilistClientImpl) customDoFunc(ctx context.Context, req *http.Request
 	reqTime := time.Now()
 	defer func() {
 		timeSince := time.Since(reqTime)
+		observeRequest(gqlInfo, timeSince, err)
 		formattedDur := timeSince.Truncate(time.Millisecond).String()
 		if err != nil {
 			ac.logger.Error().Str("duration", formattedDur).Str("rlr", rlRemainingStr).Err(err).Msg("anilist: Failed Request")
@@ -313,6 +314,7 @@ func (ac *AnilistClientImpl) customDoFunc(ctx context.Context, req *http.Request
 		// If we have a rate limit, sleep for the time
 		rlRetryAfter, err := strconv.Atoi(rlRetryAfterStr)
 		if err == nil {
+			rateLimitedCounter.With().Inc()
 			ac.logger.Warn().Msgf("anilist: Rate limited, retrying in %d seconds", rlRetryAfter+1)
 			if time.Since(sentRateLimitWarningTime) > 10*time.Second {
 				if events.GlobalWSEventManager != nil {
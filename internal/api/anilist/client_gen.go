@@ -60,6 +60,7 @@ type BaseAnime struct {
 	MeanScore         *int                         "json:\"meanScore,omitempty\" graphql:\"meanScore\""
 	Description       *string                      "json:\"description,omitempty\" graphql:\"description\""
 	Genres            []*string                    "json:\"genres,omitempty\" graphql:\"genres\""
+	Tags              []*BaseAnime_Tags            "json:\"tags,omitempty\" graphql:\"tags\""
 	Duration          *int                         "json:\"duration,omitempty\" graphql:\"duration\""
 	Trailer           *BaseAnime_Trailer           "json:\"trailer,omitempty\" graphql:\"trailer\""
 	Title             *BaseAnime_Title             "json:\"title,omitempty\" graphql:\"title\""
@@ -165,6 +166,12 @@ func (t *BaseAnime) GetGenres() []*string {
 	}
 	return t.Genres
 }
+func (t *BaseAnime) GetTags() []*BaseAnime_Tags {
+	if t == nil {
+		t = &BaseAnime{}
+	}
+	return t.Tags
+}
 func (t *BaseAnime) GetDuration() *int {
 	if t == nil {
 		t = &BaseAnime{}
@@ -945,6 +952,24 @@ func (t *UserReleaseYearStats) GetChaptersRead() int {
 	return t.ChaptersRead
 }
 
+type BaseAnime_Tags struct {
+	Name string "json:\"name\" graphql:\"name\""
+	Rank *int   "json:\"rank,omitempty\" graphql:\"rank\""
+}
+
+func (t *BaseAnime_Tags) GetName() string {
+	if t == nil {
+		t = &BaseAnime_Tags{}
+	}
+	return t.Name
+}
+func (t *BaseAnime_Tags) GetRank() *int {
+	if t == nil {
+		t = &BaseAnime_Tags{}
+	}
+	return t.Rank
+}
+
 type BaseAnime_Trailer struct {
 	ID        *string "json:\"id,omitempty\" graphql:\"id\""
 	Site      *string "json:\"site,omitempty\" graphql:\"site\""
@@ -7597,6 +7622,10 @@ fragment baseAnime on Media {
 	meanScore
 	description
 	genres
+	tags {
+		name
+		rank
+	}
 	duration
 	trailer {
 		id
@@ -7757,6 +7786,10 @@ fragment baseAnime on Media {
 	meanScore
 	description
 	genres
+	tags {
+		name
+		rank
+	}
 	duration
 	trailer {
 		id
@@ -7832,6 +7865,10 @@ fragment baseAnime on Media {
 	meanScore
 	description
 	genres
+	tags {
+		name
+		rank
+	}
 	duration
 	trailer {
 		id
@@ -7907,6 +7944,10 @@ fragment baseAnime on Media {
 	meanScore
 	description
 	genres
+	tags {
+		name
+		rank
+	}
 	duration
 	trailer {
 		id
@@ -7987,6 +8028,10 @@ fragment baseAnime on Media {
 	meanScore
 	description
 	genres
+	tags {
+		name
+		rank
+	}
 	duration
 	trailer {
 		id
@@ -8130,6 +8175,10 @@ fragment baseAnime on Media {
 	meanScore
 	description
 	genres
+	tags {
+		name
+		rank
+	}
 	duration
 	trailer {
 		id
@@ -8334,6 +8383,10 @@ fragment baseAnime on Media {
 	meanScore
 	description
 	genres
+	tags {
+		name
+		rank
+	}
 	duration
 	trailer {
 		id
@@ -8418,6 +8471,10 @@ fragment baseAnime on Media {
 	meanScore
 	description
 	genres
+	tags {
+		name
+		rank
+	}
 	duration
 	trailer {
 		id
@@ -8518,6 +8575,10 @@ fragment baseAnime on Media {
 	meanScore
 	description
 	genres
+	tags {
+		name
+		rank
+	}
 	duration
 	trailer {
 		id
@@ -9429,6 +9490,10 @@ fragment baseAnime on Media {
 	meanScore
 	description
 	genres
+	tags {
+		name
+		rank
+	}
 	duration
 	trailer {
 		id
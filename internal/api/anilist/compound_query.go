@@ -79,6 +79,10 @@ fragment baseAnime on Media {
 	meanScore
 	description
 	genres
+	tags {
+		name
+		rank
+	}
 	duration
 	trailer {
 		id
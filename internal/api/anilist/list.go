@@ -502,6 +502,10 @@ fragment baseAnime on Media {
 	meanScore
 	description
 	genres
+	tags {
+		name
+		rank
+	}
 	duration
 	trailer {
 		id
@@ -0,0 +1,40 @@
+package anilist
+
+import (
+	"seanime/internal/metrics"
+	"time"
+
+	"github.com/Yamashou/gqlgenc/clientv2"
+)
+
+var (
+	requestsCounter = metrics.NewCounterVec(
+		"anilist_requests_total",
+		"Number of requests sent to the AniList API, by operation and result.",
+		"operation", "result",
+	)
+	requestDurationHistogram = metrics.NewHistogramVec(
+		"anilist_request_duration_seconds",
+		"Duration of requests sent to the AniList API, including retries.",
+		nil,
+		"operation",
+	)
+	rateLimitedCounter = metrics.NewCounterVec(
+		"anilist_rate_limited_total",
+		"Number of requests rate limited by the AniList API.",
+	)
+)
+
+func observeRequest(gqlInfo *clientv2.GQLRequestInfo, duration time.Duration, err error) {
+	operation := "unknown"
+	if gqlInfo != nil && gqlInfo.Request != nil && gqlInfo.Request.OperationName != "" {
+		operation = gqlInfo.Request.OperationName
+	}
+
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	requestsCounter.With(operation, result).Inc()
+	requestDurationHistogram.With(operation).Observe(duration.Seconds())
+}
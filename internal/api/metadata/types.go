@@ -45,6 +45,7 @@ type (
 	EpisodeMetadata struct {
 		AnidbId               int    `json:"anidbId"`
 		TvdbId                int    `json:"tvdbId"`
+		TvdbShowId            int    `json:"tvdbShowId,omitempty"`
 		Title                 string `json:"title"`
 		Image                 string `json:"image"`
 		AirDate               string `json:"airDate"`
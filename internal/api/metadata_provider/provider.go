@@ -212,6 +212,7 @@ func (p *ProviderImpl) fetchAnimeMetadata(platform metadata.Platform, mId int) (
 			em := &metadata.EpisodeMetadata{
 				AnidbId:               ep.AnidbId,
 				TvdbId:                ep.TvdbId,
+				TvdbShowId:            ep.TvdbShowId,
 				Title:                 ep.AnidbTitle,
 				Image:                 ep.Image,
 				AirDate:               ep.AirDate,
@@ -0,0 +1,171 @@
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"seanime/internal/database/db"
+	"seanime/internal/database/models"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+const (
+	// TokenPrefix is the prefix of every API token, it distinguishes them from the server password hash.
+	TokenPrefix = "sea_"
+	// displayPrefixLength is the length of the token prefix stored to identify the token
+	displayPrefixLength = len(TokenPrefix) + 6
+	// lastUsedWriteInterval is the minimum duration between two writes of the last-used timestamp of a token
+	lastUsedWriteInterval = time.Minute
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid API token")
+	ErrTokenExpired = errors.New("API token expired")
+)
+
+type (
+	// Manager creates and authenticates the personal API tokens.
+	Manager struct {
+		db     *db.Database
+		logger *zerolog.Logger
+
+		lastUsedMu sync.Mutex
+		lastUsed   map[uint]time.Time // Last time the last-used timestamp of a token was written
+	}
+
+	NewManagerOptions struct {
+		Database *db.Database
+		Logger   *zerolog.Logger
+	}
+)
+
+func NewManager(opts *NewManagerOptions) *Manager {
+	return &Manager{
+		db:       opts.Database,
+		logger:   opts.Logger,
+		lastUsed: make(map[uint]time.Time),
+	}
+}
+
+// IsToken returns true if the value has the format of an API token.
+func IsToken(value string) bool {
+	return strings.HasPrefix(value, TokenPrefix)
+}
+
+// Create creates a token with the given scopes.
+// The token is only returned here, only its hash is stored.
+func (m *Manager) Create(name string, scopes []string, expiresAt *time.Time) (string, *models.ApiToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, errors.New("name is required")
+	}
+	if len(scopes) == 0 {
+		return "", nil, errors.New("at least one scope is required")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, errors.New("expiry date must be in the future")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := TokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	apiToken := &models.ApiToken{
+		Name:      name,
+		TokenHash: hashToken(token),
+		Prefix:    token[:displayPrefixLength],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := m.db.InsertApiToken(apiToken); err != nil {
+		return "", nil, err
+	}
+
+	m.logger.Info().Str("name", name).Strs("scopes", scopes).Msg("apitoken: Created API token")
+
+	return token, apiToken, nil
+}
+
+func (m *Manager) List() ([]*models.ApiToken, error) {
+	return m.db.GetApiTokens()
+}
+
+// Revoke deletes the token, requests using it are rejected immediately.
+func (m *Manager) Revoke(id uint) error {
+	if err := m.db.DeleteApiToken(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("API token not found")
+		}
+		return err
+	}
+
+	m.lastUsedMu.Lock()
+	delete(m.lastUsed, id)
+	m.lastUsedMu.Unlock()
+
+	m.logger.Info().Uint("id", id).Msg("apitoken: Revoked API token")
+	return nil
+}
+
+// Authenticate returns the stored token matching the given token and records its use.
+func (m *Manager) Authenticate(token string) (*models.ApiToken, error) {
+	if !IsToken(token) {
+		return nil, ErrInvalidToken
+	}
+
+	apiToken, err := m.db.GetApiTokenByHash(hashToken(token))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if apiToken.ExpiresAt != nil && apiToken.ExpiresAt.Before(time.Now()) {
+		return nil, ErrTokenExpired
+	}
+
+	m.recordUse(apiToken)
+
+	return apiToken, nil
+}
+
+// recordUse updates the last-used timestamp, writes are throttled since tokens are checked on every request.
+func (m *Manager) recordUse(apiToken *models.ApiToken) {
+	now := time.Now()
+
+	m.lastUsedMu.Lock()
+	if last, ok := m.lastUsed[apiToken.ID]; ok && now.Sub(last) < lastUsedWriteInterval {
+		m.lastUsedMu.Unlock()
+		return
+	}
+	m.lastUsed[apiToken.ID] = now
+	m.lastUsedMu.Unlock()
+
+	if err := m.db.UpdateApiTokenLastUsed(apiToken.ID, now); err != nil {
+		m.logger.Warn().Err(err).Uint("id", apiToken.ID).Msg("apitoken: Failed to update last-used timestamp")
+		return
+	}
+	apiToken.LastUsedAt = &now
+}
+
+// HasScope returns true if the token grants access to the scope.
+func HasScope(apiToken *models.ApiToken, scope string) bool {
+	for _, s := range apiToken.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,75 @@
+package apitoken
+
+import (
+	"seanime/internal/database/db"
+	"seanime/internal/util"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	logger := util.NewLogger()
+	database, err := db.NewDatabase(t.TempDir(), "test", logger)
+	require.NoError(t, err)
+	return NewManager(&NewManagerOptions{Database: database, Logger: logger})
+}
+
+func TestManager(t *testing.T) {
+	m := newTestManager(t)
+
+	_, _, err := m.Create("scans", nil, nil)
+	require.Error(t, err)
+	past := time.Now().Add(-time.Hour)
+	_, _, err = m.Create("scans", []string{"RefreshMetadata"}, &past)
+	require.Error(t, err)
+
+	token, apiToken, err := m.Create("scans", []string{"RefreshMetadata", "ViewAutoDownloader"}, nil)
+	require.NoError(t, err)
+	require.True(t, IsToken(token))
+	require.True(t, len(token) > displayPrefixLength)
+	require.Equal(t, token[:displayPrefixLength], apiToken.Prefix)
+	require.NotContains(t, apiToken.TokenHash, token)
+
+	authenticated, err := m.Authenticate(token)
+	require.NoError(t, err)
+	require.Equal(t, apiToken.ID, authenticated.ID)
+	require.True(t, HasScope(authenticated, "RefreshMetadata"))
+	require.False(t, HasScope(authenticated, "UpdateSettings"))
+	require.NotNil(t, authenticated.LastUsedAt)
+
+	tokens, err := m.List()
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	require.NotNil(t, tokens[0].LastUsedAt)
+	require.Equal(t, []string{"RefreshMetadata", "ViewAutoDownloader"}, []string(tokens[0].Scopes))
+
+	_, err = m.Authenticate(token + "x")
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = m.Authenticate("password-hash")
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	require.NoError(t, m.Revoke(apiToken.ID))
+	require.Error(t, m.Revoke(apiToken.ID))
+	_, err = m.Authenticate(token)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestManager_Expiry(t *testing.T) {
+	m := newTestManager(t)
+
+	expiresAt := time.Now().Add(time.Hour)
+	token, apiToken, err := m.Create("temporary", []string{"RefreshMetadata"}, &expiresAt)
+	require.NoError(t, err)
+
+	_, err = m.Authenticate(token)
+	require.NoError(t, err)
+
+	expired := time.Now().Add(-time.Minute)
+	apiToken.ExpiresAt = &expired
+	require.NoError(t, m.db.Gorm().Save(apiToken).Error)
+
+	_, err = m.Authenticate(token)
+	require.ErrorIs(t, err, ErrTokenExpired)
+}
@@ -0,0 +1,451 @@
+package backup
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"seanime/internal/constants"
+	"seanime/internal/database/db"
+	"seanime/internal/extension_repo"
+	"seanime/internal/local"
+	"seanime/internal/util"
+	"seanime/internal/util/filecache"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// FormatVersion is the version of the archive layout.
+	// It's incremented when the layout changes in a way older servers can't restore.
+	FormatVersion = 1
+
+	manifestFileName   = "manifest.json"
+	archiveFilePrefix  = "seanime-backup-"
+	archiveFileExt     = ".zip"
+	archiveTimeLayout  = "20060102-150405"
+	pendingRestoreName = "restore-pending.zip"
+
+	databaseArchiveDir      = "database"
+	filecacheArchiveDir     = "filecache"
+	extensionsArchiveDir    = "extensions"
+	offlineArchiveDir       = "offline"
+	offlineAssetsArchiveDir = "offline-assets"
+	offlineDatabaseFileName = "local.db"
+	settingsBucketName      = "backup-settings"
+	settingsBucketKey       = "1"
+	defaultBackupDirName    = "backups"
+	defaultKeep             = 5
+	defaultIntervalHours    = 24
+)
+
+type Component string
+
+const (
+	// ComponentDatabase is a snapshot of the main database (settings, library, auto downloader, plugin storage...)
+	ComponentDatabase Component = "database"
+	// ComponentFilecache is the selected filecache buckets
+	ComponentFilecache Component = "filecache"
+	// ComponentExtensions is the extension payloads, their user configs and settings
+	ComponentExtensions Component = "extensions"
+	// ComponentOffline is the local database and offline assets
+	ComponentOffline Component = "offline"
+)
+
+var AllComponents = []Component{ComponentDatabase, ComponentFilecache, ComponentExtensions, ComponentOffline}
+
+var (
+	ErrInvalidArchive       = errors.New("backup: invalid archive")
+	ErrUnsupportedFormat    = errors.New("backup: archive format is not supported by this version")
+	ErrNewerVersion         = errors.New("backup: archive was created by a newer version of Seanime")
+	ErrBackupInProgress     = errors.New("backup: a backup is already in progress")
+	ErrInvalidBackupName    = errors.New("backup: invalid backup name")
+	ErrBackupDirUnavailable = errors.New("backup: backup directory is not set")
+)
+
+type (
+	// Manifest describes the content of an archive.
+	Manifest struct {
+		FormatVersion int         `json:"formatVersion"`
+		Version       string      `json:"version"`
+		CreatedAt     time.Time   `json:"createdAt"`
+		Components    []Component `json:"components"`
+		// Buckets included in the filecache component
+		FilecacheBuckets []string `json:"filecacheBuckets,omitempty"`
+	}
+
+	// Paths are the locations of the server state.
+	Paths struct {
+		DataDir         string
+		DatabasePath    string
+		CacheDir        string
+		ExtensionDir    string
+		OfflineDir      string
+		OfflineAssetDir string
+	}
+
+	CreateOptions struct {
+		// Components to include, all of them if empty
+		Components []Component `json:"components"`
+		// Filecache buckets to include, all of them if empty
+		Buckets []string `json:"buckets"`
+	}
+
+	// Info describes an archive in the backup directory.
+	Info struct {
+		Name      string    `json:"name"`
+		Size      int64     `json:"size"`
+		CreatedAt time.Time `json:"createdAt"`
+		Manifest  *Manifest `json:"manifest,omitempty"`
+	}
+
+	Manager struct {
+		logger       *zerolog.Logger
+		database     *db.Database
+		fileCacher   *filecache.Cacher
+		localManager local.Manager
+		paths        Paths
+		mu           sync.Mutex
+		running      bool
+	}
+
+	NewManagerOptions struct {
+		Logger       *zerolog.Logger
+		Database     *db.Database
+		FileCacher   *filecache.Cacher
+		LocalManager local.Manager
+		Paths        Paths
+	}
+)
+
+func NewManager(opts *NewManagerOptions) *Manager {
+	return &Manager{
+		logger:       opts.Logger,
+		database:     opts.Database,
+		fileCacher:   opts.FileCacher,
+		localManager: opts.LocalManager,
+		paths:        opts.Paths,
+	}
+}
+
+// ListBuckets returns the filecache buckets that can be included in a backup.
+func (m *Manager) ListBuckets() ([]string, error) {
+	buckets, err := m.fileCacher.ListBuckets()
+	if err != nil {
+		return nil, err
+	}
+
+	// Extension buckets are part of the extensions component
+	ret := make([]string, 0, len(buckets))
+	for _, b := range buckets {
+		if b == settingsBucketName || extension_repo.IsExtensionDataBucket(b) {
+			continue
+		}
+		ret = append(ret, b)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Create
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// CreateBackup writes an archive to the given directory and returns its path.
+func (m *Manager) CreateBackup(dir string, opts CreateOptions) (ret string, err error) {
+	defer util.HandlePanicInModuleWithError("backup/CreateBackup", &err)
+
+	if dir == "" {
+		return "", ErrBackupDirUnavailable
+	}
+
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return "", ErrBackupInProgress
+	}
+	m.running = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.running = false
+		m.mu.Unlock()
+	}()
+
+	components := opts.Components
+	if len(components) == 0 {
+		components = AllComponents
+	}
+	for _, c := range components {
+		if !slices.Contains(AllComponents, c) {
+			return "", fmt.Errorf("backup: unknown component %q", c)
+		}
+	}
+
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("backup: failed to create backup directory: %w", err)
+	}
+
+	createdAt := time.Now()
+	ret = filepath.Join(dir, archiveFilePrefix+createdAt.Format(archiveTimeLayout)+archiveFileExt)
+
+	tmpDir, err := os.MkdirTemp(dir, ".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("backup: failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpFile, err := os.Create(filepath.Join(tmpDir, "archive"+archiveFileExt))
+	if err != nil {
+		return "", fmt.Errorf("backup: failed to create archive: %w", err)
+	}
+	defer tmpFile.Close()
+
+	manifest := &Manifest{
+		FormatVersion: FormatVersion,
+		Version:       constants.Version,
+		CreatedAt:     createdAt,
+		Components:    components,
+	}
+
+	m.logger.Info().Str("path", ret).Interface("components", components).Msg("backup: Creating backup")
+
+	zw := zip.NewWriter(tmpFile)
+
+	for _, c := range components {
+		switch c {
+		case ComponentDatabase:
+			err = m.writeDatabase(zw, tmpDir)
+		case ComponentFilecache:
+			manifest.FilecacheBuckets, err = m.writeFilecache(zw, opts.Buckets)
+		case ComponentExtensions:
+			err = m.writeExtensions(zw)
+		case ComponentOffline:
+			err = m.writeOffline(zw, tmpDir)
+		}
+		if err != nil {
+			_ = zw.Close()
+			m.logger.Error().Err(err).Str("component", string(c)).Msg("backup: Failed to write component")
+			return "", fmt.Errorf("backup: failed to write %s: %w", c, err)
+		}
+	}
+
+	w, err := zw.Create(manifestFileName)
+	if err != nil {
+		_ = zw.Close()
+		return "", err
+	}
+	if err = json.NewEncoder(w).Encode(manifest); err != nil {
+		_ = zw.Close()
+		return "", err
+	}
+
+	if err = zw.Close(); err != nil {
+		return "", fmt.Errorf("backup: failed to write archive: %w", err)
+	}
+	if err = tmpFile.Close(); err != nil {
+		return "", fmt.Errorf("backup: failed to write archive: %w", err)
+	}
+
+	if err = os.Rename(tmpFile.Name(), ret); err != nil {
+		return "", fmt.Errorf("backup: failed to move archive: %w", err)
+	}
+
+	m.logger.Info().Str("path", ret).Msg("backup: Backup created")
+
+	return ret, nil
+}
+
+func (m *Manager) writeDatabase(zw *zip.Writer, tmpDir string) error {
+	snapshotPath := filepath.Join(tmpDir, "database.db")
+	if err := m.database.Snapshot(snapshotPath); err != nil {
+		return err
+	}
+	defer os.Remove(snapshotPath)
+
+	return addFile(zw, snapshotPath, path.Join(databaseArchiveDir, filepath.Base(m.paths.DatabasePath)))
+}
+
+func (m *Manager) writeFilecache(zw *zip.Writer, selected []string) ([]string, error) {
+	buckets, err := m.ListBuckets()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(selected) > 0 {
+		buckets = slices.DeleteFunc(buckets, func(b string) bool {
+			return !slices.Contains(selected, b)
+		})
+	}
+
+	for _, b := range buckets {
+		if err = m.writeBucket(zw, filecacheArchiveDir, b); err != nil {
+			return nil, err
+		}
+	}
+
+	return buckets, nil
+}
+
+func (m *Manager) writeBucket(zw *zip.Writer, dir string, name string) error {
+	w, err := zw.Create(path.Join(dir, name+".cache"))
+	if err != nil {
+		return err
+	}
+	return m.fileCacher.WriteBucket(name, w)
+}
+
+func (m *Manager) writeExtensions(zw *zip.Writer) error {
+	if err := addDir(zw, m.paths.ExtensionDir, extensionsArchiveDir); err != nil {
+		return err
+	}
+
+	// User configs and extension settings
+	buckets, err := m.fileCacher.ListBuckets()
+	if err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		if !extension_repo.IsExtensionDataBucket(b) {
+			continue
+		}
+		if err = m.writeBucket(zw, path.Join(extensionsArchiveDir, filecacheArchiveDir), b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) writeOffline(zw *zip.Writer, tmpDir string) error {
+	snapshotPath := filepath.Join(tmpDir, offlineDatabaseFileName)
+	if err := m.localManager.SnapshotDatabase(snapshotPath); err != nil {
+		return err
+	}
+	defer os.Remove(snapshotPath)
+
+	if err := addFile(zw, snapshotPath, path.Join(offlineArchiveDir, offlineDatabaseFileName)); err != nil {
+		return err
+	}
+
+	return addDir(zw, m.paths.OfflineAssetDir, offlineAssetsArchiveDir)
+}
+
+func addFile(zw *zip.Writer, src string, name string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// addDir adds the files of a directory under the given archive directory.
+func addDir(zw *zip.Writer, dir string, archiveDir string) error {
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		return addFile(zw, p, path.Join(archiveDir, filepath.ToSlash(rel)))
+	})
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// List
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// ListBackups returns the archives in the given directory, newest first.
+func ListBackups(dir string) ([]*Info, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []*Info{}, nil
+		}
+		return nil, err
+	}
+
+	ret := make([]*Info, 0)
+	for _, e := range entries {
+		if e.IsDir() || !isBackupName(e.Name()) {
+			continue
+		}
+		createdAt, err := time.ParseInLocation(archiveTimeLayout, strings.TrimSuffix(strings.TrimPrefix(e.Name(), archiveFilePrefix), archiveFileExt), time.Local)
+		if err != nil {
+			continue
+		}
+		info := &Info{
+			Name:      e.Name(),
+			CreatedAt: createdAt,
+		}
+		if fi, err := e.Info(); err == nil {
+			info.Size = fi.Size()
+		}
+		info.Manifest, _ = ReadManifest(filepath.Join(dir, e.Name()))
+		ret = append(ret, info)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].CreatedAt.After(ret[j].CreatedAt)
+	})
+
+	return ret, nil
+}
+
+// GetBackupPath returns the path of the named archive in the directory.
+func GetBackupPath(dir string, name string) (string, error) {
+	if name != filepath.Base(name) || !isBackupName(name) {
+		return "", ErrInvalidBackupName
+	}
+	p := filepath.Join(dir, name)
+	if _, err := os.Stat(p); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+func isBackupName(name string) bool {
+	return strings.HasPrefix(name, archiveFilePrefix) && strings.HasSuffix(name, archiveFileExt)
+}
+
+// rotate removes the oldest archives, keeping the given number of archives.
+func (m *Manager) rotate(dir string, keep int) {
+	backups, err := ListBackups(dir)
+	if err != nil || keep <= 0 || len(backups) <= keep {
+		return
+	}
+
+	for _, b := range backups[keep:] {
+		if err := os.Remove(filepath.Join(dir, b.Name)); err != nil {
+			m.logger.Warn().Err(err).Str("name", b.Name).Msg("backup: Failed to remove old backup")
+			continue
+		}
+		m.logger.Debug().Str("name", b.Name).Msg("backup: Removed old backup")
+	}
+}
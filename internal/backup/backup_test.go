@@ -0,0 +1,210 @@
+package backup
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"seanime/internal/constants"
+	"seanime/internal/database/db"
+	"seanime/internal/database/models"
+	"seanime/internal/local"
+	"seanime/internal/util"
+	"seanime/internal/util/filecache"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func getTestManager(t *testing.T, paths Paths) (*Manager, *db.Database, *filecache.Cacher) {
+	logger := util.NewLogger()
+
+	database, err := db.NewDatabase(paths.DataDir, "seanime", logger)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		sqlDB, _ := database.Gorm().DB()
+		_ = sqlDB.Close()
+	})
+
+	fileCacher, err := filecache.NewCacher(paths.CacheDir)
+	require.NoError(t, err)
+
+	localManager, err := local.NewManager(&local.NewManagerOptions{
+		LocalDir: paths.OfflineDir,
+		AssetDir: paths.OfflineAssetDir,
+		Logger:   logger,
+		Database: database,
+	})
+	require.NoError(t, err)
+
+	return NewManager(&NewManagerOptions{
+		Logger:       logger,
+		Database:     database,
+		FileCacher:   fileCacher,
+		LocalManager: localManager,
+		Paths:        paths,
+	}), database, fileCacher
+}
+
+func getTestPaths(t *testing.T) Paths {
+	dataDir := t.TempDir()
+	return Paths{
+		DataDir:         dataDir,
+		DatabasePath:    filepath.Join(dataDir, "seanime.db"),
+		CacheDir:        filepath.Join(dataDir, "cache"),
+		ExtensionDir:    filepath.Join(dataDir, "extensions"),
+		OfflineDir:      filepath.Join(dataDir, "offline"),
+		OfflineAssetDir: filepath.Join(dataDir, "offline", "assets"),
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	paths := getTestPaths(t)
+	manager, database, fileCacher := getTestManager(t, paths)
+
+	// Server state
+	require.NoError(t, database.Gorm().Create(&models.PluginData{PluginID: "backup-test", Data: []byte("data")}).Error)
+	require.NoError(t, fileCacher.SetPerm(filecache.NewPermanentBucket("continuity"), "1", "watched"))
+	require.NoError(t, fileCacher.SetPerm(filecache.NewPermanentBucket("onlinestream"), "1", "episodes"))
+	require.NoError(t, fileCacher.SetPerm(filecache.NewPermanentBucket("ext_user_config_backup-test"), "backup-test", "config"))
+	require.NoError(t, os.MkdirAll(paths.ExtensionDir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(paths.ExtensionDir, "backup-test.json"), []byte(`{"id":"backup-test"}`), 0600))
+	require.NoError(t, os.MkdirAll(paths.OfflineAssetDir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(paths.OfflineAssetDir, "cover.jpg"), []byte("image"), 0600))
+
+	buckets, err := manager.ListBuckets()
+	require.NoError(t, err)
+	require.Equal(t, []string{"continuity", "onlinestream"}, buckets)
+
+	archivePath, err := manager.CreateBackup(manager.DefaultDir(), CreateOptions{Buckets: []string{"continuity"}})
+	require.NoError(t, err)
+
+	manifest, err := ReadManifest(archivePath)
+	require.NoError(t, err)
+	require.Equal(t, constants.Version, manifest.Version)
+	require.Equal(t, AllComponents, manifest.Components)
+	require.Equal(t, []string{"continuity"}, manifest.FilecacheBuckets)
+
+	backups, err := ListBackups(manager.DefaultDir())
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	require.Equal(t, filepath.Base(archivePath), backups[0].Name)
+
+	// Restore on another server
+	newPaths := getTestPaths(t)
+	restored, err := Restore(archivePath, newPaths, util.NewLogger())
+	require.NoError(t, err)
+	require.Equal(t, constants.Version, restored.Version)
+
+	_, newDatabase, newFileCacher := getTestManager(t, newPaths)
+
+	var pluginData models.PluginData
+	require.NoError(t, newDatabase.Gorm().Where("plugin_id = ?", "backup-test").First(&pluginData).Error)
+	require.Equal(t, "data", string(pluginData.Data))
+
+	var value string
+	found, _ := newFileCacher.GetPerm(filecache.NewPermanentBucket("continuity"), "1", &value)
+	require.True(t, found)
+	require.Equal(t, "watched", value)
+	found, _ = newFileCacher.GetPerm(filecache.NewPermanentBucket("onlinestream"), "1", &value)
+	require.False(t, found)
+	found, _ = newFileCacher.GetPerm(filecache.NewPermanentBucket("ext_user_config_backup-test"), "backup-test", &value)
+	require.True(t, found)
+	require.Equal(t, "config", value)
+
+	require.FileExists(t, filepath.Join(newPaths.ExtensionDir, "backup-test.json"))
+	require.NoDirExists(t, filepath.Join(newPaths.ExtensionDir, "filecache"))
+	require.FileExists(t, filepath.Join(newPaths.OfflineDir, "local.db"))
+	require.FileExists(t, filepath.Join(newPaths.OfflineAssetDir, "cover.jpg"))
+}
+
+func TestRestoreValidation(t *testing.T) {
+	paths := getTestPaths(t)
+
+	writeArchive := func(manifest *Manifest, files map[string]string) string {
+		p := filepath.Join(t.TempDir(), "archive.zip")
+		f, err := os.Create(p)
+		require.NoError(t, err)
+		defer f.Close()
+
+		zw := zip.NewWriter(f)
+		for name, content := range files {
+			w, err := zw.Create(name)
+			require.NoError(t, err)
+			_, _ = w.Write([]byte(content))
+		}
+		if manifest != nil {
+			w, err := zw.Create(manifestFileName)
+			require.NoError(t, err)
+			require.NoError(t, json.NewEncoder(w).Encode(manifest))
+		}
+		require.NoError(t, zw.Close())
+		return p
+	}
+
+	manifest := func(formatVersion int, version string) *Manifest {
+		return &Manifest{
+			FormatVersion: formatVersion,
+			Version:       version,
+			CreatedAt:     time.Now(),
+			Components:    []Component{ComponentExtensions},
+		}
+	}
+
+	_, err := Restore(writeArchive(nil, nil), paths, util.NewLogger())
+	require.ErrorIs(t, err, ErrInvalidArchive)
+
+	_, err = Restore(writeArchive(manifest(FormatVersion+1, constants.Version), nil), paths, util.NewLogger())
+	require.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	_, err = Restore(writeArchive(manifest(FormatVersion, "99.0.0"), nil), paths, util.NewLogger())
+	require.ErrorIs(t, err, ErrNewerVersion)
+
+	_, err = Restore(writeArchive(manifest(FormatVersion, constants.Version), map[string]string{"../escape.json": "{}"}), paths, util.NewLogger())
+	require.ErrorIs(t, err, ErrInvalidArchive)
+	require.NoFileExists(t, filepath.Join(filepath.Dir(paths.DataDir), "escape.json"))
+
+	// Older archives are restored
+	restored, err := Restore(writeArchive(manifest(FormatVersion, "2.0.0"), map[string]string{"extensions/ext.json": "{}"}), paths, util.NewLogger())
+	require.NoError(t, err)
+	require.Equal(t, "2.0.0", restored.Version)
+	require.FileExists(t, filepath.Join(paths.ExtensionDir, "ext.json"))
+}
+
+func TestScheduledBackupRotation(t *testing.T) {
+	paths := getTestPaths(t)
+	manager, _, _ := getTestManager(t, paths)
+
+	dir := manager.DefaultDir()
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	for i := 1; i <= 3; i++ {
+		name := archiveFilePrefix + time.Now().Add(-time.Duration(i)*48*time.Hour).Format(archiveTimeLayout) + archiveFileExt
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{}, 0600))
+	}
+
+	// Disabled by default
+	manager.RunScheduledBackup()
+	backups, err := ListBackups(dir)
+	require.NoError(t, err)
+	require.Len(t, backups, 3)
+
+	settings := manager.GetSettings()
+	settings.Enabled = true
+	settings.Keep = 2
+	settings.Components = []Component{ComponentExtensions}
+	require.NoError(t, manager.SaveSettings(settings))
+
+	manager.RunScheduledBackup()
+	backups, err = ListBackups(dir)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	require.NotNil(t, backups[0].Manifest)
+	require.WithinDuration(t, time.Now(), backups[0].CreatedAt, time.Minute)
+
+	// The last backup is recent enough
+	manager.RunScheduledBackup()
+	backups, err = ListBackups(dir)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+}
@@ -0,0 +1,330 @@
+package backup
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"seanime/internal/constants"
+	"seanime/internal/util"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// ReadManifest reads and validates the manifest of an archive.
+func ReadManifest(archivePath string) (*Manifest, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer zr.Close()
+
+	return readManifest(&zr.Reader)
+}
+
+func readManifest(zr *zip.Reader) (*Manifest, error) {
+	f, err := zr.Open(manifestFileName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing manifest", ErrInvalidArchive)
+	}
+	defer f.Close()
+
+	var manifest Manifest
+	if err = json.NewDecoder(f).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	if manifest.FormatVersion <= 0 || manifest.Version == "" {
+		return nil, fmt.Errorf("%w: incomplete manifest", ErrInvalidArchive)
+	}
+	if manifest.FormatVersion > FormatVersion {
+		return nil, ErrUnsupportedFormat
+	}
+	if util.VersionIsOlderThan(constants.Version, manifest.Version) {
+		return nil, fmt.Errorf("%w (%s)", ErrNewerVersion, manifest.Version)
+	}
+	for _, c := range manifest.Components {
+		if !slices.Contains(AllComponents, c) {
+			return nil, fmt.Errorf("%w: unknown component %q", ErrInvalidArchive, c)
+		}
+	}
+
+	return &manifest, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Pending restore
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// PendingRestorePath returns the path of the archive that will be restored on the next start.
+func PendingRestorePath(dataDir string) string {
+	return filepath.Join(dataDir, pendingRestoreName)
+}
+
+// StageRestore validates the archive and schedules it to be restored on the next start.
+// The server state can't be replaced while the databases are open.
+func (m *Manager) StageRestore(src io.Reader) (*Manifest, error) {
+	dest := PendingRestorePath(m.paths.DataDir)
+	tmp := dest + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, fmt.Errorf("backup: failed to create file: %w", err)
+	}
+	_, err = io.Copy(f, src)
+	_ = f.Close()
+	if err != nil {
+		_ = os.Remove(tmp)
+		return nil, fmt.Errorf("backup: failed to write file: %w", err)
+	}
+
+	manifest, err := ReadManifest(tmp)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+
+	if err = os.Rename(tmp, dest); err != nil {
+		_ = os.Remove(tmp)
+		return nil, fmt.Errorf("backup: failed to move file: %w", err)
+	}
+
+	m.logger.Info().Str("version", manifest.Version).Time("createdAt", manifest.CreatedAt).Msg("backup: Restore scheduled for the next start")
+
+	return manifest, nil
+}
+
+// CancelPendingRestore removes the archive scheduled to be restored.
+func (m *Manager) CancelPendingRestore() error {
+	err := os.Remove(PendingRestorePath(m.paths.DataDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// GetPendingRestore returns the manifest of the archive scheduled to be restored, if any.
+func (m *Manager) GetPendingRestore() *Manifest {
+	manifest, err := ReadManifest(PendingRestorePath(m.paths.DataDir))
+	if err != nil {
+		return nil
+	}
+	return manifest
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Restore
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Restore replaces the server state with the content of the archive.
+// It must be called before the databases are opened.
+// The caller should run the version migrations from the returned manifest version.
+func Restore(archivePath string, paths Paths, logger *zerolog.Logger) (manifest *Manifest, err error) {
+	defer util.HandlePanicInModuleWithError("backup/Restore", &err)
+
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer zr.Close()
+
+	manifest, err = readManifest(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info().Str("path", archivePath).Str("version", manifest.Version).Interface("components", manifest.Components).Msg("backup: Restoring backup")
+
+	// Extract everything first so that a corrupted archive doesn't leave a partially restored state
+	stagingDir, err := os.MkdirTemp(paths.DataDir, ".restore-")
+	if err != nil {
+		return nil, fmt.Errorf("backup: failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	if err = extract(&zr.Reader, stagingDir); err != nil {
+		return nil, err
+	}
+
+	for _, c := range manifest.Components {
+		switch c {
+		case ComponentDatabase:
+			err = replaceDatabase(filepath.Join(stagingDir, databaseArchiveDir, filepath.Base(paths.DatabasePath)), paths.DatabasePath)
+		case ComponentFilecache:
+			err = restoreBuckets(filepath.Join(stagingDir, filecacheArchiveDir), paths.CacheDir)
+		case ComponentExtensions:
+			err = replaceDir(filepath.Join(stagingDir, extensionsArchiveDir), paths.ExtensionDir, filecacheArchiveDir)
+			if err == nil {
+				err = restoreBuckets(filepath.Join(stagingDir, extensionsArchiveDir, filecacheArchiveDir), paths.CacheDir)
+			}
+		case ComponentOffline:
+			err = replaceDatabase(filepath.Join(stagingDir, offlineArchiveDir, offlineDatabaseFileName), filepath.Join(paths.OfflineDir, offlineDatabaseFileName))
+			if err == nil {
+				err = replaceDir(filepath.Join(stagingDir, offlineAssetsArchiveDir), paths.OfflineAssetDir)
+			}
+		}
+		if err != nil {
+			logger.Error().Err(err).Str("component", string(c)).Msg("backup: Failed to restore component")
+			return nil, fmt.Errorf("backup: failed to restore %s: %w", c, err)
+		}
+	}
+
+	logger.Info().Str("version", manifest.Version).Msg("backup: Backup restored")
+
+	return manifest, nil
+}
+
+// extract writes the archive files to the directory, refusing paths that escape it.
+func extract(zr *zip.Reader, dir string) error {
+	for _, f := range zr.File {
+		name := path.Clean(f.Name)
+		if f.FileInfo().IsDir() || name == manifestFileName {
+			continue
+		}
+		if !f.Mode().IsRegular() || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") || strings.Contains(name, `\`) {
+			return fmt.Errorf("%w: invalid file %q", ErrInvalidArchive, f.Name)
+		}
+
+		dest := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+			return err
+		}
+		if err := extractFile(f, dest); err != nil {
+			return fmt.Errorf("backup: failed to extract %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func extractFile(f *zip.File, dest string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, rc)
+	return err
+}
+
+// replaceDatabase replaces a SQLite database file, removing its write-ahead log.
+func replaceDatabase(src string, dest string) error {
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("%w: missing database", ErrInvalidArchive)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dest + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return move(src, dest)
+}
+
+// restoreBuckets copies the bucket files to the cache directory, overwriting existing buckets.
+func restoreBuckets(src string, cacheDir string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err = os.MkdirAll(cacheDir, 0700); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".cache" {
+			continue
+		}
+		if err = move(filepath.Join(src, e.Name()), filepath.Join(cacheDir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceDir replaces the content of a directory, skipping the given top-level entries of the source.
+func replaceDir(src string, dest string, skip ...string) error {
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if slices.Contains(skip, e.Name()) {
+			continue
+		}
+		if err = move(filepath.Join(src, e.Name()), filepath.Join(dest, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// move renames a file or directory, copying it when the destination is on another device.
+func move(src string, dest string) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		return copyFile(p, target)
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+func copyFile(src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,88 @@
+package backup
+
+import (
+	"path/filepath"
+	"seanime/internal/util"
+	"seanime/internal/util/filecache"
+	"time"
+)
+
+// Settings configures the scheduled backups.
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// Directory the archives are written to, defaults to the "backups" directory in the data directory
+	Dir string `json:"dir"`
+	// Hours between two scheduled backups
+	IntervalHours int `json:"intervalHours"`
+	// Number of archives to keep, older archives are removed
+	Keep int `json:"keep"`
+	CreateOptions
+}
+
+func (m *Manager) defaultSettings() *Settings {
+	return &Settings{
+		Enabled:       false,
+		Dir:           m.DefaultDir(),
+		IntervalHours: defaultIntervalHours,
+		Keep:          defaultKeep,
+	}
+}
+
+// DefaultDir returns the default backup directory.
+func (m *Manager) DefaultDir() string {
+	return filepath.Join(m.paths.DataDir, defaultBackupDirName)
+}
+
+func (m *Manager) GetSettings() *Settings {
+	bucket := filecache.NewPermanentBucket(settingsBucketName)
+
+	settings := m.defaultSettings()
+	found, _ := m.fileCacher.GetPerm(bucket, settingsBucketKey, settings)
+	if !found {
+		return m.defaultSettings()
+	}
+	if settings.Dir == "" {
+		settings.Dir = m.DefaultDir()
+	}
+	return settings
+}
+
+func (m *Manager) SaveSettings(settings *Settings) error {
+	if settings.IntervalHours < 1 {
+		settings.IntervalHours = 1
+	}
+	if settings.Keep < 1 {
+		settings.Keep = 1
+	}
+	bucket := filecache.NewPermanentBucket(settingsBucketName)
+	return m.fileCacher.SetPerm(bucket, settingsBucketKey, settings)
+}
+
+// RunScheduledBackup creates a backup if the last one is older than the configured interval
+// and removes the archives that exceed the retention count.
+// This is called periodically.
+func (m *Manager) RunScheduledBackup() {
+	defer util.HandlePanicInModuleThen("backup/RunScheduledBackup", func() {})
+
+	settings := m.GetSettings()
+	if !settings.Enabled {
+		return
+	}
+
+	backups, err := ListBackups(settings.Dir)
+	if err != nil {
+		m.logger.Error().Err(err).Str("dir", settings.Dir).Msg("backup: Failed to list backups")
+		return
+	}
+
+	if len(backups) > 0 && time.Since(backups[0].CreatedAt) < time.Duration(settings.IntervalHours)*time.Hour {
+		return
+	}
+
+	if _, err = m.CreateBackup(settings.Dir, settings.CreateOptions); err != nil {
+		m.logger.Error().Err(err).Msg("backup: Scheduled backup failed")
+		return
+	}
+
+	m.rotate(settings.Dir, settings.Keep)
+}
@@ -85,6 +85,8 @@ func (a *App) RefreshAnimeCollection() (*anilist.AnimeCollection, error) {
 
 	// Save the collection to AutoDownloader
 	a.AutoDownloader.SetAnimeCollection(ret)
+	// Create and retire the rules of the rule templates
+	go a.AutoDownloader.SyncRuleTemplates()
 
 	// Save the collection to LocalManager
 	a.LocalManager.SetAnimeCollection(ret)
@@ -97,6 +99,10 @@ func (a *App) RefreshAnimeCollection() (*anilist.AnimeCollection, error) {
 
 	a.AutoScanner.SetAnimeCollection(ret)
 
+	a.RetentionManager.SetAnimeCollection(ret)
+
+	a.NfoExporter.SetAnimeCollection(ret)
+
 	//a.SyncAnilistToSimulatedCollection()
 
 	a.WSEventManager.SendEvent(events.RefreshedAnilistAnimeCollection, nil)
@@ -6,6 +6,8 @@ import (
 	"runtime"
 	"seanime/internal/api/anilist"
 	"seanime/internal/api/metadata_provider"
+	"seanime/internal/apitoken"
+	"seanime/internal/backup"
 	"seanime/internal/constants"
 	"seanime/internal/continuity"
 	"seanime/internal/database/db"
@@ -22,10 +24,14 @@ import (
 	"seanime/internal/library/autodownloader"
 	"seanime/internal/library/autoscanner"
 	"seanime/internal/library/fillermanager"
+	"seanime/internal/library/integrity"
+	"seanime/internal/library/nfo"
 	"seanime/internal/library/playbackmanager"
+	"seanime/internal/library/retention"
 	"seanime/internal/library/scanner"
 	"seanime/internal/library_explorer"
 	"seanime/internal/local"
+	"seanime/internal/local/listimport"
 	"seanime/internal/mediaplayers/iina"
 	"seanime/internal/mediaplayers/mediaplayer"
 	"seanime/internal/mediaplayers/mpchc"
@@ -33,14 +39,17 @@ import (
 	"seanime/internal/mediaplayers/vlc"
 	"seanime/internal/mediastream"
 	"seanime/internal/nakama"
+	nakama_librarysync "seanime/internal/nakama/librarysync"
 	"seanime/internal/nativeplayer"
 	"seanime/internal/onlinestream"
+	onlinestream_downloader "seanime/internal/onlinestream/downloader"
 	"seanime/internal/platforms/anilist_platform"
 	"seanime/internal/platforms/platform"
 	"seanime/internal/platforms/simulated_platform"
 	"seanime/internal/playlist"
 	"seanime/internal/plugin"
 	"seanime/internal/report"
+	"seanime/internal/serverauth"
 	"seanime/internal/torrent_clients/torrent_client"
 	"seanime/internal/torrents/torrent"
 	"seanime/internal/torrentstream"
@@ -80,6 +89,12 @@ type (
 		AutoDownloader  *autodownloader.AutoDownloader
 		AutoScanner     *autoscanner.AutoScanner
 		PlaybackManager *playbackmanager.PlaybackManager
+		// IntegrityManager checks the local files for corruption
+		IntegrityManager *integrity.Manager
+		// RetentionManager removes watched episodes according to the retention rules
+		RetentionManager *retention.Manager
+		// NfoExporter writes NFO files and artwork for other media centers
+		NfoExporter *nfo.Manager
 
 		// Real-time communication
 		WSEventManager *events.WSEventManager
@@ -94,6 +109,8 @@ type (
 		OnlinestreamRepository  *onlinestream.Repository
 		MediastreamRepository   *mediastream.Repository
 		TorrentstreamRepository *torrentstream.Repository
+		// OnlinestreamDownloader downloads online-stream episodes for offline viewing
+		OnlinestreamDownloader *onlinestream_downloader.Manager
 
 		// Players
 		NativePlayer *nativeplayer.NativePlayer
@@ -108,12 +125,18 @@ type (
 
 		// Offline and local account
 		LocalManager local.Manager
+		// ListImporter imports the list exports of other services into the local account
+		ListImporter *listimport.Importer
 
 		// Utilities
 		FileCacher       *filecache.Cacher
 		Updater          *updater.Updater
 		SelfUpdater      *updater.SelfUpdater
 		ReportRepository *report.Repository
+		BackupManager    *backup.Manager
+		ApiTokenManager  *apitoken.Manager
+		// ServerAuthManager handles the OIDC and trusted proxy sign-ins
+		ServerAuthManager *serverauth.Manager
 
 		// Integrations
 		DiscordPresence *discordrpc_presence.Presence
@@ -158,6 +181,8 @@ type (
 		PlaylistManager *playlist.Manager
 		LibraryExplorer *library_explorer.LibraryExplorer
 		NakamaManager   *nakama.Manager
+		// NakamaLibrarySync copies files from the Nakama host's anime library
+		NakamaLibrarySync *nakama_librarysync.Manager
 
 		// Show this version's tour on the frontend
 		// Hydrated by migrations.go when there's a version change
@@ -218,6 +243,13 @@ func NewApp(configOpts *ConfigOptions, selfupdater *updater.SelfUpdater) *App {
 		logger.Info().Msg("app: Desktop sidecar mode enabled")
 	}
 
+	// Restore a backup before the database is opened
+	// Migrations are run from the version that created the backup
+	if restoredVersion, ok := restoreBackup(cfg, configOpts.Flags, logger); ok {
+		logger.Info().Str("version", restoredVersion).Msg("app: Restored backup")
+		previousVersion = restoredVersion
+	}
+
 	// Initialize database connection
 	database, err := db.NewDatabase(cfg.Data.AppDataDir, cfg.Database.Name, logger)
 	if err != nil {
@@ -365,11 +397,17 @@ func NewApp(configOpts *ConfigOptions, selfupdater *updater.SelfUpdater) *App {
 		ExtensionBankRef:              extensionBankRef,
 		ExtensionPlaygroundRepository: extensionPlaygroundRepository,
 		ReportRepository:              report.NewRepository(logger),
+		BackupManager:                 nil, // Initialized below
+		ListImporter:                  nil, // Initialized below
 		TorrentRepository:             nil, // Initialized in App.initModulesOnce
 		FillerManager:                 nil, // Initialized in App.initModulesOnce
 		PlaybackManager:               nil, // Initialized in App.initModulesOnce
 		AutoDownloader:                nil, // Initialized in App.initModulesOnce
 		AutoScanner:                   nil, // Initialized in App.initModulesOnce
+		IntegrityManager:              nil, // Initialized in App.initModulesOnce
+		RetentionManager:              nil, // Initialized in App.initModulesOnce
+		NfoExporter:                   nil, // Initialized in App.initModulesOnce
+		OnlinestreamDownloader:        nil, // Initialized in App.initModulesOnce
 		MediastreamRepository:         nil, // Initialized in App.initModulesOnce
 		TorrentstreamRepository:       nil, // Initialized in App.initModulesOnce
 		ContinuityManager:             nil, // Initialized in App.initModulesOnce
@@ -378,6 +416,7 @@ func NewApp(configOpts *ConfigOptions, selfupdater *updater.SelfUpdater) *App {
 		NativePlayer:                  nil, // Initialized in App.initModulesOnce
 		VideoCore:                     nil, // Initialized in App.initModulesOnce
 		NakamaManager:                 nil, // Initialized in App.initModulesOnce
+		NakamaLibrarySync:             nil, // Initialized in App.initModulesOnce
 		LibraryExplorer:               nil, // Initialized in App.initModulesOnce
 		TorrentClientRepository:       nil, // Initialized in App.InitOrRefreshModules
 		MediaPlayerRepository:         nil, // Initialized in App.InitOrRefreshModules
@@ -397,6 +436,30 @@ func NewApp(configOpts *ConfigOptions, selfupdater *updater.SelfUpdater) *App {
 		ServerPasswordHash:              serverPasswordHash,
 	}
 
+	app.BackupManager = backup.NewManager(&backup.NewManagerOptions{
+		Logger:       logger,
+		Database:     database,
+		FileCacher:   fileCacher,
+		LocalManager: localManager,
+		Paths:        getBackupPaths(cfg),
+	})
+
+	app.ApiTokenManager = apitoken.NewManager(&apitoken.NewManagerOptions{
+		Database: database,
+		Logger:   logger,
+	})
+
+	app.ServerAuthManager, err = serverauth.NewManager(getServerAuthOptions(cfg, logger))
+	if err != nil {
+		logger.Fatal().Err(err).Msgf("app: Failed to initialize server authentication")
+	}
+
+	app.ListImporter = listimport.NewImporter(&listimport.NewImporterOptions{
+		Logger:       logger,
+		LocalManager: localManager,
+		PlatformRef:  activePlatformRef,
+	})
+
 	// Run database migrations if version has changed
 	app.runMigrations()
 
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"seanime/internal/backup"
+
+	"github.com/rs/zerolog"
+)
+
+func getBackupPaths(cfg *Config) backup.Paths {
+	return backup.Paths{
+		DataDir:         cfg.Data.AppDataDir,
+		DatabasePath:    filepath.Join(cfg.Data.AppDataDir, cfg.Database.Name+".db"),
+		CacheDir:        cfg.Cache.Dir,
+		ExtensionDir:    cfg.Extensions.Dir,
+		OfflineDir:      cfg.Offline.Dir,
+		OfflineAssetDir: cfg.Offline.AssetDir,
+	}
+}
+
+// restoreBackup restores the archive passed with the --restore flag or scheduled from the web interface.
+// It must be called before the database is opened.
+// It returns the version of Seanime that created the archive, so that the version migrations can be run.
+func restoreBackup(cfg *Config, flags SeanimeFlags, logger *zerolog.Logger) (string, bool) {
+	paths := getBackupPaths(cfg)
+
+	// Restore from the command line
+	if flags.Restore != "" {
+		manifest, err := backup.Restore(flags.Restore, paths, logger)
+		if err != nil {
+			logger.Fatal().Err(err).Str("path", flags.Restore).Msg("app: Failed to restore backup")
+		}
+		return manifest.Version, true
+	}
+
+	// Restore scheduled from the web interface
+	pendingPath := backup.PendingRestorePath(cfg.Data.AppDataDir)
+	if _, err := os.Stat(pendingPath); errors.Is(err, os.ErrNotExist) {
+		return "", false
+	}
+
+	manifest, err := backup.Restore(pendingPath, paths, logger)
+	// Remove the archive even if it failed, so the server doesn't try to restore it on every start
+	_ = os.Remove(pendingPath)
+	if err != nil {
+		logger.Error().Err(err).Msg("app: Failed to restore scheduled backup")
+		return "", false
+	}
+	return manifest.Version, true
+}
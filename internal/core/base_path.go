@@ -0,0 +1,142 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"seanime/internal/serverauth"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+)
+
+// NormalizeBasePath returns the base path with a leading slash and without a trailing slash.
+// Returns an empty string if the app is served at the root.
+func NormalizeBasePath(basePath string) string {
+	basePath = strings.Trim(strings.TrimSpace(basePath), "/")
+	if basePath == "" {
+		return ""
+	}
+	return path.Clean("/" + basePath)
+}
+
+// GetExternalURL returns the URL at which the client reached the server, including the base path.
+// The X-Forwarded-Proto and X-Forwarded-Host headers take precedence when the request comes from one of the trusted proxies.
+func (cfg *Config) GetExternalURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	// The addresses are validated when the config is loaded
+	trustedProxies, _ := serverauth.ParseCIDRs(cfg.Server.TrustedProxies)
+	if serverauth.IsFromCIDRs(r, trustedProxies) {
+		if proto := firstHeaderValue(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if forwardedHost := firstHeaderValue(r.Header.Get("X-Forwarded-Host")); forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+
+	return scheme + "://" + host + cfg.Server.BasePath
+}
+
+// firstHeaderValue returns the first value of a comma-separated header, proxies append their own values.
+func firstHeaderValue(value string) string {
+	value, _, _ = strings.Cut(value, ",")
+	return strings.TrimSpace(value)
+}
+
+// basePathMiddleware strips the base path from the request path so that routes are matched as if the app was served at the root.
+// Requests without the base path are served as-is, e.g. when accessed directly or when the proxy strips the prefix itself.
+func basePathMiddleware(basePath string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			if req.URL.Path == basePath {
+				target := basePath + "/"
+				if req.URL.RawQuery != "" {
+					target += "?" + req.URL.RawQuery
+				}
+				return c.Redirect(http.StatusMovedPermanently, target)
+			}
+
+			if strings.HasPrefix(req.URL.Path, basePath+"/") {
+				req.URL.Path = strings.TrimPrefix(req.URL.Path, basePath)
+				if req.URL.RawPath != "" {
+					req.URL.RawPath = strings.TrimPrefix(req.URL.RawPath, basePath)
+				}
+				req.RequestURI = req.URL.RequestURI()
+			}
+
+			return next(c)
+		}
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// basePathFS serves the web interface with root-relative URLs prefixed by the base path.
+// The base path is exposed to the interface as window.__SEANIME_BASE_PATH__.
+type basePathFS struct {
+	fs       fs.FS
+	basePath string
+}
+
+func (b *basePathFS) Open(name string) (fs.File, error) {
+	f, err := b.fs.Open(name)
+	if err != nil || !strings.HasSuffix(name, ".html") {
+		return f, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	content = rewriteHTMLBasePath(content, b.basePath)
+
+	return &memFile{
+		Reader: bytes.NewReader(content),
+		info:   &memFileInfo{FileInfo: info, size: int64(len(content))},
+	}, nil
+}
+
+// rewriteHTMLBasePath prefixes the root-relative href and src attributes and injects the base path script.
+func rewriteHTMLBasePath(content []byte, basePath string) []byte {
+	for _, attr := range []string{"href", "src"} {
+		content = bytes.ReplaceAll(content, []byte(attr+`="/`), []byte(attr+`="`+basePath+"/"))
+		// Protocol-relative URLs are left untouched
+		content = bytes.ReplaceAll(content, []byte(attr+`="`+basePath+"//"), []byte(attr+`="//`))
+	}
+
+	value, _ := json.Marshal(basePath)
+	script := []byte("<head><script>window.__SEANIME_BASE_PATH__=" + string(value) + "</script>")
+	return bytes.Replace(content, []byte("<head>"), script, 1)
+}
+
+type memFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+type memFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i *memFileInfo) Size() int64 { return i.size }
@@ -3,11 +3,14 @@ package core
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"seanime/internal/constants"
+	"seanime/internal/serverauth"
 	"seanime/internal/util"
 	"strconv"
+	"strings"
 
 	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
@@ -23,11 +26,39 @@ type Config struct {
 		Systray       bool
 		DoHUrl        string
 		Password      string
-		Tls           struct {
+		BasePath      string // Path prefix when served behind a reverse proxy, e.g. "/anime"
+		// TrustedProxies lists the addresses of the reverse proxies whose X-Forwarded-Proto and X-Forwarded-Host headers are honored
+		TrustedProxies []string
+		Tls            struct {
 			Enabled  bool
 			CertPath string
 			KeyPath  string
 		}
+		Auth struct {
+			// AllowedUsers lists the usernames or emails allowed to sign in with OIDC or the trusted proxy.
+			// Everyone authenticated by the identity provider is allowed if empty.
+			AllowedUsers []string
+			Oidc         struct {
+				Enabled       bool
+				Issuer        string
+				ClientID      string
+				ClientSecret  string
+				RedirectURL   string // Defaults to <external URL>/api/v1/auth/oidc/callback
+				Scopes        []string
+				UsernameClaim string
+			}
+			// TrustedProxy accepts the username set by an authenticating reverse proxy, e.g. Authelia or Authentik
+			TrustedProxy struct {
+				Enabled      bool
+				Header       string   // e.g. Remote-User (Authelia), X-Authentik-Username (Authentik), X-Forwarded-User (oauth2-proxy)
+				EmailHeader  string   // e.g. Remote-Email (Authelia), X-Authentik-Email (Authentik), X-Forwarded-Email (oauth2-proxy)
+				AllowedCIDRs []string // Addresses of the proxies, the headers are ignored for other clients
+			}
+		}
+		Metrics struct {
+			// Token allows scrapers to read the metrics with "Authorization: Bearer <token>" when the server is protected
+			Token string
+		}
 	}
 	Database struct {
 		Name string
@@ -135,6 +166,11 @@ func NewConfig(options *ConfigOptions, logger *zerolog.Logger) (*Config, error)
 	viper.SetDefault("server.host", defaultHost)
 	viper.SetDefault("server.port", defaultPort)
 	viper.SetDefault("server.offline", false)
+	viper.SetDefault("server.basePath", "")
+	viper.SetDefault("server.auth.oidc.scopes", []string{"openid", "profile", "email"})
+	viper.SetDefault("server.auth.oidc.usernameClaim", "preferred_username")
+	viper.SetDefault("server.auth.trustedProxy.header", "Remote-User")
+	viper.SetDefault("server.auth.trustedProxy.emailHeader", "Remote-Email")
 	// Use the binary's directory as the working directory environment variable on macOS
 	viper.SetDefault("server.useBinaryPath", true)
 	// viper.SetDefault("server.systray", true)
@@ -226,6 +262,22 @@ func NewConfig(options *ConfigOptions, logger *zerolog.Logger) (*Config, error)
 		expandEnvironmentValues(cfg)
 	}
 
+	// Environment variable overrides the base path
+	if os.Getenv("SEANIME_SERVER_BASE_PATH") != "" {
+		cfg.Server.BasePath = os.Getenv("SEANIME_SERVER_BASE_PATH")
+	}
+	cfg.Server.BasePath = NormalizeBasePath(cfg.Server.BasePath)
+
+	// Environment variable overrides the OIDC client secret so that it doesn't have to be stored in the config file
+	if os.Getenv("SEANIME_SERVER_AUTH_OIDC_CLIENT_SECRET") != "" {
+		cfg.Server.Auth.Oidc.ClientSecret = os.Getenv("SEANIME_SERVER_AUTH_OIDC_CLIENT_SECRET")
+	}
+
+	// Environment variable overrides the metrics token
+	if os.Getenv("SEANIME_SERVER_METRICS_TOKEN") != "" {
+		cfg.Server.Metrics.Token = os.Getenv("SEANIME_SERVER_METRICS_TOKEN")
+	}
+
 	// Check validity of the config
 	if err := validateConfig(cfg, logger); err != nil {
 		return nil, err
@@ -242,6 +294,11 @@ func (cfg *Config) GetServerAddr(df ...string) string {
 	return fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 }
 
+// IsAuthEnabled returns true if clients have to authenticate, with the server password, OIDC or the trusted proxy.
+func (cfg *Config) IsAuthEnabled() bool {
+	return cfg.Server.Password != "" || cfg.Server.Auth.Oidc.Enabled || cfg.Server.Auth.TrustedProxy.Enabled
+}
+
 func (cfg *Config) GetServerURI(df ...string) string {
 	scheme := "http"
 	if cfg.Server.Tls.Enabled {
@@ -324,6 +381,35 @@ func validateConfig(cfg *Config, logger *zerolog.Logger) error {
 	if cfg.Server.Port == 0 {
 		return errInvalidConfigValue("server.port", "cannot be 0")
 	}
+	if strings.ContainsAny(cfg.Server.BasePath, "?#\"") {
+		return errInvalidConfigValue("server.basePath", "cannot contain '?', '#' or '\"'")
+	}
+	if _, err := serverauth.ParseCIDRs(cfg.Server.TrustedProxies); err != nil {
+		return wrapInvalidConfigValue("server.trustedProxies", err)
+	}
+	if cfg.Server.Auth.Oidc.Enabled {
+		if cfg.Server.Auth.Oidc.Issuer == "" {
+			return errInvalidConfigValue("server.auth.oidc.issuer", "cannot be empty when OIDC is enabled")
+		}
+		if u, err := url.Parse(cfg.Server.Auth.Oidc.Issuer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errInvalidConfigValue("server.auth.oidc.issuer", "must be an http(s) URL")
+		}
+		if cfg.Server.Auth.Oidc.ClientID == "" {
+			return errInvalidConfigValue("server.auth.oidc.clientId", "cannot be empty when OIDC is enabled")
+		}
+	}
+	if cfg.Server.Auth.TrustedProxy.Enabled {
+		if cfg.Server.Auth.TrustedProxy.Header == "" {
+			return errInvalidConfigValue("server.auth.trustedProxy.header", "cannot be empty when the trusted proxy is enabled")
+		}
+		prefixes, err := serverauth.ParseCIDRs(cfg.Server.Auth.TrustedProxy.AllowedCIDRs)
+		if err != nil {
+			return wrapInvalidConfigValue("server.auth.trustedProxy.allowedCidrs", err)
+		}
+		if len(prefixes) == 0 {
+			return errInvalidConfigValue("server.auth.trustedProxy.allowedCidrs", "cannot be empty when the trusted proxy is enabled")
+		}
+	}
 	if cfg.Database.Name == "" {
 		return errInvalidConfigValue("database.name", "cannot be empty")
 	}
@@ -29,6 +29,12 @@ func NewEchoApp(app *App, webFS *embed.FS) *echo.Echo {
 		log.Fatal(err)
 	}
 
+	if basePath := app.Config.Server.BasePath; basePath != "" {
+		app.Logger.Info().Str("basePath", basePath).Msg("app: Serving under base path")
+		e.Pre(basePathMiddleware(basePath))
+		distFS = &basePathFS{fs: distFS, basePath: basePath}
+	}
+
 	if app.Config.Server.Tls.Enabled {
 		app.Logger.Debug().Msg("app: TLS is enabled, adding security middleware")
 		e.Use(middleware.Secure())
@@ -152,5 +158,5 @@ func RunEchoServer(app *App, e *echo.Echo) {
 	}()
 
 	time.Sleep(100 * time.Millisecond)
-	app.Logger.Info().Msg("app: Seanime started at " + app.Config.GetServerURI())
+	app.Logger.Info().Msg("app: Seanime started at " + app.Config.GetServerURI() + app.Config.Server.BasePath)
 }
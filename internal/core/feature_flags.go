@@ -1,6 +1,8 @@
 package core
 
 import (
+	"slices"
+
 	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
 )
@@ -49,6 +51,8 @@ const (
 	ManageAutoDownloader FeatureKey = "ManageAutoDownloader"
 	// ViewScanSummaries allows viewing the scan summaries.
 	ViewScanSummaries FeatureKey = "ViewScanSummaries"
+	// ViewMetrics allows reading the Prometheus metrics.
+	ViewMetrics       FeatureKey = "ViewMetrics"
 	ViewExtensions    FeatureKey = "ViewExtensions"
 	ManageExtensions  FeatureKey = "ManageExtensions"
 	ManageHomeScreen  FeatureKey = "ManageHomeScreen"
@@ -61,6 +65,46 @@ const (
 	PushRequests      FeatureKey = "PushRequests"
 )
 
+// AllFeatures lists every feature, they are all disabled in lockdown mode.
+var AllFeatures = []FeatureKey{
+	ManageOfflineMode,
+	ViewSettings,
+	ViewLogs,
+	UpdateSettings,
+	ManagePlaylist,
+	ManageLocalAnimeLibrary,
+	ManageAccount,
+	ViewAccount,
+	ManageLists,
+	RefreshMetadata,
+	ManageMangaDownloads,
+	WatchingLocalAnime,
+	TorrentStreaming,
+	DebridStreaming,
+	OnlineStreaming,
+	Reading,
+	ViewAutoDownloader,
+	ManageAutoDownloader,
+	ViewScanSummaries,
+	ViewMetrics,
+	ViewExtensions,
+	ManageExtensions,
+	ManageHomeScreen,
+	OpenInExplorer,
+	PluginTray,
+	ManageNakama,
+	ManageDebrid,
+	Proxy,
+	Transcode,
+	ManageMangaSource,
+	PushRequests,
+}
+
+// IsValidFeature returns true if the key is a known feature.
+func IsValidFeature(key FeatureKey) bool {
+	return slices.Contains(AllFeatures, key)
+}
+
 func NewFeatureManager(logger *zerolog.Logger, flags SeanimeFlags) *FeatureManager {
 	ret := &FeatureManager{
 		disabledFeatures: make(map[FeatureKey]bool),
@@ -69,38 +113,7 @@ func NewFeatureManager(logger *zerolog.Logger, flags SeanimeFlags) *FeatureManag
 	}
 
 	if flags.LockDown {
-		ret.DisabledFeatures = []FeatureKey{
-			ManageOfflineMode,
-			ViewSettings,
-			ViewLogs,
-			UpdateSettings,
-			ManagePlaylist,
-			ManageLocalAnimeLibrary,
-			ManageAccount,
-			ViewAccount,
-			ManageLists,
-			RefreshMetadata,
-			ManageMangaDownloads,
-			WatchingLocalAnime,
-			TorrentStreaming,
-			DebridStreaming,
-			OnlineStreaming,
-			Reading,
-			ViewAutoDownloader,
-			ManageAutoDownloader,
-			ViewScanSummaries,
-			ViewExtensions,
-			ManageExtensions,
-			ManageHomeScreen,
-			OpenInExplorer,
-			PluginTray,
-			ManageNakama,
-			ManageDebrid,
-			Proxy,
-			Transcode,
-			ManageMangaSource,
-			PushRequests,
-		}
+		ret.DisabledFeatures = slices.Clone(AllFeatures)
 	}
 
 	for _, key := range ret.DisabledFeatures {
@@ -18,6 +18,11 @@ type (
 		Password         string
 		DisablePassword  bool
 		LockDown         bool
+		Restore          string
+		Relay            bool
+		RelayURL         string
+		RelayMaxRooms    int
+		RelayPassword    string
 	}
 )
 
@@ -42,6 +47,11 @@ func GetSeanimeFlags() SeanimeFlags {
 		fmt.Printf("  --disable-all-features        disable all features that can be disabled\n")
 		fmt.Printf("  --password string             password to use for the instance\n")
 		fmt.Printf("  --disable-password            disable password protection\n")
+		fmt.Printf("  --restore string              restore a backup archive before starting\n")
+		fmt.Printf("  --relay                       run as a Nakama rooms relay server\n")
+		fmt.Printf("  --relay-url string            public URL of the relay server (default: derived from requests)\n")
+		fmt.Printf("  --relay-max-rooms int         maximum number of open rooms on the relay server (default: 100)\n")
+		fmt.Printf("  --relay-password string       password required to create rooms on the relay server\n")
 		fmt.Printf("  -h                           show this help message\n")
 	}
 
@@ -54,11 +64,18 @@ func GetSeanimeFlags() SeanimeFlags {
 	flag.BoolVar(&flags.LockDown, "disable-all-features", false, "Disables all features that can be disabled")
 	flag.StringVar(&flags.Password, "password", "", "Password to use for the instance")
 	flag.BoolVar(&flags.DisablePassword, "disable-password", false, "Disable password protection")
+	flag.StringVar(&flags.Restore, "restore", "", "Restore a backup archive before starting")
+	flag.BoolVar(&flags.Relay, "relay", false, "Run as a Nakama rooms relay server")
+	flag.StringVar(&flags.RelayURL, "relay-url", "", "Public URL of the relay server")
+	flag.IntVar(&flags.RelayMaxRooms, "relay-max-rooms", 0, "Maximum number of open rooms on the relay server")
+	flag.StringVar(&flags.RelayPassword, "relay-password", "", "Password required to create rooms on the relay server")
 
 	flag.Parse()
 
 	flags.DataDir = strings.TrimSpace(flags.DataDir)
 	flags.Host = strings.TrimSpace(flags.Host)
+	flags.Restore = strings.TrimSpace(flags.Restore)
+	flags.RelayURL = strings.TrimSpace(flags.RelayURL)
 
 	if disableFeaturesStr != "" {
 		features := strings.Split(disableFeaturesStr, ",")
@@ -8,12 +8,11 @@ import (
 // GetServerPasswordHMACAuth returns an HMAC authenticator using the hashed server password as the base secret
 // This is used for server endpoints that don't use Nakama
 func (a *App) GetServerPasswordHMACAuth() *util.HMACAuth {
-	var secret string
-	if a.Config != nil && a.Config.Server.Password != "" {
-		secret = a.ServerPasswordHash
-	} else {
-		secret = "seanime-default-secret"
-	}
+	return util.NewHMACAuth(a.getAuthSecret(), 24*time.Hour)
+}
 
-	return util.NewHMACAuth(secret, 24*time.Hour)
+// GetCalendarFeedHMACAuth returns an HMAC authenticator for the calendar feed URLs
+// Calendar apps keep polling the same URL so the tokens are valid for a year
+func (a *App) GetCalendarFeedHMACAuth() *util.HMACAuth {
+	return util.NewHMACAuth(a.getAuthSecret(), 365*24*time.Hour)
 }
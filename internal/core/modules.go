@@ -1,6 +1,8 @@
 package core
 
 import (
+	"cmp"
+	"path/filepath"
 	"seanime/internal/api/anilist"
 	"seanime/internal/continuity"
 	"seanime/internal/database/db"
@@ -14,7 +16,10 @@ import (
 	"seanime/internal/library/autodownloader"
 	"seanime/internal/library/autoscanner"
 	"seanime/internal/library/fillermanager"
+	"seanime/internal/library/integrity"
+	"seanime/internal/library/nfo"
 	"seanime/internal/library/playbackmanager"
+	"seanime/internal/library/retention"
 	"seanime/internal/library_explorer"
 	"seanime/internal/mediaplayers/iina"
 	"seanime/internal/mediaplayers/mediaplayer"
@@ -23,8 +28,10 @@ import (
 	"seanime/internal/mediaplayers/vlc"
 	"seanime/internal/mediastream"
 	"seanime/internal/nakama"
+	nakama_librarysync "seanime/internal/nakama/librarysync"
 	"seanime/internal/nativeplayer"
 	"seanime/internal/notifier"
+	onlinestream_downloader "seanime/internal/onlinestream/downloader"
 	"seanime/internal/platforms/shared_platform"
 	"seanime/internal/playlist"
 	"seanime/internal/plugin"
@@ -109,6 +116,7 @@ func (a *App) initModulesOnce() {
 		RefreshAnimeCollectionFunc: func() {
 			_, _ = a.RefreshAnimeCollection()
 		},
+		OfflineLocalFilesFunc: a.LocalManager.GetOfflineLocalFiles,
 	})
 
 	// +---------------------+
@@ -197,6 +205,7 @@ func (a *App) initModulesOnce() {
 		Database:            a.Database,
 		DirectStreamManager: a.DirectStreamManager,
 		NativePlayer:        a.NativePlayer,
+		BasePath:            a.Config.Server.BasePath,
 	})
 
 	// +---------------------+
@@ -230,6 +239,7 @@ func (a *App) initModulesOnce() {
 		Database:                a.Database,
 		WSEventManager:          a.WSEventManager,
 		MetadataProviderRef:     a.MetadataProviderRef,
+		PlatformRef:             a.AnilistPlatformRef,
 		DebridClientRepository:  a.DebridClientRepository,
 		IsOfflineRef:            util.NewRef(false),
 	})
@@ -237,6 +247,63 @@ func (a *App) initModulesOnce() {
 	// This is run in a goroutine
 	a.AutoDownloader.Start()
 
+	// +---------------------+
+	// |      Integrity      |
+	// +---------------------+
+
+	a.IntegrityManager = integrity.NewManager(&integrity.NewManagerOptions{
+		Logger:         a.Logger,
+		Database:       a.Database,
+		WSEventManager: a.WSEventManager,
+		FileCacher:     a.FileCacher,
+	})
+
+	// This is run in a goroutine
+	a.IntegrityManager.Start()
+
+	// +---------------------+
+	// |      Retention      |
+	// +---------------------+
+
+	a.RetentionManager = retention.NewManager(&retention.NewManagerOptions{
+		Logger:         a.Logger,
+		Database:       a.Database,
+		FileCacher:     a.FileCacher,
+		WSEventManager: a.WSEventManager,
+		OnFilesRemoved: func() {
+			_, _ = a.RefreshAnimeCollection()
+		},
+	})
+
+	// +---------------------+
+	// |    NFO Exporter     |
+	// +---------------------+
+
+	a.NfoExporter = nfo.NewManager(&nfo.NewManagerOptions{
+		Logger:              a.Logger,
+		Database:            a.Database,
+		FileCacher:          a.FileCacher,
+		MetadataProviderRef: a.MetadataProviderRef,
+	})
+
+	// +---------------------+
+	// |    Onlinestream     |
+	// +---------------------+
+
+	a.OnlinestreamDownloader = onlinestream_downloader.NewManager(&onlinestream_downloader.NewManagerOptions{
+		Logger:         a.Logger,
+		Database:       a.Database,
+		WSEventManager: a.WSEventManager,
+		Resolver:       a.OnlinestreamRepository,
+		WorkDir:        filepath.Join(a.Config.Cache.Dir, "onlinestream-downloads"),
+	})
+
+	// This is run in a goroutine
+	a.OnlinestreamDownloader.Start()
+
+	// This is run in a goroutine
+	a.OnlinestreamRepository.StartHealthChecks()
+
 	// +---------------------+
 	// |    Auto Scanner     |
 	// +---------------------+
@@ -255,6 +322,10 @@ func (a *App) initModulesOnce() {
 				_, _ = a.RefreshAnimeCollection()
 			}()
 		},
+		OnScanCompleted: func(lfs []*anime.LocalFile) {
+			go a.NfoExporter.OnScanCompleted(lfs)
+			a.IntegrityManager.OnScanCompleted(lfs)
+		},
 	})
 
 	// This is run in a goroutine
@@ -266,6 +337,7 @@ func (a *App) initModulesOnce() {
 
 	a.NakamaManager = nakama.NewManager(&nakama.NewManagerOptions{
 		Logger:                  a.Logger,
+		Database:                a.Database,
 		WSEventManager:          a.WSEventManager,
 		PlaybackManager:         a.PlaybackManager,
 		TorrentstreamRepository: a.TorrentstreamRepository,
@@ -279,6 +351,16 @@ func (a *App) initModulesOnce() {
 		IsOfflineRef:            util.NewRef(false),
 	})
 
+	a.NakamaLibrarySync = nakama_librarysync.NewManager(&nakama_librarysync.NewManagerOptions{
+		Logger:         a.Logger,
+		Database:       a.Database,
+		WSEventManager: a.WSEventManager,
+		Host:           a.NakamaManager,
+	})
+
+	// This is run in a goroutine
+	a.NakamaLibrarySync.Start()
+
 	// +---------------------+
 	// |      Playlist       |
 	// +---------------------+
@@ -378,7 +460,14 @@ func (a *App) InitOrRefreshModules() {
 
 		if a.Updater != nil {
 			a.Updater.SetEnabled(!settings.Library.DisableUpdateCheck)
+			a.Updater.SetChannel(settings.Library.UpdateChannel, settings.Library.UpdatePinnedVersion)
 		}
+		if a.SelfUpdater != nil {
+			a.SelfUpdater.SetChannel(settings.Library.UpdateChannel, settings.Library.UpdatePinnedVersion)
+		}
+
+		// Only probe the online-stream providers if online streaming is enabled
+		a.OnlinestreamRepository.SetHealthChecksEnabled(settings.Library.EnableOnlinestream)
 
 		// Refresh auto scanner settings (thread safe)
 		if a.AutoScanner != nil {
@@ -508,6 +597,8 @@ func (a *App) InitOrRefreshModules() {
 
 		// Set AutoDownloader qBittorrent client
 		a.AutoDownloader.SetTorrentClientRepository(a.TorrentClientRepository)
+		a.IntegrityManager.SetTorrentClientRepository(a.TorrentClientRepository)
+		a.RetentionManager.SetTorrentClientRepository(a.TorrentClientRepository)
 
 		plugin.GlobalAppContext.SetModulesPartial(plugin.AppContextModules{
 			TorrentClientRepository: a.TorrentClientRepository,
@@ -559,6 +650,7 @@ func (a *App) InitOrRefreshModules() {
 
 	if settings.Nakama != nil {
 		go a.NakamaManager.SetSettings(settings.Nakama)
+		a.NakamaLibrarySync.SetBandwidthLimits(settings.Nakama.LibrarySyncBandwidthLimit, settings.Nakama.HostLibrarySyncBandwidthLimit)
 	}
 
 	a.Logger.Info().Msg("app: Refreshed modules")
@@ -592,6 +684,9 @@ func (a *App) InitOrRefreshMediastreamSettings() {
 
 	a.MediastreamRepository.InitializeModules(settings, a.Config.Cache.Dir, a.Config.Cache.TranscodeDir)
 
+	a.IntegrityManager.SetFfprobePath(cmp.Or(settings.FfprobePath, "ffprobe"))
+	a.OnlinestreamDownloader.SetFfmpegPath(cmp.Or(settings.FfmpegPath, "ffmpeg"))
+
 	// Cleanup cache
 	go func() {
 		if settings.TranscodeEnabled {
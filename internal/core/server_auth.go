@@ -0,0 +1,48 @@
+package core
+
+import (
+	"seanime/internal/serverauth"
+
+	"github.com/rs/zerolog"
+)
+
+func getServerAuthOptions(cfg *Config, logger *zerolog.Logger) *serverauth.NewManagerOptions {
+	opts := &serverauth.NewManagerOptions{
+		Logger:       logger,
+		AllowedUsers: cfg.Server.Auth.AllowedUsers,
+	}
+
+	if cfg.Server.Auth.Oidc.Enabled {
+		opts.OIDC = &serverauth.OIDCOptions{
+			Issuer:        cfg.Server.Auth.Oidc.Issuer,
+			ClientID:      cfg.Server.Auth.Oidc.ClientID,
+			ClientSecret:  cfg.Server.Auth.Oidc.ClientSecret,
+			Scopes:        cfg.Server.Auth.Oidc.Scopes,
+			UsernameClaim: cfg.Server.Auth.Oidc.UsernameClaim,
+		}
+		logger.Info().Str("issuer", cfg.Server.Auth.Oidc.Issuer).Msg("app: OpenID Connect sign-in enabled")
+	}
+
+	if cfg.Server.Auth.TrustedProxy.Enabled {
+		opts.TrustedProxy = &serverauth.TrustedProxyOptions{
+			Header:       cfg.Server.Auth.TrustedProxy.Header,
+			EmailHeader:  cfg.Server.Auth.TrustedProxy.EmailHeader,
+			AllowedCIDRs: cfg.Server.Auth.TrustedProxy.AllowedCIDRs,
+		}
+		logger.Info().Strs("allowedCidrs", cfg.Server.Auth.TrustedProxy.AllowedCIDRs).Msg("app: Trusted proxy sign-in enabled")
+	}
+
+	return opts
+}
+
+// getAuthSecret returns the base secret used to sign URLs.
+// Without a server password, a random secret is used when the server requires OIDC or trusted proxy authentication.
+func (a *App) getAuthSecret() string {
+	if a.Config != nil && a.Config.Server.Password != "" {
+		return a.ServerPasswordHash
+	}
+	if a.ServerAuthManager != nil && a.ServerAuthManager.IsEnabled() {
+		return a.ServerAuthManager.Secret()
+	}
+	return "seanime-default-secret"
+}
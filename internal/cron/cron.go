@@ -20,6 +20,8 @@ func RunJobs(app *core.App) {
 	refreshLocalDataTicker := time.NewTicker(30 * time.Minute)
 	refetchReleaseTicker := time.NewTicker(1 * time.Hour)
 	refetchAnnouncementsTicker := time.NewTicker(10 * time.Minute)
+	backupTicker := time.NewTicker(1 * time.Hour)
+	retentionTicker := time.NewTicker(1 * time.Hour)
 
 	go func() {
 		for {
@@ -70,4 +72,25 @@ func RunJobs(app *core.App) {
 		}
 	}()
 
+	go func() {
+		for {
+			select {
+			case <-backupTicker.C:
+				app.BackupManager.RunScheduledBackup()
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-retentionTicker.C:
+				if app.IsOffline() {
+					continue
+				}
+				app.RetentionManager.RunScheduled()
+			}
+		}
+	}()
+
 }
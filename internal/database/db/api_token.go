@@ -0,0 +1,46 @@
+package db
+
+import (
+	"seanime/internal/database/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (db *Database) GetApiTokens() ([]*models.ApiToken, error) {
+	var res []*models.ApiToken
+	err := db.gormdb.Order("created_at desc").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (db *Database) GetApiTokenByHash(tokenHash string) (*models.ApiToken, error) {
+	var res models.ApiToken
+	err := db.gormdb.Where("token_hash = ?", tokenHash).First(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (db *Database) InsertApiToken(token *models.ApiToken) error {
+	return db.gormdb.Create(token).Error
+}
+
+func (db *Database) DeleteApiToken(id uint) error {
+	res := db.gormdb.Delete(&models.ApiToken{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateApiTokenLastUsed updates the last-used timestamp without changing updated_at.
+func (db *Database) UpdateApiTokenLastUsed(id uint, lastUsedAt time.Time) error {
+	return db.gormdb.Model(&models.ApiToken{}).Where("id = ?", id).UpdateColumn("last_used_at", lastUsedAt).Error
+}
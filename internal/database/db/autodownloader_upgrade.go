@@ -0,0 +1,45 @@
+package db
+
+import (
+	"seanime/internal/database/models"
+)
+
+func (db *Database) GetAutoDownloaderUpgrades() ([]*models.AutoDownloaderUpgrade, error) {
+	var res []*models.AutoDownloaderUpgrade
+	err := db.gormdb.Order("id desc").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (db *Database) GetAutoDownloaderUpgradesByStatus(status string) ([]*models.AutoDownloaderUpgrade, error) {
+	var res []*models.AutoDownloaderUpgrade
+	err := db.gormdb.Where("status = ?", status).Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (db *Database) GetAutoDownloaderUpgradesByMediaId(mId int) ([]*models.AutoDownloaderUpgrade, error) {
+	var res []*models.AutoDownloaderUpgrade
+	err := db.gormdb.Where("media_id = ?", mId).Order("id").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (db *Database) InsertAutoDownloaderUpgrade(upgrade *models.AutoDownloaderUpgrade) error {
+	return db.gormdb.Create(upgrade).Error
+}
+
+func (db *Database) UpdateAutoDownloaderUpgrade(upgrade *models.AutoDownloaderUpgrade) error {
+	return db.gormdb.Save(upgrade).Error
+}
+
+// DeleteFinishedAutoDownloaderUpgrades deletes the upgrade history, pending upgrades are kept.
+func (db *Database) DeleteFinishedAutoDownloaderUpgrades() error {
+	return db.gormdb.Where("status <> ?", "pending").Delete(&models.AutoDownloaderUpgrade{}).Error
+}
@@ -95,7 +95,9 @@ func migrateTables(db *gorm.DB) error {
 		&models.AutoSelectProfile{},
 		&models.AutoDownloaderRule{},
 		&models.AutoDownloaderProfile{},
+		&models.AutoDownloaderRuleTemplate{},
 		&models.AutoDownloaderItem{},
+		&models.AutoDownloaderUpgrade{},
 		&models.SilencedMediaEntry{},
 		&models.Theme{},
 		&models.PlaylistEntry{}, // Legacy playlists
@@ -113,6 +115,12 @@ func migrateTables(db *gorm.DB) error {
 		&models.CustomSourceCollection{},
 		&models.CustomSourceIdentifier{},
 		&models.MediaMetadataParent{},
+		&models.LocalFileHealth{},
+		&models.NfoExportedFile{},
+		&models.OnlinestreamDownload{},
+		&models.NakamaLibraryDownload{},
+		&models.WatchPartyHistory{},
+		&models.ApiToken{},
 		//&models.MangaChapterContainer{},
 	)
 	if err != nil {
@@ -123,6 +131,12 @@ func migrateTables(db *gorm.DB) error {
 	return nil
 }
 
+// Snapshot writes a consistent copy of the database to the given path.
+// The file must not exist.
+func (db *Database) Snapshot(dest string) error {
+	return db.gormdb.Exec("VACUUM INTO ?", dest).Error
+}
+
 // RunDatabaseCleanup runs all database cleanup operations
 func (db *Database) RunDatabaseCleanup() {
 	db.cleanupManager.RunAllCleanupOperations()
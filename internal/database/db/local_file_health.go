@@ -0,0 +1,40 @@
+package db
+
+import (
+	"seanime/internal/database/models"
+
+	"gorm.io/gorm/clause"
+)
+
+func (db *Database) GetLocalFileHealthReports() ([]*models.LocalFileHealth, error) {
+	var res []*models.LocalFileHealth
+	err := db.gormdb.Order("path").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (db *Database) GetLocalFileHealth(path string) (*models.LocalFileHealth, error) {
+	var res models.LocalFileHealth
+	err := db.gormdb.Where("path = ?", path).First(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UpsertLocalFileHealth saves the report, replacing the previous report of the same file.
+func (db *Database) UpsertLocalFileHealth(report *models.LocalFileHealth) error {
+	return db.gormdb.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "media_id", "episode", "size", "mod_time", "expected_crc32", "actual_crc32", "status", "error", "checked_at"}),
+	}).Create(report).Error
+}
+
+func (db *Database) DeleteLocalFileHealthReports(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.gormdb.Delete(&models.LocalFileHealth{}, ids).Error
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"seanime/internal/database/models"
+)
+
+func (db *Database) GetNakamaLibraryDownloads() ([]*models.NakamaLibraryDownload, error) {
+	var res []*models.NakamaLibraryDownload
+	err := db.gormdb.Order("id").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetNakamaLibraryDownloadsByStatus returns the downloads with the given statuses, oldest first.
+func (db *Database) GetNakamaLibraryDownloadsByStatus(statuses ...string) ([]*models.NakamaLibraryDownload, error) {
+	var res []*models.NakamaLibraryDownload
+	err := db.gormdb.Where("status IN ?", statuses).Order("id").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (db *Database) GetNakamaLibraryDownload(id uint) (*models.NakamaLibraryDownload, error) {
+	var res models.NakamaLibraryDownload
+	err := db.gormdb.First(&res, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (db *Database) SaveNakamaLibraryDownload(download *models.NakamaLibraryDownload) error {
+	return db.gormdb.Save(download).Error
+}
+
+func (db *Database) DeleteNakamaLibraryDownload(id uint) error {
+	return db.gormdb.Delete(&models.NakamaLibraryDownload{}, id).Error
+}
@@ -0,0 +1,31 @@
+package db
+
+import (
+	"seanime/internal/database/models"
+
+	"gorm.io/gorm/clause"
+)
+
+func (db *Database) GetNfoExportedFiles() ([]*models.NfoExportedFile, error) {
+	var res []*models.NfoExportedFile
+	err := db.gormdb.Order("path").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UpsertNfoExportedFile saves the exported file, replacing the previous entry of the same path.
+func (db *Database) UpsertNfoExportedFile(file *models.NfoExportedFile) error {
+	return db.gormdb.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "media_id", "kind", "hash"}),
+	}).Create(file).Error
+}
+
+func (db *Database) DeleteNfoExportedFiles(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.gormdb.Delete(&models.NfoExportedFile{}, ids).Error
+}
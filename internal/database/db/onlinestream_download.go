@@ -0,0 +1,41 @@
+package db
+
+import (
+	"seanime/internal/database/models"
+)
+
+func (db *Database) GetOnlinestreamDownloads() ([]*models.OnlinestreamDownload, error) {
+	var res []*models.OnlinestreamDownload
+	err := db.gormdb.Order("id").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetOnlinestreamDownloadsByStatus returns the downloads with the given statuses, oldest first.
+func (db *Database) GetOnlinestreamDownloadsByStatus(statuses ...string) ([]*models.OnlinestreamDownload, error) {
+	var res []*models.OnlinestreamDownload
+	err := db.gormdb.Where("status IN ?", statuses).Order("id").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (db *Database) GetOnlinestreamDownload(id uint) (*models.OnlinestreamDownload, error) {
+	var res models.OnlinestreamDownload
+	err := db.gormdb.First(&res, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (db *Database) SaveOnlinestreamDownload(download *models.OnlinestreamDownload) error {
+	return db.gormdb.Save(download).Error
+}
+
+func (db *Database) DeleteOnlinestreamDownload(id uint) error {
+	return db.gormdb.Delete(&models.OnlinestreamDownload{}, id).Error
+}
@@ -0,0 +1,23 @@
+package db
+
+import (
+	"seanime/internal/database/models"
+)
+
+// GetWatchPartyHistory returns the recorded watch party sessions, most recent first.
+func (db *Database) GetWatchPartyHistory() ([]*models.WatchPartyHistory, error) {
+	var res []*models.WatchPartyHistory
+	err := db.gormdb.Order("started_at desc").Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (db *Database) SaveWatchPartyHistory(history *models.WatchPartyHistory) error {
+	return db.gormdb.Save(history).Error
+}
+
+func (db *Database) DeleteWatchPartyHistory(id uint) error {
+	return db.gormdb.Delete(&models.WatchPartyHistory{}, id).Error
+}
@@ -0,0 +1,81 @@
+package db_bridge
+
+import (
+	"seanime/internal/database/db"
+	"seanime/internal/database/models"
+	"seanime/internal/library/anime"
+
+	"github.com/goccy/go-json"
+)
+
+func GetAutoDownloaderRuleTemplates(db *db.Database) ([]*anime.AutoDownloaderRuleTemplate, error) {
+
+	var res []*models.AutoDownloaderRuleTemplate
+	err := db.Gorm().Find(&res).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the data
+	var templates []*anime.AutoDownloaderRuleTemplate
+	for _, r := range res {
+		smBytes := r.Value
+		var sm anime.AutoDownloaderRuleTemplate
+		if err := json.Unmarshal(smBytes, &sm); err != nil {
+			return nil, err
+		}
+		sm.DbID = r.ID
+		templates = append(templates, &sm)
+	}
+
+	return templates, nil
+}
+
+func GetAutoDownloaderRuleTemplate(db *db.Database, id uint) (*anime.AutoDownloaderRuleTemplate, error) {
+	var res models.AutoDownloaderRuleTemplate
+	err := db.Gorm().First(&res, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the data
+	smBytes := res.Value
+	var sm anime.AutoDownloaderRuleTemplate
+	if err := json.Unmarshal(smBytes, &sm); err != nil {
+		return nil, err
+	}
+	sm.DbID = res.ID
+
+	return &sm, nil
+}
+
+func InsertAutoDownloaderRuleTemplate(db *db.Database, sm *anime.AutoDownloaderRuleTemplate) error {
+
+	// Marshal the data
+	bytes, err := json.Marshal(sm)
+	if err != nil {
+		return err
+	}
+
+	// Save the data
+	return db.Gorm().Create(&models.AutoDownloaderRuleTemplate{
+		Value: bytes,
+	}).Error
+}
+
+func DeleteAutoDownloaderRuleTemplate(db *db.Database, id uint) error {
+
+	return db.Gorm().Delete(&models.AutoDownloaderRuleTemplate{}, id).Error
+}
+
+func UpdateAutoDownloaderRuleTemplate(db *db.Database, id uint, sm *anime.AutoDownloaderRuleTemplate) error {
+
+	// Marshal the data
+	bytes, err := json.Marshal(sm)
+	if err != nil {
+		return err
+	}
+
+	// Save the data
+	return db.Gorm().Model(&models.AutoDownloaderRuleTemplate{}).Where("id = ?", id).Update("value", bytes).Error
+}
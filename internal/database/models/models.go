@@ -99,6 +99,9 @@ type LibrarySettings struct {
 	// v3.5+
 	ScannerUseLegacyMatching bool   `gorm:"column:scanner_use_legacy_matching" json:"scannerUseLegacyMatching"`
 	ScannerConfig            string `gorm:"column:scanner_config" json:"scannerConfig"`
+	// Release channel used by the updater, "stable", "beta" or "pinned"
+	UpdateChannel       string `gorm:"column:update_channel" json:"updateChannel"`
+	UpdatePinnedVersion string `gorm:"column:update_pinned_version" json:"updatePinnedVersion"`
 }
 
 func (o *LibrarySettings) GetLibraryPaths() (ret []string) {
@@ -144,6 +147,12 @@ type NakamaSettings struct {
 	HostUnsharedAnimeIds IntSlice `gorm:"column:host_unshared_anime_ids;type:text" json:"hostUnsharedAnimeIds"`
 	// HostEnablePortForwarding enables port forwarding.
 	HostEnablePortForwarding bool `gorm:"column:host_enable_port_forwarding" json:"hostEnablePortForwarding"`
+	// RoomsRelayURL is the URL of a self-hosted rooms relay, the Seanime Rooms API is used if empty.
+	RoomsRelayURL string `gorm:"column:rooms_relay_url" json:"roomsRelayUrl"`
+	// HostLibrarySyncBandwidthLimit limits the upload rate of the files copied by the peers, in KiB/s. 0 means no limit.
+	HostLibrarySyncBandwidthLimit int `gorm:"column:host_library_sync_bandwidth_limit" json:"hostLibrarySyncBandwidthLimit"`
+	// LibrarySyncBandwidthLimit limits the download rate of the files copied from the host, in KiB/s. 0 means no limit.
+	LibrarySyncBandwidthLimit int `gorm:"column:library_sync_bandwidth_limit" json:"librarySyncBandwidthLimit"`
 }
 
 type IntSlice []int
@@ -275,6 +284,11 @@ type AutoDownloaderProfile struct {
 	Value []byte `gorm:"column:value" json:"value"`
 }
 
+type AutoDownloaderRuleTemplate struct {
+	BaseModel
+	Value []byte `gorm:"column:value" json:"value"`
+}
+
 // +---------------------+
 // |     Auto Select     |
 // +---------------------+
@@ -300,6 +314,22 @@ type AutoDownloaderItem struct {
 	TorrentData []byte    `gorm:"column:torrent_data" json:"-"` // Serialized NormalizedTorrent
 }
 
+// AutoDownloaderUpgrade records the replacement of a library file by a better release.
+type AutoDownloaderUpgrade struct {
+	BaseModel
+	RuleID         uint       `gorm:"column:rule_id" json:"ruleId"`
+	MediaID        int        `gorm:"column:media_id;index" json:"mediaId"`
+	Episode        int        `gorm:"column:episode" json:"episode"`
+	OldPath        string     `gorm:"column:old_path" json:"oldPath"`
+	OldTorrentHash string     `gorm:"column:old_torrent_hash" json:"oldTorrentHash"`
+	NewHash        string     `gorm:"column:new_hash" json:"newHash"`
+	NewTorrentName string     `gorm:"column:new_torrent_name" json:"newTorrentName"`
+	Reason         string     `gorm:"column:reason" json:"reason"`
+	Status         string     `gorm:"column:status;index" json:"status"` // "pending", "completed", "failed"
+	Error          string     `gorm:"column:error" json:"error,omitempty"`
+	CompletedAt    *time.Time `gorm:"column:completed_at" json:"completedAt,omitempty"`
+}
+
 type AutoDownloaderSettings struct {
 	Provider              string `gorm:"column:auto_downloader_provider" json:"provider"`
 	Interval              int    `gorm:"column:auto_downloader_interval" json:"interval"`
@@ -309,6 +339,10 @@ type AutoDownloaderSettings struct {
 	EnableEnhancedQueries bool `gorm:"column:auto_downloader_enable_enhanced_queries" json:"enableEnhancedQueries"`
 	EnableSeasonCheck     bool `gorm:"column:auto_downloader_enable_season_check" json:"enableSeasonCheck"`
 	UseDebrid             bool `gorm:"column:auto_downloader_use_debrid" json:"useDebrid"`
+	// EnableBatchFallback If true, batches are downloaded for the missing episodes of finished shows
+	EnableBatchFallback bool `gorm:"column:auto_downloader_enable_batch_fallback" json:"enableBatchFallback"`
+	// EnableAiringSchedule If true, the check interval follows the airing schedule of the ruled shows
+	EnableAiringSchedule bool `gorm:"column:auto_downloader_enable_airing_schedule" json:"enableAiringSchedule"`
 }
 
 // +---------------------+
@@ -582,6 +616,98 @@ type MediaMetadataParent struct {
 	SpecialOffset int `gorm:"column:special_offset" json:"specialOffset"`
 }
 
+// +---------------------+
+// |      Integrity      |
+// +---------------------+
+
+// LocalFileHealth is the result of the last integrity check of a local file.
+type LocalFileHealth struct {
+	BaseModel
+	Path          string    `gorm:"column:path;uniqueIndex" json:"path"`
+	MediaId       int       `gorm:"column:media_id;index" json:"mediaId"`
+	Episode       int       `gorm:"column:episode" json:"episode"`
+	Size          int64     `gorm:"column:size" json:"size"`
+	ModTime       time.Time `gorm:"column:mod_time" json:"modTime"`
+	ExpectedCrc32 string    `gorm:"column:expected_crc32" json:"expectedCrc32"`
+	ActualCrc32   string    `gorm:"column:actual_crc32" json:"actualCrc32"`
+	Status        string    `gorm:"column:status;index" json:"status"`
+	Error         string    `gorm:"column:error" json:"error"`
+	CheckedAt     time.Time `gorm:"column:checked_at" json:"checkedAt"`
+}
+
+// NfoExportedFile is a file written by the NFO exporter.
+// Only these files are updated or removed by the exporter, files created by other tools are left untouched.
+type NfoExportedFile struct {
+	BaseModel
+	Path    string `gorm:"column:path;uniqueIndex" json:"path"`
+	MediaId int    `gorm:"column:media_id;index" json:"mediaId"`
+	Kind    string `gorm:"column:kind" json:"kind"` // "tvshow", "episode", "movie", "poster", "fanart"
+	// Hash is the hash of the content of NFO files, or of the source URL of artwork
+	Hash string `gorm:"column:hash" json:"hash"`
+}
+
+// OnlinestreamDownload is an episode queued by the online-stream downloader.
+type OnlinestreamDownload struct {
+	BaseModel
+	MediaId       int    `gorm:"column:media_id;index" json:"mediaId"`
+	EpisodeNumber int    `gorm:"column:episode_number" json:"episodeNumber"`
+	Provider      string `gorm:"column:provider" json:"provider"`
+	Dubbed        bool   `gorm:"column:dubbed" json:"dubbed"`
+	// Preferred quality (e.g. "1080p") and server, the best available source is used if empty
+	Quality string `gorm:"column:quality" json:"quality"`
+	Server  string `gorm:"column:server" json:"server"`
+	// Directory is the library directory in which the episode is saved
+	Directory string `gorm:"column:directory" json:"directory"`
+	Status    string `gorm:"column:status;index" json:"status"` // "queued", "downloading", "completed", "failed", "cancelled"
+	// Path is the path of the finished file
+	Path  string `gorm:"column:path" json:"path"`
+	Error string `gorm:"column:error" json:"error"`
+}
+
+// NakamaLibraryDownload is a file of the Nakama host's anime library queued to be copied to the library of this peer.
+type NakamaLibraryDownload struct {
+	BaseModel
+	MediaId int `gorm:"column:media_id;index" json:"mediaId"`
+	// HostPath is the path of the file on the host
+	HostPath string `gorm:"column:host_path" json:"hostPath"`
+	// Path is the destination of the file in the library
+	Path         string `gorm:"column:path" json:"path"`
+	Episode      int    `gorm:"column:episode" json:"episode"`
+	AniDBEpisode string `gorm:"column:anidb_episode" json:"aniDBEpisode"`
+	// LocalFile is the JSON-encoded local file of the host, it's added to the local files once the file is copied
+	LocalFile []byte `gorm:"column:local_file" json:"-"`
+	Status    string `gorm:"column:status;index" json:"status"` // "queued", "downloading", "completed", "failed", "cancelled"
+	Error     string `gorm:"column:error" json:"error"`
+}
+
+// WatchPartyHistory is a finished Nakama watch party session, recorded by the host.
+type WatchPartyHistory struct {
+	BaseModel
+	SessionId string    `gorm:"column:session_id;index" json:"sessionId"`
+	StartedAt time.Time `gorm:"column:started_at" json:"startedAt"`
+	EndedAt   time.Time `gorm:"column:ended_at" json:"endedAt"`
+	// Participants is the JSON-encoded list of users who joined the session
+	Participants []byte `gorm:"column:participants" json:"participants"`
+	// Episodes is the JSON-encoded list of episodes played during the session
+	Episodes []byte `gorm:"column:episodes" json:"episodes"`
+	// ChatLog is the JSON-encoded list of chat messages
+	ChatLog []byte `gorm:"column:chat_log" json:"chatLog"`
+}
+
+// ApiToken is a personal API token used by scripts and automations.
+// Only the SHA-256 hash of the token is stored.
+type ApiToken struct {
+	BaseModel
+	Name      string `gorm:"column:name" json:"name"`
+	TokenHash string `gorm:"column:token_hash;uniqueIndex" json:"-"`
+	// Prefix is the beginning of the token, used to identify it
+	Prefix string `gorm:"column:prefix" json:"prefix"`
+	// Scopes are the features the token can access
+	Scopes     StringSlice `gorm:"column:scopes;type:text" json:"scopes"`
+	ExpiresAt  *time.Time  `gorm:"column:expires_at" json:"expiresAt"` // Never expires if nil
+	LastUsedAt *time.Time  `gorm:"column:last_used_at" json:"lastUsedAt"`
+}
+
 ///////////////////////////////////////////////////////////////////////////
 
 type StringSlice []string
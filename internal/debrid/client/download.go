@@ -20,6 +20,7 @@ import (
 	"seanime/internal/util/result"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -143,6 +144,7 @@ func (r *Repository) downloadTorrentItem(tId string, torrentName string, destina
 		downloadUrls := strings.Split(downloadUrl, ",")
 		downloadMap := result.NewMap[string, downloadStatus]()
 
+		failed := atomic.Bool{}
 		for _, url := range downloadUrls {
 			wg.Add(1)
 			go func(ctx context.Context, url string) {
@@ -151,12 +153,22 @@ func (r *Repository) downloadTorrentItem(tId string, torrentName string, destina
 				// Download the file
 				ok := r.downloadFile(ctx, tId, url, destination, downloadMap)
 				if !ok {
+					failed.Store(true)
 					return
 				}
 			}(ctx, url)
 		}
 		wg.Wait()
 
+		switch {
+		case ctx.Err() != nil:
+			downloadsCounter.With("cancelled").Inc()
+		case failed.Load():
+			downloadsCounter.With("failed").Inc()
+		default:
+			downloadsCounter.With("completed").Inc()
+		}
+
 		r.sendDownloadCompletedEvent(tId)
 		notifier.GlobalNotifier.Notify(notifier.Debrid, fmt.Sprintf("Downloaded %q", torrentName))
 	}(ctx)
@@ -292,6 +304,7 @@ func (r *Repository) downloadFile(ctx context.Context, tId string, downloadUrl s
 				return false
 			}
 			totalBytes += int64(n)
+			downloadedBytesCounter.With().Add(float64(n))
 			if totalSize > 0 {
 				speed = int((totalBytes - lastBytes) / 1024) // KB/s
 				lastBytes = totalBytes
@@ -0,0 +1,51 @@
+package debrid_client
+
+import (
+	"seanime/internal/events"
+	"seanime/internal/metrics"
+)
+
+var (
+	downloadsCounter = metrics.NewCounterVec(
+		"debrid_downloads_total",
+		"Number of local downloads of debrid torrents that ended, by result.",
+		"result",
+	)
+	downloadedBytesCounter = metrics.NewCounterVec(
+		"debrid_downloaded_bytes_total",
+		"Bytes downloaded from the debrid service.",
+	)
+	streamStatesCounter = metrics.NewCounterVec(
+		"debrid_stream_states_total",
+		"Number of debrid stream state changes, by status.",
+		"status",
+	)
+)
+
+// registerMetrics exposes the number of local downloads in progress and whether a debrid stream is active.
+// The values are read when the metrics are scraped, the latest repository replaces the previous one.
+func (r *Repository) registerMetrics() {
+	metrics.NewGaugeFunc("debrid_active_downloads", "Number of debrid torrents being downloaded locally.", func() float64 {
+		return float64(len(r.ctxMap.Keys()))
+	})
+
+	metrics.NewGaugeFunc("debrid_active_streams", "Number of active debrid streams.", func() float64 {
+		if _, ok := r.GetStreamURL(); ok {
+			return 1
+		}
+		return 0
+	})
+}
+
+// sendStreamState sends the state of the stream to the client.
+// Repeated states, e.g. download progress, are only counted once.
+func (s *StreamManager) sendStreamState(state StreamState) {
+	s.statusMu.Lock()
+	if s.currentStatus != state.Status {
+		s.currentStatus = state.Status
+		streamStatesCounter.With(string(state.Status)).Inc()
+	}
+	s.statusMu.Unlock()
+
+	s.repository.wsEventManager.SendEvent(events.DebridStreamState, state)
+}
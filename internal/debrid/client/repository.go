@@ -85,6 +85,7 @@ func NewRepository(opts *NewRepositoryOptions) (ret *Repository) {
 	}
 
 	ret.streamManager = NewStreamManager(ret)
+	ret.registerMetrics()
 
 	ret.autoSelect = autoselect.New(&autoselect.NewAutoSelectOptions{
 		Logger:            opts.Logger,
@@ -27,6 +27,9 @@ type (
 
 		currentStreamUrl string
 
+		statusMu      sync.Mutex
+		currentStatus StreamStatus
+
 		playbackSubscriberCtxCancelFunc context.CancelFunc
 	}
 
@@ -138,7 +141,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 
 	if opts.AutoSelect {
 
-		s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+		s.sendStreamState(StreamState{
 			Status:      StreamStatusDownloading,
 			TorrentName: "-",
 			Message:     "Selecting best torrent...",
@@ -149,7 +152,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 			if opts.PlaybackType == PlaybackTypeNativePlayer {
 				s.repository.directStreamManager.AbortOpen(opts.ClientId, err)
 			}
-			s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+			s.sendStreamState(StreamState{
 				Status:      StreamStatusFailed,
 				TorrentName: "-",
 				Message:     fmt.Sprintf("Failed to select best torrent, %v", err),
@@ -167,7 +170,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 			return fmt.Errorf("debridstream: Failed to start stream, no torrent provided")
 		}
 
-		s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+		s.sendStreamState(StreamState{
 			Status:      StreamStatusDownloading,
 			TorrentName: selectedTorrent.Name,
 			Message:     "Analyzing selected torrent...",
@@ -184,7 +187,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 				if opts.PlaybackType == PlaybackTypeNativePlayer {
 					s.repository.directStreamManager.AbortOpen(opts.ClientId, err)
 				}
-				s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+				s.sendStreamState(StreamState{
 					Status:      StreamStatusFailed,
 					TorrentName: selectedTorrent.Name,
 					Message:     fmt.Sprintf("Failed to analyze torrent, %v", err),
@@ -206,7 +209,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 		return fmt.Errorf("debridstream: Failed to start stream, no torrent provided")
 	}
 
-	s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+	s.sendStreamState(StreamState{
 		Status:      StreamStatusDownloading,
 		TorrentName: selectedTorrent.Name,
 		Message:     "Adding torrent...",
@@ -219,7 +222,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 		SelectFileId: fileId, // RD-only, download only the selected file
 	})
 	if err != nil {
-		s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+		s.sendStreamState(StreamState{
 			Status:      StreamStatusFailed,
 			TorrentName: selectedTorrent.Name,
 			Message:     fmt.Sprintf("Failed to add torrent, %v", err),
@@ -260,7 +263,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 
 		s.repository.logger.Debug().Msg("debridstream: Listening to torrent status")
 
-		s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+		s.sendStreamState(StreamState{
 			Status:      StreamStatusDownloading,
 			TorrentName: selectedTorrent.Name,
 			Message:     fmt.Sprintf("Downloading torrent..."),
@@ -274,7 +277,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 					s.repository.directStreamManager.PrepareNewStream(opts.ClientId, fmt.Sprintf("Awaiting stream: %d%%", item.CompletionPercentage))
 				}
 
-				s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+				s.sendStreamState(StreamState{
 					Status:      StreamStatusDownloading,
 					TorrentName: item.Name,
 					Message:     fmt.Sprintf("Downloading torrent: %d%%", item.CompletionPercentage),
@@ -302,7 +305,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 		if err != nil {
 			s.repository.logger.Err(err).Msg("debridstream: Failed to get stream URL")
 			if !errors.Is(err, context.Canceled) {
-				s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+				s.sendStreamState(StreamState{
 					Status:      StreamStatusFailed,
 					TorrentName: selectedTorrent.Name,
 					Message:     fmt.Sprintf("Failed to get stream URL, %v", err),
@@ -323,7 +326,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 		// Default prevented, we check if we can stream the file
 		if skipCheckEvent.DefaultPrevented {
 			s.repository.logger.Debug().Msg("debridstream: Stream URL received, checking stream file")
-			s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+			s.sendStreamState(StreamState{
 				Status:      StreamStatusDownloading,
 				TorrentName: selectedTorrent.Name,
 				Message:     "Checking stream file...",
@@ -343,7 +346,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 						if retries >= skipCheckEvent.Retries {
 							s.repository.logger.Error().Msg("debridstream: Cannot stream the file")
 
-							s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+							s.sendStreamState(StreamState{
 								Status:      StreamStatusFailed,
 								TorrentName: selectedTorrent.Name,
 								Message:     fmt.Sprintf("Cannot stream this file: %s", reason),
@@ -351,7 +354,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 							return
 						}
 						s.repository.logger.Warn().Msg("debridstream: Rechecking stream file in 8 seconds")
-						s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+						s.sendStreamState(StreamState{
 							Status:      StreamStatusDownloading,
 							TorrentName: selectedTorrent.Name,
 							Message:     "Checking stream file...",
@@ -368,7 +371,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 		s.repository.logger.Debug().Msg("debridstream: Stream is ready")
 
 		// Signal to the client that the torrent is ready to stream
-		s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+		s.sendStreamState(StreamState{
 			Status:      StreamStatusReady,
 			TorrentName: selectedTorrent.Name,
 			Message:     "Ready to stream the file",
@@ -413,14 +416,14 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 		switch playbackType {
 		case PlaybackTypeNone:
 			// No playback type selected, just signal to the client that the stream is ready
-			s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+			s.sendStreamState(StreamState{
 				Status:      StreamStatusReady,
 				TorrentName: selectedTorrent.Name,
 				Message:     "External player link sent",
 			})
 		case PlaybackTypeNoneAndAwait:
 			// No playback type selected, just signal to the client that the stream is ready
-			s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+			s.sendStreamState(StreamState{
 				Status:      StreamStatusReady,
 				TorrentName: selectedTorrent.Name,
 				Message:     "External player link sent",
@@ -454,7 +457,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 					s.playbackSubscriberCtxCancelFunc = nil
 				}
 				// Failed to start the stream, we'll drop the torrents and stop the server
-				s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+				s.sendStreamState(StreamState{
 					Status:      StreamStatusFailed,
 					TorrentName: selectedTorrent.Name,
 					Message:     fmt.Sprintf("Failed to send the stream to the media player, %v", err),
@@ -504,7 +507,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 
 			// Signal to the client that the torrent has started playing (remove loading status)
 			// We can't know for sure
-			s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+			s.sendStreamState(StreamState{
 				Status:      StreamStatusReady,
 				TorrentName: selectedTorrent.Name,
 				Message:     "External player link sent",
@@ -538,7 +541,7 @@ func (s *StreamManager) startStream(ctx context.Context, opts *StartStreamOption
 		}()
 	}(ctx)
 
-	s.repository.wsEventManager.SendEvent(events.DebridStreamState, StreamState{
+	s.sendStreamState(StreamState{
 		Status:      StreamStatusStarted,
 		TorrentName: selectedTorrent.Name,
 		Message:     "Stream started",
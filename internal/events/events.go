@@ -57,6 +57,7 @@ const (
 
 	ExtensionsReloaded    = "extensions-reloaded"
 	ExtensionUpdatesFound = "extension-updates-found"
+	ExtensionRolledBack   = "extension-rolled-back"
 	PluginUnloaded        = "plugin-unloaded"
 	PluginLoaded          = "plugin-loaded"
 
@@ -66,6 +67,12 @@ const (
 	SyncLocalFinished   = "sync-local-finished"
 	SyncAnilistFinished = "sync-anilist-finished"
 
+	LocalEpisodeDownloadProgress = "local-episode-download-progress"
+
+	IntegrityCheckProgress = "integrity-check-progress"
+
+	OnlinestreamDownloadProgress = "onlinestream-download-progress"
+
 	TorrentStreamState = "torrentstream-state"
 
 	DebridDownloadProgress = "debrid-download-progress"
@@ -93,6 +100,7 @@ const (
 	NakamaRoomCreated          = "nakama-room-created"
 	NakamaRoomClosed           = "nakama-room-closed"
 	NakamaRoomReconnected      = "nakama-room-reconnected"
+	NakamaLibrarySyncProgress  = "nakama-library-sync-progress"
 
 	NakamaOnlineStreamEvent = "nakama-online-stream-event"
 
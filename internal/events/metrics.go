@@ -0,0 +1,16 @@
+package events
+
+import (
+	"seanime/internal/metrics"
+)
+
+var (
+	websocketClientsGauge = metrics.NewGaugeVec(
+		"websocket_clients",
+		"Number of connected websocket clients.",
+	)
+	websocketConnectionsCounter = metrics.NewCounterVec(
+		"websocket_connections_total",
+		"Number of websocket connections opened.",
+	)
+)
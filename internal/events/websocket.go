@@ -137,12 +137,15 @@ func (m *WSEventManager) AddConn(id string, conn *websocket.Conn) {
 		ID:   id,
 		Conn: conn,
 	})
+	websocketClientsGauge.With().Inc()
+	websocketConnectionsCounter.With().Inc()
 }
 
 func (m *WSEventManager) RemoveConn(id string) {
 	for i, conn := range m.Conns {
 		if conn.ID == id {
 			m.Conns = append(m.Conns[:i], m.Conns[i+1:]...)
+			websocketClientsGauge.With().Dec()
 			break
 		}
 	}
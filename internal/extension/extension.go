@@ -22,6 +22,8 @@ const (
 	LanguageJavascript Language = "javascript"
 	LanguageTypescript Language = "typescript"
 	LanguageGo         Language = "go"
+	// LanguageWasm is used for WebAssembly modules, the payload is the base64-encoded module.
+	LanguageWasm Language = "wasm"
 )
 
 type Extension struct {
@@ -66,6 +68,16 @@ type Extension struct {
 	PayloadURI string `json:"payloadURI,omitempty"`
 	// Plugin is the manifest of the extension if it is a plugin.
 	Plugin *PluginManifest `json:"plugin,omitempty"`
+	// Wasm is the manifest of the extension if it is a WebAssembly module.
+	Wasm *WasmManifest `json:"wasm,omitempty"`
+
+	// PayloadHash is the hex-encoded SHA-256 hash of the payload.
+	// If set, the downloaded payload must match it.
+	PayloadHash string `json:"payloadHash,omitempty"`
+	// Signature is the base64-encoded Ed25519 signature of the manifest (see extension_repo.ExtensionSigningMessage).
+	Signature string `json:"signature,omitempty"`
+	// PublicKey is the base64-encoded Ed25519 public key of the publisher.
+	PublicKey string `json:"publicKey,omitempty"`
 
 	// IsDevelopment is true if the extension is in development mode.
 	// If true, the extension code will be loaded from PayloadURI and allow you to edit the code from an editor and reload the extension without restarting the application.
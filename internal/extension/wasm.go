@@ -0,0 +1,27 @@
+package extension
+
+const (
+	WasmABIVersion = "1"
+)
+
+// WasmManifest is the manifest of a WebAssembly extension.
+//
+// The module must export its memory and the following functions:
+//   - seanime_alloc(size i32) i32: allocates a buffer in the module's memory
+//   - seanime_call(methodPtr i32, methodLen i32, inputPtr i32, inputLen i32) i64: calls a provider method
+//
+// The input is a JSON array of the method arguments, the output is a JSON object {"result": any, "error": string}.
+// Pointers and lengths are packed into an i64 as (ptr << 32) | len.
+//
+// The host exposes the following functions in the "seanime" module:
+//   - log(level i32, ptr i32, len i32)
+//   - fetch(reqPtr i32, reqLen i32) i64: performs an HTTP request, the request and response are JSON objects
+//   - get_user_config(keyPtr i32, keyLen i32) i64: returns the user config value, 0 if it isn't set
+type WasmManifest struct {
+	// ABIVersion is the version of the host ABI the module was built against.
+	ABIVersion string `json:"abiVersion"`
+	// Permissions asked by the module.
+	// Only network access is used by the WebAssembly runtime, if no domains are allowed, fetch is limited to the default whitelist.
+	// The user must acknowledge these permissions before the extension can be loaded.
+	Permissions PluginPermissions `json:"permissions,omitempty"`
+}
@@ -0,0 +1,477 @@
+package extension_repo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"seanime/internal/events"
+	"seanime/internal/extension"
+	"seanime/internal/util/filecache"
+	"sync/atomic"
+	"time"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Update policies
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+const (
+	ExtensionUpdateSettingsBucket = "extension-update-settings"
+	ExtensionUpdateSettingsKey    = "1"
+
+	// previousExtensionDir is the subdirectory of the extension directory holding the payloads replaced by the last update
+	previousExtensionDir = ".previous"
+
+	// An auto-updated extension is reverted if its provider fails this many times in a row during the probation period
+	updateProbationMaxErrors = 3
+	updateProbationDuration  = 24 * time.Hour
+)
+
+type ExtensionUpdatePolicy string
+
+const (
+	// ExtensionUpdatePolicyManual doesn't notify about updates, they're only listed when checking for updates
+	ExtensionUpdatePolicyManual ExtensionUpdatePolicy = "manual"
+	// ExtensionUpdatePolicyNotify notifies the client when an update is found (default)
+	ExtensionUpdatePolicyNotify ExtensionUpdatePolicy = "notify"
+	// ExtensionUpdatePolicyAuto installs updates when they're found and reverts them if they break the extension
+	ExtensionUpdatePolicyAuto ExtensionUpdatePolicy = "auto"
+)
+
+var ErrNoPreviousExtensionVersion = errors.New("no previous version to roll back to")
+
+type StoredExtensionUpdateSettings struct {
+	// Extension ID -> Policy
+	Policies map[string]ExtensionUpdatePolicy `json:"policies"`
+	// Extension ID -> Version that was rolled back, it won't be auto-installed again
+	RolledBackVersions map[string]string `json:"rolledBackVersions"`
+	// Extension ID -> Probation of the last auto-update, restored at startup
+	Probations map[string]*StoredUpdateProbation `json:"probations"`
+}
+
+type StoredUpdateProbation struct {
+	Version string    `json:"version"`
+	Until   time.Time `json:"until"`
+}
+
+type (
+	// ExtensionUpdateSettings is returned to the client
+	ExtensionUpdateSettings struct {
+		Policies           map[string]ExtensionUpdatePolicy `json:"policies"`
+		RolledBackVersions map[string]string                `json:"rolledBackVersions"`
+		// Extension ID -> Version that can be restored with RollbackExtension
+		PreviousVersions map[string]string `json:"previousVersions"`
+	}
+
+	UpdateAllExtensionsResponse struct {
+		Updated []string `json:"updated"`
+		// Extension ID -> Error
+		Failed map[string]string `json:"failed"`
+	}
+
+	ExtensionRolledBackEvent struct {
+		ExtensionID string `json:"extensionID"`
+		Version     string `json:"version"`
+		Reason      string `json:"reason"`
+	}
+
+	// updateProbation tracks an auto-updated extension until it's deemed stable
+	updateProbation struct {
+		version           string
+		until             time.Time
+		consecutiveErrors atomic.Int32
+		rolledBack        atomic.Bool
+	}
+)
+
+func (r *Repository) getStoredUpdateSettings() *StoredExtensionUpdateSettings {
+	bucket := filecache.NewPermanentBucket(ExtensionUpdateSettingsBucket)
+
+	var data *StoredExtensionUpdateSettings
+	found, _ := r.fileCacher.GetPerm(bucket, ExtensionUpdateSettingsKey, &data)
+	if !found || data == nil {
+		data = &StoredExtensionUpdateSettings{}
+	}
+	if data.Policies == nil {
+		data.Policies = make(map[string]ExtensionUpdatePolicy)
+	}
+	if data.RolledBackVersions == nil {
+		data.RolledBackVersions = make(map[string]string)
+	}
+	if data.Probations == nil {
+		data.Probations = make(map[string]*StoredUpdateProbation)
+	}
+
+	return data
+}
+
+func (r *Repository) saveStoredUpdateSettings(data *StoredExtensionUpdateSettings) error {
+	bucket := filecache.NewPermanentBucket(ExtensionUpdateSettingsBucket)
+	return r.fileCacher.SetPerm(bucket, ExtensionUpdateSettingsKey, data)
+}
+
+func (r *Repository) GetExtensionUpdateSettings() *ExtensionUpdateSettings {
+	data := r.getStoredUpdateSettings()
+
+	ret := &ExtensionUpdateSettings{
+		Policies:           data.Policies,
+		RolledBackVersions: data.RolledBackVersions,
+		PreviousVersions:   make(map[string]string),
+	}
+
+	entries, _ := os.ReadDir(r.previousExtensionDir())
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		ext, err := extractExtensionFromFile(filepath.Join(r.previousExtensionDir(), entry.Name()))
+		if err != nil {
+			continue
+		}
+		ret.PreviousVersions[ext.ID] = ext.Version
+	}
+
+	return ret
+}
+
+// GetExtensionUpdatePolicy returns the update policy of the extension, ExtensionUpdatePolicyNotify by default.
+func (r *Repository) GetExtensionUpdatePolicy(id string) ExtensionUpdatePolicy {
+	r.updateSettingsMu.Lock()
+	defer r.updateSettingsMu.Unlock()
+
+	if policy, ok := r.getStoredUpdateSettings().Policies[id]; ok {
+		return policy
+	}
+	return ExtensionUpdatePolicyNotify
+}
+
+func (r *Repository) SetExtensionUpdatePolicy(id string, policy ExtensionUpdatePolicy) error {
+	switch policy {
+	case ExtensionUpdatePolicyManual, ExtensionUpdatePolicyNotify, ExtensionUpdatePolicyAuto:
+	default:
+		return fmt.Errorf("invalid update policy: %s", policy)
+	}
+
+	r.updateSettingsMu.Lock()
+	defer r.updateSettingsMu.Unlock()
+
+	data := r.getStoredUpdateSettings()
+	if policy == ExtensionUpdatePolicyNotify {
+		delete(data.Policies, id)
+	} else {
+		data.Policies[id] = policy
+	}
+
+	return r.saveStoredUpdateSettings(data)
+}
+
+func (r *Repository) removeExtensionUpdateSettings(id string) {
+	r.updateSettingsMu.Lock()
+	defer r.updateSettingsMu.Unlock()
+
+	data := r.getStoredUpdateSettings()
+	delete(data.Policies, id)
+	delete(data.RolledBackVersions, id)
+	delete(data.Probations, id)
+	_ = r.saveStoredUpdateSettings(data)
+
+	_ = os.Remove(r.previousExtensionPath(id))
+	r.updateProbations.Delete(id)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Scheduled updates
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// applyUpdatePolicies installs the updates of extensions with the auto policy.
+// It returns the updates that are still pending and the ones the client should be notified about.
+func (r *Repository) applyUpdatePolicies(updates []UpdateData) (pending []UpdateData, notify []UpdateData) {
+	r.updateSettingsMu.Lock()
+	data := r.getStoredUpdateSettings()
+	r.updateSettingsMu.Unlock()
+
+	pending = make([]UpdateData, 0, len(updates))
+	notify = make([]UpdateData, 0, len(updates))
+
+	for _, update := range updates {
+		policy, ok := data.Policies[update.ExtensionID]
+		if !ok {
+			policy = ExtensionUpdatePolicyNotify
+		}
+
+		// Updates that need the publisher key to be approved and versions that were rolled back are never auto-installed
+		if policy == ExtensionUpdatePolicyAuto && update.TrustError == "" && data.RolledBackVersions[update.ExtensionID] != update.Version {
+			if err := r.autoUpdateExtension(update); err == nil {
+				continue
+			}
+			// Fall back to notifying the user
+			policy = ExtensionUpdatePolicyNotify
+		}
+
+		pending = append(pending, update)
+		if policy != ExtensionUpdatePolicyManual {
+			notify = append(notify, update)
+		}
+	}
+
+	return
+}
+
+// autoUpdateExtension installs the update and reverts it if the new version fails to load.
+func (r *Repository) autoUpdateExtension(update UpdateData) error {
+	r.logger.Info().Str("id", update.ExtensionID).Str("version", update.Version).Msg("extensions: Auto-updating extension")
+
+	if _, err := r.installExternalExtension(update.ManifestURI, ""); err != nil {
+		r.logger.Error().Err(err).Str("id", update.ExtensionID).Msg("extensions: Failed to auto-update extension")
+		return err
+	}
+
+	// The extension is reloaded synchronously by the install, check that it's still valid
+	if invalid, ok := r.invalidExtensions.Get(update.ExtensionID); ok && invalid.Code != extension.InvalidExtensionUserConfigError {
+		reason := fmt.Sprintf("failed to load: %s", invalid.Reason)
+		if err := r.rollbackFailedUpdate(update.ExtensionID, update.Version, reason); err != nil {
+			return err
+		}
+		return errors.New(reason)
+	}
+
+	r.setUpdateProbation(update.ExtensionID, update.Version, time.Now().Add(updateProbationDuration))
+
+	return nil
+}
+
+// UpdateAllExtensions checks for updates and installs all of them, regardless of their policies.
+// Updates that require the publisher key to be approved are skipped.
+func (r *Repository) UpdateAllExtensions() *UpdateAllExtensionsResponse {
+	ret := &UpdateAllExtensionsResponse{
+		Updated: make([]string, 0),
+		Failed:  make(map[string]string),
+	}
+
+	updates := r.checkForUpdates()
+	for _, update := range updates {
+		if update.TrustError != "" {
+			ret.Failed[update.ExtensionID] = update.TrustError
+			continue
+		}
+		if _, err := r.installExternalExtension(update.ManifestURI, ""); err != nil {
+			ret.Failed[update.ExtensionID] = err.Error()
+			continue
+		}
+		ret.Updated = append(ret.Updated, update.ExtensionID)
+	}
+
+	r.updateDataMu.Lock()
+	r.updateData = make([]UpdateData, 0)
+	for _, update := range updates {
+		if _, failed := ret.Failed[update.ExtensionID]; failed {
+			r.updateData = append(r.updateData, update)
+		}
+	}
+	r.updateDataMu.Unlock()
+
+	return ret
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Rollback
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (r *Repository) previousExtensionDir() string {
+	return filepath.Join(r.extensionDir, previousExtensionDir)
+}
+
+func (r *Repository) previousExtensionPath(id string) string {
+	return filepath.Join(r.previousExtensionDir(), id+".json")
+}
+
+// keepPreviousExtension moves the installed extension file aside so that the update can be rolled back.
+func (r *Repository) keepPreviousExtension(id string) error {
+	if err := os.MkdirAll(r.previousExtensionDir(), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(r.extensionDir, id+".json"), r.previousExtensionPath(id))
+}
+
+// RollbackExtension restores the version of the extension that was installed before the last update.
+// The version that was rolled back won't be auto-installed again.
+func (r *Repository) RollbackExtension(id string) error {
+	return r.rollbackExtension(id, "")
+}
+
+func (r *Repository) rollbackExtension(id string, reason string) error {
+	previousPath := r.previousExtensionPath(id)
+	previous, err := extractExtensionFromFile(previousPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNoPreviousExtensionVersion
+		}
+		r.logger.Error().Err(err).Str("id", id).Msg("extensions: Failed to read previous extension file")
+		return fmt.Errorf("failed to read previous extension file, %w", err)
+	}
+
+	extensionFilepath := filepath.Join(r.extensionDir, id+".json")
+	var currentVersion string
+	if current, err := extractExtensionFromFile(extensionFilepath); err == nil {
+		currentVersion = current.Version
+	}
+
+	if err = os.Rename(previousPath, extensionFilepath); err != nil {
+		r.logger.Error().Err(err).Str("id", id).Msg("extensions: Failed to restore previous extension file")
+		return fmt.Errorf("failed to restore previous extension file, %w", err)
+	}
+
+	r.deleteUpdateProbation(id)
+
+	if currentVersion != "" && currentVersion != previous.Version {
+		r.updateSettingsMu.Lock()
+		data := r.getStoredUpdateSettings()
+		data.RolledBackVersions[id] = currentVersion
+		_ = r.saveStoredUpdateSettings(data)
+		r.updateSettingsMu.Unlock()
+	}
+
+	// The restored payload was signed by the key that was installed at the time
+	r.recordExtensionTrust(previous, "")
+
+	r.reloadExtension(id)
+
+	r.logger.Info().Str("id", id).Str("version", previous.Version).Str("reason", reason).Msg("extensions: Rolled back extension")
+
+	if reason != "" {
+		r.wsEventManager.SendEvent(events.ExtensionRolledBack, ExtensionRolledBackEvent{
+			ExtensionID: id,
+			Version:     currentVersion,
+			Reason:      reason,
+		})
+	}
+
+	return nil
+}
+
+func (r *Repository) rollbackFailedUpdate(id string, version string, reason string) error {
+	r.logger.Warn().Str("id", id).Str("version", version).Str("reason", reason).Msg("extensions: Auto-update failed, rolling back")
+	if err := r.rollbackExtension(id, reason); err != nil {
+		r.logger.Error().Err(err).Str("id", id).Msg("extensions: Failed to roll back extension")
+		return err
+	}
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Probation
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// setUpdateProbation starts the probation of an auto-updated extension.
+// It's stored so that a restart during the probation period doesn't end it.
+func (r *Repository) setUpdateProbation(id string, version string, until time.Time) {
+	r.updateProbations.Set(id, &updateProbation{
+		version: version,
+		until:   until,
+	})
+
+	r.updateSettingsMu.Lock()
+	defer r.updateSettingsMu.Unlock()
+
+	data := r.getStoredUpdateSettings()
+	data.Probations[id] = &StoredUpdateProbation{Version: version, Until: until}
+	if err := r.saveStoredUpdateSettings(data); err != nil {
+		r.logger.Warn().Err(err).Str("id", id).Msg("extensions: Failed to save update probation")
+	}
+}
+
+func (r *Repository) deleteUpdateProbation(id string) {
+	r.updateProbations.Delete(id)
+
+	r.updateSettingsMu.Lock()
+	defer r.updateSettingsMu.Unlock()
+
+	data := r.getStoredUpdateSettings()
+	if _, ok := data.Probations[id]; !ok {
+		return
+	}
+	delete(data.Probations, id)
+	_ = r.saveStoredUpdateSettings(data)
+}
+
+// loadUpdateProbations restores the probations that were running when the app was closed.
+// Probations that expired or whose version is no longer installed are dropped.
+func (r *Repository) loadUpdateProbations() {
+	if r.fileCacher == nil {
+		return
+	}
+
+	r.updateSettingsMu.Lock()
+	defer r.updateSettingsMu.Unlock()
+
+	data := r.getStoredUpdateSettings()
+	if len(data.Probations) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for id, probation := range data.Probations {
+		ext, err := extractExtensionFromFile(filepath.Join(r.extensionDir, id+".json"))
+		if probation == nil || now.After(probation.Until) || err != nil || ext.Version != probation.Version {
+			delete(data.Probations, id)
+			continue
+		}
+		r.updateProbations.Set(id, &updateProbation{
+			version: probation.Version,
+			until:   probation.Until,
+		})
+	}
+	_ = r.saveStoredUpdateSettings(data)
+}
+
+// getUpdateProbation returns the probation of an auto-updated extension if it's still running.
+func (r *Repository) getUpdateProbation(id string) (*updateProbation, bool) {
+	probation, ok := r.updateProbations.Get(id)
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(probation.until) {
+		r.deleteUpdateProbation(id)
+		return nil, false
+	}
+	return probation, true
+}
+
+// providerCallResultFunc returns the function called by providers with the outcome of each method call.
+func (r *Repository) providerCallResultFunc(id string) func(err error) {
+	return func(err error) {
+		probation, ok := r.getUpdateProbation(id)
+		if !ok {
+			return
+		}
+
+		if err == nil {
+			probation.consecutiveErrors.Store(0)
+			return
+		}
+
+		if probation.consecutiveErrors.Add(1) < updateProbationMaxErrors || !probation.rolledBack.CompareAndSwap(false, true) {
+			return
+		}
+
+		reason := fmt.Sprintf("provider failed %d times in a row after update: %v", updateProbationMaxErrors, err)
+		// Roll back outside the provider call
+		go func() {
+			_ = r.rollbackFailedUpdate(id, probation.version, reason)
+		}()
+	}
+}
+
+// invalidatedDuringProbation reverts an auto-updated extension that was invalidated at runtime.
+func (r *Repository) invalidatedDuringProbation(id string, reason string) {
+	probation, ok := r.getUpdateProbation(id)
+	if !ok || !probation.rolledBack.CompareAndSwap(false, true) {
+		return
+	}
+
+	// Roll back outside the extension runtime
+	go func() {
+		_ = r.rollbackFailedUpdate(id, probation.version, fmt.Sprintf("invalidated after update: %s", reason))
+	}()
+}
@@ -0,0 +1,145 @@
+package extension_repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"seanime/internal/extension"
+	hibiketorrent "seanime/internal/extension/hibike/torrent"
+	"seanime/internal/util"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const autoUpdateTestPayload = `
+class Provider {
+	async search(opts) { %s }
+	async smartSearch(opts) { return [] }
+	async getTorrentInfoHash(torrent) { return "" }
+	async getTorrentMagnetLink(torrent) { return "" }
+	async getLatest() { return [] }
+	getSettings() { return { canSmartSearch: false, smartSearchFilters: [], supportsAdult: false, type: "main" } }
+}
+`
+
+func TestExtensionAutoUpdate(t *testing.T) {
+	repo := GetMockExtensionRepository(t)
+	repo.extensionBankRef = util.NewRef(extension.NewUnifiedBank())
+
+	var manifest atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(manifest.Load())
+	}))
+	defer server.Close()
+
+	manifestURI := server.URL + "/manifest.json"
+	setVersion := func(version string, payload string) UpdateData {
+		manifest.Store(&extension.Extension{
+			ID:          "auto-update-test",
+			Name:        "Auto Update Test",
+			Version:     version,
+			ManifestURI: manifestURI,
+			Language:    extension.LanguageJavascript,
+			Type:        extension.TypeAnimeTorrentProvider,
+			Author:      "Seanime",
+			Payload:     payload,
+		})
+		return UpdateData{ExtensionID: "auto-update-test", ManifestURI: manifestURI, Version: version}
+	}
+	installedVersion := func() string {
+		ext, ok := repo.extensionBankRef.Get().Get("auto-update-test")
+		if !ok {
+			return ""
+		}
+		return ext.GetVersion()
+	}
+
+	setVersion("1.0.0", fmt.Sprintf(autoUpdateTestPayload, "return []"))
+	_, err := repo.InstallExternalExtension(manifestURI)
+	require.NoError(t, err)
+	require.Equal(t, "1.0.0", installedVersion())
+
+	// Rolling back without a previous version
+	require.ErrorIs(t, repo.RollbackExtension("auto-update-test"), ErrNoPreviousExtensionVersion)
+
+	t.Run("Notify policy", func(t *testing.T) {
+		update := setVersion("1.1.0", fmt.Sprintf(autoUpdateTestPayload, "return []"))
+
+		pending, notify := repo.applyUpdatePolicies([]UpdateData{update})
+		require.Len(t, pending, 1)
+		require.Len(t, notify, 1)
+		require.Equal(t, "1.0.0", installedVersion())
+
+		require.NoError(t, repo.SetExtensionUpdatePolicy("auto-update-test", ExtensionUpdatePolicyManual))
+		pending, notify = repo.applyUpdatePolicies([]UpdateData{update})
+		require.Len(t, pending, 1)
+		require.Empty(t, notify)
+	})
+
+	require.NoError(t, repo.SetExtensionUpdatePolicy("auto-update-test", ExtensionUpdatePolicyAuto))
+	require.Error(t, repo.SetExtensionUpdatePolicy("auto-update-test", "sometimes"))
+
+	t.Run("Rollback on repeated provider errors", func(t *testing.T) {
+		update := setVersion("2.0.0", fmt.Sprintf(autoUpdateTestPayload, `throw new Error("broken")`))
+
+		pending, notify := repo.applyUpdatePolicies([]UpdateData{update})
+		require.Empty(t, pending)
+		require.Empty(t, notify)
+		require.Equal(t, "2.0.0", installedVersion())
+		require.Equal(t, "1.0.0", repo.GetExtensionUpdateSettings().PreviousVersions["auto-update-test"])
+
+		// The probation is restored after a restart
+		restarted := NewRepository(&NewRepositoryOptions{
+			Logger:         repo.logger,
+			ExtensionDir:   repo.extensionDir,
+			WSEventManager: repo.wsEventManager,
+			FileCacher:     repo.fileCacher,
+		})
+		probation, ok := restarted.getUpdateProbation("auto-update-test")
+		require.True(t, ok)
+		require.Equal(t, "2.0.0", probation.version)
+
+		ext, ok := extension.GetExtension[extension.AnimeTorrentProviderExtension](repo.extensionBankRef.Get(), "auto-update-test")
+		require.True(t, ok)
+		for i := 0; i < updateProbationMaxErrors; i++ {
+			_, err := ext.GetProvider().Search(hibiketorrent.AnimeSearchOptions{Query: "frieren"})
+			require.Error(t, err)
+		}
+
+		require.Eventually(t, func() bool {
+			return installedVersion() == "1.0.0"
+		}, 5*time.Second, 100*time.Millisecond)
+		require.Equal(t, "2.0.0", repo.GetExtensionUpdateSettings().RolledBackVersions["auto-update-test"])
+		require.NotContains(t, repo.getStoredUpdateSettings().Probations, "auto-update-test")
+
+		// The rolled back version isn't installed again
+		pending, notify = repo.applyUpdatePolicies([]UpdateData{update})
+		require.Len(t, pending, 1)
+		require.Len(t, notify, 1)
+		require.Equal(t, "1.0.0", installedVersion())
+	})
+
+	t.Run("Rollback on load failure", func(t *testing.T) {
+		update := setVersion("3.0.0", "class Provider {")
+
+		pending, _ := repo.applyUpdatePolicies([]UpdateData{update})
+		require.Len(t, pending, 1)
+		require.Equal(t, "1.0.0", installedVersion())
+		require.Equal(t, "3.0.0", repo.GetExtensionUpdateSettings().RolledBackVersions["auto-update-test"])
+	})
+
+	t.Run("Manual rollback", func(t *testing.T) {
+		setVersion("4.0.0", fmt.Sprintf(autoUpdateTestPayload, "return []"))
+		_, err := repo.InstallExternalExtension(manifestURI)
+		require.NoError(t, err)
+		require.Equal(t, "4.0.0", installedVersion())
+
+		require.NoError(t, repo.RollbackExtension("auto-update-test"))
+		require.Equal(t, "1.0.0", installedVersion())
+		require.NotContains(t, repo.GetExtensionUpdateSettings().PreviousVersions, "auto-update-test")
+	})
+}
@@ -85,6 +85,12 @@ func (r *Repository) fetchExternalExtensionData(manifestURI string, noPayloadDow
 		return nil, fmt.Errorf("failed sanity check, %w", err)
 	}
 
+	// Check the payload hash and signature
+	if err = verifyExtensionIntegrity(&ext); err != nil {
+		r.logger.Error().Err(err).Str("uri", manifestURI).Msg("extensions: Failed integrity check")
+		return nil, fmt.Errorf("failed integrity check, %w", err)
+	}
+
 	// Check if the extension is development mode
 	if ext.IsDevelopment {
 		r.logger.Error().Str("id", ext.ID).Msg("extensions: Development mode enabled, cannot install development mode extensions for security reasons")
@@ -131,6 +137,16 @@ type ExtensionInstallResponse struct {
 }
 
 func (r *Repository) InstallExternalExtension(manifestURI string) (*ExtensionInstallResponse, error) {
+	return r.installExternalExtension(manifestURI, "")
+}
+
+// InstallMarketplaceExtension installs the extension from the given manifest uri and checks it against the keys pinned for the marketplace.
+// An empty marketplace URL is the default marketplace.
+func (r *Repository) InstallMarketplaceExtension(manifestURI string, marketplaceURL string) (*ExtensionInstallResponse, error) {
+	return r.installExternalExtension(manifestURI, getMarketplaceURL(marketplaceURL))
+}
+
+func (r *Repository) installExternalExtension(manifestURI string, marketplaceURL string) (*ExtensionInstallResponse, error) {
 
 	ext, err := r.fetchExternalExtensionData(manifestURI)
 	if err != nil {
@@ -138,6 +154,12 @@ func (r *Repository) InstallExternalExtension(manifestURI string) (*ExtensionIns
 		return nil, fmt.Errorf("failed to fetch extension data, %w", err)
 	}
 
+	// Refuse the extension if the publisher key isn't trusted
+	if err = r.checkExtensionTrust(ext, marketplaceURL); err != nil {
+		r.logger.Warn().Err(err).Str("id", ext.ID).Str("publicKey", publisherKey(ext)).Msg("extensions: Refused untrusted extension")
+		return nil, err
+	}
+
 	filename := filepath.Join(r.extensionDir, ext.ID+".json")
 
 	update := false
@@ -146,11 +168,11 @@ func (r *Repository) InstallExternalExtension(manifestURI string) (*ExtensionIns
 	// i.e. a file with the same ID exists
 	if _, err := os.Stat(filename); err == nil {
 		r.logger.Debug().Str("id", ext.ID).Msg("extensions: Updating extension")
-		// Delete the old extension
-		err := os.Remove(filename)
+		// Keep the old extension so that the update can be rolled back
+		err := r.keepPreviousExtension(ext.ID)
 		if err != nil {
-			r.logger.Error().Err(err).Str("id", ext.ID).Msg("extensions: Failed to remove old extension")
-			return nil, fmt.Errorf("failed to remove old extension, %w", err)
+			r.logger.Error().Err(err).Str("id", ext.ID).Msg("extensions: Failed to move old extension")
+			return nil, fmt.Errorf("failed to move old extension, %w", err)
 		}
 		update = true
 	}
@@ -171,6 +193,8 @@ func (r *Repository) InstallExternalExtension(manifestURI string) (*ExtensionIns
 		return nil, fmt.Errorf("failed to write extension to file, %w", err)
 	}
 
+	r.recordExtensionTrust(ext, marketplaceURL)
+
 	// Reload the extensions
 	//r.loadExternalExtensions()
 
@@ -275,8 +299,13 @@ func (r *Repository) InstallExternalExtensions(uriOrJson string, install bool) (
 	wg.Wait()
 
 	if install {
+		// Extensions from a repository URL are checked against the keys pinned for that URL
+		marketplaceURL := ""
+		if !strings.HasPrefix(strings.TrimSpace(uriOrJson), "{") {
+			marketplaceURL = uriOrJson
+		}
 		for _, ext := range extensions {
-			_, err := r.InstallExternalExtension(ext.ManifestURI)
+			_, err := r.installExternalExtension(ext.ManifestURI, marketplaceURL)
 			if err != nil {
 				r.logger.Error().Err(err).Str("id", ext.ID).Msg("extensions: Failed to install extension from repository")
 			}
@@ -320,11 +349,16 @@ func (r *Repository) UninstallExternalExtension(id string) error {
 
 	go func() {
 		_ = r.deleteExtensionUserConfig(id)
+		r.removeExtensionTrust(id)
+		r.removeExtensionUpdateSettings(id)
 
 		// Delete the plugin data if it was a plugin
 		if ext.Type == extension.TypePlugin {
 			r.deletePluginData(id)
 			r.removePluginFromStoredSettings(id)
+		} else if ext.Language == extension.LanguageWasm {
+			// Revoke the granted permissions
+			r.removePluginFromStoredSettings(id)
 		}
 	}()
 
@@ -378,13 +412,20 @@ func (r *Repository) checkForUpdates() (ret []UpdateData) {
 
 			// If there's an update, send the update data to the channel
 			if extFromRepo.Version != ext.GetVersion() {
-				mu.Lock()
-				ret = append(ret, UpdateData{
+				updateData := UpdateData{
 					ExtensionID: extFromRepo.ID,
 					Version:     extFromRepo.Version,
 					ManifestURI: extFromRepo.ManifestURI,
 					Payload:     extFromRepo.Payload,
-				})
+					PublicKey:   publisherKey(extFromRepo),
+				}
+				// The update will be refused on install if the publisher key changed
+				if err = r.checkExtensionTrust(extFromRepo, ""); err != nil {
+					r.logger.Warn().Err(err).Str("id", ext.GetID()).Msg("extensions: Update requires approval")
+					updateData.TrustError = err.Error()
+				}
+				mu.Lock()
+				ret = append(ret, updateData)
 				mu.Unlock()
 			}
 		}(ext)
@@ -433,7 +474,17 @@ func (r *Repository) UpdateExtensionCode(id string, payload string) error {
 	}
 
 	// Update the payload
+	// The publisher signature no longer applies to the edited payload
 	ext.Payload = payload
+	ext.PayloadHash = ""
+	ext.Signature = ""
+	ext.PublicKey = ""
+
+	// Refuse the edit if the extension was signed, unless the unsigned payload was approved
+	if err = r.checkExtensionTrust(ext, ""); err != nil {
+		r.logger.Warn().Err(err).Str("id", id).Msg("extensions: Refused to edit signed extension")
+		return err
+	}
 
 	// Write the extension to the file
 	file, err := os.Create(extensionFilepath)
@@ -451,6 +502,8 @@ func (r *Repository) UpdateExtensionCode(id string, payload string) error {
 		return fmt.Errorf("failed to write extension to file, %w", err)
 	}
 
+	r.recordExtensionTrust(ext, "")
+
 	// Call reload extension to unload it
 	r.reloadExtension(id)
 
@@ -509,6 +562,25 @@ func (r *Repository) interruptExternalGojaExtensionVMs() {
 	r.logger.Debug().Int("count", count).Msg("extensions: Killed Goja VMs")
 }
 
+// closeExternalWasmRuntimes closes all runtimes from currently loaded external WebAssembly extensions & clears the map.
+func (r *Repository) closeExternalWasmRuntimes() {
+	defer util.HandlePanicInModuleThen("extension_repo/closeExternalWasmRuntimes", func() {})
+
+	count := 0
+	for _, key := range r.wasmExtensions.Keys() {
+		if wasmExt, ok := r.wasmExtensions.Get(key); ok {
+			if !r.shouldLoadType(wasmExt.GetExtension().Type) {
+				continue
+			}
+			wasmExt.Close()
+			r.wasmExtensions.Delete(key)
+			count++
+		}
+	}
+
+	r.logger.Debug().Int("count", count).Msg("extensions: Closed WebAssembly runtimes")
+}
+
 // unloadExternalExtensions unloads all external extensions from the extension banks.
 func (r *Repository) unloadExternalExtensions() {
 	r.logger.Trace().Msg("extensions: Unloading external extensions")
@@ -557,6 +629,9 @@ func (r *Repository) loadExternalExtensions() {
 	// Interrupt all Goja VMs
 	r.interruptExternalGojaExtensionVMs()
 
+	// Close all WebAssembly runtimes
+	r.closeExternalWasmRuntimes()
+
 	// Unload all external extensions
 	r.unloadExternalExtensions()
 
@@ -571,6 +646,10 @@ func (r *Repository) loadExternalExtensions() {
 		}
 
 		if d.IsDir() {
+			// Skip the payloads kept for rollbacks
+			if path == r.previousExtensionDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -739,6 +818,22 @@ func (r *Repository) loadExternalExtension(filePath string) {
 		}
 	}
 
+	if ext.Language == extension.LanguageWasm && !ext.IsDevelopment {
+		permissionErr := r.checkPluginPermissions(ext)
+		if permissionErr != nil {
+			r.invalidExtensions.Set(invalidExtensionID, &extension.InvalidExtension{
+				ID:                          invalidExtensionID,
+				Reason:                      permissionErr.Error(),
+				Path:                        filePath,
+				Code:                        extension.InvalidExtensionPluginPermissionsNotGranted,
+				Extension:                   *ext,
+				PluginPermissionDescription: ext.Wasm.Permissions.GetDescription(),
+			})
+			r.logger.Warn().Err(permissionErr).Str("id", ext.ID).Msg("extensions: WebAssembly extension permissions not granted. Please grant the permissions in the extension page.")
+			return
+		}
+	}
+
 	// +
 	// | Load user config
 	// +
@@ -813,6 +908,9 @@ func (r *Repository) invalidateExtension(id string, reason string) {
 		Extension: *ext.GetExtension(),
 	})
 	r.logger.Warn().Str("id", id).Msg("extensions: Invalidated extension")
+
+	// Revert the extension if it was just auto-updated
+	r.invalidatedDuringProbation(id, reason)
 }
 
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -838,6 +936,11 @@ func (r *Repository) reloadExtension(id string) {
 		r.logger.Trace().Str("id", id).Msg("extensions: Killed extension's runtime")
 		r.gojaExtensions.Delete(id)
 	}
+	// Close the WebAssembly runtime if it exists
+	if wasmExtension, ok := r.wasmExtensions.Get(id); ok {
+		wasmExtension.Close()
+		r.wasmExtensions.Delete(id)
+	}
 	// Remove from invalid extensions
 	r.invalidExtensions.Delete(id)
 
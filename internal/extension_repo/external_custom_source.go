@@ -23,6 +23,8 @@ func (r *Repository) loadExternalCustomSourceProviderExtension(ext *extension.Ex
 	switch ext.Language {
 	case extension.LanguageJavascript, extension.LanguageTypescript:
 		err = r.loadExternalCustomSourceExtensionJS(ext, ext.Language)
+	case extension.LanguageWasm:
+		err = r.loadExternalCustomSourceExtensionWasm(ext)
 	default:
 		err = fmt.Errorf("unsupported language: %v", ext.Language)
 	}
@@ -84,6 +86,9 @@ func (r *Repository) loadExternalCustomSourceExtensionJS(ext *extension.Extensio
 		return err
 	}
 
+	// Track provider errors while the extension is on probation after an auto-update
+	gojaExt.callResultFunc = r.providerCallResultFunc(ext.ID)
+
 	// Add the extension to the map
 	retExt := extension.NewCustomSourceExtension(ext, provider)
 	retExt.SetExtensionIdentifier(r.generateExtensionIdentifier(ext.ID))
@@ -95,3 +100,24 @@ func (r *Repository) loadExternalCustomSourceExtensionJS(ext *extension.Extensio
 
 	return nil
 }
+
+func (r *Repository) loadExternalCustomSourceExtensionWasm(ext *extension.Extension) error {
+	provider, wasmExt, err := NewWasmCustomSource(ext, r.logger)
+	if err != nil {
+		return err
+	}
+
+	// Track provider errors while the extension is on probation after an auto-update
+	wasmExt.runtime.callResultFunc = r.providerCallResultFunc(ext.ID)
+
+	// Add the extension to the map
+	retExt := extension.NewCustomSourceExtension(ext, provider)
+	retExt.SetExtensionIdentifier(r.generateExtensionIdentifier(ext.ID))
+	wasmExt.extensionIdentifier = retExt.GetExtensionIdentifier()
+	r.extensionBankRef.Get().Set(ext.ID, retExt)
+	r.wasmExtensions.Set(ext.ID, wasmExt)
+
+	r.logger.Trace().Str("id", ext.ID).Int("identifier", wasmExt.extensionIdentifier).Msg("extensions: Loaded external custom source extension")
+
+	return nil
+}
@@ -16,6 +16,8 @@ func (r *Repository) loadExternalOnlinestreamProviderExtension(ext *extension.Ex
 	switch ext.Language {
 	case extension.LanguageJavascript, extension.LanguageTypescript:
 		err = r.loadExternalOnlinestreamExtensionJS(ext, ext.Language)
+	case extension.LanguageWasm:
+		err = r.loadExternalOnlinestreamExtensionWasm(ext)
 	default:
 		err = fmt.Errorf("unsupported language: %v", ext.Language)
 	}
@@ -33,9 +35,28 @@ func (r *Repository) loadExternalOnlinestreamExtensionJS(ext *extension.Extensio
 		return err
 	}
 
+	// Track provider errors while the extension is on probation after an auto-update
+	gojaExt.callResultFunc = r.providerCallResultFunc(ext.ID)
+
 	// Add the extension to the map
 	retExt := extension.NewOnlinestreamProviderExtension(ext, provider)
 	r.extensionBankRef.Get().Set(ext.ID, retExt)
 	r.gojaExtensions.Set(ext.ID, gojaExt)
 	return nil
 }
+
+func (r *Repository) loadExternalOnlinestreamExtensionWasm(ext *extension.Extension) error {
+	provider, wasmExt, err := NewWasmOnlinestreamProvider(ext, r.logger)
+	if err != nil {
+		return err
+	}
+
+	// Track provider errors while the extension is on probation after an auto-update
+	wasmExt.runtime.callResultFunc = r.providerCallResultFunc(ext.ID)
+
+	// Add the extension to the map
+	retExt := extension.NewOnlinestreamProviderExtension(ext, provider)
+	r.extensionBankRef.Get().Set(ext.ID, retExt)
+	r.wasmExtensions.Set(ext.ID, wasmExt)
+	return nil
+}
@@ -66,14 +66,15 @@ func (r *Repository) GrantPluginPermissions(pluginId string) {
 		return
 	}
 
-	// Check if the extension is a plugin
-	if ext.Type != extension.TypePlugin {
+	// Check if the extension asks for permissions
+	permissions := getExtensionPermissions(ext)
+	if permissions == nil {
 		r.logger.Error().Str("id", pluginId).Msg("extensions: Extension is not a plugin")
 		return
 	}
 
 	// Grant the plugin permissions
-	permissionHash := ext.Plugin.Permissions.GetHash()
+	permissionHash := permissions.GetHash()
 
 	r.setPluginGrantedPermissions(pluginId, permissionHash)
 
@@ -114,19 +115,27 @@ func (r *Repository) removePluginFromStoredSettings(pluginId string) {
 	r.fileCacher.SetPerm(bucket, PluginSettingsKey, settings)
 }
 
+// getExtensionPermissions returns the permissions asked by plugins and WebAssembly extensions.
+func getExtensionPermissions(ext *extension.Extension) *extension.PluginPermissions {
+	switch {
+	case ext.Type == extension.TypePlugin && ext.Plugin != nil:
+		return &ext.Plugin.Permissions
+	case ext.Language == extension.LanguageWasm && ext.Wasm != nil:
+		return &ext.Wasm.Permissions
+	}
+	return nil
+}
+
 func (r *Repository) checkPluginPermissions(ext *extension.Extension) (err error) {
 	defer util.HandlePanicInModuleWithError("extension_repo/checkPluginPermissions", &err)
 
-	if ext.Type != extension.TypePlugin {
-		return nil
-	}
-
-	if ext.Plugin == nil {
+	permissions := getExtensionPermissions(ext)
+	if permissions == nil {
 		return nil
 	}
 
 	// Get current plugin permission hash
-	pluginPermissionHash := ext.Plugin.Permissions.GetHash()
+	pluginPermissionHash := permissions.GetHash()
 
 	// If the plugin has no permissions, skip the check
 	if pluginPermissionHash == "" {
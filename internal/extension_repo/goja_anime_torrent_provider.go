@@ -7,6 +7,7 @@ import (
 	hibiketorrent "seanime/internal/extension/hibike/torrent"
 	"seanime/internal/goja/goja_runtime"
 	"seanime/internal/util"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -28,6 +29,7 @@ func NewGojaAnimeTorrentProvider(ext *extension.Extension, language extension.La
 }
 
 func (g *GojaAnimeTorrentProvider) Search(opts hibiketorrent.AnimeSearchOptions) (ret []*hibiketorrent.AnimeTorrent, err error) {
+	defer observeExtensionCall(g.ext.ID, "Search", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".Search", &err)
 
 	method, err := g.callClassMethod(context.Background(), "search", structToMap(opts))
@@ -50,6 +52,7 @@ func (g *GojaAnimeTorrentProvider) Search(opts hibiketorrent.AnimeSearchOptions)
 }
 
 func (g *GojaAnimeTorrentProvider) SmartSearch(opts hibiketorrent.AnimeSmartSearchOptions) (ret []*hibiketorrent.AnimeTorrent, err error) {
+	defer observeExtensionCall(g.ext.ID, "SmartSearch", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".SmartSearch", &err)
 
 	method, err := g.callClassMethod(context.Background(), "smartSearch", structToMap(opts))
@@ -72,6 +75,7 @@ func (g *GojaAnimeTorrentProvider) SmartSearch(opts hibiketorrent.AnimeSmartSear
 }
 
 func (g *GojaAnimeTorrentProvider) GetTorrentInfoHash(torrent *hibiketorrent.AnimeTorrent) (ret string, err error) {
+	defer observeExtensionCall(g.ext.ID, "GetTorrentInfoHash", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".GetTorrentInfoHash", &err)
 
 	res, err := g.callClassMethod(context.Background(), "getTorrentInfoHash", structToMap(torrent))
@@ -93,6 +97,7 @@ func (g *GojaAnimeTorrentProvider) GetTorrentInfoHash(torrent *hibiketorrent.Ani
 }
 
 func (g *GojaAnimeTorrentProvider) GetTorrentMagnetLink(torrent *hibiketorrent.AnimeTorrent) (ret string, err error) {
+	defer observeExtensionCall(g.ext.ID, "GetTorrentMagnetLink", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".GetTorrentMagnetLink", &err)
 
 	res, err := g.callClassMethod(context.Background(), "getTorrentMagnetLink", structToMap(torrent))
@@ -114,6 +119,7 @@ func (g *GojaAnimeTorrentProvider) GetTorrentMagnetLink(torrent *hibiketorrent.A
 }
 
 func (g *GojaAnimeTorrentProvider) GetLatest() (ret []*hibiketorrent.AnimeTorrent, err error) {
+	defer observeExtensionCall(g.ext.ID, "GetLatest", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".GetLatest", &err)
 
 	method, err := g.callClassMethod(context.Background(), "getLatest")
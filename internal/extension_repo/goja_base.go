@@ -27,6 +27,8 @@ type gojaProviderBase struct {
 	store          *plugin.Store[string, any]
 	scheduler      *gojautil.Scheduler
 	wsEventManager events.WSEventManagerInterface
+	// Called with the outcome of each provider method call, may be nil
+	callResultFunc func(err error)
 }
 
 func initializeProviderBase(
@@ -180,7 +182,13 @@ func (g *gojaProviderBase) unmarshalValue(value goja.Value, target interface{})
 }
 
 // waitForPromise waits for a promise to resolve and returns the result
-func (g *gojaProviderBase) waitForPromise(value goja.Value) (goja.Value, error) {
+func (g *gojaProviderBase) waitForPromise(value goja.Value) (ret goja.Value, err error) {
+	if g.callResultFunc != nil {
+		defer func() {
+			g.callResultFunc(err)
+		}()
+	}
+
 	if value == nil {
 		return nil, fmt.Errorf("cannot wait for nil promise")
 	}
@@ -10,6 +10,7 @@ import (
 	hibikecustomsource "seanime/internal/extension/hibike/customsource"
 	"seanime/internal/goja/goja_runtime"
 	"seanime/internal/util"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -38,6 +39,7 @@ func (g *GojaCustomSource) GetExtensionIdentifier() int {
 }
 
 func (g *GojaCustomSource) ListAnime(ctx context.Context, search string, page int, perPage int) (ret *hibikecustomsource.ListAnimeResponse, err error) {
+	defer observeExtensionCall(g.ext.ID, "ListAnime", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".ListAnime", &err)
 
 	g.logger.Debug().Str("extension", g.extId).Str("search", search).Msg("custom source: Fetching anime")
@@ -61,6 +63,7 @@ func (g *GojaCustomSource) ListAnime(ctx context.Context, search string, page in
 }
 
 func (g *GojaCustomSource) ListManga(ctx context.Context, search string, page int, perPage int) (ret *hibikecustomsource.ListMangaResponse, err error) {
+	defer observeExtensionCall(g.ext.ID, "ListManga", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".ListManga", &err)
 
 	g.logger.Debug().Str("extension", g.extId).Str("search", search).Msg("custom source: Fetching manga")
@@ -102,6 +105,7 @@ func (g *GojaCustomSource) GetSettings() (ret hibikecustomsource.Settings) {
 }
 
 func (g *GojaCustomSource) GetAnime(ctx context.Context, id []int) (ret []*anilist.BaseAnime, err error) {
+	defer observeExtensionCall(g.ext.ID, "GetAnime", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".GetAnime", &err)
 
 	g.logger.Debug().Str("extension", g.extId).Ints("ids", id).Msg("custom source: Getting anime")
@@ -125,6 +129,7 @@ func (g *GojaCustomSource) GetAnime(ctx context.Context, id []int) (ret []*anili
 }
 
 func (g *GojaCustomSource) GetAnimeWithRelations(ctx context.Context, id int) (ret *anilist.CompleteAnime, err error) {
+	defer observeExtensionCall(g.ext.ID, "GetAnimeWithRelations", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".GetAnimeWithRelations", &err)
 
 	g.logger.Debug().Str("extension", g.extId).Int("id", id).Msg("custom source: Getting anime with relations")
@@ -152,6 +157,7 @@ func (g *GojaCustomSource) GetAnimeWithRelations(ctx context.Context, id int) (r
 }
 
 func (g *GojaCustomSource) GetAnimeMetadata(ctx context.Context, id int) (ret *metadata.AnimeMetadata, err error) {
+	defer observeExtensionCall(g.ext.ID, "GetAnimeMetadata", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".GetAnimeMetadata", &err)
 
 	g.logger.Debug().Str("extension", g.extId).Int("id", id).Msg("custom source: Getting anime metadata")
@@ -175,6 +181,7 @@ func (g *GojaCustomSource) GetAnimeMetadata(ctx context.Context, id int) (ret *m
 }
 
 func (g *GojaCustomSource) GetAnimeDetails(ctx context.Context, id int) (ret *anilist.AnimeDetailsById_Media, err error) {
+	defer observeExtensionCall(g.ext.ID, "GetAnimeDetails", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".GetAnimeDetails", &err)
 
 	g.logger.Debug().Str("extension", g.extId).Int("id", id).Msg("custom source: Getting anime details")
@@ -198,6 +205,7 @@ func (g *GojaCustomSource) GetAnimeDetails(ctx context.Context, id int) (ret *an
 }
 
 func (g *GojaCustomSource) GetManga(ctx context.Context, id []int) (ret []*anilist.BaseManga, err error) {
+	defer observeExtensionCall(g.ext.ID, "GetManga", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".GetManga", &err)
 
 	g.logger.Debug().Str("extension", g.extId).Ints("ids", id).Msg("custom source: Getting manga")
@@ -221,6 +229,7 @@ func (g *GojaCustomSource) GetManga(ctx context.Context, id []int) (ret []*anili
 }
 
 func (g *GojaCustomSource) GetMangaDetails(ctx context.Context, id int) (ret *anilist.MangaDetailsById_Media, err error) {
+	defer observeExtensionCall(g.ext.ID, "GetMangaDetails", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".GetMangaDetails", &err)
 
 	g.logger.Debug().Str("extension", g.extId).Int("id", id).Msg("custom source: Getting manga details")
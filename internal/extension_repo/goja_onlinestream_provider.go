@@ -8,6 +8,7 @@ import (
 	hibikeonlinestream "seanime/internal/extension/hibike/onlinestream"
 	"seanime/internal/goja/goja_runtime"
 	"seanime/internal/util"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -47,6 +48,7 @@ func (g *GojaOnlinestreamProvider) GetEpisodeServers() (ret []string) {
 }
 
 func (g *GojaOnlinestreamProvider) Search(opts hibikeonlinestream.SearchOptions) (ret []*hibikeonlinestream.SearchResult, err error) {
+	defer observeExtensionCall(g.ext.ID, "Search", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".Search", &err)
 
 	method, err := g.callClassMethod(context.Background(), "search", structToMap(opts))
@@ -69,6 +71,7 @@ func (g *GojaOnlinestreamProvider) Search(opts hibikeonlinestream.SearchOptions)
 }
 
 func (g *GojaOnlinestreamProvider) FindEpisodes(id string) (ret []*hibikeonlinestream.EpisodeDetails, err error) {
+	defer observeExtensionCall(g.ext.ID, "FindEpisodes", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".FindEpisodes", &err)
 
 	method, err := g.callClassMethod(context.Background(), "findEpisodes", id)
@@ -91,6 +94,7 @@ func (g *GojaOnlinestreamProvider) FindEpisodes(id string) (ret []*hibikeonlines
 }
 
 func (g *GojaOnlinestreamProvider) FindEpisodeServer(episode *hibikeonlinestream.EpisodeDetails, server string) (ret *hibikeonlinestream.EpisodeServer, err error) {
+	defer observeExtensionCall(g.ext.ID, "FindEpisodeServer", time.Now(), &err)
 	defer util.HandlePanicInModuleWithError(g.ext.ID+".FindEpisodeServer", &err)
 
 	method, err := g.callClassMethod(context.Background(), "findEpisodeServer", structToMap(episode), server)
@@ -14,12 +14,15 @@ import (
 func (r *Repository) GetMarketplaceExtensions(url string) (extensions []*extension.Extension, err error) {
 	defer util.HandlePanicInModuleWithError("extension_repo/GetMarketplaceExtensions", &err)
 
-	marketplaceUrl := constants.DefaultExtensionMarketplaceURL
-	if url != "" {
-		marketplaceUrl = url
-	}
+	return r.getMarketplaceExtensions(getMarketplaceURL(url))
+}
 
-	return r.getMarketplaceExtensions(marketplaceUrl)
+// getMarketplaceURL returns the URL of the marketplace, the default marketplace is used if empty.
+func getMarketplaceURL(url string) string {
+	if url == "" {
+		return constants.DefaultExtensionMarketplaceURL
+	}
+	return url
 }
 
 func (r *Repository) getMarketplaceExtensions(url string) (extensions []*extension.Extension, err error) {
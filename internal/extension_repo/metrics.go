@@ -0,0 +1,29 @@
+package extension_repo
+
+import (
+	"seanime/internal/metrics"
+	"time"
+)
+
+var (
+	extensionCallDurationHistogram = metrics.NewHistogramVec(
+		"extension_call_duration_seconds",
+		"Duration of calls to extension providers.",
+		nil,
+		"extension_id", "method",
+	)
+	extensionCallErrorsCounter = metrics.NewCounterVec(
+		"extension_call_errors_total",
+		"Number of calls to extension providers that returned an error or panicked.",
+		"extension_id", "method",
+	)
+)
+
+// observeExtensionCall records the latency and the error of a provider method call.
+// It is deferred before the panic handler so that recovered panics are counted as errors.
+func observeExtensionCall(extensionID string, method string, startTime time.Time, err *error) {
+	extensionCallDurationHistogram.With(extensionID, method).Observe(time.Since(startTime).Seconds())
+	if *err != nil {
+		extensionCallErrorsCounter.With(extensionID, method).Inc()
+	}
+}
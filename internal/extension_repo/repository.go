@@ -32,6 +32,9 @@ type (
 		// Store all active Goja VMs
 		// - When reloading extensions, all VMs are interrupted
 		gojaExtensions *result.Map[string, GojaExtension]
+		// Store all active WebAssembly runtimes
+		// - When reloading extensions, all runtimes are closed
+		wasmExtensions *result.Map[string, WasmExtension]
 
 		gojaRuntimeManager *goja_runtime.Manager
 		// Extension bank
@@ -51,6 +54,12 @@ type (
 		updateData   []UpdateData
 		updateDataMu sync.Mutex
 
+		trustMu sync.RWMutex
+
+		updateSettingsMu sync.Mutex
+		// Auto-updated extensions that are reverted if they break
+		updateProbations *result.Map[string, *updateProbation]
+
 		// Called when the external extensions are loaded for the first time
 		firstExternalExtensionLoadedFunc context.CancelFunc
 
@@ -79,6 +88,10 @@ type (
 		ManifestURI string `json:"manifestURI"`
 		Version     string `json:"version"`
 		Payload     string `json:"payload"`
+		// PublicKey is the publisher key the update is signed with, empty if unsigned
+		PublicKey string `json:"publicKey,omitempty"`
+		// TrustError is set when the update will be refused until the publisher key is approved
+		TrustError string `json:"trustError,omitempty"`
 	}
 
 	OnlinestreamProviderExtensionItem struct {
@@ -124,6 +137,7 @@ func NewRepository(opts *NewRepositoryOptions) *Repository {
 		extensionDir:       opts.ExtensionDir,
 		wsEventManager:     opts.WSEventManager,
 		gojaExtensions:     result.NewMap[string, GojaExtension](),
+		wasmExtensions:     result.NewMap[string, WasmExtension](),
 		gojaRuntimeManager: goja_runtime.NewManager(opts.Logger),
 		extensionBankRef:   opts.ExtensionBankRef,
 		invalidExtensions:  result.NewMap[string, *extension.InvalidExtension](),
@@ -132,10 +146,13 @@ func NewRepository(opts *NewRepositoryOptions) *Repository {
 		client:             http.DefaultClient,
 		builtinExtensions:  result.NewMap[string, *builtinExtension](),
 		updateData:         make([]UpdateData, 0),
+		updateProbations:   result.NewMap[string, *updateProbation](),
 	}
 
 	ret.loadOnlyType.Store([]extension.Type{})
 
+	ret.loadUpdateProbations()
+
 	firstExtensionLoadedCtx, firstExtensionLoadedCancel := context.WithCancel(context.Background())
 	ret.firstExternalExtensionLoadedFunc = firstExtensionLoadedCancel
 
@@ -154,10 +171,14 @@ func NewRepository(opts *NewRepositoryOptions) *Repository {
 
 			ret.firstExternalExtensionLoadedFunc = nil
 
-			ret.updateData = ret.checkForUpdates()
-			if len(ret.updateData) > 0 {
+			// Install the updates of extensions with the auto policy
+			updateData, notify := ret.applyUpdatePolicies(ret.checkForUpdates())
+			ret.updateDataMu.Lock()
+			ret.updateData = updateData
+			ret.updateDataMu.Unlock()
+			if len(notify) > 0 {
 				// Signal the frontend that there are updates available
-				ret.wsEventManager.SendEvent(events.ExtensionUpdatesFound, ret.updateData)
+				ret.wsEventManager.SendEvent(events.ExtensionUpdatesFound, notify)
 			}
 			time.Sleep(12 * time.Hour)
 		}
@@ -0,0 +1,293 @@
+package extension_repo
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"seanime/internal/extension"
+	"seanime/internal/util"
+	"seanime/internal/util/filecache"
+	"slices"
+	"strings"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Extension trust
+// - Manifests can carry a payload hash and an Ed25519 signature from the publisher.
+// - The publisher key of an installed extension is remembered (trust on first use), updates signed by another key are refused
+//   until the user approves the new key.
+// - Users can pin trusted publisher keys per marketplace URL, extensions from that marketplace must be signed by one of them.
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+const (
+	ExtensionTrustKey    = "1"
+	ExtensionTrustBucket = "extension-trust"
+
+	extensionSigningMessageVersion = "seanime-extension-v1"
+)
+
+var (
+	ErrExtensionPayloadHashMismatch = fmt.Errorf("extension: payload does not match the manifest hash")
+	ErrExtensionInvalidSignature    = fmt.Errorf("extension: invalid signature")
+	ErrExtensionMissingSignature    = fmt.Errorf("extension: signature is missing")
+	ErrExtensionUntrustedKey        = fmt.Errorf("extension: publisher key is not trusted for this marketplace")
+	ErrExtensionKeyChanged          = fmt.Errorf("extension: publisher key changed, the new key must be approved")
+)
+
+type (
+	StoredExtensionTrustData struct {
+		PinnedKeys    map[string][]string `json:"pinnedKeys"`    // Marketplace URL -> Trusted publisher keys
+		InstalledKeys map[string]string   `json:"installedKeys"` // Extension ID -> Publisher key at install time, empty if unsigned
+		Marketplaces  map[string]string   `json:"marketplaces"`  // Extension ID -> Marketplace URL it was installed from
+		ApprovedKeys  map[string]string   `json:"approvedKeys"`  // Extension ID -> Publisher key approved for the next install/update
+	}
+)
+
+// ExtensionSigningMessage returns the message signed by the publisher.
+// It binds the extension's identity, version, payload and plugin permissions so none of them can be swapped by the host.
+func ExtensionSigningMessage(ext *extension.Extension) []byte {
+	permissionHash := ""
+	if ext.Plugin != nil {
+		permissionHash = ext.Plugin.Permissions.GetHash()
+	} else if ext.Wasm != nil {
+		permissionHash = ext.Wasm.Permissions.GetHash()
+	}
+	return []byte(strings.Join([]string{
+		extensionSigningMessageVersion,
+		ext.ID,
+		string(ext.Type),
+		ext.Version,
+		util.HashSHA256Hex(ext.Payload),
+		permissionHash,
+	}, "\n"))
+}
+
+// SignExtension sets the payload hash, public key and signature of the extension manifest.
+// The payload must be present.
+func SignExtension(ext *extension.Extension, privateKey ed25519.PrivateKey) {
+	ext.PayloadHash = util.HashSHA256Hex(ext.Payload)
+	ext.PublicKey = base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey))
+	ext.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, ExtensionSigningMessage(ext)))
+}
+
+func decodePublicKey(key string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key, %w", err)
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size: %d", len(b))
+	}
+	return b, nil
+}
+
+// verifyExtensionIntegrity checks the payload hash and the signature of the manifest.
+// Unsigned manifests pass, the trust policy decides whether they're allowed.
+func verifyExtensionIntegrity(ext *extension.Extension) error {
+	// Payload wasn't downloaded, nothing to verify
+	if ext.Payload == "" {
+		return nil
+	}
+
+	if ext.PayloadHash != "" && !strings.EqualFold(ext.PayloadHash, util.HashSHA256Hex(ext.Payload)) {
+		return ErrExtensionPayloadHashMismatch
+	}
+
+	if ext.Signature == "" {
+		if ext.PublicKey != "" {
+			return ErrExtensionMissingSignature
+		}
+		return nil
+	}
+
+	if ext.PublicKey == "" {
+		return fmt.Errorf("extension: public key is missing")
+	}
+
+	publicKey, err := decodePublicKey(ext.PublicKey)
+	if err != nil {
+		return fmt.Errorf("extension: %w", err)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(ext.Signature)
+	if err != nil {
+		return ErrExtensionInvalidSignature
+	}
+
+	if !ed25519.Verify(publicKey, ExtensionSigningMessage(ext), sig) {
+		return ErrExtensionInvalidSignature
+	}
+
+	return nil
+}
+
+// publisherKey returns the key the extension is signed with, or an empty string if it's unsigned.
+func publisherKey(ext *extension.Extension) string {
+	if ext.Signature == "" {
+		return ""
+	}
+	return strings.TrimSpace(ext.PublicKey)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// GetExtensionTrustData returns the stored trust data.
+func (r *Repository) GetExtensionTrustData() *StoredExtensionTrustData {
+	r.trustMu.RLock()
+	defer r.trustMu.RUnlock()
+
+	return r.getExtensionTrustData()
+}
+
+// getExtensionTrustData reads the stored trust data, the caller must hold trustMu.
+func (r *Repository) getExtensionTrustData() *StoredExtensionTrustData {
+	bucket := filecache.NewPermanentBucket(ExtensionTrustBucket)
+
+	var data StoredExtensionTrustData
+	_, _ = r.fileCacher.GetPerm(bucket, ExtensionTrustKey, &data)
+
+	if data.PinnedKeys == nil {
+		data.PinnedKeys = make(map[string][]string)
+	}
+	if data.InstalledKeys == nil {
+		data.InstalledKeys = make(map[string]string)
+	}
+	if data.Marketplaces == nil {
+		data.Marketplaces = make(map[string]string)
+	}
+	if data.ApprovedKeys == nil {
+		data.ApprovedKeys = make(map[string]string)
+	}
+
+	return &data
+}
+
+func (r *Repository) saveExtensionTrustData(data *StoredExtensionTrustData) error {
+	bucket := filecache.NewPermanentBucket(ExtensionTrustBucket)
+	return r.fileCacher.SetPerm(bucket, ExtensionTrustKey, data)
+}
+
+// SetMarketplaceTrustedKeys pins the publisher keys trusted for a marketplace URL, the default marketplace if empty.
+// An empty list removes the pin.
+func (r *Repository) SetMarketplaceTrustedKeys(marketplaceURL string, keys []string) error {
+	r.trustMu.Lock()
+	defer r.trustMu.Unlock()
+
+	marketplaceURL = getMarketplaceURL(marketplaceURL)
+
+	cleaned := make([]string, 0, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if _, err := decodePublicKey(key); err != nil {
+			return err
+		}
+		if !slices.Contains(cleaned, key) {
+			cleaned = append(cleaned, key)
+		}
+	}
+
+	data := r.getExtensionTrustData()
+	if len(cleaned) == 0 {
+		delete(data.PinnedKeys, marketplaceURL)
+	} else {
+		data.PinnedKeys[marketplaceURL] = cleaned
+	}
+
+	return r.saveExtensionTrustData(data)
+}
+
+// ApproveExtensionPublisherKey allows the next install or update of the extension to use the given publisher key.
+// An empty key approves an unsigned payload (e.g. a manually edited extension).
+func (r *Repository) ApproveExtensionPublisherKey(id string, publicKey string) error {
+	r.trustMu.Lock()
+	defer r.trustMu.Unlock()
+
+	if id == "" {
+		return fmt.Errorf("id is empty")
+	}
+
+	publicKey = strings.TrimSpace(publicKey)
+	if publicKey != "" {
+		if _, err := decodePublicKey(publicKey); err != nil {
+			return err
+		}
+	}
+
+	data := r.getExtensionTrustData()
+	data.ApprovedKeys[id] = publicKey
+
+	r.logger.Debug().Str("id", id).Msg("extensions: Approved publisher key")
+
+	return r.saveExtensionTrustData(data)
+}
+
+// checkExtensionTrust verifies the manifest and checks its publisher key against the pinned marketplace keys
+// and the key the extension was installed with.
+// If marketplaceURL is empty, the marketplace the extension was installed from is used.
+func (r *Repository) checkExtensionTrust(ext *extension.Extension, marketplaceURL string) error {
+	// Integrity failures cannot be approved
+	if err := verifyExtensionIntegrity(ext); err != nil {
+		return err
+	}
+
+	r.trustMu.RLock()
+	data := r.getExtensionTrustData()
+	r.trustMu.RUnlock()
+
+	key := publisherKey(ext)
+
+	approvedKey, hasApproval := data.ApprovedKeys[ext.ID]
+	approved := hasApproval && approvedKey == key
+
+	if marketplaceURL == "" {
+		marketplaceURL = data.Marketplaces[ext.ID]
+	}
+
+	if pinned := data.PinnedKeys[marketplaceURL]; len(pinned) > 0 && !approved {
+		if key == "" {
+			return ErrExtensionMissingSignature
+		}
+		if !slices.Contains(pinned, key) {
+			return ErrExtensionUntrustedKey
+		}
+	}
+
+	if installedKey, found := data.InstalledKeys[ext.ID]; found && installedKey != key && !approved {
+		return ErrExtensionKeyChanged
+	}
+
+	return nil
+}
+
+// recordExtensionTrust remembers the publisher key of an installed extension and consumes its approval.
+func (r *Repository) recordExtensionTrust(ext *extension.Extension, marketplaceURL string) {
+	r.trustMu.Lock()
+	defer r.trustMu.Unlock()
+
+	data := r.getExtensionTrustData()
+	data.InstalledKeys[ext.ID] = publisherKey(ext)
+	if marketplaceURL != "" {
+		data.Marketplaces[ext.ID] = marketplaceURL
+	}
+	delete(data.ApprovedKeys, ext.ID)
+
+	if err := r.saveExtensionTrustData(data); err != nil {
+		r.logger.Error().Err(err).Str("id", ext.ID).Msg("extensions: Failed to save trust data")
+	}
+}
+
+// removeExtensionTrust forgets the trust data of an uninstalled extension.
+func (r *Repository) removeExtensionTrust(id string) {
+	r.trustMu.Lock()
+	defer r.trustMu.Unlock()
+
+	data := r.getExtensionTrustData()
+	delete(data.InstalledKeys, id)
+	delete(data.Marketplaces, id)
+	delete(data.ApprovedKeys, id)
+
+	_ = r.saveExtensionTrustData(data)
+}
@@ -0,0 +1,127 @@
+package extension_repo
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"seanime/internal/extension"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSignedTestExtension(t *testing.T, privateKey ed25519.PrivateKey) *extension.Extension {
+	ext := &extension.Extension{
+		ID:       "trust-test",
+		Name:     "Trust Test",
+		Version:  "1.0.0",
+		Language: extension.LanguageTypescript,
+		Type:     extension.TypeAnimeTorrentProvider,
+		Author:   "Seanime",
+		Payload:  "class Provider {}",
+	}
+	if privateKey != nil {
+		SignExtension(ext, privateKey)
+	}
+	return ext
+}
+
+func TestVerifyExtensionIntegrity(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ext := newSignedTestExtension(t, privateKey)
+	require.NoError(t, verifyExtensionIntegrity(ext))
+
+	// Unsigned manifests pass the integrity check
+	require.NoError(t, verifyExtensionIntegrity(newSignedTestExtension(t, nil)))
+
+	// Tampered payload
+	tampered := *ext
+	tampered.Payload = "class Provider { steal() {} }"
+	require.ErrorIs(t, verifyExtensionIntegrity(&tampered), ErrExtensionPayloadHashMismatch)
+
+	// Tampered payload with a matching hash
+	tampered.PayloadHash = ""
+	require.ErrorIs(t, verifyExtensionIntegrity(&tampered), ErrExtensionInvalidSignature)
+
+	// Escalated plugin permissions
+	escalated := *ext
+	escalated.Plugin = &extension.PluginManifest{
+		Version: extension.PluginManifestVersion,
+		Permissions: extension.PluginPermissions{
+			Scopes: []extension.PluginPermissionScope{extension.PluginPermissionSystem},
+		},
+	}
+	require.ErrorIs(t, verifyExtensionIntegrity(&escalated), ErrExtensionInvalidSignature)
+
+	// Public key without signature
+	stripped := *ext
+	stripped.Signature = ""
+	require.ErrorIs(t, verifyExtensionIntegrity(&stripped), ErrExtensionMissingSignature)
+}
+
+func TestCheckExtensionTrust(t *testing.T) {
+	repo := GetMockExtensionRepository(t)
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ext := newSignedTestExtension(t, privateKey)
+	otherExt := newSignedTestExtension(t, otherPrivateKey)
+	unsignedExt := newSignedTestExtension(t, nil)
+
+	// First install, any key is trusted
+	require.NoError(t, repo.checkExtensionTrust(ext, ""))
+	repo.recordExtensionTrust(ext, "")
+
+	// Same key
+	require.NoError(t, repo.checkExtensionTrust(ext, ""))
+
+	// Key changed or signature removed
+	require.ErrorIs(t, repo.checkExtensionTrust(otherExt, ""), ErrExtensionKeyChanged)
+	require.ErrorIs(t, repo.checkExtensionTrust(unsignedExt, ""), ErrExtensionKeyChanged)
+
+	// Approving the new key allows the update once
+	require.NoError(t, repo.ApproveExtensionPublisherKey(ext.ID, otherExt.PublicKey))
+	require.ErrorIs(t, repo.checkExtensionTrust(unsignedExt, ""), ErrExtensionKeyChanged)
+	require.NoError(t, repo.checkExtensionTrust(otherExt, ""))
+	repo.recordExtensionTrust(otherExt, "")
+	require.ErrorIs(t, repo.checkExtensionTrust(ext, ""), ErrExtensionKeyChanged)
+
+	// Uninstalling forgets the key
+	repo.removeExtensionTrust(ext.ID)
+	require.NoError(t, repo.checkExtensionTrust(ext, ""))
+}
+
+func TestCheckExtensionTrust_PinnedMarketplace(t *testing.T) {
+	repo := GetMockExtensionRepository(t)
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	marketplaceURL := "https://example.com/marketplace.json"
+
+	require.Error(t, repo.SetMarketplaceTrustedKeys(marketplaceURL, []string{"not-a-key"}))
+	require.NoError(t, repo.SetMarketplaceTrustedKeys(marketplaceURL, []string{base64.StdEncoding.EncodeToString(publicKey)}))
+
+	require.NoError(t, repo.checkExtensionTrust(newSignedTestExtension(t, privateKey), marketplaceURL))
+	require.ErrorIs(t, repo.checkExtensionTrust(newSignedTestExtension(t, otherPrivateKey), marketplaceURL), ErrExtensionUntrustedKey)
+	require.ErrorIs(t, repo.checkExtensionTrust(newSignedTestExtension(t, nil), marketplaceURL), ErrExtensionMissingSignature)
+
+	// Other marketplaces aren't affected
+	require.NoError(t, repo.checkExtensionTrust(newSignedTestExtension(t, otherPrivateKey), "https://example.org/marketplace.json"))
+
+	// Updates use the marketplace the extension was installed from
+	ext := newSignedTestExtension(t, privateKey)
+	repo.recordExtensionTrust(ext, marketplaceURL)
+	require.Equal(t, marketplaceURL, repo.GetExtensionTrustData().Marketplaces[ext.ID])
+
+	// Removing the pin
+	require.NoError(t, repo.SetMarketplaceTrustedKeys(marketplaceURL, nil))
+	require.NotContains(t, repo.GetExtensionTrustData().PinnedKeys, marketplaceURL)
+}
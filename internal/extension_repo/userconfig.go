@@ -13,6 +13,15 @@ func getExtensionUserConfigBucketKey(extId string) string {
 	return fmt.Sprintf("ext_user_config_%s", extId)
 }
 
+// IsExtensionDataBucket returns true if the filecache bucket holds extension user configs or settings.
+func IsExtensionDataBucket(name string) bool {
+	switch name {
+	case PluginSettingsBucket, ExtensionTrustBucket, ExtensionUpdateSettingsBucket, CustomSourceIdentifierBucket:
+		return true
+	}
+	return strings.HasPrefix(name, "ext_user_config_")
+}
+
 var (
 	ErrMissingUserConfig      = fmt.Errorf("extension: user config is missing")
 	ErrIncompatibleUserConfig = fmt.Errorf("extension: user config is incompatible")
@@ -33,6 +33,24 @@ func pluginManifestSanityCheck(ext *extension.Extension) error {
 	return nil
 }
 
+func wasmManifestSanityCheck(ext *extension.Extension) error {
+	if ext.Type != extension.TypeAnimeTorrentProvider &&
+		ext.Type != extension.TypeOnlinestreamProvider &&
+		ext.Type != extension.TypeCustomSource {
+		return fmt.Errorf("unsupported extension type for wasm: %v", ext.Type)
+	}
+
+	if ext.Wasm == nil {
+		return fmt.Errorf("wasm manifest is missing")
+	}
+
+	if ext.Wasm.ABIVersion != extension.WasmABIVersion {
+		return fmt.Errorf("unsupported wasm ABI version: %v", ext.Wasm.ABIVersion)
+	}
+
+	return nil
+}
+
 func manifestSanityCheck(ext *extension.Extension) error {
 	if ext.ID == "" || ext.Name == "" || ext.Version == "" || ext.Language == "" || ext.Type == "" || ext.Author == "" {
 		return fmt.Errorf("extension is missing required fields, ID: %v, Name: %v, Version: %v, Language: %v, Type: %v, Author: %v, Payload: %v",
@@ -65,7 +83,8 @@ func manifestSanityCheck(ext *extension.Extension) error {
 	// Check language
 	if ext.Language != extension.LanguageGo &&
 		ext.Language != extension.LanguageJavascript &&
-		ext.Language != extension.LanguageTypescript {
+		ext.Language != extension.LanguageTypescript &&
+		ext.Language != extension.LanguageWasm {
 		return fmt.Errorf("unsupported language: %v", ext.Language)
 	}
 
@@ -84,6 +103,12 @@ func manifestSanityCheck(ext *extension.Extension) error {
 		}
 	}
 
+	if ext.Language == extension.LanguageWasm {
+		if err := wasmManifestSanityCheck(ext); err != nil {
+			return err
+		}
+	}
+
 	ext.Lang = strings.ToLower(ext.Lang)
 
 	return nil
@@ -0,0 +1,349 @@
+package extension_repo
+
+import (
+	"context"
+	"fmt"
+	"seanime/internal/api/anilist"
+	"seanime/internal/api/metadata"
+	"seanime/internal/extension"
+	hibikecustomsource "seanime/internal/extension/hibike/customsource"
+	hibikeonlinestream "seanime/internal/extension/hibike/onlinestream"
+	hibiketorrent "seanime/internal/extension/hibike/torrent"
+	"seanime/internal/util"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// WasmExtension is stored in the repository extension map, giving access to the runtime.
+// Current use: Close the runtime when the extension is unloaded.
+type WasmExtension interface {
+	Close()
+	GetExtension() *extension.Extension
+}
+
+type wasmProviderBase struct {
+	ext     *extension.Extension
+	logger  *zerolog.Logger
+	runtime *wasmRuntime
+}
+
+func initializeWasmProviderBase(ext *extension.Extension, logger *zerolog.Logger) (*wasmProviderBase, error) {
+	runtime, err := newWasmRuntime(ext, logger)
+	if err != nil {
+		logger.Error().Err(err).Str("id", ext.ID).Msg("extensions: Failed to initialize wasm runtime")
+		return nil, err
+	}
+
+	return &wasmProviderBase{
+		ext:     ext,
+		logger:  logger,
+		runtime: runtime,
+	}, nil
+}
+
+func (w *wasmProviderBase) GetExtension() *extension.Extension {
+	return w.ext
+}
+
+func (w *wasmProviderBase) Close() {
+	w.runtime.Close()
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Anime torrent provider
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type WasmAnimeTorrentProvider struct {
+	*wasmProviderBase
+}
+
+func NewWasmAnimeTorrentProvider(ext *extension.Extension, logger *zerolog.Logger) (hibiketorrent.AnimeProvider, *WasmAnimeTorrentProvider, error) {
+	base, err := initializeWasmProviderBase(ext, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := &WasmAnimeTorrentProvider{
+		wasmProviderBase: base,
+	}
+	return provider, provider, nil
+}
+
+func (w *WasmAnimeTorrentProvider) Search(opts hibiketorrent.AnimeSearchOptions) (ret []*hibiketorrent.AnimeTorrent, err error) {
+	defer observeExtensionCall(w.ext.ID, "Search", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".Search", &err)
+
+	if err = w.runtime.call(context.Background(), "search", &ret, opts); err != nil {
+		return nil, err
+	}
+
+	for i := range ret {
+		ret[i].Provider = w.ext.ID
+	}
+
+	return
+}
+
+func (w *WasmAnimeTorrentProvider) SmartSearch(opts hibiketorrent.AnimeSmartSearchOptions) (ret []*hibiketorrent.AnimeTorrent, err error) {
+	defer observeExtensionCall(w.ext.ID, "SmartSearch", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".SmartSearch", &err)
+
+	if err = w.runtime.call(context.Background(), "smartSearch", &ret, opts); err != nil {
+		return nil, err
+	}
+
+	for i := range ret {
+		ret[i].Provider = w.ext.ID
+	}
+
+	return
+}
+
+func (w *WasmAnimeTorrentProvider) GetTorrentInfoHash(torrent *hibiketorrent.AnimeTorrent) (ret string, err error) {
+	defer observeExtensionCall(w.ext.ID, "GetTorrentInfoHash", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".GetTorrentInfoHash", &err)
+
+	if err = w.runtime.call(context.Background(), "getTorrentInfoHash", &ret, torrent); err != nil {
+		return "", err
+	}
+
+	return
+}
+
+func (w *WasmAnimeTorrentProvider) GetTorrentMagnetLink(torrent *hibiketorrent.AnimeTorrent) (ret string, err error) {
+	defer observeExtensionCall(w.ext.ID, "GetTorrentMagnetLink", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".GetTorrentMagnetLink", &err)
+
+	if err = w.runtime.call(context.Background(), "getTorrentMagnetLink", &ret, torrent); err != nil {
+		return "", err
+	}
+
+	return
+}
+
+func (w *WasmAnimeTorrentProvider) GetLatest() (ret []*hibiketorrent.AnimeTorrent, err error) {
+	defer observeExtensionCall(w.ext.ID, "GetLatest", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".GetLatest", &err)
+
+	if err = w.runtime.call(context.Background(), "getLatest", &ret); err != nil {
+		return nil, err
+	}
+
+	for i := range ret {
+		ret[i].Provider = w.ext.ID
+	}
+
+	return
+}
+
+func (w *WasmAnimeTorrentProvider) GetSettings() (ret hibiketorrent.AnimeProviderSettings) {
+	defer util.HandlePanicInModuleThen(w.ext.ID+".GetSettings", func() {
+		ret = hibiketorrent.AnimeProviderSettings{}
+	})
+
+	_ = w.runtime.call(context.Background(), "getSettings", &ret)
+
+	return
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Online streaming provider
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type WasmOnlinestreamProvider struct {
+	*wasmProviderBase
+}
+
+func NewWasmOnlinestreamProvider(ext *extension.Extension, logger *zerolog.Logger) (hibikeonlinestream.Provider, *WasmOnlinestreamProvider, error) {
+	base, err := initializeWasmProviderBase(ext, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := &WasmOnlinestreamProvider{
+		wasmProviderBase: base,
+	}
+	return provider, provider, nil
+}
+
+func (w *WasmOnlinestreamProvider) Search(opts hibikeonlinestream.SearchOptions) (ret []*hibikeonlinestream.SearchResult, err error) {
+	defer observeExtensionCall(w.ext.ID, "Search", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".Search", &err)
+
+	ret = make([]*hibikeonlinestream.SearchResult, 0)
+	if err = w.runtime.call(context.Background(), "search", &ret, opts); err != nil {
+		return nil, fmt.Errorf("failed to call search method: %w", err)
+	}
+
+	return ret, nil
+}
+
+func (w *WasmOnlinestreamProvider) FindEpisodes(id string) (ret []*hibikeonlinestream.EpisodeDetails, err error) {
+	defer observeExtensionCall(w.ext.ID, "FindEpisodes", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".FindEpisodes", &err)
+
+	if err = w.runtime.call(context.Background(), "findEpisodes", &ret, id); err != nil {
+		return nil, err
+	}
+
+	for _, episode := range ret {
+		episode.Provider = w.ext.ID
+	}
+
+	return
+}
+
+func (w *WasmOnlinestreamProvider) FindEpisodeServer(episode *hibikeonlinestream.EpisodeDetails, server string) (ret *hibikeonlinestream.EpisodeServer, err error) {
+	defer observeExtensionCall(w.ext.ID, "FindEpisodeServer", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".FindEpisodeServer", &err)
+
+	if err = w.runtime.call(context.Background(), "findEpisodeServer", &ret, episode, server); err != nil {
+		return nil, err
+	}
+
+	if ret == nil {
+		return nil, fmt.Errorf("episode server not found")
+	}
+
+	ret.Provider = w.ext.ID
+
+	return
+}
+
+func (w *WasmOnlinestreamProvider) GetSettings() (ret hibikeonlinestream.Settings) {
+	defer util.HandlePanicInModuleThen(w.ext.ID+".GetSettings", func() {
+		ret = hibikeonlinestream.Settings{}
+	})
+
+	_ = w.runtime.call(context.Background(), "getSettings", &ret)
+
+	return
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Custom source
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type WasmCustomSource struct {
+	*wasmProviderBase
+	extensionIdentifier int
+}
+
+func NewWasmCustomSource(ext *extension.Extension, logger *zerolog.Logger) (hibikecustomsource.Provider, *WasmCustomSource, error) {
+	base, err := initializeWasmProviderBase(ext, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := &WasmCustomSource{
+		wasmProviderBase: base,
+	}
+	return provider, provider, nil
+}
+
+func (w *WasmCustomSource) GetExtensionIdentifier() int {
+	return w.extensionIdentifier
+}
+
+func (w *WasmCustomSource) GetSettings() (ret hibikecustomsource.Settings) {
+	defer util.HandlePanicInModuleThen(w.ext.ID+".GetSettings", func() {
+		ret = hibikecustomsource.Settings{}
+	})
+
+	_ = w.runtime.call(context.Background(), "getSettings", &ret)
+
+	return
+}
+
+func (w *WasmCustomSource) GetAnime(ctx context.Context, id []int) (ret []*anilist.BaseAnime, err error) {
+	defer observeExtensionCall(w.ext.ID, "GetAnime", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".GetAnime", &err)
+
+	if err = w.runtime.call(ctx, "getAnime", &ret, id); err != nil {
+		return nil, fmt.Errorf("failed to call getAnime method: %w", err)
+	}
+
+	return ret, nil
+}
+
+func (w *WasmCustomSource) ListAnime(ctx context.Context, search string, page int, perPage int) (ret *hibikecustomsource.ListAnimeResponse, err error) {
+	defer observeExtensionCall(w.ext.ID, "ListAnime", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".ListAnime", &err)
+
+	if err = w.runtime.call(ctx, "listAnime", &ret, search, page, perPage); err != nil {
+		return nil, fmt.Errorf("failed to call listAnime method: %w", err)
+	}
+
+	return ret, nil
+}
+
+func (w *WasmCustomSource) GetAnimeWithRelations(ctx context.Context, id int) (ret *anilist.CompleteAnime, err error) {
+	defer observeExtensionCall(w.ext.ID, "GetAnimeWithRelations", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".GetAnimeWithRelations", &err)
+
+	if err = w.runtime.call(ctx, "getAnimeWithRelations", &ret, id); err != nil {
+		return nil, fmt.Errorf("failed to call getAnimeWithRelations method: %w", err)
+	}
+
+	if ret == nil || ret.Relations == nil {
+		return nil, fmt.Errorf("relations not found")
+	}
+
+	return ret, nil
+}
+
+func (w *WasmCustomSource) GetAnimeMetadata(ctx context.Context, id int) (ret *metadata.AnimeMetadata, err error) {
+	defer observeExtensionCall(w.ext.ID, "GetAnimeMetadata", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".GetAnimeMetadata", &err)
+
+	if err = w.runtime.call(ctx, "getAnimeMetadata", &ret, id); err != nil {
+		return nil, fmt.Errorf("failed to call getAnimeMetadata method: %w", err)
+	}
+
+	return ret, nil
+}
+
+func (w *WasmCustomSource) GetAnimeDetails(ctx context.Context, id int) (ret *anilist.AnimeDetailsById_Media, err error) {
+	defer observeExtensionCall(w.ext.ID, "GetAnimeDetails", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".GetAnimeDetails", &err)
+
+	if err = w.runtime.call(ctx, "getAnimeDetails", &ret, id); err != nil || ret == nil {
+		return &anilist.AnimeDetailsById_Media{}, nil
+	}
+
+	return ret, nil
+}
+
+func (w *WasmCustomSource) GetManga(ctx context.Context, id []int) (ret []*anilist.BaseManga, err error) {
+	defer observeExtensionCall(w.ext.ID, "GetManga", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".GetManga", &err)
+
+	if err = w.runtime.call(ctx, "getManga", &ret, id); err != nil {
+		return nil, fmt.Errorf("failed to call getManga method: %w", err)
+	}
+
+	return ret, nil
+}
+
+func (w *WasmCustomSource) ListManga(ctx context.Context, search string, page int, perPage int) (ret *hibikecustomsource.ListMangaResponse, err error) {
+	defer observeExtensionCall(w.ext.ID, "ListManga", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".ListManga", &err)
+
+	if err = w.runtime.call(ctx, "listManga", &ret, search, page, perPage); err != nil {
+		return nil, fmt.Errorf("failed to call listManga method: %w", err)
+	}
+
+	return ret, nil
+}
+
+func (w *WasmCustomSource) GetMangaDetails(ctx context.Context, id int) (ret *anilist.MangaDetailsById_Media, err error) {
+	defer observeExtensionCall(w.ext.ID, "GetMangaDetails", time.Now(), &err)
+	defer util.HandlePanicInModuleWithError(w.ext.ID+".GetMangaDetails", &err)
+
+	if err = w.runtime.call(ctx, "getMangaDetails", &ret, id); err != nil || ret == nil {
+		return &anilist.MangaDetailsById_Media{}, nil
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,469 @@
+package extension_repo
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"seanime/internal/extension"
+	goja_bindings "seanime/internal/goja/goja_bindings"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// WebAssembly runtime
+// - Modules are compiled once and instantiated lazily, up to wasmMaxInstances instances per extension.
+// - An instance is never used by two calls at the same time.
+// - See extension.WasmManifest for the ABI.
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+const (
+	wasmHostModuleName  = "seanime"
+	wasmAllocFunction   = "seanime_alloc"
+	wasmFreeFunction    = "seanime_free"
+	wasmCallFunction    = "seanime_call"
+	wasmMaxInstances    = 4
+	wasmMemoryLimit     = 4096 // 256 MiB
+	wasmCallTimeout     = 60 * time.Second
+	wasmFetchTimeout    = 35 * time.Second
+	wasmMaxResponseSize = 32 << 20 // 32 MB
+)
+
+var (
+	ErrWasmRuntimeClosed = errors.New("wasm: runtime is closed")
+
+	// Shared by all runtimes so that reloading an extension doesn't compile the module again
+	wasmCompilationCache = wazero.NewCompilationCache()
+)
+
+type (
+	wasmRuntime struct {
+		ext            *extension.Extension
+		logger         *zerolog.Logger
+		runtime        wazero.Runtime
+		compiled       wazero.CompiledModule
+		idle           chan api.Module
+		slots          chan struct{}
+		closed         atomic.Bool
+		allowedDomains []string
+		client         *http.Client
+		// Called with the outcome of each provider method call, may be nil
+		callResultFunc func(err error)
+	}
+
+	wasmCallResponse struct {
+		Result json.RawMessage `json:"result"`
+		Error  string          `json:"error"`
+	}
+
+	wasmFetchRequest struct {
+		URL     string            `json:"url"`
+		Method  string            `json:"method"`
+		Headers map[string]string `json:"headers"`
+		Body    string            `json:"body"`
+	}
+
+	wasmFetchResponse struct {
+		Status     int               `json:"status"`
+		StatusText string            `json:"statusText"`
+		Headers    map[string]string `json:"headers"`
+		Body       string            `json:"body"`
+		Error      string            `json:"error,omitempty"`
+	}
+)
+
+func newWasmRuntime(ext *extension.Extension, logger *zerolog.Logger) (ret *wasmRuntime, err error) {
+	binary, err := base64.StdEncoding.DecodeString(strings.TrimSpace(ext.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("wasm: payload is not base64-encoded: %w", err)
+	}
+
+	ctx := context.Background()
+
+	ret = &wasmRuntime{
+		ext:    ext,
+		logger: logger,
+		runtime: wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+			WithMemoryLimitPages(wasmMemoryLimit).
+			WithCloseOnContextDone(true).
+			WithCompilationCache(wasmCompilationCache)),
+		idle:   make(chan api.Module, wasmMaxInstances),
+		slots:  make(chan struct{}, wasmMaxInstances),
+		client: &http.Client{Timeout: wasmFetchTimeout},
+	}
+
+	if ext.Wasm != nil {
+		ret.allowedDomains = ext.Wasm.Permissions.GetNetworkAccessAllowedDomains()
+	}
+
+	defer func() {
+		if err != nil {
+			_ = ret.runtime.Close(ctx)
+		}
+	}()
+
+	// Modules built for WASI (Go, Rust, Zig) need the preview1 imports
+	// No filesystem or environment is exposed
+	if _, err = wasi_snapshot_preview1.Instantiate(ctx, ret.runtime); err != nil {
+		return nil, fmt.Errorf("wasm: failed to instantiate WASI: %w", err)
+	}
+
+	_, err = ret.runtime.NewHostModuleBuilder(wasmHostModuleName).
+		NewFunctionBuilder().WithFunc(ret.hostLog).Export("log").
+		NewFunctionBuilder().WithFunc(ret.hostFetch).Export("fetch").
+		NewFunctionBuilder().WithFunc(ret.hostGetUserConfig).Export("get_user_config").
+		Instantiate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("wasm: failed to instantiate host module: %w", err)
+	}
+
+	ret.compiled, err = ret.runtime.CompileModule(ctx, binary)
+	if err != nil {
+		return nil, fmt.Errorf("wasm: compilation failed: %w", err)
+	}
+
+	for _, name := range []string{wasmAllocFunction, wasmCallFunction} {
+		if _, ok := ret.compiled.ExportedFunctions()[name]; !ok {
+			return nil, fmt.Errorf("wasm: module does not export %s", name)
+		}
+	}
+
+	// Instantiate once to catch initialization errors early
+	mod, err := ret.instantiate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret.slots <- struct{}{}
+	ret.put(mod, nil)
+
+	return ret, nil
+}
+
+func (w *wasmRuntime) instantiate(ctx context.Context) (api.Module, error) {
+	config := wazero.NewModuleConfig().
+		WithName("").
+		// Reactor modules (e.g. Go with -buildmode=c-shared) are initialized by "_initialize"
+		WithStartFunctions("_initialize").
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep().
+		WithRandSource(rand.Reader)
+
+	mod, err := w.runtime.InstantiateModule(ctx, w.compiled, config)
+	if err != nil {
+		return nil, fmt.Errorf("wasm: failed to instantiate module: %w", err)
+	}
+	return mod, nil
+}
+
+// get returns an idle instance or creates a new one if the limit isn't reached.
+func (w *wasmRuntime) get(ctx context.Context) (api.Module, error) {
+	if w.closed.Load() {
+		return nil, ErrWasmRuntimeClosed
+	}
+
+	select {
+	case w.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case mod := <-w.idle:
+		return mod, nil
+	default:
+	}
+
+	mod, err := w.instantiate(ctx)
+	if err != nil {
+		<-w.slots
+		return nil, err
+	}
+	return mod, nil
+}
+
+// put returns the instance to the pool.
+// Instances that failed are discarded since their state can't be trusted.
+func (w *wasmRuntime) put(mod api.Module, callErr error) {
+	defer func() { <-w.slots }()
+
+	var methodErr *wasmMethodError
+	if (callErr != nil && !errors.As(callErr, &methodErr)) || w.closed.Load() || mod.IsClosed() {
+		_ = mod.Close(context.Background())
+		return
+	}
+
+	select {
+	case w.idle <- mod:
+	default:
+		_ = mod.Close(context.Background())
+	}
+}
+
+func (w *wasmRuntime) Close() {
+	if w.closed.Swap(true) {
+		return
+	}
+	_ = w.runtime.Close(context.Background())
+}
+
+// call calls a provider method and unmarshals the result into ret.
+func (w *wasmRuntime) call(ctx context.Context, method string, ret interface{}, args ...interface{}) (err error) {
+	if w.callResultFunc != nil {
+		defer func() {
+			w.callResultFunc(err)
+		}()
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, wasmCallTimeout)
+		defer cancel()
+	}
+
+	if args == nil {
+		args = []interface{}{}
+	}
+	input, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("wasm: failed to marshal arguments: %w", err)
+	}
+
+	mod, err := w.get(ctx)
+	if err != nil {
+		w.logger.Error().Err(err).Str("id", w.ext.ID).Msg("extension: Failed to get wasm instance")
+		return err
+	}
+	defer func() {
+		w.put(mod, err)
+	}()
+
+	methodPtr, err := writeToModule(ctx, mod, []byte(method))
+	if err != nil {
+		return err
+	}
+	inputPtr, err := writeToModule(ctx, mod, input)
+	if err != nil {
+		return err
+	}
+
+	res, err := mod.ExportedFunction(wasmCallFunction).Call(ctx, uint64(methodPtr), uint64(len(method)), uint64(inputPtr), uint64(len(input)))
+	if err != nil {
+		return fmt.Errorf("wasm: %s failed: %w", method, err)
+	}
+
+	output, err := readFromModule(ctx, mod, res[0])
+	if err != nil {
+		return err
+	}
+
+	var resp wasmCallResponse
+	if err = json.Unmarshal(output, &resp); err != nil {
+		return fmt.Errorf("wasm: invalid response from %s: %w", method, err)
+	}
+
+	if resp.Error != "" {
+		// Errors returned by the module don't invalidate the instance
+		return &wasmMethodError{method: method, message: resp.Error}
+	}
+
+	if ret == nil || len(resp.Result) == 0 || string(resp.Result) == "null" {
+		return nil
+	}
+
+	if err = json.Unmarshal(resp.Result, ret); err != nil {
+		return fmt.Errorf("wasm: failed to unmarshal result of %s: %w", method, err)
+	}
+
+	return nil
+}
+
+type wasmMethodError struct {
+	method  string
+	message string
+}
+
+func (e *wasmMethodError) Error() string {
+	return e.method + ": " + e.message
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Memory helpers
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func packPtrLen(ptr uint32, size uint32) uint64 {
+	return uint64(ptr)<<32 | uint64(size)
+}
+
+func unpackPtrLen(v uint64) (ptr uint32, size uint32) {
+	return uint32(v >> 32), uint32(v)
+}
+
+// writeToModule copies data into a buffer allocated by the module.
+func writeToModule(ctx context.Context, mod api.Module, data []byte) (uint32, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	res, err := mod.ExportedFunction(wasmAllocFunction).Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("wasm: allocation failed: %w", err)
+	}
+	ptr := uint32(res[0])
+	if !mod.Memory().Write(ptr, data) {
+		return 0, fmt.Errorf("wasm: allocated buffer is out of range")
+	}
+	return ptr, nil
+}
+
+// readFromModule copies a packed buffer out of the module's memory and frees it if the module exports seanime_free.
+func readFromModule(ctx context.Context, mod api.Module, packed uint64) ([]byte, error) {
+	ptr, size := unpackPtrLen(packed)
+	if size == 0 {
+		return nil, nil
+	}
+	data, ok := mod.Memory().Read(ptr, size)
+	if !ok {
+		return nil, fmt.Errorf("wasm: buffer is out of range")
+	}
+	ret := bytes.Clone(data)
+
+	if free := mod.ExportedFunction(wasmFreeFunction); free != nil {
+		_, _ = free.Call(ctx, uint64(ptr), uint64(size))
+	}
+
+	return ret, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Host functions
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (w *wasmRuntime) hostLog(_ context.Context, mod api.Module, level uint32, ptr uint32, size uint32) {
+	msg, ok := mod.Memory().Read(ptr, size)
+	if !ok {
+		return
+	}
+
+	var event *zerolog.Event
+	switch level {
+	case 0:
+		event = w.logger.Debug()
+	case 1:
+		event = w.logger.Info()
+	case 2:
+		event = w.logger.Warn()
+	default:
+		event = w.logger.Error()
+	}
+	event.Str("id", w.ext.ID).Msg("extension: " + string(msg))
+}
+
+func (w *wasmRuntime) hostGetUserConfig(ctx context.Context, mod api.Module, ptr uint32, size uint32) uint64 {
+	key, ok := mod.Memory().Read(ptr, size)
+	if !ok {
+		return 0
+	}
+
+	value, found := "", false
+	if w.ext.SavedUserConfig != nil {
+		value, found = w.ext.SavedUserConfig.Values[string(key)]
+	}
+	if !found && w.ext.UserConfig != nil {
+		for _, field := range w.ext.UserConfig.Fields {
+			if field.Name == string(key) && field.Default != "" {
+				value, found = field.Default, true
+			}
+		}
+	}
+	if !found || value == "" {
+		return 0
+	}
+
+	retPtr, err := writeToModule(ctx, mod, []byte(value))
+	if err != nil {
+		return 0
+	}
+	return packPtrLen(retPtr, uint32(len(value)))
+}
+
+func (w *wasmRuntime) hostFetch(ctx context.Context, mod api.Module, ptr uint32, size uint32) uint64 {
+	resp := w.fetch(ctx, mod, ptr, size)
+
+	data, _ := json.Marshal(resp)
+	retPtr, err := writeToModule(ctx, mod, data)
+	if err != nil {
+		return 0
+	}
+	return packPtrLen(retPtr, uint32(len(data)))
+}
+
+func (w *wasmRuntime) fetch(ctx context.Context, mod api.Module, ptr uint32, size uint32) *wasmFetchResponse {
+	raw, ok := mod.Memory().Read(ptr, size)
+	if !ok {
+		return &wasmFetchResponse{Error: "request is out of range"}
+	}
+
+	var fetchReq wasmFetchRequest
+	if err := json.Unmarshal(raw, &fetchReq); err != nil {
+		return &wasmFetchResponse{Error: "invalid request: " + err.Error()}
+	}
+
+	if !goja_bindings.IsURLAllowed(w.allowedDomains, fetchReq.URL) {
+		w.logger.Warn().Str("id", w.ext.ID).Str("url", fetchReq.URL).Msg("extension: Blocked request to a domain that isn't allowed")
+		return &wasmFetchResponse{Error: "access to this domain is not allowed"}
+	}
+
+	if fetchReq.Method == "" {
+		fetchReq.Method = http.MethodGet
+	}
+
+	var body io.Reader
+	if fetchReq.Body != "" {
+		body = strings.NewReader(fetchReq.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(fetchReq.Method), fetchReq.URL, body)
+	if err != nil {
+		return &wasmFetchResponse{Error: err.Error()}
+	}
+	for k, v := range fetchReq.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return &wasmFetchResponse{Error: err.Error()}
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, wasmMaxResponseSize))
+	if err != nil {
+		return &wasmFetchResponse{Error: err.Error()}
+	}
+
+	headers := make(map[string]string, len(res.Header))
+	for k := range res.Header {
+		headers[strings.ToLower(k)] = res.Header.Get(k)
+	}
+
+	return &wasmFetchResponse{
+		Status:     res.StatusCode,
+		StatusText: res.Status,
+		Headers:    headers,
+		Body:       string(resBody),
+	}
+}
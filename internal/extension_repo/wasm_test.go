@@ -0,0 +1,134 @@
+package extension_repo
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"seanime/internal/extension"
+	hibiketorrent "seanime/internal/extension/hibike/torrent"
+	"seanime/internal/util"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestWasmProvider compiles wasm_testdir/provider to WebAssembly.
+func buildTestWasmProvider(t *testing.T) string {
+	out := filepath.Join(t.TempDir(), "provider.wasm")
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", out, ".")
+	cmd.Dir = "wasm_testdir/provider"
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("failed to build the wasm provider: %v\n%s", err, b)
+	}
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestWasmAnimeTorrentProvider(t *testing.T) {
+	payload := buildTestWasmProvider(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("result for " + r.URL.Query().Get("q")))
+	}))
+	defer server.Close()
+
+	newExt := func(allowedDomains []string) *extension.Extension {
+		return &extension.Extension{
+			ID:       "wasm-test",
+			Name:     "Wasm Test",
+			Version:  "1.0.0",
+			Language: extension.LanguageWasm,
+			Type:     extension.TypeAnimeTorrentProvider,
+			Author:   "Seanime",
+			Payload:  payload,
+			Wasm: &extension.WasmManifest{
+				ABIVersion: extension.WasmABIVersion,
+				Permissions: extension.PluginPermissions{
+					Allow: extension.PluginAllowlist{
+						NetworkAccess: extension.PluginNetworkAcess{AllowedDomains: allowedDomains},
+					},
+				},
+			},
+			SavedUserConfig: &extension.SavedUserConfig{
+				Values: map[string]string{"baseUrl": server.URL},
+			},
+		}
+	}
+
+	t.Run("Allowed domain", func(t *testing.T) {
+		ext := newExt([]string{"127.0.0.1"})
+		require.NoError(t, manifestSanityCheck(ext))
+
+		provider, wasmExt, err := NewWasmAnimeTorrentProvider(ext, util.NewLogger())
+		require.NoError(t, err)
+		defer wasmExt.Close()
+
+		settings := provider.GetSettings()
+		require.Equal(t, hibiketorrent.AnimeProviderTypeMain, settings.Type)
+
+		torrents, err := provider.Search(hibiketorrent.AnimeSearchOptions{Query: "frieren"})
+		require.NoError(t, err)
+		require.Len(t, torrents, 1)
+		require.Equal(t, "result for frieren", torrents[0].Name)
+		require.Equal(t, server.URL, torrents[0].Link)
+		require.Equal(t, ext.ID, torrents[0].Provider)
+
+		// Errors returned by the module
+		_, err = provider.GetLatest()
+		require.ErrorContains(t, err, "not implemented")
+
+		// The instance is reused after a module error
+		torrents, err = provider.Search(hibiketorrent.AnimeSearchOptions{Query: "dandadan"})
+		require.NoError(t, err)
+		require.Equal(t, "result for dandadan", torrents[0].Name)
+	})
+
+	t.Run("Blocked domain", func(t *testing.T) {
+		provider, wasmExt, err := NewWasmAnimeTorrentProvider(newExt(nil), util.NewLogger())
+		require.NoError(t, err)
+		defer wasmExt.Close()
+
+		_, err = provider.Search(hibiketorrent.AnimeSearchOptions{Query: "frieren"})
+		require.ErrorContains(t, err, "not allowed")
+	})
+
+	t.Run("Closed runtime", func(t *testing.T) {
+		provider, wasmExt, err := NewWasmAnimeTorrentProvider(newExt(nil), util.NewLogger())
+		require.NoError(t, err)
+		wasmExt.Close()
+
+		_, err = provider.Search(hibiketorrent.AnimeSearchOptions{Query: "frieren"})
+		require.ErrorIs(t, err, ErrWasmRuntimeClosed)
+	})
+}
+
+func TestWasmManifestSanityCheck(t *testing.T) {
+	ext := &extension.Extension{
+		ID:       "wasm-test",
+		Name:     "Wasm Test",
+		Version:  "1.0.0",
+		Language: extension.LanguageWasm,
+		Type:     extension.TypePlugin,
+		Author:   "Seanime",
+		Payload:  "AGFzbQ==",
+		Plugin:   &extension.PluginManifest{Version: extension.PluginManifestVersion},
+	}
+	require.ErrorContains(t, manifestSanityCheck(ext), "unsupported extension type for wasm")
+
+	ext.Type = extension.TypeOnlinestreamProvider
+	ext.Plugin = nil
+	require.ErrorContains(t, manifestSanityCheck(ext), "wasm manifest is missing")
+
+	ext.Wasm = &extension.WasmManifest{ABIVersion: "0"}
+	require.ErrorContains(t, manifestSanityCheck(ext), "unsupported wasm ABI version")
+
+	ext.Wasm.ABIVersion = extension.WasmABIVersion
+	require.NoError(t, manifestSanityCheck(ext))
+}
@@ -0,0 +1,112 @@
+//go:build wasip1
+
+// Example anime torrent provider compiled to WebAssembly.
+// GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o provider.wasm .
+package main
+
+import (
+	"encoding/json"
+	"unsafe"
+)
+
+//go:wasmimport seanime log
+func hostLog(level uint32, ptr unsafe.Pointer, size uint32)
+
+//go:wasmimport seanime fetch
+func hostFetch(ptr unsafe.Pointer, size uint32) uint64
+
+//go:wasmimport seanime get_user_config
+func hostGetUserConfig(ptr unsafe.Pointer, size uint32) uint64
+
+// Keep the buffers handed to the host alive until they're freed
+var buffers = map[uint32][]byte{}
+
+//go:wasmexport seanime_alloc
+func alloc(size uint32) uint32 {
+	buf := make([]byte, size)
+	ptr := uint32(uintptr(unsafe.Pointer(&buf[0])))
+	buffers[ptr] = buf
+	return ptr
+}
+
+//go:wasmexport seanime_free
+func free(ptr uint32, _ uint32) {
+	delete(buffers, ptr)
+}
+
+func take(ptr uint32, size uint32) []byte {
+	buf := buffers[ptr]
+	delete(buffers, ptr)
+	return buf[:size]
+}
+
+func unpack(v uint64) []byte {
+	if v == 0 {
+		return nil
+	}
+	return take(uint32(v>>32), uint32(v))
+}
+
+func log(msg string) {
+	b := []byte(msg)
+	hostLog(1, unsafe.Pointer(&b[0]), uint32(len(b)))
+}
+
+func userConfig(key string) string {
+	b := []byte(key)
+	return string(unpack(hostGetUserConfig(unsafe.Pointer(&b[0]), uint32(len(b)))))
+}
+
+type fetchResponse struct {
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+	Error  string `json:"error"`
+}
+
+func fetch(url string) fetchResponse {
+	req, _ := json.Marshal(map[string]string{"url": url, "method": "GET"})
+	var res fetchResponse
+	_ = json.Unmarshal(unpack(hostFetch(unsafe.Pointer(&req[0]), uint32(len(req)))), &res)
+	return res
+}
+
+type torrent struct {
+	Name string `json:"name"`
+	Link string `json:"link"`
+}
+
+//go:wasmexport seanime_call
+func call(methodPtr, methodLen, inputPtr, inputLen uint32) uint64 {
+	method := string(take(methodPtr, methodLen))
+	var args []json.RawMessage
+	_ = json.Unmarshal(take(inputPtr, inputLen), &args)
+
+	var result any
+	var errMsg string
+
+	switch method {
+	case "getSettings":
+		result = map[string]any{"type": "main", "canSmartSearch": false}
+	case "search":
+		var opts struct {
+			Query string `json:"query"`
+		}
+		_ = json.Unmarshal(args[0], &opts)
+		log("searching " + opts.Query)
+		res := fetch(userConfig("baseUrl") + "/search?q=" + opts.Query)
+		if res.Error != "" {
+			errMsg = res.Error
+			break
+		}
+		result = []torrent{{Name: res.Body, Link: userConfig("baseUrl")}}
+	default:
+		errMsg = "not implemented"
+	}
+
+	out, _ := json.Marshal(map[string]any{"result": result, "error": errMsg})
+	ptr := alloc(uint32(len(out)))
+	copy(buffers[ptr], out)
+	return uint64(ptr)<<32 | uint64(len(out))
+}
+
+func main() {}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/url"
 	"seanime/internal/util"
+	"slices"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -197,6 +198,14 @@ func BindFetch(vm *goja.Runtime, allowedDomains ...[]string) *Fetch {
 	return f
 }
 
+// IsURLAllowed reports whether the URL can be fetched with the given allowed domains.
+// The same rules as the fetch binding apply, including the whitelisted domains.
+func IsURLAllowed(allowedDomains []string, urlStr string) bool {
+	f := &Fetch{allowedDomains: lo.Uniq(append(slices.Clone(allowedDomains), whitelistedDomains...))}
+	f.compileRules()
+	return f.isURLAllowed(urlStr)
+}
+
 func (f *Fetch) isURLAllowed(urlStr string) bool {
 	if len(f.rules) == 0 {
 		return false
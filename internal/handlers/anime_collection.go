@@ -1,10 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"seanime/internal/api/anilist"
 	"seanime/internal/customsource"
-	"seanime/internal/database/db_bridge"
 	"seanime/internal/library/anime"
 	"seanime/internal/torrentstream"
 	"seanime/internal/util"
@@ -160,7 +160,7 @@ func (h *Handler) HandleGetLibraryCollection(c echo.Context) error {
 		}
 
 	} else {
-		lfs, _, err = db_bridge.GetLocalFiles(h.App.Database)
+		lfs, err = h.getLocalFilesWithOfflineEpisodes()
 		if err != nil {
 			return h.RespondWithError(c, err)
 		}
@@ -231,6 +231,16 @@ var animeScheduleCache = result.NewCache[int, []*anime.ScheduleItem]()
 //	@route /api/v1/library/schedule [GET]
 //	@returns []anime.ScheduleItem
 func (h *Handler) HandleGetAnimeCollectionSchedule(c echo.Context) error {
+	ret, err := h.getAnimeScheduleItems(c.Request().Context())
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, ret)
+}
+
+// getAnimeScheduleItems returns the cached schedule items of the anime collection.
+func (h *Handler) getAnimeScheduleItems(ctx context.Context) ([]*anime.ScheduleItem, error) {
 
 	// Invalidate the cache when the Anilist collection is refreshed
 	h.App.AddOnRefreshAnilistCollectionFunc("HandleGetAnimeCollectionSchedule", func() {
@@ -238,24 +248,24 @@ func (h *Handler) HandleGetAnimeCollectionSchedule(c echo.Context) error {
 	})
 
 	if ret, ok := animeScheduleCache.Get(1); ok {
-		return h.RespondWithData(c, ret)
+		return ret, nil
 	}
 
-	animeSchedule, err := h.App.AnilistPlatformRef.Get().GetAnimeAiringSchedule(c.Request().Context())
+	animeSchedule, err := h.App.AnilistPlatformRef.Get().GetAnimeAiringSchedule(ctx)
 	if err != nil {
-		return h.RespondWithError(c, err)
+		return nil, err
 	}
 
 	animeCollection, err := h.App.GetAnimeCollection(false)
 	if err != nil {
-		return h.RespondWithError(c, err)
+		return nil, err
 	}
 
 	ret := anime.GetScheduleItems(animeSchedule, animeCollection)
 
 	animeScheduleCache.SetT(1, ret, 1*time.Hour)
 
-	return h.RespondWithData(c, ret)
+	return ret, nil
 }
 
 // HandleAddUnknownMedia
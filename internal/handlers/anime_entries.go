@@ -117,7 +117,7 @@ func (h *Handler) HandleGetAnimeEntry(c echo.Context) error {
 	}
 
 	// Get all the local files
-	lfs, _, err := db_bridge.GetLocalFiles(h.App.Database)
+	lfs, err := h.getLocalFilesWithOfflineEpisodes()
 	if err != nil {
 		return h.RespondWithError(c, err)
 	}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"seanime/internal/core"
+	"seanime/internal/database/models"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleGetApiTokens
+//
+//	@summary returns the personal API tokens.
+//	@desc The tokens themselves are not returned, only their prefix.
+//	@route /api/v1/api-tokens [GET]
+//	@returns []models.ApiToken
+func (h *Handler) HandleGetApiTokens(c echo.Context) error {
+	tokens, err := h.App.ApiTokenManager.List()
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, tokens)
+}
+
+type CreateApiTokenResponse struct {
+	Token    string           `json:"token"`
+	ApiToken *models.ApiToken `json:"apiToken"`
+}
+
+// HandleCreateApiToken
+//
+//	@summary creates a personal API token.
+//	@desc The token is only returned once, only its hash is stored.
+//	@desc The token is sent in the 'Authorization: Bearer <token>' or 'X-Seanime-Token' header when a server password is set.
+//	@desc Requests made with the token can only access the routes of the features listed in 'scopes'.
+//	@desc API tokens can't be used to manage API tokens.
+//	@route /api/v1/api-tokens [POST]
+//	@returns handlers.CreateApiTokenResponse
+func (h *Handler) HandleCreateApiToken(c echo.Context) error {
+	type body struct {
+		Name      string            `json:"name"`
+		Scopes    []core.FeatureKey `json:"scopes"`
+		ExpiresAt *time.Time        `json:"expiresAt"` // Never expires if nil
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	scopes := make([]string, 0, len(b.Scopes))
+	for _, scope := range b.Scopes {
+		if !core.IsValidFeature(scope) {
+			return h.RespondWithError(c, fmt.Errorf("unknown scope: %s", scope))
+		}
+		scopes = append(scopes, string(scope))
+	}
+
+	token, apiToken, err := h.App.ApiTokenManager.Create(b.Name, scopes, b.ExpiresAt)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, &CreateApiTokenResponse{
+		Token:    token,
+		ApiToken: apiToken,
+	})
+}
+
+// HandleRevokeApiToken
+//
+//	@summary revokes a personal API token.
+//	@desc Requests using the token are rejected immediately.
+//	@route /api/v1/api-tokens [DELETE]
+//	@returns bool
+func (h *Handler) HandleRevokeApiToken(c echo.Context) error {
+	type body struct {
+		ID uint `json:"id"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.ApiTokenManager.Revoke(b.ID); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
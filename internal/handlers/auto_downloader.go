@@ -49,6 +49,17 @@ func (h *Handler) HandleRunAutoDownloaderSimulation(c echo.Context) error {
 	return h.RespondWithData(c, res)
 }
 
+// HandleGetAutoDownloaderPollingPlan
+//
+//	@summary returns the polling plan of the auto downloader.
+//	@desc If the airing schedule is enabled, rules whose episode recently aired are checked more often
+//	@desc and full checks are less frequent when no episode is due.
+//	@route /api/v1/auto-downloader/polling-plan [GET]
+//	@returns autodownloader.PollingPlan
+func (h *Handler) HandleGetAutoDownloaderPollingPlan(c echo.Context) error {
+	return h.RespondWithData(c, h.App.AutoDownloader.GetPollingPlan(c.Request().Context()))
+}
+
 // HandleGetAutoDownloaderRule
 //
 //	@summary returns the rule with the given DB id.
@@ -324,6 +335,136 @@ func (h *Handler) HandleDeleteAutoDownloaderProfile(c echo.Context) error {
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
+// HandleGetAutoDownloaderRuleTemplates
+//
+//	@summary returns all rule templates.
+//	@route /api/v1/auto-downloader/rule-templates [GET]
+//	@returns []anime.AutoDownloaderRuleTemplate
+func (h *Handler) HandleGetAutoDownloaderRuleTemplates(c echo.Context) error {
+	templates, err := db_bridge.GetAutoDownloaderRuleTemplates(h.App.Database)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, templates)
+}
+
+// HandleCreateAutoDownloaderRuleTemplate
+//
+//	@summary creates a new rule template.
+//	@desc Rules are created for the matching entries the next time the anime collection is refreshed or the templates are applied.
+//	@route /api/v1/auto-downloader/rule-template [POST]
+//	@returns anime.AutoDownloaderRuleTemplate
+func (h *Handler) HandleCreateAutoDownloaderRuleTemplate(c echo.Context) error {
+	var template anime.AutoDownloaderRuleTemplate
+	if err := c.Bind(&template); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.validateAutoDownloaderRuleTemplate(&template); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	template.DbID = 0
+	if err := db_bridge.InsertAutoDownloaderRuleTemplate(h.App.Database, &template); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, template)
+}
+
+// HandleUpdateAutoDownloaderRuleTemplate
+//
+//	@summary updates a rule template.
+//	@route /api/v1/auto-downloader/rule-template [PATCH]
+//	@returns anime.AutoDownloaderRuleTemplate
+func (h *Handler) HandleUpdateAutoDownloaderRuleTemplate(c echo.Context) error {
+	var template anime.AutoDownloaderRuleTemplate
+	if err := c.Bind(&template); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if template.DbID == 0 {
+		return h.RespondWithError(c, errors.New("invalid template id"))
+	}
+
+	if err := h.validateAutoDownloaderRuleTemplate(&template); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := db_bridge.UpdateAutoDownloaderRuleTemplate(h.App.Database, template.DbID, &template); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, template)
+}
+
+// HandleDeleteAutoDownloaderRuleTemplate
+//
+//	@summary deletes a rule template.
+//	@desc The rules created by the template are kept.
+//	@route /api/v1/auto-downloader/rule-template/{id} [DELETE]
+//	@param id - int - true - "The DB id of the template"
+//	@returns bool
+func (h *Handler) HandleDeleteAutoDownloaderRuleTemplate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return h.RespondWithError(c, errors.New("invalid id"))
+	}
+
+	if err := db_bridge.DeleteAutoDownloaderRuleTemplate(h.App.Database, uint(id)); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandlePreviewAutoDownloaderRuleTemplates
+//
+//	@summary returns the rules that the templates would create and delete.
+//	@route /api/v1/auto-downloader/rule-templates/preview [GET]
+//	@returns autodownloader.RuleTemplatePlan
+func (h *Handler) HandlePreviewAutoDownloaderRuleTemplates(c echo.Context) error {
+	plan, err := h.App.AutoDownloader.ApplyRuleTemplates(true)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, plan)
+}
+
+// HandleApplyAutoDownloaderRuleTemplates
+//
+//	@summary creates and deletes the rules of the templates.
+//	@desc This is also done after the anime collection is refreshed.
+//	@route /api/v1/auto-downloader/rule-templates/apply [POST]
+//	@returns autodownloader.RuleTemplatePlan
+func (h *Handler) HandleApplyAutoDownloaderRuleTemplates(c echo.Context) error {
+	plan, err := h.App.AutoDownloader.ApplyRuleTemplates(false)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, plan)
+}
+
+func (h *Handler) validateAutoDownloaderRuleTemplate(template *anime.AutoDownloaderRuleTemplate) error {
+	if template.Name == "" {
+		return errors.New("template name is required")
+	}
+	if template.DestinationPattern != "" && filepath.IsAbs(template.DestinationPattern) {
+		return nil
+	}
+	// Relative patterns are resolved against the library path
+	libraryPath, err := h.App.Database.GetLibraryPathFromSettings()
+	if err != nil || libraryPath == "" {
+		return errors.New("destination pattern must be an absolute path if the library path is not set")
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
 // HandleGetAutoDownloaderItems
 //
 //	@summary returns all queued items.
@@ -365,3 +506,33 @@ func (h *Handler) HandleDeleteAutoDownloaderItem(c echo.Context) error {
 
 	return h.RespondWithData(c, true)
 }
+
+// HandleGetAutoDownloaderUpgrades
+//
+//	@summary returns the upgrade history.
+//	@desc Upgrades are episodes in the library that were replaced by a better release.
+//	@desc Pending upgrades are removed from the library once the new release is downloaded.
+//	@route /api/v1/auto-downloader/upgrades [GET]
+//	@returns []models.AutoDownloaderUpgrade
+func (h *Handler) HandleGetAutoDownloaderUpgrades(c echo.Context) error {
+	upgrades, err := h.App.Database.GetAutoDownloaderUpgrades()
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, upgrades)
+}
+
+// HandleClearAutoDownloaderUpgrades
+//
+//	@summary clears the upgrade history.
+//	@desc Pending upgrades are kept.
+//	@route /api/v1/auto-downloader/upgrades [DELETE]
+//	@returns bool
+func (h *Handler) HandleClearAutoDownloaderUpgrades(c echo.Context) error {
+	if err := h.App.Database.DeleteFinishedAutoDownloaderUpgrades(); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"seanime/internal/backup"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleGetBackups
+//
+//	@summary returns the backups in the backup directory, newest first.
+//	@route /api/v1/backup/list [GET]
+//	@returns []backup.Info
+func (h *Handler) HandleGetBackups(c echo.Context) error {
+	backups, err := backup.ListBackups(h.App.BackupManager.GetSettings().Dir)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, backups)
+}
+
+// HandleGetBackupBuckets
+//
+//	@summary returns the filecache buckets that can be included in a backup.
+//	@route /api/v1/backup/buckets [GET]
+//	@returns []string
+func (h *Handler) HandleGetBackupBuckets(c echo.Context) error {
+	buckets, err := h.App.BackupManager.ListBuckets()
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, buckets)
+}
+
+// HandleCreateBackup
+//
+//	@summary creates a backup in the backup directory.
+//	@desc If no components are given, all of them are included.
+//	@desc If no buckets are given, all filecache buckets are included.
+//	@route /api/v1/backup/create [POST]
+//	@returns backup.Info
+func (h *Handler) HandleCreateBackup(c echo.Context) error {
+	var b backup.CreateOptions
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	dir := h.App.BackupManager.GetSettings().Dir
+
+	p, err := h.App.BackupManager.CreateBackup(dir, b)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	backups, err := backup.ListBackups(dir)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+	for _, info := range backups {
+		if info.Name == filepath.Base(p) {
+			return h.RespondWithData(c, info)
+		}
+	}
+
+	return h.RespondWithError(c, errors.New("backup not found"))
+}
+
+// HandleDeleteBackup
+//
+//	@summary deletes a backup from the backup directory.
+//	@route /api/v1/backup [DELETE]
+//	@returns bool
+func (h *Handler) HandleDeleteBackup(c echo.Context) error {
+	type body struct {
+		Name string `json:"name"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	p, err := backup.GetBackupPath(h.App.BackupManager.GetSettings().Dir, b.Name)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err = os.Remove(p); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleDownloadBackup
+//
+//	@summary downloads a backup from the backup directory.
+//	@route /api/v1/backup/download/:name [GET]
+//	@returns nil
+func (h *Handler) HandleDownloadBackup(c echo.Context) error {
+	p, err := backup.GetBackupPath(h.App.BackupManager.GetSettings().Dir, c.Param("name"))
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return c.Attachment(p, filepath.Base(p))
+}
+
+// HandleRestoreBackup
+//
+//	@summary schedules a backup from the backup directory to be restored.
+//	@desc The archive is validated and restored the next time the server starts.
+//	@route /api/v1/backup/restore [POST]
+//	@returns backup.Manifest
+func (h *Handler) HandleRestoreBackup(c echo.Context) error {
+	type body struct {
+		Name string `json:"name"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	p, err := backup.GetBackupPath(h.App.BackupManager.GetSettings().Dir, b.Name)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+	defer f.Close()
+
+	manifest, err := h.App.BackupManager.StageRestore(f)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, manifest)
+}
+
+// HandleUploadBackup
+//
+//	@summary schedules an uploaded backup to be restored.
+//	@desc The archive is validated and restored the next time the server starts.
+//	@route /api/v1/backup/restore/upload [POST]
+//	@returns backup.Manifest
+func (h *Handler) HandleUploadBackup(c echo.Context) error {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+	defer src.Close()
+
+	manifest, err := h.App.BackupManager.StageRestore(src)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, manifest)
+}
+
+// HandleGetPendingRestore
+//
+//	@summary returns the backup scheduled to be restored on the next start, if any.
+//	@route /api/v1/backup/restore [GET]
+//	@returns backup.Manifest
+func (h *Handler) HandleGetPendingRestore(c echo.Context) error {
+	return h.RespondWithData(c, h.App.BackupManager.GetPendingRestore())
+}
+
+// HandleCancelPendingRestore
+//
+//	@summary cancels the scheduled restore.
+//	@route /api/v1/backup/restore [DELETE]
+//	@returns bool
+func (h *Handler) HandleCancelPendingRestore(c echo.Context) error {
+	if err := h.App.BackupManager.CancelPendingRestore(); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleGetBackupSettings
+//
+//	@summary returns the scheduled backup settings.
+//	@route /api/v1/backup/settings [GET]
+//	@returns backup.Settings
+func (h *Handler) HandleGetBackupSettings(c echo.Context) error {
+	return h.RespondWithData(c, h.App.BackupManager.GetSettings())
+}
+
+// HandleSaveBackupSettings
+//
+//	@summary saves the scheduled backup settings.
+//	@route /api/v1/backup/settings [POST]
+//	@returns backup.Settings
+func (h *Handler) HandleSaveBackupSettings(c echo.Context) error {
+	var b backup.Settings
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.BackupManager.SaveSettings(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, h.App.BackupManager.GetSettings())
+}
@@ -3,7 +3,6 @@ package handlers
 import (
 	"fmt"
 	"net/http"
-	"seanime/internal/database/db_bridge"
 	"seanime/internal/directstream"
 	"seanime/internal/mkvparser"
 
@@ -27,7 +26,7 @@ func (h *Handler) HandleDirectstreamPlayLocalFile(c echo.Context) error {
 		return h.RespondWithError(c, err)
 	}
 
-	lfs, _, err := db_bridge.GetLocalFiles(h.App.Database)
+	lfs, err := h.getLocalFilesWithOfflineEpisodes()
 	if err != nil {
 		return h.RespondWithError(c, err)
 	}
@@ -6,6 +6,7 @@ import (
 	"seanime/internal/core"
 	"seanime/internal/extension"
 	"seanime/internal/extension_playground"
+	"seanime/internal/extension_repo"
 	"seanime/internal/util"
 	"strings"
 	"sync/atomic"
@@ -44,6 +45,8 @@ func (h *Handler) HandleFetchExternalExtensionData(c echo.Context) error {
 func (h *Handler) HandleInstallExternalExtension(c echo.Context) error {
 	type body struct {
 		ManifestURI string `json:"manifestUri"`
+		// Optional, the marketplace the extension is installed from, empty for the default marketplace
+		MarketplaceURL *string `json:"marketplaceUrl"`
 	}
 
 	var b body
@@ -51,7 +54,13 @@ func (h *Handler) HandleInstallExternalExtension(c echo.Context) error {
 		return h.RespondWithError(c, err)
 	}
 
-	res, err := h.App.ExtensionRepository.InstallExternalExtension(b.ManifestURI)
+	var res *extension_repo.ExtensionInstallResponse
+	var err error
+	if b.MarketplaceURL != nil {
+		res, err = h.App.ExtensionRepository.InstallMarketplaceExtension(b.ManifestURI, *b.MarketplaceURL)
+	} else {
+		res, err = h.App.ExtensionRepository.InstallExternalExtension(b.ManifestURI)
+	}
 	if err != nil {
 		return h.RespondWithError(c, err)
 	}
@@ -418,3 +427,130 @@ func (h *Handler) HandleGetMarketplaceExtensions(c echo.Context) error {
 
 	return h.RespondWithData(c, extensions)
 }
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// HandleGetExtensionTrustData
+//
+//	@summary returns the pinned marketplace keys and the publisher keys of installed extensions.
+//	@route /api/v1/extensions/trust [GET]
+//	@returns extension_repo.StoredExtensionTrustData
+func (h *Handler) HandleGetExtensionTrustData(c echo.Context) error {
+	return h.RespondWithData(c, h.App.ExtensionRepository.GetExtensionTrustData())
+}
+
+// HandleSetMarketplaceTrustedKeys
+//
+//	@summary pins the publisher keys trusted for a marketplace.
+//	@desc Extensions installed from the marketplace must be signed by one of the keys.
+//	@desc An empty list removes the pin.
+//	@route /api/v1/extensions/trust/marketplace-keys [POST]
+//	@returns bool
+func (h *Handler) HandleSetMarketplaceTrustedKeys(c echo.Context) error {
+	type body struct {
+		MarketplaceURL string   `json:"marketplaceUrl"`
+		PublicKeys     []string `json:"publicKeys"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.ExtensionRepository.SetMarketplaceTrustedKeys(b.MarketplaceURL, b.PublicKeys); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleApproveExtensionPublisherKey
+//
+//	@summary approves a new publisher key for the extension with the given ID.
+//	@desc This allows the next install or update to be signed by the given key.
+//	@desc An empty key allows an unsigned payload, e.g. when editing the code of a signed extension.
+//	@route /api/v1/extensions/trust/approve [POST]
+//	@returns bool
+func (h *Handler) HandleApproveExtensionPublisherKey(c echo.Context) error {
+	type body struct {
+		ID        string `json:"id"`
+		PublicKey string `json:"publicKey"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.ExtensionRepository.ApproveExtensionPublisherKey(b.ID, b.PublicKey); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleGetExtensionUpdateSettings
+//
+//	@summary returns the update policies of the extensions and the versions that can be rolled back to.
+//	@route /api/v1/extensions/update-settings [GET]
+//	@returns extension_repo.ExtensionUpdateSettings
+func (h *Handler) HandleGetExtensionUpdateSettings(c echo.Context) error {
+	return h.RespondWithData(c, h.App.ExtensionRepository.GetExtensionUpdateSettings())
+}
+
+// HandleSetExtensionUpdatePolicy
+//
+//	@summary sets the update policy of the extension with the given ID.
+//	@desc The policy is either "manual", "notify" or "auto".
+//	@desc Auto-updated extensions are rolled back if the new version fails to load or its provider keeps failing.
+//	@route /api/v1/extensions/update-settings/policy [POST]
+//	@returns bool
+func (h *Handler) HandleSetExtensionUpdatePolicy(c echo.Context) error {
+	type body struct {
+		ID     string                               `json:"id"`
+		Policy extension_repo.ExtensionUpdatePolicy `json:"policy"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.ExtensionRepository.SetExtensionUpdatePolicy(b.ID, b.Policy); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleRollbackExtension
+//
+//	@summary restores the version of the extension that was installed before the last update.
+//	@route /api/v1/extensions/external/rollback [POST]
+//	@returns bool
+func (h *Handler) HandleRollbackExtension(c echo.Context) error {
+	type body struct {
+		ID string `json:"id"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.ExtensionRepository.RollbackExtension(b.ID); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleUpdateAllExtensions
+//
+//	@summary installs all available extension updates.
+//	@desc Updates that require a new publisher key to be approved are skipped and returned as failed.
+//	@route /api/v1/extensions/external/update-all [POST]
+//	@returns extension_repo.UpdateAllExtensionsResponse
+func (h *Handler) HandleUpdateAllExtensions(c echo.Context) error {
+	return h.RespondWithData(c, h.App.ExtensionRepository.UpdateAllExtensions())
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"seanime/internal/core"
+	"seanime/internal/extension"
+	"seanime/internal/extension_repo"
+	"seanime/internal/util"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleInstallExternalExtension_PinnedMarketplaceKeys(t *testing.T) {
+	repo := extension_repo.GetMockExtensionRepository(t)
+	h := &Handler{App: &core.App{Logger: util.NewLogger(), ExtensionRepository: repo}}
+
+	pinnedKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	marketplaceURL := "https://example.com/marketplace.json"
+	require.NoError(t, repo.SetMarketplaceTrustedKeys(marketplaceURL, []string{base64.StdEncoding.EncodeToString(pinnedKey)}))
+
+	// The extension is signed by a key that isn't pinned for the marketplace
+	ext := &extension.Extension{
+		ID:       "pinned-test",
+		Name:     "Pinned Test",
+		Version:  "1.0.0",
+		Language: extension.LanguageTypescript,
+		Type:     extension.TypeAnimeTorrentProvider,
+		Author:   "Seanime",
+		Payload:  "class Provider {}",
+	}
+	extension_repo.SignExtension(ext, otherPrivateKey)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(ext)
+	}))
+	defer server.Close()
+
+	install := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/extensions/external/install", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleInstallExternalExtension(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	rec := install(`{"manifestUri":"` + server.URL + `","marketplaceUrl":"` + marketplaceURL + `"}`)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Contains(t, rec.Body.String(), extension_repo.ErrExtensionUntrustedKey.Error())
+
+	// An empty marketplace URL is the default marketplace
+	require.NoError(t, repo.SetMarketplaceTrustedKeys("", []string{base64.StdEncoding.EncodeToString(pinnedKey)}))
+	rec = install(`{"manifestUri":"` + server.URL + `","marketplaceUrl":""}`)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Contains(t, rec.Body.String(), extension_repo.ErrExtensionUntrustedKey.Error())
+
+	// The extension isn't installed
+	require.NotContains(t, repo.GetExtensionTrustData().InstalledKeys, ext.ID)
+}
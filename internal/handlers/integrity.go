@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/library/anime"
+	"seanime/internal/library/integrity"
+	"seanime/internal/util"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleGetIntegrityReports
+//
+//	@summary returns the health report of every checked local file.
+//	@route /api/v1/library/integrity/reports [GET]
+//	@returns []models.LocalFileHealth
+func (h *Handler) HandleGetIntegrityReports(c echo.Context) error {
+	reports, err := h.App.IntegrityManager.GetReports()
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, reports)
+}
+
+// HandleGetIntegrityStatus
+//
+//	@summary returns the state of the integrity check worker.
+//	@route /api/v1/library/integrity/status [GET]
+//	@returns integrity.Status
+func (h *Handler) HandleGetIntegrityStatus(c echo.Context) error {
+	return h.RespondWithData(c, h.App.IntegrityManager.GetStatus())
+}
+
+// HandleRunIntegrityCheck
+//
+//	@summary queues local files to be checked.
+//	@desc If no paths are given, all local files are queued.
+//	@desc Unless 'force' is true, files that haven't changed since their last check are skipped.
+//	@route /api/v1/library/integrity/check [POST]
+//	@returns bool
+func (h *Handler) HandleRunIntegrityCheck(c echo.Context) error {
+	type body struct {
+		Paths []string `json:"paths"`
+		Force bool     `json:"force"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	lfs, _, err := db_bridge.GetLocalFiles(h.App.Database)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if len(b.Paths) > 0 {
+		paths := make(map[string]struct{}, len(b.Paths))
+		for _, p := range b.Paths {
+			paths[util.NormalizePath(p)] = struct{}{}
+		}
+		filtered := make([]*anime.LocalFile, 0, len(b.Paths))
+		for _, lf := range lfs {
+			if _, ok := paths[lf.GetNormalizedPath()]; ok {
+				filtered = append(filtered, lf)
+			}
+		}
+		lfs = filtered
+	}
+
+	h.App.IntegrityManager.Enqueue(lfs, b.Force)
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleCancelIntegrityCheck
+//
+//	@summary clears the integrity check queue and stops the current check.
+//	@route /api/v1/library/integrity/check [DELETE]
+//	@returns bool
+func (h *Handler) HandleCancelIntegrityCheck(c echo.Context) error {
+	h.App.IntegrityManager.CancelChecks()
+	return h.RespondWithData(c, true)
+}
+
+// HandleRecheckCorruptTorrent
+//
+//	@summary asks the torrent client to verify the torrent containing the file.
+//	@desc The torrent client downloads the corrupt pieces again.
+//	@route /api/v1/library/integrity/recheck-torrent [POST]
+//	@returns bool
+func (h *Handler) HandleRecheckCorruptTorrent(c echo.Context) error {
+	type body struct {
+		Path string `json:"path"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.IntegrityManager.RecheckTorrent(b.Path); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleGetIntegritySettings
+//
+//	@summary returns the integrity check settings.
+//	@route /api/v1/library/integrity/settings [GET]
+//	@returns integrity.Settings
+func (h *Handler) HandleGetIntegritySettings(c echo.Context) error {
+	return h.RespondWithData(c, h.App.IntegrityManager.GetSettings())
+}
+
+// HandleSaveIntegritySettings
+//
+//	@summary saves the integrity check settings.
+//	@route /api/v1/library/integrity/settings [POST]
+//	@returns integrity.Settings
+func (h *Handler) HandleSaveIntegritySettings(c echo.Context) error {
+	var b integrity.Settings
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.IntegrityManager.SaveSettings(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, h.App.IntegrityManager.GetSettings())
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"seanime/internal/local/listimport"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleLocalImportList
+//
+//	@summary imports a list exported from another service into the local account.
+//	@desc The format is "mal" (MAL XML), "anilist" (AniList JSON), "kitsu" (Kitsu JSON) or "csv" (CSV with mal_id or anilist_id columns).
+//	@desc Existing entries that differ are reported as conflicts and are only replaced if 'overwrite' is true.
+//	@desc Use 'dryRun' to get the report without modifying the local account.
+//	@route /api/v1/local/list-import [POST]
+//	@returns listimport.ImportReport
+func (h *Handler) HandleLocalImportList(c echo.Context) error {
+	type body struct {
+		Format    listimport.Format `json:"format"`
+		Content   string            `json:"content"`
+		Overwrite bool              `json:"overwrite"`
+		DryRun    bool              `json:"dryRun"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	entries, err := listimport.Parse(b.Format, []byte(b.Content))
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	report, err := h.App.ListImporter.Import(c.Request().Context(), entries, &listimport.ImportOptions{
+		Overwrite: b.Overwrite,
+		DryRun:    b.DryRun,
+	})
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	// Reload the local collection if it is the one being used
+	if !b.DryRun && h.App.GetUser().IsSimulated {
+		_, _ = h.App.RefreshAnimeCollection()
+	}
+
+	return h.RespondWithData(c, report)
+}
+
+// HandleLocalExportListToMal
+//
+//	@summary exports the anime collection to the MAL XML format.
+//	@desc The file can be imported by MyAnimeList, Kitsu and most other services.
+//	@desc Entries of anime that are not on MyAnimeList are left out.
+//	@route /api/v1/local/list-export/mal [GET]
+//	@returns string
+func (h *Handler) HandleLocalExportListToMal(c echo.Context) error {
+	collection, err := h.App.GetRawAnimeCollection(false)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	username := ""
+	if u := h.App.GetUser(); !u.IsSimulated && u.Viewer != nil {
+		username = u.Viewer.Name
+	}
+
+	data, skipped, err := listimport.ExportMalXML(collection, username)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	filename := fmt.Sprintf("seanime-animelist-%s.xml", time.Now().Format("2006-01-02"))
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Response().Header().Set("X-Skipped-Entries", fmt.Sprint(skipped))
+
+	return c.Blob(http.StatusOK, "application/xml; charset=utf-8", data)
+}
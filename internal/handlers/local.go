@@ -1,12 +1,25 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/library/anime"
+	"seanime/internal/local"
 	"seanime/internal/util"
 	"strconv"
 
 	"github.com/labstack/echo/v4"
 )
 
+// getLocalFilesWithOfflineEpisodes returns the local files and the episodes downloaded for offline use.
+func (h *Handler) getLocalFilesWithOfflineEpisodes() ([]*anime.LocalFile, error) {
+	lfs, _, err := db_bridge.GetLocalFiles(h.App.Database)
+	if err != nil {
+		return nil, err
+	}
+	return append(lfs, h.App.LocalManager.GetOfflineLocalFiles()...), nil
+}
 
 
 // HandleLocalGetTrackedMediaItems
@@ -202,3 +215,128 @@ func (h *Handler) HandleLocalSyncSimulatedDataToAnilist(c echo.Context) error {
 	}
 	return h.RespondWithData(c, true)
 }
+
+// HandleLocalDownloadStreamedEpisode
+//
+//	@summary downloads the episode being streamed for offline use.
+//	@desc The source is either "torrentstream" or "debrid".
+//	@desc The anime is tracked for offline sync once the download is complete.
+//	@route /api/v1/local/episodes/download [POST]
+//	@returns bool
+func (h *Handler) HandleLocalDownloadStreamedEpisode(c echo.Context) error {
+	type body struct {
+		Source string `json:"source"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	opts := &local.DownloadEpisodeOptions{
+		Source: b.Source,
+	}
+
+	switch b.Source {
+	case local.OfflineEpisodeSourceTorrentstream:
+		streamOpts, ok := h.App.TorrentstreamRepository.GetPreviousStreamOptions()
+		if !ok {
+			return h.RespondWithError(c, errors.New("no torrent stream found"))
+		}
+		reader, name, size, err := h.App.TorrentstreamRepository.OpenCurrentFile()
+		if err != nil {
+			return h.RespondWithError(c, err)
+		}
+		opts.MediaId = streamOpts.MediaId
+		opts.EpisodeNumber = streamOpts.EpisodeNumber
+		opts.AniDBEpisode = streamOpts.AniDBEpisode
+		opts.Reader = reader
+		opts.Filename = name
+		opts.Size = size
+	case local.OfflineEpisodeSourceDebrid:
+		streamOpts, ok := h.App.DebridClientRepository.GetPreviousStreamOptions()
+		if !ok {
+			return h.RespondWithError(c, errors.New("no debrid stream found"))
+		}
+		streamUrl, ok := h.App.DebridClientRepository.GetStreamURL()
+		if !ok {
+			return h.RespondWithError(c, errors.New("no debrid stream found"))
+		}
+		opts.MediaId = streamOpts.MediaId
+		opts.EpisodeNumber = streamOpts.EpisodeNumber
+		opts.AniDBEpisode = streamOpts.AniDBEpisode
+		opts.Url = streamUrl
+	default:
+		return h.RespondWithError(c, fmt.Errorf("invalid source %q", b.Source))
+	}
+
+	if err := h.App.LocalManager.DownloadEpisode(opts); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleLocalGetEpisodeDownloads
+//
+//	@summary gets the episodes being downloaded for offline use.
+//	@route /api/v1/local/episodes/downloads [GET]
+//	@returns []local.EpisodeDownload
+func (h *Handler) HandleLocalGetEpisodeDownloads(c echo.Context) error {
+	return h.RespondWithData(c, h.App.LocalManager.GetEpisodeDownloads())
+}
+
+// HandleLocalCancelEpisodeDownload
+//
+//	@summary cancels the download of an episode.
+//	@route /api/v1/local/episodes/downloads [DELETE]
+//	@returns bool
+func (h *Handler) HandleLocalCancelEpisodeDownload(c echo.Context) error {
+	type body struct {
+		MediaId       int `json:"mediaId"`
+		EpisodeNumber int `json:"episodeNumber"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.LocalManager.CancelEpisodeDownload(b.MediaId, b.EpisodeNumber); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleLocalGetOfflineEpisodes
+//
+//	@summary gets the episodes downloaded for offline use.
+//	@route /api/v1/local/episodes [GET]
+//	@returns []local.OfflineEpisode
+func (h *Handler) HandleLocalGetOfflineEpisodes(c echo.Context) error {
+	return h.RespondWithData(c, h.App.LocalManager.GetOfflineEpisodes())
+}
+
+// HandleLocalRemoveOfflineEpisode
+//
+//	@summary deletes an episode downloaded for offline use.
+//	@route /api/v1/local/episodes [DELETE]
+//	@returns bool
+func (h *Handler) HandleLocalRemoveOfflineEpisode(c echo.Context) error {
+	type body struct {
+		MediaId       int `json:"mediaId"`
+		EpisodeNumber int `json:"episodeNumber"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.LocalManager.RemoveOfflineEpisode(b.MediaId, b.EpisodeNumber); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"seanime/internal/metrics"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const metricsPath = "/api/v1/metrics"
+
+// HandleGetMetrics
+//
+//	@summary returns the metrics in the Prometheus text format.
+//	@desc When the server is protected, scrapers can authenticate with the metrics token set in the config, an API token with the ViewMetrics scope or the server password.
+//	@desc The token is sent with the "Authorization: Bearer <token>" header.
+//	@route /api/v1/metrics [GET]
+//	@returns string
+func (h *Handler) HandleGetMetrics(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderContentType, metrics.ContentType)
+	c.Response().WriteHeader(http.StatusOK)
+
+	if _, err := metrics.WriteTo(c.Response().Writer); err != nil {
+		h.App.Logger.Error().Err(err).Msg("handlers: Failed to write metrics")
+	}
+
+	return nil
+}
+
+// isMetricsTokenValid returns true if the request is sent to the metrics endpoint with the metrics token set in the config.
+func (h *Handler) isMetricsTokenValid(c echo.Context) bool {
+	expected := h.App.Config.Server.Metrics.Token
+	if expected == "" || c.Request().URL.Path != metricsPath {
+		return false
+	}
+
+	token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if !ok {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"net/url"
 	"seanime/internal/api/anilist"
 	"seanime/internal/customsource"
 	"seanime/internal/database/db_bridge"
@@ -404,8 +405,58 @@ func (h *Handler) HandleNakamaHostAnimeLibraryServeStream(c echo.Context) error
 	return c.File(string(decodedPath))
 }
 
+// route /api/v1/nakama/host/anime/library/download?path={base64_encoded_path}&token={hmac_token}
+// Allows peers to copy a file of the shared anime library, with support for range requests.
+func (h *Handler) HandleNakamaHostAnimeLibraryDownload(c echo.Context) error {
+	nakamaSettings := h.App.Settings.GetNakama()
+	if !nakamaSettings.Enabled || !nakamaSettings.IsHost || !nakamaSettings.HostShareLocalAnimeLibrary {
+		return echo.NewHTTPError(http.StatusForbidden, "host is not sharing its anime library")
+	}
+
+	// Peers sign each request for the file with the host password
+	if err := nakama.ValidateHostAnimeLibraryDownloadToken(nakamaSettings.HostPassword, c.QueryParam("token"), c.QueryParam("path")); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+	}
+
+	decodedPath, err := base64.StdEncoding.DecodeString(c.QueryParam("path"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid path")
+	}
+	path := string(decodedPath)
+
+	// Only shared files can be downloaded
+	lfs, err := h.getFilteredLocalFiles(0)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get local files")
+	}
+	lf, found := lo.Find(lfs, func(lf *anime.LocalFile) bool {
+		return lf.HasSamePath(path)
+	})
+	if !found {
+		return echo.NewHTTPError(http.StatusNotFound, "file not shared")
+	}
+
+	isInLibrary := false
+	for _, libraryPath := range h.App.Settings.GetLibrary().GetLibraryPaths() {
+		if util.IsFileUnderDir(lf.Path, libraryPath) {
+			isInLibrary = true
+			break
+		}
+	}
+	if !isInLibrary {
+		return echo.NewHTTPError(http.StatusNotFound, "file not in library")
+	}
+
+	h.App.Logger.Debug().Str("path", lf.Path).Str("range", c.Request().Header.Get("Range")).Msg("nakama: Serving anime library file for download")
+
+	if err := h.App.NakamaLibrarySync.ServeFile(c.Response().Writer, c.Request(), lf.Path); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "file not found")
+	}
+	return nil
+}
+
 // route /api/v1/nakama/stream
-// Proxies stream requests to the host. It inserts the Nakama password in the headers.
+// Proxies stream requests to the host, or to the room relay in rooms mode. It inserts the Nakama password in the headers.
 // It checks if the password is valid.
 // For debrid streams, it redirects directly to the debrid service to avoid host bandwidth usage.
 func (h *Handler) HandleNakamaProxyStream(c echo.Context) error {
@@ -415,22 +466,17 @@ func (h *Handler) HandleNakamaProxyStream(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "type is required")
 	}
 
-	hostServerUrl := h.App.Settings.GetNakama().RemoteServerURL
-	hostServerUrl = strings.TrimSuffix(hostServerUrl, "/")
-
 	if streamType == "debrid" {
 		// Get the debrid stream URL from the host
-		urlEndpoint := hostServerUrl + "/api/v1/nakama/host/debridstream/url"
+		urlEndpoint := "/api/v1/nakama/host/debridstream/url"
 
-		req, err := http.NewRequest(http.MethodGet, urlEndpoint, nil)
+		// Add Nakama password for authentication
+		req, err := h.App.NakamaManager.NewHostRequest(c.Request().Context(), http.MethodGet, urlEndpoint)
 		if err != nil {
 			h.App.Logger.Error().Err(err).Str("url", urlEndpoint).Msg("nakama: Failed to create debrid URL request")
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create request")
 		}
 
-		// Add Nakama password for authentication
-		req.Header.Set("X-Seanime-Nakama-Token", h.App.Settings.GetNakama().RemoteServerPassword)
-
 		client := &http.Client{
 			Timeout: 30 * time.Second,
 		}
@@ -515,9 +561,9 @@ func (h *Handler) HandleNakamaProxyStream(c echo.Context) error {
 		if filepath == "" {
 			return echo.NewHTTPError(http.StatusBadRequest, "path is required")
 		}
-		requestUrl = hostServerUrl + "/api/v1/nakama/host/anime/library/stream?path=" + filepath
+		requestUrl = "/api/v1/nakama/host/anime/library/stream?path=" + url.QueryEscape(filepath)
 	case "torrent":
-		requestUrl = hostServerUrl + "/api/v1/nakama/host/torrentstream/stream"
+		requestUrl = "/api/v1/nakama/host/torrentstream/stream"
 	default:
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid type")
 	}
@@ -534,15 +580,13 @@ func (h *Handler) HandleNakamaProxyStream(c echo.Context) error {
 	}
 
 	if c.Request().Method == http.MethodHead {
-		req, err := http.NewRequest(http.MethodHead, requestUrl, nil)
+		// Add Nakama password for authentication
+		req, err := h.App.NakamaManager.NewHostRequest(c.Request().Context(), http.MethodHead, requestUrl)
 		if err != nil {
 			h.App.Logger.Error().Err(err).Str("url", requestUrl).Msg("nakama: Failed to create HEAD request")
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create request")
 		}
 
-		// Add Nakama password for authentication
-		req.Header.Set("X-Seanime-Nakama-Token", h.App.Settings.GetNakama().RemoteServerPassword)
-
 		// Add User-Agent from original request
 		if userAgent := c.Request().Header.Get("User-Agent"); userAgent != "" {
 			req.Header.Set("User-Agent", userAgent)
@@ -572,7 +616,7 @@ func (h *Handler) HandleNakamaProxyStream(c echo.Context) error {
 
 	// Create request with timeout context
 	ctx := c.Request().Context()
-	req, err := http.NewRequestWithContext(ctx, c.Request().Method, requestUrl, c.Request().Body)
+	req, err := h.App.NakamaManager.NewHostRequest(ctx, c.Request().Method, requestUrl)
 	if err != nil {
 		h.App.Logger.Error().Err(err).Str("url", requestUrl).Msg("nakama: Failed to create request")
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create request")
@@ -877,3 +921,151 @@ func (h *Handler) HandleNakamaSendChatMessage(c echo.Context) error {
 
 	return h.RespondWithData(c, true)
 }
+
+// HandleNakamaAddToWatchPartyQueue
+//
+//	@summary adds an episode to the watch party queue.
+//	@desc Episodes added by the host are approved. Peers propose the episode to the host, which has to approve it.
+//	@desc The stream params of the stream type are required, they are used by the host to start the stream.
+//	@route /api/v1/nakama/watch-party/queue [POST]
+//	@returns bool
+func (h *Handler) HandleNakamaAddToWatchPartyQueue(c echo.Context) error {
+	var b nakama.WatchPartyQueueItem
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if !h.App.Settings.GetNakama().IsHost && !h.App.NakamaManager.IsConnectedToHost() {
+		return h.RespondWithError(c, errors.New("not connected to host"))
+	}
+
+	err := h.App.NakamaManager.GetWatchPartyManager().AddToQueue(&b)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleNakamaApproveWatchPartyQueueItem
+//
+//	@summary approves an episode proposed by a peer.
+//	@desc Only approved episodes are played. This is only available to the host.
+//	@route /api/v1/nakama/watch-party/queue/approve [POST]
+//	@returns bool
+func (h *Handler) HandleNakamaApproveWatchPartyQueueItem(c echo.Context) error {
+	type body struct {
+		ID string `json:"id"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	err := h.App.NakamaManager.GetWatchPartyManager().ApproveQueueItem(b.ID)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleNakamaRemoveWatchPartyQueueItem
+//
+//	@summary removes an episode from the watch party queue.
+//	@desc This is also used to reject proposals. This is only available to the host.
+//	@route /api/v1/nakama/watch-party/queue [DELETE]
+//	@returns bool
+func (h *Handler) HandleNakamaRemoveWatchPartyQueueItem(c echo.Context) error {
+	type body struct {
+		ID string `json:"id"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	err := h.App.NakamaManager.GetWatchPartyManager().RemoveQueueItem(b.ID)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleNakamaPlayNextWatchPartyQueueItem
+//
+//	@summary plays the next approved episode of the watch party queue.
+//	@desc The next episode is also played automatically once all participants finish the current one.
+//	@desc This is only available to the host.
+//	@route /api/v1/nakama/watch-party/queue/next [POST]
+//	@returns bool
+func (h *Handler) HandleNakamaPlayNextWatchPartyQueueItem(c echo.Context) error {
+	err := h.App.NakamaManager.GetWatchPartyManager().PlayNextQueueItem()
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleGetNakamaWatchPartyHistory
+//
+//	@summary returns the finished watch party sessions.
+//	@desc The sessions are recorded by the host, peers get the history of the host.
+//	@desc Only sessions in which episodes were played are recorded.
+//	@route /api/v1/nakama/watch-party/history [GET]
+//	@returns []nakama.WatchPartyHistoryEntry
+func (h *Handler) HandleGetNakamaWatchPartyHistory(c echo.Context) error {
+	history, err := h.App.NakamaManager.GetWatchPartyHistory(c.Request().Context())
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, history)
+}
+
+// HandleDeleteNakamaWatchPartyHistory
+//
+//	@summary deletes a finished watch party session from the history.
+//	@desc This is only available to the host.
+//	@route /api/v1/nakama/watch-party/history [DELETE]
+//	@returns bool
+func (h *Handler) HandleDeleteNakamaWatchPartyHistory(c echo.Context) error {
+	type body struct {
+		ID uint `json:"id"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	err := h.App.NakamaManager.DeleteWatchPartyHistory(b.ID)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleGetNakamaHostWatchPartyHistory
+//
+//	@summary returns the watch party history of the host.
+//	@desc This is used by Nakama peers to get the sessions they watched with the host.
+//	@route /api/v1/nakama/host/watch-party/history [GET]
+//	@returns []nakama.WatchPartyHistoryEntry
+func (h *Handler) HandleGetNakamaHostWatchPartyHistory(c echo.Context) error {
+	if !h.App.Settings.GetNakama().IsHost {
+		return h.RespondWithError(c, errors.New("not a host"))
+	}
+
+	history, err := h.App.NakamaManager.GetWatchPartyHistory(c.Request().Context())
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, history)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	nakama_librarysync "seanime/internal/nakama/librarysync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleGetNakamaLibrarySyncDownloads
+//
+//	@summary returns the files copied from the Nakama host.
+//	@desc The progress is only set for the file being downloaded.
+//	@route /api/v1/nakama/library-sync [GET]
+//	@returns []nakama_librarysync.Download
+func (h *Handler) HandleGetNakamaLibrarySyncDownloads(c echo.Context) error {
+	downloads, err := h.App.NakamaLibrarySync.GetDownloads()
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, downloads)
+}
+
+// HandleEnqueueNakamaLibrarySyncDownloads
+//
+//	@summary queues files of the Nakama host's anime library to be copied to the library.
+//	@desc If no paths are given, all the shared files of the media are copied.
+//	@desc The host's local file metadata is applied to the copied files, so they don't need to be matched by a scan.
+//	@desc If no directory is given, the main library path is used.
+//	@desc Files that are already queued or already in the library are skipped.
+//	@route /api/v1/nakama/library-sync [POST]
+//	@returns []models.NakamaLibraryDownload
+func (h *Handler) HandleEnqueueNakamaLibrarySyncDownloads(c echo.Context) error {
+	var b nakama_librarysync.EnqueueOptions
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if !h.App.NakamaManager.IsConnectedToHost() {
+		return h.RespondWithError(c, errors.New("not connected to host"))
+	}
+
+	downloads, err := h.App.NakamaLibrarySync.Enqueue(c.Request().Context(), &b)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, downloads)
+}
+
+// HandleCancelNakamaLibrarySyncDownload
+//
+//	@summary cancels a file copy from the Nakama host or removes it from the list.
+//	@desc If 'remove' is true, the download is removed from the list. Copied files are kept.
+//	@route /api/v1/nakama/library-sync [DELETE]
+//	@returns bool
+func (h *Handler) HandleCancelNakamaLibrarySyncDownload(c echo.Context) error {
+	type body struct {
+		ID     uint `json:"id"`
+		Remove bool `json:"remove"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	var err error
+	if b.Remove {
+		err = h.App.NakamaLibrarySync.Remove(b.ID)
+	} else {
+		err = h.App.NakamaLibrarySync.Cancel(b.ID)
+	}
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleRetryNakamaLibrarySyncDownload
+//
+//	@summary queues a failed or cancelled file copy again.
+//	@desc The transfer resumes from the bytes downloaded by the previous attempt.
+//	@route /api/v1/nakama/library-sync/retry [POST]
+//	@returns bool
+func (h *Handler) HandleRetryNakamaLibrarySyncDownload(c echo.Context) error {
+	type body struct {
+		ID uint `json:"id"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.NakamaLibrarySync.Retry(b.ID); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
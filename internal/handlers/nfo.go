@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"seanime/internal/library/nfo"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleGetNfoExportSettings
+//
+//	@summary returns the settings of the NFO exporter.
+//	@route /api/v1/library/nfo/settings [GET]
+//	@returns nfo.Settings
+func (h *Handler) HandleGetNfoExportSettings(c echo.Context) error {
+	return h.RespondWithData(c, h.App.NfoExporter.GetSettings())
+}
+
+// HandleSaveNfoExportSettings
+//
+//	@summary saves the settings of the NFO exporter.
+//	@route /api/v1/library/nfo/settings [POST]
+//	@returns nfo.Settings
+func (h *Handler) HandleSaveNfoExportSettings(c echo.Context) error {
+	var b nfo.Settings
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.NfoExporter.SaveSettings(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, h.App.NfoExporter.GetSettings())
+}
+
+// HandleExportNfo
+//
+//	@summary writes the NFO files and artwork of the library.
+//	@desc tvshow.nfo, poster.jpg and fanart.jpg are written in the directory of each show, and an NFO file is written beside each episode.
+//	@desc Only files whose content changed are written. Existing files that were not created by the exporter are left untouched.
+//	@route /api/v1/library/nfo/export [POST]
+//	@returns nfo.ExportResult
+func (h *Handler) HandleExportNfo(c echo.Context) error {
+	res, err := h.App.NfoExporter.ExportLibrary(c.Request().Context())
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, res)
+}
+
+// HandleRemoveExportedNfo
+//
+//	@summary removes all the files written by the NFO exporter.
+//	@route /api/v1/library/nfo/export [DELETE]
+//	@returns int
+func (h *Handler) HandleRemoveExportedNfo(c echo.Context) error {
+	count, err := h.App.NfoExporter.RemoveExportedFiles()
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, count)
+}
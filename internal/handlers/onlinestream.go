@@ -47,7 +47,7 @@ func (h *Handler) HandleGetOnlineStreamEpisodeList(c echo.Context) error {
 
 	// Get episode list
 	// This is cached using file cache
-	episodes, err := h.App.OnlinestreamRepository.GetMediaEpisodes(b.Provider, media, b.Dubbed)
+	episodes, provider, err := h.App.OnlinestreamRepository.GetMediaEpisodes(b.Provider, media, b.Dubbed)
 	//if err != nil {
 	//	return h.RespondWithError(c, err)
 	//}
@@ -55,6 +55,7 @@ func (h *Handler) HandleGetOnlineStreamEpisodeList(c echo.Context) error {
 	ret := onlinestream.EpisodeListResponse{
 		Episodes: episodes,
 		Media:    media,
+		Provider: provider,
 	}
 
 	h.App.FillerManager.HydrateOnlinestreamFillerData(b.MediaId, ret.Episodes)
@@ -226,3 +227,22 @@ func (h *Handler) HandleRemoveOnlinestreamMapping(c echo.Context) error {
 
 	return h.RespondWithData(c, true)
 }
+
+// HandleGetOnlinestreamProvidersHealth
+//
+//	@summary returns the health of the online-stream providers.
+//	@desc Providers are ranked from the most to the least reliable, this is the order in which they're used when a provider fails.
+//	@route /api/v1/onlinestream/providers/health [GET]
+//	@returns []onlinestream.ProviderHealth
+func (h *Handler) HandleGetOnlinestreamProvidersHealth(c echo.Context) error {
+	return h.RespondWithData(c, h.App.OnlinestreamRepository.GetProvidersHealth())
+}
+
+// HandleCheckOnlinestreamProvidersHealth
+//
+//	@summary probes the online-stream providers and returns their health.
+//	@route /api/v1/onlinestream/providers/health [POST]
+//	@returns []onlinestream.ProviderHealth
+func (h *Handler) HandleCheckOnlinestreamProvidersHealth(c echo.Context) error {
+	return h.RespondWithData(c, h.App.OnlinestreamRepository.CheckProvidersHealth())
+}
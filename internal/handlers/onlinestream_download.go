@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	onlinestream_downloader "seanime/internal/onlinestream/downloader"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleGetOnlinestreamDownloads
+//
+//	@summary returns the online-stream downloads.
+//	@desc The progress is only set for the episode being downloaded.
+//	@route /api/v1/onlinestream/downloads [GET]
+//	@returns []onlinestream_downloader.Download
+func (h *Handler) HandleGetOnlinestreamDownloads(c echo.Context) error {
+	downloads, err := h.App.OnlinestreamDownloader.GetDownloads()
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, downloads)
+}
+
+// HandleEnqueueOnlinestreamDownloads
+//
+//	@summary queues episodes to be downloaded from an online-stream provider.
+//	@desc Episodes are downloaded one at a time and saved in the library directory so that they're picked up by the scanner.
+//	@desc If no directory is given, the main library path is used.
+//	@desc Episodes that are already queued are skipped.
+//	@route /api/v1/onlinestream/downloads [POST]
+//	@returns []models.OnlinestreamDownload
+func (h *Handler) HandleEnqueueOnlinestreamDownloads(c echo.Context) error {
+	var b onlinestream_downloader.EnqueueOptions
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if h.App.Settings == nil || !h.App.Settings.GetLibrary().EnableOnlinestream {
+		return h.RespondWithError(c, errors.New("enable online streaming in the settings"))
+	}
+
+	if len(b.EpisodeNumbers) == 0 {
+		return h.RespondWithError(c, errors.New("no episodes selected"))
+	}
+
+	downloads, err := h.App.OnlinestreamDownloader.Enqueue(&b)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, downloads)
+}
+
+// HandleCancelOnlinestreamDownload
+//
+//	@summary cancels an online-stream download or removes it from the list.
+//	@desc If 'remove' is true, the download is removed from the list. Downloaded episodes are kept.
+//	@route /api/v1/onlinestream/downloads [DELETE]
+//	@returns bool
+func (h *Handler) HandleCancelOnlinestreamDownload(c echo.Context) error {
+	type body struct {
+		ID     uint `json:"id"`
+		Remove bool `json:"remove"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	var err error
+	if b.Remove {
+		err = h.App.OnlinestreamDownloader.Remove(b.ID)
+	} else {
+		err = h.App.OnlinestreamDownloader.Cancel(b.ID)
+	}
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// HandleRetryOnlinestreamDownload
+//
+//	@summary queues a failed or cancelled online-stream download again.
+//	@desc Segments downloaded by the previous attempt are reused.
+//	@route /api/v1/onlinestream/downloads/retry [POST]
+//	@returns bool
+func (h *Handler) HandleRetryOnlinestreamDownload(c echo.Context) error {
+	type body struct {
+		ID uint `json:"id"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.OnlinestreamDownloader.Retry(b.ID); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, true)
+}
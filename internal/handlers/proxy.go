@@ -28,6 +28,7 @@ func (h *Handler) VideoProxy(c echo.Context) (err error) {
 	url := c.QueryParam("url")
 	headers := c.QueryParam("headers")
 	authToken := c.QueryParam("token")
+	basePath := h.App.Config.Server.BasePath // Rewritten URIs are resolved by the client
 
 	r := videoProxyClient2.R()
 
@@ -113,19 +114,19 @@ func (h *Handler) VideoProxy(c echo.Context) (err error) {
 		for _, segment := range mediaPl.Segments {
 			if segment != nil {
 				// Rewrite Segment URI
-				if rewriteURI(&segment.URI, baseURL, headerMap, authToken) {
+				if rewriteURI(&segment.URI, baseURL, headerMap, authToken, basePath) {
 					needsRewrite = true
 				}
 
 				// Rewrite encryption key URIs
 				for i := range segment.Keys {
-					if rewriteURI(&segment.Keys[i].URI, baseURL, headerMap, authToken) {
+					if rewriteURI(&segment.Keys[i].URI, baseURL, headerMap, authToken, basePath) {
 						needsRewrite = true
 					}
 				}
 
 				if segment.Map != nil {
-					if rewriteURI(&segment.Map.URI, baseURL, headerMap, authToken) {
+					if rewriteURI(&segment.Map.URI, baseURL, headerMap, authToken, basePath) {
 						needsRewrite = true
 					}
 				}
@@ -135,27 +136,27 @@ func (h *Handler) VideoProxy(c echo.Context) (err error) {
 		for _, segment := range mediaPl.PartialSegments {
 			if segment != nil {
 				// Rewrite Segment URI
-				if rewriteURI(&segment.URI, baseURL, headerMap, authToken) {
+				if rewriteURI(&segment.URI, baseURL, headerMap, authToken, basePath) {
 					needsRewrite = true
 				}
 			}
 		}
 
 		if mediaPl.PreloadHints != nil {
-			if rewriteURI(&mediaPl.PreloadHints.URI, baseURL, headerMap, authToken) {
+			if rewriteURI(&mediaPl.PreloadHints.URI, baseURL, headerMap, authToken, basePath) {
 				needsRewrite = true
 			}
 		}
 
 		if mediaPl.Map != nil {
-			if rewriteURI(&mediaPl.Map.URI, baseURL, headerMap, authToken) {
+			if rewriteURI(&mediaPl.Map.URI, baseURL, headerMap, authToken, basePath) {
 				needsRewrite = true
 			}
 		}
 
 		// Rewrite playlist-level encryption key URIs
 		for i := range mediaPl.Keys {
-			if rewriteURI(&mediaPl.Keys[i].URI, baseURL, headerMap, authToken) {
+			if rewriteURI(&mediaPl.Keys[i].URI, baseURL, headerMap, authToken, basePath) {
 				needsRewrite = true
 			}
 		}
@@ -170,13 +171,13 @@ func (h *Handler) VideoProxy(c echo.Context) (err error) {
 
 		for _, variant := range masterPl.Variants {
 			if variant != nil {
-				if rewriteURI(&variant.URI, baseURL, headerMap, authToken) {
+				if rewriteURI(&variant.URI, baseURL, headerMap, authToken, basePath) {
 					needsRewrite = true
 				}
 
 				// Handle alternative media groups (audio, subtitles, etc.)
 				for _, alternative := range variant.Alternatives {
-					if alternative != nil && rewriteURI(&alternative.URI, baseURL, headerMap, authToken) {
+					if alternative != nil && rewriteURI(&alternative.URI, baseURL, headerMap, authToken, basePath) {
 						needsRewrite = true
 					}
 				}
@@ -185,7 +186,7 @@ func (h *Handler) VideoProxy(c echo.Context) (err error) {
 
 		// Rewrite session key URIs
 		for i := range masterPl.SessionKeys {
-			if rewriteURI(&masterPl.SessionKeys[i].URI, baseURL, headerMap, authToken) {
+			if rewriteURI(&masterPl.SessionKeys[i].URI, baseURL, headerMap, authToken, basePath) {
 				needsRewrite = true
 			}
 		}
@@ -213,7 +214,7 @@ func (h *Handler) VideoProxy(c echo.Context) (err error) {
 }
 
 // rewriteURI rewrites a URI pointer if needed, returns true if modified
-func rewriteURI(uri *string, baseURL *url2.URL, headerMap map[string]string, authToken string) bool {
+func rewriteURI(uri *string, baseURL *url2.URL, headerMap map[string]string, authToken string, basePath string) bool {
 	if *uri == "" || isAlreadyProxied(*uri) {
 		return false
 	}
@@ -223,7 +224,7 @@ func rewriteURI(uri *string, baseURL *url2.URL, headerMap map[string]string, aut
 		*uri = resolveURL(baseURL, *uri)
 	}
 
-	*uri = toProxyURL(*uri, headerMap, authToken)
+	*uri = toProxyURL(*uri, headerMap, authToken, basePath)
 	return true
 }
 
@@ -238,8 +239,8 @@ func resolveURL(base *url2.URL, relativeURI string) string {
 	return base.ResolveReference(relativeURL).String()
 }
 
-func toProxyURL(targetMediaURL string, headerMap map[string]string, authToken string) string {
-	proxyURL := "/api/v1/proxy?url=" + url2.QueryEscape(targetMediaURL)
+func toProxyURL(targetMediaURL string, headerMap map[string]string, authToken string, basePath string) string {
+	proxyURL := basePath + "/api/v1/proxy?url=" + url2.QueryEscape(targetMediaURL)
 	if len(headerMap) > 0 {
 		headersStrB, err := json.Marshal(headerMap)
 		// Ignore marshalling errors here? Or log them? For simplicity, ignoring now.
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"seanime/internal/library/retention"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleGetRetentionSettings
+//
+//	@summary returns the retention rules and settings.
+//	@route /api/v1/library/retention/settings [GET]
+//	@returns retention.Settings
+func (h *Handler) HandleGetRetentionSettings(c echo.Context) error {
+	return h.RespondWithData(c, h.App.RetentionManager.GetSettings())
+}
+
+// HandleSaveRetentionSettings
+//
+//	@summary saves the retention rules and settings.
+//	@route /api/v1/library/retention/settings [POST]
+//	@returns retention.Settings
+func (h *Handler) HandleSaveRetentionSettings(c echo.Context) error {
+	var b retention.Settings
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	if err := h.App.RetentionManager.SaveSettings(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, h.App.RetentionManager.GetSettings())
+}
+
+// HandleRunRetentionRules
+//
+//	@summary applies the enabled retention rules to the local files.
+//	@desc In a dry run, nothing is deleted or moved and the report lists what would be done.
+//	@route /api/v1/library/retention/run [POST]
+//	@returns retention.Report
+func (h *Handler) HandleRunRetentionRules(c echo.Context) error {
+	type body struct {
+		DryRun bool `json:"dryRun"`
+	}
+
+	var b body
+	if err := c.Bind(&b); err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	report, err := h.App.RetentionManager.Run(b.DryRun)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, report)
+}
+
+// HandleGetRetentionReport
+//
+//	@summary returns the report of the last run of the retention rules.
+//	@route /api/v1/library/retention/report [GET]
+//	@returns retention.Report
+func (h *Handler) HandleGetRetentionReport(c echo.Context) error {
+	return h.RespondWithData(c, h.App.RetentionManager.GetLastReport())
+}
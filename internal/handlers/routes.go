@@ -140,12 +140,25 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1.GET("/memory/cpu", h.HandleGetCPUProfile)
 	v1.POST("/memory/gc", h.HandleForceGC)
 
+	v1.GET("/metrics", h.HandleGetMetrics)
+
 	v1.POST("/announcements", h.HandleGetAnnouncements)
 
 	// Auth
 	v1.POST("/auth/login", h.HandleLogin)
 	v1.POST("/auth/logout", h.HandleLogout)
 
+	// Server auth
+	v1.GET("/auth/oidc/login", h.HandleOIDCLogin)
+	v1.GET("/auth/oidc/callback", h.HandleOIDCCallback)
+	v1.POST("/auth/proxy", h.HandleTrustedProxyLogin)
+	v1.DELETE("/auth/session", h.HandleServerLogout)
+
+	// API tokens
+	v1.GET("/api-tokens", h.HandleGetApiTokens)
+	v1.POST("/api-tokens", h.HandleCreateApiToken)
+	v1.DELETE("/api-tokens", h.HandleRevokeApiToken)
+
 	// Settings
 	v1.GET("/settings", h.HandleGetSettings)
 	v1.PATCH("/settings", h.HandleSaveSettings)
@@ -156,6 +169,7 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	// Auto Downloader
 	v1.POST("/auto-downloader/run", h.HandleRunAutoDownloader)
 	v1.POST("/auto-downloader/run/simulation", h.HandleRunAutoDownloaderSimulation)
+	v1.GET("/auto-downloader/polling-plan", h.HandleGetAutoDownloaderPollingPlan)
 	v1.GET("/auto-downloader/rule/:id", h.HandleGetAutoDownloaderRule)
 	v1.GET("/auto-downloader/rule/anime/:id", h.HandleGetAutoDownloaderRulesByAnime)
 	v1.GET("/auto-downloader/rules", h.HandleGetAutoDownloaderRules)
@@ -165,6 +179,8 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 
 	v1.GET("/auto-downloader/items", h.HandleGetAutoDownloaderItems)
 	v1.DELETE("/auto-downloader/item", h.HandleDeleteAutoDownloaderItem)
+	v1.GET("/auto-downloader/upgrades", h.HandleGetAutoDownloaderUpgrades)
+	v1.DELETE("/auto-downloader/upgrades", h.HandleClearAutoDownloaderUpgrades)
 
 	v1.GET("/auto-downloader/profiles", h.HandleGetAutoDownloaderProfiles)
 	v1.GET("/auto-downloader/profile/:id", h.HandleGetAutoDownloaderProfile)
@@ -172,6 +188,13 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1.PATCH("/auto-downloader/profile", h.HandleUpdateAutoDownloaderProfile)
 	v1.DELETE("/auto-downloader/profile/:id", h.HandleDeleteAutoDownloaderProfile)
 
+	v1.GET("/auto-downloader/rule-templates", h.HandleGetAutoDownloaderRuleTemplates)
+	v1.POST("/auto-downloader/rule-template", h.HandleCreateAutoDownloaderRuleTemplate)
+	v1.PATCH("/auto-downloader/rule-template", h.HandleUpdateAutoDownloaderRuleTemplate)
+	v1.DELETE("/auto-downloader/rule-template/:id", h.HandleDeleteAutoDownloaderRuleTemplate)
+	v1.GET("/auto-downloader/rule-templates/preview", h.HandlePreviewAutoDownloaderRuleTemplates)
+	v1.POST("/auto-downloader/rule-templates/apply", h.HandleApplyAutoDownloaderRuleTemplates)
+
 	// Other
 	v1.POST("/test-dump", h.HandleTestDump)
 
@@ -242,9 +265,29 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 
 	v1Library.GET("/collection", h.HandleGetLibraryCollection)
 	v1Library.GET("/schedule", h.HandleGetAnimeCollectionSchedule)
+	v1Library.GET("/schedule/calendar-url", h.HandleGetScheduleCalendarURL)
+	v1Library.GET("/schedule/calendar.ics", h.HandleGetScheduleCalendar)
 
 	v1Library.GET("/scan-summaries", h.HandleGetScanSummaries)
 
+	v1Library.GET("/integrity/reports", h.HandleGetIntegrityReports)
+	v1Library.GET("/integrity/status", h.HandleGetIntegrityStatus)
+	v1Library.POST("/integrity/check", h.HandleRunIntegrityCheck)
+	v1Library.DELETE("/integrity/check", h.HandleCancelIntegrityCheck)
+	v1Library.POST("/integrity/recheck-torrent", h.HandleRecheckCorruptTorrent)
+	v1Library.GET("/integrity/settings", h.HandleGetIntegritySettings)
+	v1Library.POST("/integrity/settings", h.HandleSaveIntegritySettings)
+
+	v1Library.GET("/retention/settings", h.HandleGetRetentionSettings)
+	v1Library.POST("/retention/settings", h.HandleSaveRetentionSettings)
+	v1Library.POST("/retention/run", h.HandleRunRetentionRules)
+	v1Library.GET("/retention/report", h.HandleGetRetentionReport)
+
+	v1Library.GET("/nfo/settings", h.HandleGetNfoExportSettings)
+	v1Library.POST("/nfo/settings", h.HandleSaveNfoExportSettings)
+	v1Library.POST("/nfo/export", h.HandleExportNfo)
+	v1Library.DELETE("/nfo/export", h.HandleRemoveExportedNfo)
+
 	v1Library.GET("/missing-episodes", h.HandleGetMissingEpisodes)
 	v1Library.GET("/upcoming-episodes", h.HandleGetUpcomingEpisodes)
 
@@ -355,6 +398,12 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1.POST("/onlinestream/manual-mapping", h.HandleOnlinestreamManualMapping)
 	v1.POST("/onlinestream/get-mapping", h.HandleGetOnlinestreamMapping)
 	v1.POST("/onlinestream/remove-mapping", h.HandleRemoveOnlinestreamMapping)
+	v1.GET("/onlinestream/providers/health", h.HandleGetOnlinestreamProvidersHealth)
+	v1.POST("/onlinestream/providers/health", h.HandleCheckOnlinestreamProvidersHealth)
+	v1.GET("/onlinestream/downloads", h.HandleGetOnlinestreamDownloads)
+	v1.POST("/onlinestream/downloads", h.HandleEnqueueOnlinestreamDownloads)
+	v1.DELETE("/onlinestream/downloads", h.HandleCancelOnlinestreamDownload)
+	v1.POST("/onlinestream/downloads/retry", h.HandleRetryOnlinestreamDownload)
 
 	//
 	// Metadata Provider
@@ -376,6 +425,23 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1FileCache.GET("/mediastream/videofiles/total-size", h.HandleGetFileCacheMediastreamVideoFilesTotalSize)
 	v1FileCache.DELETE("/mediastream/videofiles", h.HandleClearFileCacheMediastreamVideoFiles)
 
+	//
+	// Backup
+	//
+
+	v1Backup := v1.Group("/backup")
+	v1Backup.GET("/list", h.HandleGetBackups)
+	v1Backup.GET("/buckets", h.HandleGetBackupBuckets)
+	v1Backup.POST("/create", h.HandleCreateBackup)
+	v1Backup.DELETE("", h.HandleDeleteBackup)
+	v1Backup.GET("/download/:name", h.HandleDownloadBackup)
+	v1Backup.GET("/restore", h.HandleGetPendingRestore)
+	v1Backup.POST("/restore", h.HandleRestoreBackup)
+	v1Backup.DELETE("/restore", h.HandleCancelPendingRestore)
+	v1Backup.POST("/restore/upload", h.HandleUploadBackup)
+	v1Backup.GET("/settings", h.HandleGetBackupSettings)
+	v1Backup.POST("/settings", h.HandleSaveBackupSettings)
+
 	//
 	// Discord
 	//
@@ -439,6 +505,8 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1Extensions.POST("/external/install-repository", h.HandleInstallExternalExtensionRepository)
 	v1Extensions.POST("/external/uninstall", h.HandleUninstallExternalExtension)
 	v1Extensions.POST("/external/edit-payload", h.HandleUpdateExtensionCode)
+	v1Extensions.POST("/external/rollback", h.HandleRollbackExtension)
+	v1Extensions.POST("/external/update-all", h.HandleUpdateAllExtensions)
 	v1Extensions.POST("/external/reload", h.HandleReloadExternalExtensions)
 	v1Extensions.POST("/external/reload", h.HandleReloadExternalExtension)
 	v1Extensions.POST("/all", h.HandleGetAllExtensions)
@@ -455,6 +523,11 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1Extensions.GET("/plugin-settings", h.HandleGetPluginSettings)
 	v1Extensions.POST("/plugin-settings/pinned-trays", h.HandleSetPluginSettingsPinnedTrays)
 	v1Extensions.POST("/plugin-permissions/grant", h.HandleGrantPluginPermissions)
+	v1Extensions.GET("/trust", h.HandleGetExtensionTrustData)
+	v1Extensions.POST("/trust/marketplace-keys", h.HandleSetMarketplaceTrustedKeys)
+	v1Extensions.POST("/trust/approve", h.HandleApproveExtensionPublisherKey)
+	v1Extensions.GET("/update-settings", h.HandleGetExtensionUpdateSettings)
+	v1Extensions.POST("/update-settings/policy", h.HandleSetExtensionUpdatePolicy)
 
 	//
 	// Continuity
@@ -479,6 +552,13 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1Local.GET("/updated", h.HandleLocalGetHasLocalChanges)
 	v1Local.GET("/storage/size", h.HandleLocalGetLocalStorageSize)
 	v1Local.POST("/sync-simulated-to-anilist", h.HandleLocalSyncSimulatedDataToAnilist)
+	v1Local.POST("/list-import", h.HandleLocalImportList)
+	v1Local.GET("/list-export/mal", h.HandleLocalExportListToMal)
+	v1Local.GET("/episodes", h.HandleLocalGetOfflineEpisodes)
+	v1Local.DELETE("/episodes", h.HandleLocalRemoveOfflineEpisode)
+	v1Local.POST("/episodes/download", h.HandleLocalDownloadStreamedEpisode)
+	v1Local.GET("/episodes/downloads", h.HandleLocalGetEpisodeDownloads)
+	v1Local.DELETE("/episodes/downloads", h.HandleLocalCancelEpisodeDownload)
 
 
 	//
@@ -526,6 +606,8 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1Nakama.HEAD("/host/torrentstream/stream", h.HandleNakamaHostTorrentstreamServeStream)
 	v1Nakama.GET("/host/anime/library/stream", h.HandleNakamaHostAnimeLibraryServeStream)
 	v1Nakama.HEAD("/host/anime/library/stream", h.HandleNakamaHostAnimeLibraryServeStream)
+	v1Nakama.GET("/host/anime/library/download", h.HandleNakamaHostAnimeLibraryDownload)
+	v1Nakama.HEAD("/host/anime/library/download", h.HandleNakamaHostAnimeLibraryDownload)
 	v1Nakama.GET("/host/debridstream/stream", h.HandleNakamaHostDebridstreamServeStream)
 	v1Nakama.HEAD("/host/debridstream/stream", h.HandleNakamaHostDebridstreamServeStream)
 	v1Nakama.GET("/host/debridstream/url", h.HandleNakamaHostGetDebridstreamURL)
@@ -535,6 +617,17 @@ func InitRoutes(app *core.App, e *echo.Echo) {
 	v1Nakama.POST("/watch-party/join", h.HandleNakamaJoinWatchParty)
 	v1Nakama.POST("/watch-party/leave", h.HandleNakamaLeaveWatchParty)
 	v1Nakama.POST("/watch-party/chat", h.HandleNakamaSendChatMessage)
+	v1Nakama.POST("/watch-party/queue", h.HandleNakamaAddToWatchPartyQueue)
+	v1Nakama.DELETE("/watch-party/queue", h.HandleNakamaRemoveWatchPartyQueueItem)
+	v1Nakama.POST("/watch-party/queue/approve", h.HandleNakamaApproveWatchPartyQueueItem)
+	v1Nakama.POST("/watch-party/queue/next", h.HandleNakamaPlayNextWatchPartyQueueItem)
+	v1Nakama.GET("/watch-party/history", h.HandleGetNakamaWatchPartyHistory)
+	v1Nakama.DELETE("/watch-party/history", h.HandleDeleteNakamaWatchPartyHistory)
+	v1Nakama.GET("/host/watch-party/history", h.HandleGetNakamaHostWatchPartyHistory)
+	v1Nakama.GET("/library-sync", h.HandleGetNakamaLibrarySyncDownloads)
+	v1Nakama.POST("/library-sync", h.HandleEnqueueNakamaLibrarySyncDownloads)
+	v1Nakama.DELETE("/library-sync", h.HandleCancelNakamaLibrarySyncDownload)
+	v1Nakama.POST("/library-sync/retry", h.HandleRetryNakamaLibrarySyncDownload)
 
 	//
 	// Custom Source
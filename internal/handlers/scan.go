@@ -119,6 +119,10 @@ func (h *Handler) HandleScanLocalFiles(c echo.Context) error {
 
 	go h.App.AutoDownloader.CleanUpDownloadedItems()
 
+	go h.App.IntegrityManager.OnScanCompleted(lfs)
+
+	go h.App.NfoExporter.OnScanCompleted(lfs)
+
 	go h.App.RefreshAnimeCollection()
 
 	return h.RespondWithData(c, lfs)
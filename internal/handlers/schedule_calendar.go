@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"seanime/internal/api/anilist"
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/library/anime"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+)
+
+const scheduleCalendarPath = "/api/v1/library/schedule/calendar.ics"
+
+// HandleGetScheduleCalendarURL
+//
+//	@summary returns a signed URL of the airing schedule calendar feed.
+//	@desc The URL can be added to calendar apps, it contains a token that is valid for a year.
+//	@desc The URL is absolute and uses the address at which the client reached the server, including the reverse proxy's.
+//	@desc The feed can be filtered by list status with a comma-separated 'status' query parameter (e.g. CURRENT,PLANNING).
+//	@route /api/v1/library/schedule/calendar-url [GET]
+//	@returns string
+func (h *Handler) HandleGetScheduleCalendarURL(c echo.Context) error {
+	statuses, err := parseScheduleCalendarListStatuses(c.QueryParam("status"))
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	token, err := h.App.GetCalendarFeedHMACAuth().GenerateToken(scheduleCalendarPath)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	query := url.Values{}
+	query.Set("token", token)
+	if len(statuses) > 0 {
+		query.Set("status", strings.Join(lo.Map(statuses, func(s anilist.MediaListStatus, _ int) string { return string(s) }), ","))
+	}
+
+	return h.RespondWithData(c, fmt.Sprintf("%s%s?%s", h.App.Config.GetExternalURL(c.Request()), scheduleCalendarPath, query.Encode()))
+}
+
+// HandleGetScheduleCalendar
+//
+//	@summary returns the airing schedule as an iCalendar feed.
+//	@desc The request must contain the token returned by HandleGetScheduleCalendarURL.
+//	@desc Each event is an upcoming episode of the anime collection and specifies whether it is already in the library.
+//	@route /api/v1/library/schedule/calendar.ics [GET]
+//	@returns string
+func (h *Handler) HandleGetScheduleCalendar(c echo.Context) error {
+	if _, err := h.App.GetCalendarFeedHMACAuth().ValidateQueryParam(c.QueryParam("token"), scheduleCalendarPath); err != nil {
+		return c.String(http.StatusUnauthorized, "UNAUTHENTICATED")
+	}
+
+	statuses, err := parseScheduleCalendarListStatuses(c.QueryParam("status"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	items, err := h.getAnimeScheduleItems(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	animeCollection, err := h.App.GetAnimeCollection(false)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	lfs, _, err := db_bridge.GetLocalFiles(h.App.Database)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	calendar := anime.NewScheduleCalendar(items, &anime.ScheduleCalendarOptions{
+		AnimeCollection: animeCollection,
+		LocalFiles:      lfs,
+		ListStatuses:    statuses,
+	})
+
+	c.Response().Header().Set("Content-Disposition", `inline; filename="seanime.ics"`)
+	return c.Blob(http.StatusOK, "text/calendar; charset=utf-8", []byte(calendar))
+}
+
+// parseScheduleCalendarListStatuses parses a comma-separated list of list statuses.
+func parseScheduleCalendarListStatuses(param string) ([]anilist.MediaListStatus, error) {
+	ret := make([]anilist.MediaListStatus, 0)
+	for _, s := range strings.Split(param, ",") {
+		s = strings.ToUpper(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+		status := anilist.MediaListStatus(s)
+		if !status.IsValid() {
+			return nil, errors.New("invalid list status: " + s)
+		}
+		if !slices.Contains(ret, status) {
+			ret = append(ret, status)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"seanime/internal/serverauth"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	oidcCallbackPath = "/api/v1/auth/oidc/callback"
+	// oidcStateCookieName is the cookie that binds the OIDC sign-in to the browser that started it
+	oidcStateCookieName = "Seanime-OIDC-State"
+)
+
+type ServerSessionResponse struct {
+	Token   string              `json:"token"`
+	Session *serverauth.Session `json:"session"`
+}
+
+// HandleOIDCLogin
+//
+//	@summary redirects the user to the OpenID Connect provider.
+//	@desc The provider redirects the user back to /api/v1/auth/oidc/callback after signing in.
+//	@route /api/v1/auth/oidc/login [GET]
+//	@returns string
+func (h *Handler) HandleOIDCLogin(c echo.Context) error {
+	if !h.App.ServerAuthManager.OIDCEnabled() {
+		return h.RespondWithError(c, errors.New("OpenID Connect is disabled"))
+	}
+
+	loginURL, state, err := h.App.ServerAuthManager.OIDCLoginURL(c.Request().Context(), h.getOIDCRedirectURL(c))
+	if err != nil {
+		h.App.Logger.Error().Err(err).Msg("server auth: Failed to start OIDC sign-in")
+		return h.redirectToServerAuth(c, "error", err.Error())
+	}
+
+	h.setOIDCStateCookie(c, state, int(serverauth.LoginStateTTL.Seconds()))
+
+	return c.Redirect(http.StatusFound, loginURL)
+}
+
+// HandleOIDCCallback
+//
+//	@summary creates a server session after signing in with the OpenID Connect provider.
+//	@desc The ID token is validated and the user is checked against the allowed users.
+//	@desc The user is redirected to the auth page with the session token in the URL fragment, the client stores it in place of the password hash.
+//	@route /api/v1/auth/oidc/callback [GET]
+//	@returns string
+func (h *Handler) HandleOIDCCallback(c echo.Context) error {
+	if !h.App.ServerAuthManager.OIDCEnabled() {
+		return h.RespondWithError(c, errors.New("OpenID Connect is disabled"))
+	}
+
+	if errCode := c.QueryParam("error"); errCode != "" {
+		msg := errCode
+		if desc := c.QueryParam("error_description"); desc != "" {
+			msg += ": " + desc
+		}
+		h.App.Logger.Warn().Str("error", msg).Msg("server auth: OIDC provider returned an error")
+		return h.redirectToServerAuth(c, "error", msg)
+	}
+
+	var browserState string
+	if cookie, err := c.Cookie(oidcStateCookieName); err == nil {
+		browserState = cookie.Value
+	}
+	h.setOIDCStateCookie(c, "", -1)
+
+	identity, err := h.App.ServerAuthManager.OIDCCallback(c.Request().Context(), c.QueryParam("state"), browserState, c.QueryParam("code"))
+	if err != nil {
+		h.App.Logger.Error().Err(err).Msg("server auth: OIDC sign-in failed")
+		return h.redirectToServerAuth(c, "error", err.Error())
+	}
+
+	token, _, err := h.App.ServerAuthManager.CreateSession(identity, serverauth.MethodOIDC)
+	if err != nil {
+		return h.redirectToServerAuth(c, "error", err.Error())
+	}
+
+	return h.redirectToServerAuth(c, "session", token)
+}
+
+// HandleTrustedProxyLogin
+//
+//	@summary creates a server session for the user authenticated by the trusted reverse proxy.
+//	@desc The username is read from the configured header, e.g. Remote-User, only if the request comes from an allowed address.
+//	@desc The client stores the returned token in place of the password hash.
+//	@route /api/v1/auth/proxy [POST]
+//	@returns handlers.ServerSessionResponse
+func (h *Handler) HandleTrustedProxyLogin(c echo.Context) error {
+	if !h.App.ServerAuthManager.TrustedProxyEnabled() {
+		return h.RespondWithError(c, errors.New("trusted proxy authentication is disabled"))
+	}
+
+	identity, err := h.App.ServerAuthManager.AuthenticateProxyRequest(c.Request())
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+	if identity == nil {
+		return h.RespondWithError(c, errors.New("UNAUTHENTICATED"))
+	}
+
+	token, session, err := h.App.ServerAuthManager.CreateSession(identity, serverauth.MethodTrustedProxy)
+	if err != nil {
+		return h.RespondWithError(c, err)
+	}
+
+	return h.RespondWithData(c, &ServerSessionResponse{
+		Token:   token,
+		Session: session,
+	})
+}
+
+// HandleServerLogout
+//
+//	@summary revokes the server session of the client.
+//	@desc This does nothing for clients authenticated with the server password.
+//	@route /api/v1/auth/session [DELETE]
+//	@returns bool
+func (h *Handler) HandleServerLogout(c echo.Context) error {
+	token := c.Request().Header.Get("X-Seanime-Token")
+	if serverauth.IsSessionToken(token) {
+		h.App.ServerAuthManager.RevokeSession(token)
+	}
+
+	return h.RespondWithData(c, true)
+}
+
+// getOIDCRedirectURL returns the configured redirect URL or the callback URL at which the client reached the server.
+func (h *Handler) getOIDCRedirectURL(c echo.Context) string {
+	if h.App.Config.Server.Auth.Oidc.RedirectURL != "" {
+		return h.App.Config.Server.Auth.Oidc.RedirectURL
+	}
+	return h.App.Config.GetExternalURL(c.Request()) + oidcCallbackPath
+}
+
+// setOIDCStateCookie stores the state of the OIDC sign-in in the browser, the cookie is removed if maxAge is negative.
+// The cookie is sent with the redirection from the identity provider, i.e. a top-level navigation.
+func (h *Handler) setOIDCStateCookie(c echo.Context, state string, maxAge int) {
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.App.Config.GetExternalURL(c.Request()), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// redirectToServerAuth redirects to the auth page of the web interface.
+// The value is passed in the URL fragment so that it is not sent to the server or logged by proxies.
+func (h *Handler) redirectToServerAuth(c echo.Context, key string, value string) error {
+	fragment := url.Values{}
+	fragment.Set(key, value)
+	return c.Redirect(http.StatusFound, h.App.Config.Server.BasePath+"/public/auth#"+fragment.Encode())
+}
@@ -2,23 +2,29 @@ package handlers
 
 import (
 	"errors"
+	"seanime/internal/apitoken"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 )
 
+// apiTokenContextKey is the context key of the API token used to authenticate the request.
+const apiTokenContextKey = "apiToken"
+
 func (h *Handler) OptionalAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		if h.App.Config.Server.Password == "" {
+		if !h.App.Config.IsAuthEnabled() {
 			return next(c)
 		}
 
 		path := c.Request().URL.Path
-		passwordHash := c.Request().Header.Get("X-Seanime-Token")
 
 		// Allow the following paths to be accessed by anyone
 		if path == "/api/v1/auth/login" || // for auth
 			path == "/api/v1/auth/logout" || // for auth
+			path == "/api/v1/auth/oidc/login" || // for server auth
+			path == "/api/v1/auth/oidc/callback" || // for server auth
+			path == "/api/v1/auth/proxy" || // for server auth, checks the proxy headers itself
 			path == "/api/v1/status" || // for interface
 			path == "/events" || // for server events
 			strings.HasPrefix(path, "/api/v1/directstream") || // ID & path based
@@ -33,7 +39,7 @@ func (h *Handler) OptionalAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc
 			if path == "/api/v1/status" {
 				// allow status requests by anyone but mark as unauthenticated
 				// so we can filter out critical info like settings
-				if passwordHash != h.App.ServerPasswordHash {
+				if !h.isAuthenticated(c) {
 					c.Set("unauthenticated", true)
 				}
 			}
@@ -41,7 +47,23 @@ func (h *Handler) OptionalAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc
 			return next(c)
 		}
 
-		if passwordHash == h.App.ServerPasswordHash {
+		if h.isAuthenticated(c) {
+			return next(c)
+		}
+
+		// Check the metrics token, used by scrapers that can't sign in
+		if h.isMetricsTokenValid(c) {
+			return next(c)
+		}
+
+		// Check personal API token, sent as a bearer token or in place of the password hash
+		if token := getApiToken(c); token != "" {
+			apiToken, err := h.App.ApiTokenManager.Authenticate(token)
+			if err != nil {
+				h.App.Logger.Debug().Err(err).Str("path", path).Msg("server auth: API token validation failed")
+				return h.RespondWithError(c, errors.New("UNAUTHENTICATED"))
+			}
+			c.Set(apiTokenContextKey, apiToken)
 			return next(c)
 		}
 
@@ -50,11 +72,18 @@ func (h *Handler) OptionalAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc
 		if token != "" {
 			hmacAuth := h.App.GetServerPasswordHMACAuth()
 			_, err := hmacAuth.ValidateToken(token, path)
+			if err != nil && h.App.Config.Server.BasePath != "" {
+				// The token can be bound to the path including the base path
+				_, err = hmacAuth.ValidateToken(token, h.App.Config.Server.BasePath+path)
+			}
 			if err == nil {
 				return next(c)
-			} else {
-				h.App.Logger.Debug().Err(err).Str("path", path).Msg("server auth: HMAC token validation failed")
 			}
+			// Clients signed in with OIDC or the trusted proxy sign the URLs with their session token
+			if h.App.ServerAuthManager.ValidateHMACToken(token, path, h.App.Config.Server.BasePath+path) {
+				return next(c)
+			}
+			h.App.Logger.Debug().Err(err).Str("path", path).Msg("server auth: HMAC token validation failed")
 		}
 
 		// Handle Nakama client connections
@@ -82,3 +111,35 @@ func (h *Handler) OptionalAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc
 		return h.RespondWithError(c, errors.New("UNAUTHENTICATED"))
 	}
 }
+
+// isAuthenticated returns true if the request has the server password hash, a valid session token or an identity set by the trusted proxy.
+func (h *Handler) isAuthenticated(c echo.Context) bool {
+	token := c.Request().Header.Get("X-Seanime-Token")
+
+	if h.App.Config.Server.Password != "" && token == h.App.ServerPasswordHash {
+		return true
+	}
+
+	if h.App.ServerAuthManager.GetSession(token) != nil {
+		return true
+	}
+
+	if h.App.ServerAuthManager.TrustedProxyEnabled() {
+		identity, err := h.App.ServerAuthManager.AuthenticateProxyRequest(c.Request())
+		if err == nil && identity != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getApiToken(c echo.Context) string {
+	if token := c.Request().Header.Get("X-Seanime-Token"); apitoken.IsToken(token) {
+		return token
+	}
+	if token, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer "); ok && apitoken.IsToken(token) {
+		return token
+	}
+	return ""
+}
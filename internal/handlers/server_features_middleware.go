@@ -2,135 +2,194 @@ package handlers
 
 import (
 	"errors"
+	"seanime/internal/apitoken"
 	"seanime/internal/core"
+	"seanime/internal/database/models"
 	"slices"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 )
 
-func (h *Handler) FeaturesMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		if !h.App.FeatureManager.HasDisabledFeatures() {
-			return next(c)
-		}
+// featureRoute maps the API routes starting with PathStartsWith to a feature.
+type featureRoute struct {
+	PathStartsWith string
+	Feature        core.FeatureKey
+	Methods        []string // All methods if empty
+	ExcludePaths   []string
+}
 
-		var ErrFeatureDisabled = errors.New("feature disabled")
+var (
+	updateMethods = []string{"POST", "PUT", "DELETE", "PATCH"}
+	readMethods   = []string{"GET", "HEAD"}
+)
+
+// featureRoutes are rejected when their feature is disabled.
+var featureRoutes = []featureRoute{
+	// offline mode
+	{"/api/v1/local", core.ManageOfflineMode, updateMethods, nil},
+	// settings
+	{"/api/v1/start", core.UpdateSettings, updateMethods, nil},
+	{"/api/v1/settings", core.UpdateSettings, updateMethods, nil},
+	{"/api/v1/torrentstream/settings", core.UpdateSettings, updateMethods, nil},
+	{"/api/v1/debrid/settings", core.UpdateSettings, updateMethods, nil},
+	{"/api/v1/mediastream/settings", core.UpdateSettings, updateMethods, nil},
+	{"/api/v1/report", core.UpdateSettings, updateMethods, nil},
+	{"/api/v1/theme", core.UpdateSettings, updateMethods, nil},
+	{"/api/v1/memory", core.UpdateSettings, nil, nil},
+	{"/api/v1/filecache", core.UpdateSettings, nil, nil},
+	// account
+	{"/api/v1/auth", core.ManageAccount, updateMethods, nil},
+	{"/api/v1/mal/auth", core.ManageAccount, updateMethods, nil},
+	{"/api/v1/mal/logout", core.ManageAccount, updateMethods, nil},
+	// lists
+	{"/api/v1/anilist/list-entry", core.ManageLists, updateMethods, nil},
+	{"/api/v1/library/anime-entry/update-progress", core.ManageLists, updateMethods, nil},
+	{"/api/v1/library/anime-entry/update-repeat", core.ManageLists, updateMethods, nil},
+	{"/api/v1/manga/update-progress", core.ManageLists, updateMethods, nil},
+	// refresh metadata
+	{"/api/v1/anilist/cache-layer/status", core.RefreshMetadata, updateMethods, nil},
+	{"/api/v1/library/scan", core.RefreshMetadata, updateMethods, nil},
+	{"/api/v1/manga/refetch-chapter-containers", core.RefreshMetadata, updateMethods, nil},
+	// playlists
+	{"/api/v1/playlist", core.ManagePlaylist, updateMethods, nil},
+	{"/api/v1/playback-manager/start-playlist", core.ManagePlaylist, updateMethods, nil},
+	{"/api/v1/playback-manager/playlist-next", core.ManagePlaylist, updateMethods, nil},
+	{"/api/v1/playback-manager/cancel-playlist", core.ManagePlaylist, updateMethods, nil},
+	// playback
+	{"/api/v1/playback-manager", core.WatchingLocalAnime, updateMethods, []string{"/api/v1/playback-manager/start-playlist", "/api/v1/playback-manager/playlist-next", "/api/v1/playback-manager/cancel-playlist"}},
+	{"/api/v1/media-player/start", core.WatchingLocalAnime, updateMethods, nil},
+	// torrent client / auto downloader
+	{"/api/v1/torrent/search", core.ManageAutoDownloader, updateMethods, nil},
+	{"/api/v1/torrent-client", core.ManageAutoDownloader, updateMethods, nil},
+	{"/api/v1/download-torrent-file", core.ManageAutoDownloader, updateMethods, nil},
+	{"/api/v1/auto-downloader", core.ManageAutoDownloader, updateMethods, nil},
+	// onlinestream
+	{"/api/v1/onlinestream", core.OnlineStreaming, updateMethods, []string{"/api/v1/onlinestream/search", "/api/v1/onlinestream/manual-mapping", "/api/v1/onlinestream/get-mapping", "/api/v1/onlinestream/remove-mapping"}},
+	{"/api/v1/onlinestream/search", core.ManageMangaSource, updateMethods, nil},
+	{"/api/v1/onlinestream/manual-mapping", core.ManageMangaSource, updateMethods, nil},
+	{"/api/v1/onlinestream/get-mapping", core.ManageMangaSource, updateMethods, nil},
+	{"/api/v1/onlinestream/remove-mapping", core.ManageMangaSource, updateMethods, nil},
+	// custom source
+	//{"/api/v1/custom-source", core.ManageMangaSource, updateMethods, nil},
+	// nakama
+	{"/api/v1/nakama", core.ManageNakama, updateMethods, nil},
+	// open in explorer
+	{"/api/v1/open-in-explorer", core.OpenInExplorer, nil, nil},
+	{"/api/v1/library/anime-entry/open-in-explorer", core.OpenInExplorer, updateMethods, nil},
+	// debrid
+	{"/api/v1/debrid", core.ManageDebrid, updateMethods, []string{"/api/v1/debrid/settings", "/api/v1/debrid/torrents/info", "/api/v1/debrid/torrents/file-previews"}},
+	{"/api/v1/debrid/stream", core.DebridStreaming, updateMethods, nil},
+	// home items
+	{"/api/v1/status/home-items", core.ManageHomeScreen, updateMethods, nil},
+	// extensions
+	{"/api/v1/extensions", core.ManageExtensions, updateMethods, []string{"/api/v1/extensions/all"}},
+	{"/api/v1/extensions/updates", core.ManageExtensions, nil, nil},
+	// proxy
+	{"/api/v1/proxy", core.Proxy, nil, nil},
+	{"/api/v1/image-proxy", core.Proxy, nil, nil},
+	// backups contain the whole server state
+	{"/api/v1/backup", core.UpdateSettings, nil, nil},
+	// logs
+	{"/api/v1/log", core.ViewLogs, nil, nil},
+	{"/api/v1/logs", core.ViewLogs, nil, nil},
+	{"/api/v1/logs", core.UpdateSettings, []string{"DELETE"}, nil},
+	// metrics
+	{"/api/v1/metrics", core.ViewMetrics, nil, nil},
+	// torrent stream
+	{"/api/v1/torrentstream", core.TorrentStreaming, updateMethods, []string{"/api/v1/torrentstream/settings"}},
+	// transcode
+	{"/api/v1/mediastream", core.Transcode, updateMethods, []string{"/api/v1/mediastream/settings"}},
+	{"/api/v1/directstream", core.WatchingLocalAnime, updateMethods, nil},
+	{"/api/v1/mediastream/file", core.WatchingLocalAnime, nil, nil},
+	{"/api/v1/mediastream", core.WatchingLocalAnime, nil, nil},
+	// manga
+	{"/api/v1/manga", core.ManageMangaSource, updateMethods, []string{"/api/v1/manga/pages", "/api/v1/manga/chapters"}},
+	{"/api/v1/manga", core.Reading, updateMethods, nil},
+	// manga downloads
+	{"/api/v1/manga/download", core.ManageMangaDownloads, updateMethods, nil},
+	// local anime library
+	{"/api/v1/metadata-provider", core.ManageLocalAnimeLibrary, updateMethods, nil},
+	{"/api/v1/library", core.ManageLocalAnimeLibrary, updateMethods, []string{"/api/v1/library/anime-entry/update-progress", "/api/v1/library/anime-entry/update-repeat"}},
+	{"/api/v1/library/explorer", core.ManageLocalAnimeLibrary, updateMethods, nil},
+	// api tokens
+	{"/api/v1/api-tokens", core.UpdateSettings, nil, nil},
+}
+
+// apiTokenReadRoutes are the read-only routes of the View features.
+// They are only used for API token scopes, the interface hides them when the feature is disabled.
+var apiTokenReadRoutes = []featureRoute{
+	{"/api/v1/settings", core.ViewSettings, readMethods, nil},
+	{"/api/v1/auto-downloader", core.ViewAutoDownloader, readMethods, nil},
+	{"/api/v1/library/scan-summaries", core.ViewScanSummaries, readMethods, nil},
+	{"/api/v1/extensions", core.ViewExtensions, readMethods, nil},
+	{"/api/v1/metrics", core.ViewMetrics, readMethods, nil},
+}
+
+func (r *featureRoute) matches(path string, method string) bool {
+	return strings.HasPrefix(path, r.PathStartsWith) &&
+		!slices.Contains(r.ExcludePaths, path) &&
+		(len(r.Methods) == 0 || slices.Contains(r.Methods, method))
+}
+
+// apiTokenCanAccess returns true if the token has the feature of the most specific route matching the request.
+// Routes that don't belong to a feature and the API token routes can't be accessed with API tokens.
+func apiTokenCanAccess(apiToken *models.ApiToken, path string, method string) bool {
+	if strings.HasPrefix(path, "/api/v1/api-tokens") {
+		return false
+	}
 
-		type pathFeatureConfig struct {
-			PathStartsWith string
-			ShouldReject   bool
-			Methods        []string
-			ExcludePaths   []string
+	longest := -1
+	allowed := false
+	for _, routes := range [][]featureRoute{featureRoutes, apiTokenReadRoutes} {
+		for _, route := range routes {
+			if !route.matches(path, method) {
+				continue
+			}
+			hasScope := apitoken.HasScope(apiToken, string(route.Feature))
+			switch {
+			case len(route.PathStartsWith) > longest:
+				longest = len(route.PathStartsWith)
+				allowed = hasScope
+			case len(route.PathStartsWith) == longest:
+				allowed = allowed || hasScope
+			}
 		}
+	}
 
-		var UpdateMethods = []string{"POST", "PUT", "DELETE", "PATCH"}
-		var Empty []string
+	return allowed
+}
 
+func (h *Handler) FeaturesMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
 		path := c.Request().URL.Path
 		method := strings.ToUpper(c.Request().Method)
 
-		var pathFeatureConfigs = []pathFeatureConfig{
-			// offline mode
-			{"/api/v1/local", h.App.FeatureManager.IsDisabled(core.ManageOfflineMode), UpdateMethods, Empty},
-			// settings
-			{"/api/v1/start", h.App.FeatureManager.IsDisabled(core.UpdateSettings), UpdateMethods, Empty},
-			{"/api/v1/settings", h.App.FeatureManager.IsDisabled(core.UpdateSettings), UpdateMethods, Empty},
-			{"/api/v1/torrentstream/settings", h.App.FeatureManager.IsDisabled(core.UpdateSettings), UpdateMethods, Empty},
-			{"/api/v1/debrid/settings", h.App.FeatureManager.IsDisabled(core.UpdateSettings), UpdateMethods, Empty},
-			{"/api/v1/mediastream/settings", h.App.FeatureManager.IsDisabled(core.UpdateSettings), UpdateMethods, Empty},
-			{"/api/v1/report", h.App.FeatureManager.IsDisabled(core.UpdateSettings), UpdateMethods, Empty},
-			{"/api/v1/theme", h.App.FeatureManager.IsDisabled(core.UpdateSettings), UpdateMethods, Empty},
-			{"/api/v1/memory", h.App.FeatureManager.IsDisabled(core.UpdateSettings), Empty, Empty},
-			{"/api/v1/filecache", h.App.FeatureManager.IsDisabled(core.UpdateSettings), Empty, Empty},
-			// account
-			{"/api/v1/auth", h.App.FeatureManager.IsDisabled(core.ManageAccount), UpdateMethods, Empty},
-			{"/api/v1/mal/auth", h.App.FeatureManager.IsDisabled(core.ManageAccount), UpdateMethods, Empty},
-			{"/api/v1/mal/logout", h.App.FeatureManager.IsDisabled(core.ManageAccount), UpdateMethods, Empty},
-			// lists
-			{"/api/v1/anilist/list-entry", h.App.FeatureManager.IsDisabled(core.ManageLists), UpdateMethods, Empty},
-			{"/api/v1/library/anime-entry/update-progress", h.App.FeatureManager.IsDisabled(core.ManageLists), UpdateMethods, Empty},
-			{"/api/v1/library/anime-entry/update-repeat", h.App.FeatureManager.IsDisabled(core.ManageLists), UpdateMethods, Empty},
-			{"/api/v1/manga/update-progress", h.App.FeatureManager.IsDisabled(core.ManageLists), UpdateMethods, Empty},
-			// refresh metadata
-			{"/api/v1/anilist/cache-layer/status", h.App.FeatureManager.IsDisabled(core.RefreshMetadata), UpdateMethods, Empty},
-			{"/api/v1/library/scan", h.App.FeatureManager.IsDisabled(core.RefreshMetadata), UpdateMethods, Empty},
-			{"/api/v1/manga/refetch-chapter-containers", h.App.FeatureManager.IsDisabled(core.RefreshMetadata), UpdateMethods, Empty},
-			// playlists
-			{"/api/v1/playlist", h.App.FeatureManager.IsDisabled(core.ManagePlaylist), UpdateMethods, Empty},
-			{"/api/v1/playback-manager/start-playlist", h.App.FeatureManager.IsDisabled(core.ManagePlaylist), UpdateMethods, Empty},
-			{"/api/v1/playback-manager/playlist-next", h.App.FeatureManager.IsDisabled(core.ManagePlaylist), UpdateMethods, Empty},
-			{"/api/v1/playback-manager/cancel-playlist", h.App.FeatureManager.IsDisabled(core.ManagePlaylist), UpdateMethods, Empty},
-			// playback
-			{"/api/v1/playback-manager", h.App.FeatureManager.IsDisabled(core.WatchingLocalAnime), UpdateMethods, []string{"/api/v1/playback-manager/start-playlist", "/api/v1/playback-manager/playlist-next", "/api/v1/playback-manager/cancel-playlist"}},
-			{"/api/v1/media-player/start", h.App.FeatureManager.IsDisabled(core.WatchingLocalAnime), UpdateMethods, Empty},
-			// torrent client / auto downloader
-			{"/api/v1/torrent/search", h.App.FeatureManager.IsDisabled(core.ManageAutoDownloader), UpdateMethods, Empty},
-			{"/api/v1/torrent-client", h.App.FeatureManager.IsDisabled(core.ManageAutoDownloader), UpdateMethods, Empty},
-			{"/api/v1/download-torrent-file", h.App.FeatureManager.IsDisabled(core.ManageAutoDownloader), UpdateMethods, Empty},
-			{"/api/v1/auto-downloader", h.App.FeatureManager.IsDisabled(core.ManageAutoDownloader), UpdateMethods, Empty},
-			// onlinestream
-			{"/api/v1/onlinestream", h.App.FeatureManager.IsDisabled(core.OnlineStreaming), UpdateMethods, []string{"/api/v1/onlinestream/search", "/api/v1/onlinestream/manual-mapping", "/api/v1/onlinestream/get-mapping", "/api/v1/onlinestream/remove-mapping"}},
-			{"/api/v1/onlinestream/search", h.App.FeatureManager.IsDisabled(core.ManageMangaSource), UpdateMethods, Empty},
-			{"/api/v1/onlinestream/manual-mapping", h.App.FeatureManager.IsDisabled(core.ManageMangaSource), UpdateMethods, Empty},
-			{"/api/v1/onlinestream/get-mapping", h.App.FeatureManager.IsDisabled(core.ManageMangaSource), UpdateMethods, Empty},
-			{"/api/v1/onlinestream/remove-mapping", h.App.FeatureManager.IsDisabled(core.ManageMangaSource), UpdateMethods, Empty},
-			// custom source
-			//{"/api/v1/custom-source", h.App.FeatureManager.IsDisabled(core.ManageMangaSource), UpdateMethods, Empty},
-			// nakama
-			{"/api/v1/nakama", h.App.FeatureManager.IsDisabled(core.ManageNakama), UpdateMethods, Empty},
-			// open in explorer
-			{"/api/v1/open-in-explorer", h.App.FeatureManager.IsDisabled(core.OpenInExplorer), Empty, Empty},
-			{"/api/v1/library/anime-entry/open-in-explorer", h.App.FeatureManager.IsDisabled(core.OpenInExplorer), UpdateMethods, Empty},
-			// debrid
-			{"/api/v1/debrid", h.App.FeatureManager.IsDisabled(core.ManageDebrid), UpdateMethods, []string{"/api/v1/debrid/settings", "/api/v1/debrid/torrents/info", "/api/v1/debrid/torrents/file-previews"}},
-			{"/api/v1/debrid/stream", h.App.FeatureManager.IsDisabled(core.DebridStreaming), UpdateMethods, Empty},
-			// home items
-			{"/api/v1/status/home-items", h.App.FeatureManager.IsDisabled(core.ManageHomeScreen), UpdateMethods, Empty},
-			// extensions
-			{"/api/v1/extensions", h.App.FeatureManager.IsDisabled(core.ManageExtensions), UpdateMethods, []string{"/api/v1/extensions/all"}},
-			{"/api/v1/extensions/updates", h.App.FeatureManager.IsDisabled(core.ManageExtensions), Empty, Empty},
-			// proxy
-			{"/api/v1/proxy", h.App.FeatureManager.IsDisabled(core.Proxy), Empty, Empty},
-			{"/api/v1/image-proxy", h.App.FeatureManager.IsDisabled(core.Proxy), Empty, Empty},
-			// logs
-			{"/api/v1/log", h.App.FeatureManager.IsDisabled(core.ViewLogs), Empty, Empty},
-			{"/api/v1/logs", h.App.FeatureManager.IsDisabled(core.ViewLogs), Empty, Empty},
-			{"/api/v1/logs", h.App.FeatureManager.IsDisabled(core.UpdateSettings), []string{"DELETE"}, Empty},
-			// torrent stream
-			{"/api/v1/torrentstream", h.App.FeatureManager.IsDisabled(core.TorrentStreaming), UpdateMethods, []string{"/api/v1/torrentstream/settings"}},
-			// transcode
-			{"/api/v1/mediastream", h.App.FeatureManager.IsDisabled(core.Transcode), UpdateMethods, []string{"/api/v1/mediastream/settings"}},
-			{"/api/v1/directstream", h.App.FeatureManager.IsDisabled(core.WatchingLocalAnime), UpdateMethods, Empty},
-			{"/api/v1/mediastream/file", h.App.FeatureManager.IsDisabled(core.WatchingLocalAnime), Empty, Empty},
-			{"/api/v1/mediastream", h.App.FeatureManager.IsDisabled(core.WatchingLocalAnime), Empty, Empty},
-			// manga
-			{"/api/v1/manga", h.App.FeatureManager.IsDisabled(core.ManageMangaSource), UpdateMethods, []string{"/api/v1/manga/pages", "/api/v1/manga/chapters"}},
-			{"/api/v1/manga", h.App.FeatureManager.IsDisabled(core.Reading), UpdateMethods, Empty},
-			// manga downloads
-			{"/api/v1/manga/download", h.App.FeatureManager.IsDisabled(core.ManageMangaDownloads), UpdateMethods, Empty},
-			// local anime library
-			{"/api/v1/metadata-provider", h.App.FeatureManager.IsDisabled(core.ManageLocalAnimeLibrary), UpdateMethods, Empty},
-			{"/api/v1/library", h.App.FeatureManager.IsDisabled(core.ManageLocalAnimeLibrary), UpdateMethods, []string{"/api/v1/library/anime-entry/update-progress", "/api/v1/library/anime-entry/update-repeat"}},
-			{"/api/v1/library/explorer", h.App.FeatureManager.IsDisabled(core.ManageLocalAnimeLibrary), UpdateMethods, Empty},
+		// Requests authenticated with an API token are limited to its scopes
+		if apiToken, ok := c.Get(apiTokenContextKey).(*models.ApiToken); ok {
+			if !apiTokenCanAccess(apiToken, path, method) {
+				return h.RespondWithError(c, errors.New("API token does not have access to this route"))
+			}
 		}
 
-		pathPrefixes := make([]string, 0, len(pathFeatureConfigs))
-		for _, config := range pathFeatureConfigs {
-			pathPrefixes = append(pathPrefixes, config.PathStartsWith)
-			if config.ShouldReject &&
-				strings.HasPrefix(path, config.PathStartsWith) &&
-				!slices.ContainsFunc(config.ExcludePaths, func(i string) bool { return path == i }) {
-				if len(config.Methods) == 0 || strings.Contains(strings.Join(config.Methods, ","), strings.ToUpper(method)) {
-					return h.RespondWithError(c, ErrFeatureDisabled)
-				}
+		if !h.App.FeatureManager.HasDisabledFeatures() {
+			return next(c)
+		}
+
+		var ErrFeatureDisabled = errors.New("feature disabled")
+
+		pathPrefixes := make([]string, 0, len(featureRoutes))
+		for _, route := range featureRoutes {
+			pathPrefixes = append(pathPrefixes, route.PathStartsWith)
+			if h.App.FeatureManager.IsDisabled(route.Feature) && route.matches(path, method) {
+				return h.RespondWithError(c, ErrFeatureDisabled)
 			}
 		}
 
 		if h.App.FeatureManager.IsDisabled(core.PushRequests) {
 			pathPrefixes = append(pathPrefixes, "/api/v1/anilist/list-anime", "/api/v1/anilist/list-manga", "/api/v1/anilist/list-recent-anime", "/api/v1/manga/anilist/list", "/api/v1/announcements")
 			if !slices.ContainsFunc(pathPrefixes, func(i string) bool { return strings.HasPrefix(path, i) }) {
-				if strings.Contains(strings.Join(UpdateMethods, ","), strings.ToUpper(method)) {
+				if slices.Contains(updateMethods, method) {
 					//return h.RespondWithError(c, ErrFeatureDisabled)
 					return h.RespondWithData(c, nil)
 				}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"seanime/internal/core"
+	"seanime/internal/database/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiTokenCanAccess(t *testing.T) {
+	tests := []struct {
+		name     string
+		scopes   []core.FeatureKey
+		method   string
+		path     string
+		expected bool
+	}{
+		// The most specific route decides
+		{"Refresh metadata can scan", []core.FeatureKey{core.RefreshMetadata}, "POST", "/api/v1/library/scan", true},
+		{"Refresh metadata can't manage the library", []core.FeatureKey{core.RefreshMetadata}, "POST", "/api/v1/library/unknown-media", false},
+		{"Refresh metadata can't delete local files", []core.FeatureKey{core.RefreshMetadata}, "DELETE", "/api/v1/library/local-files", false},
+		{"Local library can't scan", []core.FeatureKey{core.ManageLocalAnimeLibrary}, "POST", "/api/v1/library/scan", false},
+		{"Local library can manage the library", []core.FeatureKey{core.ManageLocalAnimeLibrary}, "POST", "/api/v1/library/unknown-media", true},
+		// View features are read-only
+		{"View auto downloader can read the rules", []core.FeatureKey{core.ViewAutoDownloader}, "GET", "/api/v1/auto-downloader/rules", true},
+		{"View auto downloader can't create rules", []core.FeatureKey{core.ViewAutoDownloader}, "POST", "/api/v1/auto-downloader/rule", false},
+		{"View auto downloader can't delete rules", []core.FeatureKey{core.ViewAutoDownloader}, "DELETE", "/api/v1/auto-downloader/rule/1", false},
+		{"Manage auto downloader can create rules", []core.FeatureKey{core.ManageAutoDownloader}, "POST", "/api/v1/auto-downloader/rule", true},
+		{"Manage auto downloader can't read the rules", []core.FeatureKey{core.ManageAutoDownloader}, "GET", "/api/v1/auto-downloader/rules", false},
+		{"View metrics", []core.FeatureKey{core.ViewMetrics}, "GET", "/api/v1/metrics", true},
+		{"Metrics without the scope", []core.FeatureKey{core.ViewSettings}, "GET", "/api/v1/metrics", false},
+		// API tokens can't manage API tokens
+		{"API tokens with update settings", []core.FeatureKey{core.UpdateSettings}, "GET", "/api/v1/api-tokens", false},
+		{"API tokens creation", []core.FeatureKey{core.UpdateSettings, core.ViewSettings}, "POST", "/api/v1/api-tokens", false},
+		{"API token deletion", []core.FeatureKey{core.UpdateSettings}, "DELETE", "/api/v1/api-tokens/1", false},
+		// Routes that don't belong to a feature
+		{"Unknown route", []core.FeatureKey{core.UpdateSettings, core.ManageLocalAnimeLibrary}, "GET", "/api/v1/anilist/collection", false},
+		{"Unknown update route", []core.FeatureKey{core.UpdateSettings}, "POST", "/api/v1/unknown", false},
+		{"No scopes", nil, "POST", "/api/v1/library/scan", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiToken := &models.ApiToken{}
+			for _, scope := range tt.scopes {
+				apiToken.Scopes = append(apiToken.Scopes, string(scope))
+			}
+			require.Equal(t, tt.expected, apiTokenCanAccess(apiToken, tt.path, tt.method))
+		})
+	}
+}
@@ -258,6 +258,8 @@ func (h *Handler) HandleSaveAutoDownloaderSettings(c echo.Context) error {
 		EnableEnhancedQueries bool   `json:"enableEnhancedQueries"`
 		EnableSeasonCheck     bool   `json:"enableSeasonCheck"`
 		UseDebrid             bool   `json:"useDebrid"`
+		EnableBatchFallback   bool   `json:"enableBatchFallback"`
+		EnableAiringSchedule  bool   `json:"enableAiringSchedule"`
 	}
 
 	var b body
@@ -284,6 +286,8 @@ func (h *Handler) HandleSaveAutoDownloaderSettings(c echo.Context) error {
 		EnableEnhancedQueries: b.EnableEnhancedQueries,
 		EnableSeasonCheck:     b.EnableSeasonCheck,
 		UseDebrid:             b.UseDebrid,
+		EnableBatchFallback:   b.EnableBatchFallback,
+		EnableAiringSchedule:  b.EnableAiringSchedule,
 	}
 
 	currSettings.AutoDownloader = autoDownloaderSettings
@@ -46,10 +46,18 @@ type Status struct {
 	FeatureFlags          core.FeatureFlags             `json:"featureFlags"`
 	DisabledFeatures      []core.FeatureKey             `json:"disabledFeatures"`
 	ServerReady           bool                          `json:"serverReady"`
-	ServerHasPassword     bool                          `json:"serverHasPassword"`
+	ServerHasPassword     bool                          `json:"serverHasPassword"` // Clients have to authenticate, with the password, OIDC or the trusted proxy
+	ServerAuthMethods     ServerAuthMethods             `json:"serverAuthMethods"`
 	ShowChangelogTour     string                        `json:"showChangelogTour"`
 }
 
+// ServerAuthMethods lists the enabled ways for clients to authenticate.
+type ServerAuthMethods struct {
+	Password     bool `json:"password"`
+	Oidc         bool `json:"oidc"`
+	TrustedProxy bool `json:"trustedProxy"`
+}
+
 var clientInfoCache = result.NewMap[string, util.ClientInfo]()
 
 // NewStatus returns a new Status struct.
@@ -107,9 +115,14 @@ func (h *Handler) NewStatus(c echo.Context) *Status {
 		IsDesktopSidecar:      h.App.IsDesktopSidecar,
 		FeatureFlags:          h.App.FeatureFlags,
 		ServerReady:           h.App.ServerReady,
-		ServerHasPassword:     h.App.Config.Server.Password != "",
+		ServerHasPassword:     h.App.Config.IsAuthEnabled(),
 		DisabledFeatures:      h.App.FeatureManager.DisabledFeatures,
 		ShowChangelogTour:     h.App.ShowTour,
+		ServerAuthMethods: ServerAuthMethods{
+			Password:     h.App.Config.Server.Password != "",
+			Oidc:         h.App.ServerAuthManager.OIDCEnabled(),
+			TrustedProxy: h.App.ServerAuthManager.TrustedProxyEnabled(),
+		},
 	}
 
 	if c.Get("unauthenticated") != nil && c.Get("unauthenticated").(bool) {
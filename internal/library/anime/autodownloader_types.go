@@ -1,5 +1,9 @@
 package anime
 
+import (
+	"seanime/internal/api/anilist"
+)
+
 // DEVNOTE: The structs are defined in this file because they are imported by both the autodownloader package and the db package.
 // Defining them in the autodownloader package would create a circular dependency because the db package imports these structs.
 
@@ -59,6 +63,10 @@ type (
 		// Providers (extension IDs) If set, only torrents from these providers are considered.
 		// Overrides default provider if set.
 		Providers []string `json:"providers"`
+
+		// TemplateID is set if the rule was created by a rule template.
+		// The rule is deleted when the media no longer matches the template.
+		TemplateID *uint `json:"templateId,omitempty"`
 	}
 
 	AutoDownloaderProfile struct {
@@ -85,10 +93,53 @@ type (
 		// If a torrent score hits this threshold, skip the delay and download/queue immediately
 		SkipDelayScore int `json:"skipDelayScore"`
 
+		// UpgradeEnabled If true, episodes in the library are replaced when a better release is found
+		// (higher resolution, preferred release group, higher score or v2/REPACK).
+		UpgradeEnabled bool `json:"upgradeEnabled,omitempty"`
+		// UpgradeCutoffHours Better releases are only looked for during X hours after the episode was downloaded.
+		// Defaults to 72 hours.
+		UpgradeCutoffHours int `json:"upgradeCutoffHours,omitempty"`
+
 		// Providers (extension IDs) If set, only torrents from these providers are considered.
 		Providers []string `json:"providers"`
 	}
 
+	// AutoDownloaderRuleTemplate creates rules for the entries of the collection that match its criteria.
+	AutoDownloaderRuleTemplate struct {
+		DbID    uint   `json:"dbId"`
+		Name    string `json:"name"`
+		Enabled bool   `json:"enabled"`
+
+		// Criteria, an entry must match all the criteria that are set
+		ListStatuses  []anilist.MediaListStatus `json:"listStatuses"`
+		MediaStatuses []anilist.MediaStatus     `json:"mediaStatuses,omitempty"`
+		Formats       []anilist.MediaFormat     `json:"formats,omitempty"`
+		// Genres The media must have at least one of the genres
+		Genres []string `json:"genres,omitempty"`
+		// Tags The media must have at least one of the tags
+		Tags []string `json:"tags,omitempty"`
+		// MinTagRank Minimum rank (0-100) of the matching tag, 0 means any rank
+		MinTagRank int `json:"minTagRank,omitempty"`
+		// MinScore Minimum score given by the user
+		MinScore float64 `json:"minScore,omitempty"`
+		// MinMeanScore Minimum mean score of the media
+		MinMeanScore int `json:"minMeanScore,omitempty"`
+
+		// DestinationPattern Destination of the created rules.
+		// Supports {title}, {romajiTitle}, {englishTitle}, {year} and {season}.
+		// Relative patterns are resolved against the library path, e.g. "{title}".
+		DestinationPattern string `json:"destinationPattern"`
+
+		// Fields copied to the created rules
+		ProfileID           *uint                                 `json:"profileId,omitempty"`
+		TitleComparisonType AutoDownloaderRuleTitleComparisonType `json:"titleComparisonType"`
+		ReleaseGroups       []string                              `json:"releaseGroups,omitempty"`
+		Resolutions         []string                              `json:"resolutions,omitempty"`
+		AdditionalTerms     []string                              `json:"additionalTerms"`
+		ExcludeTerms        []string                              `json:"excludeTerms"`
+		Providers           []string                              `json:"providers"`
+	}
+
 	AutoDownloaderCondition struct {
 		ID      string                                `json:"id"`
 		Term    string                                `json:"term"`
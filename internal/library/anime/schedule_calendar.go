@@ -0,0 +1,148 @@
+package anime
+
+import (
+	"fmt"
+	"seanime/internal/api/anilist"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// calendarPastWindow is how long aired episodes are kept in the calendar
+	calendarPastWindow         = 7 * 24 * time.Hour
+	calendarDefaultDuration    = 24 * time.Minute
+	calendarLineLength         = 75
+	calendarTimeFormat         = "20060102T150405Z"
+	calendarProductIdentifier  = "-//Seanime//Airing Schedule//EN"
+	calendarAnilistAnimeURLFmt = "https://anilist.co/anime/%d"
+)
+
+type ScheduleCalendarOptions struct {
+	AnimeCollection *anilist.AnimeCollection
+	// LocalFiles is used to mark the episodes that are already in the library
+	LocalFiles []*LocalFile
+	// ListStatuses filters the entries by list status, all entries are included if empty
+	ListStatuses []anilist.MediaListStatus
+	Now          time.Time
+}
+
+// NewScheduleCalendar returns an iCalendar (RFC 5545) document with one event per upcoming episode.
+// Episodes that aired in the last 7 days are kept so that they don't disappear from calendars as soon as they air.
+func NewScheduleCalendar(items []*ScheduleItem, opts *ScheduleCalendarOptions) string {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	entries := make(map[int]*anilist.AnimeListEntry)
+	if opts.AnimeCollection != nil {
+		for _, list := range opts.AnimeCollection.GetMediaListCollection().GetLists() {
+			for _, entry := range list.GetEntries() {
+				entries[entry.GetMedia().GetID()] = entry
+			}
+		}
+	}
+	lfWrapper := NewLocalFileWrapper(opts.LocalFiles)
+
+	items = slices.Clone(items)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DateTime.Before(items[j].DateTime)
+	})
+
+	var sb strings.Builder
+	writeCalendarLine(&sb, "BEGIN:VCALENDAR")
+	writeCalendarLine(&sb, "VERSION:2.0")
+	writeCalendarLine(&sb, "PRODID:"+calendarProductIdentifier)
+	writeCalendarLine(&sb, "CALSCALE:GREGORIAN")
+	writeCalendarLine(&sb, "METHOD:PUBLISH")
+	writeCalendarLine(&sb, "X-WR-CALNAME:Seanime")
+
+	for _, item := range items {
+		if item == nil || item.DateTime.Before(now.Add(-calendarPastWindow)) {
+			continue
+		}
+
+		entry, ok := entries[item.MediaId]
+		if len(opts.ListStatuses) > 0 && (!ok || !slices.Contains(opts.ListStatuses, entry.GetStatusSafe())) {
+			continue
+		}
+
+		duration := calendarDefaultDuration
+		if ok && entry.GetMedia().GetDuration() != nil && *entry.GetMedia().GetDuration() > 0 {
+			duration = time.Duration(*entry.GetMedia().GetDuration()) * time.Minute
+		}
+
+		summary := item.Title
+		if !item.IsMovie {
+			summary = fmt.Sprintf("%s - Episode %d", item.Title, item.EpisodeNumber)
+		}
+
+		inLibrary := false
+		if lfEntry, found := lfWrapper.GetLocalEntryById(item.MediaId); found {
+			_, inLibrary = lfEntry.FindLocalFileWithEpisodeNumber(item.EpisodeNumber)
+		}
+
+		description := make([]string, 0, 4)
+		if !item.IsMovie {
+			description = append(description, fmt.Sprintf("Episode %d", item.EpisodeNumber))
+		}
+		if item.IsSeasonFinale {
+			description = append(description, "Season finale")
+		}
+		if inLibrary {
+			description = append(description, "In library")
+		} else {
+			description = append(description, "Not in library")
+		}
+		url := fmt.Sprintf(calendarAnilistAnimeURLFmt, item.MediaId)
+		description = append(description, url)
+
+		writeCalendarLine(&sb, "BEGIN:VEVENT")
+		writeCalendarLine(&sb, fmt.Sprintf("UID:seanime-%d-%d-%d@seanime", item.MediaId, item.EpisodeNumber, item.DateTime.Unix()))
+		writeCalendarLine(&sb, "DTSTAMP:"+now.UTC().Format(calendarTimeFormat))
+		writeCalendarLine(&sb, "DTSTART:"+item.DateTime.UTC().Format(calendarTimeFormat))
+		writeCalendarLine(&sb, "DTEND:"+item.DateTime.Add(duration).UTC().Format(calendarTimeFormat))
+		writeCalendarLine(&sb, "SUMMARY:"+escapeCalendarText(summary))
+		writeCalendarLine(&sb, "DESCRIPTION:"+escapeCalendarText(strings.Join(description, "\n")))
+		writeCalendarLine(&sb, "URL:"+url)
+		if ok && entry.GetStatus() != nil {
+			writeCalendarLine(&sb, "CATEGORIES:"+escapeCalendarText(string(*entry.GetStatus())))
+		}
+		writeCalendarLine(&sb, "TRANSP:TRANSPARENT")
+		writeCalendarLine(&sb, "END:VEVENT")
+	}
+
+	writeCalendarLine(&sb, "END:VCALENDAR")
+	return sb.String()
+}
+
+// writeCalendarLine writes the line folded at 75 octets, as required by RFC 5545.
+func writeCalendarLine(sb *strings.Builder, line string) {
+	limit := calendarLineLength
+	for len(line) > limit {
+		// Don't split multi-byte characters
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		sb.WriteString(line[:cut])
+		sb.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space
+		limit = calendarLineLength - 1
+	}
+	sb.WriteString(line)
+	sb.WriteString("\r\n")
+}
+
+func escapeCalendarText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
@@ -0,0 +1,68 @@
+package anime
+
+import (
+	"seanime/internal/api/anilist"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewScheduleCalendar(t *testing.T) {
+	now := time.Date(2024, 10, 5, 12, 0, 0, 0, time.UTC)
+
+	collection := &anilist.AnimeCollection{
+		MediaListCollection: &anilist.AnimeCollection_MediaListCollection{
+			Lists: []*anilist.AnimeCollection_MediaListCollection_Lists{
+				{Entries: []*anilist.AnimeListEntry{
+					{Status: lo.ToPtr(anilist.MediaListStatusCurrent), Media: &anilist.BaseAnime{ID: 1, Duration: lo.ToPtr(30)}},
+					{Status: lo.ToPtr(anilist.MediaListStatusPlanning), Media: &anilist.BaseAnime{ID: 2}},
+				}},
+			},
+		},
+	}
+
+	items := []*ScheduleItem{
+		{MediaId: 1, Title: "Frieren, Beyond Journey's End", EpisodeNumber: 5, DateTime: now.Add(-time.Hour)},
+		{MediaId: 1, Title: "Frieren, Beyond Journey's End", EpisodeNumber: 6, DateTime: now.Add(6 * 24 * time.Hour)},
+		{MediaId: 1, Title: "Frieren, Beyond Journey's End", EpisodeNumber: 1, DateTime: now.Add(-30 * 24 * time.Hour)},
+		{MediaId: 2, Title: "Dandadan", EpisodeNumber: 2, DateTime: now.Add(2 * time.Hour), IsSeasonFinale: true},
+	}
+
+	lfs := []*LocalFile{
+		{Path: "/anime/Frieren/05.mkv", MediaId: 1, Metadata: &LocalFileMetadata{Episode: 5, Type: LocalFileTypeMain}},
+	}
+
+	calendar := NewScheduleCalendar(items, &ScheduleCalendarOptions{
+		AnimeCollection: collection,
+		LocalFiles:      lfs,
+		Now:             now,
+	})
+
+	require.True(t, strings.HasPrefix(calendar, "BEGIN:VCALENDAR\r\n"))
+	require.True(t, strings.HasSuffix(calendar, "END:VCALENDAR\r\n"))
+	// Episodes that aired more than a week ago are not included
+	require.Equal(t, 3, strings.Count(calendar, "BEGIN:VEVENT"))
+	require.Contains(t, calendar, "UID:seanime-1-5-1728126000@seanime")
+
+	unfolded := strings.ReplaceAll(calendar, "\r\n ", "")
+	require.Contains(t, unfolded, `SUMMARY:Frieren\, Beyond Journey's End - Episode 5`)
+	require.Contains(t, unfolded, `DESCRIPTION:Episode 5\nIn library\nhttps://anilist.co/anime/1`)
+	require.Contains(t, unfolded, "DTSTART:20241005T110000Z")
+	require.Contains(t, unfolded, "DTEND:20241005T113000Z")
+	require.Contains(t, unfolded, `DESCRIPTION:Episode 2\nSeason finale\nNot in library\nhttps://anilist.co/anime/2`)
+
+	for _, line := range strings.Split(calendar, "\r\n") {
+		require.LessOrEqual(t, len(line), 75)
+	}
+
+	planning := NewScheduleCalendar(items, &ScheduleCalendarOptions{
+		AnimeCollection: collection,
+		ListStatuses:    []anilist.MediaListStatus{anilist.MediaListStatusPlanning},
+		Now:             now,
+	})
+	require.Equal(t, 1, strings.Count(planning, "BEGIN:VEVENT"))
+	require.Contains(t, planning, "CATEGORIES:PLANNING")
+}
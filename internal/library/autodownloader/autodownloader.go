@@ -17,6 +17,7 @@ import (
 	"seanime/internal/hook"
 	"seanime/internal/library/anime"
 	"seanime/internal/notifier"
+	"seanime/internal/platforms/platform"
 	"seanime/internal/torrent_clients/torrent_client"
 	"seanime/internal/torrents/torrent"
 	"seanime/internal/util"
@@ -49,13 +50,21 @@ type (
 		wsEventManager          events.WSEventManagerInterface
 		settings                *models.AutoDownloaderSettings
 		metadataProviderRef     *util.Ref[metadata_provider.Provider]
+		platformRef             *util.Ref[platform.Platform]
 		settingsUpdatedCh       chan struct{}
 		stopCh                  chan struct{}
 		startCh                 chan bool
 		debugTrace              bool
 		mu                      sync.Mutex
+		templatesMu             sync.Mutex
 		isOfflineRef            *util.Ref[bool]
 		simulationResults       []*SimulationResult // Stores results when running in simulation mode
+		pollingMu               sync.Mutex
+		lastFullCheckAt         time.Time
+		airingSchedule          []*anime.ScheduleItem // Cached airing schedule of the collection
+		airingScheduleFetchedAt time.Time
+		batchSearchFailures     map[uint]*batchSearchFailure // Rule ID -> Failed batch searches, see [downloadMissingBatches]
+		batchSearchMu           sync.Mutex
 	}
 
 	// SimulationResult represents a torrent that would be downloaded in simulation mode
@@ -69,6 +78,9 @@ type (
 		Score       int    `json:"score"`
 		ExtensionID string `json:"extensionId"`
 		IsDelayed   bool   `json:"isDelayed"`
+		// Set if the torrent is a batch downloaded for missing episodes
+		IsBatch  bool  `json:"isBatch,omitempty"`
+		Episodes []int `json:"episodes,omitempty"`
 	}
 
 	NewAutoDownloaderOptions struct {
@@ -78,6 +90,7 @@ type (
 		WSEventManager          events.WSEventManagerInterface
 		Database                *db.Database
 		MetadataProviderRef     *util.Ref[metadata_provider.Provider]
+		PlatformRef             *util.Ref[platform.Platform]
 		DebridClientRepository  *debrid_client.Repository
 		IsOfflineRef            *util.Ref[bool]
 	}
@@ -92,6 +105,7 @@ func New(opts *NewAutoDownloaderOptions) *AutoDownloader {
 		wsEventManager:          opts.WSEventManager,
 		animeCollection:         mo.None[*anilist.AnimeCollection](),
 		metadataProviderRef:     opts.MetadataProviderRef,
+		platformRef:             opts.PlatformRef,
 		debridClientRepository:  opts.DebridClientRepository,
 		settings: &models.AutoDownloaderSettings{
 			Provider:              "", // Default provider, will be updated after the settings are fetched
@@ -100,13 +114,14 @@ func New(opts *NewAutoDownloaderOptions) *AutoDownloader {
 			DownloadAutomatically: false,
 			EnableEnhancedQueries: false,
 		},
-		settingsUpdatedCh: make(chan struct{}, 1),
-		stopCh:            make(chan struct{}, 1),
-		startCh:           make(chan bool, 1),
-		debugTrace:        true,
-		mu:                sync.Mutex{},
-		isOfflineRef:      opts.IsOfflineRef,
-		simulationResults: make([]*SimulationResult, 0),
+		settingsUpdatedCh:   make(chan struct{}, 1),
+		stopCh:              make(chan struct{}, 1),
+		startCh:             make(chan bool, 1),
+		debugTrace:          true,
+		mu:                  sync.Mutex{},
+		isOfflineRef:        opts.IsOfflineRef,
+		simulationResults:   make([]*SimulationResult, 0),
+		batchSearchFailures: make(map[uint]*batchSearchFailure),
 	}
 }
 
@@ -140,6 +155,7 @@ func (ad *AutoDownloader) SetSettings(settings *models.AutoDownloaderSettings) {
 
 func (ad *AutoDownloader) SetAnimeCollection(ac *anilist.AnimeCollection) {
 	ad.animeCollection = mo.Some(ac)
+	ad.invalidateAiringSchedule()
 }
 
 func (ad *AutoDownloader) SetTorrentClientRepository(repo *torrent_client.Repository) {
@@ -237,13 +253,11 @@ func (ad *AutoDownloader) start() {
 		ad.logger.Info().Msg("autodownloader: Module started")
 	}
 
+	ad.setLastFullCheck(time.Now())
+
 	for {
-		interval := 20
-		// Use the user-defined interval if it's greater or equal to 15
-		if ad.settings != nil && ad.settings.Interval > 0 && ad.settings.Interval >= 15 {
-			interval = ad.settings.Interval
-		}
-		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		// The delay depends on the airing schedule if it's enabled, otherwise it's the user-defined interval
+		timer := time.NewTimer(ad.getNextCheckDelay(context.Background()))
 		select {
 		case <-ad.settingsUpdatedCh:
 			break // Restart the loop
@@ -252,14 +266,19 @@ func (ad *AutoDownloader) start() {
 		case isSumulation := <-ad.startCh:
 			if ad.settings.Enabled {
 				ad.logger.Debug().Msg("autodownloader: Auto Downloader started")
+				if !isSumulation {
+					ad.setLastFullCheck(time.Now())
+				}
 				ad.checkForNewEpisodes(context.Background(), isSumulation)
 			}
-		case <-ticker.C:
+		case <-timer.C:
 			if ad.settings.Enabled {
-				ad.checkForNewEpisodes(context.Background(), false)
+				ad.runScheduledCheck(context.Background())
+			} else {
+				ad.setLastFullCheck(time.Now())
 			}
 		}
-		ticker.Stop()
+		timer.Stop()
 	}
 
 }
@@ -281,6 +300,14 @@ func (ad *AutoDownloader) checkForNewEpisodes(ctx context.Context, isSimulation
 	}
 	ad.mu.Unlock()
 
+	runResult := runResultError
+	if !isSimulation {
+		startTime := time.Now()
+		defer func() {
+			observeRun(runResult, startTime)
+		}()
+	}
+
 	// Fetch all necessary data
 	data, err := ad.fetchRunData(ctx, ruleIDs...)
 	if err != nil {
@@ -298,17 +325,27 @@ func (ad *AutoDownloader) checkForNewEpisodes(ctx context.Context, isSimulation
 
 	// Default prevented, return
 	if event.DefaultPrevented {
+		runResult = runResultSkipped
 		return
 	}
 
 	// If there are no rules, return
 	if len(data.rules) == 0 {
 		ad.logger.Debug().Msg("autodownloader: No rules found")
+		runResult = runResultSkipped
 		return
 	}
 
+	// Remove the files replaced by upgrades that have been downloaded
+	if !isSimulation {
+		ad.completeUpgrades(data.localFileWrapper)
+	}
+
 	// Group matched torrents by rule and episode
 	groupedCandidates := ad.groupTorrentCandidates(data)
+	if !isSimulation {
+		observeCandidates(groupedCandidates, data.rules)
+	}
 
 	// Select best candidates and download
 	downloaded := ad.selectAndDownloadBestCandidates(isSimulation, groupedCandidates, data.rules, data.profiles)
@@ -317,8 +354,15 @@ func (ad *AutoDownloader) checkForNewEpisodes(ctx context.Context, isSimulation
 	delayedDownloaded := ad.downloadDelayedItems(isSimulation)
 	downloaded += delayedDownloaded
 
+	// Download batches for the missing episodes of finished shows
+	if ad.settings.EnableBatchFallback {
+		downloaded += ad.downloadMissingBatches(ctx, isSimulation, data)
+	}
+
 	// Notify user
 	ad.notifyDownloadResults(downloaded)
+
+	runResult = runResultSuccess
 }
 
 // runData holds all data needed for checking new episodes
@@ -415,6 +459,9 @@ func (ad *AutoDownloader) fetchRunData(ctx context.Context, ruleIDs ...uint) (*r
 type Candidate struct {
 	Torrent *NormalizedTorrent
 	Score   int
+	// upgrade is set if the episode is in the library and the torrent is a better release
+	upgrade *upgradeTarget
+	quality releaseQuality
 }
 
 // groupTorrentCandidates groups torrents by rule ID and episode number
@@ -438,6 +485,14 @@ func (ad *AutoDownloader) groupTorrentCandidates(data *runData) map[uint]map[int
 		// Get all queued items from this media
 		ruleQueuedItems, _ := ad.database.GetAutoDownloaderItemByMediaId(listEntry.GetMedia().GetID())
 
+		// Episodes in the library that can be replaced by a better release
+		upgradeSettings := ad.getUpgradeSettings(ruleProfiles)
+		var upgrades []*models.AutoDownloaderUpgrade
+		if upgradeSettings.enabled {
+			upgrades, _ = ad.database.GetAutoDownloaderUpgradesByMediaId(rule.MediaId)
+		}
+		upgradeTargets := make(map[int]*upgradeTarget)
+
 		// Initialize map for this rule
 		groupedCandidates[rule.DbID] = make(map[int][]*Candidate)
 
@@ -454,9 +509,20 @@ func (ad *AutoDownloader) groupTorrentCandidates(data *runData) map[uint]map[int
 				continue
 			}
 
-			// Skip if already in library or queue (not delayed)
+			// Skip if already in library or queue (not delayed), unless the torrent is a better release
+			var target *upgradeTarget
 			if ad.isEpisodeAlreadyHandled(episode, rule.CustomEpisodeNumberAbsoluteOffset, rule.DbID, rule.MediaId, data.localFileWrapper, ruleQueuedItems) {
-				continue
+				if !upgradeSettings.enabled {
+					continue
+				}
+				var ok bool
+				if target, ok = upgradeTargets[episode]; !ok {
+					target = ad.findUpgradeTarget(episode, rule, ruleProfiles, listEntry.GetProgressSafe(), data.localFileWrapper, ruleQueuedItems, upgrades, upgradeSettings)
+					upgradeTargets[episode] = target
+				}
+				if target == nil {
+					continue
+				}
 			}
 
 			// Calculate score
@@ -467,6 +533,14 @@ func (ad *AutoDownloader) groupTorrentCandidates(data *runData) map[uint]map[int
 				continue
 			}
 
+			var quality releaseQuality
+			if target != nil {
+				quality = ad.getReleaseQuality(t.Name, t.ParsedData, score, rule, ruleProfiles)
+				if quality.compare(target.quality) <= 0 {
+					continue
+				}
+			}
+
 			// Add to candidates
 			if groupedCandidates[rule.DbID][episode] == nil {
 				groupedCandidates[rule.DbID][episode] = make([]*Candidate, 0)
@@ -474,6 +548,8 @@ func (ad *AutoDownloader) groupTorrentCandidates(data *runData) map[uint]map[int
 			groupedCandidates[rule.DbID][episode] = append(groupedCandidates[rule.DbID][episode], &Candidate{
 				Torrent: t,
 				Score:   score,
+				upgrade: target,
+				quality: quality,
 			})
 		}
 	}
@@ -688,6 +764,11 @@ func (ad *AutoDownloader) processEpisodeCandidate(
 		return false
 	}
 
+	// Replace the episode in the library with the best release
+	if candidates[0].upgrade != nil {
+		return ad.handleUpgrade(isSimulation, ad.selectBestUpgradeCandidate(candidates), rule, episode)
+	}
+
 	// 1. Identify best candidate
 	bestCandidate := ad.selectBestCandidate(candidates)
 	if bestCandidate == nil {
@@ -1208,6 +1289,8 @@ downloadScope:
 		ad.logger.Info().Str("name", t.Name).Bool("downloaded", downloaded).Msg("autodownloader: Added item to queue")
 	}
 
+	observeDownload(rule, downloaded)
+
 	// Event
 	afterEvent := &AutoDownloaderAfterDownloadTorrentEvent{
 		Torrent: t,
@@ -0,0 +1,389 @@
+package autodownloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"seanime/internal/api/anilist"
+	"seanime/internal/database/models"
+	"seanime/internal/events"
+	"seanime/internal/library/anime"
+	"seanime/internal/torrent_clients/torrent_client"
+	"seanime/internal/torrents/torrent"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/5rahim/habari"
+	"github.com/samber/lo"
+)
+
+const (
+	// A rule whose batch search found nothing is searched again after this delay, doubled after each failure
+	batchSearchRetryDelay    = 6 * time.Hour
+	batchSearchMaxRetryDelay = 7 * 24 * time.Hour
+)
+
+type batchSearchFailure struct {
+	count   int
+	retryAt time.Time
+}
+
+// downloadMissingBatches looks for batches of finished shows whose episodes are missing from the library.
+// Episodes of airing shows are handled one by one from the latest torrents, but the latest torrents
+// don't contain the episodes of shows that finished airing before the rule was created.
+// Rules whose search found no batch are searched again later, see [batchSearchRetryDelay].
+// Returns the number of episodes downloaded
+func (ad *AutoDownloader) downloadMissingBatches(ctx context.Context, isSimulation bool, data *runData) int {
+	downloaded := 0
+
+	for _, rule := range data.rules {
+		if rule.MediaId == 0 || rule.Destination == "" {
+			continue
+		}
+
+		listEntry, ok := ad.getRuleListEntry(rule)
+		if !ok || listEntry.GetMedia() == nil {
+			continue
+		}
+		media := listEntry.GetMedia()
+		if media.GetStatus() == nil || *media.GetStatus() != anilist.MediaStatusFinished || media.IsMovieOrSingleEpisode() {
+			continue
+		}
+
+		queuedItems, _ := ad.database.GetAutoDownloaderItemByMediaId(rule.MediaId)
+		missing := ad.getMissingEpisodes(rule, listEntry, data.localFileWrapper, queuedItems)
+		if len(missing) == 0 {
+			continue
+		}
+
+		if !isSimulation && !ad.canSearchBatch(rule.DbID) {
+			continue
+		}
+
+		ruleProfiles := ad.getRuleProfiles(rule, data.profiles)
+
+		candidates := ad.searchBatchCandidates(ctx, rule, media, ruleProfiles, data.existingTorrents)
+		// Batches that were queued but not downloaded
+		candidates = lo.Filter(candidates, func(c *Candidate, _ int) bool {
+			return !lo.ContainsBy(queuedItems, func(item *models.AutoDownloaderItem) bool {
+				return item.RuleID == rule.DbID && strings.EqualFold(item.Hash, c.Torrent.InfoHash)
+			})
+		})
+		if len(candidates) == 0 {
+			ad.logger.Debug().Str("title", rule.ComparisonTitle).Ints("missing", missing).Msg("autodownloader: No batch found for missing episodes")
+			if !isSimulation {
+				ad.recordBatchSearchFailure(rule.DbID)
+			}
+			continue
+		}
+		ad.resetBatchSearchFailures(rule.DbID)
+
+		best := ad.selectBestCandidate(candidates)
+
+		ad.logger.Debug().
+			Str("name", best.Torrent.Name).
+			Int("score", best.Score).
+			Str("rule", rule.ComparisonTitle).
+			Ints("missing", missing).
+			Msg("autodownloader: Found batch for missing episodes")
+
+		if ad.downloadBatch(ctx, isSimulation, best, rule, media, missing, data.localFileWrapper) {
+			downloaded += len(missing)
+		}
+	}
+
+	return downloaded
+}
+
+// canSearchBatch returns false if the last batch searches of the rule found nothing and the retry delay hasn't passed.
+func (ad *AutoDownloader) canSearchBatch(ruleId uint) bool {
+	ad.batchSearchMu.Lock()
+	defer ad.batchSearchMu.Unlock()
+
+	failure, ok := ad.batchSearchFailures[ruleId]
+	return !ok || time.Now().After(failure.retryAt)
+}
+
+func (ad *AutoDownloader) recordBatchSearchFailure(ruleId uint) {
+	ad.batchSearchMu.Lock()
+	defer ad.batchSearchMu.Unlock()
+
+	if ad.batchSearchFailures == nil {
+		ad.batchSearchFailures = make(map[uint]*batchSearchFailure)
+	}
+	failure, ok := ad.batchSearchFailures[ruleId]
+	if !ok {
+		failure = &batchSearchFailure{}
+		ad.batchSearchFailures[ruleId] = failure
+	}
+	failure.count++
+
+	// 6h, 12h, 24h... up to a week
+	delay := min(batchSearchRetryDelay<<min(failure.count-1, 5), batchSearchMaxRetryDelay)
+	failure.retryAt = time.Now().Add(delay)
+}
+
+func (ad *AutoDownloader) resetBatchSearchFailures(ruleId uint) {
+	ad.batchSearchMu.Lock()
+	defer ad.batchSearchMu.Unlock()
+	delete(ad.batchSearchFailures, ruleId)
+}
+
+// getMissingEpisodes returns the episodes of the rule that are not in the library, queued or watched.
+func (ad *AutoDownloader) getMissingEpisodes(rule *anime.AutoDownloaderRule, listEntry *anilist.AnimeListEntry, lfWrapper *anime.LocalFileWrapper, queuedItems []*models.AutoDownloaderItem) []int {
+	episodes := make([]int, 0)
+	switch rule.EpisodeType {
+	case anime.AutoDownloaderRuleEpisodeSelected:
+		episodes = append(episodes, rule.EpisodeNumbers...)
+	default:
+		for ep := 1; ep <= listEntry.GetMedia().GetTotalEpisodeCount(); ep++ {
+			episodes = append(episodes, ep)
+		}
+	}
+
+	missing := make([]int, 0)
+	for _, ep := range episodes {
+		if ep <= 0 || ep > listEntry.GetMedia().GetTotalEpisodeCount() {
+			continue
+		}
+		if ad.isEpisodeAlreadyHandled(ep, rule.CustomEpisodeNumberAbsoluteOffset, rule.DbID, rule.MediaId, lfWrapper, queuedItems) {
+			continue
+		}
+		missing = append(missing, ep)
+	}
+	slices.Sort(missing)
+	return lo.Uniq(missing)
+}
+
+// searchBatchCandidates runs a batch search on the providers of the rule and returns the batches that follow the rule and its profiles.
+func (ad *AutoDownloader) searchBatchCandidates(
+	ctx context.Context,
+	rule *anime.AutoDownloaderRule,
+	media *anilist.BaseAnime,
+	ruleProfiles []*anime.AutoDownloaderProfile,
+	existingTorrents []*torrent_client.Torrent,
+) []*Candidate {
+	ret := make([]*Candidate, 0)
+
+	releaseGroups := ad.inheritReleaseGroupsFromProfiles(rule, ruleProfiles)
+	resolutions := ad.inheritResolutionsFromProfiles(rule, ruleProfiles)
+
+	for _, providerId := range ad.getRuleProviderIDs(rule, ruleProfiles) {
+		providerExtension, found := ad.torrentRepository.GetAnimeProviderExtension(providerId)
+		if !found || !providerExtension.GetProvider().GetSettings().CanSmartSearch {
+			continue
+		}
+
+		data, err := ad.torrentRepository.SearchAnime(ctx, torrent.AnimeSearchOptions{
+			Provider:     providerId,
+			Type:         torrent.AnimeSearchTypeSmart,
+			Media:        media,
+			Batch:        true,
+			SkipPreviews: true,
+		})
+		if err != nil {
+			ad.logger.Warn().Err(err).Str("provider", providerId).Msg("autodownloader: Batch search failed")
+			continue
+		}
+
+		for _, at := range data.Torrents {
+			if at.Provider == "" {
+				at.Provider = providerId
+			}
+			t := &NormalizedTorrent{
+				AnimeTorrent: at,
+				ParsedData:   habari.Parse(at.Name),
+				ExtensionID:  providerId,
+			}
+			if t.InfoHash == "" || !isBatchTorrent(t) || ad.isTorrentAlreadyDownloaded(t, existingTorrents) {
+				continue
+			}
+			if !ad.isBatchFollowingRule(t, rule, releaseGroups, resolutions, ruleProfiles) {
+				continue
+			}
+
+			score, requiredMinScore := ad.calculateCandidateScore(t, ruleProfiles)
+			if score < requiredMinScore {
+				continue
+			}
+			ret = append(ret, &Candidate{
+				Torrent: t,
+				Score:   score,
+			})
+		}
+	}
+
+	return lo.UniqBy(ret, func(c *Candidate) string {
+		return c.Torrent.InfoHash
+	})
+}
+
+// isBatchFollowingRule checks the filters of the rule and its profiles.
+// The title and episode are not checked since the smart search only returns batches of the media.
+func (ad *AutoDownloader) isBatchFollowingRule(t *NormalizedTorrent, rule *anime.AutoDownloaderRule, releaseGroups []string, resolutions []string, ruleProfiles []*anime.AutoDownloaderProfile) bool {
+	if !ad.isReleaseGroupMatch(t.ParsedData.ReleaseGroup, releaseGroups) {
+		return false
+	}
+	if !ad.isResolutionMatch(t.ParsedData.VideoResolution, resolutions) {
+		return false
+	}
+	if !ad.isAdditionalTermsMatch(t.Name, rule) || !ad.isExcludedTermsMatch(t.Name, rule) {
+		return false
+	}
+	if !ad.isConstraintsMatch(t, rule) {
+		return false
+	}
+	for _, p := range ruleProfiles {
+		if !ad.isProfileValidChecks(t, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func isBatchTorrent(t *NormalizedTorrent) bool {
+	return t.IsBatch || len(t.ParsedData.EpisodeNumber) != 1
+}
+
+// getRuleProviderIDs returns the providers of the rule, the providers of its profiles or the default provider.
+func (ad *AutoDownloader) getRuleProviderIDs(rule *anime.AutoDownloaderRule, ruleProfiles []*anime.AutoDownloaderProfile) []string {
+	if len(rule.Providers) > 0 {
+		return rule.Providers
+	}
+	ret := make([]string, 0)
+	for _, p := range ruleProfiles {
+		ret = append(ret, p.Providers...)
+	}
+	if len(ret) > 0 {
+		return lo.Uniq(ret)
+	}
+	if defaultProv, found := ad.torrentRepository.GetAnimeProviderExtensionOrDefault(ad.settings.Provider); found {
+		ret = append(ret, defaultProv.GetID())
+	}
+	return ret
+}
+
+// downloadBatch adds the batch to the torrent client, selecting only the missing episodes if the library already contains some of them.
+// If the batch can't be downloaded, it's queued as a single item so that it can be downloaded manually.
+// Returns true if the batch was downloaded
+func (ad *AutoDownloader) downloadBatch(
+	ctx context.Context,
+	isSimulation bool,
+	candidate *Candidate,
+	rule *anime.AutoDownloaderRule,
+	media *anilist.BaseAnime,
+	missing []int,
+	lfWrapper *anime.LocalFileWrapper,
+) bool {
+	t := candidate.Torrent
+
+	if isSimulation {
+		ad.simulationResults = append(ad.simulationResults, &SimulationResult{
+			RuleID:      rule.DbID,
+			MediaID:     rule.MediaId,
+			Episodes:    missing,
+			Link:        t.Link,
+			Hash:        t.InfoHash,
+			TorrentName: t.Name,
+			Score:       candidate.Score,
+			ExtensionID: t.ExtensionID,
+			IsBatch:     true,
+		})
+		return true
+	}
+
+	providerExtension, found := ad.torrentRepository.GetAnimeProviderExtension(t.ExtensionID)
+	if !found {
+		ad.logger.Error().Str("extensionId", t.ExtensionID).Msg("autodownloader: Provider extension not found")
+		return false
+	}
+
+	magnet, err := t.GetMagnet(providerExtension.GetProvider())
+	if err != nil {
+		magnet = fmt.Sprintf("magnet:?xt=urn:btih:%s", t.InfoHash)
+	}
+
+	// Only download the missing files if the library contains some episodes
+	_, hasLocalFiles := lfWrapper.GetLocalEntryById(rule.MediaId)
+	needsSelection := hasLocalFiles || len(missing) < media.GetTotalEpisodeCount()
+
+	downloaded := false
+	// Debrid services download the whole batch, the batch is queued instead
+	if ad.settings.DownloadAutomatically && !ad.settings.UseDebrid && ad.torrentClientRepository != nil && ad.torrentClientRepository.Start() {
+		if ad.torrentClientRepository.TorrentExists(t.InfoHash) {
+			return false
+		}
+
+		if needsSelection {
+			completeAnime, err := ad.getCompleteAnime(ctx, media)
+			if err == nil {
+				err = ad.torrentClientRepository.SmartSelect(&torrent_client.SmartSelectParams{
+					Torrent:          t.AnimeTorrent,
+					EpisodeNumbers:   missing,
+					Media:            completeAnime,
+					Destination:      rule.Destination,
+					ShouldAddTorrent: true,
+					PlatformRef:      ad.platformRef,
+				})
+			}
+			if err != nil {
+				ad.logger.Warn().Err(err).Str("name", t.Name).Msg("autodownloader: Failed to select missing episodes, batch will be queued")
+			}
+			downloaded = err == nil
+		} else {
+			err = ad.torrentClientRepository.AddMagnets([]string{magnet}, rule.Destination)
+			if err != nil {
+				ad.logger.Warn().Err(err).Str("name", t.Name).Msg("autodownloader: Failed to add batch, batch will be queued")
+			}
+			downloaded = err == nil
+		}
+	}
+
+	ad.wsEventManager.SendEvent(events.AutoDownloaderItemAdded, t.Name)
+
+	torrentData, err := json.Marshal(t)
+	if err != nil {
+		torrentData = nil
+	}
+
+	newItem := func(episode int) *models.AutoDownloaderItem {
+		return &models.AutoDownloaderItem{
+			RuleID:      rule.DbID,
+			MediaID:     rule.MediaId,
+			Episode:     episode,
+			Link:        t.Link,
+			Hash:        t.InfoHash,
+			Magnet:      magnet,
+			TorrentName: t.Name,
+			Downloaded:  downloaded,
+			Score:       candidate.Score,
+			TorrentData: torrentData,
+		}
+	}
+
+	if downloaded {
+		// Record each missing episode so that they are not downloaded again
+		for _, ep := range missing {
+			_ = ad.database.InsertAutoDownloaderItem(newItem(ep))
+		}
+	} else {
+		// The other episodes stay missing until the batch is downloaded, the queued batch isn't picked again
+		_ = ad.database.InsertAutoDownloaderItem(newItem(missing[0]))
+	}
+
+	observeDownload(rule, downloaded)
+
+	return downloaded
+}
+
+func (ad *AutoDownloader) getCompleteAnime(ctx context.Context, media *anilist.BaseAnime) (*anilist.CompleteAnime, error) {
+	if ad.platformRef == nil || ad.platformRef.IsAbsent() {
+		return nil, fmt.Errorf("platform not set")
+	}
+	completeAnime, err := ad.platformRef.Get().GetAnimeWithRelations(ctx, media.GetID())
+	if err != nil {
+		return media.ToCompleteAnime(), nil
+	}
+	return completeAnime, nil
+}
@@ -0,0 +1,94 @@
+package autodownloader
+
+import (
+	"seanime/internal/api/anilist"
+	"seanime/internal/database/models"
+	hibiketorrent "seanime/internal/extension/hibike/torrent"
+	"seanime/internal/library/anime"
+	"testing"
+	"time"
+
+	"github.com/5rahim/habari"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMissingEpisodes(t *testing.T) {
+	ad := &AutoDownloader{}
+
+	listEntry := &anilist.AnimeListEntry{
+		Progress: lo.ToPtr(2),
+		Media: &anilist.BaseAnime{
+			ID:       1,
+			Episodes: lo.ToPtr(6),
+			Status:   lo.ToPtr(anilist.MediaStatusFinished),
+		},
+	}
+
+	lfWrapper := anime.NewLocalFileWrapper([]*anime.LocalFile{
+		{Path: "/anime/Show/ep3.mkv", MediaId: 1, Metadata: &anime.LocalFileMetadata{Episode: 3, Type: anime.LocalFileTypeMain}},
+	})
+	queuedItems := []*models.AutoDownloaderItem{{RuleID: 1, MediaID: 1, Episode: 5}}
+
+	rule := &anime.AutoDownloaderRule{DbID: 1, MediaId: 1, EpisodeType: anime.AutoDownloaderRuleEpisodeRecent}
+	// Watched episodes are only excluded when the collection is set
+	require.Equal(t, []int{1, 2, 4, 6}, ad.getMissingEpisodes(rule, listEntry, lfWrapper, queuedItems))
+
+	rule.EpisodeType = anime.AutoDownloaderRuleEpisodeSelected
+	rule.EpisodeNumbers = []int{3, 4, 4, 7}
+	require.Equal(t, []int{4}, ad.getMissingEpisodes(rule, listEntry, lfWrapper, queuedItems))
+}
+
+func TestIsBatchFollowingRule(t *testing.T) {
+	ad := &AutoDownloader{}
+
+	newTorrent := func(name string, isBatch bool) *NormalizedTorrent {
+		return &NormalizedTorrent{
+			AnimeTorrent: &hibiketorrent.AnimeTorrent{Name: name, IsBatch: isBatch, Seeders: 10},
+			ParsedData:   habari.Parse(name),
+		}
+	}
+
+	require.True(t, isBatchTorrent(newTorrent("[SubsPlease] Frieren (01-28) (1080p) [Batch]", false)))
+	require.True(t, isBatchTorrent(newTorrent("[SubsPlease] Frieren (1080p)", true)))
+	require.False(t, isBatchTorrent(newTorrent("[SubsPlease] Frieren - 05 (1080p)", false)))
+
+	rule := &anime.AutoDownloaderRule{ExcludeTerms: []string{"HEVC"}}
+	releaseGroups := []string{"SubsPlease"}
+	resolutions := []string{"1080p"}
+
+	require.True(t, ad.isBatchFollowingRule(newTorrent("[SubsPlease] Frieren (01-28) (1080p) [Batch]", false), rule, releaseGroups, resolutions, nil))
+	require.False(t, ad.isBatchFollowingRule(newTorrent("[SubsPlease] Frieren (01-28) (720p) [Batch]", false), rule, releaseGroups, resolutions, nil))
+	require.False(t, ad.isBatchFollowingRule(newTorrent("[Erai-raws] Frieren (01-28) (1080p) [Batch]", false), rule, releaseGroups, resolutions, nil))
+	require.False(t, ad.isBatchFollowingRule(newTorrent("[SubsPlease] Frieren (01-28) (1080p) [HEVC] [Batch]", false), rule, releaseGroups, resolutions, nil))
+
+	profiles := []*anime.AutoDownloaderProfile{{MinSeeders: 20}}
+	require.False(t, ad.isBatchFollowingRule(newTorrent("[SubsPlease] Frieren (01-28) (1080p) [Batch]", false), rule, releaseGroups, resolutions, profiles))
+}
+
+func TestBatchSearchBackoff(t *testing.T) {
+	ad := &AutoDownloader{}
+
+	require.True(t, ad.canSearchBatch(1))
+
+	ad.recordBatchSearchFailure(1)
+	require.False(t, ad.canSearchBatch(1))
+	require.True(t, ad.canSearchBatch(2))
+	require.WithinDuration(t, time.Now().Add(batchSearchRetryDelay), ad.batchSearchFailures[1].retryAt, time.Minute)
+
+	// The delay doubles after each failure
+	ad.recordBatchSearchFailure(1)
+	require.WithinDuration(t, time.Now().Add(2*batchSearchRetryDelay), ad.batchSearchFailures[1].retryAt, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		ad.recordBatchSearchFailure(1)
+	}
+	require.WithinDuration(t, time.Now().Add(batchSearchMaxRetryDelay), ad.batchSearchFailures[1].retryAt, time.Minute)
+
+	// Searched again once the delay passed
+	ad.batchSearchFailures[1].retryAt = time.Now().Add(-time.Minute)
+	require.True(t, ad.canSearchBatch(1))
+
+	ad.resetBatchSearchFailures(1)
+	require.NotContains(t, ad.batchSearchFailures, uint(1))
+}
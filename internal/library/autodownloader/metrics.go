@@ -0,0 +1,67 @@
+package autodownloader
+
+import (
+	"seanime/internal/library/anime"
+	"seanime/internal/metrics"
+	"strconv"
+	"time"
+)
+
+const (
+	runResultSuccess = "success"
+	runResultSkipped = "skipped"
+	runResultError   = "error"
+)
+
+var (
+	runsCounter = metrics.NewCounterVec(
+		"autodownloader_runs_total",
+		"Number of auto-downloader runs, by result. Simulations are not counted.",
+		"result",
+	)
+	runDurationHistogram = metrics.NewHistogramVec(
+		"autodownloader_run_duration_seconds",
+		"Duration of auto-downloader runs.",
+		nil,
+	)
+	candidatesCounter = metrics.NewCounterVec(
+		"autodownloader_candidates_total",
+		"Number of torrents matching an auto-downloader rule.",
+		"rule_id", "media_id",
+	)
+	downloadsCounter = metrics.NewCounterVec(
+		"autodownloader_downloads_total",
+		"Number of torrents added by an auto-downloader rule, by status. Queued torrents are added to the queue instead of the torrent client.",
+		"rule_id", "media_id", "status",
+	)
+)
+
+func observeRun(result string, startTime time.Time) {
+	runsCounter.With(result).Inc()
+	runDurationHistogram.With().Observe(time.Since(startTime).Seconds())
+}
+
+func observeCandidates(groupedCandidates map[uint]map[int][]*Candidate, rules []*anime.AutoDownloaderRule) {
+	for _, rule := range rules {
+		count := 0
+		for _, candidates := range groupedCandidates[rule.DbID] {
+			count += len(candidates)
+		}
+		if count == 0 {
+			continue
+		}
+		candidatesCounter.With(ruleLabels(rule)...).Add(float64(count))
+	}
+}
+
+func observeDownload(rule *anime.AutoDownloaderRule, downloaded bool) {
+	status := "queued"
+	if downloaded {
+		status = "downloaded"
+	}
+	downloadsCounter.With(append(ruleLabels(rule), status)...).Inc()
+}
+
+func ruleLabels(rule *anime.AutoDownloaderRule) []string {
+	return []string{strconv.FormatUint(uint64(rule.DbID), 10), strconv.Itoa(rule.MediaId)}
+}
@@ -0,0 +1,275 @@
+package autodownloader
+
+import (
+	"context"
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/database/models"
+	"seanime/internal/library/anime"
+	"sort"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const (
+	// airingWindow is how long after an episode airs its rule is checked more often
+	airingWindow = 6 * time.Hour
+	// airingPollInterval is the interval of the rule-scoped checks during an airing window
+	airingPollInterval = 5 * time.Minute
+	// airingLookahead is how far ahead upcoming episodes are listed in the plan
+	airingLookahead = 24 * time.Hour
+	// backoffThreshold is how far the next episode must be for the full checks to back off
+	backoffThreshold = 6 * time.Hour
+	backoffFactor    = 3
+	maxBackoff       = 3 * time.Hour
+	// airingScheduleTTL is how long the airing schedule is cached
+	airingScheduleTTL = time.Hour
+)
+
+type (
+	// PollingPlan describes when the auto downloader checks for new episodes.
+	PollingPlan struct {
+		// Enabled is true if the plan follows the airing schedule
+		Enabled bool `json:"enabled"`
+		// IsBackingOff is true if no episode is due soon and full checks are less frequent
+		IsBackingOff bool `json:"isBackingOff"`
+		// FullCheckInterval is the interval of the checks of all rules, in minutes
+		FullCheckInterval int       `json:"fullCheckInterval"`
+		LastFullCheckAt   time.Time `json:"lastFullCheckAt"`
+		NextFullCheckAt   time.Time `json:"nextFullCheckAt"`
+		// NextCheckAt is the time of the next check, either a full check or a rule-scoped check
+		NextCheckAt time.Time `json:"nextCheckAt"`
+		// DueRuleIDs are the rules checked by the next rule-scoped check
+		DueRuleIDs []uint          `json:"dueRuleIds"`
+		Windows    []*AiringWindow `json:"windows"`
+	}
+
+	// AiringWindow is an episode of a ruled show that recently aired or will air soon.
+	AiringWindow struct {
+		RuleID   uint      `json:"ruleId"`
+		MediaID  int       `json:"mediaId"`
+		Title    string    `json:"title"`
+		Episode  int       `json:"episode"`
+		AiringAt time.Time `json:"airingAt"`
+		// WindowEnd is the time after which the rule is no longer checked more often
+		WindowEnd time.Time `json:"windowEnd"`
+		IsDue     bool      `json:"isDue"`
+	}
+)
+
+// GetPollingPlan returns the current polling plan.
+func (ad *AutoDownloader) GetPollingPlan(ctx context.Context) *PollingPlan {
+	return ad.refreshPollingPlan(ctx, time.Now())
+}
+
+// refreshPollingPlan computes the polling plan from the cached airing schedule.
+func (ad *AutoDownloader) refreshPollingPlan(ctx context.Context, now time.Time) *PollingPlan {
+	ad.mu.Lock()
+	settings := ad.settings
+	ad.mu.Unlock()
+
+	baseInterval := getBaseInterval(settings)
+
+	ad.pollingMu.Lock()
+	lastFullCheck := ad.lastFullCheckAt
+	ad.pollingMu.Unlock()
+	if lastFullCheck.IsZero() {
+		lastFullCheck = now
+	}
+
+	var scheduleItems []*anime.ScheduleItem
+	var rules []*anime.AutoDownloaderRule
+	isHandled := func(rule *anime.AutoDownloaderRule, episode int) bool { return false }
+
+	if settings != nil && settings.EnableAiringSchedule {
+		scheduleItems = ad.getAiringSchedule(ctx, now)
+		rules, _ = db_bridge.GetAutoDownloaderRules(ad.database)
+
+		lfs, _, err := db_bridge.GetLocalFiles(ad.database)
+		if err == nil {
+			lfWrapper := anime.NewLocalFileWrapper(lfs)
+			queuedItems, _ := ad.database.GetAutoDownloaderItems()
+			isHandled = func(rule *anime.AutoDownloaderRule, episode int) bool {
+				return ad.isEpisodeAlreadyHandled(episode, rule.CustomEpisodeNumberAbsoluteOffset, rule.DbID, rule.MediaId, lfWrapper, queuedItems)
+			}
+		}
+	}
+
+	return planPolling(settings != nil && settings.EnableAiringSchedule, rules, scheduleItems, isHandled, now, lastFullCheck, baseInterval)
+}
+
+// getAiringSchedule returns the airing schedule of the collection, fetching it if the cached one expired.
+func (ad *AutoDownloader) getAiringSchedule(ctx context.Context, now time.Time) []*anime.ScheduleItem {
+	ad.pollingMu.Lock()
+	defer ad.pollingMu.Unlock()
+
+	if ad.airingSchedule != nil && now.Sub(ad.airingScheduleFetchedAt) < airingScheduleTTL {
+		return ad.airingSchedule
+	}
+
+	collection, ok := ad.animeCollection.Get()
+	if !ok || collection == nil || ad.platformRef == nil || ad.platformRef.IsAbsent() || ad.isOfflineRef.Get() {
+		return ad.airingSchedule
+	}
+
+	schedule, err := ad.platformRef.Get().GetAnimeAiringSchedule(ctx)
+	if err != nil {
+		ad.logger.Warn().Err(err).Msg("autodownloader: Failed to fetch airing schedule")
+		// Retry later without hammering the API
+		ad.airingScheduleFetchedAt = now.Add(-airingScheduleTTL + airingPollInterval)
+		return ad.airingSchedule
+	}
+
+	ad.airingSchedule = anime.GetScheduleItems(schedule, collection)
+	ad.airingScheduleFetchedAt = now
+	return ad.airingSchedule
+}
+
+// invalidateAiringSchedule makes the next plan refetch the airing schedule.
+func (ad *AutoDownloader) invalidateAiringSchedule() {
+	ad.pollingMu.Lock()
+	defer ad.pollingMu.Unlock()
+	ad.airingScheduleFetchedAt = time.Time{}
+}
+
+func (ad *AutoDownloader) setLastFullCheck(t time.Time) {
+	ad.pollingMu.Lock()
+	defer ad.pollingMu.Unlock()
+	ad.lastFullCheckAt = t
+}
+
+// runScheduledCheck runs a full check if it is due, or a check of the rules whose episode is due.
+func (ad *AutoDownloader) runScheduledCheck(ctx context.Context) {
+	now := time.Now()
+	plan := ad.refreshPollingPlan(ctx, now)
+
+	if !now.Before(plan.NextFullCheckAt) {
+		ad.setLastFullCheck(now)
+		ad.checkForNewEpisodes(ctx, false)
+		return
+	}
+
+	if len(plan.DueRuleIDs) > 0 {
+		ad.logger.Debug().Interface("rules", plan.DueRuleIDs).Msg("autodownloader: Checking rules with an episode due")
+		ad.checkForNewEpisodes(ctx, false, plan.DueRuleIDs...)
+	}
+}
+
+// getNextCheckDelay returns the time until the next scheduled check.
+func (ad *AutoDownloader) getNextCheckDelay(ctx context.Context) time.Duration {
+	now := time.Now()
+	plan := ad.refreshPollingPlan(ctx, now)
+	return max(plan.NextCheckAt.Sub(now), time.Second)
+}
+
+// getBaseInterval returns the user-defined interval if it's greater or equal to 15 minutes.
+func getBaseInterval(settings *models.AutoDownloaderSettings) time.Duration {
+	interval := 20
+	if settings != nil && settings.Interval >= 15 {
+		interval = settings.Interval
+	}
+	return time.Duration(interval) * time.Minute
+}
+
+// planPolling returns the polling plan.
+//   - Full checks run at the base interval, or less often if no episode of a ruled show airs soon.
+//   - Rules whose episode aired in the last airingWindow and is not in the library are checked every airingPollInterval.
+//   - If nothing is due, the next check is moved to the next airing time.
+func planPolling(
+	enabled bool,
+	rules []*anime.AutoDownloaderRule,
+	scheduleItems []*anime.ScheduleItem,
+	isHandled func(rule *anime.AutoDownloaderRule, episode int) bool,
+	now time.Time,
+	lastFullCheck time.Time,
+	baseInterval time.Duration,
+) *PollingPlan {
+	plan := &PollingPlan{
+		Enabled:         enabled,
+		LastFullCheckAt: lastFullCheck,
+		DueRuleIDs:      make([]uint, 0),
+		Windows:         make([]*AiringWindow, 0),
+	}
+
+	if !enabled {
+		plan.FullCheckInterval = int(baseInterval.Minutes())
+		plan.NextFullCheckAt = lastFullCheck.Add(baseInterval)
+		plan.NextCheckAt = plan.NextFullCheckAt
+		return plan
+	}
+
+	itemsByMediaId := lo.GroupBy(scheduleItems, func(item *anime.ScheduleItem) int {
+		return item.MediaId
+	})
+
+	var nextAiring time.Time
+	for _, rule := range rules {
+		if !rule.Enabled || rule.MediaId == 0 {
+			continue
+		}
+		for _, item := range itemsByMediaId[rule.MediaId] {
+			if rule.EpisodeType == anime.AutoDownloaderRuleEpisodeSelected && !lo.Contains(rule.EpisodeNumbers, item.EpisodeNumber) {
+				continue
+			}
+			windowEnd := item.DateTime.Add(airingWindow)
+			if !now.Before(windowEnd) || item.DateTime.After(now.Add(airingLookahead)) {
+				continue
+			}
+
+			window := &AiringWindow{
+				RuleID:    rule.DbID,
+				MediaID:   rule.MediaId,
+				Title:     item.Title,
+				Episode:   item.EpisodeNumber,
+				AiringAt:  item.DateTime,
+				WindowEnd: windowEnd,
+			}
+
+			if item.DateTime.After(now) {
+				if nextAiring.IsZero() || item.DateTime.Before(nextAiring) {
+					nextAiring = item.DateTime
+				}
+			} else if !isHandled(rule, item.EpisodeNumber) {
+				window.IsDue = true
+				if !lo.Contains(plan.DueRuleIDs, rule.DbID) {
+					plan.DueRuleIDs = append(plan.DueRuleIDs, rule.DbID)
+				}
+			} else {
+				// Already downloaded
+				continue
+			}
+
+			plan.Windows = append(plan.Windows, window)
+		}
+	}
+
+	sort.Slice(plan.Windows, func(i, j int) bool {
+		return plan.Windows[i].AiringAt.Before(plan.Windows[j].AiringAt)
+	})
+	sort.Slice(plan.DueRuleIDs, func(i, j int) bool {
+		return plan.DueRuleIDs[i] < plan.DueRuleIDs[j]
+	})
+
+	fullInterval := baseInterval
+	if len(plan.DueRuleIDs) == 0 && (nextAiring.IsZero() || nextAiring.Sub(now) > backoffThreshold) {
+		fullInterval = min(baseInterval*backoffFactor, max(maxBackoff, baseInterval))
+		plan.IsBackingOff = true
+	}
+	plan.FullCheckInterval = int(fullInterval.Minutes())
+	plan.NextFullCheckAt = lastFullCheck.Add(fullInterval)
+	plan.NextCheckAt = plan.NextFullCheckAt
+
+	if len(plan.DueRuleIDs) > 0 {
+		if t := now.Add(airingPollInterval); t.Before(plan.NextCheckAt) {
+			plan.NextCheckAt = t
+		}
+	} else if !nextAiring.IsZero() && nextAiring.Before(plan.NextCheckAt) {
+		plan.NextCheckAt = nextAiring
+	}
+
+	if plan.NextCheckAt.Before(now) {
+		plan.NextCheckAt = now
+	}
+
+	return plan
+}
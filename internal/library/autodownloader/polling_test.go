@@ -0,0 +1,86 @@
+package autodownloader
+
+import (
+	"seanime/internal/library/anime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanPolling(t *testing.T) {
+	now := time.Date(2024, 10, 5, 12, 0, 0, 0, time.UTC)
+	lastFullCheck := now.Add(-10 * time.Minute)
+	baseInterval := 20 * time.Minute
+
+	rules := []*anime.AutoDownloaderRule{
+		{DbID: 1, Enabled: true, MediaId: 1, EpisodeType: anime.AutoDownloaderRuleEpisodeRecent},
+		{DbID: 2, Enabled: true, MediaId: 2, EpisodeType: anime.AutoDownloaderRuleEpisodeRecent},
+		{DbID: 3, Enabled: false, MediaId: 3, EpisodeType: anime.AutoDownloaderRuleEpisodeRecent},
+		{DbID: 4, Enabled: true, MediaId: 4, EpisodeType: anime.AutoDownloaderRuleEpisodeRecent},
+	}
+	isHandled := func(rule *anime.AutoDownloaderRule, episode int) bool {
+		// Episode 5 of media 4 is in the library
+		return rule.MediaId == 4 && episode == 5
+	}
+
+	t.Run("Episode due", func(t *testing.T) {
+		items := []*anime.ScheduleItem{
+			{MediaId: 1, EpisodeNumber: 4, DateTime: now.Add(-7 * 24 * time.Hour)},
+			{MediaId: 1, EpisodeNumber: 5, DateTime: now.Add(-time.Hour)},
+			{MediaId: 2, EpisodeNumber: 2, DateTime: now.Add(3 * time.Hour)},
+			{MediaId: 3, EpisodeNumber: 8, DateTime: now.Add(-time.Hour)},
+			{MediaId: 4, EpisodeNumber: 5, DateTime: now.Add(-2 * time.Hour)},
+		}
+
+		plan := planPolling(true, rules, items, isHandled, now, lastFullCheck, baseInterval)
+
+		require.Equal(t, []uint{1}, plan.DueRuleIDs)
+		require.False(t, plan.IsBackingOff)
+		require.Equal(t, 20, plan.FullCheckInterval)
+		require.Equal(t, lastFullCheck.Add(baseInterval), plan.NextFullCheckAt)
+		require.Equal(t, now.Add(airingPollInterval), plan.NextCheckAt)
+
+		require.Len(t, plan.Windows, 2)
+		require.Equal(t, 5, plan.Windows[0].Episode)
+		require.True(t, plan.Windows[0].IsDue)
+		require.Equal(t, now.Add(-time.Hour).Add(airingWindow), plan.Windows[0].WindowEnd)
+		require.Equal(t, uint(2), plan.Windows[1].RuleID)
+		require.False(t, plan.Windows[1].IsDue)
+	})
+
+	t.Run("Back off", func(t *testing.T) {
+		items := []*anime.ScheduleItem{
+			{MediaId: 2, EpisodeNumber: 2, DateTime: now.Add(10 * time.Hour)},
+		}
+
+		plan := planPolling(true, rules, items, isHandled, now, lastFullCheck, baseInterval)
+
+		require.Empty(t, plan.DueRuleIDs)
+		require.True(t, plan.IsBackingOff)
+		require.Equal(t, 60, plan.FullCheckInterval)
+		require.Equal(t, lastFullCheck.Add(time.Hour), plan.NextCheckAt)
+	})
+
+	t.Run("Wake up at airing time", func(t *testing.T) {
+		items := []*anime.ScheduleItem{
+			{MediaId: 2, EpisodeNumber: 2, DateTime: now.Add(5 * time.Minute)},
+		}
+
+		plan := planPolling(true, rules, items, isHandled, now, lastFullCheck, baseInterval)
+
+		require.False(t, plan.IsBackingOff)
+		require.Equal(t, now.Add(5*time.Minute), plan.NextCheckAt)
+
+		// The rule is due once the episode aired
+		plan = planPolling(true, rules, items, isHandled, now.Add(5*time.Minute), lastFullCheck, baseInterval)
+		require.Equal(t, []uint{2}, plan.DueRuleIDs)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		plan := planPolling(false, rules, nil, isHandled, now, lastFullCheck, baseInterval)
+
+		require.Empty(t, plan.Windows)
+		require.Equal(t, lastFullCheck.Add(baseInterval), plan.NextCheckAt)
+	})
+}
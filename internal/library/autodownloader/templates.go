@@ -0,0 +1,257 @@
+package autodownloader
+
+import (
+	"cmp"
+	"errors"
+	"path/filepath"
+	"seanime/internal/api/anilist"
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/library/anime"
+	"seanime/internal/util"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+const defaultDestinationPattern = "{title}"
+
+var ErrNoAnimeCollection = errors.New("anime collection not loaded")
+
+type (
+	// RuleTemplatePlan describes the rules created and deleted by the rule templates.
+	RuleTemplatePlan struct {
+		Created []*anime.AutoDownloaderRule `json:"created"`
+		Retired []*anime.AutoDownloaderRule `json:"retired"`
+	}
+)
+
+// SyncRuleTemplates creates and retires the rules of the templates.
+// This should be run after the anime collection is refreshed.
+func (ad *AutoDownloader) SyncRuleTemplates() {
+	defer util.HandlePanicInModuleThen("autodownloader/SyncRuleTemplates", func() {})
+
+	if ad == nil {
+		return
+	}
+	plan, err := ad.ApplyRuleTemplates(false)
+	if err != nil {
+		if !errors.Is(err, ErrNoAnimeCollection) {
+			ad.logger.Error().Err(err).Msg("autodownloader: Failed to apply rule templates")
+		}
+		return
+	}
+	if len(plan.Created) > 0 || len(plan.Retired) > 0 {
+		ad.logger.Info().Int("created", len(plan.Created)).Int("retired", len(plan.Retired)).Msg("autodownloader: Applied rule templates")
+	}
+}
+
+// ApplyRuleTemplates creates rules for the entries that match the enabled templates
+// and deletes the rules of entries that no longer match their template.
+// If dryRun is true, the rules are not saved.
+func (ad *AutoDownloader) ApplyRuleTemplates(dryRun bool) (*RuleTemplatePlan, error) {
+	ad.templatesMu.Lock()
+	defer ad.templatesMu.Unlock()
+
+	collection, ok := ad.animeCollection.Get()
+	if !ok || collection == nil {
+		return nil, ErrNoAnimeCollection
+	}
+
+	templates, err := db_bridge.GetAutoDownloaderRuleTemplates(ad.database)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := db_bridge.GetAutoDownloaderRules(ad.database)
+	if err != nil {
+		return nil, err
+	}
+	libraryPath, _ := ad.database.GetLibraryPathFromSettings()
+
+	plan := planRuleTemplates(templates, rules, collection, libraryPath)
+	if dryRun {
+		return plan, nil
+	}
+
+	for _, rule := range plan.Retired {
+		if err := db_bridge.DeleteAutoDownloaderRule(ad.database, rule.DbID); err != nil {
+			return nil, err
+		}
+		ad.logger.Debug().Int("mediaId", rule.MediaId).Str("title", rule.ComparisonTitle).Msg("autodownloader: Retired rule created by template")
+	}
+	for _, rule := range plan.Created {
+		if err := db_bridge.InsertAutoDownloaderRule(ad.database, rule); err != nil {
+			return nil, err
+		}
+		ad.logger.Debug().Int("mediaId", rule.MediaId).Str("title", rule.ComparisonTitle).Msg("autodownloader: Created rule from template")
+	}
+
+	return plan, nil
+}
+
+// planRuleTemplates returns the rules to create and delete.
+// Media that already have a rule are skipped, each media gets at most one rule from the first matching template.
+// Rules of disabled or deleted templates are kept.
+func planRuleTemplates(templates []*anime.AutoDownloaderRuleTemplate, rules []*anime.AutoDownloaderRule, collection *anilist.AnimeCollection, libraryPath string) *RuleTemplatePlan {
+	plan := &RuleTemplatePlan{
+		Created: make([]*anime.AutoDownloaderRule, 0),
+		Retired: make([]*anime.AutoDownloaderRule, 0),
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].DbID < templates[j].DbID
+	})
+	templatesById := lo.SliceToMap(templates, func(t *anime.AutoDownloaderRuleTemplate) (uint, *anime.AutoDownloaderRuleTemplate) {
+		return t.DbID, t
+	})
+
+	// Retire the rules whose media no longer match
+	mediaWithRule := make(map[int]struct{})
+	for _, rule := range rules {
+		if rule.TemplateID != nil {
+			if template, ok := templatesById[*rule.TemplateID]; ok && template.Enabled {
+				entry, found := collection.GetListEntryFromAnimeId(rule.MediaId)
+				if !found || !templateMatches(template, entry) {
+					plan.Retired = append(plan.Retired, rule)
+					continue
+				}
+			}
+		}
+		mediaWithRule[rule.MediaId] = struct{}{}
+	}
+
+	entries := make([]*anilist.AnimeListEntry, 0)
+	if collection.MediaListCollection != nil {
+		for _, l := range collection.MediaListCollection.Lists {
+			entries = append(entries, l.GetEntries()...)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].GetMedia().GetID() < entries[j].GetMedia().GetID()
+	})
+
+	for _, template := range templates {
+		if !template.Enabled {
+			continue
+		}
+		for _, entry := range entries {
+			mediaId := entry.GetMedia().GetID()
+			if _, ok := mediaWithRule[mediaId]; ok || mediaId == 0 {
+				continue
+			}
+			if !templateMatches(template, entry) {
+				continue
+			}
+			mediaWithRule[mediaId] = struct{}{}
+			plan.Created = append(plan.Created, newRuleFromTemplate(template, entry.GetMedia(), libraryPath))
+		}
+	}
+
+	return plan
+}
+
+// templateMatches returns true if the entry matches all the criteria of the template.
+func templateMatches(t *anime.AutoDownloaderRuleTemplate, entry *anilist.AnimeListEntry) bool {
+	media := entry.GetMedia()
+	if media == nil {
+		return false
+	}
+	if len(t.ListStatuses) > 0 && !slices.Contains(t.ListStatuses, entry.GetStatusSafe()) {
+		return false
+	}
+	if len(t.MediaStatuses) > 0 && (media.GetStatus() == nil || !slices.Contains(t.MediaStatuses, *media.GetStatus())) {
+		return false
+	}
+	if len(t.Formats) > 0 && (media.GetFormat() == nil || !slices.Contains(t.Formats, *media.GetFormat())) {
+		return false
+	}
+	if len(t.Genres) > 0 {
+		found := false
+		for _, genre := range media.GetGenres() {
+			if genre != nil && lo.ContainsBy(t.Genres, func(g string) bool { return strings.EqualFold(g, *genre) }) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(t.Tags) > 0 {
+		found := false
+		for _, tag := range media.GetTags() {
+			if tag == nil || !lo.ContainsBy(t.Tags, func(name string) bool { return strings.EqualFold(name, tag.GetName()) }) {
+				continue
+			}
+			if t.MinTagRank > 0 && (tag.GetRank() == nil || *tag.GetRank() < t.MinTagRank) {
+				continue
+			}
+			found = true
+			break
+		}
+		if !found {
+			return false
+		}
+	}
+	if t.MinScore > 0 && (entry.GetScore() == nil || *entry.GetScore() < t.MinScore) {
+		return false
+	}
+	if t.MinMeanScore > 0 && (media.GetMeanScore() == nil || *media.GetMeanScore() < t.MinMeanScore) {
+		return false
+	}
+	return true
+}
+
+// newRuleFromTemplate returns the rule created by the template for the media.
+func newRuleFromTemplate(t *anime.AutoDownloaderRuleTemplate, media *anilist.BaseAnime, libraryPath string) *anime.AutoDownloaderRule {
+	templateId := t.DbID
+	return &anime.AutoDownloaderRule{
+		Enabled:             true,
+		MediaId:             media.GetID(),
+		Destination:         resolveDestinationPattern(t.DestinationPattern, media, libraryPath),
+		ProfileID:           t.ProfileID,
+		ReleaseGroups:       t.ReleaseGroups,
+		Resolutions:         t.Resolutions,
+		EpisodeType:         anime.AutoDownloaderRuleEpisodeRecent,
+		ComparisonTitle:     media.GetRomajiTitleSafe(),
+		TitleComparisonType: cmp.Or(t.TitleComparisonType, anime.AutoDownloaderRuleTitleComparisonLikely),
+		AdditionalTerms:     t.AdditionalTerms,
+		ExcludeTerms:        t.ExcludeTerms,
+		Providers:           t.Providers,
+		TemplateID:          &templateId,
+	}
+}
+
+// resolveDestinationPattern replaces the placeholders of the pattern.
+// Relative patterns are resolved against the library path.
+func resolveDestinationPattern(pattern string, media *anilist.BaseAnime, libraryPath string) string {
+	if pattern == "" {
+		pattern = defaultDestinationPattern
+	}
+
+	year := ""
+	if media.GetSeasonYear() != nil {
+		year = strconv.Itoa(*media.GetSeasonYear())
+	} else if media.GetStartDate() != nil && media.GetStartDate().GetYear() != nil {
+		year = strconv.Itoa(*media.GetStartDate().GetYear())
+	}
+	season := ""
+	if media.GetSeason() != nil {
+		season = strings.ToLower(string(*media.GetSeason()))
+	}
+
+	replacer := strings.NewReplacer(
+		"{title}", util.SanitizeFilename(media.GetPreferredTitle()),
+		"{romajiTitle}", util.SanitizeFilename(media.GetRomajiTitleSafe()),
+		"{englishTitle}", util.SanitizeFilename(media.GetEnglishTitleSafe()),
+		"{year}", year,
+		"{season}", season,
+	)
+	dest := filepath.Clean(replacer.Replace(filepath.FromSlash(pattern)))
+	if !filepath.IsAbs(dest) && libraryPath != "" {
+		dest = filepath.Join(libraryPath, dest)
+	}
+	return dest
+}
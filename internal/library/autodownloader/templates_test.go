@@ -0,0 +1,134 @@
+package autodownloader
+
+import (
+	"path/filepath"
+	"seanime/internal/api/anilist"
+	"seanime/internal/library/anime"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanRuleTemplates(t *testing.T) {
+	newEntry := func(id int, title string, listStatus anilist.MediaListStatus, status anilist.MediaStatus, genres []string, score float64) *anilist.AnimeListEntry {
+		return &anilist.AnimeListEntry{
+			Status: &listStatus,
+			Score:  &score,
+			Media: &anilist.BaseAnime{
+				ID:     id,
+				Status: &status,
+				Title:  &anilist.BaseAnime_Title{Romaji: lo.ToPtr(title), UserPreferred: lo.ToPtr(title)},
+				Genres: lo.ToSlicePtr(genres),
+			},
+		}
+	}
+
+	collection := &anilist.AnimeCollection{
+		MediaListCollection: &anilist.AnimeCollection_MediaListCollection{
+			Lists: []*anilist.AnimeCollection_MediaListCollection_Lists{
+				{Entries: []*anilist.AnimeListEntry{
+					newEntry(1, "Frieren", anilist.MediaListStatusCurrent, anilist.MediaStatusReleasing, []string{"Fantasy"}, 0),
+					newEntry(2, "Dandadan", anilist.MediaListStatusCurrent, anilist.MediaStatusReleasing, []string{"Action"}, 0),
+					newEntry(3, "Mushishi", anilist.MediaListStatusCurrent, anilist.MediaStatusFinished, []string{"Fantasy"}, 0),
+					newEntry(4, "Re:Zero", anilist.MediaListStatusPlanning, anilist.MediaStatusReleasing, []string{"Fantasy"}, 8),
+					newEntry(5, "Kaiju", anilist.MediaListStatusPlanning, anilist.MediaStatusReleasing, []string{"Action"}, 5),
+					newEntry(6, "Yuru Camp", anilist.MediaListStatusCurrent, anilist.MediaStatusFinished, []string{"Slice of Life"}, 0),
+				}},
+			},
+		},
+	}
+	setTags := func(mediaId int, tags map[string]int) {
+		entry, _ := collection.GetListEntryFromAnimeId(mediaId)
+		for name, rank := range tags {
+			entry.Media.Tags = append(entry.Media.Tags, &anilist.BaseAnime_Tags{Name: name, Rank: lo.ToPtr(rank)})
+		}
+	}
+	setTags(3, map[string]int{"Iyashikei": 92, "Episodic": 80})
+	setTags(6, map[string]int{"Iyashikei": 60, "Camping": 95})
+
+	profileId := uint(3)
+	templates := []*anime.AutoDownloaderRuleTemplate{
+		{
+			DbID:          2,
+			Enabled:       true,
+			ListStatuses:  []anilist.MediaListStatus{anilist.MediaListStatusPlanning},
+			Genres:        []string{"fantasy"},
+			MinScore:      7,
+			ProfileID:     &profileId,
+			Resolutions:   []string{"1080p"},
+			ReleaseGroups: []string{"SubsPlease"},
+		},
+		{
+			DbID:               1,
+			Enabled:            true,
+			ListStatuses:       []anilist.MediaListStatus{anilist.MediaListStatusCurrent},
+			MediaStatuses:      []anilist.MediaStatus{anilist.MediaStatusReleasing},
+			DestinationPattern: "Airing/{title}",
+		},
+		{
+			DbID:    3,
+			Enabled: false,
+		},
+		{
+			DbID:         4,
+			Enabled:      true,
+			ListStatuses: []anilist.MediaListStatus{anilist.MediaListStatusCurrent},
+			Tags:         []string{"iyashikei"},
+			MinTagRank:   80,
+		},
+	}
+
+	libraryPath := filepath.FromSlash("/anime")
+	rules := []*anime.AutoDownloaderRule{
+		// Manual rule
+		{DbID: 10, MediaId: 2},
+		// Rule of template 1 whose media finished airing
+		{DbID: 11, MediaId: 3, TemplateID: lo.ToPtr(uint(1))},
+		// Rule of the disabled template
+		{DbID: 12, MediaId: 5, TemplateID: lo.ToPtr(uint(3))},
+	}
+
+	plan := planRuleTemplates(templates, rules, collection, libraryPath)
+
+	require.Len(t, plan.Retired, 1)
+	require.Equal(t, uint(11), plan.Retired[0].DbID)
+
+	require.Len(t, plan.Created, 3)
+
+	frieren := plan.Created[0]
+	require.Equal(t, 1, frieren.MediaId)
+	require.Equal(t, uint(1), *frieren.TemplateID)
+	require.True(t, frieren.Enabled)
+	require.Equal(t, "Frieren", frieren.ComparisonTitle)
+	require.Equal(t, filepath.Join(libraryPath, "Airing", "Frieren"), frieren.Destination)
+	require.Equal(t, anime.AutoDownloaderRuleEpisodeRecent, frieren.EpisodeType)
+	require.Equal(t, anime.AutoDownloaderRuleTitleComparisonLikely, frieren.TitleComparisonType)
+
+	reZero := plan.Created[1]
+	require.Equal(t, 4, reZero.MediaId)
+	require.Equal(t, uint(2), *reZero.TemplateID)
+	require.Equal(t, &profileId, reZero.ProfileID)
+	require.Equal(t, []string{"1080p"}, reZero.Resolutions)
+	// Characters that are not allowed in file names are removed
+	require.Equal(t, filepath.Join(libraryPath, "ReZero"), reZero.Destination)
+
+	// The media of the retired rule matches the tags of another template, the rank of the tag of Yuru Camp is too low
+	mushishi := plan.Created[2]
+	require.Equal(t, 3, mushishi.MediaId)
+	require.Equal(t, uint(4), *mushishi.TemplateID)
+}
+
+func TestResolveDestinationPattern(t *testing.T) {
+	media := &anilist.BaseAnime{
+		Title:      &anilist.BaseAnime_Title{Romaji: lo.ToPtr("Sousou no Frieren"), English: lo.ToPtr("Frieren: Beyond Journey's End")},
+		SeasonYear: lo.ToPtr(2023),
+		Season:     lo.ToPtr(anilist.MediaSeasonFall),
+	}
+
+	root := filepath.FromSlash("/anime")
+
+	require.Equal(t, filepath.Join(root, "Frieren Beyond Journey's End"), resolveDestinationPattern("", media, root))
+	require.Equal(t, filepath.Join(root, "2023", "fall", "Sousou no Frieren"), resolveDestinationPattern("{year}/{season}/{romajiTitle}", media, root))
+	require.Equal(t, filepath.FromSlash("/downloads/Sousou no Frieren"), resolveDestinationPattern("/downloads/{romajiTitle}", media, root))
+}
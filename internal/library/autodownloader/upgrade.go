@@ -0,0 +1,445 @@
+package autodownloader
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"seanime/internal/database/models"
+	hibiketorrent "seanime/internal/extension/hibike/torrent"
+	"seanime/internal/library/anime"
+	"seanime/internal/library/filesystem"
+	"seanime/internal/torrent_clients/torrent_client"
+	"seanime/internal/util"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/5rahim/habari"
+)
+
+const (
+	UpgradeStatusPending   = "pending"
+	UpgradeStatusCompleted = "completed"
+	UpgradeStatusFailed    = "failed"
+
+	defaultUpgradeCutoffHours = 72
+	// Pending upgrades whose release is not downloaded after this duration are marked as failed
+	upgradeExpiration = 7 * 24 * time.Hour
+)
+
+type (
+	// upgradeSettings holds the upgrade configuration for a rule
+	upgradeSettings struct {
+		enabled bool
+		cutoff  time.Duration
+	}
+
+	// upgradeTarget is an episode in the library that can be replaced by a better release
+	upgradeTarget struct {
+		localFile *anime.LocalFile
+		quality   releaseQuality
+	}
+
+	// releaseQuality is used to compare releases of the same episode.
+	// Fields are compared in order: resolution, release group, score and version.
+	releaseQuality struct {
+		resolutionRank int // Rank in the ordered resolutions, higher is better, 0 if not in the list
+		groupRank      int // Rank in the ordered release groups, higher is better, 0 if not in the list
+		score          int
+		version        int
+
+		resolution   string
+		releaseGroup string
+	}
+)
+
+// getUpgradeSettings extracts the upgrade configuration from profiles.
+// Upgrades are enabled if any profile enables them and the longest cutoff is used.
+func (ad *AutoDownloader) getUpgradeSettings(ruleProfiles []*anime.AutoDownloaderProfile) upgradeSettings {
+	settings := upgradeSettings{}
+	for _, p := range ruleProfiles {
+		if !p.UpgradeEnabled {
+			continue
+		}
+		settings.enabled = true
+		cutoffHours := p.UpgradeCutoffHours
+		if cutoffHours <= 0 {
+			cutoffHours = defaultUpgradeCutoffHours
+		}
+		settings.cutoff = max(settings.cutoff, time.Duration(cutoffHours)*time.Hour)
+	}
+	return settings
+}
+
+// getReleaseQuality returns the quality of a release based on the preferences of the rule and its profiles.
+func (ad *AutoDownloader) getReleaseQuality(name string, parsedData *habari.Metadata, score int, rule *anime.AutoDownloaderRule, ruleProfiles []*anime.AutoDownloaderProfile) releaseQuality {
+	q := releaseQuality{
+		score:   score,
+		version: 1,
+	}
+	if parsedData == nil {
+		parsedData = habari.Parse(name)
+	}
+	q.resolution = parsedData.VideoResolution
+	q.releaseGroup = parsedData.ReleaseGroup
+
+	if q.resolution != "" {
+		resolutions := ad.inheritResolutionsFromProfiles(rule, ruleProfiles)
+		resolution := util.ExtractResolutionInt(util.NormalizeResolution(q.resolution))
+		for i, r := range resolutions {
+			if util.ExtractResolutionInt(util.NormalizeResolution(r)) == resolution {
+				q.resolutionRank = len(resolutions) - i
+				break
+			}
+		}
+	}
+
+	if q.releaseGroup != "" {
+		releaseGroups := ad.inheritReleaseGroupsFromProfiles(rule, ruleProfiles)
+		for i, rg := range releaseGroups {
+			if strings.EqualFold(rg, q.releaseGroup) {
+				q.groupRank = len(releaseGroups) - i
+				break
+			}
+		}
+	}
+
+	if len(parsedData.ReleaseVersion) > 0 {
+		if v, err := strconv.Atoi(parsedData.ReleaseVersion[0]); err == nil && v > 0 {
+			q.version = v
+		}
+	}
+	nameLower := strings.ToLower(name)
+	if strings.Contains(nameLower, "repack") || strings.Contains(nameLower, "proper") {
+		q.version = max(q.version, 2)
+	}
+
+	return q
+}
+
+func (q releaseQuality) compare(other releaseQuality) int {
+	return cmp.Or(
+		cmp.Compare(q.resolutionRank, other.resolutionRank),
+		cmp.Compare(q.groupRank, other.groupRank),
+		cmp.Compare(q.score, other.score),
+		cmp.Compare(q.version, other.version),
+	)
+}
+
+// upgradeReason describes why q is better than the previous release.
+func (q releaseQuality) upgradeReason(previous releaseQuality) string {
+	switch {
+	case q.resolutionRank != previous.resolutionRank:
+		return fmt.Sprintf("Preferred resolution (%s → %s)", cmp.Or(previous.resolution, "unknown"), q.resolution)
+	case q.groupRank != previous.groupRank:
+		return fmt.Sprintf("Preferred release group (%s → %s)", cmp.Or(previous.releaseGroup, "unknown"), q.releaseGroup)
+	case q.score != previous.score:
+		return fmt.Sprintf("Higher score (%d → %d)", previous.score, q.score)
+	default:
+		return fmt.Sprintf("New version (v%d → v%d)", previous.version, q.version)
+	}
+}
+
+// findUpgradeTarget returns the library file of the episode if it can be replaced by a better release.
+// Returns nil if the episode was watched, is queued, is already being upgraded or if the cutoff has passed.
+func (ad *AutoDownloader) findUpgradeTarget(
+	episode int,
+	rule *anime.AutoDownloaderRule,
+	ruleProfiles []*anime.AutoDownloaderProfile,
+	progress int,
+	lfWrapper *anime.LocalFileWrapper,
+	queuedItems []*models.AutoDownloaderItem,
+	upgrades []*models.AutoDownloaderUpgrade,
+	settings upgradeSettings,
+) *upgradeTarget {
+	if !settings.enabled || progress >= episode {
+		return nil
+	}
+
+	episodes := []int{episode}
+	if rule.CustomEpisodeNumberAbsoluteOffset != 0 {
+		episodes = append(episodes, episode-rule.CustomEpisodeNumberAbsoluteOffset)
+	}
+
+	for _, item := range queuedItems {
+		if !item.IsDelayed && item.RuleID == rule.DbID && slices.Contains(episodes, item.Episode) {
+			return nil
+		}
+	}
+
+	le, found := lfWrapper.GetLocalEntryById(rule.MediaId)
+	if !found {
+		return nil
+	}
+	var lf *anime.LocalFile
+	for _, ep := range episodes {
+		if lf, found = le.FindLocalFileWithEpisodeNumber(ep); found {
+			break
+		}
+	}
+	if lf == nil || lf.IsLocked() {
+		return nil
+	}
+
+	info, err := os.Stat(lf.Path)
+	if err != nil {
+		return nil
+	}
+	downloadedAt := info.ModTime()
+	for _, u := range upgrades {
+		if u.RuleID != rule.DbID || !slices.Contains(episodes, u.Episode) {
+			continue
+		}
+		if u.Status == UpgradeStatusPending {
+			return nil
+		}
+		// The window starts when the first release was downloaded
+		if u.CreatedAt.Before(downloadedAt) {
+			downloadedAt = u.CreatedAt
+		}
+	}
+	if time.Now().After(downloadedAt.Add(settings.cutoff)) {
+		return nil
+	}
+
+	score, _ := ad.calculateCandidateScore(&NormalizedTorrent{AnimeTorrent: &hibiketorrent.AnimeTorrent{Name: lf.Name}}, ruleProfiles)
+
+	return &upgradeTarget{
+		localFile: lf,
+		quality:   ad.getReleaseQuality(lf.Name, nil, score, rule, ruleProfiles),
+	}
+}
+
+// selectBestUpgradeCandidate selects the candidate with the best quality, or by seeders if the quality is the same.
+func (ad *AutoDownloader) selectBestUpgradeCandidate(candidates []*Candidate) *Candidate {
+	sort.Slice(candidates, func(i, j int) bool {
+		if c := candidates[i].quality.compare(candidates[j].quality); c != 0 {
+			return c > 0
+		}
+		return candidates[i].Torrent.Seeders > candidates[j].Torrent.Seeders
+	})
+
+	return candidates[0]
+}
+
+// handleUpgrade downloads a better release of an episode in the library and records the upgrade.
+// The replaced file is removed once the new release is downloaded.
+// Returns true if the item was downloaded or queued
+func (ad *AutoDownloader) handleUpgrade(isSimulation bool, candidate *Candidate, rule *anime.AutoDownloaderRule, episode int) bool {
+	target := candidate.upgrade
+	reason := candidate.quality.upgradeReason(target.quality)
+
+	ad.logger.Info().
+		Str("file", target.localFile.Name).
+		Str("torrent", candidate.Torrent.Name).
+		Str("reason", reason).
+		Int("episode", episode).
+		Msg("autodownloader: Found better release, upgrading")
+
+	if !ad.downloadTorrent(isSimulation, candidate.Torrent, rule, episode, candidate.Score, nil) {
+		return false
+	}
+	if isSimulation {
+		return true
+	}
+
+	upgrade := &models.AutoDownloaderUpgrade{
+		RuleID:         rule.DbID,
+		MediaID:        rule.MediaId,
+		Episode:        episode,
+		OldPath:        target.localFile.Path,
+		NewHash:        candidate.Torrent.InfoHash,
+		NewTorrentName: candidate.Torrent.Name,
+		Reason:         reason,
+		Status:         UpgradeStatusPending,
+	}
+
+	if ad.torrentClientRepository != nil && ad.torrentClientRepository.GetProvider() != torrent_client.NoneClient {
+		torrents, err := ad.torrentClientRepository.FindTorrentsForFiles([]string{target.localFile.Path})
+		if err == nil {
+			if t, ok := torrents[target.localFile.Path]; ok {
+				upgrade.OldTorrentHash = t.Hash
+			}
+		}
+	}
+
+	if err := ad.database.InsertAutoDownloaderUpgrade(upgrade); err != nil {
+		ad.logger.Error().Err(err).Msg("autodownloader: Failed to record upgrade")
+	}
+
+	return true
+}
+
+// completeUpgrades removes the files replaced by pending upgrades once the new releases are downloaded.
+func (ad *AutoDownloader) completeUpgrades(lfWrapper *anime.LocalFileWrapper) {
+	upgrades, err := ad.database.GetAutoDownloaderUpgradesByStatus(UpgradeStatusPending)
+	if err != nil || len(upgrades) == 0 {
+		return
+	}
+
+	var torrents []*torrent_client.Torrent
+	hasTorrentClient := ad.torrentClientRepository != nil && ad.torrentClientRepository.GetProvider() != torrent_client.NoneClient
+	if hasTorrentClient {
+		torrents, err = ad.torrentClientRepository.GetList(&torrent_client.GetListOptions{})
+		if err != nil {
+			ad.logger.Warn().Err(err).Msg("autodownloader: Could not get torrents, skipping pending upgrades")
+			return
+		}
+	}
+
+	removed := false
+	for _, u := range upgrades {
+		if !isUpgradeDownloaded(u, torrents, lfWrapper) {
+			if time.Since(u.CreatedAt) > upgradeExpiration {
+				u.Status = UpgradeStatusFailed
+				u.Error = "The new release was not downloaded in time"
+				_ = ad.database.UpdateAutoDownloaderUpgrade(u)
+			}
+			continue
+		}
+
+		if err := ad.removeReplacedFile(u, torrents, lfWrapper); err != nil {
+			ad.logger.Error().Err(err).Str("path", u.OldPath).Msg("autodownloader: Failed to remove replaced file")
+			u.Status = UpgradeStatusFailed
+			u.Error = err.Error()
+		} else {
+			ad.logger.Info().Str("path", u.OldPath).Str("torrent", u.NewTorrentName).Msg("autodownloader: Upgrade completed, replaced file removed")
+			u.Status = UpgradeStatusCompleted
+			removed = true
+		}
+		now := time.Now()
+		u.CompletedAt = &now
+		_ = ad.database.UpdateAutoDownloaderUpgrade(u)
+	}
+
+	if removed {
+		libraryPaths, _ := ad.database.GetAllLibraryPathsFromSettings()
+		for _, p := range libraryPaths {
+			filesystem.RemoveEmptyDirectories(p, ad.logger)
+		}
+	}
+}
+
+// isUpgradeDownloaded returns true if the torrent of the upgrade is complete.
+// If the torrent is not in the torrent client (e.g. debrid), the library is checked for another file of the episode.
+func isUpgradeDownloaded(u *models.AutoDownloaderUpgrade, torrents []*torrent_client.Torrent, lfWrapper *anime.LocalFileWrapper) bool {
+	for _, t := range torrents {
+		if strings.EqualFold(t.Hash, u.NewHash) {
+			return t.Progress >= 1
+		}
+	}
+
+	le, found := lfWrapper.GetLocalEntryById(u.MediaID)
+	if !found {
+		return false
+	}
+	for _, lf := range le.LocalFiles {
+		if lf.IsMain() && lf.GetEpisodeNumber() == u.Episode && util.NormalizePath(lf.Path) != util.NormalizePath(u.OldPath) {
+			return true
+		}
+	}
+	return false
+}
+
+type replacedFileRemoval int
+
+const (
+	// The new release has the same path as the replaced file, e.g. a REPACK with the same name
+	replacedFileKeep replacedFileRemoval = iota
+	replacedFileRemoveFile
+	// The old torrent is removed with its data, the torrent client deletes the file
+	replacedFileRemoveTorrent
+)
+
+// removeReplacedFile removes the old torrent with its data if it only contains the replaced file.
+// Otherwise, only the file is deleted.
+func (ad *AutoDownloader) removeReplacedFile(u *models.AutoDownloaderUpgrade, torrents []*torrent_client.Torrent, lfWrapper *anime.LocalFileWrapper) error {
+	newPaths, err := ad.getUpgradeFilePaths(u, torrents, lfWrapper)
+	if err != nil {
+		return fmt.Errorf("could not get the files of the new release: %w", err)
+	}
+
+	var oldTorrent *torrent_client.Torrent
+	var oldTorrentPaths []string
+	if u.OldTorrentHash != "" {
+		for _, t := range torrents {
+			if t.Hash != u.OldTorrentHash {
+				continue
+			}
+			oldTorrent = t
+			oldTorrentPaths, err = ad.torrentClientRepository.GetTorrentFilePaths(t)
+			if err != nil {
+				return fmt.Errorf("could not get the files of the old torrent: %w", err)
+			}
+			break
+		}
+	}
+
+	switch getReplacedFileRemoval(u.OldPath, newPaths, oldTorrentPaths) {
+	case replacedFileKeep:
+		ad.logger.Debug().Str("path", u.OldPath).Msg("autodownloader: The new release replaced the file in place")
+		return nil
+	case replacedFileRemoveTorrent:
+		return ad.torrentClientRepository.RemoveTorrents([]string{oldTorrent.Hash})
+	}
+
+	if err := os.Remove(u.OldPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// getUpgradeFilePaths returns the paths of the files of the new release.
+// If the torrent is not in the torrent client, the files of the episode in the library are returned.
+func (ad *AutoDownloader) getUpgradeFilePaths(u *models.AutoDownloaderUpgrade, torrents []*torrent_client.Torrent, lfWrapper *anime.LocalFileWrapper) ([]string, error) {
+	for _, t := range torrents {
+		if strings.EqualFold(t.Hash, u.NewHash) {
+			return ad.torrentClientRepository.GetTorrentFilePaths(t)
+		}
+	}
+
+	ret := make([]string, 0)
+	if le, found := lfWrapper.GetLocalEntryById(u.MediaID); found {
+		for _, lf := range le.LocalFiles {
+			if lf.IsMain() && lf.GetEpisodeNumber() == u.Episode && util.NormalizePath(lf.Path) != util.NormalizePath(u.OldPath) {
+				ret = append(ret, lf.Path)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// getReplacedFileRemoval decides how the replaced file is removed.
+// oldTorrentPaths is nil if the old torrent is not in the torrent client.
+func getReplacedFileRemoval(oldPath string, newPaths []string, oldTorrentPaths []string) replacedFileRemoval {
+	isNewFile := make(map[string]bool, len(newPaths))
+	for _, p := range newPaths {
+		isNewFile[util.NormalizePath(p)] = true
+	}
+
+	if isNewFile[util.NormalizePath(oldPath)] {
+		return replacedFileKeep
+	}
+	if oldTorrentPaths == nil {
+		return replacedFileRemoveFile
+	}
+
+	videoFiles := 0
+	for _, p := range oldTorrentPaths {
+		// The old torrent also holds the new release
+		if isNewFile[util.NormalizePath(p)] {
+			return replacedFileRemoveFile
+		}
+		if util.IsValidVideoExtension(filepath.Ext(p)) {
+			videoFiles++
+		}
+	}
+	if videoFiles <= 1 {
+		return replacedFileRemoveTorrent
+	}
+	return replacedFileRemoveFile
+}
@@ -0,0 +1,227 @@
+package autodownloader
+
+import (
+	"os"
+	"path/filepath"
+	"seanime/internal/database/models"
+	"seanime/internal/library/anime"
+	"seanime/internal/torrent_clients/torrent_client"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseQuality(t *testing.T) {
+	ad := &AutoDownloader{}
+
+	rule := &anime.AutoDownloaderRule{
+		ReleaseGroups: []string{"SubsPlease", "Erai-raws"},
+		Resolutions:   []string{"1080p", "720p"},
+	}
+
+	quality := func(name string) releaseQuality {
+		return ad.getReleaseQuality(name, nil, 0, rule, nil)
+	}
+
+	original := quality("[Erai-raws] Frieren - 01 [720p].mkv")
+
+	tests := []struct {
+		name     string
+		release  string
+		expected int
+		reason   string
+	}{
+		{
+			name:     "Higher resolution",
+			release:  "[Erai-raws] Frieren - 01 [1080p].mkv",
+			expected: 1,
+			reason:   "Preferred resolution (720p → 1080p)",
+		},
+		{
+			name:     "Preferred release group",
+			release:  "[SubsPlease] Frieren - 01 (720p) [ABCD1234].mkv",
+			expected: 1,
+			reason:   "Preferred release group (Erai-raws → SubsPlease)",
+		},
+		{
+			name:     "New version",
+			release:  "[Erai-raws] Frieren - 01v2 [720p].mkv",
+			expected: 1,
+			reason:   "New version (v1 → v2)",
+		},
+		{
+			name:     "Repack",
+			release:  "[Erai-raws] Frieren - 01 [720p] [REPACK].mkv",
+			expected: 1,
+			reason:   "New version (v1 → v2)",
+		},
+		{
+			name:     "Same release",
+			release:  "[Erai-raws] Frieren - 01 [720p].mkv",
+			expected: 0,
+		},
+		{
+			name:     "Higher version but lower resolution",
+			release:  "[Erai-raws] Frieren - 01v2 [480p].mkv",
+			expected: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := quality(tt.release)
+			require.Equal(t, tt.expected, q.compare(original))
+			if tt.reason != "" {
+				require.Equal(t, tt.reason, q.upgradeReason(original))
+			}
+		})
+	}
+
+	// Profile score
+	withScore := ad.getReleaseQuality("[Erai-raws] Frieren - 01 [720p] [HEVC].mkv", nil, 10, rule, nil)
+	require.Equal(t, 1, withScore.compare(original))
+}
+
+func TestGetUpgradeSettings(t *testing.T) {
+	ad := &AutoDownloader{}
+
+	settings := ad.getUpgradeSettings([]*anime.AutoDownloaderProfile{{UpgradeEnabled: false}})
+	require.False(t, settings.enabled)
+
+	settings = ad.getUpgradeSettings([]*anime.AutoDownloaderProfile{
+		{UpgradeEnabled: true},
+		{UpgradeEnabled: true, UpgradeCutoffHours: 24},
+	})
+	require.True(t, settings.enabled)
+	require.Equal(t, time.Duration(defaultUpgradeCutoffHours)*time.Hour, settings.cutoff)
+}
+
+func TestFindUpgradeTarget(t *testing.T) {
+	ad := &AutoDownloader{}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "[Erai-raws] Frieren - 02 [720p].mkv")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+
+	lf := &anime.LocalFile{
+		Path:    path,
+		Name:    filepath.Base(path),
+		MediaId: 1,
+		Metadata: &anime.LocalFileMetadata{
+			Episode: 2,
+			Type:    anime.LocalFileTypeMain,
+		},
+	}
+	lfWrapper := anime.NewLocalFileWrapper([]*anime.LocalFile{lf})
+
+	rule := &anime.AutoDownloaderRule{DbID: 1, MediaId: 1, Resolutions: []string{"1080p", "720p"}}
+	settings := upgradeSettings{enabled: true, cutoff: time.Hour}
+
+	target := ad.findUpgradeTarget(2, rule, nil, 1, lfWrapper, nil, nil, settings)
+	require.NotNil(t, target)
+	require.Equal(t, path, target.localFile.Path)
+	require.Equal(t, 1, target.quality.resolutionRank)
+
+	// Watched
+	require.Nil(t, ad.findUpgradeTarget(2, rule, nil, 2, lfWrapper, nil, nil, settings))
+
+	// Not in the library
+	require.Nil(t, ad.findUpgradeTarget(3, rule, nil, 1, lfWrapper, nil, nil, settings))
+
+	// Queued
+	queued := []*models.AutoDownloaderItem{{RuleID: 1, Episode: 2}}
+	require.Nil(t, ad.findUpgradeTarget(2, rule, nil, 1, lfWrapper, queued, nil, settings))
+
+	// Already being upgraded
+	pending := []*models.AutoDownloaderUpgrade{{RuleID: 1, Episode: 2, Status: UpgradeStatusPending}}
+	require.Nil(t, ad.findUpgradeTarget(2, rule, nil, 1, lfWrapper, nil, pending, settings))
+
+	// The window starts with the first upgrade
+	completed := []*models.AutoDownloaderUpgrade{{BaseModel: models.BaseModel{CreatedAt: time.Now().Add(-2 * time.Hour)}, RuleID: 1, Episode: 2, Status: UpgradeStatusCompleted}}
+	require.Nil(t, ad.findUpgradeTarget(2, rule, nil, 1, lfWrapper, nil, completed, settings))
+
+	// Cutoff passed
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(path, old, old))
+	require.Nil(t, ad.findUpgradeTarget(2, rule, nil, 1, lfWrapper, nil, nil, settings))
+
+	// Locked
+	lf.Locked = true
+	require.Nil(t, ad.findUpgradeTarget(2, rule, nil, 1, lfWrapper, nil, nil, upgradeSettings{enabled: true, cutoff: 24 * time.Hour}))
+}
+
+func TestIsUpgradeDownloaded(t *testing.T) {
+	oldPath := filepath.FromSlash("/anime/Frieren/[Erai-raws] Frieren - 02 [720p].mkv")
+	newPath := filepath.FromSlash("/anime/Frieren/[SubsPlease] Frieren - 02 (1080p).mkv")
+	u := &models.AutoDownloaderUpgrade{MediaID: 1, Episode: 2, OldPath: oldPath, NewHash: "abc"}
+
+	newLocalFile := func(path string) *anime.LocalFile {
+		return &anime.LocalFile{Path: path, MediaId: 1, Metadata: &anime.LocalFileMetadata{Episode: 2, Type: anime.LocalFileTypeMain}}
+	}
+
+	onlyOld := anime.NewLocalFileWrapper([]*anime.LocalFile{newLocalFile(oldPath)})
+	both := anime.NewLocalFileWrapper([]*anime.LocalFile{newLocalFile(oldPath), newLocalFile(newPath)})
+
+	// The torrent client decides when the torrent is known
+	require.False(t, isUpgradeDownloaded(u, []*torrent_client.Torrent{{Hash: "ABC", Progress: 0.5}}, both))
+	require.True(t, isUpgradeDownloaded(u, []*torrent_client.Torrent{{Hash: "abc", Progress: 1}}, onlyOld))
+
+	// Otherwise the library is checked
+	require.False(t, isUpgradeDownloaded(u, nil, onlyOld))
+	require.True(t, isUpgradeDownloaded(u, nil, both))
+}
+
+func TestGetReplacedFileRemoval(t *testing.T) {
+	dir := filepath.FromSlash("/downloads/")
+	oldPath := filepath.Join(dir, "[Erai-raws] Frieren - 02 [720p].mkv")
+	newPath := filepath.Join(dir, "[SubsPlease] Frieren - 02 (1080p).mkv")
+
+	tests := []struct {
+		name            string
+		newPaths        []string
+		oldTorrentPaths []string
+		expected        replacedFileRemoval
+	}{
+		{
+			name:            "Repack with the same name",
+			newPaths:        []string{oldPath},
+			oldTorrentPaths: []string{oldPath},
+			expected:        replacedFileKeep,
+		},
+		{
+			name:     "Repack with the same name, old torrent not in the client",
+			newPaths: []string{filepath.ToSlash(oldPath)},
+			expected: replacedFileKeep,
+		},
+		{
+			name:            "Single file torrent",
+			newPaths:        []string{newPath},
+			oldTorrentPaths: []string{oldPath, filepath.Join(dir, "readme.txt")},
+			expected:        replacedFileRemoveTorrent,
+		},
+		{
+			name:            "Batch torrent",
+			newPaths:        []string{newPath},
+			oldTorrentPaths: []string{oldPath, filepath.Join(dir, "[Erai-raws] Frieren - 03 [720p].mkv")},
+			expected:        replacedFileRemoveFile,
+		},
+		{
+			name:            "Old torrent holds the new file",
+			newPaths:        []string{newPath},
+			oldTorrentPaths: []string{oldPath, newPath},
+			expected:        replacedFileRemoveFile,
+		},
+		{
+			name:     "Old torrent not in the client",
+			newPaths: []string{newPath},
+			expected: replacedFileRemoveFile,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, getReplacedFileRemoval(oldPath, tt.newPaths, tt.oldTorrentPaths))
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"seanime/internal/database/db_bridge"
 	"seanime/internal/database/models"
 	"seanime/internal/events"
+	"seanime/internal/library/anime"
 	"seanime/internal/library/autodownloader"
 	"seanime/internal/library/scanner"
 	"seanime/internal/library/summary"
@@ -41,6 +42,7 @@ type (
 		logsDir             string
 		scanning            atomic.Bool
 		onRefreshCollection func()
+		onScanCompleted     func(lfs []*anime.LocalFile)
 		animeCollection     *anilist.AnimeCollection
 	}
 	NewAutoScannerOptions struct {
@@ -54,6 +56,8 @@ type (
 		MetadataProviderRef *util.Ref[metadata_provider.Provider]
 		LogsDir             string
 		OnRefreshCollection func()
+		// OnScanCompleted is called with the local files after they are saved
+		OnScanCompleted func(lfs []*anime.LocalFile)
 	}
 )
 
@@ -79,6 +83,7 @@ func New(opts *NewAutoScannerOptions) *AutoScanner {
 		metadataProviderRef: opts.MetadataProviderRef,
 		logsDir:             opts.LogsDir,
 		onRefreshCollection: opts.OnRefreshCollection,
+		onScanCompleted:     opts.OnScanCompleted,
 	}
 }
 
@@ -300,6 +305,10 @@ func (as *AutoScanner) scan() {
 	// Refresh the queue
 	go as.autoDownloader.CleanUpDownloadedItems()
 
+	if as.onScanCompleted != nil && len(allLfs) > 0 {
+		go as.onScanCompleted(allLfs)
+	}
+
 	if as.onRefreshCollection != nil {
 		go as.onRefreshCollection()
 	}
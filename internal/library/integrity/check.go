@@ -0,0 +1,184 @@
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"seanime/internal/database/models"
+	"seanime/internal/util"
+	"strings"
+	"time"
+
+	"github.com/5rahim/habari"
+	"gopkg.in/vansante/go-ffprobe.v2"
+)
+
+const readBufferSize = 1024 * 1024
+
+type CheckOptions struct {
+	// Path of the ffprobe binary, the probe is skipped if empty or not found
+	FfprobePath string
+	// Read speed limit in MiB/s, 0 means no limit
+	MaxReadSpeed int
+}
+
+// Check returns the health report of a file.
+// The cheap checks run first (size, container, ffprobe), the CRC32 is only computed
+// when the filename contains a checksum since the whole file has to be read.
+func Check(ctx context.Context, path string, opts *CheckOptions) *models.LocalFileHealth {
+	report := &models.LocalFileHealth{
+		Path:          path,
+		ExpectedCrc32: GetFilenameChecksum(path),
+		Status:        StatusOk,
+		CheckedAt:     time.Now(),
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		report.Status = StatusMissing
+		report.Error = err.Error()
+		return report
+	}
+	report.Size = info.Size()
+	report.ModTime = info.ModTime()
+
+	if info.Size() == 0 {
+		report.Status = StatusTruncated
+		report.Error = "file is empty"
+		return report
+	}
+
+	if err = checkContainer(path, info.Size()); err != nil {
+		if errors.Is(err, errTruncated) {
+			report.Status = StatusTruncated
+		} else {
+			report.Status = StatusUnreadable
+		}
+		report.Error = err.Error()
+		return report
+	}
+
+	if err = probe(ctx, opts.FfprobePath, path); err != nil {
+		report.Status = StatusUnreadable
+		report.Error = err.Error()
+		return report
+	}
+
+	if report.ExpectedCrc32 == "" {
+		return report
+	}
+
+	report.ActualCrc32, err = computeCrc32(ctx, path, opts.MaxReadSpeed)
+	if err != nil {
+		report.Status = StatusUnreadable
+		report.Error = err.Error()
+		return report
+	}
+	if report.ActualCrc32 != report.ExpectedCrc32 {
+		report.Status = StatusMismatch
+		report.Error = fmt.Sprintf("expected CRC32 %s, got %s", report.ExpectedCrc32, report.ActualCrc32)
+	}
+
+	return report
+}
+
+// GetFilenameChecksum returns the CRC32 embedded in the filename (e.g. "[Group] Show - 01 [ABCD1234].mkv"), in uppercase.
+func GetFilenameChecksum(path string) string {
+	checksum := strings.ToUpper(habari.Parse(filepath.Base(path)).FileChecksum)
+	if len(checksum) != 8 {
+		return ""
+	}
+	if _, err := hex.DecodeString(checksum); err != nil {
+		return ""
+	}
+	return checksum
+}
+
+// computeCrc32 reads the file and returns its CRC32 in uppercase hex.
+func computeCrc32(ctx context.Context, path string, maxReadSpeed int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	buf := make([]byte, readBufferSize)
+	start := time.Now()
+	var read int64
+
+	for {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		n, err := f.Read(buf)
+		if n > 0 {
+			_, _ = h.Write(buf[:n])
+			read += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		// Throttle
+		if maxReadSpeed > 0 {
+			expected := time.Duration(float64(read) / float64(maxReadSpeed*readBufferSize) * float64(time.Second))
+			if d := expected - time.Since(start); d > 0 && !waitFor(ctx, d) {
+				return "", ctx.Err()
+			}
+		}
+	}
+
+	return fmt.Sprintf("%08X", h.Sum32()), nil
+}
+
+// probe returns an error if ffprobe can't parse the file.
+// The binary is run directly instead of through ffprobe.ProbeURL, whose binary path is global and set by the media streaming module.
+func probe(ctx context.Context, ffprobePath string, path string) error {
+	if ffprobePath == "" {
+		return nil
+	}
+	// Don't flag every file if ffprobe isn't installed
+	if _, err := exec.LookPath(ffprobePath); err != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 40*time.Second)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := util.NewCmdCtx(ctx, ffprobePath, "-loglevel", "fatal", "-print_format", "json", "-show_format", "-show_streams", path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("ffprobe: %s", msg)
+		}
+		return fmt.Errorf("ffprobe: %w", err)
+	}
+
+	var data ffprobe.ProbeData
+	if err := json.Unmarshal(stdout.Bytes(), &data); err != nil {
+		return fmt.Errorf("ffprobe: invalid output: %w", err)
+	}
+	if len(data.Streams) == 0 {
+		return errors.New("ffprobe: no streams found")
+	}
+	return nil
+}
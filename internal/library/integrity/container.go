@@ -0,0 +1,196 @@
+package integrity
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DEVNOTE: An interrupted download usually leaves a file that is shorter than what its container declares.
+// Matroska files declare the size of the Segment element in the header and MP4 files are a sequence of sized boxes,
+// so truncation can be detected without reading the whole file.
+
+var errTruncated = errors.New("file is truncated")
+
+const (
+	ebmlHeaderId      = 0x1A45DFA3
+	matroskaSegmentId = 0x18538067
+	mp4MaxBoxes       = 10_000
+)
+
+// checkContainer returns errTruncated if the file is shorter than what the container declares.
+// Unknown containers are not checked.
+func checkContainer(path string, size int64) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mkv", ".webm", ".mka":
+		return checkMatroska(path, size)
+	case ".mp4", ".m4v", ".mov":
+		return checkMp4(path, size)
+	}
+	return nil
+}
+
+func checkMatroska(path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	id, _, err := readEbmlId(r)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errTruncated, err)
+	}
+	if id != ebmlHeaderId {
+		return errors.New("invalid matroska header")
+	}
+	headerSize, headerSizeLen, _, err := readEbmlSize(r)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errTruncated, err)
+	}
+	if _, err = r.Discard(int(headerSize)); err != nil {
+		return fmt.Errorf("%w: %s", errTruncated, err)
+	}
+
+	id, idLen, err := readEbmlId(r)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errTruncated, err)
+	}
+	if id != matroskaSegmentId {
+		// Unexpected element, can't tell
+		return nil
+	}
+	segmentSize, segmentSizeLen, unknown, err := readEbmlSize(r)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errTruncated, err)
+	}
+	if unknown {
+		// Live streams and some muxers don't write the size
+		return nil
+	}
+
+	// EBML ID (4) + header size + header + segment ID + segment size + segment
+	end := 4 + int64(headerSizeLen) + int64(headerSize) + int64(idLen) + int64(segmentSizeLen) + int64(segmentSize)
+	if end > size {
+		return fmt.Errorf("%w: %d bytes missing", errTruncated, end-size)
+	}
+	return nil
+}
+
+// readEbmlId reads an element ID, the length marker is kept.
+func readEbmlId(r io.ByteReader) (id uint32, length int, err error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	length = vintLength(b)
+	if length == 0 || length > 4 {
+		return 0, 0, errors.New("invalid element ID")
+	}
+	id = uint32(b)
+	for i := 1; i < length; i++ {
+		b, err = r.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+		id = id<<8 | uint32(b)
+	}
+	return id, length, nil
+}
+
+// readEbmlSize reads an element data size.
+// unknown is true if all the value bits are set, meaning the size is not known.
+func readEbmlSize(r io.ByteReader) (size uint64, length int, unknown bool, err error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	length = vintLength(b)
+	if length == 0 {
+		return 0, 0, false, errors.New("invalid element size")
+	}
+	mask := byte(0xFF >> length)
+	size = uint64(b & mask)
+	unknown = b&mask == mask
+	for i := 1; i < length; i++ {
+		b, err = r.ReadByte()
+		if err != nil {
+			return 0, 0, false, err
+		}
+		size = size<<8 | uint64(b)
+		unknown = unknown && b == 0xFF
+	}
+	return size, length, unknown, nil
+}
+
+// vintLength returns the length of a variable-size integer from its first byte, 0 if invalid.
+func vintLength(b byte) int {
+	for i := 0; i < 8; i++ {
+		if b&(0x80>>i) != 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func checkMp4(path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var offset int64
+	header := make([]byte, 16)
+
+	for i := 0; offset < size && i < mp4MaxBoxes; i++ {
+		if size-offset < 8 {
+			return fmt.Errorf("%w: incomplete box header", errTruncated)
+		}
+		if _, err = f.ReadAt(header[:8], offset); err != nil {
+			return err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+
+		if i == 0 && boxType != "ftyp" {
+			// Not an ISO base media file, can't tell
+			return nil
+		}
+
+		switch boxSize {
+		case 0:
+			// The box extends to the end of the file
+			return nil
+		case 1:
+			if size-offset < 16 {
+				return fmt.Errorf("%w: incomplete box header", errTruncated)
+			}
+			if _, err = f.ReadAt(header[8:16], offset+8); err != nil {
+				return err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			if boxSize < 16 {
+				return fmt.Errorf("invalid %q box size", boxType)
+			}
+		default:
+			if boxSize < 8 {
+				return fmt.Errorf("invalid %q box size", boxType)
+			}
+		}
+
+		if offset+boxSize > size {
+			return fmt.Errorf("%w: %q box is missing %d bytes", errTruncated, boxType, offset+boxSize-size)
+		}
+		offset += boxSize
+	}
+
+	return nil
+}
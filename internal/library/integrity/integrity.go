@@ -0,0 +1,333 @@
+package integrity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"seanime/internal/database/db"
+	"seanime/internal/database/models"
+	"seanime/internal/events"
+	"seanime/internal/library/anime"
+	"seanime/internal/torrent_clients/torrent_client"
+	"seanime/internal/util"
+	"seanime/internal/util/filecache"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	StatusOk         = "ok"
+	StatusMismatch   = "mismatch"   // The CRC32 doesn't match the checksum in the filename
+	StatusTruncated  = "truncated"  // The file is smaller than what the container declares
+	StatusUnreadable = "unreadable" // The file can't be read or ffprobe can't parse it
+	StatusMissing    = "missing"
+
+	settingsBucketName  = "integrity-settings"
+	settingsBucketKey   = "1"
+	defaultMaxReadSpeed = 30 // MiB/s
+)
+
+var (
+	ErrNoTorrentClient = errors.New("integrity: no torrent client")
+	ErrTorrentNotFound = errors.New("integrity: no torrent contains this file")
+)
+
+type (
+	// Manager checks the integrity of local files in a background worker.
+	// Files are checked one at a time and the read speed is throttled so that playback isn't affected.
+	Manager struct {
+		logger                  *zerolog.Logger
+		database                *db.Database
+		wsEventManager          events.WSEventManagerInterface
+		fileCacher              *filecache.Cacher
+		torrentClientRepository *torrent_client.Repository
+		ffprobePath             string
+
+		mu      sync.Mutex
+		queue   []*job
+		queued  map[string]struct{}
+		current string
+		checked int
+		cancel  context.CancelFunc
+		wakeCh  chan struct{}
+	}
+
+	NewManagerOptions struct {
+		Logger         *zerolog.Logger
+		Database       *db.Database
+		WSEventManager events.WSEventManagerInterface
+		FileCacher     *filecache.Cacher
+	}
+
+	// Settings configures the integrity checks.
+	Settings struct {
+		// Queue new and modified files after each scan
+		CheckAfterScan bool `json:"checkAfterScan"`
+		// Read speed limit in MiB/s, 0 means no limit
+		MaxReadSpeed int `json:"maxReadSpeed"`
+		// Ask the torrent client to verify the torrent of a corrupt file, it downloads the bad pieces again
+		RecheckCorruptTorrents bool `json:"recheckCorruptTorrents"`
+	}
+
+	// Status is the state of the worker.
+	Status struct {
+		// Path of the file being checked
+		Current string `json:"current"`
+		Pending int    `json:"pending"`
+		// Files checked since the queue was last empty
+		Checked int `json:"checked"`
+	}
+
+	job struct {
+		lf    *anime.LocalFile
+		force bool
+	}
+)
+
+func NewManager(opts *NewManagerOptions) *Manager {
+	return &Manager{
+		logger:         opts.Logger,
+		database:       opts.Database,
+		wsEventManager: opts.WSEventManager,
+		fileCacher:     opts.FileCacher,
+		queue:          make([]*job, 0),
+		queued:         make(map[string]struct{}),
+		wakeCh:         make(chan struct{}, 1),
+	}
+}
+
+func (m *Manager) SetTorrentClientRepository(repo *torrent_client.Repository) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.torrentClientRepository = repo
+}
+
+// SetFfprobePath sets the ffprobe binary used to check that files can be parsed.
+func (m *Manager) SetFfprobePath(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ffprobePath = path
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (m *Manager) defaultSettings() *Settings {
+	return &Settings{
+		CheckAfterScan:         false,
+		MaxReadSpeed:           defaultMaxReadSpeed,
+		RecheckCorruptTorrents: false,
+	}
+}
+
+func (m *Manager) GetSettings() *Settings {
+	bucket := filecache.NewPermanentBucket(settingsBucketName)
+
+	settings := m.defaultSettings()
+	found, _ := m.fileCacher.GetPerm(bucket, settingsBucketKey, settings)
+	if !found {
+		return m.defaultSettings()
+	}
+	return settings
+}
+
+func (m *Manager) SaveSettings(settings *Settings) error {
+	if settings.MaxReadSpeed < 0 {
+		settings.MaxReadSpeed = 0
+	}
+	bucket := filecache.NewPermanentBucket(settingsBucketName)
+	return m.fileCacher.SetPerm(bucket, settingsBucketKey, settings)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// GetReports returns the health report of every checked file.
+func (m *Manager) GetReports() ([]*models.LocalFileHealth, error) {
+	return m.database.GetLocalFileHealthReports()
+}
+
+func (m *Manager) GetStatus() *Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getStatus()
+}
+
+func (m *Manager) getStatus() *Status {
+	return &Status{
+		Current: m.current,
+		Pending: len(m.queue),
+		Checked: m.checked,
+	}
+}
+
+// OnScanCompleted removes the reports of the files that are no longer in the library
+// and queues the new and modified files if enabled.
+func (m *Manager) OnScanCompleted(lfs []*anime.LocalFile) {
+	defer util.HandlePanicInModuleThen("integrity/OnScanCompleted", func() {})
+
+	reports, err := m.database.GetLocalFileHealthReports()
+	if err != nil {
+		m.logger.Error().Err(err).Msg("integrity: Failed to get reports")
+		return
+	}
+
+	paths := make(map[string]struct{}, len(lfs))
+	for _, lf := range lfs {
+		paths[lf.GetNormalizedPath()] = struct{}{}
+	}
+	staleIds := make([]uint, 0)
+	for _, r := range reports {
+		if _, ok := paths[util.NormalizePath(r.Path)]; !ok {
+			staleIds = append(staleIds, r.ID)
+		}
+	}
+	if err = m.database.DeleteLocalFileHealthReports(staleIds); err != nil {
+		m.logger.Error().Err(err).Msg("integrity: Failed to delete stale reports")
+	}
+
+	if m.GetSettings().CheckAfterScan {
+		m.Enqueue(lfs, false)
+	}
+}
+
+// Enqueue queues the files to be checked.
+// Unless force is true, files that haven't changed since their last check are skipped.
+func (m *Manager) Enqueue(lfs []*anime.LocalFile, force bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	added := 0
+	for _, lf := range lfs {
+		if lf == nil || lf.IsIgnored() {
+			continue
+		}
+		if _, ok := m.queued[lf.Path]; ok {
+			continue
+		}
+		m.queued[lf.Path] = struct{}{}
+		m.queue = append(m.queue, &job{lf: lf, force: force})
+		added++
+	}
+
+	if added == 0 {
+		return
+	}
+
+	m.logger.Debug().Int("count", added).Msg("integrity: Files queued")
+
+	select {
+	case m.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// CancelChecks clears the queue and stops the current check.
+func (m *Manager) CancelChecks() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.queue = make([]*job, 0)
+	m.queued = make(map[string]struct{})
+	if m.cancel != nil {
+		m.cancel()
+	}
+}
+
+// Start starts the worker in a goroutine.
+func (m *Manager) Start() {
+	go func() {
+		for range m.wakeCh {
+			m.processQueue()
+		}
+	}()
+}
+
+func (m *Manager) processQueue() {
+	defer util.HandlePanicInModuleThen("integrity/processQueue", func() {})
+
+	for {
+		m.mu.Lock()
+		if len(m.queue) == 0 {
+			m.current = ""
+			m.checked = 0
+			m.mu.Unlock()
+			m.wsEventManager.SendEvent(events.IntegrityCheckProgress, m.GetStatus())
+			return
+		}
+		j := m.queue[0]
+		m.queue = m.queue[1:]
+		delete(m.queued, j.lf.Path)
+		m.current = j.lf.Path
+		ctx, cancel := context.WithCancel(context.Background())
+		m.cancel = cancel
+		ffprobePath := m.ffprobePath
+		status := m.getStatus()
+		m.mu.Unlock()
+
+		m.wsEventManager.SendEvent(events.IntegrityCheckProgress, status)
+
+		m.processJob(ctx, j, ffprobePath)
+		cancel()
+
+		m.mu.Lock()
+		m.cancel = nil
+		m.checked++
+		m.mu.Unlock()
+	}
+}
+
+func (m *Manager) processJob(ctx context.Context, j *job, ffprobePath string) {
+	if !j.force {
+		previous, err := m.database.GetLocalFileHealth(j.lf.Path)
+		if err == nil {
+			if info, err := os.Stat(j.lf.Path); err == nil && info.Size() == previous.Size && info.ModTime().Equal(previous.ModTime) {
+				return
+			}
+		}
+	}
+
+	settings := m.GetSettings()
+
+	report := Check(ctx, j.lf.Path, &CheckOptions{
+		FfprobePath:  ffprobePath,
+		MaxReadSpeed: settings.MaxReadSpeed,
+	})
+	if ctx.Err() != nil {
+		// Cancelled
+		return
+	}
+	report.MediaId = j.lf.MediaId
+	report.Episode = j.lf.GetEpisodeNumber()
+
+	if err := m.database.UpsertLocalFileHealth(report); err != nil {
+		m.logger.Error().Err(err).Str("path", report.Path).Msg("integrity: Failed to save report")
+	}
+
+	if report.Status == StatusOk {
+		m.logger.Trace().Str("path", report.Path).Msg("integrity: File is healthy")
+		return
+	}
+
+	m.logger.Warn().Str("path", report.Path).Str("status", report.Status).Str("error", report.Error).Msg("integrity: Corrupt file detected")
+	m.wsEventManager.SendEvent(events.WarningToast, fmt.Sprintf("Integrity check failed (%s): %s", report.Status, j.lf.Name))
+
+	if settings.RecheckCorruptTorrents && (report.Status == StatusMismatch || report.Status == StatusTruncated) {
+		if err := m.RecheckTorrent(report.Path); err != nil {
+			m.logger.Debug().Err(err).Str("path", report.Path).Msg("integrity: Could not recheck torrent")
+		}
+	}
+}
+
+// waitFor sleeps for the given duration, returns false if the context is cancelled.
+func waitFor(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
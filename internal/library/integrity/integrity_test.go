@@ -0,0 +1,112 @@
+package integrity
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// matroskaFile returns a minimal Matroska file declaring a segment of segmentSize bytes, with written bytes of segment data.
+func matroskaFile(segmentSize int, written int) []byte {
+	data := []byte{0x1A, 0x45, 0xDF, 0xA3, 0x84, 0x42, 0x82, 0x81, 0x01}
+	data = append(data, 0x18, 0x53, 0x80, 0x67, 0x01)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(segmentSize))
+	data = append(data, size[1:]...)
+	return append(data, make([]byte, written)...)
+}
+
+func mp4Box(boxType string, size int, written int) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, uint32(size))
+	copy(data[4:], boxType)
+	return append(data, make([]byte, written-8)...)
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+
+	validMkv := matroskaFile(100, 100)
+	validMp4 := append(mp4Box("ftyp", 16, 16), mp4Box("mdat", 64, 64)...)
+
+	tests := []struct {
+		name           string
+		filename       string
+		data           []byte
+		expectedStatus string
+	}{
+		{
+			name:           "valid checksum",
+			filename:       fmt.Sprintf("[Group] Show - 01 [%08X].mkv", crc32.ChecksumIEEE(validMkv)),
+			data:           validMkv,
+			expectedStatus: StatusOk,
+		},
+		{
+			name:           "checksum mismatch",
+			filename:       "[Group] Show - 02 [ABCD1234].mkv",
+			data:           validMkv,
+			expectedStatus: StatusMismatch,
+		},
+		{
+			name:           "no checksum",
+			filename:       "Show - 03.mkv",
+			data:           validMkv,
+			expectedStatus: StatusOk,
+		},
+		{
+			name:           "truncated matroska",
+			filename:       "Show - 04.mkv",
+			data:           matroskaFile(100, 60),
+			expectedStatus: StatusTruncated,
+		},
+		{
+			name:           "unknown segment size",
+			filename:       "Show - 05.mkv",
+			data:           append(matroskaFile(100, 0)[:13], append([]byte{0xFF}, make([]byte, 10)...)...),
+			expectedStatus: StatusOk,
+		},
+		{
+			name:           "valid mp4",
+			filename:       "Show - 06.mp4",
+			data:           validMp4,
+			expectedStatus: StatusOk,
+		},
+		{
+			name:           "truncated mp4",
+			filename:       "Show - 07.mp4",
+			data:           append(mp4Box("ftyp", 16, 16), mp4Box("mdat", 64, 40)...),
+			expectedStatus: StatusTruncated,
+		},
+		{
+			name:           "empty file",
+			filename:       "Show - 08.mkv",
+			data:           []byte{},
+			expectedStatus: StatusTruncated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.filename)
+			require.NoError(t, os.WriteFile(path, tt.data, 0644))
+
+			report := Check(context.Background(), path, &CheckOptions{})
+			require.Equal(t, tt.expectedStatus, report.Status, report.Error)
+			require.Equal(t, int64(len(tt.data)), report.Size)
+		})
+	}
+
+	report := Check(context.Background(), filepath.Join(dir, "missing.mkv"), &CheckOptions{})
+	require.Equal(t, StatusMissing, report.Status)
+}
+
+func TestGetFilenameChecksum(t *testing.T) {
+	require.Equal(t, "ABCD1234", GetFilenameChecksum("/anime/[Group] Show - 01 (1080p) [abcd1234].mkv"))
+	require.Equal(t, "", GetFilenameChecksum("/anime/Show - 01 (1080p).mkv"))
+}
@@ -0,0 +1,32 @@
+package integrity
+
+import (
+	"seanime/internal/torrent_clients/torrent_client"
+)
+
+// RecheckTorrent finds the torrent that contains the file in the torrent client and verifies it.
+// The torrent client downloads the corrupt pieces again.
+func (m *Manager) RecheckTorrent(path string) error {
+	m.mu.Lock()
+	repo := m.torrentClientRepository
+	m.mu.Unlock()
+
+	if repo == nil || repo.GetProvider() == torrent_client.NoneClient {
+		return ErrNoTorrentClient
+	}
+
+	torrents, err := repo.FindTorrentsForFiles([]string{path})
+	if err != nil {
+		return err
+	}
+	t, ok := torrents[path]
+	if !ok {
+		return ErrTorrentNotFound
+	}
+
+	m.logger.Info().Str("path", path).Str("torrent", t.Name).Msg("integrity: Rechecking torrent")
+	if err = repo.RecheckTorrents([]string{t.Hash}); err != nil {
+		return err
+	}
+	return repo.ResumeTorrents([]string{t.Hash})
+}
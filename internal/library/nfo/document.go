@@ -0,0 +1,287 @@
+package nfo
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"regexp"
+	"seanime/internal/api/anilist"
+	"seanime/internal/api/metadata"
+	"seanime/internal/library/anime"
+	"strconv"
+	"strings"
+)
+
+// The documents follow the Kodi NFO format, which is also read by Jellyfin, Emby and Plex agents.
+// https://kodi.wiki/view/NFO_files
+
+type (
+	uniqueId struct {
+		Type    string `xml:"type,attr"`
+		Default bool   `xml:"default,attr,omitempty"`
+		Value   string `xml:",chardata"`
+	}
+
+	thumb struct {
+		Aspect string `xml:"aspect,attr,omitempty"`
+		Value  string `xml:",chardata"`
+	}
+
+	ratings struct {
+		Ratings []rating `xml:"rating"`
+	}
+
+	fanart struct {
+		Thumbs []thumb `xml:"thumb"`
+	}
+
+	rating struct {
+		Name    string `xml:"name,attr"`
+		Max     int    `xml:"max,attr"`
+		Default bool   `xml:"default,attr"`
+		Value   string `xml:"value"`
+	}
+
+	tvShowDocument struct {
+		XMLName       xml.Name   `xml:"tvshow"`
+		Title         string     `xml:"title"`
+		OriginalTitle string     `xml:"originaltitle,omitempty"`
+		Plot          string     `xml:"plot,omitempty"`
+		Year          int        `xml:"year,omitempty"`
+		Premiered     string     `xml:"premiered,omitempty"`
+		Status        string     `xml:"status,omitempty"`
+		Genres        []string   `xml:"genre"`
+		Ratings       *ratings   `xml:"ratings,omitempty"`
+		UniqueIds     []uniqueId `xml:"uniqueid"`
+		Thumbs        []thumb    `xml:"thumb"`
+		Fanart        *fanart    `xml:"fanart,omitempty"`
+	}
+
+	movieDocument struct {
+		XMLName       xml.Name   `xml:"movie"`
+		Title         string     `xml:"title"`
+		OriginalTitle string     `xml:"originaltitle,omitempty"`
+		Plot          string     `xml:"plot,omitempty"`
+		Runtime       int        `xml:"runtime,omitempty"`
+		Year          int        `xml:"year,omitempty"`
+		Premiered     string     `xml:"premiered,omitempty"`
+		Genres        []string   `xml:"genre"`
+		Ratings       *ratings   `xml:"ratings,omitempty"`
+		UniqueIds     []uniqueId `xml:"uniqueid"`
+		Thumbs        []thumb    `xml:"thumb"`
+		Fanart        *fanart    `xml:"fanart,omitempty"`
+	}
+
+	episodeDocument struct {
+		XMLName   xml.Name   `xml:"episodedetails"`
+		Title     string     `xml:"title"`
+		ShowTitle string     `xml:"showtitle,omitempty"`
+		Season    int        `xml:"season"`
+		Episode   int        `xml:"episode"`
+		Aired     string     `xml:"aired,omitempty"`
+		Plot      string     `xml:"plot,omitempty"`
+		Runtime   int        `xml:"runtime,omitempty"`
+		UniqueIds []uniqueId `xml:"uniqueid"`
+		Thumbs    []thumb    `xml:"thumb"`
+	}
+)
+
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// newTvShowDocument returns the tvshow.nfo document of the media.
+func newTvShowDocument(media *anilist.BaseAnime, animeMetadata *metadata.AnimeMetadata) *tvShowDocument {
+	doc := &tvShowDocument{
+		Title:         media.GetPreferredTitle(),
+		OriginalTitle: media.GetRomajiTitleSafe(),
+		Plot:          cleanDescription(media.GetDescription()),
+		Year:          getYear(media),
+		Premiered:     getPremiered(media),
+		Genres:        getGenres(media),
+		Ratings:       getRatings(media),
+		UniqueIds:     getMediaUniqueIds(media, animeMetadata),
+	}
+	if doc.OriginalTitle == doc.Title {
+		doc.OriginalTitle = ""
+	}
+	if media.GetStatus() != nil {
+		switch *media.GetStatus() {
+		case anilist.MediaStatusFinished, anilist.MediaStatusCancelled:
+			doc.Status = "Ended"
+		default:
+			doc.Status = "Continuing"
+		}
+	}
+	if poster := media.GetCoverImageSafe(); poster != "" {
+		doc.Thumbs = append(doc.Thumbs, thumb{Aspect: "poster", Value: poster})
+	}
+	if media.GetBannerImage() != nil && *media.GetBannerImage() != "" {
+		doc.Fanart = &fanart{Thumbs: []thumb{{Value: *media.GetBannerImage()}}}
+	}
+	return doc
+}
+
+// newMovieDocument returns the NFO document of a movie.
+func newMovieDocument(media *anilist.BaseAnime, animeMetadata *metadata.AnimeMetadata) *movieDocument {
+	show := newTvShowDocument(media, animeMetadata)
+	doc := &movieDocument{
+		Title:         show.Title,
+		OriginalTitle: show.OriginalTitle,
+		Plot:          show.Plot,
+		Year:          show.Year,
+		Premiered:     show.Premiered,
+		Genres:        show.Genres,
+		Ratings:       show.Ratings,
+		UniqueIds:     show.UniqueIds,
+		Thumbs:        show.Thumbs,
+		Fanart:        show.Fanart,
+	}
+	if media.GetDuration() != nil {
+		doc.Runtime = *media.GetDuration()
+	}
+	return doc
+}
+
+// newEpisodeDocument returns the NFO document of the episode file.
+// Main episodes are in season 1 and specials in season 0 since each AniList media is exported as its own show.
+func newEpisodeDocument(media *anilist.BaseAnime, lf *anime.LocalFile, animeMetadata *metadata.AnimeMetadata) *episodeDocument {
+	doc := &episodeDocument{
+		ShowTitle: media.GetPreferredTitle(),
+		Season:    1,
+		Episode:   lf.GetEpisodeNumber(),
+	}
+
+	if lf.GetType() == anime.LocalFileTypeSpecial {
+		doc.Season = 0
+		if n, err := strconv.Atoi(strings.TrimPrefix(lf.GetAniDBEpisode(), "S")); err == nil {
+			doc.Episode = n
+		}
+	}
+
+	episodeMetadata, found := animeMetadata.FindEpisode(lf.GetAniDBEpisode())
+	if found {
+		doc.Title = episodeMetadata.GetTitle()
+		doc.Aired = episodeMetadata.AirDate
+		doc.Plot = strings.TrimSpace(episodeMetadata.Overview)
+		if doc.Plot == "" {
+			doc.Plot = strings.TrimSpace(episodeMetadata.Summary)
+		}
+		doc.Runtime = episodeMetadata.Length
+		if episodeMetadata.TvdbId > 0 {
+			doc.UniqueIds = append(doc.UniqueIds, uniqueId{Type: "tvdb", Default: true, Value: strconv.Itoa(episodeMetadata.TvdbId)})
+		}
+		if episodeMetadata.AnidbEid > 0 {
+			doc.UniqueIds = append(doc.UniqueIds, uniqueId{Type: "anidb", Default: len(doc.UniqueIds) == 0, Value: strconv.Itoa(episodeMetadata.AnidbEid)})
+		}
+		if episodeMetadata.HasImage && episodeMetadata.Image != "" {
+			doc.Thumbs = append(doc.Thumbs, thumb{Value: episodeMetadata.Image})
+		}
+	}
+
+	if doc.Title == "" {
+		if doc.Season == 0 {
+			doc.Title = fmt.Sprintf("Special %d", doc.Episode)
+		} else {
+			doc.Title = fmt.Sprintf("Episode %d", doc.Episode)
+		}
+	}
+	if doc.Runtime == 0 && media.GetDuration() != nil {
+		doc.Runtime = *media.GetDuration()
+	}
+
+	return doc
+}
+
+// marshalDocument returns the indented XML document with its header.
+func marshalDocument(doc any) ([]byte, error) {
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal nfo: %w", err)
+	}
+	return append([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"), append(data, '\n')...), nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func getMediaUniqueIds(media *anilist.BaseAnime, animeMetadata *metadata.AnimeMetadata) []uniqueId {
+	ret := []uniqueId{{Type: "anilist", Default: true, Value: strconv.Itoa(media.GetID())}}
+
+	mappings := animeMetadata.GetMappings()
+	malId := mappings.MalId
+	if media.GetIDMal() != nil {
+		malId = *media.GetIDMal()
+	}
+	if malId > 0 {
+		ret = append(ret, uniqueId{Type: "mal", Value: strconv.Itoa(malId)})
+	}
+	if mappings.AnidbId > 0 {
+		ret = append(ret, uniqueId{Type: "anidb", Value: strconv.Itoa(mappings.AnidbId)})
+	}
+	if mappings.ThetvdbId > 0 {
+		ret = append(ret, uniqueId{Type: "tvdb", Value: strconv.Itoa(mappings.ThetvdbId)})
+	}
+	if mappings.ImdbId != "" {
+		ret = append(ret, uniqueId{Type: "imdb", Value: mappings.ImdbId})
+	}
+	if mappings.ThemoviedbId != "" {
+		ret = append(ret, uniqueId{Type: "tmdb", Value: mappings.ThemoviedbId})
+	}
+	if mappings.KitsuId > 0 {
+		ret = append(ret, uniqueId{Type: "kitsu", Value: strconv.Itoa(mappings.KitsuId)})
+	}
+	return ret
+}
+
+func getGenres(media *anilist.BaseAnime) []string {
+	ret := make([]string, 0, len(media.GetGenres()))
+	for _, genre := range media.GetGenres() {
+		if genre != nil && *genre != "" {
+			ret = append(ret, *genre)
+		}
+	}
+	return ret
+}
+
+func getRatings(media *anilist.BaseAnime) *ratings {
+	if media.GetMeanScore() == nil || *media.GetMeanScore() == 0 {
+		return nil
+	}
+	return &ratings{Ratings: []rating{{
+		Name:    "anilist",
+		Max:     10,
+		Default: true,
+		Value:   strconv.FormatFloat(float64(*media.GetMeanScore())/10, 'f', 1, 64),
+	}}}
+}
+
+func getYear(media *anilist.BaseAnime) int {
+	if media.GetStartDate() != nil && media.GetStartDate().GetYear() != nil {
+		return *media.GetStartDate().GetYear()
+	}
+	if media.GetSeasonYear() != nil {
+		return *media.GetSeasonYear()
+	}
+	return 0
+}
+
+// getPremiered returns the start date in the YYYY-MM-DD format, or an empty string if it's incomplete.
+func getPremiered(media *anilist.BaseAnime) string {
+	date := media.GetStartDate()
+	if date == nil || date.GetYear() == nil || date.GetMonth() == nil || date.GetDay() == nil {
+		return ""
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", *date.GetYear(), *date.GetMonth(), *date.GetDay())
+}
+
+// cleanDescription removes the HTML tags of AniList descriptions.
+func cleanDescription(description *string) string {
+	if description == nil {
+		return ""
+	}
+	s := strings.NewReplacer("<br>", "\n", "<br/>", "\n", "<br />", "\n").Replace(*description)
+	s = html.UnescapeString(htmlTagRegex.ReplaceAllString(s, ""))
+	// AniList descriptions use <br> followed by a newline
+	for strings.Contains(s, "\n\n\n") {
+		s = strings.ReplaceAll(s, "\n\n\n", "\n\n")
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,471 @@
+package nfo
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"seanime/internal/api/anilist"
+	"seanime/internal/api/metadata"
+	"seanime/internal/api/metadata_provider"
+	"seanime/internal/database/db"
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/database/models"
+	"seanime/internal/library/anime"
+	"seanime/internal/util"
+	"seanime/internal/util/filecache"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"github.com/samber/mo"
+)
+
+const (
+	KindTvShow  = "tvshow"
+	KindEpisode = "episode"
+	KindMovie   = "movie"
+	KindPoster  = "poster"
+	KindFanart  = "fanart"
+
+	settingsBucketName = "nfo-settings"
+	settingsBucketKey  = "1"
+)
+
+var (
+	ErrNoAnimeCollection = errors.New("nfo: anime collection not loaded")
+	ErrExportRunning     = errors.New("nfo: an export is already running")
+)
+
+type (
+	// Manager writes Kodi/Jellyfin NFO files and artwork beside the matched local files.
+	// Files are only written if their content changed, and files that were not created by the exporter are never modified.
+	Manager struct {
+		logger              *zerolog.Logger
+		database            *db.Database
+		fileCacher          *filecache.Cacher
+		metadataProviderRef *util.Ref[metadata_provider.Provider]
+		httpClient          *http.Client
+
+		mu              sync.Mutex // Held during an export
+		collectionMu    sync.RWMutex
+		animeCollection mo.Option[*anilist.AnimeCollection]
+	}
+
+	NewManagerOptions struct {
+		Logger              *zerolog.Logger
+		Database            *db.Database
+		FileCacher          *filecache.Cacher
+		MetadataProviderRef *util.Ref[metadata_provider.Provider]
+	}
+
+	// Settings configures the exporter.
+	Settings struct {
+		// Export the library after each scan
+		ExportAfterScan bool `json:"exportAfterScan"`
+		// Download poster.jpg and fanart.jpg
+		ExportArtwork bool `json:"exportArtwork"`
+	}
+
+	// ExportResult is the summary of an export.
+	ExportResult struct {
+		Written   int `json:"written"`
+		Unchanged int `json:"unchanged"`
+		// Files that already exist and were not created by the exporter
+		Skipped int `json:"skipped"`
+		// Files removed because their local file is no longer in the library
+		Removed int `json:"removed"`
+		Failed  int `json:"failed"`
+	}
+
+	// export holds the state of a single export.
+	export struct {
+		ctx      context.Context
+		settings *Settings
+		manifest map[string]*models.NfoExportedFile
+		kept     map[string]struct{}
+		result   *ExportResult
+	}
+)
+
+func NewManager(opts *NewManagerOptions) *Manager {
+	return &Manager{
+		logger:              opts.Logger,
+		database:            opts.Database,
+		fileCacher:          opts.FileCacher,
+		metadataProviderRef: opts.MetadataProviderRef,
+		httpClient:          &http.Client{Timeout: 30 * time.Second},
+		animeCollection:     mo.None[*anilist.AnimeCollection](),
+	}
+}
+
+func (m *Manager) SetAnimeCollection(ac *anilist.AnimeCollection) {
+	m.collectionMu.Lock()
+	defer m.collectionMu.Unlock()
+	m.animeCollection = mo.Some(ac)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (m *Manager) defaultSettings() *Settings {
+	return &Settings{
+		ExportAfterScan: false,
+		ExportArtwork:   true,
+	}
+}
+
+func (m *Manager) GetSettings() *Settings {
+	bucket := filecache.NewPermanentBucket(settingsBucketName)
+
+	settings := m.defaultSettings()
+	found, _ := m.fileCacher.GetPerm(bucket, settingsBucketKey, settings)
+	if !found {
+		return m.defaultSettings()
+	}
+	return settings
+}
+
+func (m *Manager) SaveSettings(settings *Settings) error {
+	bucket := filecache.NewPermanentBucket(settingsBucketName)
+	return m.fileCacher.SetPerm(bucket, settingsBucketKey, settings)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// OnScanCompleted exports the library if enabled.
+func (m *Manager) OnScanCompleted(lfs []*anime.LocalFile) {
+	defer util.HandlePanicInModuleThen("nfo/OnScanCompleted", func() {})
+
+	if !m.GetSettings().ExportAfterScan {
+		return
+	}
+
+	res, err := m.Export(context.Background(), lfs)
+	if err != nil {
+		if !errors.Is(err, ErrNoAnimeCollection) {
+			m.logger.Error().Err(err).Msg("nfo: Failed to export library")
+		}
+		return
+	}
+	m.logger.Debug().Interface("result", res).Msg("nfo: Exported library")
+}
+
+// ExportLibrary exports the local files saved in the database.
+func (m *Manager) ExportLibrary(ctx context.Context) (*ExportResult, error) {
+	lfs, _, err := db_bridge.GetLocalFiles(m.database)
+	if err != nil {
+		return nil, err
+	}
+	return m.Export(ctx, lfs)
+}
+
+// Export writes the NFO files and artwork of the matched local files.
+// Exported files whose local file is no longer in the library are removed.
+func (m *Manager) Export(ctx context.Context, lfs []*anime.LocalFile) (*ExportResult, error) {
+	if !m.mu.TryLock() {
+		return nil, ErrExportRunning
+	}
+	defer m.mu.Unlock()
+
+	m.collectionMu.RLock()
+	collection, ok := m.animeCollection.Get()
+	m.collectionMu.RUnlock()
+	if !ok || collection == nil {
+		return nil, ErrNoAnimeCollection
+	}
+
+	exportedFiles, err := m.database.GetNfoExportedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &export{
+		ctx:      ctx,
+		settings: m.GetSettings(),
+		manifest: lo.SliceToMap(exportedFiles, func(f *models.NfoExportedFile) (string, *models.NfoExportedFile) {
+			return util.NormalizePath(f.Path), f
+		}),
+		kept:   make(map[string]struct{}),
+		result: &ExportResult{},
+	}
+
+	libraryPaths, _ := m.database.GetAllLibraryPathsFromSettings()
+	dirOwners := getDirOwners(lfs)
+
+	groups := anime.GroupLocalFilesByMediaID(lfs)
+	mediaIds := lo.Keys(groups)
+	slices.Sort(mediaIds)
+
+	for _, mediaId := range mediaIds {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if mediaId == 0 {
+			continue
+		}
+		entry, found := collection.GetListEntryFromAnimeId(mediaId)
+		if !found || entry.GetMedia() == nil {
+			continue
+		}
+		media := entry.GetMedia()
+
+		files := lo.Filter(groups[mediaId], func(lf *anime.LocalFile, _ int) bool {
+			return lf.GetType() == anime.LocalFileTypeMain || lf.GetType() == anime.LocalFileTypeSpecial
+		})
+		if len(files) == 0 {
+			continue
+		}
+
+		var animeMetadata *metadata.AnimeMetadata
+		if m.metadataProviderRef != nil && m.metadataProviderRef.IsPresent() {
+			animeMetadata, _ = m.metadataProviderRef.Get().GetAnimeMetadata(metadata.AnilistPlatform, mediaId)
+		}
+
+		if media.IsMovie() {
+			m.exportMovie(e, media, animeMetadata, files)
+			continue
+		}
+
+		showDir := getShowDir(files)
+		if isShowDirExportable(showDir, mediaId, libraryPaths, dirOwners) {
+			m.exportShow(e, media, animeMetadata, showDir)
+		}
+		for _, lf := range files {
+			m.writeDocument(e, nfoPath(lf.GetPath()), KindEpisode, mediaId, newEpisodeDocument(media, lf, animeMetadata))
+		}
+	}
+
+	// Remove the files of local files that are no longer in the library
+	staleIds := make([]uint, 0)
+	for path, f := range e.manifest {
+		if _, ok := e.kept[path]; ok {
+			continue
+		}
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			m.logger.Warn().Err(err).Str("path", f.Path).Msg("nfo: Failed to remove stale file")
+			continue
+		}
+		staleIds = append(staleIds, f.ID)
+		e.result.Removed++
+	}
+	if err := m.database.DeleteNfoExportedFiles(staleIds); err != nil {
+		return nil, err
+	}
+
+	return e.result, nil
+}
+
+// RemoveExportedFiles removes all the files written by the exporter.
+// Returns the number of files removed
+func (m *Manager) RemoveExportedFiles() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exportedFiles, err := m.database.GetNfoExportedFiles()
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]uint, 0, len(exportedFiles))
+	for _, f := range exportedFiles {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			m.logger.Warn().Err(err).Str("path", f.Path).Msg("nfo: Failed to remove exported file")
+			continue
+		}
+		ids = append(ids, f.ID)
+	}
+
+	if err := m.database.DeleteNfoExportedFiles(ids); err != nil {
+		return 0, err
+	}
+
+	m.logger.Info().Int("count", len(ids)).Msg("nfo: Removed exported files")
+	return len(ids), nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (m *Manager) exportShow(e *export, media *anilist.BaseAnime, animeMetadata *metadata.AnimeMetadata, showDir string) {
+	m.writeDocument(e, filepath.Join(showDir, "tvshow.nfo"), KindTvShow, media.GetID(), newTvShowDocument(media, animeMetadata))
+
+	if e.settings.ExportArtwork {
+		m.writeArtwork(e, filepath.Join(showDir, "poster.jpg"), KindPoster, media.GetID(), media.GetCoverImageSafe())
+		if media.GetBannerImage() != nil {
+			m.writeArtwork(e, filepath.Join(showDir, "fanart.jpg"), KindFanart, media.GetID(), *media.GetBannerImage())
+		}
+	}
+}
+
+// exportMovie writes the NFO and artwork of each file, named after the file.
+func (m *Manager) exportMovie(e *export, media *anilist.BaseAnime, animeMetadata *metadata.AnimeMetadata, files []*anime.LocalFile) {
+	for _, lf := range files {
+		m.writeDocument(e, nfoPath(lf.GetPath()), KindMovie, media.GetID(), newMovieDocument(media, animeMetadata))
+
+		if e.settings.ExportArtwork {
+			base := strings.TrimSuffix(lf.GetPath(), filepath.Ext(lf.GetPath()))
+			m.writeArtwork(e, base+"-poster.jpg", KindPoster, media.GetID(), media.GetCoverImageSafe())
+			if media.GetBannerImage() != nil {
+				m.writeArtwork(e, base+"-fanart.jpg", KindFanart, media.GetID(), *media.GetBannerImage())
+			}
+		}
+	}
+}
+
+func (m *Manager) writeDocument(e *export, path string, kind string, mediaId int, doc any) {
+	data, err := marshalDocument(doc)
+	if err != nil {
+		m.logger.Error().Err(err).Str("path", path).Msg("nfo: Failed to create document")
+		e.result.Failed++
+		return
+	}
+
+	m.writeFile(e, path, kind, mediaId, contentHash(data), func() ([]byte, error) {
+		return data, nil
+	})
+}
+
+// writeArtwork downloads the image if the URL changed since the last export.
+func (m *Manager) writeArtwork(e *export, path string, kind string, mediaId int, url string) {
+	if url == "" {
+		return
+	}
+
+	m.writeFile(e, path, kind, mediaId, contentHash([]byte(url)), func() ([]byte, error) {
+		return m.download(e.ctx, url)
+	})
+}
+
+// writeFile writes the file unless it was not created by the exporter or its hash didn't change.
+func (m *Manager) writeFile(e *export, path string, kind string, mediaId int, hash string, getContent func() ([]byte, error)) {
+	key := util.NormalizePath(path)
+	if _, ok := e.kept[key]; ok {
+		return
+	}
+
+	exported, tracked := e.manifest[key]
+	_, statErr := os.Stat(path)
+	exists := statErr == nil
+
+	if exists && !tracked {
+		e.result.Skipped++
+		return
+	}
+
+	e.kept[key] = struct{}{}
+
+	if exists && exported.Hash == hash {
+		e.result.Unchanged++
+		return
+	}
+
+	content, err := getContent()
+	if err == nil {
+		err = os.WriteFile(path, content, 0644)
+	}
+	if err != nil {
+		m.logger.Warn().Err(err).Str("path", path).Msg("nfo: Failed to write file")
+		e.result.Failed++
+		return
+	}
+
+	err = m.database.UpsertNfoExportedFile(&models.NfoExportedFile{
+		Path:    path,
+		MediaId: mediaId,
+		Kind:    kind,
+		Hash:    hash,
+	})
+	if err != nil {
+		m.logger.Error().Err(err).Str("path", path).Msg("nfo: Failed to save exported file")
+	}
+	e.result.Written++
+}
+
+func (m *Manager) download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func contentHash(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// nfoPath returns the path of the NFO file of a video file.
+func nfoPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".nfo"
+}
+
+// getShowDir returns the deepest directory containing all the files.
+func getShowDir(files []*anime.LocalFile) string {
+	dir := filepath.Dir(files[0].GetPath())
+	for _, lf := range files[1:] {
+		for !util.IsFileUnderDir(lf.GetPath(), dir) {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				return dir
+			}
+			dir = parent
+		}
+	}
+	return dir
+}
+
+// getDirOwners returns the media IDs of the files under each directory.
+func getDirOwners(lfs []*anime.LocalFile) map[string]map[int]struct{} {
+	ret := make(map[string]map[int]struct{})
+	for _, lf := range lfs {
+		dir := filepath.Dir(lf.GetPath())
+		for {
+			key := util.NormalizePath(dir)
+			if _, ok := ret[key]; !ok {
+				ret[key] = make(map[int]struct{})
+			}
+			ret[key][lf.MediaId] = struct{}{}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return ret
+}
+
+// isShowDirExportable returns false if the directory is a library root or contains files of other media,
+// since media centers would use tvshow.nfo for all of them.
+func isShowDirExportable(dir string, mediaId int, libraryPaths []string, dirOwners map[string]map[int]struct{}) bool {
+	key := util.NormalizePath(dir)
+	for _, p := range libraryPaths {
+		if util.NormalizePath(filepath.Clean(p)) == key {
+			return false
+		}
+	}
+	owners := dirOwners[key]
+	if len(owners) != 1 {
+		return false
+	}
+	_, ok := owners[mediaId]
+	return ok
+}
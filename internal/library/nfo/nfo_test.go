@@ -0,0 +1,104 @@
+package nfo
+
+import (
+	"path/filepath"
+	"seanime/internal/api/anilist"
+	"seanime/internal/api/metadata"
+	"seanime/internal/library/anime"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocuments(t *testing.T) {
+	media := &anilist.BaseAnime{
+		ID:          154587,
+		IDMal:       lo.ToPtr(52991),
+		Status:      lo.ToPtr(anilist.MediaStatusFinished),
+		Title:       &anilist.BaseAnime_Title{Romaji: lo.ToPtr("Sousou no Frieren"), UserPreferred: lo.ToPtr("Frieren")},
+		Description: lo.ToPtr("The adventure is over.<br>\n<br>\n<i>Frieren</i> &amp; friends."),
+		Genres:      lo.ToSlicePtr([]string{"Adventure", "Fantasy"}),
+		MeanScore:   lo.ToPtr(91),
+		Duration:    lo.ToPtr(24),
+		StartDate:   &anilist.BaseAnime_StartDate{Year: lo.ToPtr(2023), Month: lo.ToPtr(9), Day: lo.ToPtr(29)},
+		CoverImage:  &anilist.BaseAnime_CoverImage{Large: lo.ToPtr("https://example.com/cover.jpg")},
+	}
+	animeMetadata := &metadata.AnimeMetadata{
+		Episodes: map[string]*metadata.EpisodeMetadata{
+			"1":  {Title: "The Journey's End", AirDate: "2023-09-29", Overview: "The party returns.", TvdbId: 9911, AnidbEid: 271234},
+			"S1": {Title: "Recap"},
+		},
+		Mappings: &metadata.AnimeMappings{AnidbId: 17617, ThetvdbId: 424536},
+	}
+
+	show, err := marshalDocument(newTvShowDocument(media, animeMetadata))
+	require.NoError(t, err)
+	require.Contains(t, string(show), "<title>Frieren</title>")
+	require.Contains(t, string(show), "<originaltitle>Sousou no Frieren</originaltitle>")
+	require.Contains(t, string(show), "<plot>The adventure is over.&#xA;&#xA;Frieren &amp; friends.</plot>")
+	require.Contains(t, string(show), "<premiered>2023-09-29</premiered>")
+	require.Contains(t, string(show), "<status>Ended</status>")
+	require.Contains(t, string(show), `<uniqueid type="anilist" default="true">154587</uniqueid>`)
+	require.Contains(t, string(show), `<uniqueid type="mal">52991</uniqueid>`)
+	require.Contains(t, string(show), `<uniqueid type="tvdb">424536</uniqueid>`)
+	require.Contains(t, string(show), "<value>9.1</value>")
+	require.Contains(t, string(show), `<thumb aspect="poster">https://example.com/cover.jpg</thumb>`)
+	require.NotContains(t, string(show), "<fanart>")
+
+	episode := newEpisodeDocument(media, &anime.LocalFile{Metadata: &anime.LocalFileMetadata{Episode: 1, AniDBEpisode: "1", Type: anime.LocalFileTypeMain}}, animeMetadata)
+	require.Equal(t, "The Journey's End", episode.Title)
+	require.Equal(t, 1, episode.Season)
+	require.Equal(t, 1, episode.Episode)
+	require.Equal(t, "2023-09-29", episode.Aired)
+	require.Equal(t, 24, episode.Runtime)
+	require.Equal(t, []uniqueId{{Type: "tvdb", Default: true, Value: "9911"}, {Type: "anidb", Value: "271234"}}, episode.UniqueIds)
+
+	special := newEpisodeDocument(media, &anime.LocalFile{Metadata: &anime.LocalFileMetadata{Episode: 1, AniDBEpisode: "S1", Type: anime.LocalFileTypeSpecial}}, animeMetadata)
+	require.Equal(t, 0, special.Season)
+	require.Equal(t, 1, special.Episode)
+	require.Equal(t, "Recap", special.Title)
+
+	// Without metadata
+	episode = newEpisodeDocument(media, &anime.LocalFile{Metadata: &anime.LocalFileMetadata{Episode: 2, AniDBEpisode: "2", Type: anime.LocalFileTypeMain}}, nil)
+	require.Equal(t, "Episode 2", episode.Title)
+}
+
+func TestShowDir(t *testing.T) {
+	root := filepath.FromSlash("/anime")
+	newLf := func(mediaId int, path string) *anime.LocalFile {
+		return &anime.LocalFile{Path: filepath.Join(root, filepath.FromSlash(path)), MediaId: mediaId}
+	}
+
+	frieren := []*anime.LocalFile{
+		newLf(1, "Frieren/Season 1/01.mkv"),
+		newLf(1, "Frieren/Season 1/02.mkv"),
+		newLf(1, "Frieren/Specials/S01.mkv"),
+	}
+	loose := []*anime.LocalFile{
+		newLf(2, "Dandadan - 01.mkv"),
+	}
+	shared := []*anime.LocalFile{
+		newLf(3, "Monogatari/Bakemonogatari/01.mkv"),
+		newLf(4, "Monogatari/Nisemonogatari/01.mkv"),
+		newLf(4, "Monogatari/Nisemonogatari/02.mkv"),
+	}
+
+	all := append(append(append([]*anime.LocalFile{}, frieren...), loose...), shared...)
+	owners := getDirOwners(all)
+	libraryPaths := []string{root}
+
+	require.Equal(t, filepath.Join(root, "Frieren"), getShowDir(frieren))
+	require.True(t, isShowDirExportable(getShowDir(frieren), 1, libraryPaths, owners))
+
+	// Files at the root of the library
+	require.Equal(t, root, getShowDir(loose))
+	require.False(t, isShowDirExportable(getShowDir(loose), 2, libraryPaths, owners))
+
+	require.Equal(t, filepath.Join(root, "Monogatari", "Nisemonogatari"), getShowDir(shared[1:]))
+	require.True(t, isShowDirExportable(getShowDir(shared[1:]), 4, libraryPaths, owners))
+	// Directory shared with another media
+	require.False(t, isShowDirExportable(filepath.Join(root, "Monogatari"), 3, libraryPaths, owners))
+
+	require.Equal(t, filepath.Join(root, "Frieren", "Season 1", "01.nfo"), nfoPath(frieren[0].Path))
+}
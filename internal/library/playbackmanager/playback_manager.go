@@ -56,7 +56,8 @@ type (
 		wsEventManager             events.WSEventManagerInterface
 		platformRef                *util.Ref[platform.Platform]
 		metadataProviderRef        *util.Ref[metadata_provider.Provider]
-		refreshAnimeCollectionFunc func() // This function is called to refresh the AniList collection
+		refreshAnimeCollectionFunc func()                    // This function is called to refresh the AniList collection
+		offlineLocalFilesFunc      func() []*anime.LocalFile // Returns the episodes downloaded for offline use
 		mu                         sync.Mutex
 		eventMu                    sync.RWMutex
 		cancel                     context.CancelFunc
@@ -184,7 +185,8 @@ type (
 		PlatformRef                *util.Ref[platform.Platform]
 		MetadataProviderRef        *util.Ref[metadata_provider.Provider]
 		Database                   *db.Database
-		RefreshAnimeCollectionFunc func() // This function is called to refresh the AniList collection
+		RefreshAnimeCollectionFunc func()                    // This function is called to refresh the AniList collection
+		OfflineLocalFilesFunc      func() []*anime.LocalFile // Returns the episodes downloaded for offline use, treated as local files
 		DiscordPresence            *discordrpc_presence.Presence
 		IsOfflineRef               *util.Ref[bool]
 		ContinuityManager          *continuity.Manager
@@ -216,6 +218,7 @@ func New(opts *NewPlaybackManagerOptions) *PlaybackManager {
 		platformRef:                  opts.PlatformRef,
 		metadataProviderRef:          opts.MetadataProviderRef,
 		refreshAnimeCollectionFunc:   opts.RefreshAnimeCollectionFunc,
+		offlineLocalFilesFunc:        opts.OfflineLocalFilesFunc,
 		mu:                           sync.Mutex{},
 		autoPlayMu:                   sync.Mutex{},
 		eventMu:                      sync.RWMutex{},
@@ -34,6 +34,9 @@ func (pm *PlaybackManager) getLocalFilePlaybackDetails(path string) (*anilist.An
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("error getting local files: %s", err.Error())
 	}
+	if pm.offlineLocalFilesFunc != nil {
+		lfs = append(lfs, pm.offlineLocalFilesFunc()...)
+	}
 
 	reqEvent := &PlaybackLocalFileDetailsRequestedEvent{
 		Path:                  path,
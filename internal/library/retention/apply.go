@@ -0,0 +1,159 @@
+package retention
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"seanime/internal/library/filesystem"
+	"seanime/internal/torrent_clients/torrent_client"
+	"seanime/internal/util"
+	"strings"
+)
+
+// markTorrentFiles respects the state of the torrents containing the selected files.
+// Files of torrents that are downloading are always kept.
+// If torrents can be removed, a torrent is removed with its data only if all its video files are deleted.
+// Otherwise, files of torrents that are still seeding are kept.
+func (m *Manager) markTorrentFiles(report *Report, settings *Settings) {
+	m.mu.Lock()
+	repo := m.torrentClientRepository
+	m.mu.Unlock()
+
+	if repo == nil || repo.GetProvider() == torrent_client.NoneClient {
+		return
+	}
+
+	paths := make([]string, 0, len(report.Items))
+	for _, item := range report.Items {
+		if !item.Skipped {
+			paths = append(paths, item.Path)
+		}
+	}
+
+	torrents, err := repo.FindTorrentsForFiles(paths)
+	if err != nil {
+		m.logger.Warn().Err(err).Msg("retention: Could not get the torrents, files of torrents will be deleted")
+		return
+	}
+	if len(torrents) == 0 {
+		return
+	}
+
+	// Selected files grouped by torrent
+	byTorrent := make(map[string][]*ReportItem)
+	for _, item := range report.Items {
+		if t, ok := torrents[item.Path]; ok && !item.Skipped {
+			byTorrent[t.Hash] = append(byTorrent[t.Hash], item)
+		}
+	}
+
+	for hash, items := range byTorrent {
+		t := torrents[items[0].Path]
+
+		skip := func(reason string) {
+			for _, item := range items {
+				item.Skipped = true
+				item.SkipReason = reason
+			}
+		}
+
+		if t.Status == torrent_client.TorrentStatusDownloading {
+			skip("torrent is downloading")
+			continue
+		}
+
+		if settings.RemoveTorrents {
+			files, err := repo.GetFiles(hash)
+			if err != nil {
+				skip("could not get the torrent files")
+				continue
+			}
+			videoFiles := 0
+			for _, f := range files {
+				if util.IsValidVideoExtension(filepath.Ext(f)) {
+					videoFiles++
+				}
+			}
+			allDeleted := videoFiles == len(items)
+			for _, item := range items {
+				allDeleted = allDeleted && item.Action == ActionDelete
+			}
+			if !allDeleted {
+				skip("torrent contains files that are kept")
+				continue
+			}
+			for _, item := range items {
+				item.TorrentHash = hash
+			}
+			continue
+		}
+
+		if t.Status == torrent_client.TorrentStatusSeeding {
+			skip("torrent is seeding")
+		}
+	}
+}
+
+// apply deletes or moves the selected files and returns the paths removed from the library.
+func (m *Manager) apply(report *Report) map[string]struct{} {
+	removed := make(map[string]struct{})
+
+	m.mu.Lock()
+	repo := m.torrentClientRepository
+	m.mu.Unlock()
+
+	removedTorrents := make(map[string]error)
+
+	for _, item := range report.Items {
+		if item.Skipped {
+			continue
+		}
+
+		var err error
+		switch {
+		case item.TorrentHash != "":
+			// The torrent client deletes the files
+			var ok bool
+			if err, ok = removedTorrents[item.TorrentHash]; !ok {
+				err = repo.RemoveTorrents([]string{item.TorrentHash})
+				removedTorrents[item.TorrentHash] = err
+			}
+		case item.Action == ActionDelete:
+			err = os.Remove(item.Path)
+		case item.Action == ActionMove:
+			err = util.MoveFile(item.Path, item.MoveTo)
+		}
+
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			item.Error = err.Error()
+			m.logger.Error().Err(err).Str("path", item.Path).Msg("retention: Failed to remove file")
+			continue
+		}
+
+		item.Done = true
+		removed[item.Path] = struct{}{}
+		m.logger.Debug().Str("path", item.Path).Str("action", string(item.Action)).Str("reason", item.Reason).Msg("retention: File removed")
+	}
+
+	if len(removed) > 0 {
+		libraryPaths, _ := m.database.GetAllLibraryPathsFromSettings()
+		for _, p := range libraryPaths {
+			filesystem.RemoveEmptyDirectories(p, m.logger)
+		}
+	}
+
+	return removed
+}
+
+// getMoveDestination returns the path of the file in the destination directory.
+// The path relative to the library is kept, e.g. "Show/Show - 01.mkv".
+func getMoveDestination(path string, moveTo string, libraryPaths []string) string {
+	for _, root := range libraryPaths {
+		if util.IsFileUnderDir(path, root) {
+			if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+				return filepath.Join(moveTo, rel)
+			}
+		}
+	}
+	return filepath.Join(moveTo, filepath.Base(path))
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package retention
+
+import (
+	"syscall"
+)
+
+// getDiskUsage returns the size and free space of the volume containing the path.
+func getDiskUsage(path string) (*DiskUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return nil, err
+	}
+	return &DiskUsage{
+		Total: stat.Blocks * uint64(stat.Bsize),
+		Free:  stat.Bavail * uint64(stat.Bsize),
+	}, nil
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package retention
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// getDiskUsage returns the size and free space of the volume containing the path.
+func getDiskUsage(path string) (*DiskUsage, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	var freeBytesAvailable, totalBytes, totalFreeBytes uint64
+	r, _, err := getDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&freeBytesAvailable)),
+		uintptr(unsafe.Pointer(&totalBytes)),
+		uintptr(unsafe.Pointer(&totalFreeBytes)),
+	)
+	if r == 0 {
+		return nil, err
+	}
+	return &DiskUsage{
+		Total: totalBytes,
+		Free:  freeBytesAvailable,
+	}, nil
+}
@@ -0,0 +1,263 @@
+package retention
+
+import (
+	"fmt"
+	"os"
+	"seanime/internal/api/anilist"
+	"seanime/internal/library/anime"
+	"seanime/internal/util"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+type (
+	evaluationInput struct {
+		rules        []*Rule
+		localFiles   []*anime.LocalFile
+		collection   *anilist.AnimeCollection
+		watchedAt    map[string]time.Time // Keyed by normalized path
+		libraryPaths []string
+		files        map[string]*fileInfo // Keyed by path, missing files are not in the map
+		diskUsage    func(path string) (*DiskUsage, error)
+		now          time.Time
+	}
+
+	fileInfo struct {
+		size    int64
+		modTime time.Time
+	}
+
+	DiskUsage struct {
+		Total uint64 `json:"total"`
+		Free  uint64 `json:"free"`
+	}
+)
+
+func (d *DiskUsage) UsedPercent() float64 {
+	if d.Total == 0 {
+		return 0
+	}
+	return float64(d.Total-d.Free) / float64(d.Total) * 100
+}
+
+func statFiles(lfs []*anime.LocalFile) map[string]*fileInfo {
+	ret := make(map[string]*fileInfo, len(lfs))
+	for _, lf := range lfs {
+		info, err := os.Stat(lf.Path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		ret[lf.Path] = &fileInfo{size: info.Size(), modTime: info.ModTime()}
+	}
+	return ret
+}
+
+// evaluate returns the files selected by the enabled rules.
+// A file is only selected by the first rule that matches it.
+// Locked files are reported as skipped.
+func evaluate(in *evaluationInput) []*ReportItem {
+	ret := make([]*ReportItem, 0)
+	selected := make(map[string]struct{})
+
+	add := func(rule *Rule, lf *anime.LocalFile, reason string) {
+		if _, ok := selected[lf.Path]; ok {
+			return
+		}
+		selected[lf.Path] = struct{}{}
+
+		item := &ReportItem{
+			Path:     lf.Path,
+			MediaId:  lf.MediaId,
+			Episode:  lf.GetEpisodeNumber(),
+			RuleId:   rule.ID,
+			RuleName: rule.Name,
+			Action:   rule.Action,
+			Reason:   reason,
+		}
+		if info, ok := in.files[lf.Path]; ok {
+			item.Size = info.size
+		}
+		if rule.Action == ActionMove {
+			item.MoveTo = getMoveDestination(lf.Path, rule.MoveTo, in.libraryPaths)
+		}
+		if lf.IsLocked() {
+			item.Skipped = true
+			item.SkipReason = "file is locked"
+		}
+		ret = append(ret, item)
+	}
+
+	for _, rule := range in.rules {
+		if !rule.Enabled {
+			continue
+		}
+
+		switch rule.Type {
+		case RuleTypeWatched:
+			for _, lf := range in.localFiles {
+				entry, ok := in.getScopedEntry(rule, lf)
+				if !ok || !isWatched(lf, entry) {
+					continue
+				}
+				watchedAt, ok := in.watchedAt[lf.GetNormalizedPath()]
+				if !ok {
+					continue
+				}
+				days := int(in.now.Sub(watchedAt).Hours() / 24)
+				if days >= rule.WatchedDays {
+					add(rule, lf, fmt.Sprintf("watched %d days ago", days))
+				}
+			}
+
+		case RuleTypeKeepLast:
+			byMedia := lo.GroupBy(in.localFiles, func(lf *anime.LocalFile) int { return lf.MediaId })
+			for _, mediaId := range sortedKeys(byMedia) {
+				var entry *anilist.AnimeListEntry
+				mainFiles := make([]*anime.LocalFile, 0)
+				for _, lf := range byMedia[mediaId] {
+					e, ok := in.getScopedEntry(rule, lf)
+					if !ok || !lf.IsMain() {
+						continue
+					}
+					entry = e
+					mainFiles = append(mainFiles, lf)
+				}
+				if entry == nil || entry.GetMedia().GetStatus() == nil || *entry.GetMedia().GetStatus() != anilist.MediaStatusReleasing {
+					continue
+				}
+
+				episodes := lo.Uniq(lo.Map(mainFiles, func(lf *anime.LocalFile, _ int) int { return lf.GetEpisodeNumber() }))
+				if len(episodes) <= rule.KeepLast {
+					continue
+				}
+				slices.Sort(episodes)
+				oldestKept := episodes[len(episodes)-rule.KeepLast]
+
+				for _, lf := range mainFiles {
+					if lf.GetEpisodeNumber() < oldestKept && isWatched(lf, entry) {
+						add(rule, lf, fmt.Sprintf("older than the last %d episodes", rule.KeepLast))
+					}
+				}
+			}
+
+		case RuleTypeDiskUsage:
+			roots := in.libraryPaths
+			if rule.LibraryPath != "" {
+				roots = []string{rule.LibraryPath}
+			}
+			for _, root := range roots {
+				in.evaluateDiskUsage(rule, root, add)
+			}
+		}
+	}
+
+	return ret
+}
+
+// evaluateDiskUsage selects whole entries under the root, oldest first, until the disk usage is below the threshold.
+func (in *evaluationInput) evaluateDiskUsage(rule *Rule, root string, add func(*Rule, *anime.LocalFile, string)) {
+	usage, err := in.diskUsage(root)
+	if err != nil || usage.Total == 0 {
+		return
+	}
+	usedPercent := usage.UsedPercent()
+	if usedPercent <= float64(rule.MaxDiskUsagePercent) {
+		return
+	}
+
+	statuses := rule.ListStatuses
+	if len(statuses) == 0 {
+		statuses = []anilist.MediaListStatus{anilist.MediaListStatusCompleted, anilist.MediaListStatusDropped}
+	}
+
+	type candidate struct {
+		mediaId int
+		files   []*anime.LocalFile
+		newest  time.Time
+	}
+	candidates := make(map[int]*candidate)
+	for _, lf := range in.localFiles {
+		if !util.IsFileUnderDir(lf.Path, root) || (rule.LibraryPath != "" && !util.IsFileUnderDir(lf.Path, rule.LibraryPath)) {
+			continue
+		}
+		entry, ok := in.collection.GetListEntryFromAnimeId(lf.MediaId)
+		if !ok || !slices.Contains(statuses, entry.GetStatusSafe()) {
+			continue
+		}
+		info, ok := in.files[lf.Path]
+		if !ok {
+			continue
+		}
+		c, ok := candidates[lf.MediaId]
+		if !ok {
+			c = &candidate{mediaId: lf.MediaId}
+			candidates[lf.MediaId] = c
+		}
+		c.files = append(c.files, lf)
+		if info.modTime.After(c.newest) {
+			c.newest = info.modTime
+		}
+	}
+
+	sorted := lo.Values(candidates)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].newest.Equal(sorted[j].newest) {
+			return sorted[i].mediaId < sorted[j].mediaId
+		}
+		return sorted[i].newest.Before(sorted[j].newest)
+	})
+
+	target := uint64(float64(usage.Total) * float64(rule.MaxDiskUsagePercent) / 100)
+	used := usage.Total - usage.Free
+	reason := fmt.Sprintf("disk usage is %.0f%%, above %d%%", usedPercent, rule.MaxDiskUsagePercent)
+
+	for _, c := range sorted {
+		if used <= target {
+			break
+		}
+		for _, lf := range c.files {
+			add(rule, lf, reason)
+			if !lf.IsLocked() {
+				used -= min(used, uint64(in.files[lf.Path].size))
+			}
+		}
+	}
+}
+
+// getScopedEntry returns the list entry of the file if the file is in the scope of the rule.
+func (in *evaluationInput) getScopedEntry(rule *Rule, lf *anime.LocalFile) (*anilist.AnimeListEntry, bool) {
+	if lf.MediaId == 0 || lf.IsIgnored() {
+		return nil, false
+	}
+	if _, ok := in.files[lf.Path]; !ok {
+		return nil, false
+	}
+	if rule.LibraryPath != "" && !util.IsFileUnderDir(lf.Path, rule.LibraryPath) {
+		return nil, false
+	}
+	entry, ok := in.collection.GetListEntryFromAnimeId(lf.MediaId)
+	if !ok {
+		return nil, false
+	}
+	if len(rule.ListStatuses) > 0 && !slices.Contains(rule.ListStatuses, entry.GetStatusSafe()) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// isWatched returns true if the progress of the entry passed the main episode of the file.
+func isWatched(lf *anime.LocalFile, entry *anilist.AnimeListEntry) bool {
+	if !lf.IsMain() || lf.GetEpisodeNumber() <= 0 {
+		return false
+	}
+	return entry.GetProgressSafe() >= lf.GetEpisodeNumber()
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := lo.Keys(m)
+	slices.Sort(keys)
+	return keys
+}
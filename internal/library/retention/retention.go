@@ -0,0 +1,408 @@
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"seanime/internal/api/anilist"
+	"seanime/internal/database/db"
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/events"
+	"seanime/internal/library/anime"
+	"seanime/internal/torrent_clients/torrent_client"
+	"seanime/internal/util"
+	"seanime/internal/util/filecache"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	settingsBucketName   = "retention-settings"
+	settingsBucketKey    = "1"
+	watchedBucketName    = "retention-watched"
+	watchedBucketKey     = "1"
+	defaultIntervalHours = 24
+)
+
+var (
+	ErrRunInProgress = errors.New("retention: a run is already in progress")
+	ErrInvalidRule   = errors.New("retention: invalid rule")
+)
+
+type (
+	RuleType string
+	Action   string
+)
+
+const (
+	// RuleTypeWatched removes main episodes N days after the progress passed them
+	RuleTypeWatched RuleType = "watched"
+	// RuleTypeKeepLast removes the watched episodes of airing shows, except the last K episodes
+	RuleTypeKeepLast RuleType = "keep_last"
+	// RuleTypeDiskUsage removes whole entries, oldest first, while the disk usage exceeds a threshold
+	RuleTypeDiskUsage RuleType = "disk_usage"
+
+	ActionDelete Action = "delete"
+	ActionMove   Action = "move"
+)
+
+type (
+	// Manager applies the retention rules to the local files.
+	Manager struct {
+		logger                  *zerolog.Logger
+		database                *db.Database
+		fileCacher              *filecache.Cacher
+		wsEventManager          events.WSEventManagerInterface
+		torrentClientRepository *torrent_client.Repository
+		animeCollection         *anilist.AnimeCollection
+		onFilesRemoved          func()
+
+		mu         sync.Mutex
+		runMu      sync.Mutex
+		lastRun    time.Time
+		lastReport *Report
+	}
+
+	NewManagerOptions struct {
+		Logger         *zerolog.Logger
+		Database       *db.Database
+		FileCacher     *filecache.Cacher
+		WSEventManager events.WSEventManagerInterface
+		// OnFilesRemoved is called after files have been removed from the library
+		OnFilesRemoved func()
+	}
+
+	// Settings configures the retention rules.
+	Settings struct {
+		// Run the rules periodically
+		Enabled bool `json:"enabled"`
+		// Hours between two scheduled runs
+		IntervalHours int `json:"intervalHours"`
+		// Remove the torrent (and its data) from the torrent client when all its files are deleted.
+		// Otherwise, files of torrents that are still seeding are kept.
+		RemoveTorrents bool    `json:"removeTorrents"`
+		Rules          []*Rule `json:"rules"`
+	}
+
+	// Rule selects local files to delete or move.
+	Rule struct {
+		ID      string   `json:"id"`
+		Name    string   `json:"name"`
+		Enabled bool     `json:"enabled"`
+		Type    RuleType `json:"type"`
+		// Only files in this directory, all library paths if empty
+		LibraryPath string `json:"libraryPath"`
+		// Only entries with these list statuses, all if empty.
+		// Defaults to COMPLETED and DROPPED for disk usage rules.
+		ListStatuses []anilist.MediaListStatus `json:"listStatuses"`
+		// RuleTypeWatched: days after the episode was watched
+		WatchedDays int `json:"watchedDays"`
+		// RuleTypeKeepLast: number of episodes to keep
+		KeepLast int `json:"keepLast"`
+		// RuleTypeDiskUsage: disk usage percentage above which entries are removed
+		MaxDiskUsagePercent int    `json:"maxDiskUsagePercent"`
+		Action              Action `json:"action"`
+		// ActionMove: the directory files are moved to, the path relative to the library is kept
+		MoveTo string `json:"moveTo"`
+	}
+
+	// Report lists the files selected by the rules and what was done with them.
+	Report struct {
+		DryRun    bool          `json:"dryRun"`
+		CreatedAt time.Time     `json:"createdAt"`
+		Items     []*ReportItem `json:"items"`
+		// Bytes freed, or that would be freed in a dry run
+		FreedBytes int64 `json:"freedBytes"`
+	}
+
+	ReportItem struct {
+		Path     string `json:"path"`
+		MediaId  int    `json:"mediaId"`
+		Episode  int    `json:"episode"`
+		Size     int64  `json:"size"`
+		RuleId   string `json:"ruleId"`
+		RuleName string `json:"ruleName"`
+		Action   Action `json:"action"`
+		MoveTo   string `json:"moveTo,omitempty"`
+		// Why the rule selected the file
+		Reason string `json:"reason"`
+		// Hash of the torrent removed from the torrent client with the file
+		TorrentHash string `json:"torrentHash,omitempty"`
+		Skipped     bool   `json:"skipped"`
+		SkipReason  string `json:"skipReason,omitempty"`
+		Error       string `json:"error,omitempty"`
+		Done        bool   `json:"done"`
+	}
+)
+
+func NewManager(opts *NewManagerOptions) *Manager {
+	return &Manager{
+		logger:         opts.Logger,
+		database:       opts.Database,
+		fileCacher:     opts.FileCacher,
+		wsEventManager: opts.WSEventManager,
+		onFilesRemoved: opts.OnFilesRemoved,
+	}
+}
+
+func (m *Manager) SetTorrentClientRepository(repo *torrent_client.Repository) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.torrentClientRepository = repo
+}
+
+func (m *Manager) SetAnimeCollection(ac *anilist.AnimeCollection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.animeCollection = ac
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (m *Manager) defaultSettings() *Settings {
+	return &Settings{
+		Enabled:        false,
+		IntervalHours:  defaultIntervalHours,
+		RemoveTorrents: false,
+		Rules:          make([]*Rule, 0),
+	}
+}
+
+func (m *Manager) GetSettings() *Settings {
+	bucket := filecache.NewPermanentBucket(settingsBucketName)
+
+	settings := m.defaultSettings()
+	found, _ := m.fileCacher.GetPerm(bucket, settingsBucketKey, settings)
+	if !found {
+		return m.defaultSettings()
+	}
+	if settings.Rules == nil {
+		settings.Rules = make([]*Rule, 0)
+	}
+	return settings
+}
+
+func (m *Manager) SaveSettings(settings *Settings) error {
+	if settings.IntervalHours < 1 {
+		settings.IntervalHours = 1
+	}
+	if settings.Rules == nil {
+		settings.Rules = make([]*Rule, 0)
+	}
+	for _, rule := range settings.Rules {
+		if err := validateRule(rule); err != nil {
+			return err
+		}
+		if rule.ID == "" {
+			rule.ID = uuid.NewString()
+		}
+	}
+	bucket := filecache.NewPermanentBucket(settingsBucketName)
+	return m.fileCacher.SetPerm(bucket, settingsBucketKey, settings)
+}
+
+func validateRule(rule *Rule) error {
+	switch rule.Type {
+	case RuleTypeWatched:
+		if rule.WatchedDays < 0 {
+			return fmt.Errorf("%w: %q: the number of days must be positive", ErrInvalidRule, rule.Name)
+		}
+	case RuleTypeKeepLast:
+		if rule.KeepLast < 1 {
+			return fmt.Errorf("%w: %q: at least one episode must be kept", ErrInvalidRule, rule.Name)
+		}
+	case RuleTypeDiskUsage:
+		if rule.MaxDiskUsagePercent < 1 || rule.MaxDiskUsagePercent > 100 {
+			return fmt.Errorf("%w: %q: the disk usage must be between 1 and 100", ErrInvalidRule, rule.Name)
+		}
+	default:
+		return fmt.Errorf("%w: %q: unknown type %q", ErrInvalidRule, rule.Name, rule.Type)
+	}
+	switch rule.Action {
+	case ActionDelete:
+	case ActionMove:
+		if rule.MoveTo == "" {
+			return fmt.Errorf("%w: %q: no destination", ErrInvalidRule, rule.Name)
+		}
+	default:
+		return fmt.Errorf("%w: %q: unknown action %q", ErrInvalidRule, rule.Name, rule.Action)
+	}
+	return nil
+}
+
+// GetLastReport returns the report of the last run, nil if the rules haven't run yet.
+func (m *Manager) GetLastReport() *Report {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastReport
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// RunScheduled applies the rules if enabled and the last run is older than the configured interval.
+// This is called periodically.
+func (m *Manager) RunScheduled() {
+	defer util.HandlePanicInModuleThen("retention/RunScheduled", func() {})
+
+	settings := m.GetSettings()
+	if !settings.Enabled || len(settings.Rules) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	lastRun := m.lastRun
+	m.mu.Unlock()
+	if time.Since(lastRun) < time.Duration(settings.IntervalHours)*time.Hour {
+		// Still record when episodes are watched
+		if lfs, _, err := db_bridge.GetLocalFiles(m.database); err == nil {
+			m.updateWatchedTimes(lfs)
+		}
+		return
+	}
+
+	report, err := m.Run(false)
+	if err != nil {
+		m.logger.Error().Err(err).Msg("retention: Scheduled run failed")
+		return
+	}
+
+	done := 0
+	for _, item := range report.Items {
+		if item.Done {
+			done++
+		}
+	}
+	if done > 0 {
+		m.wsEventManager.SendEvent(events.InfoToast, fmt.Sprintf("Retention rules removed %d files (%s)", done, util.Bytes(uint64(report.FreedBytes))))
+	}
+}
+
+// Run applies the enabled rules to the local files.
+// In a dry run, nothing is changed and the report lists what would be done.
+func (m *Manager) Run(dryRun bool) (*Report, error) {
+	if !m.runMu.TryLock() {
+		return nil, ErrRunInProgress
+	}
+	defer m.runMu.Unlock()
+
+	settings := m.GetSettings()
+
+	lfs, lfsId, err := db_bridge.GetLocalFiles(m.database)
+	if err != nil {
+		return nil, err
+	}
+
+	libraryPaths, err := m.database.GetAllLibraryPathsFromSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	collection := m.animeCollection
+	m.mu.Unlock()
+
+	watchedAt := m.updateWatchedTimes(lfs)
+
+	items := evaluate(&evaluationInput{
+		rules:        settings.Rules,
+		localFiles:   lfs,
+		collection:   collection,
+		watchedAt:    watchedAt,
+		libraryPaths: libraryPaths,
+		files:        statFiles(lfs),
+		diskUsage:    getDiskUsage,
+		now:          time.Now(),
+	})
+
+	report := &Report{
+		DryRun:    dryRun,
+		CreatedAt: time.Now(),
+		Items:     items,
+	}
+
+	m.markTorrentFiles(report, settings)
+
+	if !dryRun {
+		removed := m.apply(report)
+		if len(removed) > 0 {
+			if err = m.removeLocalFiles(lfs, lfsId, removed); err != nil {
+				m.logger.Error().Err(err).Msg("retention: Failed to update local files")
+			}
+		}
+	}
+
+	for _, item := range report.Items {
+		if !item.Skipped && item.Error == "" {
+			report.FreedBytes += item.Size
+		}
+	}
+
+	m.logger.Info().Bool("dryRun", dryRun).Int("items", len(report.Items)).Int64("freedBytes", report.FreedBytes).Msg("retention: Rules applied")
+
+	m.mu.Lock()
+	m.lastReport = report
+	if !dryRun {
+		m.lastRun = time.Now()
+	}
+	m.mu.Unlock()
+
+	return report, nil
+}
+
+// removeLocalFiles removes the deleted and moved files from the library.
+func (m *Manager) removeLocalFiles(lfs []*anime.LocalFile, lfsId uint, removed map[string]struct{}) error {
+	remaining := make([]*anime.LocalFile, 0, len(lfs))
+	for _, lf := range lfs {
+		if _, ok := removed[lf.Path]; !ok {
+			remaining = append(remaining, lf)
+		}
+	}
+
+	if _, err := db_bridge.SaveLocalFiles(m.database, lfsId, remaining); err != nil {
+		return err
+	}
+
+	if m.onFilesRemoved != nil {
+		go m.onFilesRemoved()
+	}
+	return nil
+}
+
+// updateWatchedTimes records when each main episode was first seen as watched and returns the records.
+// AniList only stores the progress, so the delay of watched rules starts when the progress is first seen.
+func (m *Manager) updateWatchedTimes(lfs []*anime.LocalFile) map[string]time.Time {
+	bucket := filecache.NewPermanentBucket(watchedBucketName)
+
+	watchedAt := make(map[string]time.Time)
+	_, _ = m.fileCacher.GetPerm(bucket, watchedBucketKey, &watchedAt)
+
+	m.mu.Lock()
+	collection := m.animeCollection
+	m.mu.Unlock()
+	if collection == nil {
+		return watchedAt
+	}
+
+	now := time.Now()
+	ret := make(map[string]time.Time, len(watchedAt))
+	for _, lf := range lfs {
+		entry, ok := collection.GetListEntryFromAnimeId(lf.MediaId)
+		if !ok || !isWatched(lf, entry) {
+			continue
+		}
+		key := lf.GetNormalizedPath()
+		if t, ok := watchedAt[key]; ok {
+			ret[key] = t
+		} else {
+			ret[key] = now
+		}
+	}
+
+	if err := m.fileCacher.SetPerm(bucket, watchedBucketKey, ret); err != nil {
+		m.logger.Error().Err(err).Msg("retention: Failed to save watched episodes")
+	}
+
+	return ret
+}
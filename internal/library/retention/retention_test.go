@@ -0,0 +1,147 @@
+package retention
+
+import (
+	"path/filepath"
+	"seanime/internal/api/anilist"
+	"seanime/internal/library/anime"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func testEntry(mediaId int, status anilist.MediaListStatus, progress int, mediaStatus anilist.MediaStatus) *anilist.AnimeListEntry {
+	return &anilist.AnimeListEntry{
+		Status:   &status,
+		Progress: &progress,
+		Media:    &anilist.BaseAnime{ID: mediaId, Status: &mediaStatus},
+	}
+}
+
+func testLocalFile(root string, mediaId int, episode int) *anime.LocalFile {
+	return &anime.LocalFile{
+		Path:    filepath.Join(root, "Show "+lo.RandomString(4, lo.LettersCharset), "ep.mkv"),
+		MediaId: mediaId,
+		Metadata: &anime.LocalFileMetadata{
+			Episode: episode,
+			Type:    anime.LocalFileTypeMain,
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	root := filepath.FromSlash("/anime")
+	now := time.Now()
+
+	collection := &anilist.AnimeCollection{
+		MediaListCollection: &anilist.AnimeCollection_MediaListCollection{
+			Lists: []*anilist.AnimeCollection_MediaListCollection_Lists{
+				{Entries: []*anilist.AnimeListEntry{
+					testEntry(1, anilist.MediaListStatusCurrent, 2, anilist.MediaStatusFinished),
+					testEntry(2, anilist.MediaListStatusCurrent, 4, anilist.MediaStatusReleasing),
+					testEntry(3, anilist.MediaListStatusCompleted, 12, anilist.MediaStatusFinished),
+					testEntry(4, anilist.MediaListStatusDropped, 1, anilist.MediaStatusFinished),
+				}},
+			},
+		},
+	}
+
+	// Media 1: episodes 1 and 2 watched, 3 not watched
+	m1e1, m1e2, m1e3 := testLocalFile(root, 1, 1), testLocalFile(root, 1, 2), testLocalFile(root, 1, 3)
+	m1e2.Locked = true
+	// Media 2: airing, episodes 1 to 5, progress 4
+	m2 := []*anime.LocalFile{testLocalFile(root, 2, 1), testLocalFile(root, 2, 2), testLocalFile(root, 2, 3), testLocalFile(root, 2, 4), testLocalFile(root, 2, 5)}
+	// Media 3 and 4: completed and dropped
+	m3 := testLocalFile(root, 3, 1)
+	m4 := testLocalFile(root, 4, 1)
+
+	lfs := append([]*anime.LocalFile{m1e1, m1e2, m1e3, m3, m4}, m2...)
+
+	files := make(map[string]*fileInfo)
+	for _, lf := range lfs {
+		files[lf.Path] = &fileInfo{size: 100, modTime: now}
+	}
+	files[m4.Path].modTime = now.Add(-time.Hour)
+
+	newInput := func(rules ...*Rule) *evaluationInput {
+		return &evaluationInput{
+			rules:      rules,
+			localFiles: lfs,
+			collection: collection,
+			watchedAt: map[string]time.Time{
+				m1e1.GetNormalizedPath():  now.Add(-10 * 24 * time.Hour),
+				m1e2.GetNormalizedPath():  now.Add(-10 * 24 * time.Hour),
+				m2[0].GetNormalizedPath(): now,
+			},
+			libraryPaths: []string{root},
+			files:        files,
+			diskUsage: func(path string) (*DiskUsage, error) {
+				return &DiskUsage{Total: 1000, Free: 50}, nil
+			},
+			now: now,
+		}
+	}
+
+	itemPaths := func(items []*ReportItem) []string {
+		return lo.Map(items, func(item *ReportItem, _ int) string { return item.Path })
+	}
+
+	t.Run("watched", func(t *testing.T) {
+		items := evaluate(newInput(&Rule{Enabled: true, Type: RuleTypeWatched, WatchedDays: 7, Action: ActionDelete}))
+		require.Equal(t, []string{m1e1.Path, m1e2.Path}, itemPaths(items))
+		require.False(t, items[0].Skipped)
+		require.True(t, items[1].Skipped, "locked files are skipped")
+
+		// Not watched long enough
+		items = evaluate(newInput(&Rule{Enabled: true, Type: RuleTypeWatched, WatchedDays: 11, Action: ActionDelete}))
+		require.Empty(t, items)
+
+		// List status scope
+		items = evaluate(newInput(&Rule{Enabled: true, Type: RuleTypeWatched, ListStatuses: []anilist.MediaListStatus{anilist.MediaListStatusCompleted}, Action: ActionDelete}))
+		require.Empty(t, items)
+	})
+
+	t.Run("keep last", func(t *testing.T) {
+		items := evaluate(newInput(&Rule{Enabled: true, Type: RuleTypeKeepLast, KeepLast: 2, Action: ActionDelete}))
+		// Episodes 4 and 5 are kept, media 1 is not airing
+		require.Equal(t, []string{m2[0].Path, m2[1].Path, m2[2].Path}, itemPaths(items))
+	})
+
+	t.Run("disk usage", func(t *testing.T) {
+		// 950/1000 used, 900 allowed, the oldest entry (dropped) frees 100 bytes
+		items := evaluate(newInput(&Rule{Enabled: true, Type: RuleTypeDiskUsage, MaxDiskUsagePercent: 90, Action: ActionDelete}))
+		require.Equal(t, []string{m4.Path}, itemPaths(items))
+
+		// 800 allowed, both entries are removed
+		items = evaluate(newInput(&Rule{Enabled: true, Type: RuleTypeDiskUsage, MaxDiskUsagePercent: 80, Action: ActionDelete}))
+		require.Equal(t, []string{m4.Path, m3.Path}, itemPaths(items))
+
+		items = evaluate(newInput(&Rule{Enabled: true, Type: RuleTypeDiskUsage, MaxDiskUsagePercent: 96, Action: ActionDelete}))
+		require.Empty(t, items)
+	})
+
+	t.Run("move", func(t *testing.T) {
+		moveTo := filepath.FromSlash("/archive")
+		items := evaluate(newInput(
+			&Rule{Enabled: true, Type: RuleTypeWatched, WatchedDays: 7, Action: ActionMove, MoveTo: moveTo},
+			&Rule{Enabled: true, Type: RuleTypeWatched, WatchedDays: 0, Action: ActionDelete},
+		))
+		// Files are only selected by the first matching rule
+		require.Len(t, items, 3)
+		require.Equal(t, ActionMove, items[0].Action)
+		rel, err := filepath.Rel(root, m1e1.Path)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(moveTo, rel), items[0].MoveTo)
+		require.Equal(t, m2[0].Path, items[2].Path)
+		require.Equal(t, ActionDelete, items[2].Action)
+	})
+}
+
+func TestValidateRule(t *testing.T) {
+	require.NoError(t, validateRule(&Rule{Type: RuleTypeWatched, WatchedDays: 3, Action: ActionDelete}))
+	require.ErrorIs(t, validateRule(&Rule{Type: RuleTypeKeepLast, KeepLast: 0, Action: ActionDelete}), ErrInvalidRule)
+	require.ErrorIs(t, validateRule(&Rule{Type: RuleTypeDiskUsage, MaxDiskUsagePercent: 120, Action: ActionDelete}), ErrInvalidRule)
+	require.ErrorIs(t, validateRule(&Rule{Type: RuleTypeWatched, Action: ActionMove}), ErrInvalidRule)
+	require.ErrorIs(t, validateRule(&Rule{Type: "unknown", Action: ActionDelete}), ErrInvalidRule)
+}
@@ -32,6 +32,10 @@ type MatchingRule struct {
 
 type HydrationConfig struct {
 	Rules []*HydrationRule `json:"rules"`
+	// UseTvdbMapping resolves "S02E05" and "Season 2/05" style numbering through the TVDB mapping of the metadata provider.
+	// The season and episode are looked up in the matched media and its relations sharing the same TVDB show,
+	// so split-cour entries and specials (season 0) get the right AniList media and AniDB episode.
+	UseTvdbMapping bool `json:"useTvdbMapping"`
 }
 
 // HydrationRule defines a rule for attaching metadata to local files.
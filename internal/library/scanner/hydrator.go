@@ -142,6 +142,11 @@ func (fh *FileHydrator) hydrateGroupMetadata(
 	var mediaTreeAnalysis *MediaTreeAnalysis
 	treeFetched := false
 	mediaTreeAnalysisMu := sync.Mutex{}
+	// Resolves TVDB season/episode numbering, if enabled
+	var tvdbResolver *tvdbEpisodeResolver
+	if fh.Config != nil && fh.Config.Hydration.UseTvdbMapping {
+		tvdbResolver = newTvdbEpisodeResolver(fh, media, rateLimiter)
+	}
 
 	// Process each local file in the group sequentially
 	lop.ForEach(lfs, func(lf *anime.LocalFile, index int) {
@@ -230,6 +235,11 @@ func (fh *FileHydrator) hydrateGroupMetadata(
 			return
 		}
 
+		// TVDB season/episode numbering
+		if tvdbResolver != nil && fh.applyTvdbMapping(tvdbResolver, lf, mId, episode) {
+			return
+		}
+
 		// Special metadata
 		if lf.IsProbablySpecial() {
 			lf.Metadata.Type = anime.LocalFileTypeSpecial
@@ -0,0 +1,57 @@
+package scanner
+
+import (
+	"seanime/internal/library/anime"
+	"seanime/internal/metrics"
+	"time"
+)
+
+var (
+	scansCounter = metrics.NewCounterVec(
+		"scans_total",
+		"Number of library scans, by result.",
+		"result",
+	)
+	scanDurationHistogram = metrics.NewHistogramVec(
+		"scan_duration_seconds",
+		"Duration of library scans.",
+		[]float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800},
+	)
+	scanFilesGauge = metrics.NewGaugeVec(
+		"scan_files",
+		"Number of local files found by the last successful scan, by state.",
+		"state",
+	)
+)
+
+// observeScan records the result of a scan.
+// It is deferred before the panic handler so that recovered panics are counted as failures.
+func observeScan(startTime time.Time, lfs *[]*anime.LocalFile, err *error) {
+	if *err != nil {
+		scansCounter.With("error").Inc()
+		return
+	}
+
+	scansCounter.With("success").Inc()
+	scanDurationHistogram.With().Observe(time.Since(startTime).Seconds())
+
+	var matched, unmatched, locked, ignored int
+	for _, lf := range *lfs {
+		if lf.MediaId != 0 {
+			matched++
+		} else {
+			unmatched++
+		}
+		if lf.IsLocked() {
+			locked++
+		}
+		if lf.IsIgnored() {
+			ignored++
+		}
+	}
+	scanFilesGauge.With("total").Set(float64(len(*lfs)))
+	scanFilesGauge.With("matched").Set(float64(matched))
+	scanFilesGauge.With("unmatched").Set(float64(unmatched))
+	scanFilesGauge.With("locked").Set(float64(locked))
+	scanFilesGauge.With("ignored").Set(float64(ignored))
+}
@@ -56,6 +56,7 @@ type Scanner struct {
 
 // Scan will scan the directory and return a list of anime.LocalFile.
 func (scn *Scanner) Scan(ctx context.Context) (lfs []*anime.LocalFile, err error) {
+	defer observeScan(time.Now(), &lfs, &err)
 	defer util.HandlePanicWithError(&err)
 
 	go anime.EpisodeCollectionFromLocalFilesCache.Clear()
@@ -0,0 +1,271 @@
+package scanner
+
+import (
+	"seanime/internal/api/anilist"
+	"seanime/internal/api/metadata"
+	"seanime/internal/library/anime"
+	"seanime/internal/util"
+	"seanime/internal/util/limiter"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/sourcegraph/conc/pool"
+)
+
+// DEVNOTE: Libraries managed by Sonarr use TVDB numbering (e.g. "Show S02E05", "Show/Season 2/05.mkv").
+// A TVDB season can span multiple AniList entries (split-cour shows), and TVDB specials are in season 0.
+// The metadata provider maps each AniDB episode to its TVDB show, season and episode number,
+// so we look up the (show, season, episode) triple in the matched media and its relations.
+
+type (
+	// tvdbEpisodeResolver resolves TVDB season and episode numbers to AniList media and AniDB episodes.
+	// It is shared by the files of a media group, the metadata of the related media is only fetched when needed.
+	tvdbEpisodeResolver struct {
+		fh          *FileHydrator
+		media       *anime.NormalizedMedia
+		rateLimiter *limiter.Limiter
+
+		mu         sync.Mutex
+		loaded     bool
+		treeLoaded bool
+		showId     int
+		// The matched media first, then the related media sharing the same TVDB show
+		candidates []*tvdbCandidate
+	}
+
+	tvdbCandidate struct {
+		mediaId       int
+		animeMetadata *metadata.AnimeMetadata
+	}
+
+	tvdbEpisode struct {
+		MediaId      int
+		Episode      int
+		AniDBEpisode string
+		Type         anime.LocalFileType
+	}
+)
+
+func newTvdbEpisodeResolver(fh *FileHydrator, media *anime.NormalizedMedia, rateLimiter *limiter.Limiter) *tvdbEpisodeResolver {
+	return &tvdbEpisodeResolver{
+		fh:          fh,
+		media:       media,
+		rateLimiter: rateLimiter,
+		candidates:  make([]*tvdbCandidate, 0),
+	}
+}
+
+// resolve returns the AniList media and episode corresponding to the TVDB season and episode.
+func (r *tvdbEpisodeResolver) resolve(season int, episode int) (*tvdbEpisode, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.loaded {
+		r.loaded = true
+		r.rateLimiter.Wait()
+		animeMetadata, err := r.fh.MetadataProviderRef.Get().GetAnimeMetadata(metadata.AnilistPlatform, r.media.ID)
+		if err != nil || animeMetadata == nil {
+			return nil, false
+		}
+		r.showId = animeMetadata.GetMappings().ThetvdbId
+		r.candidates = append(r.candidates, &tvdbCandidate{mediaId: r.media.ID, animeMetadata: animeMetadata})
+	}
+
+	if r.showId == 0 {
+		return nil, false
+	}
+
+	if ret, ok := findTvdbEpisode(r.candidates, r.showId, season, episode); ok {
+		return ret, true
+	}
+
+	// The episode might belong to another part of the season or a sequel
+	if r.treeLoaded || r.fh.ForceMediaId != 0 {
+		return nil, false
+	}
+	r.treeLoaded = true
+	r.loadRelatedCandidates()
+
+	return findTvdbEpisode(r.candidates, r.showId, season, episode)
+}
+
+// loadRelatedCandidates fetches the media tree and keeps the related media that share the TVDB show.
+func (r *tvdbEpisodeResolver) loadRelatedCandidates() {
+	tree := anilist.NewCompleteAnimeRelationTree()
+	if err := r.media.FetchMediaTree(anilist.FetchMediaTreeAll, r.fh.PlatformRef.Get().GetAnilistClient(), r.fh.AnilistRateLimiter, tree, r.fh.CompleteAnimeCache); err != nil {
+		if r.fh.ScanLogger != nil {
+			r.fh.ScanLogger.LogFileHydrator(zerolog.ErrorLevel).
+				Int("mediaId", r.media.ID).
+				Str("error", err.Error()).
+				Msg("TVDB mapping: Could not fetch media tree")
+		}
+		return
+	}
+
+	relationIds := make([]int, 0)
+	tree.Range(func(key int, value *anilist.CompleteAnime) bool {
+		if key != r.media.ID {
+			relationIds = append(relationIds, key)
+		}
+		return true
+	})
+	slices.Sort(relationIds)
+
+	p := pool.NewWithResults[*tvdbCandidate]()
+	for _, id := range relationIds {
+		p.Go(func() *tvdbCandidate {
+			r.rateLimiter.Wait()
+			animeMetadata, err := r.fh.MetadataProviderRef.Get().GetAnimeMetadata(metadata.AnilistPlatform, id)
+			if err != nil || animeMetadata == nil || !sharesTvdbShow(animeMetadata, r.showId) {
+				return nil
+			}
+			return &tvdbCandidate{mediaId: id, animeMetadata: animeMetadata}
+		})
+	}
+
+	// Results are in the order of the tasks
+	for _, c := range p.Wait() {
+		if c != nil {
+			r.candidates = append(r.candidates, c)
+		}
+	}
+
+	if r.fh.ScanLogger != nil {
+		r.fh.ScanLogger.LogFileHydrator(zerolog.DebugLevel).
+			Int("mediaId", r.media.ID).
+			Int("tvdbShowId", r.showId).
+			Int("candidates", len(r.candidates)).
+			Msg("TVDB mapping: Related media fetched")
+	}
+}
+
+func sharesTvdbShow(animeMetadata *metadata.AnimeMetadata, showId int) bool {
+	if animeMetadata.GetMappings().ThetvdbId == showId {
+		return true
+	}
+	for _, ep := range animeMetadata.Episodes {
+		if ep.TvdbShowId == showId {
+			return true
+		}
+	}
+	return false
+}
+
+// findTvdbEpisode finds the episode with the TVDB season and episode number in the candidates.
+// Main episodes are preferred over specials, and earlier candidates over later ones.
+func findTvdbEpisode(candidates []*tvdbCandidate, showId int, season int, episode int) (*tvdbEpisode, bool) {
+	var special *tvdbEpisode
+
+	for _, c := range candidates {
+		var ret *tvdbEpisode
+		for key, ep := range c.animeMetadata.Episodes {
+			if ep.SeasonNumber != season || ep.EpisodeNumber != episode {
+				continue
+			}
+			epShowId := ep.TvdbShowId
+			if epShowId == 0 {
+				epShowId = c.animeMetadata.GetMappings().ThetvdbId
+			}
+			if epShowId != showId {
+				continue
+			}
+
+			found, ok := toTvdbEpisode(c.mediaId, key)
+			if !ok {
+				continue
+			}
+			// Keep the lowest AniDB episode if several are mapped to the same TVDB episode
+			if ret == nil || (found.Type == ret.Type && found.Episode < ret.Episode) || (found.Type == anime.LocalFileTypeMain && ret.Type != anime.LocalFileTypeMain) {
+				ret = found
+			}
+		}
+		if ret == nil {
+			continue
+		}
+		if ret.Type == anime.LocalFileTypeMain {
+			return ret, true
+		}
+		if special == nil {
+			special = ret
+		}
+	}
+
+	return special, special != nil
+}
+
+// toTvdbEpisode converts an AniDB episode key ("5", "S2") to the episode of the local file.
+func toTvdbEpisode(mediaId int, key string) (*tvdbEpisode, bool) {
+	if ep, ok := util.StringToInt(key); ok {
+		return &tvdbEpisode{MediaId: mediaId, Episode: ep, AniDBEpisode: key, Type: anime.LocalFileTypeMain}, true
+	}
+	if n, found := strings.CutPrefix(key, "S"); found {
+		if ep, ok := util.StringToInt(n); ok {
+			return &tvdbEpisode{MediaId: mediaId, Episode: ep, AniDBEpisode: key, Type: anime.LocalFileTypeSpecial}, true
+		}
+	}
+	// Credits, trailers, etc. are not mapped
+	return nil, false
+}
+
+// getTvdbSeason returns the season number from the filename, or from the closest folder name.
+func getTvdbSeason(lf *anime.LocalFile) (int, bool) {
+	if lf.ParsedData != nil && lf.ParsedData.Season != "" {
+		return util.StringToInt(lf.ParsedData.Season)
+	}
+	for i := len(lf.ParsedFolderData) - 1; i >= 0; i-- {
+		if lf.ParsedFolderData[i].Season != "" {
+			return util.StringToInt(lf.ParsedFolderData[i].Season)
+		}
+	}
+	return 0, false
+}
+
+// applyTvdbMapping hydrates the file using the TVDB season and episode numbers.
+// Returns false if the file has no season number or the episode couldn't be resolved.
+func (fh *FileHydrator) applyTvdbMapping(resolver *tvdbEpisodeResolver, lf *anime.LocalFile, mId int, episode int) bool {
+	if episode < 0 {
+		return false
+	}
+	season, ok := getTvdbSeason(lf)
+	if !ok {
+		return false
+	}
+
+	ret, ok := resolver.resolve(season, episode)
+	if !ok {
+		if fh.ScanLogger != nil {
+			fh.logFileHydration(zerolog.DebugLevel, lf, mId, episode).
+				Int("season", season).
+				Msg("TVDB mapping: Episode not found, falling back to default hydration")
+		}
+		return false
+	}
+
+	lf.MediaId = ret.MediaId
+	lf.Metadata.Episode = ret.Episode
+	lf.Metadata.AniDBEpisode = ret.AniDBEpisode
+	lf.Metadata.Type = ret.Type
+
+	/*Log */
+	if fh.ScanLogger != nil {
+		fh.logFileHydration(zerolog.DebugLevel, lf, mId, episode).
+			Dict("tvdbMapping", zerolog.Dict().
+				Int("season", season).
+				Bool("hasNewMediaId", lf.MediaId != mId).
+				Int("newMediaId", lf.MediaId),
+			).
+			Msg("File has been hydrated using the TVDB mapping")
+	}
+	switch {
+	case lf.MediaId != mId:
+		fh.ScanSummaryLogger.LogMetadataEpisodeNormalized(lf, mId, episode, lf.Metadata.Episode, lf.MediaId, lf.Metadata.AniDBEpisode)
+	case lf.Metadata.Type == anime.LocalFileTypeSpecial:
+		fh.ScanSummaryLogger.LogMetadataSpecial(lf, lf.Metadata.Episode, lf.Metadata.AniDBEpisode)
+	default:
+		fh.ScanSummaryLogger.LogMetadataMain(lf, lf.Metadata.Episode, lf.Metadata.AniDBEpisode)
+	}
+
+	return true
+}
@@ -0,0 +1,115 @@
+package scanner
+
+import (
+	"seanime/internal/api/metadata"
+	"seanime/internal/library/anime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindTvdbEpisode(t *testing.T) {
+	const showId = 100
+
+	// Split-cour season: the second part continues the TVDB season numbering
+	part1 := &tvdbCandidate{
+		mediaId: 1,
+		animeMetadata: &metadata.AnimeMetadata{
+			Mappings: &metadata.AnimeMappings{ThetvdbId: showId},
+			Episodes: map[string]*metadata.EpisodeMetadata{
+				"1":  {SeasonNumber: 2, EpisodeNumber: 1},
+				"2":  {SeasonNumber: 2, EpisodeNumber: 2},
+				"S1": {SeasonNumber: 0, EpisodeNumber: 3},
+				"C1": {SeasonNumber: 2, EpisodeNumber: 3},
+			},
+		},
+	}
+	part2 := &tvdbCandidate{
+		mediaId: 2,
+		animeMetadata: &metadata.AnimeMetadata{
+			Mappings: &metadata.AnimeMappings{ThetvdbId: showId},
+			Episodes: map[string]*metadata.EpisodeMetadata{
+				"1": {SeasonNumber: 2, EpisodeNumber: 3},
+				"2": {SeasonNumber: 2, EpisodeNumber: 4},
+				// Mapped to another show
+				"3": {SeasonNumber: 2, EpisodeNumber: 5, TvdbShowId: 200},
+			},
+		},
+	}
+	candidates := []*tvdbCandidate{part1, part2}
+
+	tests := []struct {
+		name                 string
+		season               int
+		episode              int
+		expectedFound        bool
+		expectedMediaId      int
+		expectedEpisode      int
+		expectedAniDBEpisode string
+		expectedType         anime.LocalFileType
+	}{
+		{"first part", 2, 2, true, 1, 2, "2", anime.LocalFileTypeMain},
+		{"second part", 2, 4, true, 2, 2, "2", anime.LocalFileTypeMain},
+		{"credits are skipped", 2, 3, true, 2, 1, "1", anime.LocalFileTypeMain},
+		{"special", 0, 3, true, 1, 1, "S1", anime.LocalFileTypeSpecial},
+		{"other show", 2, 5, false, 0, 0, "", ""},
+		{"not found", 3, 1, false, 0, 0, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ret, found := findTvdbEpisode(candidates, showId, tt.season, tt.episode)
+			require.Equal(t, tt.expectedFound, found)
+			if !tt.expectedFound {
+				return
+			}
+			require.Equal(t, tt.expectedMediaId, ret.MediaId)
+			require.Equal(t, tt.expectedEpisode, ret.Episode)
+			require.Equal(t, tt.expectedAniDBEpisode, ret.AniDBEpisode)
+			require.Equal(t, tt.expectedType, ret.Type)
+		})
+	}
+}
+
+func TestGetTvdbSeason(t *testing.T) {
+	tests := []struct {
+		name           string
+		lf             *anime.LocalFile
+		expectedSeason int
+		expectedFound  bool
+	}{
+		{
+			name: "filename",
+			lf: &anime.LocalFile{
+				ParsedData:       &anime.LocalFileParsedData{Season: "2", Episode: "5"},
+				ParsedFolderData: []*anime.LocalFileParsedData{{Season: "1"}},
+			},
+			expectedSeason: 2,
+			expectedFound:  true,
+		},
+		{
+			name: "closest folder",
+			lf: &anime.LocalFile{
+				ParsedData:       &anime.LocalFileParsedData{Episode: "5"},
+				ParsedFolderData: []*anime.LocalFileParsedData{{Season: "1"}, {Title: "Extras"}, {Season: "3"}},
+			},
+			expectedSeason: 3,
+			expectedFound:  true,
+		},
+		{
+			name: "no season",
+			lf: &anime.LocalFile{
+				ParsedData: &anime.LocalFileParsedData{Episode: "5"},
+			},
+			expectedFound: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			season, found := getTvdbSeason(tt.lf)
+			require.Equal(t, tt.expectedFound, found)
+			require.Equal(t, tt.expectedSeason, season)
+		})
+	}
+}
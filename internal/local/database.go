@@ -60,6 +60,11 @@ func newLocalSyncDatabase(appDataDir, dbName string, logger *zerolog.Logger) (*D
 	}, nil
 }
 
+// Snapshot writes a consistent copy of the local database to the given path.
+func (ldb *Database) Snapshot(dest string) error {
+	return ldb.gormdb.Exec("VACUUM INTO ?", dest).Error
+}
+
 // MigrateTables performs auto migration on the database
 func migrateTables(db *gorm.DB) error {
 	err := db.AutoMigrate(
@@ -68,6 +73,7 @@ func migrateTables(db *gorm.DB) error {
 		&SimulatedCollection{},
 		&AnimeSnapshot{},
 		&TrackedMedia{},
+		&OfflineEpisode{},
 	)
 	if err != nil {
 		return err
@@ -93,6 +93,36 @@ func (ldb *Database) GetAnimeSnapshots() ([]*AnimeSnapshot, bool) {
 }
 
 
+//----------------------------------------------------------------------------------------------------------------------------------------------------
+
+func (ldb *Database) SaveOfflineEpisode(oe *OfflineEpisode) error {
+	return ldb.gormdb.Save(oe).Error
+}
+
+func (ldb *Database) GetOfflineEpisode(mediaId int, episodeNumber int) (*OfflineEpisode, bool) {
+	var oe OfflineEpisode
+	err := ldb.gormdb.Where("media_id = ? AND episode_number = ?", mediaId, episodeNumber).First(&oe).Error
+	return &oe, err == nil
+}
+
+func (ldb *Database) GetOfflineEpisodes() ([]*OfflineEpisode, bool) {
+	var oe []*OfflineEpisode
+	err := ldb.gormdb.Order("media_id, episode_number").Find(&oe).Error
+	return oe, err == nil
+}
+
+func (ldb *Database) GetOfflineEpisodesByMediaId(mediaId int) ([]*OfflineEpisode, bool) {
+	var oe []*OfflineEpisode
+	err := ldb.gormdb.Where("media_id = ?", mediaId).Find(&oe).Error
+	return oe, err == nil
+}
+
+func (ldb *Database) RemoveOfflineEpisode(id uint) error {
+	return ldb.gormdb.Delete(&OfflineEpisode{}, id).Error
+}
+
+//----------------------------------------------------------------------------------------------------------------------------------------------------
+
 func (ldb *Database) SaveAnimeCollection(ac *anilist.AnimeCollection) error {
 	return ldb._saveLocalCollection(AnimeType, ac)
 }
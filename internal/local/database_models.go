@@ -54,6 +54,17 @@ type AnimeSnapshot struct {
 	ReferenceKey string `gorm:"column:reference_key" json:"referenceKey"`
 }
 
+// OfflineEpisode is an episode downloaded from a torrent stream or a debrid stream for offline use.
+// It is treated as a local file of the tracked anime.
+type OfflineEpisode struct {
+	BaseModel
+	MediaId       int    `gorm:"column:media_id;index" json:"mediaId"`
+	EpisodeNumber int    `gorm:"column:episode_number" json:"episodeNumber"`
+	AniDBEpisode  string `gorm:"column:anidb_episode" json:"aniDBEpisode"`
+	Path          string `gorm:"column:path" json:"path"`
+	Size          int64  `gorm:"column:size" json:"size"`
+	Source        string `gorm:"column:source" json:"source"` // "torrentstream" or "debrid"
+}
 
 // +---------------------+
 // |      Simulated      |
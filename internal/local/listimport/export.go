@@ -0,0 +1,115 @@
+package listimport
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"seanime/internal/api/anilist"
+
+	"github.com/samber/lo"
+)
+
+// ExportMalXML writes the collection in the MyAnimeList XML format, which can be imported by MAL, Kitsu and most other services.
+// Entries of media without a MAL ID are left out and their count is returned.
+func ExportMalXML(collection *anilist.AnimeCollection, username string) (data []byte, skipped int, err error) {
+	doc := &malDocument{
+		MyInfo: &malMyInfo{
+			UserExportType: 1, // anime
+			UserName:       username,
+		},
+		Anime: make([]malAnime, 0),
+	}
+
+	seen := make(map[int]struct{})
+	for _, list := range collection.GetMediaListCollection().GetLists() {
+		if list.GetIsCustomList() != nil && *list.GetIsCustomList() {
+			continue
+		}
+		for _, entry := range list.GetEntries() {
+			if entry.GetMedia() == nil || entry.GetStatus() == nil {
+				continue
+			}
+			if _, ok := seen[entry.GetMedia().GetID()]; ok {
+				continue
+			}
+			seen[entry.GetMedia().GetID()] = struct{}{}
+
+			e := newEntryFromListEntry(entry)
+			if e.MalId == 0 {
+				skipped++
+				continue
+			}
+			doc.Anime = append(doc.Anime, newMalAnime(entry.GetMedia(), e))
+		}
+	}
+	doc.MyInfo.UserTotalAnime = len(doc.Anime)
+
+	data, err = xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to marshal MAL export: %w", err)
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), skipped, nil
+}
+
+func newMalAnime(media *anilist.BaseAnime, e *Entry) malAnime {
+	ret := malAnime{
+		SeriesAnimedbId:   e.MalId,
+		SeriesTitle:       cdata{Value: media.GetRomajiTitleSafe()},
+		SeriesEpisodes:    lo.FromPtr(media.GetEpisodes()),
+		MyWatchedEpisodes: e.Progress,
+		MyStartDate:       formatMalDate(e.StartedAt),
+		MyFinishDate:      formatMalDate(e.CompletedAt),
+		// MAL scores are integers out of 10
+		MyScore:        int(math.Round(float64(e.Score) / 10)),
+		MyTimesWatched: e.Repeat,
+		// Makes MAL update the entries that are already in the list
+		UpdateOnImport: 1,
+	}
+	if media.GetFormat() != nil {
+		ret.SeriesType = malSeriesType(*media.GetFormat())
+	}
+
+	switch e.Status {
+	case anilist.MediaListStatusCurrent:
+		ret.MyStatus = "Watching"
+	case anilist.MediaListStatusCompleted:
+		ret.MyStatus = "Completed"
+	case anilist.MediaListStatusPaused:
+		ret.MyStatus = "On-Hold"
+	case anilist.MediaListStatusDropped:
+		ret.MyStatus = "Dropped"
+	case anilist.MediaListStatusRepeating:
+		// MAL marks rewatched entries as completed
+		ret.MyStatus = "Completed"
+		ret.MyRewatching = 1
+	default:
+		ret.MyStatus = "Plan to Watch"
+	}
+	return ret
+}
+
+func malSeriesType(format anilist.MediaFormat) string {
+	switch format {
+	case anilist.MediaFormatTv, anilist.MediaFormatTvShort:
+		return "TV"
+	case anilist.MediaFormatMovie:
+		return "Movie"
+	case anilist.MediaFormatSpecial:
+		return "Special"
+	case anilist.MediaFormatOva:
+		return "OVA"
+	case anilist.MediaFormatOna:
+		return "ONA"
+	case anilist.MediaFormatMusic:
+		return "Music"
+	}
+	return ""
+}
+
+// formatMalDate returns the date in the YYYY-MM-DD format, with zeroes for the unknown parts.
+func formatMalDate(date *anilist.FuzzyDateInput) string {
+	if date == nil {
+		return "0000-00-00"
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", lo.FromPtr(date.Year), lo.FromPtr(date.Month), lo.FromPtr(date.Day))
+}
@@ -0,0 +1,341 @@
+package listimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seanime/internal/api/anilist"
+	"seanime/internal/local"
+	"seanime/internal/platforms/platform"
+	"seanime/internal/util"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+// Importer writes the entries of list exports into the simulated (local) anime collection.
+type Importer struct {
+	logger       *zerolog.Logger
+	localManager local.Manager
+	platformRef  *util.Ref[platform.Platform]
+	mu           sync.Mutex
+}
+
+type NewImporterOptions struct {
+	Logger       *zerolog.Logger
+	LocalManager local.Manager
+	PlatformRef  *util.Ref[platform.Platform]
+}
+
+type (
+	ImportOptions struct {
+		// Overwrite replaces the existing entries that differ from the imported ones.
+		// Otherwise, the existing entries are kept and reported as conflicts.
+		Overwrite bool `json:"overwrite"`
+		// DryRun returns the report without modifying the collection.
+		DryRun bool `json:"dryRun"`
+	}
+
+	ImportReport struct {
+		Total      int         `json:"total"`
+		Added      int         `json:"added"`
+		Updated    int         `json:"updated"`
+		Unchanged  int         `json:"unchanged"`
+		Conflicts  []*Conflict `json:"conflicts"`
+		Unresolved []*Entry    `json:"unresolved"`
+		DryRun     bool        `json:"dryRun"`
+	}
+
+	// Conflict is an imported entry that differs from the entry already in the collection.
+	Conflict struct {
+		MediaId  int    `json:"mediaId"`
+		Title    string `json:"title"`
+		Existing *Entry `json:"existing"`
+		Imported *Entry `json:"imported"`
+		// Fields that differ: "status", "score", "progress", "repeat", "startedAt" or "completedAt"
+		Fields      []string `json:"fields"`
+		Overwritten bool     `json:"overwritten"`
+	}
+)
+
+func NewImporter(opts *NewImporterOptions) *Importer {
+	return &Importer{
+		logger:       opts.Logger,
+		localManager: opts.LocalManager,
+		platformRef:  opts.PlatformRef,
+	}
+}
+
+// Import resolves the entries to AniList media and writes them into the simulated collection.
+// Entries are resolved by AniList ID first, then by MAL ID.
+func (i *Importer) Import(ctx context.Context, entries []*Entry, opts *ImportOptions) (*ImportReport, error) {
+	if i.platformRef.IsAbsent() {
+		return nil, errors.New("platform not initialized")
+	}
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.logger.Debug().Int("count", len(entries)).Bool("dryRun", opts.DryRun).Msg("listimport: Importing list entries")
+
+	report := &ImportReport{
+		Total:      len(entries),
+		Conflicts:  make([]*Conflict, 0),
+		Unresolved: make([]*Entry, 0),
+		DryRun:     opts.DryRun,
+	}
+
+	collection := i.getSimulatedCollection()
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		media, err := i.resolveMedia(ctx, entry)
+		if err != nil {
+			i.logger.Trace().Err(err).Str("title", entry.Title).Int("malId", entry.MalId).Int("anilistId", entry.AnilistId).Msg("listimport: Could not resolve entry")
+			report.Unresolved = append(report.Unresolved, entry)
+			continue
+		}
+
+		// AniList rejects progress greater than the episode count
+		imported := *entry
+		if media.GetEpisodes() != nil && *media.GetEpisodes() > 0 {
+			imported.Progress = min(imported.Progress, *media.GetEpisodes())
+		}
+		imported.AnilistId = media.GetID()
+		if media.GetIDMal() != nil {
+			imported.MalId = *media.GetIDMal()
+		}
+
+		existing, found := findEntry(collection, media.GetID())
+		if !found {
+			report.Added++
+			if !opts.DryRun {
+				setEntry(collection, media, &imported)
+			}
+			continue
+		}
+
+		fields := diffEntry(existing, &imported)
+		if len(fields) == 0 {
+			report.Unchanged++
+			continue
+		}
+
+		report.Conflicts = append(report.Conflicts, &Conflict{
+			MediaId:     media.GetID(),
+			Title:       media.GetPreferredTitle(),
+			Existing:    newEntryFromListEntry(existing),
+			Imported:    &imported,
+			Fields:      fields,
+			Overwritten: opts.Overwrite,
+		})
+		if opts.Overwrite {
+			report.Updated++
+			if !opts.DryRun {
+				setEntry(collection, media, &imported)
+			}
+		}
+	}
+
+	if !opts.DryRun && (report.Added > 0 || report.Updated > 0) {
+		i.localManager.SaveSimulatedAnimeCollection(collection)
+	}
+
+	i.logger.Info().
+		Int("added", report.Added).
+		Int("updated", report.Updated).
+		Int("unchanged", report.Unchanged).
+		Int("conflicts", len(report.Conflicts)).
+		Int("unresolved", len(report.Unresolved)).
+		Msg("listimport: Imported list entries")
+
+	return report, nil
+}
+
+func (i *Importer) resolveMedia(ctx context.Context, entry *Entry) (*anilist.BaseAnime, error) {
+	p := i.platformRef.Get()
+	if entry.AnilistId > 0 {
+		if media, err := p.GetAnime(ctx, entry.AnilistId); err == nil && media != nil {
+			return media, nil
+		}
+	}
+	if entry.MalId > 0 {
+		if media, err := p.GetAnimeByMalID(ctx, entry.MalId); err == nil && media != nil {
+			return media, nil
+		}
+	}
+	return nil, fmt.Errorf("no AniList media found for %q", entry.Title)
+}
+
+func (i *Importer) getSimulatedCollection() *anilist.AnimeCollection {
+	if collection, ok := i.localManager.GetSimulatedAnimeCollection().Get(); ok && collection.GetMediaListCollection() != nil {
+		return collection
+	}
+	return &anilist.AnimeCollection{
+		MediaListCollection: &anilist.AnimeCollection_MediaListCollection{
+			Lists: []*anilist.AnimeCollection_MediaListCollection_Lists{},
+		},
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func findEntry(collection *anilist.AnimeCollection, mediaId int) (*anilist.AnimeListEntry, bool) {
+	for _, list := range collection.GetMediaListCollection().GetLists() {
+		if list.GetIsCustomList() != nil && *list.GetIsCustomList() {
+			continue
+		}
+		for _, entry := range list.GetEntries() {
+			if entry.GetMedia().GetID() == mediaId {
+				return entry, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// setEntry adds or replaces the entry of the media, moving it to the list of its new status.
+// The dates of an existing entry are kept when the imported entry doesn't have any.
+func setEntry(collection *anilist.AnimeCollection, media *anilist.BaseAnime, imported *Entry) {
+	mlc := collection.GetMediaListCollection()
+
+	entry, found := findEntry(collection, media.GetID())
+	if found {
+		for _, list := range mlc.GetLists() {
+			list.Entries = lo.Filter(list.GetEntries(), func(e *anilist.AnimeListEntry, _ int) bool {
+				return e.GetMedia().GetID() != media.GetID()
+			})
+		}
+	} else {
+		entry = &anilist.AnimeListEntry{
+			ID:          newEntryId(),
+			Private:     lo.ToPtr(false),
+			StartedAt:   &anilist.AnimeCollection_MediaListCollection_Lists_Entries_StartedAt{},
+			CompletedAt: &anilist.AnimeCollection_MediaListCollection_Lists_Entries_CompletedAt{},
+		}
+	}
+
+	entry.Media = media
+	entry.Status = lo.ToPtr(imported.Status)
+	entry.Score = lo.ToPtr(float64(imported.Score))
+	entry.Progress = lo.ToPtr(imported.Progress)
+	entry.Repeat = lo.ToPtr(imported.Repeat)
+	if imported.StartedAt != nil {
+		entry.StartedAt = &anilist.AnimeCollection_MediaListCollection_Lists_Entries_StartedAt{
+			Year:  imported.StartedAt.Year,
+			Month: imported.StartedAt.Month,
+			Day:   imported.StartedAt.Day,
+		}
+	}
+	if imported.CompletedAt != nil {
+		entry.CompletedAt = &anilist.AnimeCollection_MediaListCollection_Lists_Entries_CompletedAt{
+			Year:  imported.CompletedAt.Year,
+			Month: imported.CompletedAt.Month,
+			Day:   imported.CompletedAt.Day,
+		}
+	}
+
+	var targetList *anilist.AnimeCollection_MediaListCollection_Lists
+	for _, list := range mlc.GetLists() {
+		if list.GetStatus() != nil && *list.GetStatus() == imported.Status && (list.GetIsCustomList() == nil || !*list.GetIsCustomList()) {
+			targetList = list
+			break
+		}
+	}
+	if targetList == nil {
+		targetList = &anilist.AnimeCollection_MediaListCollection_Lists{
+			Status:       lo.ToPtr(imported.Status),
+			Name:         lo.ToPtr(string(imported.Status)),
+			IsCustomList: lo.ToPtr(false),
+			Entries:      []*anilist.AnimeListEntry{},
+		}
+		mlc.Lists = append(mlc.Lists, targetList)
+	}
+	targetList.Entries = append(targetList.Entries, entry)
+}
+
+// diffEntry returns the fields of the imported entry that differ from the existing one.
+// Dates are only compared when the imported entry has them.
+func diffEntry(existing *anilist.AnimeListEntry, imported *Entry) []string {
+	current := newEntryFromListEntry(existing)
+	ret := make([]string, 0)
+	if current.Status != imported.Status {
+		ret = append(ret, "status")
+	}
+	if current.Score != imported.Score {
+		ret = append(ret, "score")
+	}
+	if current.Progress != imported.Progress {
+		ret = append(ret, "progress")
+	}
+	if current.Repeat != imported.Repeat {
+		ret = append(ret, "repeat")
+	}
+	if imported.StartedAt != nil && !equalDates(current.StartedAt, imported.StartedAt) {
+		ret = append(ret, "startedAt")
+	}
+	if imported.CompletedAt != nil && !equalDates(current.CompletedAt, imported.CompletedAt) {
+		ret = append(ret, "completedAt")
+	}
+	return ret
+}
+
+func newEntryFromListEntry(e *anilist.AnimeListEntry) *Entry {
+	ret := &Entry{
+		Title:     e.GetMedia().GetPreferredTitle(),
+		AnilistId: e.GetMedia().GetID(),
+	}
+	if e.GetMedia().GetIDMal() != nil {
+		ret.MalId = *e.GetMedia().GetIDMal()
+	}
+	if e.GetStatus() != nil {
+		ret.Status = *e.GetStatus()
+	}
+	if e.GetScore() != nil {
+		ret.Score = int(*e.GetScore())
+	}
+	if e.GetProgress() != nil {
+		ret.Progress = *e.GetProgress()
+	}
+	if e.GetRepeat() != nil {
+		ret.Repeat = *e.GetRepeat()
+	}
+	if e.GetStartedAt() != nil {
+		ret.StartedAt = normalizeDate(&anilist.FuzzyDateInput{Year: e.GetStartedAt().GetYear(), Month: e.GetStartedAt().GetMonth(), Day: e.GetStartedAt().GetDay()})
+	}
+	if e.GetCompletedAt() != nil {
+		ret.CompletedAt = normalizeDate(&anilist.FuzzyDateInput{Year: e.GetCompletedAt().GetYear(), Month: e.GetCompletedAt().GetMonth(), Day: e.GetCompletedAt().GetDay()})
+	}
+	return ret
+}
+
+var lastEntryId atomic.Int64
+
+// newEntryId returns a unique ID for a new entry of the simulated collection, which uses timestamps as IDs.
+func newEntryId() int {
+	for {
+		last := lastEntryId.Load()
+		id := max(time.Now().UnixNano(), last+1)
+		if lastEntryId.CompareAndSwap(last, id) {
+			return int(id)
+		}
+	}
+}
+
+func equalDates(a, b *anilist.FuzzyDateInput) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return lo.FromPtr(a.Year) == lo.FromPtr(b.Year) &&
+		lo.FromPtr(a.Month) == lo.FromPtr(b.Month) &&
+		lo.FromPtr(a.Day) == lo.FromPtr(b.Day)
+}
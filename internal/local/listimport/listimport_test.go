@@ -0,0 +1,217 @@
+package listimport
+
+import (
+	"seanime/internal/api/anilist"
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMalXML(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8" ?>
+<myanimelist>
+	<myinfo><user_export_type>1</user_export_type></myinfo>
+	<anime>
+		<series_animedb_id>52991</series_animedb_id>
+		<series_title><![CDATA[Sousou no Frieren]]></series_title>
+		<my_watched_episodes>28</my_watched_episodes>
+		<my_start_date>2023-09-29</my_start_date>
+		<my_finish_date>2024-03-22</my_finish_date>
+		<my_score>10</my_score>
+		<my_status>Completed</my_status>
+		<my_times_watched>1</my_times_watched>
+		<my_rewatching>0</my_rewatching>
+	</anime>
+	<anime>
+		<series_animedb_id>57334</series_animedb_id>
+		<series_title><![CDATA[Dandadan]]></series_title>
+		<my_watched_episodes>0</my_watched_episodes>
+		<my_start_date>0000-00-00</my_start_date>
+		<my_finish_date>0000-00-00</my_finish_date>
+		<my_score>0</my_score>
+		<my_status>Plan to Watch</my_status>
+	</anime>
+</myanimelist>`
+
+	entries, err := ParseMalXML([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	require.Equal(t, "Sousou no Frieren", entries[0].Title)
+	require.Equal(t, 52991, entries[0].MalId)
+	require.Equal(t, anilist.MediaListStatusCompleted, entries[0].Status)
+	require.Equal(t, 100, entries[0].Score)
+	require.Equal(t, 28, entries[0].Progress)
+	require.Equal(t, 1, entries[0].Repeat)
+	require.Equal(t, &anilist.FuzzyDateInput{Year: lo.ToPtr(2023), Month: lo.ToPtr(9), Day: lo.ToPtr(29)}, entries[0].StartedAt)
+
+	require.Equal(t, anilist.MediaListStatusPlanning, entries[1].Status)
+	require.Nil(t, entries[1].StartedAt)
+	require.Nil(t, entries[1].CompletedAt)
+}
+
+func TestParseAnilistJSON(t *testing.T) {
+	data := `{"data":{"MediaListCollection":{"lists":[
+		{"isCustomList":false,"entries":[
+			{"mediaId":154587,"status":"COMPLETED","score":95,"progress":28,"startedAt":{"year":2023,"month":9,"day":29},"completedAt":{"year":null,"month":null,"day":null}},
+			{"status":"CURRENT","score":0,"progress":3,"media":{"id":171018,"idMal":57334,"title":{"userPreferred":"Dandadan"}}}
+		]},
+		{"isCustomList":true,"entries":[{"mediaId":154587,"status":"COMPLETED","score":95}]}
+	]}}}`
+
+	entries, err := ParseAnilistJSON([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	require.Equal(t, 154587, entries[0].AnilistId)
+	require.Equal(t, 95, entries[0].Score)
+	require.NotNil(t, entries[0].StartedAt)
+	require.Nil(t, entries[0].CompletedAt)
+
+	require.Equal(t, 171018, entries[1].AnilistId)
+	require.Equal(t, 57334, entries[1].MalId)
+	require.Equal(t, "Dandadan", entries[1].Title)
+	require.Equal(t, anilist.MediaListStatusCurrent, entries[1].Status)
+
+	// Scores out of 10
+	entries, err = ParseAnilistJSON([]byte(`[{"mediaId":1,"status":"PAUSED","score":7.5}]`))
+	require.NoError(t, err)
+	require.Equal(t, 75, entries[0].Score)
+	require.Equal(t, anilist.MediaListStatusPaused, entries[0].Status)
+}
+
+func TestParseKitsuJSON(t *testing.T) {
+	data := `{
+		"data":[
+			{"id":"1","type":"libraryEntries","attributes":{"status":"on_hold","progress":12,"ratingTwenty":16,"reconsuming":false,"reconsumeCount":0,"startedAt":"2023-10-01T00:00:00.000Z","finishedAt":null},
+				"relationships":{"anime":{"data":{"type":"anime","id":"46474"}}}},
+			{"id":"2","type":"libraryEntries","attributes":{"status":"completed","progress":1},
+				"relationships":{"anime":{"data":null},"manga":{"data":{"type":"manga","id":"1"}}}}
+		],
+		"included":[
+			{"id":"46474","type":"anime","attributes":{"canonicalTitle":"Sousou no Frieren"}},
+			{"id":"10","type":"mappings","attributes":{"externalSite":"myanimelist/anime","externalId":"52991"},"relationships":{"item":{"data":{"type":"anime","id":"46474"}}}},
+			{"id":"11","type":"mappings","attributes":{"externalSite":"anilist/anime","externalId":"154587"},"relationships":{"item":{"data":{"type":"anime","id":"46474"}}}}
+		]
+	}`
+
+	entries, err := ParseKitsuJSON([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, &Entry{
+		Title:     "Sousou no Frieren",
+		AnilistId: 154587,
+		MalId:     52991,
+		KitsuId:   46474,
+		Status:    anilist.MediaListStatusPaused,
+		Score:     80,
+		Progress:  12,
+		StartedAt: &anilist.FuzzyDateInput{Year: lo.ToPtr(2023), Month: lo.ToPtr(10), Day: lo.ToPtr(1)},
+	}, entries[0])
+}
+
+func TestParseCSV(t *testing.T) {
+	data := "\xef\xbb\xbfTitle,MAL ID,AniList ID,Status,Score,Progress,Started At\n" +
+		"Frieren,52991,,watching,8.5,10,2023-09\n" +
+		"Unknown,,,completed,10,1,\n" +
+		"Dandadan,,171018,Plan to Watch,,,\n"
+
+	entries, err := ParseCSV([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	require.Equal(t, 52991, entries[0].MalId)
+	require.Equal(t, anilist.MediaListStatusCurrent, entries[0].Status)
+	require.Equal(t, 85, entries[0].Score)
+	require.Equal(t, 10, entries[0].Progress)
+	require.Nil(t, entries[0].StartedAt)
+
+	require.Equal(t, 171018, entries[1].AnilistId)
+	require.Equal(t, anilist.MediaListStatusPlanning, entries[1].Status)
+
+	_, err = ParseCSV([]byte("title,status\nFrieren,completed\n"))
+	require.Error(t, err)
+}
+
+func TestSetEntryAndDiff(t *testing.T) {
+	frieren := &anilist.BaseAnime{ID: 154587, IDMal: lo.ToPtr(52991), Episodes: lo.ToPtr(28), Title: &anilist.BaseAnime_Title{Romaji: lo.ToPtr("Sousou no Frieren")}}
+	collection := &anilist.AnimeCollection{
+		MediaListCollection: &anilist.AnimeCollection_MediaListCollection{
+			Lists: []*anilist.AnimeCollection_MediaListCollection_Lists{
+				{Status: lo.ToPtr(anilist.MediaListStatusCurrent), Entries: []*anilist.AnimeListEntry{
+					{ID: 1, Media: frieren, Status: lo.ToPtr(anilist.MediaListStatusCurrent), Score: lo.ToPtr(0.0), Progress: lo.ToPtr(10), Repeat: lo.ToPtr(0),
+						StartedAt: &anilist.AnimeCollection_MediaListCollection_Lists_Entries_StartedAt{Year: lo.ToPtr(2023), Month: lo.ToPtr(9), Day: lo.ToPtr(29)}},
+				}},
+			},
+		},
+	}
+
+	existing, found := findEntry(collection, frieren.ID)
+	require.True(t, found)
+
+	imported := &Entry{MalId: 52991, Status: anilist.MediaListStatusCompleted, Score: 100, Progress: 28}
+	require.Equal(t, []string{"status", "score", "progress"}, diffEntry(existing, imported))
+
+	setEntry(collection, frieren, imported)
+	lists := collection.GetMediaListCollection().GetLists()
+	require.Len(t, lists, 2)
+	require.Empty(t, lists[0].GetEntries())
+	require.Len(t, lists[1].GetEntries(), 1)
+
+	entry := lists[1].GetEntries()[0]
+	require.Equal(t, 1, entry.GetID())
+	require.Equal(t, anilist.MediaListStatusCompleted, *entry.GetStatus())
+	require.Equal(t, 100.0, *entry.GetScore())
+	// Dates are kept when the imported entry doesn't have any
+	require.Equal(t, 2023, *entry.GetStartedAt().GetYear())
+	require.Empty(t, diffEntry(entry, imported))
+}
+
+func TestExportMalXML(t *testing.T) {
+	collection := &anilist.AnimeCollection{
+		MediaListCollection: &anilist.AnimeCollection_MediaListCollection{
+			Lists: []*anilist.AnimeCollection_MediaListCollection_Lists{
+				{Status: lo.ToPtr(anilist.MediaListStatusRepeating), Entries: []*anilist.AnimeListEntry{
+					{
+						Media:       &anilist.BaseAnime{ID: 154587, IDMal: lo.ToPtr(52991), Format: lo.ToPtr(anilist.MediaFormatTv), Title: &anilist.BaseAnime_Title{Romaji: lo.ToPtr("Sousou no Frieren")}},
+						Status:      lo.ToPtr(anilist.MediaListStatusRepeating),
+						Score:       lo.ToPtr(95.0),
+						Progress:    lo.ToPtr(4),
+						Repeat:      lo.ToPtr(1),
+						StartedAt:   &anilist.AnimeCollection_MediaListCollection_Lists_Entries_StartedAt{Year: lo.ToPtr(2023), Month: lo.ToPtr(9)},
+						CompletedAt: &anilist.AnimeCollection_MediaListCollection_Lists_Entries_CompletedAt{},
+					},
+					{
+						Media:  &anilist.BaseAnime{ID: 1},
+						Status: lo.ToPtr(anilist.MediaListStatusRepeating),
+					},
+				}},
+			},
+		},
+	}
+
+	data, skipped, err := ExportMalXML(collection, "seanime")
+	require.NoError(t, err)
+	require.Equal(t, 1, skipped)
+	require.True(t, strings.HasPrefix(string(data), "<?xml"))
+	require.Contains(t, string(data), "<series_title><![CDATA[Sousou no Frieren]]></series_title>")
+	require.Contains(t, string(data), "<series_type>TV</series_type>")
+	require.Contains(t, string(data), "<my_start_date>2023-09-00</my_start_date>")
+	require.Contains(t, string(data), "<my_finish_date>0000-00-00</my_finish_date>")
+
+	// Round-trip
+	entries, err := ParseMalXML(data)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, &Entry{
+		Title:     "Sousou no Frieren",
+		MalId:     52991,
+		Status:    anilist.MediaListStatusRepeating,
+		Score:     100,
+		Progress:  4,
+		Repeat:    1,
+		StartedAt: &anilist.FuzzyDateInput{Year: lo.ToPtr(2023), Month: lo.ToPtr(9)},
+	}, entries[0])
+}
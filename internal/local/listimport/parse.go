@@ -0,0 +1,521 @@
+package listimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"seanime/internal/api/anilist"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/samber/lo"
+)
+
+type Format string
+
+const (
+	FormatMalXML      Format = "mal"
+	FormatAnilistJSON Format = "anilist"
+	FormatKitsuJSON   Format = "kitsu"
+	FormatCSV         Format = "csv"
+)
+
+var ErrUnknownFormat = errors.New("unknown list format")
+
+// Entry is a list entry read from an export, before it is resolved to an AniList media.
+type Entry struct {
+	Title     string                  `json:"title"`
+	AnilistId int                     `json:"anilistId"`
+	MalId     int                     `json:"malId"`
+	KitsuId   int                     `json:"kitsuId"`
+	Status    anilist.MediaListStatus `json:"status"`
+	// Score out of 100, 0 means the entry is not scored.
+	Score       int                     `json:"score"`
+	Progress    int                     `json:"progress"`
+	Repeat      int                     `json:"repeat"`
+	StartedAt   *anilist.FuzzyDateInput `json:"startedAt,omitempty"`
+	CompletedAt *anilist.FuzzyDateInput `json:"completedAt,omitempty"`
+}
+
+// Parse reads the entries of an export in the given format.
+func Parse(format Format, data []byte) ([]*Entry, error) {
+	switch format {
+	case FormatMalXML:
+		return ParseMalXML(data)
+	case FormatAnilistJSON:
+		return ParseAnilistJSON(data)
+	case FormatKitsuJSON:
+		return ParseKitsuJSON(data)
+	case FormatCSV:
+		return ParseCSV(data)
+	}
+	return nil, ErrUnknownFormat
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// MyAnimeList
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type (
+	malDocument struct {
+		XMLName xml.Name   `xml:"myanimelist"`
+		MyInfo  *malMyInfo `xml:"myinfo,omitempty"`
+		Anime   []malAnime `xml:"anime"`
+	}
+
+	malMyInfo struct {
+		UserExportType int    `xml:"user_export_type"`
+		UserName       string `xml:"user_name,omitempty"`
+		UserTotalAnime int    `xml:"user_total_anime"`
+	}
+
+	malAnime struct {
+		SeriesAnimedbId   int    `xml:"series_animedb_id"`
+		SeriesTitle       cdata  `xml:"series_title"`
+		SeriesType        string `xml:"series_type,omitempty"`
+		SeriesEpisodes    int    `xml:"series_episodes"`
+		MyId              int    `xml:"my_id"`
+		MyWatchedEpisodes int    `xml:"my_watched_episodes"`
+		MyStartDate       string `xml:"my_start_date"`
+		MyFinishDate      string `xml:"my_finish_date"`
+		MyScore           int    `xml:"my_score"`
+		MyStatus          string `xml:"my_status"`
+		MyTimesWatched    int    `xml:"my_times_watched"`
+		MyRewatching      int    `xml:"my_rewatching"`
+		UpdateOnImport    int    `xml:"update_on_import"`
+	}
+
+	// cdata is a string written as a CDATA section, the way MAL writes titles.
+	cdata struct {
+		Value string `xml:",cdata"`
+	}
+)
+
+// ParseMalXML reads a MyAnimeList XML export.
+// Kitsu and most other services can export to the same format.
+func ParseMalXML(data []byte) ([]*Entry, error) {
+	var doc malDocument
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// Some exports declare a charset other than UTF-8 but are encoded in UTF-8 anyway
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid MAL export: %w", err)
+	}
+
+	ret := make([]*Entry, 0, len(doc.Anime))
+	for _, a := range doc.Anime {
+		status, ok := parseStatus(a.MyStatus)
+		if !ok {
+			status = anilist.MediaListStatusPlanning
+		}
+		if a.MyRewatching == 1 {
+			status = anilist.MediaListStatusRepeating
+		}
+		ret = append(ret, &Entry{
+			Title:       strings.TrimSpace(a.SeriesTitle.Value),
+			MalId:       a.SeriesAnimedbId,
+			Status:      status,
+			Score:       clampScore(a.MyScore * 10),
+			Progress:    max(a.MyWatchedEpisodes, 0),
+			Repeat:      max(a.MyTimesWatched, 0),
+			StartedAt:   parseDate(a.MyStartDate),
+			CompletedAt: parseDate(a.MyFinishDate),
+		})
+	}
+	return ret, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// AniList
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type (
+	anilistDocument struct {
+		Data                *anilistDocument          `json:"data"`
+		MediaListCollection *anilistCollection        `json:"MediaListCollection"`
+		Lists               []*anilistCollectionList  `json:"lists"`
+		Entries             []*anilistCollectionEntry `json:"entries"`
+	}
+
+	anilistCollection struct {
+		Lists []*anilistCollectionList `json:"lists"`
+	}
+
+	anilistCollectionList struct {
+		IsCustomList bool                      `json:"isCustomList"`
+		Entries      []*anilistCollectionEntry `json:"entries"`
+	}
+
+	anilistCollectionEntry struct {
+		MediaId     int                     `json:"mediaId"`
+		Status      string                  `json:"status"`
+		Score       float64                 `json:"score"`
+		Progress    int                     `json:"progress"`
+		Repeat      int                     `json:"repeat"`
+		StartedAt   *anilist.FuzzyDateInput `json:"startedAt"`
+		CompletedAt *anilist.FuzzyDateInput `json:"completedAt"`
+		Media       *struct {
+			ID    int  `json:"id"`
+			IDMal *int `json:"idMal"`
+			Title *struct {
+				UserPreferred *string `json:"userPreferred"`
+				Romaji        *string `json:"romaji"`
+			} `json:"title"`
+		} `json:"media"`
+	}
+)
+
+// ParseAnilistJSON reads an AniList list collection, as returned by the MediaListCollection query.
+// The response of the query, the collection itself or a plain array of entries are accepted.
+//
+// AniList returns scores in the format chosen by the user, so the scores are read out of 100
+// if any of them is greater than 10, and out of 10 otherwise.
+func ParseAnilistJSON(data []byte) ([]*Entry, error) {
+	var rawEntries []*anilistCollectionEntry
+
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		if err := json.Unmarshal(data, &rawEntries); err != nil {
+			return nil, fmt.Errorf("invalid AniList export: %w", err)
+		}
+	} else {
+		var doc anilistDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid AniList export: %w", err)
+		}
+		for doc.Data != nil {
+			doc = *doc.Data
+		}
+		lists := doc.Lists
+		if doc.MediaListCollection != nil {
+			lists = doc.MediaListCollection.Lists
+		}
+		rawEntries = doc.Entries
+		for _, list := range lists {
+			// Entries of custom lists are also in their status list
+			if list == nil || list.IsCustomList {
+				continue
+			}
+			rawEntries = append(rawEntries, list.Entries...)
+		}
+	}
+
+	rawEntries = lo.Filter(rawEntries, func(e *anilistCollectionEntry, _ int) bool { return e != nil })
+
+	scoreFactor := 10.0
+	if lo.SomeBy(rawEntries, func(e *anilistCollectionEntry) bool { return e.Score > 10 }) {
+		scoreFactor = 1
+	}
+
+	ret := make([]*Entry, 0, len(rawEntries))
+	for _, e := range rawEntries {
+		entry := &Entry{
+			AnilistId:   e.MediaId,
+			Score:       clampScore(int(math.Round(e.Score * scoreFactor))),
+			Progress:    max(e.Progress, 0),
+			Repeat:      max(e.Repeat, 0),
+			StartedAt:   normalizeDate(e.StartedAt),
+			CompletedAt: normalizeDate(e.CompletedAt),
+		}
+		if status, ok := parseStatus(e.Status); ok {
+			entry.Status = status
+		} else {
+			entry.Status = anilist.MediaListStatusPlanning
+		}
+		if e.Media != nil {
+			if entry.AnilistId == 0 {
+				entry.AnilistId = e.Media.ID
+			}
+			if e.Media.IDMal != nil {
+				entry.MalId = *e.Media.IDMal
+			}
+			if e.Media.Title != nil {
+				if e.Media.Title.UserPreferred != nil {
+					entry.Title = *e.Media.Title.UserPreferred
+				} else if e.Media.Title.Romaji != nil {
+					entry.Title = *e.Media.Title.Romaji
+				}
+			}
+		}
+		ret = append(ret, entry)
+	}
+	return ret, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Kitsu
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type (
+	kitsuDocument struct {
+		Data     []*kitsuResource `json:"data"`
+		Included []*kitsuResource `json:"included"`
+	}
+
+	kitsuResource struct {
+		ID            string                        `json:"id"`
+		Type          string                        `json:"type"`
+		Attributes    map[string]json.RawMessage    `json:"attributes"`
+		Relationships map[string]*kitsuRelationship `json:"relationships"`
+	}
+
+	kitsuRelationship struct {
+		Data json.RawMessage `json:"data"`
+	}
+
+	kitsuIdentifier struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	}
+)
+
+// ParseKitsuJSON reads Kitsu library entries in the JSON:API format, as returned by
+// /api/edge/library-entries?include=anime.mappings.
+// The MAL and AniList IDs are read from the included mappings.
+func ParseKitsuJSON(data []byte) ([]*Entry, error) {
+	var doc kitsuDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid Kitsu export: %w", err)
+	}
+
+	// Kitsu anime ID -> entry with the external IDs and title
+	anime := make(map[string]*Entry)
+	getAnime := func(id string) *Entry {
+		if _, ok := anime[id]; !ok {
+			kitsuId, _ := strconv.Atoi(id)
+			anime[id] = &Entry{KitsuId: kitsuId}
+		}
+		return anime[id]
+	}
+
+	for _, res := range doc.Included {
+		if res == nil {
+			continue
+		}
+		switch res.Type {
+		case "anime":
+			getAnime(res.ID).Title = kitsuString(res.Attributes, "canonicalTitle")
+		case "mappings":
+			item, ok := kitsuRelationshipId(res, "item")
+			if !ok || item.Type != "anime" {
+				continue
+			}
+			externalId, err := strconv.Atoi(kitsuString(res.Attributes, "externalId"))
+			if err != nil {
+				continue
+			}
+			switch kitsuString(res.Attributes, "externalSite") {
+			case "myanimelist/anime":
+				getAnime(item.ID).MalId = externalId
+			case "anilist/anime":
+				getAnime(item.ID).AnilistId = externalId
+			}
+		}
+	}
+
+	ret := make([]*Entry, 0, len(doc.Data))
+	for _, res := range doc.Data {
+		if res == nil {
+			continue
+		}
+		item, ok := kitsuRelationshipId(res, "anime")
+		if !ok {
+			// Manga and drama entries
+			continue
+		}
+		entry := *getAnime(item.ID)
+
+		if status, ok := parseStatus(kitsuString(res.Attributes, "status")); ok {
+			entry.Status = status
+		} else {
+			entry.Status = anilist.MediaListStatusPlanning
+		}
+		if kitsuBool(res.Attributes, "reconsuming") {
+			entry.Status = anilist.MediaListStatusRepeating
+		}
+		// ratingTwenty goes from 2 to 20
+		entry.Score = clampScore(kitsuInt(res.Attributes, "ratingTwenty") * 5)
+		entry.Progress = max(kitsuInt(res.Attributes, "progress"), 0)
+		entry.Repeat = max(kitsuInt(res.Attributes, "reconsumeCount"), 0)
+		entry.StartedAt = parseDate(kitsuString(res.Attributes, "startedAt"))
+		entry.CompletedAt = parseDate(kitsuString(res.Attributes, "finishedAt"))
+		ret = append(ret, &entry)
+	}
+	return ret, nil
+}
+
+func kitsuRelationshipId(res *kitsuResource, name string) (*kitsuIdentifier, bool) {
+	rel, ok := res.Relationships[name]
+	if !ok || rel == nil || len(rel.Data) == 0 {
+		return nil, false
+	}
+	var id kitsuIdentifier
+	if err := json.Unmarshal(rel.Data, &id); err != nil || id.ID == "" {
+		return nil, false
+	}
+	return &id, true
+}
+
+func kitsuString(attributes map[string]json.RawMessage, key string) string {
+	var s string
+	if err := json.Unmarshal(attributes[key], &s); err == nil {
+		return s
+	}
+	var n json.Number
+	if err := json.Unmarshal(attributes[key], &n); err == nil {
+		return n.String()
+	}
+	return ""
+}
+
+func kitsuInt(attributes map[string]json.RawMessage, key string) int {
+	n, _ := strconv.Atoi(kitsuString(attributes, key))
+	return n
+}
+
+func kitsuBool(attributes map[string]json.RawMessage, key string) bool {
+	var b bool
+	_ = json.Unmarshal(attributes[key], &b)
+	return b
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// CSV
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// ParseCSV reads a CSV file with a header row.
+// Each row needs an "anilist_id" or a "mal_id" column. The optional columns are
+// "title", "status", "score" (out of 10), "progress", "repeat", "started_at" and "completed_at" (YYYY-MM-DD).
+func ParseCSV(data []byte) ([]*Entry, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV file: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("CSV file is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[normalizeKey(name)] = i
+	}
+	_, hasAnilistId := columns["anilistid"]
+	_, hasMalId := columns["malid"]
+	if !hasAnilistId && !hasMalId {
+		return nil, errors.New("CSV file needs an anilist_id or mal_id column")
+	}
+
+	get := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	getInt := func(record []string, column string) int {
+		n, _ := strconv.Atoi(get(record, column))
+		return max(n, 0)
+	}
+
+	ret := make([]*Entry, 0, len(records)-1)
+	for _, record := range records[1:] {
+		entry := &Entry{
+			Title:       get(record, "title"),
+			AnilistId:   getInt(record, "anilistid"),
+			MalId:       getInt(record, "malid"),
+			Progress:    getInt(record, "progress"),
+			Repeat:      getInt(record, "repeat"),
+			StartedAt:   parseDate(get(record, "startedat")),
+			CompletedAt: parseDate(get(record, "completedat")),
+			Status:      anilist.MediaListStatusPlanning,
+		}
+		if entry.AnilistId == 0 && entry.MalId == 0 {
+			continue
+		}
+		if status, ok := parseStatus(get(record, "status")); ok {
+			entry.Status = status
+		}
+		if score, err := strconv.ParseFloat(get(record, "score"), 64); err == nil {
+			entry.Score = clampScore(int(math.Round(score * 10)))
+		}
+		ret = append(ret, entry)
+	}
+	return ret, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// parseStatus reads the status names used by AniList, MAL and Kitsu.
+func parseStatus(s string) (anilist.MediaListStatus, bool) {
+	switch normalizeKey(s) {
+	case "current", "watching", "1":
+		return anilist.MediaListStatusCurrent, true
+	case "completed", "2":
+		return anilist.MediaListStatusCompleted, true
+	case "paused", "onhold", "3":
+		return anilist.MediaListStatusPaused, true
+	case "dropped", "4":
+		return anilist.MediaListStatusDropped, true
+	case "planning", "plantowatch", "planned", "6":
+		return anilist.MediaListStatusPlanning, true
+	case "repeating", "rewatching":
+		return anilist.MediaListStatusRepeating, true
+	}
+	return "", false
+}
+
+// normalizeKey lowercases the string and removes everything but letters and digits.
+func normalizeKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// parseDate reads a YYYY-MM-DD date, optionally followed by a time.
+// MAL uses "0000-00-00" for unknown dates and zeroes for unknown parts.
+func parseDate(s string) *anilist.FuzzyDateInput {
+	s = strings.TrimSpace(s)
+	if len(s) > 10 {
+		s = s[:10]
+	}
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 {
+		return nil
+	}
+	year, _ := strconv.Atoi(parts[0])
+	month, _ := strconv.Atoi(parts[1])
+	day, _ := strconv.Atoi(parts[2])
+	return normalizeDate(&anilist.FuzzyDateInput{Year: &year, Month: &month, Day: &day})
+}
+
+// normalizeDate removes the unknown parts of the date and returns nil if the year is unknown.
+func normalizeDate(date *anilist.FuzzyDateInput) *anilist.FuzzyDateInput {
+	if date == nil || date.Year == nil || *date.Year <= 0 {
+		return nil
+	}
+	ret := &anilist.FuzzyDateInput{Year: lo.ToPtr(*date.Year)}
+	if date.Month != nil && *date.Month >= 1 && *date.Month <= 12 {
+		ret.Month = lo.ToPtr(*date.Month)
+		if date.Day != nil && *date.Day >= 1 && *date.Day <= 31 {
+			ret.Day = lo.ToPtr(*date.Day)
+		}
+	}
+	return ret
+}
+
+func clampScore(score int) int {
+	return min(max(score, 0), 100)
+}
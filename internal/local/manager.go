@@ -13,6 +13,7 @@ import (
 	"seanime/internal/library/anime"
 	"seanime/internal/platforms/platform"
 	"seanime/internal/util"
+	"sync"
 
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
@@ -56,6 +57,18 @@ type Manager interface {
 	// SetHasLocalChanges sets the flag to determine if there are local changes that need to be uploaded or ignored.
 	SetHasLocalChanges(bool)
 	GetLocalStorageSize() int64
+	// DownloadEpisode downloads an episode from a torrent stream or a debrid stream for offline use.
+	DownloadEpisode(opts *DownloadEpisodeOptions) error
+	// GetEpisodeDownloads returns the episodes being downloaded.
+	GetEpisodeDownloads() []*EpisodeDownload
+	CancelEpisodeDownload(mediaId int, episodeNumber int) error
+	// GetOfflineEpisodes returns the downloaded episodes.
+	GetOfflineEpisodes() []*OfflineEpisode
+	RemoveOfflineEpisode(mediaId int, episodeNumber int) error
+	// GetOfflineLocalFiles returns the downloaded episodes as local files.
+	GetOfflineLocalFiles() []*anime.LocalFile
+	// SnapshotDatabase writes a consistent copy of the local database to the given path.
+	SnapshotDatabase(dest string) error
 	// GetSimulatedAnimeCollection returns the simulated anime collection for unauthenticated users.
 	GetSimulatedAnimeCollection() mo.Option[*anilist.AnimeCollection]
 	// SaveSimulatedAnimeCollection sets the simulated anime collection for unauthenticated users.
@@ -94,6 +107,10 @@ type (
 		// Local files, set by ManagerImpl.Synchronize, accessed by the synchronization Syncer
 		localFiles []*anime.LocalFile
 
+		// Episodes being downloaded for offline use, see ManagerImpl.DownloadEpisode
+		episodeDownloads   map[string]*EpisodeDownload
+		episodeDownloadsMu sync.Mutex
+
 		RefreshAnilistCollectionsFunc func()
 	}
 	TrackedMediaItem struct {
@@ -133,6 +150,7 @@ func NewManager(opts *NewManagerOptions) (Manager, error) {
 		localAnimeCollection:          mo.None[*anilist.AnimeCollection](),
 		metadataProviderRef:           opts.MetadataProviderRef,
 		localFiles:                    make([]*anime.LocalFile, 0),
+		episodeDownloads:              make(map[string]*EpisodeDownload),
 		wsEventManager:                opts.WSEventManager,
 		isOffline:                     opts.IsOffline,
 		anilistPlatformRef:            opts.AnilistPlatformRef,
@@ -252,7 +270,7 @@ func (m *ManagerImpl) AutoTrackCurrentMedia() (added bool, err error) {
 
 // TrackAnime adds an anime to track.
 // It checks that the anime is currently in the user's anime collection.
-// The anime should have local files, or else ManagerImpl.Synchronize will remove it from tracking.
+// The anime should have local files or downloaded episodes, or else ManagerImpl.Synchronize will remove it from tracking.
 func (m *ManagerImpl) TrackAnime(mId int) error {
 
 	m.logger.Trace().Msgf("local manager: Adding anime %d to local database", mId)
@@ -279,7 +297,7 @@ func (m *ManagerImpl) TrackAnime(mId int) error {
 
 	err := m.localDb.gormdb.Create(s).Error
 	if err != nil {
-		m.logger.Error().Msgf("local manager: Failed to add anime %d to local database: %w", mId, err)
+		m.logger.Error().Msgf("local manager: Failed to add anime %d to local database: %v", mId, err)
 		return fmt.Errorf("failed to add anime %d to local database: %w", mId, err)
 	}
 
@@ -377,6 +395,7 @@ func (m *ManagerImpl) SynchronizeLocal() error {
 	if err != nil {
 		return fmt.Errorf("local manager: Couldn't start syncing, failed to get local files: %w", err)
 	}
+	lfs = append(lfs, m.GetOfflineLocalFiles()...)
 
 	// Check if the anime and manga collections are set
 	if m.animeCollection.IsAbsent() {
@@ -527,6 +546,8 @@ func (m *ManagerImpl) removeAnime(aId int) error {
 	_ = m.localDb.RemoveAnimeSnapshot(aId)
 	// Remove the images
 	_ = m.removeMediaImages(aId)
+	// Remove the downloaded episodes
+	m.removeOfflineEpisodes(aId)
 	return nil
 }
 
@@ -567,6 +588,10 @@ func (m *ManagerImpl) GetLocalStorageSize() int64 {
 	return size
 }
 
+func (m *ManagerImpl) SnapshotDatabase(dest string) error {
+	return m.localDb.Snapshot(dest)
+}
+
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
@@ -0,0 +1,427 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"seanime/internal/events"
+	"seanime/internal/library/anime"
+	"seanime/internal/util"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DEVNOTE: Offline episodes are files downloaded from a torrent stream or a debrid stream.
+// They are stored in the local directory and treated as local files of the tracked anime,
+// so that the Syncer creates the snapshot and downloads the images like it does for scanned files.
+
+const (
+	OfflineEpisodeSourceTorrentstream = "torrentstream"
+	OfflineEpisodeSourceDebrid        = "debrid"
+
+	offlineEpisodesDirName = "episodes"
+)
+
+var (
+	ErrEpisodeAlreadyDownloaded = errors.New("local manager: Episode already downloaded")
+	ErrEpisodeDownloading       = errors.New("local manager: Episode is already being downloaded")
+)
+
+type (
+	DownloadEpisodeOptions struct {
+		MediaId       int
+		EpisodeNumber int
+		AniDBEpisode  string
+		Source        string
+		// Filename is the name of the file, guessed from the response if empty.
+		Filename string
+		// Size is the size of the file, used when reading from Reader.
+		Size int64
+		// Url is the HTTP URL of the file, used if Reader is nil.
+		Url string
+		// Reader is the content of the file, closed by the manager.
+		Reader io.ReadCloser
+	}
+
+	// EpisodeDownload is the state of an episode being downloaded for offline use.
+	EpisodeDownload struct {
+		MediaId         int    `json:"mediaId"`
+		EpisodeNumber   int    `json:"episodeNumber"`
+		Source          string `json:"source"`
+		Filename        string `json:"filename"`
+		TotalBytes      int64  `json:"totalBytes"`
+		DownloadedBytes int64  `json:"downloadedBytes"`
+
+		cancel context.CancelFunc
+	}
+)
+
+func episodeDownloadKey(mediaId int, episodeNumber int) string {
+	return fmt.Sprintf("%d-%d", mediaId, episodeNumber)
+}
+
+// DownloadEpisode starts downloading an episode to the local directory for offline use.
+// Once the download is complete, the anime is tracked if it isn't already and synchronized.
+func (m *ManagerImpl) DownloadEpisode(opts *DownloadEpisodeOptions) (err error) {
+	defer util.HandlePanicInModuleWithError("local/DownloadEpisode", &err)
+
+	if opts.Reader == nil && opts.Url == "" {
+		return errors.New("local manager: No file to download")
+	}
+
+	closeReader := func() {
+		if opts.Reader != nil {
+			_ = opts.Reader.Close()
+		}
+	}
+
+	if m.animeCollection.IsAbsent() {
+		closeReader()
+		return fmt.Errorf("anime collection not set")
+	}
+	if _, found := m.animeCollection.MustGet().GetListEntryFromAnimeId(opts.MediaId); !found {
+		closeReader()
+		return fmt.Errorf("anime is not in AniList collection")
+	}
+	if _, found := m.localDb.GetOfflineEpisode(opts.MediaId, opts.EpisodeNumber); found {
+		closeReader()
+		return ErrEpisodeAlreadyDownloaded
+	}
+
+	key := episodeDownloadKey(opts.MediaId, opts.EpisodeNumber)
+
+	m.episodeDownloadsMu.Lock()
+	if _, found := m.episodeDownloads[key]; found {
+		m.episodeDownloadsMu.Unlock()
+		closeReader()
+		return ErrEpisodeDownloading
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	download := &EpisodeDownload{
+		MediaId:       opts.MediaId,
+		EpisodeNumber: opts.EpisodeNumber,
+		Source:        opts.Source,
+		Filename:      opts.Filename,
+		TotalBytes:    opts.Size,
+		cancel:        cancel,
+	}
+	m.episodeDownloads[key] = download
+	m.episodeDownloadsMu.Unlock()
+
+	removeDownload := func() {
+		cancel()
+		m.episodeDownloadsMu.Lock()
+		delete(m.episodeDownloads, key)
+		m.episodeDownloadsMu.Unlock()
+		m.sendEpisodeDownloads()
+	}
+
+	body := opts.Reader
+	if body == nil {
+		var resp *http.Response
+		resp, err = m.openEpisodeUrl(ctx, opts.Url)
+		if err != nil {
+			removeDownload()
+			return err
+		}
+		body = resp.Body
+
+		m.episodeDownloadsMu.Lock()
+		if download.Filename == "" {
+			download.Filename = getFilenameFromResponse(resp)
+		}
+		if resp.ContentLength > 0 {
+			download.TotalBytes = resp.ContentLength
+		}
+		m.episodeDownloadsMu.Unlock()
+	}
+
+	filename := sanitizeEpisodeFilename(download.Filename)
+	if filename == "" {
+		filename = fmt.Sprintf("%d - %d.mkv", opts.MediaId, opts.EpisodeNumber)
+	}
+
+	// e.g. /path/to/datadir/offline/episodes/123/filename.mkv
+	dest := filepath.Join(m.localDir, offlineEpisodesDirName, fmt.Sprintf("%d", opts.MediaId), filename)
+	if _, statErr := os.Stat(dest); statErr == nil {
+		removeDownload()
+		_ = body.Close()
+		return fmt.Errorf("local manager: File %s already exists", filename)
+	}
+
+	m.logger.Info().Int("mediaId", opts.MediaId).Int("episode", opts.EpisodeNumber).Str("source", opts.Source).Str("dest", dest).Msg("local manager: Downloading episode for offline use")
+
+	// Unblock the reader when the download is cancelled
+	closeBody := sync.OnceFunc(func() { _ = body.Close() })
+	stop := context.AfterFunc(ctx, closeBody)
+
+	go func() {
+		defer removeDownload()
+		defer closeBody()
+		defer stop()
+
+		size, err := m.writeEpisodeFile(ctx, download, body, dest)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				m.logger.Debug().Int("mediaId", opts.MediaId).Int("episode", opts.EpisodeNumber).Msg("local manager: Episode download cancelled")
+				return
+			}
+			m.logger.Error().Err(err).Int("mediaId", opts.MediaId).Int("episode", opts.EpisodeNumber).Msg("local manager: Failed to download episode")
+			m.wsEventManager.SendEvent(events.ErrorToast, fmt.Sprintf("Failed to download episode %d: %v", opts.EpisodeNumber, err))
+			return
+		}
+
+		err = m.localDb.SaveOfflineEpisode(&OfflineEpisode{
+			MediaId:       opts.MediaId,
+			EpisodeNumber: opts.EpisodeNumber,
+			AniDBEpisode:  opts.AniDBEpisode,
+			Path:          dest,
+			Size:          size,
+			Source:        opts.Source,
+		})
+		if err != nil {
+			_ = os.Remove(dest)
+			m.logger.Error().Err(err).Int("mediaId", opts.MediaId).Int("episode", opts.EpisodeNumber).Msg("local manager: Failed to save offline episode")
+			return
+		}
+
+		// Track the anime only now, since a synchronization would remove a tracked anime without local files
+		if err := m.TrackAnime(opts.MediaId); err != nil && !errors.Is(err, ErrAlreadyTracked) {
+			m.logger.Error().Err(err).Int("mediaId", opts.MediaId).Msg("local manager: Failed to track anime of downloaded episode")
+		}
+
+		m.logger.Info().Int("mediaId", opts.MediaId).Int("episode", opts.EpisodeNumber).Msg("local manager: Episode downloaded for offline use")
+		m.wsEventManager.SendEvent(events.SuccessToast, fmt.Sprintf("Episode %d downloaded for offline use", opts.EpisodeNumber))
+
+		// Create or update the snapshot of the anime
+		if err := m.SynchronizeLocal(); err != nil {
+			m.logger.Warn().Err(err).Msg("local manager: Could not synchronize after episode download")
+		}
+	}()
+
+	return nil
+}
+
+func (m *ManagerImpl) openEpisodeUrl(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("local manager: Invalid URL: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("local manager: Failed to request file: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("local manager: Failed to request file, status %d", resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+// writeEpisodeFile copies the body to a temporary file, which is renamed to dest once complete.
+func (m *ManagerImpl) writeEpisodeFile(ctx context.Context, download *EpisodeDownload, body io.Reader, dest string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return 0, err
+	}
+
+	tmp := dest + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	lastSent := time.Now()
+	buf := make([]byte, 256*1024)
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			if _, err = f.Write(buf[:n]); err != nil {
+				break
+			}
+			written += int64(n)
+
+			m.episodeDownloadsMu.Lock()
+			download.DownloadedBytes = written
+			m.episodeDownloadsMu.Unlock()
+
+			if time.Since(lastSent) > time.Second {
+				m.sendEpisodeDownloads()
+				lastSent = time.Now()
+			}
+		}
+		if readErr != nil {
+			if !errors.Is(readErr, io.EOF) {
+				err = readErr
+			}
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && download.TotalBytes > 0 && written != download.TotalBytes {
+		err = fmt.Errorf("incomplete download, %d of %d bytes", written, download.TotalBytes)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+
+	if err = os.Rename(tmp, dest); err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+
+	localStorageSizeCache = 0
+
+	return written, nil
+}
+
+func (m *ManagerImpl) sendEpisodeDownloads() {
+	m.wsEventManager.SendEvent(events.LocalEpisodeDownloadProgress, m.GetEpisodeDownloads())
+}
+
+// GetEpisodeDownloads returns the episodes being downloaded.
+func (m *ManagerImpl) GetEpisodeDownloads() []*EpisodeDownload {
+	m.episodeDownloadsMu.Lock()
+	defer m.episodeDownloadsMu.Unlock()
+
+	ret := make([]*EpisodeDownload, 0, len(m.episodeDownloads))
+	for _, d := range m.episodeDownloads {
+		c := *d
+		ret = append(ret, &c)
+	}
+	return ret
+}
+
+// CancelEpisodeDownload cancels the download of an episode.
+func (m *ManagerImpl) CancelEpisodeDownload(mediaId int, episodeNumber int) error {
+	m.episodeDownloadsMu.Lock()
+	defer m.episodeDownloadsMu.Unlock()
+
+	d, found := m.episodeDownloads[episodeDownloadKey(mediaId, episodeNumber)]
+	if !found {
+		return fmt.Errorf("local manager: Episode is not being downloaded")
+	}
+	d.cancel()
+	return nil
+}
+
+//----------------------------------------------------------------------------------------------------------------------------------------------------
+
+// GetOfflineEpisodes returns the downloaded episodes.
+func (m *ManagerImpl) GetOfflineEpisodes() []*OfflineEpisode {
+	ret, _ := m.localDb.GetOfflineEpisodes()
+	return ret
+}
+
+// RemoveOfflineEpisode deletes a downloaded episode.
+// The anime is removed from the local database on the next synchronization if it has no local files left.
+func (m *ManagerImpl) RemoveOfflineEpisode(mediaId int, episodeNumber int) error {
+	oe, found := m.localDb.GetOfflineEpisode(mediaId, episodeNumber)
+	if !found {
+		return fmt.Errorf("local manager: Episode not downloaded")
+	}
+
+	if err := m.removeOfflineEpisode(oe); err != nil {
+		return err
+	}
+
+	if err := m.SynchronizeLocal(); err != nil {
+		m.logger.Warn().Err(err).Msg("local manager: Could not synchronize after removing episode")
+	}
+
+	return nil
+}
+
+func (m *ManagerImpl) removeOfflineEpisode(oe *OfflineEpisode) error {
+	m.logger.Trace().Int("mediaId", oe.MediaId).Int("episode", oe.EpisodeNumber).Msg("local manager: Removing offline episode")
+
+	if err := os.Remove(oe.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("local manager: Failed to remove episode file: %w", err)
+	}
+	// Remove the media directory if it's empty
+	_ = os.Remove(filepath.Dir(oe.Path))
+
+	localStorageSizeCache = 0
+
+	return m.localDb.RemoveOfflineEpisode(oe.ID)
+}
+
+// removeOfflineEpisodes deletes the downloaded episodes of an anime.
+func (m *ManagerImpl) removeOfflineEpisodes(mediaId int) {
+	episodes, _ := m.localDb.GetOfflineEpisodesByMediaId(mediaId)
+	for _, oe := range episodes {
+		_ = m.removeOfflineEpisode(oe)
+	}
+}
+
+// GetOfflineLocalFiles returns the downloaded episodes as local files.
+// Episodes whose file was deleted are ignored.
+func (m *ManagerImpl) GetOfflineLocalFiles() []*anime.LocalFile {
+	episodes, _ := m.localDb.GetOfflineEpisodes()
+
+	ret := make([]*anime.LocalFile, 0, len(episodes))
+	for _, oe := range episodes {
+		if _, err := os.Stat(oe.Path); err != nil {
+			continue
+		}
+		lf := anime.NewLocalFile(oe.Path, filepath.Join(m.localDir, offlineEpisodesDirName))
+		lf.MediaId = oe.MediaId
+		lf.Locked = true
+		lf.Metadata = &anime.LocalFileMetadata{
+			Episode:      oe.EpisodeNumber,
+			AniDBEpisode: oe.AniDBEpisode,
+			Type:         anime.LocalFileTypeMain,
+		}
+		ret = append(ret, lf)
+	}
+	return ret
+}
+
+//----------------------------------------------------------------------------------------------------------------------------------------------------
+
+func getFilenameFromResponse(resp *http.Response) string {
+	if cd := resp.Header.Get("Content-Disposition"); cd != "" {
+		if _, params, err := mime.ParseMediaType(cd); err == nil && params["filename"] != "" {
+			return params["filename"]
+		}
+	}
+	if resp.Request != nil && resp.Request.URL != nil {
+		name := path.Base(resp.Request.URL.Path)
+		if unescaped, err := url.PathUnescape(name); err == nil {
+			name = unescaped
+		}
+		if path.Ext(name) != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// sanitizeEpisodeFilename removes the directories and the characters that are invalid in file names.
+func sanitizeEpisodeFilename(name string) string {
+	name = filepath.Base(filepath.FromSlash(strings.ReplaceAll(name, `\`, "/")))
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return ""
+	}
+	return util.SanitizeFilename(name)
+}
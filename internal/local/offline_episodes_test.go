@@ -0,0 +1,205 @@
+package local
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"seanime/internal/api/anilist"
+	"seanime/internal/events"
+	"seanime/internal/library/anime"
+	"seanime/internal/util"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samber/mo"
+	"github.com/stretchr/testify/require"
+)
+
+func getOfflineEpisodesTestManager(t *testing.T) *ManagerImpl {
+	logger := util.NewLogger()
+	localDir := t.TempDir()
+
+	m, err := NewManager(&NewManagerOptions{
+		LocalDir:       localDir,
+		AssetDir:       filepath.Join(localDir, "assets"),
+		Logger:         logger,
+		WSEventManager: events.NewMockWSEventManager(logger),
+	})
+	require.NoError(t, err)
+
+	ret := m.(*ManagerImpl)
+	ret.animeCollection = mo.Some(&anilist.AnimeCollection{
+		MediaListCollection: &anilist.AnimeCollection_MediaListCollection{
+			Lists: []*anilist.AnimeCollection_MediaListCollection_Lists{
+				{Entries: []*anilist.AnimeListEntry{
+					{Media: &anilist.BaseAnime{ID: 1}},
+				}},
+			},
+		},
+	})
+
+	// Pending local changes block the synchronization that follows a download, it would fetch the metadata of the anime
+	require.NoError(t, ret.localDb.SaveSettings(&Settings{Updated: true}))
+	t.Cleanup(func() { CurrSettings = nil })
+
+	return ret
+}
+
+func TestDownloadEpisode(t *testing.T) {
+	m := getOfflineEpisodesTestManager(t)
+
+	content := strings.Repeat("episode", 100_000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="../Show - 01.mkv"`)
+		_, _ = io.WriteString(w, content)
+	}))
+	defer server.Close()
+
+	// Not in the collection
+	err := m.DownloadEpisode(&DownloadEpisodeOptions{MediaId: 2, EpisodeNumber: 1, Url: server.URL})
+	require.Error(t, err)
+
+	// No file
+	err = m.DownloadEpisode(&DownloadEpisodeOptions{MediaId: 1, EpisodeNumber: 1})
+	require.Error(t, err)
+
+	err = m.DownloadEpisode(&DownloadEpisodeOptions{MediaId: 1, EpisodeNumber: 1, AniDBEpisode: "1", Source: OfflineEpisodeSourceDebrid, Url: server.URL})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		_, found := m.localDb.GetOfflineEpisode(1, 1)
+		return found && len(m.GetEpisodeDownloads()) == 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	oe, _ := m.localDb.GetOfflineEpisode(1, 1)
+	require.Equal(t, filepath.Join(m.localDir, offlineEpisodesDirName, "1", "Show - 01.mkv"), oe.Path)
+	require.Equal(t, int64(len(content)), oe.Size)
+	require.Equal(t, OfflineEpisodeSourceDebrid, oe.Source)
+
+	data, err := os.ReadFile(oe.Path)
+	require.NoError(t, err)
+	require.Equal(t, content, string(data))
+
+	// The anime is tracked once the episode is downloaded
+	_, tracked := m.localDb.GetTrackedMedia(1, AnimeType)
+	require.True(t, tracked)
+
+	err = m.DownloadEpisode(&DownloadEpisodeOptions{MediaId: 1, EpisodeNumber: 1, Url: server.URL})
+	require.ErrorIs(t, err, ErrEpisodeAlreadyDownloaded)
+
+	t.Run("Cancel download", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		defer pw.Close()
+
+		err := m.DownloadEpisode(&DownloadEpisodeOptions{MediaId: 1, EpisodeNumber: 2, Filename: "Show - 02.mkv", Size: 1000, Reader: pr})
+		require.NoError(t, err)
+
+		_, _ = pw.Write([]byte("partial"))
+
+		err = m.DownloadEpisode(&DownloadEpisodeOptions{MediaId: 1, EpisodeNumber: 2, Url: server.URL})
+		require.ErrorIs(t, err, ErrEpisodeDownloading)
+
+		require.NoError(t, m.CancelEpisodeDownload(1, 2))
+		require.Eventually(t, func() bool {
+			return len(m.GetEpisodeDownloads()) == 0
+		}, 5*time.Second, 50*time.Millisecond)
+
+		_, found := m.localDb.GetOfflineEpisode(1, 2)
+		require.False(t, found)
+
+		dest := filepath.Join(m.localDir, offlineEpisodesDirName, "1", "Show - 02.mkv")
+		require.NoFileExists(t, dest)
+		require.NoFileExists(t, dest+".part")
+	})
+}
+
+func TestWriteEpisodeFile(t *testing.T) {
+	m := getOfflineEpisodesTestManager(t)
+	dir := t.TempDir()
+
+	t.Run("Complete", func(t *testing.T) {
+		dest := filepath.Join(dir, "1", "complete.mkv")
+		download := &EpisodeDownload{TotalBytes: 5}
+
+		written, err := m.writeEpisodeFile(context.Background(), download, strings.NewReader("hello"), dest)
+		require.NoError(t, err)
+		require.Equal(t, int64(5), written)
+		require.Equal(t, int64(5), download.DownloadedBytes)
+
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		require.Equal(t, "hello", string(data))
+		require.NoFileExists(t, dest+".part")
+	})
+
+	t.Run("Incomplete", func(t *testing.T) {
+		dest := filepath.Join(dir, "1", "incomplete.mkv")
+
+		_, err := m.writeEpisodeFile(context.Background(), &EpisodeDownload{TotalBytes: 10}, strings.NewReader("hello"), dest)
+		require.ErrorContains(t, err, "incomplete download")
+		require.NoFileExists(t, dest)
+		require.NoFileExists(t, dest+".part")
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		dest := filepath.Join(dir, "1", "cancelled.mkv")
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := m.writeEpisodeFile(ctx, &EpisodeDownload{}, strings.NewReader("hello"), dest)
+		require.ErrorIs(t, err, context.Canceled)
+		require.NoFileExists(t, dest)
+		require.NoFileExists(t, dest+".part")
+	})
+}
+
+func TestSanitizeEpisodeFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"Show - 01.mkv", "Show - 01.mkv"},
+		{"../../Show - 01.mkv", "Show - 01.mkv"},
+		{`C:\Videos\Show - 01.mkv`, "Show - 01.mkv"},
+		{`Show: "Part 1" <01>?.mkv`, "Show Part 1 01.mkv"},
+		{"Show|01*.mkv", "Show01.mkv"},
+		{"Show\t01.mkv", "Show01.mkv"},
+		{"..", ""},
+		{"/", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, sanitizeEpisodeFilename(tt.name))
+		})
+	}
+}
+
+func TestGetOfflineLocalFiles(t *testing.T) {
+	m := getOfflineEpisodesTestManager(t)
+
+	episodesDir := filepath.Join(m.localDir, offlineEpisodesDirName)
+	existing := filepath.Join(episodesDir, "1", "Show - 01.mkv")
+	require.NoError(t, os.MkdirAll(filepath.Dir(existing), os.ModePerm))
+	require.NoError(t, os.WriteFile(existing, []byte("episode"), 0644))
+
+	require.NoError(t, m.localDb.SaveOfflineEpisode(&OfflineEpisode{MediaId: 1, EpisodeNumber: 1, AniDBEpisode: "1", Path: existing, Size: 7, Source: OfflineEpisodeSourceTorrentstream}))
+	// The file of this episode was deleted
+	require.NoError(t, m.localDb.SaveOfflineEpisode(&OfflineEpisode{MediaId: 1, EpisodeNumber: 2, AniDBEpisode: "2", Path: filepath.Join(episodesDir, "1", "Show - 02.mkv"), Source: OfflineEpisodeSourceTorrentstream}))
+
+	lfs := m.GetOfflineLocalFiles()
+	require.Len(t, lfs, 1)
+
+	lf := lfs[0]
+	require.Equal(t, 1, lf.MediaId)
+	require.True(t, lf.Locked)
+	require.Equal(t, 1, lf.Metadata.Episode)
+	require.Equal(t, "1", lf.Metadata.AniDBEpisode)
+	require.Equal(t, anime.LocalFileTypeMain, lf.Metadata.Type)
+	require.Equal(t, util.NormalizePath(existing), util.NormalizePath(lf.Path))
+}
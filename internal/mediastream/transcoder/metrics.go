@@ -0,0 +1,32 @@
+package transcoder
+
+import (
+	"seanime/internal/metrics"
+	"strings"
+)
+
+var (
+	ffmpegProcessesGauge = metrics.NewGaugeVec(
+		"transcoder_ffmpeg_processes",
+		"Number of running ffmpeg transcoding processes.",
+		"kind",
+	)
+	ffmpegProcessesCounter = metrics.NewCounterVec(
+		"transcoder_ffmpeg_processes_total",
+		"Number of ffmpeg transcoding processes that exited, by result.",
+		"kind", "result",
+	)
+)
+
+// registerMetrics exposes the number of active file streams of the transcoder.
+func (t *Transcoder) registerMetrics() {
+	metrics.NewGaugeFunc("transcoder_active_streams", "Number of files being transcoded.", func() float64 {
+		return float64(len(t.streams.Keys()))
+	})
+}
+
+// metricsKind returns the kind of the stream without the track or quality, e.g. "video" for "video (720p)".
+func (ts *Stream) metricsKind() string {
+	kind, _, _ := strings.Cut(ts.kind, " ")
+	return kind
+}
@@ -507,6 +507,7 @@ func (ts *Stream) run(start int32) error {
 	if err != nil {
 		return err
 	}
+	ffmpegProcessesGauge.With(ts.metricsKind()).Inc()
 	ts.lockHeads()
 	ts.heads[encoderId].command = cmd
 	ts.heads[encoderId].stdin = stdin
@@ -604,12 +605,16 @@ func (ts *Stream) run(start int32) error {
 			}
 		}
 
+		ffmpegProcessesGauge.With(ts.metricsKind()).Dec()
 		if errors.As(err, &exitErr) && exitErr.ExitCode() == 255 {
 			streamLogger.Trace().Int("eid", encoderId).Msgf("transcoder: ffmpeg process was terminated")
+			ffmpegProcessesCounter.With(ts.metricsKind(), "terminated").Inc()
 		} else if err != nil {
 			streamLogger.Error().Int("eid", encoderId).Err(fmt.Errorf("%s: %s", err, stderr.String())).Msgf("transcoder: ffmpeg process failed")
+			ffmpegProcessesCounter.With(ts.metricsKind(), "failed").Inc()
 		} else {
 			streamLogger.Trace().Int("eid", encoderId).Msgf("transcoder: ffmpeg process for %s exited", ts.kind)
+			ffmpegProcessesCounter.With(ts.metricsKind(), "exited").Inc()
 		}
 
 		ts.lockHeads()
@@ -71,6 +71,7 @@ func NewTranscoder(opts *NewTranscoderOptions) (*Transcoder, error) {
 		},
 	}
 	ret.tracker = NewTracker(ret)
+	ret.registerMetrics()
 
 	ret.logger.Info().Msg("transcoder: Initialized")
 	return ret, nil
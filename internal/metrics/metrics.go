@@ -0,0 +1,439 @@
+// Package metrics implements the metric types exposed in the Prometheus text format.
+// Metrics are registered in the default registry when created, modules can register
+// gauges computed at scrape time with NewGaugeFunc and NewGaugeVecFunc.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const namespace = "seanime_"
+
+// DefBuckets are the default histogram buckets, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+type (
+	// Registry holds the metric families exposed on the metrics endpoint.
+	Registry struct {
+		mu       sync.RWMutex
+		families map[string]family
+	}
+
+	family interface {
+		name() string
+		write(w *bytes.Buffer)
+	}
+)
+
+var defaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+// register adds the metric family to the registry, replacing the family with the same name.
+// Modules that are re-created when the settings change register their gauges again.
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	r.families[f.name()] = f
+	r.mu.Unlock()
+}
+
+// WriteTo writes all the metric families in the Prometheus text format, sorted by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	families := make([]family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name() < families[j].name()
+	})
+
+	var buf bytes.Buffer
+	for _, f := range families {
+		f.write(&buf)
+	}
+	return buf.WriteTo(w)
+}
+
+// WriteTo writes the metrics of the default registry.
+func WriteTo(w io.Writer) (int64, error) {
+	return defaultRegistry.WriteTo(w)
+}
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// vec holds the values of a metric family, one per combination of label values.
+type vec[T any] struct {
+	fullName   string
+	help       string
+	typ        string
+	labelNames []string
+	newValue   func() *T
+
+	mu     sync.RWMutex
+	values map[string]*T
+	labels map[string][]string
+}
+
+func newVec[T any](name string, help string, typ string, labelNames []string, newValue func() *T) *vec[T] {
+	return &vec[T]{
+		fullName:   namespace + name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		newValue:   newValue,
+		values:     make(map[string]*T),
+		labels:     make(map[string][]string),
+	}
+}
+
+func (v *vec[T]) name() string { return v.fullName }
+
+func (v *vec[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.fullName, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.RLock()
+	value, ok := v.values[key]
+	v.mu.RUnlock()
+	if ok {
+		return value
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if value, ok = v.values[key]; ok {
+		return value
+	}
+	value = v.newValue()
+	v.values[key] = value
+	v.labels[key] = append([]string(nil), labelValues...)
+	return value
+}
+
+func (v *vec[T]) delete(labelValues []string) {
+	key := strings.Join(labelValues, "\xff")
+	v.mu.Lock()
+	delete(v.values, key)
+	delete(v.labels, key)
+	v.mu.Unlock()
+}
+
+func (v *vec[T]) reset() {
+	v.mu.Lock()
+	v.values = make(map[string]*T)
+	v.labels = make(map[string][]string)
+	v.mu.Unlock()
+}
+
+// each calls fn for every value, sorted by label values so that the output is stable.
+func (v *vec[T]) each(fn func(labelValues []string, value *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fn(v.labels[k], v.values[k])
+	}
+	v.mu.RUnlock()
+}
+
+func (v *vec[T]) writeHeader(w *bytes.Buffer) {
+	w.WriteString("# HELP " + v.fullName + " " + escapeHelp(v.help) + "\n")
+	w.WriteString("# TYPE " + v.fullName + " " + v.typ + "\n")
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Counter is a value that only goes up.
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (c *Counter) Inc() { c.Add(1) }
+
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.value += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) get() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+type CounterVec struct {
+	*vec[Counter]
+}
+
+// NewCounterVec creates and registers a counter, the name is prefixed with "seanime_".
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	ret := &CounterVec{newVec(name, help, "counter", labelNames, func() *Counter { return &Counter{} })}
+	defaultRegistry.register(ret)
+	return ret
+}
+
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	return v.with(labelValues)
+}
+
+func (v *CounterVec) write(w *bytes.Buffer) {
+	v.writeHeader(w)
+	v.each(func(labelValues []string, c *Counter) {
+		writeSample(w, v.fullName, v.labelNames, labelValues, c.get())
+	})
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	g.value = v
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Add(v float64) {
+	g.mu.Lock()
+	g.value += v
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Inc() { g.Add(1) }
+func (g *Gauge) Dec() { g.Add(-1) }
+
+func (g *Gauge) get() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+type GaugeVec struct {
+	*vec[Gauge]
+}
+
+// NewGaugeVec creates and registers a gauge, the name is prefixed with "seanime_".
+func NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+	ret := &GaugeVec{newVec(name, help, "gauge", labelNames, func() *Gauge { return &Gauge{} })}
+	defaultRegistry.register(ret)
+	return ret
+}
+
+func (v *GaugeVec) With(labelValues ...string) *Gauge {
+	return v.with(labelValues)
+}
+
+// Delete removes the gauge with the label values, e.g. when the labelled resource no longer exists.
+func (v *GaugeVec) Delete(labelValues ...string) {
+	v.delete(labelValues)
+}
+
+// Reset removes all the gauges.
+func (v *GaugeVec) Reset() {
+	v.reset()
+}
+
+func (v *GaugeVec) write(w *bytes.Buffer) {
+	v.writeHeader(w)
+	v.each(func(labelValues []string, g *Gauge) {
+		writeSample(w, v.fullName, v.labelNames, labelValues, g.get())
+	})
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Histogram counts observations in buckets, e.g. durations.
+type Histogram struct {
+	upperBounds []float64
+
+	mu     sync.Mutex
+	counts []uint64 // Non-cumulative, one per bucket
+	sum    float64
+	count  uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+type HistogramVec struct {
+	*vec[Histogram]
+	buckets []float64
+}
+
+// NewHistogramVec creates and registers a histogram, the name is prefixed with "seanime_".
+// DefBuckets are used if buckets is nil.
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	ret := &HistogramVec{buckets: buckets}
+	ret.vec = newVec(name, help, "histogram", labelNames, func() *Histogram {
+		return &Histogram{upperBounds: buckets, counts: make([]uint64, len(buckets))}
+	})
+	defaultRegistry.register(ret)
+	return ret
+}
+
+func (v *HistogramVec) With(labelValues ...string) *Histogram {
+	return v.with(labelValues)
+}
+
+func (v *HistogramVec) write(w *bytes.Buffer) {
+	v.writeHeader(w)
+	bucketLabels := append(append([]string(nil), v.labelNames...), "le")
+	v.each(func(labelValues []string, h *Histogram) {
+		h.mu.Lock()
+		counts := append([]uint64(nil), h.counts...)
+		sum, count := h.sum, h.count
+		h.mu.Unlock()
+
+		var cumulative uint64
+		for i, upperBound := range v.buckets {
+			cumulative += counts[i]
+			writeSample(w, v.fullName+"_bucket", bucketLabels, append(append([]string(nil), labelValues...), formatFloat(upperBound)), float64(cumulative))
+		}
+		writeSample(w, v.fullName+"_bucket", bucketLabels, append(append([]string(nil), labelValues...), "+Inf"), float64(count))
+		writeSample(w, v.fullName+"_sum", v.labelNames, labelValues, sum)
+		writeSample(w, v.fullName+"_count", v.labelNames, labelValues, float64(count))
+	})
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// funcFamily is a gauge or counter whose values are computed when the metrics are scraped.
+type funcFamily struct {
+	fullName   string
+	help       string
+	typ        string
+	labelNames []string
+	collect    func(emit func(value float64, labelValues ...string))
+}
+
+// NewGaugeFunc registers a gauge whose value is returned by fn when the metrics are scraped.
+// Registering a gauge with the same name replaces the previous one.
+func NewGaugeFunc(name string, help string, fn func() float64) {
+	NewGaugeVecFunc(name, help, nil, func(emit func(value float64, labelValues ...string)) {
+		emit(fn())
+	})
+}
+
+// NewGaugeVecFunc registers a labelled gauge whose values are emitted by collect when the metrics are scraped.
+// Registering a gauge with the same name replaces the previous one.
+func NewGaugeVecFunc(name string, help string, labelNames []string, collect func(emit func(value float64, labelValues ...string))) {
+	defaultRegistry.register(&funcFamily{
+		fullName:   namespace + name,
+		help:       help,
+		typ:        "gauge",
+		labelNames: labelNames,
+		collect:    collect,
+	})
+}
+
+// NewCounterVecFunc registers a labelled counter whose values are emitted by collect when the metrics are scraped.
+// It is used to expose the counters kept by other libraries, e.g. the bytes transferred by the torrent client.
+func NewCounterVecFunc(name string, help string, labelNames []string, collect func(emit func(value float64, labelValues ...string))) {
+	defaultRegistry.register(&funcFamily{
+		fullName:   namespace + name,
+		help:       help,
+		typ:        "counter",
+		labelNames: labelNames,
+		collect:    collect,
+	})
+}
+
+func (f *funcFamily) name() string { return f.fullName }
+
+func (f *funcFamily) write(w *bytes.Buffer) {
+	w.WriteString("# HELP " + f.fullName + " " + escapeHelp(f.help) + "\n")
+	w.WriteString("# TYPE " + f.fullName + " " + f.typ + "\n")
+	f.collect(func(value float64, labelValues ...string) {
+		if len(labelValues) != len(f.labelNames) {
+			return
+		}
+		writeSample(w, f.fullName, f.labelNames, labelValues, value)
+	})
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func writeSample(w *bytes.Buffer, name string, labelNames []string, labelValues []string, value float64) {
+	w.WriteString(name)
+	if len(labelNames) > 0 {
+		w.WriteByte('{')
+		for i, labelName := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(labelName + `="` + escapeLabelValue(labelValues[i]) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
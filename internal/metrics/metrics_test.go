@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T) string {
+	var buf bytes.Buffer
+	_, err := WriteTo(&buf)
+	require.NoError(t, err)
+	return buf.String()
+}
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Number of test requests.", "operation", "result")
+	c.With("GetViewer", "success").Inc()
+	c.With("GetViewer", "success").Add(2)
+	c.With("Search \"one\"", "error").Inc()
+
+	out := scrape(t)
+	require.Contains(t, out, "# HELP seanime_test_requests_total Number of test requests.\n# TYPE seanime_test_requests_total counter\n")
+	require.Contains(t, out, `seanime_test_requests_total{operation="GetViewer",result="success"} 3`+"\n")
+	require.Contains(t, out, `seanime_test_requests_total{operation="Search \"one\"",result="error"} 1`+"\n")
+
+	// Counters cannot decrease
+	c.With("GetViewer", "success").Add(-1)
+	require.Contains(t, scrape(t), `seanime_test_requests_total{operation="GetViewer",result="success"} 3`+"\n")
+
+	require.Panics(t, func() { c.With("GetViewer") })
+}
+
+func TestGaugeVec(t *testing.T) {
+	g := NewGaugeVec("test_clients", "Number of test clients.")
+	g.With().Inc()
+	g.With().Inc()
+	g.With().Dec()
+
+	out := scrape(t)
+	require.Contains(t, out, "# TYPE seanime_test_clients gauge\n")
+	require.Contains(t, out, "seanime_test_clients 1\n")
+
+	g.With().Set(0.5)
+	require.Contains(t, scrape(t), "seanime_test_clients 0.5\n")
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "Duration of test calls.", []float64{1, 0.1}, "extension_id")
+	h.With("ext").Observe(0.05)
+	h.With("ext").Observe(0.5)
+	h.With("ext").Observe(2)
+
+	out := scrape(t)
+	require.Contains(t, out, "# TYPE seanime_test_duration_seconds histogram\n")
+	expected := strings.Join([]string{
+		`seanime_test_duration_seconds_bucket{extension_id="ext",le="0.1"} 1`,
+		`seanime_test_duration_seconds_bucket{extension_id="ext",le="1"} 2`,
+		`seanime_test_duration_seconds_bucket{extension_id="ext",le="+Inf"} 3`,
+		`seanime_test_duration_seconds_sum{extension_id="ext"} 2.55`,
+		`seanime_test_duration_seconds_count{extension_id="ext"} 3`,
+	}, "\n")
+	require.Contains(t, out, expected)
+}
+
+func TestGaugeVecFunc(t *testing.T) {
+	NewGaugeVecFunc("test_peers", "Number of test peers.", []string{"state"}, func(emit func(value float64, labelValues ...string)) {
+		emit(4, "active")
+		emit(1, "pending")
+	})
+
+	out := scrape(t)
+	require.Contains(t, out, `seanime_test_peers{state="active"} 4`+"\n")
+	require.Contains(t, out, `seanime_test_peers{state="pending"} 1`+"\n")
+
+	// Registering the gauge again replaces it
+	NewGaugeFunc("test_peers", "Number of test peers.", func() float64 { return 2 })
+	out = scrape(t)
+	require.Contains(t, out, "seanime_test_peers 2\n")
+	require.NotContains(t, out, `seanime_test_peers{state="active"}`)
+	require.Equal(t, 1, strings.Count(out, "# TYPE seanime_test_peers gauge"))
+}
+
+func TestWriteToSorted(t *testing.T) {
+	NewGaugeFunc("test_b", "B.", func() float64 { return 1 })
+	NewGaugeFunc("test_a", "A.", func() float64 { return 1 })
+
+	out := scrape(t)
+	require.Less(t, strings.Index(out, "# HELP seanime_test_a "), strings.Index(out, "# HELP seanime_test_b "))
+	require.Contains(t, out, "# HELP seanime_go_goroutines ")
+}
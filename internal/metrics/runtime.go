@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"runtime"
+	"time"
+)
+
+var startTime = time.Now()
+
+func init() {
+	NewGaugeFunc("go_goroutines", "Number of goroutines.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	NewGaugeFunc("go_heap_alloc_bytes", "Bytes of allocated heap objects.", func() float64 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return float64(m.HeapAlloc)
+	})
+	NewGaugeFunc("start_time_seconds", "Start time of the server since unix epoch in seconds.", func() float64 {
+		return float64(startTime.Unix())
+	})
+}
@@ -15,6 +15,7 @@ func (m *Manager) registerDefaultHandlers() {
 	m.messageHandlers[MessageTypePong] = m.handlePongMessage
 	m.messageHandlers[MessageTypeError] = m.handleErrorMessage
 	m.messageHandlers[MessageTypeCustom] = m.handleCustomMessage
+	m.messageHandlers[MessageTypeRelayStreamRequest] = m.handleRelayStreamRequestMessage
 
 	// Watch party handlers
 	m.messageHandlers[MessageTypeWatchPartyCreated] = m.handleWatchPartyMessage
@@ -59,7 +59,7 @@ func (m *Manager) startHostServices() {
 // RoomsAvailable returns true if the Rooms API is available.
 func (m *Manager) RoomsAvailable() bool {
 	resp, err := m.reqClient.R().
-		Get(constants.SeanimeRoomsApiUrl + "/health")
+		Get(m.getRoomsApiUrl() + "/health")
 	if err != nil {
 		return false
 	}
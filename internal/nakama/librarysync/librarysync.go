@@ -0,0 +1,520 @@
+package librarysync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"seanime/internal/customsource"
+	"seanime/internal/database/db"
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/database/models"
+	"seanime/internal/events"
+	"seanime/internal/library/anime"
+	"seanime/internal/nakama"
+	"seanime/internal/util"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+// DEVNOTE: Files are copied from the Nakama host to "<library>/<host's relative directories>/<filename>".
+// The host's LocalFile is stored with the download and added to the local files once the copy is complete,
+// so the file doesn't need to be matched by a scan.
+// Files are downloaded to "<path>.part" and resumed with range requests after a failure or a restart.
+
+const (
+	StatusQueued      = "queued"
+	StatusDownloading = "downloading"
+	StatusCompleted   = "completed"
+	StatusFailed      = "failed"
+	StatusCancelled   = "cancelled"
+)
+
+var (
+	ErrNoLibraryPath = errors.New("library sync: No library path set")
+	ErrNotFound      = errors.New("library sync: Download not found")
+)
+
+type (
+	// HostClient gives access to the host's anime library, implemented by nakama.Manager.
+	HostClient interface {
+		GetHostAnimeLibraryFiles(ctx context.Context, mId ...int) (lfs []*anime.LocalFile, customSourceMap nakama.NakamaCustomSourceMap, hydrated bool)
+		NewHostAnimeLibraryDownloadRequest(ctx context.Context, path string) (*http.Request, error)
+	}
+
+	// Manager copies files from the Nakama host's anime library one at a time in a background worker.
+	// It also throttles the files served to the peers when acting as a host.
+	Manager struct {
+		logger         *zerolog.Logger
+		database       *db.Database
+		wsEventManager events.WSEventManagerInterface
+		host           HostClient
+		httpClient     *http.Client
+
+		// downloadLimiter throttles the files copied from the host, uploadLimiter the files served to the peers
+		downloadLimiter *rate.Limiter
+		uploadLimiter   *rate.Limiter
+
+		mu       sync.Mutex
+		queue    []uint
+		current  uint
+		cancel   context.CancelFunc
+		progress map[uint]*Progress
+		wakeCh   chan struct{}
+
+		// localFilesMu prevents concurrent read-modify-write of the local files
+		localFilesMu sync.Mutex
+
+		progressSentAt time.Time
+	}
+
+	NewManagerOptions struct {
+		Logger         *zerolog.Logger
+		Database       *db.Database
+		WSEventManager events.WSEventManagerInterface
+		Host           HostClient
+	}
+
+	EnqueueOptions struct {
+		MediaId int `json:"mediaId"`
+		// Paths are the paths of the files on the host, all the shared files of the media are copied if empty
+		Paths []string `json:"paths"`
+		// Directory is the library directory in which the files are saved, defaults to the main library path
+		Directory string `json:"directory"`
+	}
+
+	// Progress is the progress of the file being downloaded.
+	Progress struct {
+		DownloadedBytes int64 `json:"downloadedBytes"`
+		// TotalBytes is -1 if unknown
+		TotalBytes int64 `json:"totalBytes"`
+	}
+
+	Download struct {
+		*models.NakamaLibraryDownload
+		Progress *Progress `json:"progress,omitempty"`
+	}
+)
+
+func NewManager(opts *NewManagerOptions) *Manager {
+	return &Manager{
+		logger:          opts.Logger,
+		database:        opts.Database,
+		wsEventManager:  opts.WSEventManager,
+		host:            opts.Host,
+		httpClient:      &http.Client{},
+		downloadLimiter: rate.NewLimiter(rate.Inf, 0),
+		uploadLimiter:   rate.NewLimiter(rate.Inf, 0),
+		queue:           make([]uint, 0),
+		progress:        make(map[uint]*Progress),
+		wakeCh:          make(chan struct{}, 1),
+	}
+}
+
+// SetBandwidthLimits sets the download and upload limits in KiB/s. 0 means no limit.
+func (m *Manager) SetBandwidthLimits(downloadKiB int, uploadKiB int) {
+	setLimit(m.downloadLimiter, downloadKiB)
+	setLimit(m.uploadLimiter, uploadKiB)
+}
+
+// Start resumes the unfinished downloads and starts the worker in a goroutine.
+func (m *Manager) Start() {
+	downloads, err := m.database.GetNakamaLibraryDownloadsByStatus(StatusQueued, StatusDownloading)
+	if err != nil {
+		m.logger.Error().Err(err).Msg("library sync: Failed to get unfinished downloads")
+	}
+
+	m.mu.Lock()
+	for _, d := range downloads {
+		m.queue = append(m.queue, d.ID)
+	}
+	m.mu.Unlock()
+
+	if len(downloads) > 0 {
+		m.logger.Info().Int("count", len(downloads)).Msg("library sync: Resuming downloads")
+		m.wake()
+	}
+
+	go func() {
+		for range m.wakeCh {
+			m.processQueue()
+		}
+	}()
+}
+
+func (m *Manager) wake() {
+	select {
+	case m.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Enqueue queues the host's files of the media.
+// Files that are already queued or that already exist in the library are skipped.
+func (m *Manager) Enqueue(ctx context.Context, opts *EnqueueOptions) ([]*models.NakamaLibraryDownload, error) {
+	if opts.MediaId == 0 {
+		return nil, errors.New("library sync: No media")
+	}
+	// Custom source IDs are generated by each instance, they don't match between the host and the peer
+	if customsource.IsExtensionId(opts.MediaId) {
+		return nil, errors.New("library sync: Custom source media cannot be copied")
+	}
+
+	directory := opts.Directory
+	if directory == "" {
+		directory, _ = m.database.GetLibraryPathFromSettings()
+	}
+	if directory == "" {
+		return nil, ErrNoLibraryPath
+	}
+
+	lfs, _, ok := m.host.GetHostAnimeLibraryFiles(ctx, opts.MediaId)
+	if !ok {
+		return nil, errors.New("library sync: Cannot access the host's anime library")
+	}
+
+	existing, err := m.database.GetNakamaLibraryDownloadsByStatus(StatusQueued, StatusDownloading)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*models.NakamaLibraryDownload, 0, len(lfs))
+	for _, lf := range lfs {
+		if lf.MediaId != opts.MediaId {
+			continue
+		}
+		if len(opts.Paths) > 0 && !slices.ContainsFunc(opts.Paths, lf.HasSamePath) {
+			continue
+		}
+		if slices.ContainsFunc(existing, func(d *models.NakamaLibraryDownload) bool {
+			return d.HostPath == lf.Path
+		}) {
+			continue
+		}
+
+		dest, err := getDestination(directory, lf)
+		if err != nil {
+			m.logger.Warn().Err(err).Str("path", lf.Path).Msg("library sync: Skipping file")
+			continue
+		}
+		if _, err := os.Stat(dest); err == nil {
+			m.logger.Debug().Str("path", dest).Msg("library sync: File already in library, skipping")
+			continue
+		}
+
+		marshaledLf, err := json.Marshal(lf)
+		if err != nil {
+			return nil, err
+		}
+
+		d := &models.NakamaLibraryDownload{
+			MediaId:      lf.MediaId,
+			HostPath:     lf.Path,
+			Path:         dest,
+			Episode:      lf.GetEpisodeNumber(),
+			AniDBEpisode: lf.GetAniDBEpisode(),
+			LocalFile:    marshaledLf,
+			Status:       StatusQueued,
+		}
+		if err := m.database.SaveNakamaLibraryDownload(d); err != nil {
+			return nil, err
+		}
+		ret = append(ret, d)
+	}
+
+	m.mu.Lock()
+	for _, d := range ret {
+		m.queue = append(m.queue, d.ID)
+	}
+	m.mu.Unlock()
+
+	if len(ret) > 0 {
+		m.logger.Debug().Int("mediaId", opts.MediaId).Int("count", len(ret)).Msg("library sync: Files queued")
+		m.sendProgress()
+		m.wake()
+	}
+
+	return ret, nil
+}
+
+// GetDownloads returns all the downloads, with the progress of the one being downloaded.
+func (m *Manager) GetDownloads() ([]*Download, error) {
+	downloads, err := m.database.GetNakamaLibraryDownloads()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret := make([]*Download, 0, len(downloads))
+	for _, d := range downloads {
+		item := &Download{NakamaLibraryDownload: d}
+		if p, ok := m.progress[d.ID]; ok {
+			c := *p
+			item.Progress = &c
+		}
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
+
+// Cancel stops or dequeues the download and removes its partial file.
+func (m *Manager) Cancel(id uint) error {
+	d, err := m.database.GetNakamaLibraryDownload(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	if d.Status != StatusQueued && d.Status != StatusDownloading {
+		return nil
+	}
+
+	m.mu.Lock()
+	m.queue = slices.DeleteFunc(m.queue, func(i uint) bool { return i == id })
+	isCurrent := m.current == id
+	if isCurrent && m.cancel != nil {
+		m.cancel()
+	}
+	m.mu.Unlock()
+
+	// The worker updates the status of the current download once it stops
+	if isCurrent {
+		return nil
+	}
+
+	d.Status = StatusCancelled
+	_ = os.Remove(d.Path + partSuffix)
+	if err := m.database.SaveNakamaLibraryDownload(d); err != nil {
+		return err
+	}
+	m.sendProgress()
+	return nil
+}
+
+// Retry queues a failed or cancelled download again.
+// The bytes downloaded by the previous attempt are reused.
+func (m *Manager) Retry(id uint) error {
+	d, err := m.database.GetNakamaLibraryDownload(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	if d.Status != StatusFailed && d.Status != StatusCancelled {
+		return fmt.Errorf("library sync: Download is %s", d.Status)
+	}
+
+	d.Status = StatusQueued
+	d.Error = ""
+	if err := m.database.SaveNakamaLibraryDownload(d); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.queue = append(m.queue, id)
+	m.mu.Unlock()
+
+	m.sendProgress()
+	m.wake()
+	return nil
+}
+
+// Remove removes the download from the list, cancelling it if needed. The copied file is kept.
+func (m *Manager) Remove(id uint) error {
+	if err := m.Cancel(id); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	isCurrent := m.current == id
+	m.mu.Unlock()
+	if isCurrent {
+		return errors.New("library sync: Download is stopping")
+	}
+
+	if d, err := m.database.GetNakamaLibraryDownload(id); err == nil {
+		_ = os.Remove(d.Path + partSuffix)
+	}
+	if err := m.database.DeleteNakamaLibraryDownload(id); err != nil {
+		return err
+	}
+	m.sendProgress()
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (m *Manager) processQueue() {
+	defer util.HandlePanicInModuleThen("nakama/librarysync/processQueue", func() {})
+
+	for {
+		m.mu.Lock()
+		if len(m.queue) == 0 {
+			m.current = 0
+			m.mu.Unlock()
+			m.sendProgress()
+			return
+		}
+		id := m.queue[0]
+		m.queue = m.queue[1:]
+		m.current = id
+		ctx, cancel := context.WithCancel(context.Background())
+		m.cancel = cancel
+		m.progress[id] = &Progress{TotalBytes: -1}
+		m.mu.Unlock()
+
+		m.processJob(ctx, id)
+		cancel()
+
+		m.mu.Lock()
+		m.current = 0
+		m.cancel = nil
+		delete(m.progress, id)
+		m.mu.Unlock()
+		m.sendProgress()
+	}
+}
+
+func (m *Manager) processJob(ctx context.Context, id uint) {
+	d, err := m.database.GetNakamaLibraryDownload(id)
+	if err != nil || (d.Status != StatusQueued && d.Status != StatusDownloading) {
+		return
+	}
+
+	d.Status = StatusDownloading
+	d.Error = ""
+	_ = m.database.SaveNakamaLibraryDownload(d)
+	m.sendProgress()
+
+	m.logger.Info().Int("mediaId", d.MediaId).Str("path", d.Path).Msg("library sync: Copying file from host")
+
+	err = m.downloadFile(ctx, d.HostPath, d.Path, func(written int64, total int64) {
+		m.updateProgress(d.ID, func(p *Progress) {
+			p.DownloadedBytes = written
+			p.TotalBytes = total
+		})
+	})
+	if err == nil {
+		err = m.addLocalFile(d)
+	}
+
+	switch {
+	case err == nil:
+		d.Status = StatusCompleted
+		m.logger.Info().Int("mediaId", d.MediaId).Str("path", d.Path).Msg("library sync: File copied")
+		m.wsEventManager.SendEvent(events.SuccessToast, fmt.Sprintf("%s copied from host", filepath.Base(d.Path)))
+		m.wsEventManager.SendEvent(events.InvalidateQueries, []string{events.GetLocalFilesEndpoint, events.GetAnimeEntryEndpoint, events.GetLibraryCollectionEndpoint, events.GetMissingEpisodesEndpoint})
+	case ctx.Err() != nil:
+		d.Status = StatusCancelled
+		_ = os.Remove(d.Path + partSuffix)
+		m.logger.Debug().Int("mediaId", d.MediaId).Str("path", d.Path).Msg("library sync: Download cancelled")
+	default:
+		// The partial file is kept so that a retry resumes the download
+		d.Status = StatusFailed
+		d.Error = err.Error()
+		m.logger.Error().Err(err).Int("mediaId", d.MediaId).Str("path", d.Path).Msg("library sync: Failed to copy file")
+		m.wsEventManager.SendEvent(events.ErrorToast, fmt.Sprintf("Failed to copy %s: %v", filepath.Base(d.Path), err))
+	}
+
+	if err := m.database.SaveNakamaLibraryDownload(d); err != nil {
+		m.logger.Error().Err(err).Msg("library sync: Failed to save download")
+	}
+}
+
+// addLocalFile adds the host's local file to the local files, with the path of the copied file.
+// A local file with the same path is replaced.
+func (m *Manager) addLocalFile(d *models.NakamaLibraryDownload) error {
+	var lf *anime.LocalFile
+	if err := json.Unmarshal(d.LocalFile, &lf); err != nil || lf == nil {
+		return fmt.Errorf("invalid local file: %w", err)
+	}
+	lf.Path = d.Path
+	lf.Name = filepath.Base(d.Path)
+
+	m.localFilesMu.Lock()
+	defer m.localFilesMu.Unlock()
+
+	lfs, lfsId, err := db_bridge.GetLocalFiles(m.database)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// The library has never been scanned
+		if _, err := db_bridge.InsertLocalFiles(m.database, []*anime.LocalFile{lf}); err != nil {
+			return fmt.Errorf("failed to save local files: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get local files: %w", err)
+	}
+
+	lfs = slices.DeleteFunc(lfs, func(f *anime.LocalFile) bool {
+		return f.HasSamePath(lf.Path)
+	})
+	lfs = append(lfs, lf)
+
+	if _, err := db_bridge.SaveLocalFiles(m.database, lfsId, lfs); err != nil {
+		return fmt.Errorf("failed to save local files: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) updateProgress(id uint, f func(p *Progress)) {
+	m.mu.Lock()
+	p, ok := m.progress[id]
+	if ok {
+		f(p)
+	}
+	send := ok && time.Since(m.progressSentAt) > time.Second
+	if send {
+		m.progressSentAt = time.Now()
+	}
+	m.mu.Unlock()
+
+	if send {
+		m.sendProgress()
+	}
+}
+
+func (m *Manager) sendProgress() {
+	if m.wsEventManager == nil {
+		return
+	}
+	downloads, err := m.GetDownloads()
+	if err != nil {
+		return
+	}
+	m.wsEventManager.SendEvent(events.NakamaLibrarySyncProgress, downloads)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// getDestination returns the path of the file in the library.
+// The directories of the file relative to the host's library are kept so that the folder titles stay the same.
+func getDestination(directory string, lf *anime.LocalFile) (string, error) {
+	name := util.SanitizeFilename(lf.Name)
+	if name == "" {
+		return "", fmt.Errorf("invalid filename: %q", lf.Name)
+	}
+
+	parts := []string{directory}
+	for _, folder := range lf.ParsedFolderData {
+		if folder == nil {
+			continue
+		}
+		dirname := util.SanitizeFilename(folder.Original)
+		if dirname == "" {
+			continue
+		}
+		parts = append(parts, dirname)
+	}
+	parts = append(parts, name)
+
+	return filepath.Join(parts...), nil
+}
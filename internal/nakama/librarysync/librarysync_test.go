@@ -0,0 +1,198 @@
+package librarysync
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"seanime/internal/database/db"
+	"seanime/internal/database/db_bridge"
+	"seanime/internal/events"
+	"seanime/internal/library/anime"
+	"seanime/internal/nakama"
+	"seanime/internal/util"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samber/mo"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHost struct {
+	url string
+	lfs []*anime.LocalFile
+}
+
+func (h *fakeHost) GetHostAnimeLibraryFiles(ctx context.Context, mId ...int) ([]*anime.LocalFile, nakama.NakamaCustomSourceMap, bool) {
+	return h.lfs, nil, true
+}
+
+func (h *fakeHost) NewHostAnimeLibraryDownloadRequest(ctx context.Context, path string) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, h.url+"?path="+base64.URLEncoding.EncodeToString([]byte(path)), nil)
+}
+
+// newTestHost serves the files with Manager.ServeFile, failing the first request after failAfter bytes.
+// The Range header of the last request is stored in lastRange.
+func newTestHost(t *testing.T, m *Manager, failAfter int64, lastRange *atomic.Value) *httptest.Server {
+	var failed atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lastRange != nil {
+			lastRange.Store(r.Header.Get("Range"))
+		}
+		path, err := base64.URLEncoding.DecodeString(r.URL.Query().Get("path"))
+		require.NoError(t, err)
+
+		if failAfter > 0 && failed.CompareAndSwap(false, true) {
+			data, err := os.ReadFile(string(path))
+			require.NoError(t, err)
+			w.Header().Set("Content-Length", "999999")
+			_, _ = w.Write(data[:failAfter])
+			// Drop the connection
+			hj, ok := w.(http.Hijacker)
+			require.True(t, ok)
+			conn, _, _ := hj.Hijack()
+			_ = conn.Close()
+			return
+		}
+
+		if err := m.ServeFile(w, r, string(path)); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestGetDestination(t *testing.T) {
+	lf := &anime.LocalFile{
+		Path: "/host/Anime/Show/Season 1/Show - 01.mkv",
+		Name: "Show - 01.mkv",
+		ParsedFolderData: []*anime.LocalFileParsedData{
+			{Original: "Show"},
+			{Original: "Season 1"},
+		},
+	}
+	dest, err := getDestination("/library", lf)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join("/library", "Show", "Season 1", "Show - 01.mkv"), dest)
+
+	// Folder names can't escape the library
+	lf.ParsedFolderData = []*anime.LocalFileParsedData{{Original: ".."}, {Original: "../etc"}}
+	dest, err = getDestination("/library", lf)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join("/library", "etc", "Show - 01.mkv"), dest)
+
+	_, err = getDestination("/library", &anime.LocalFile{Name: ".."})
+	require.Error(t, err)
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	hostDir := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789"), 10_000)
+	hostPath := filepath.Join(hostDir, "Show - 01.mkv")
+	require.NoError(t, os.WriteFile(hostPath, content, 0644))
+
+	m := NewManager(&NewManagerOptions{Logger: util.NewLogger()})
+	var lastRange atomic.Value
+	ts := newTestHost(t, m, 30_000, &lastRange)
+	m.host = &fakeHost{url: ts.URL}
+
+	dest := filepath.Join(t.TempDir(), "Show", "Show - 01.mkv")
+	var lastWritten, lastTotal int64
+	err := m.downloadFile(context.Background(), hostPath, dest, func(written int64, total int64) {
+		lastWritten, lastTotal = written, total
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+	require.Equal(t, int64(len(content)), lastWritten)
+	require.Equal(t, int64(len(content)), lastTotal)
+	require.NoFileExists(t, dest+partSuffix)
+	require.Equal(t, "bytes=30000-", lastRange.Load())
+
+	// The destination isn't overwritten
+	require.Error(t, m.downloadFile(context.Background(), hostPath, dest, func(int64, int64) {}))
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	hostDir := t.TempDir()
+	content := bytes.Repeat([]byte("a"), 64*1024)
+	hostPath := filepath.Join(hostDir, "Show - 01.mkv")
+	require.NoError(t, os.WriteFile(hostPath, content, 0644))
+
+	m := NewManager(&NewManagerOptions{Logger: util.NewLogger()})
+	ts := newTestHost(t, m, 0, nil)
+	m.host = &fakeHost{url: ts.URL}
+
+	// 32 KiB/s with a burst of one second, 64 KiB take at least one second
+	m.SetBandwidthLimits(32, 0)
+
+	start := time.Now()
+	err := m.downloadFile(context.Background(), hostPath, filepath.Join(t.TempDir(), "Show - 01.mkv"), func(int64, int64) {})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
+
+func TestEnqueue(t *testing.T) {
+	logger := util.NewLogger()
+	database, err := db.NewDatabase(t.TempDir(), "test", logger)
+	require.NoError(t, err)
+	db_bridge.CurrLocalFiles = mo.None[[]*anime.LocalFile]()
+	t.Cleanup(func() { db_bridge.CurrLocalFiles = mo.None[[]*anime.LocalFile]() })
+
+	hostDir := t.TempDir()
+	hostPath := filepath.Join(hostDir, "Show", "Show - 01.mkv")
+	require.NoError(t, os.MkdirAll(filepath.Dir(hostPath), 0755))
+	require.NoError(t, os.WriteFile(hostPath, []byte("episode"), 0644))
+
+	hostLf := &anime.LocalFile{
+		Path:             hostPath,
+		Name:             "Show - 01.mkv",
+		ParsedData:       &anime.LocalFileParsedData{Original: "Show - 01.mkv", Title: "Show", Episode: "01"},
+		ParsedFolderData: []*anime.LocalFileParsedData{{Original: "Show", Title: "Show"}},
+		Metadata:         &anime.LocalFileMetadata{Episode: 1, AniDBEpisode: "1", Type: anime.LocalFileTypeMain},
+		Locked:           true,
+		MediaId:          21,
+	}
+	otherLf := &anime.LocalFile{Path: filepath.Join(hostDir, "Other - 01.mkv"), Name: "Other - 01.mkv", MediaId: 22}
+
+	m := NewManager(&NewManagerOptions{
+		Logger:         logger,
+		Database:       database,
+		WSEventManager: events.NewMockWSEventManager(logger),
+	})
+	ts := newTestHost(t, m, 0, nil)
+	m.host = &fakeHost{url: ts.URL, lfs: []*anime.LocalFile{hostLf, otherLf}}
+	m.Start()
+
+	libraryDir := t.TempDir()
+	downloads, err := m.Enqueue(context.Background(), &EnqueueOptions{MediaId: 21, Directory: libraryDir})
+	require.NoError(t, err)
+	require.Len(t, downloads, 1)
+	require.Equal(t, filepath.Join(libraryDir, "Show", "Show - 01.mkv"), downloads[0].Path)
+	require.Equal(t, 1, downloads[0].Episode)
+
+	// Already queued
+	downloads, err = m.Enqueue(context.Background(), &EnqueueOptions{MediaId: 21, Directory: libraryDir})
+	require.NoError(t, err)
+	require.Len(t, downloads, 0)
+
+	require.Eventually(t, func() bool {
+		d, err := database.GetNakamaLibraryDownload(1)
+		return err == nil && d.Status == StatusCompleted
+	}, 5*time.Second, 20*time.Millisecond)
+
+	lfs, _, err := db_bridge.GetLocalFiles(database)
+	require.NoError(t, err)
+	require.Len(t, lfs, 1)
+	require.Equal(t, filepath.Join(libraryDir, "Show", "Show - 01.mkv"), lfs[0].Path)
+	require.Equal(t, 21, lfs[0].MediaId)
+	require.Equal(t, "1", lfs[0].Metadata.AniDBEpisode)
+	require.True(t, lfs[0].Locked)
+}
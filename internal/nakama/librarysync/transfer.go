@@ -0,0 +1,266 @@
+package librarysync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	partSuffix  = ".part"
+	maxAttempts = 3
+)
+
+var errNotRetryable = errors.New("not retryable")
+
+// downloadFile downloads the host's file to dest, resuming from the partial file if it exists.
+// Interrupted transfers are resumed up to maxAttempts times.
+func (m *Manager) downloadFile(ctx context.Context, hostPath string, dest string, onProgress func(written int64, total int64)) (err error) {
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = m.downloadFileOnce(ctx, hostPath, dest, onProgress)
+		if err == nil || errors.Is(err, errNotRetryable) || ctx.Err() != nil {
+			break
+		}
+		m.logger.Debug().Err(err).Str("path", hostPath).Int("attempt", attempt).Msg("library sync: Transfer interrupted")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(dest+partSuffix, dest)
+}
+
+func (m *Manager) downloadFileOnce(ctx context.Context, hostPath string, dest string, onProgress func(written int64, total int64)) error {
+	partPath := dest + partSuffix
+
+	var offset int64
+	if fi, err := os.Stat(partPath); err == nil {
+		offset = fi.Size()
+	}
+
+	req, err := m.host.NewHostAnimeLibraryDownloadRequest(ctx, hostPath)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNotRetryable, err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The host sent the whole file
+		offset = 0
+	case http.StatusPartialContent:
+		if start := parseContentRangeStart(resp.Header.Get("Content-Range")); start != offset {
+			return fmt.Errorf("%w: unexpected range start %d, expected %d", errNotRetryable, start, offset)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is already complete
+		if size := parseContentRangeSize(resp.Header.Get("Content-Range")); size >= 0 && size == offset {
+			onProgress(offset, offset)
+			return nil
+		}
+		_ = os.Remove(partPath)
+		return errors.New("partial file is larger than the host's file")
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err = fmt.Errorf("host responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		if resp.StatusCode < 500 {
+			err = fmt.Errorf("%w: %w", errNotRetryable, err)
+		}
+		return err
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	if offset > 0 {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNotRetryable, err)
+	}
+	defer f.Close()
+
+	written := offset
+	onProgress(written, total)
+
+	reader := &throttledReader{ctx: ctx, r: resp.Body, limiter: m.downloadLimiter}
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := reader.Read(buf)
+		if n > 0 {
+			if _, err := f.Write(buf[:n]); err != nil {
+				return fmt.Errorf("%w: %w", errNotRetryable, err)
+			}
+			written += int64(n)
+			onProgress(written, total)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	if total >= 0 && written != total {
+		return io.ErrUnexpectedEOF
+	}
+	return f.Close()
+}
+
+// ServeFile serves a file of the library to a peer, with support for range requests.
+// The upload bandwidth limit is shared by all the peers.
+func (m *Manager) ServeFile(w http.ResponseWriter, r *http.Request, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return errors.New("not a file")
+	}
+
+	tw := &throttledResponseWriter{ResponseWriter: w, ctx: r.Context(), limiter: m.uploadLimiter}
+	http.ServeContent(tw, r, fi.Name(), fi.ModTime(), f)
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// setLimit sets the rate of the limiter in KiB/s, 0 means no limit.
+// The burst is one second of transfer so that the rate is smooth.
+func setLimit(limiter *rate.Limiter, kib int) {
+	if kib <= 0 {
+		limiter.SetLimit(rate.Inf)
+		return
+	}
+	limiter.SetBurst(kib * 1024)
+	limiter.SetLimit(rate.Limit(kib * 1024))
+}
+
+// waitN waits until n bytes can be transferred, in chunks no larger than the burst.
+func waitN(ctx context.Context, limiter *rate.Limiter, n int) error {
+	if limiter.Limit() == rate.Inf {
+		return nil
+	}
+	for n > 0 {
+		chunk := min(n, max(limiter.Burst(), 1))
+		if err := limiter.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if waitErr := waitN(t.ctx, t.limiter, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func (t *throttledResponseWriter) Write(p []byte) (int, error) {
+	if t.limiter.Limit() == rate.Inf {
+		return t.ResponseWriter.Write(p)
+	}
+
+	written := 0
+	for written < len(p) {
+		chunk := min(len(p)-written, max(t.limiter.Burst(), 1))
+		if err := t.limiter.WaitN(t.ctx, chunk); err != nil {
+			return written, err
+		}
+		n, err := t.ResponseWriter.Write(p[written : written+chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// parseContentRangeStart returns the start of a "bytes <start>-<end>/<size>" header, or -1.
+func parseContentRangeStart(header string) int64 {
+	rng, _, ok := strings.Cut(strings.TrimPrefix(header, "bytes "), "/")
+	if !ok {
+		return -1
+	}
+	start, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return -1
+	}
+	ret, err := strconv.ParseInt(strings.TrimSpace(start), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return ret
+}
+
+// parseContentRangeSize returns the size of a "bytes <range>/<size>" header, or -1.
+func parseContentRangeSize(header string) int64 {
+	_, size, ok := strings.Cut(header, "/")
+	if !ok {
+		return -1
+	}
+	ret, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return ret
+}
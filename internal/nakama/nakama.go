@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"seanime/internal/database/db"
 	"seanime/internal/database/models"
 	debrid_client "seanime/internal/debrid/client"
 	"seanime/internal/directstream"
@@ -38,6 +39,7 @@ type Manager struct {
 	serverPort              int
 	username                string
 	logger                  *zerolog.Logger
+	database                *db.Database
 	settings                *models.NakamaSettings
 	wsEventManager          events.WSEventManagerInterface
 	platformRef             *util.Ref[platform.Platform]
@@ -91,6 +93,7 @@ type Manager struct {
 
 type NewManagerOptions struct {
 	Logger                  *zerolog.Logger
+	Database                *db.Database
 	WSEventManager          events.WSEventManagerInterface
 	PlaybackManager         *playbackmanager.PlaybackManager
 	TorrentstreamRepository *torrentstream.Repository
@@ -227,6 +230,7 @@ func NewManager(opts *NewManagerOptions) *Manager {
 	m := &Manager{
 		username:                "",
 		logger:                  opts.Logger,
+		database:                opts.Database,
 		wsEventManager:          opts.WSEventManager,
 		playbackManager:         opts.PlaybackManager,
 		peerConnections:         result.NewMap[string, *PeerConnection](),
@@ -357,14 +361,15 @@ func (m *Manager) SetSettings(settings *models.NakamaSettings) {
 		}
 	}
 
-	if previousSettings == nil || previousSettings.IsHost != settings.IsHost || previousSettings.RemoteServerURL != settings.RemoteServerURL || previousSettings.RemoteServerPassword != settings.RemoteServerPassword || previousSettings.Enabled != settings.Enabled {
+	if previousSettings == nil || previousSettings.IsHost != settings.IsHost || previousSettings.RemoteServerURL != settings.RemoteServerURL || previousSettings.RemoteServerPassword != settings.RemoteServerPassword || previousSettings.Enabled != settings.Enabled || previousSettings.RoomsRelayURL != settings.RoomsRelayURL {
 		// Determine if we should disconnect from current host
 		shouldDisconnect := m.IsConnectedToHost() && (!settings.Enabled || // Nakama disabled
 			settings.IsHost || // Switching to host mode
 			settings.RemoteServerURL == "" || // No remote URL
 			settings.RemoteServerPassword == "" || // No password
 			(previousSettings != nil && previousSettings.RemoteServerURL != settings.RemoteServerURL) || // URL changed
-			(previousSettings != nil && previousSettings.RemoteServerPassword != settings.RemoteServerPassword)) || // Password changed
+			(previousSettings != nil && previousSettings.RemoteServerPassword != settings.RemoteServerPassword) || // Password changed
+			(previousSettings != nil && previousSettings.RoomsRelayURL != settings.RoomsRelayURL)) || // Relay changed
 			(previousSettings != nil && previousSettings.IsHost != settings.IsHost && settings.IsHost)
 
 		// Determine if we should connect to a host
@@ -427,6 +432,11 @@ func (m *Manager) GetWatchPartyManager() *WatchPartyManager {
 func (m *Manager) Cleanup() {
 	m.logger.Debug().Msg("nakama: Cleaning up")
 
+	// Save the watch party session in progress
+	if m.watchPartyManager != nil {
+		m.watchPartyManager.saveHistory(m.watchPartyManager.getHistoryRecorder())
+	}
+
 	if m.cancel != nil {
 		m.cancel()
 	}
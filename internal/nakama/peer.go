@@ -346,7 +346,7 @@ func (m *Manager) attemptRoomConnection(connCtx context.Context) error {
 
 	roomId := strings.TrimPrefix(m.settings.RemoteServerURL, "room://")
 
-	u, err := url.Parse(fmt.Sprintf("%s/%s/peer", constants.SeanimeRoomsApiWsUrl, roomId))
+	u, err := url.Parse(fmt.Sprintf("%s/%s/peer", m.getRoomsApiWsUrl(), roomId))
 	if err != nil {
 		return err
 	}
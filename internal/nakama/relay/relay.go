@@ -0,0 +1,792 @@
+package relay
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"seanime/internal/constants"
+	"seanime/internal/util"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+)
+
+// DEVNOTE: The relay speaks the same protocol as the Seanime Rooms API used by nakama.Manager.
+//   - GET  /health                 -> {"status":"healthy","version":"<rooms version>"}
+//   - POST /                       -> creates a room, {"password","version"} -> {"roomId","hostWsUrl","peerJoinUrl","createdAt","expiresAt"}
+//   - WS   /{roomId}/host          -> ?password=&version=, messages from the host are broadcast to the peers
+//   - WS   /{roomId}/peer          -> ?password=&peerId=&name=&version=, messages from a peer are forwarded to the host
+//   - GET  /{roomId}/stream        -> ?path=<host endpoint>, streams an endpoint of the host to a peer (see below)
+//   - POST /{roomId}/stream/{id}   -> the host's response to a stream request, the body is copied to the peer
+// Streams are relayed so that peers can play the host's library files and streams when the host isn't reachable.
+// The relay sends a MessageTypeStreamRequest message to the host, which requests the endpoint from its own server and posts the response back.
+// Both requests are authenticated with the room password (RoomPasswordHeader), the Nakama token of the peer is forwarded to the host.
+// Room creation is limited per IP and in total, and can require a password (sent as the Basic auth password, e.g. https://:<password>@relay.example.com/api/rooms).
+
+const (
+	DefaultRoomTTL  = 24 * time.Hour
+	DefaultMaxRooms = 100
+
+	// roomCreationLimit is the number of rooms an IP can create per roomCreationWindow
+	roomCreationLimit  = 10
+	roomCreationWindow = time.Hour
+
+	// hostGracePeriod is the time a room is kept without its host, so that the host can reconnect
+	hostGracePeriod = 10 * time.Minute
+	maxPeersPerRoom = 32
+	maxMessageSize  = 1 << 20
+	sendBufferSize  = 256
+	pingInterval    = 30 * time.Second
+	pongTimeout     = 90 * time.Second
+	writeTimeout    = 10 * time.Second
+
+	// maxStreamsPerRoom is the number of streams that can be relayed at the same time in a room
+	maxStreamsPerRoom = 16
+	// streamResponseTimeout is the time the host has to respond to a stream request
+	streamResponseTimeout = 30 * time.Second
+)
+
+const (
+	// MessageTypeStreamRequest is the type of the message sent to the host when a peer requests a stream
+	MessageTypeStreamRequest = "relay_stream_request"
+	// RoomPasswordHeader holds the room password in stream requests and responses
+	RoomPasswordHeader = "X-Seanime-Room-Password"
+	// StreamResponseHeader holds the status and headers of the host's response to a stream request, as JSON
+	StreamResponseHeader = "X-Seanime-Stream-Response"
+)
+
+// streamEndpoints are the endpoints of the host that can be requested through a room
+var streamEndpoints = map[string]struct{}{
+	"/api/v1/nakama/host/anime/library/shared": {},
+	"/api/v1/nakama/host/anime/library/stream": {},
+	"/api/v1/nakama/host/torrentstream/stream": {},
+	"/api/v1/nakama/host/debridstream/stream":  {},
+	"/api/v1/nakama/host/debridstream/url":     {},
+}
+
+// streamRequestHeaders are the headers of the peer forwarded to the host
+var streamRequestHeaders = []string{"Range", "If-Range", "Accept", "User-Agent", "X-Seanime-Nakama-Token"}
+
+// streamResponseHeaders are the headers of the host's response forwarded to the peer
+var streamResponseHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Content-Disposition", "Last-Modified", "Etag"}
+
+var (
+	ErrRoomNotFound     = errors.New("room not found")
+	ErrWrongPassword    = errors.New("wrong password")
+	ErrRoomFull         = errors.New("room is full")
+	ErrTooManyRooms     = errors.New("too many rooms")
+	ErrRateLimited      = errors.New("too many rooms created, try again later")
+	ErrHostNotConnected = errors.New("host not connected")
+	ErrTooManyStreams   = errors.New("too many streams")
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true // Clients are Seanime servers, not browsers
+	},
+}
+
+type (
+	// Server is a self-hostable Nakama rooms relay.
+	Server struct {
+		logger    *zerolog.Logger
+		publicUrl string
+		roomTTL   time.Duration
+		maxRooms  int
+		// passwordHash is the hash of the password required to create rooms, nil if not required
+		passwordHash []byte
+
+		mu    sync.Mutex
+		rooms map[string]*room
+		// creations holds the times at which each IP created rooms in the last roomCreationWindow
+		creations map[string][]time.Time
+	}
+
+	NewServerOptions struct {
+		Logger *zerolog.Logger
+		// PublicURL is the URL at which clients reach the relay (e.g. https://relay.example.com/api/rooms).
+		// If empty, it's derived from the requests.
+		PublicURL string
+		// RoomTTL is the lifetime of a room, defaults to DefaultRoomTTL
+		RoomTTL time.Duration
+		// MaxRooms is the maximum number of open rooms, defaults to DefaultMaxRooms
+		MaxRooms int
+		// Password is required to create rooms if set
+		Password string
+	}
+
+	room struct {
+		id           string
+		passwordHash [32]byte
+		version      string
+		createdAt    time.Time
+		expiresAt    time.Time
+
+		mu   sync.Mutex
+		host *client
+		// hostLeftAt is the time the host disconnected, zero if the host is connected
+		hostLeftAt time.Time
+		peers      map[string]*client
+		// streams holds the stream requests waiting for, or being served by, the host
+		streams map[string]*streamRequest
+	}
+
+	// streamRequest is a stream request of a peer, it's closed once the peer is done
+	streamRequest struct {
+		response chan *streamResponse
+		closed   chan struct{}
+	}
+
+	streamResponse struct {
+		StreamResponse
+		body io.Reader
+	}
+
+	// StreamRequest is the payload of a MessageTypeStreamRequest message.
+	StreamRequest struct {
+		RequestID string      `json:"requestId"`
+		Method    string      `json:"method"`
+		Endpoint  string      `json:"endpoint"`
+		Header    http.Header `json:"header"`
+	}
+
+	// StreamResponse is sent by the host in the StreamResponseHeader.
+	StreamResponse struct {
+		Status int         `json:"status"`
+		Header http.Header `json:"header"`
+	}
+
+	client struct {
+		name string
+		conn *websocket.Conn
+		send chan []byte
+		once sync.Once
+		done chan struct{}
+	}
+
+	createRoomRequest struct {
+		Password string `json:"password"`
+		Version  string `json:"version"`
+	}
+
+	createRoomResponse struct {
+		RoomID      string    `json:"roomId"`
+		HostWsUrl   string    `json:"hostWsUrl"`
+		PeerJoinUrl string    `json:"peerJoinUrl"`
+		CreatedAt   time.Time `json:"createdAt"`
+		ExpiresAt   time.Time `json:"expiresAt"`
+	}
+)
+
+func NewServer(opts *NewServerOptions) *Server {
+	ttl := opts.RoomTTL
+	if ttl <= 0 {
+		ttl = DefaultRoomTTL
+	}
+	maxRooms := opts.MaxRooms
+	if maxRooms <= 0 {
+		maxRooms = DefaultMaxRooms
+	}
+	ret := &Server{
+		logger:    opts.Logger,
+		publicUrl: strings.TrimSuffix(opts.PublicURL, "/"),
+		roomTTL:   ttl,
+		maxRooms:  maxRooms,
+		rooms:     make(map[string]*room),
+		creations: make(map[string][]time.Time),
+	}
+	if opts.Password != "" {
+		hash := sha256.Sum256([]byte(opts.Password))
+		ret.passwordHash = hash[:]
+	}
+	return ret
+}
+
+// Start removes the expired rooms periodically.
+func (s *Server) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.removeExpiredRooms(time.Now())
+		}
+	}()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+
+	switch {
+	case path == "health" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{
+			"status":  "healthy",
+			"version": constants.SeanimeRoomsVersion,
+		})
+	case path == "" && r.Method == http.MethodPost:
+		s.handleCreateRoom(w, r)
+	case strings.HasSuffix(path, "/host") && r.Method == http.MethodGet:
+		s.handleHost(w, r, strings.TrimSuffix(path, "/host"))
+	case strings.HasSuffix(path, "/peer") && r.Method == http.MethodGet:
+		s.handlePeer(w, r, strings.TrimSuffix(path, "/peer"))
+	case strings.HasSuffix(path, "/stream") && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		s.handleStream(w, r, strings.TrimSuffix(path, "/stream"))
+	case strings.Contains(path, "/stream/") && r.Method == http.MethodPost:
+		roomId, requestId, _ := strings.Cut(path, "/stream/")
+		s.handleStreamResponse(w, r, roomId, requestId)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (s *Server) handleCreateRoom(w http.ResponseWriter, r *http.Request) {
+	if !s.isAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Nakama relay"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body createRoomRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if body.Password == "" {
+		http.Error(w, "password required", http.StatusBadRequest)
+		return
+	}
+
+	rm, err := s.createRoom(getRemoteIP(r), body.Password, body.Version, time.Now())
+	if err != nil {
+		writeRoomError(w, err)
+		return
+	}
+
+	baseUrl := s.getBaseUrl(r)
+	hostWsUrl, _ := url.JoinPath(toWsUrl(baseUrl), rm.id, "host")
+
+	s.logger.Info().Str("roomId", rm.id).Msg("nakama relay: Room created")
+
+	writeJSON(w, http.StatusOK, &createRoomResponse{
+		RoomID:      rm.id,
+		HostWsUrl:   hostWsUrl,
+		PeerJoinUrl: "room://" + rm.id,
+		CreatedAt:   rm.createdAt,
+		ExpiresAt:   rm.expiresAt,
+	})
+}
+
+// isAuthorized checks the relay password, if one is set.
+func (s *Server) isAuthorized(r *http.Request) bool {
+	if s.passwordHash == nil {
+		return true
+	}
+	_, password, _ := r.BasicAuth()
+	hash := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(hash[:], s.passwordHash) == 1
+}
+
+func (s *Server) createRoom(ip string, password string, version string, now time.Time) (*room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.rooms) >= s.maxRooms {
+		return nil, ErrTooManyRooms
+	}
+
+	creations := pruneCreations(s.creations[ip], now)
+	if len(creations) >= roomCreationLimit {
+		s.creations[ip] = creations
+		return nil, ErrRateLimited
+	}
+	s.creations[ip] = append(creations, now)
+
+	id := util.RandomStringWithAlphabet(12, "abcdefghijkmnpqrstuvwxyz23456789")
+	for s.rooms[id] != nil {
+		id = util.RandomStringWithAlphabet(12, "abcdefghijkmnpqrstuvwxyz23456789")
+	}
+
+	rm := &room{
+		id:           id,
+		passwordHash: sha256.Sum256([]byte(password)),
+		version:      version,
+		createdAt:    now,
+		expiresAt:    now.Add(s.roomTTL),
+		hostLeftAt:   now,
+		peers:        make(map[string]*client),
+		streams:      make(map[string]*streamRequest),
+	}
+	s.rooms[id] = rm
+	return rm, nil
+}
+
+// getRoom returns the room if the password is correct.
+func (s *Server) getRoom(id string, password string) (*room, error) {
+	s.mu.Lock()
+	rm, ok := s.rooms[id]
+	s.mu.Unlock()
+	if !ok || time.Now().After(rm.expiresAt) {
+		return nil, ErrRoomNotFound
+	}
+
+	hash := sha256.Sum256([]byte(password))
+	if subtle.ConstantTimeCompare(hash[:], rm.passwordHash[:]) != 1 {
+		return nil, ErrWrongPassword
+	}
+	return rm, nil
+}
+
+func (s *Server) handleHost(w http.ResponseWriter, r *http.Request, roomId string) {
+	q := r.URL.Query()
+	rm, err := s.getRoom(roomId, q.Get("password"))
+	if err != nil {
+		writeRoomError(w, err)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	c := newClient(conn, "host")
+
+	rm.mu.Lock()
+	previous := rm.host
+	rm.host = c
+	rm.hostLeftAt = time.Time{}
+	rm.mu.Unlock()
+	if previous != nil {
+		previous.close()
+	}
+
+	s.logger.Info().Str("roomId", rm.id).Msg("nakama relay: Host connected")
+
+	go c.writePump()
+	c.readPump(func(data []byte) {
+		rm.broadcast(data)
+	})
+
+	rm.mu.Lock()
+	if rm.host == c {
+		rm.host = nil
+		rm.hostLeftAt = time.Now()
+	}
+	rm.mu.Unlock()
+
+	s.logger.Info().Str("roomId", rm.id).Msg("nakama relay: Host disconnected")
+}
+
+func (s *Server) handlePeer(w http.ResponseWriter, r *http.Request, roomId string) {
+	q := r.URL.Query()
+	rm, err := s.getRoom(roomId, q.Get("password"))
+	if err != nil {
+		writeRoomError(w, err)
+		return
+	}
+
+	peerId := q.Get("peerId")
+	if peerId == "" {
+		http.Error(w, "missing peer ID", http.StatusBadRequest)
+		return
+	}
+	if rm.version != "" && q.Get("version") != rm.version {
+		http.Error(w, "version mismatch, the host is using "+rm.version, http.StatusBadRequest)
+		return
+	}
+
+	rm.mu.Lock()
+	_, reconnecting := rm.peers[peerId]
+	full := !reconnecting && len(rm.peers) >= maxPeersPerRoom
+	rm.mu.Unlock()
+	if full {
+		writeRoomError(w, ErrRoomFull)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	c := newClient(conn, q.Get("name"))
+
+	rm.mu.Lock()
+	previous := rm.peers[peerId]
+	rm.peers[peerId] = c
+	rm.mu.Unlock()
+	if previous != nil {
+		previous.close()
+	}
+
+	s.logger.Debug().Str("roomId", rm.id).Str("peerId", peerId).Str("name", c.name).Msg("nakama relay: Peer connected")
+
+	go c.writePump()
+	c.readPump(func(data []byte) {
+		rm.sendToHost(data)
+	})
+
+	rm.mu.Lock()
+	if rm.peers[peerId] == c {
+		delete(rm.peers, peerId)
+	}
+	rm.mu.Unlock()
+
+	s.logger.Debug().Str("roomId", rm.id).Str("peerId", peerId).Msg("nakama relay: Peer disconnected")
+}
+
+// handleStream relays a request of a peer to the host and streams the response back.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request, roomId string) {
+	rm, err := s.getRoom(roomId, r.Header.Get(RoomPasswordHeader))
+	if err != nil {
+		writeRoomError(w, err)
+		return
+	}
+
+	endpoint := r.URL.Query().Get("path")
+	if !IsStreamEndpoint(endpoint) {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	requestId := util.RandomStringWithAlphabet(16, "abcdefghijkmnpqrstuvwxyz23456789")
+	sr := &streamRequest{
+		response: make(chan *streamResponse),
+		closed:   make(chan struct{}),
+	}
+
+	rm.mu.Lock()
+	host := rm.host
+	full := len(rm.streams) >= maxStreamsPerRoom
+	if host != nil && !full {
+		rm.streams[requestId] = sr
+	}
+	rm.mu.Unlock()
+	if host == nil {
+		writeRoomError(w, ErrHostNotConnected)
+		return
+	}
+	if full {
+		writeRoomError(w, ErrTooManyStreams)
+		return
+	}
+	defer func() {
+		rm.mu.Lock()
+		delete(rm.streams, requestId)
+		rm.mu.Unlock()
+		close(sr.closed)
+	}()
+
+	header := make(http.Header)
+	for _, key := range streamRequestHeaders {
+		if values := r.Header.Values(key); len(values) > 0 {
+			header[key] = values
+		}
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"type": MessageTypeStreamRequest,
+		"payload": &StreamRequest{
+			RequestID: requestId,
+			Method:    r.Method,
+			Endpoint:  endpoint,
+			Header:    header,
+		},
+		"timestamp": time.Now(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	host.queue(data)
+
+	var resp *streamResponse
+	timer := time.NewTimer(streamResponseTimeout)
+	defer timer.Stop()
+	select {
+	case resp = <-sr.response:
+	case <-timer.C:
+		http.Error(w, "the host didn't respond", http.StatusGatewayTimeout)
+		return
+	case <-r.Context().Done():
+		return
+	}
+
+	for _, key := range streamResponseHeaders {
+		if values := resp.Header.Values(key); len(values) > 0 {
+			w.Header()[key] = values
+		}
+	}
+	w.WriteHeader(resp.Status)
+	if r.Method != http.MethodHead {
+		_, _ = io.Copy(w, resp.body)
+	}
+}
+
+// handleStreamResponse hands the host's response to the peer that requested it.
+// It returns once the peer is done, since the body is read by the peer's handler.
+func (s *Server) handleStreamResponse(w http.ResponseWriter, r *http.Request, roomId string, requestId string) {
+	rm, err := s.getRoom(roomId, r.Header.Get(RoomPasswordHeader))
+	if err != nil {
+		writeRoomError(w, err)
+		return
+	}
+
+	var resp StreamResponse
+	if err := json.Unmarshal([]byte(r.Header.Get(StreamResponseHeader)), &resp); err != nil || resp.Status < 100 || resp.Status > 999 {
+		http.Error(w, "invalid response", http.StatusBadRequest)
+		return
+	}
+
+	rm.mu.Lock()
+	sr, ok := rm.streams[requestId]
+	rm.mu.Unlock()
+	if !ok {
+		http.Error(w, "stream request not found", http.StatusNotFound)
+		return
+	}
+
+	select {
+	case sr.response <- &streamResponse{StreamResponse: resp, body: r.Body}:
+	case <-sr.closed:
+		http.Error(w, "stream request not found", http.StatusNotFound)
+		return
+	case <-r.Context().Done():
+		return
+	}
+
+	select {
+	case <-sr.closed:
+	case <-r.Context().Done():
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeExpiredRooms closes the rooms that expired or whose host didn't come back.
+func (s *Server) removeExpiredRooms(now time.Time) {
+	s.mu.Lock()
+	expired := make([]*room, 0)
+	for id, rm := range s.rooms {
+		rm.mu.Lock()
+		hostGone := rm.host == nil && now.Sub(rm.hostLeftAt) > hostGracePeriod
+		rm.mu.Unlock()
+		if now.After(rm.expiresAt) || hostGone {
+			delete(s.rooms, id)
+			expired = append(expired, rm)
+		}
+	}
+	for ip, creations := range s.creations {
+		if creations = pruneCreations(creations, now); len(creations) == 0 {
+			delete(s.creations, ip)
+		} else {
+			s.creations[ip] = creations
+		}
+	}
+	s.mu.Unlock()
+
+	for _, rm := range expired {
+		s.logger.Info().Str("roomId", rm.id).Msg("nakama relay: Room closed")
+		rm.close()
+	}
+}
+
+// RoomCount returns the number of open rooms.
+func (s *Server) RoomCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.rooms)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (rm *room) broadcast(data []byte) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	for _, p := range rm.peers {
+		p.queue(data)
+	}
+}
+
+func (rm *room) sendToHost(data []byte) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	// Messages sent while the host is reconnecting are dropped, like in direct mode
+	if rm.host != nil {
+		rm.host.queue(data)
+	}
+}
+
+func (rm *room) close() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.host != nil {
+		rm.host.close()
+	}
+	for _, p := range rm.peers {
+		p.close()
+	}
+}
+
+func newClient(conn *websocket.Conn, name string) *client {
+	conn.SetReadLimit(maxMessageSize)
+	return &client{
+		name: name,
+		conn: conn,
+		send: make(chan []byte, sendBufferSize),
+		done: make(chan struct{}),
+	}
+}
+
+// queue sends the message to the client, a client that doesn't keep up is disconnected.
+func (c *client) queue(data []byte) {
+	select {
+	case c.send <- data:
+	case <-c.done:
+	default:
+		c.close()
+	}
+}
+
+func (c *client) close() {
+	c.once.Do(func() {
+		close(c.done)
+		_ = c.conn.Close()
+	})
+}
+
+// readPump reads the messages of the client until the connection is closed.
+func (c *client) readPump(onMessage func(data []byte)) {
+	defer c.close()
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+	// Clients ping the relay with ping frames
+	c.conn.SetPingHandler(func(appData string) error {
+		_ = c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+		err := c.conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(writeTimeout))
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return nil
+		}
+		return err
+	})
+
+	for {
+		msgType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if msgType != websocket.TextMessage || !json.Valid(data) {
+			continue
+		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+		onMessage(data)
+	}
+}
+
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	defer c.close()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case data := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// getBaseUrl returns the URL at which clients reach the relay.
+func (s *Server) getBaseUrl(r *http.Request) string {
+	if s.publicUrl != "" {
+		return s.publicUrl
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	// Path of the create room request, i.e. the mount point of the relay
+	path, _, _ := strings.Cut(r.RequestURI, "?")
+	return scheme + "://" + r.Host + strings.TrimSuffix(path, "/")
+}
+
+// getRemoteIP returns the IP of the client.
+// Forwarding headers are ignored since they can be set by anyone, so clients behind the same proxy share the creation limit.
+func getRemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// pruneCreations removes the creation times older than roomCreationWindow.
+func pruneCreations(creations []time.Time, now time.Time) []time.Time {
+	ret := creations[:0]
+	for _, t := range creations {
+		if now.Sub(t) < roomCreationWindow {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// IsStreamEndpoint returns true if the endpoint of the host can be requested through a room.
+func IsStreamEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.IsAbs() || u.Host != "" {
+		return false
+	}
+	_, ok := streamEndpoints[u.Path]
+	return ok
+}
+
+func toWsUrl(u string) string {
+	switch {
+	case strings.HasPrefix(u, "https://"):
+		return "wss://" + strings.TrimPrefix(u, "https://")
+	case strings.HasPrefix(u, "http://"):
+		return "ws://" + strings.TrimPrefix(u, "http://")
+	}
+	return u
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeRoomError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrRoomNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrWrongPassword):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, ErrRateLimited), errors.Is(err, ErrTooManyStreams):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	}
+}
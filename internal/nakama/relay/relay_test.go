@@ -0,0 +1,291 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"seanime/internal/util"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRelay(t *testing.T) (*Server, *httptest.Server) {
+	s := NewServer(&NewServerOptions{Logger: util.NewLogger()})
+	mux := http.NewServeMux()
+	mux.Handle("/api/rooms/", http.StripPrefix("/api/rooms", s))
+	mux.Handle("/api/rooms", http.StripPrefix("/api/rooms", s))
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func createTestRoom(t *testing.T, baseUrl string, password string) *createRoomResponse {
+	body, _ := json.Marshal(createRoomRequest{Password: password, Version: "3.5.0"})
+	resp, err := http.Post(baseUrl, "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var ret createRoomResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&ret))
+	return &ret
+}
+
+func dialPeer(baseUrl string, roomId string, password string, peerId string, version string) (*websocket.Conn, *http.Response, error) {
+	u, _ := url.Parse(strings.Replace(baseUrl, "http://", "ws://", 1) + "/api/rooms/" + roomId + "/peer")
+	q := u.Query()
+	q.Set("password", password)
+	q.Set("peerId", peerId)
+	q.Set("name", "Peer_"+peerId)
+	q.Set("version", version)
+	u.RawQuery = q.Encode()
+	return websocket.DefaultDialer.Dial(u.String(), nil)
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var ret map[string]interface{}
+	require.NoError(t, conn.ReadJSON(&ret))
+	return ret
+}
+
+func TestRelay(t *testing.T) {
+	s, ts := newTestRelay(t)
+
+	resp, err := http.Get(ts.URL + "/api/rooms/health")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	room := createTestRoom(t, ts.URL+"/api/rooms", "secret")
+	require.Equal(t, "room://"+room.RoomID, room.PeerJoinUrl)
+	require.True(t, strings.HasPrefix(room.HostWsUrl, "ws://"))
+	require.True(t, strings.HasSuffix(room.HostWsUrl, "/api/rooms/"+room.RoomID+"/host"))
+	require.Equal(t, 1, s.RoomCount())
+
+	host, _, err := websocket.DefaultDialer.Dial(room.HostWsUrl+"?password=secret&version=3.5.0", nil)
+	require.NoError(t, err)
+	defer host.Close()
+
+	_, resp, err = dialPeer(ts.URL, room.RoomID, "wrong", "peer-1", "3.5.0")
+	require.Error(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, resp, err = dialPeer(ts.URL, room.RoomID, "secret", "peer-1", "3.4.0")
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	_, resp, err = dialPeer(ts.URL, "unknown", "secret", "peer-1", "3.5.0")
+	require.Error(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	peer1, _, err := dialPeer(ts.URL, room.RoomID, "secret", "peer-1", "3.5.0")
+	require.NoError(t, err)
+	defer peer1.Close()
+	peer2, _, err := dialPeer(ts.URL, room.RoomID, "secret", "peer-2", "3.5.0")
+	require.NoError(t, err)
+	defer peer2.Close()
+
+	// Wait for the peers to be registered
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		rm := s.rooms[room.RoomID]
+		s.mu.Unlock()
+		rm.mu.Lock()
+		defer rm.mu.Unlock()
+		return len(rm.peers) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Peer -> Host
+	require.NoError(t, peer1.WriteJSON(map[string]interface{}{"type": "watch_party_join", "payload": map[string]string{"peerId": "peer-1"}}))
+	msg := readMessage(t, host)
+	require.Equal(t, "watch_party_join", msg["type"])
+
+	// Host -> Peers
+	require.NoError(t, host.WriteJSON(map[string]interface{}{"type": "watch_party_state_changed"}))
+	require.Equal(t, "watch_party_state_changed", readMessage(t, peer1)["type"])
+	require.Equal(t, "watch_party_state_changed", readMessage(t, peer2)["type"])
+}
+
+func TestRelayRemoveExpiredRooms(t *testing.T) {
+	s := NewServer(&NewServerOptions{Logger: util.NewLogger(), RoomTTL: time.Hour})
+	now := time.Now()
+
+	expired, err := s.createRoom("127.0.0.1", "a", "", now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	active, err := s.createRoom("127.0.0.1", "b", "", now)
+	require.NoError(t, err)
+	active.mu.Lock()
+	active.hostLeftAt = time.Time{}
+	active.host = &client{done: make(chan struct{})}
+	active.mu.Unlock()
+	abandoned, err := s.createRoom("127.0.0.1", "c", "", now.Add(-30*time.Minute))
+	require.NoError(t, err)
+
+	s.removeExpiredRooms(now)
+
+	require.Equal(t, 1, s.RoomCount())
+	_, err = s.getRoom(active.id, "b")
+	require.NoError(t, err)
+	_, err = s.getRoom(expired.id, "a")
+	require.ErrorIs(t, err, ErrRoomNotFound)
+	_, err = s.getRoom(abandoned.id, "c")
+	require.ErrorIs(t, err, ErrRoomNotFound)
+}
+
+func TestRelayRoomCreationLimits(t *testing.T) {
+	now := time.Now()
+
+	t.Run("Rate limit per IP", func(t *testing.T) {
+		s := NewServer(&NewServerOptions{Logger: util.NewLogger()})
+
+		for i := 0; i < roomCreationLimit; i++ {
+			_, err := s.createRoom("1.1.1.1", "secret", "", now)
+			require.NoError(t, err)
+		}
+		_, err := s.createRoom("1.1.1.1", "secret", "", now)
+		require.ErrorIs(t, err, ErrRateLimited)
+
+		// Other IPs are not limited
+		_, err = s.createRoom("2.2.2.2", "secret", "", now)
+		require.NoError(t, err)
+
+		// The limit is lifted after the window
+		_, err = s.createRoom("1.1.1.1", "secret", "", now.Add(roomCreationWindow))
+		require.NoError(t, err)
+	})
+
+	t.Run("Max rooms", func(t *testing.T) {
+		s := NewServer(&NewServerOptions{Logger: util.NewLogger()})
+		require.Equal(t, DefaultMaxRooms, s.maxRooms)
+
+		s = NewServer(&NewServerOptions{Logger: util.NewLogger(), MaxRooms: 2})
+		_, err := s.createRoom("1.1.1.1", "secret", "", now)
+		require.NoError(t, err)
+		_, err = s.createRoom("2.2.2.2", "secret", "", now)
+		require.NoError(t, err)
+		_, err = s.createRoom("3.3.3.3", "secret", "", now)
+		require.ErrorIs(t, err, ErrTooManyRooms)
+	})
+
+	t.Run("Relay password", func(t *testing.T) {
+		s := NewServer(&NewServerOptions{Logger: util.NewLogger(), Password: "relay-secret"})
+		ts := httptest.NewServer(http.StripPrefix("/api/rooms", s))
+		defer ts.Close()
+
+		body, _ := json.Marshal(createRoomRequest{Password: "secret", Version: "3.5.0"})
+		resp, err := http.Post(ts.URL+"/api/rooms", "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		// The password is set in the relay URL, like in the settings of the client
+		u, _ := url.Parse(ts.URL + "/api/rooms")
+		u.User = url.UserPassword("", "relay-secret")
+		createTestRoom(t, u.String(), "secret")
+		require.Equal(t, 1, s.RoomCount())
+	})
+}
+
+func TestRelayStream(t *testing.T) {
+	_, ts := newTestRelay(t)
+	room := createTestRoom(t, ts.URL+"/api/rooms", "secret")
+	streamUrl := ts.URL + "/api/rooms/" + room.RoomID + "/stream"
+	endpoint := "/api/v1/nakama/host/anime/library/stream?path=ZmlsZQ=="
+
+	getStream := func(password string, endpoint string) (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodGet, streamUrl+"?path="+url.QueryEscape(endpoint), nil)
+		req.Header.Set(RoomPasswordHeader, password)
+		req.Header.Set("Range", "bytes=0-")
+		req.Header.Set("X-Seanime-Nakama-Token", "secret")
+		req.Header.Set("Cookie", "not-forwarded")
+		return http.DefaultClient.Do(req)
+	}
+
+	// The host isn't connected
+	resp, err := getStream("secret", endpoint)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	host, _, err := websocket.DefaultDialer.Dial(room.HostWsUrl+"?password=secret&version=3.5.0", nil)
+	require.NoError(t, err)
+	defer host.Close()
+
+	resp, err = getStream("wrong", endpoint)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// Only the stream endpoints of the host can be requested
+	for _, invalid := range []string{"/api/v1/settings", "http://example.com/api/v1/nakama/host/torrentstream/stream", "//example.com/api/v1/nakama/host/torrentstream/stream"} {
+		resp, err = getStream("secret", invalid)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, invalid)
+	}
+
+	type result struct {
+		resp *http.Response
+		body string
+		err  error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		resp, err := getStream("secret", endpoint)
+		if err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		resultCh <- result{resp: resp, body: string(body), err: err}
+	}()
+
+	// The host receives the request
+	msg := readMessage(t, host)
+	require.Equal(t, MessageTypeStreamRequest, msg["type"])
+	data, _ := json.Marshal(msg["payload"])
+	var streamReq StreamRequest
+	require.NoError(t, json.Unmarshal(data, &streamReq))
+	require.Equal(t, http.MethodGet, streamReq.Method)
+	require.Equal(t, endpoint, streamReq.Endpoint)
+	require.Equal(t, "bytes=0-", streamReq.Header.Get("Range"))
+	require.Equal(t, "secret", streamReq.Header.Get("X-Seanime-Nakama-Token"))
+	require.Empty(t, streamReq.Header.Get("Cookie"))
+
+	postResponse := func(password string, requestId string) *http.Response {
+		header, _ := json.Marshal(&StreamResponse{
+			Status: http.StatusPartialContent,
+			Header: http.Header{"Content-Range": {"bytes 0-4/5"}, "Set-Cookie": {"not-forwarded"}},
+		})
+		req, _ := http.NewRequest(http.MethodPost, streamUrl+"/"+requestId, strings.NewReader("hello"))
+		req.Header.Set(RoomPasswordHeader, password)
+		req.Header.Set(StreamResponseHeader, string(header))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	require.Equal(t, http.StatusUnauthorized, postResponse("wrong", streamReq.RequestID).StatusCode)
+	require.Equal(t, http.StatusNotFound, postResponse("secret", "unknown").StatusCode)
+	require.Equal(t, http.StatusNoContent, postResponse("secret", streamReq.RequestID).StatusCode)
+
+	res := <-resultCh
+	require.NoError(t, res.err)
+	require.Equal(t, http.StatusPartialContent, res.resp.StatusCode)
+	require.Equal(t, "bytes 0-4/5", res.resp.Header.Get("Content-Range"))
+	require.Empty(t, res.resp.Header.Get("Set-Cookie"))
+	require.Equal(t, "hello", res.body)
+
+	// The request can't be answered twice
+	require.Equal(t, http.StatusNotFound, postResponse("secret", streamReq.RequestID).StatusCode)
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"seanime/internal/constants"
+	"strings"
 	"time"
 )
 
@@ -33,6 +34,29 @@ type CreateRoomResponse struct {
 	ExpiresAt   time.Time `json:"expiresAt"`
 }
 
+// getRoomsApiUrl returns the URL of the rooms relay, the self-hosted relay if set or Seanime Rooms
+func (m *Manager) getRoomsApiUrl() string {
+	if m.settings != nil && strings.TrimSpace(m.settings.RoomsRelayURL) != "" {
+		return strings.TrimSuffix(strings.TrimSpace(m.settings.RoomsRelayURL), "/")
+	}
+	return constants.SeanimeRoomsApiUrl
+}
+
+// getRoomsApiWsUrl returns the WebSocket URL of the rooms relay
+func (m *Manager) getRoomsApiWsUrl() string {
+	if m.settings == nil || strings.TrimSpace(m.settings.RoomsRelayURL) == "" {
+		return constants.SeanimeRoomsApiWsUrl
+	}
+	u := m.getRoomsApiUrl()
+	switch {
+	case strings.HasPrefix(u, "https://"):
+		return "wss://" + strings.TrimPrefix(u, "https://")
+	case strings.HasPrefix(u, "http://"):
+		return "ws://" + strings.TrimPrefix(u, "http://")
+	}
+	return u
+}
+
 // createRoom creates a new room on Seanime Rooms
 func (m *Manager) createRoom(password string) (*Room, error) {
 	reqBody := CreateRoomRequest{
@@ -46,7 +70,7 @@ func (m *Manager) createRoom(password string) (*Room, error) {
 	}
 
 	resp, err := http.Post(
-		constants.SeanimeRoomsApiUrl,
+		m.getRoomsApiUrl(),
 		"application/json",
 		bytes.NewBuffer(jsonData),
 	)
@@ -0,0 +1,150 @@
+package nakama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"seanime/internal/nakama/relay"
+	"strconv"
+	"strings"
+)
+
+// MessageTypeRelayStreamRequest is sent by the room relay when a peer requests a stream of the host
+const MessageTypeRelayStreamRequest MessageType = relay.MessageTypeStreamRequest
+
+// relayStreamClient has no timeout since streams are long-lived, requests are cancelled with the manager's context
+var relayStreamClient = &http.Client{}
+
+// NewHostRequest creates a request to an endpoint of the host.
+// In rooms mode, the request goes through the room relay which forwards it to the host.
+func (m *Manager) NewHostRequest(ctx context.Context, method string, endpoint string) (*http.Request, error) {
+	var requestUrl string
+	if m.IsRoomConnection() {
+		roomId := strings.TrimPrefix(m.settings.RemoteServerURL, "room://")
+		requestUrl = m.getRoomsApiUrl() + "/" + roomId + "/stream?path=" + url.QueryEscape(endpoint)
+	} else {
+		requestUrl = m.GetHostBaseServerURL() + endpoint
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	if m.IsRoomConnection() {
+		req.Header.Set(relay.RoomPasswordHeader, m.settings.RemoteServerPassword)
+	}
+	req.Header.Set("X-Seanime-Nakama-Token", m.settings.RemoteServerPassword)
+
+	return req, nil
+}
+
+// handleRelayStreamRequestMessage handles a stream request of a peer forwarded by the room relay
+func (m *Manager) handleRelayStreamRequestMessage(message *Message, senderID string) error {
+	if !m.settings.IsHost {
+		return errors.New("not acting as host")
+	}
+
+	m.roomMu.RLock()
+	room := m.currentRoom
+	m.roomMu.RUnlock()
+	if room == nil {
+		return errors.New("not in a room")
+	}
+
+	data, err := json.Marshal(message.Payload)
+	if err != nil {
+		return err
+	}
+
+	var payload relay.StreamRequest
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	if payload.RequestID == "" || !relay.IsStreamEndpoint(payload.Endpoint) {
+		return fmt.Errorf("invalid stream request: %s", payload.Endpoint)
+	}
+	if payload.Method != http.MethodGet && payload.Method != http.MethodHead {
+		return fmt.Errorf("invalid stream request method: %s", payload.Method)
+	}
+
+	go m.serveRelayStreamRequest(room, &payload)
+	return nil
+}
+
+// serveRelayStreamRequest requests the endpoint from this server and posts the response to the room relay
+func (m *Manager) serveRelayStreamRequest(room *Room, payload *relay.StreamRequest) {
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+
+	host := m.serverHost
+	if host == "0.0.0.0" {
+		host = "127.0.0.1"
+	}
+	address := fmt.Sprintf("http://%s:%d", host, m.serverPort)
+	if strings.HasPrefix(address, "http://http") {
+		address = strings.Replace(address, "http://http", "http", 1)
+	}
+
+	streamResp := &relay.StreamResponse{
+		Status: http.StatusBadGateway,
+		Header: make(http.Header),
+	}
+	var body io.Reader = http.NoBody
+	contentLength := int64(0)
+
+	req, err := http.NewRequestWithContext(ctx, payload.Method, address+payload.Endpoint, nil)
+	if err == nil {
+		// The Nakama token of the peer is forwarded, this server checks it
+		for key, values := range payload.Header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+
+		resp, err := relayStreamClient.Do(req)
+		if err != nil {
+			m.logger.Error().Err(err).Str("endpoint", payload.Endpoint).Msg("nakama: Failed to serve relayed stream request")
+		} else {
+			defer resp.Body.Close()
+			streamResp.Status = resp.StatusCode
+			streamResp.Header = resp.Header
+			if payload.Method == http.MethodHead {
+				if resp.ContentLength >= 0 {
+					streamResp.Header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+				}
+			} else {
+				body = resp.Body
+				contentLength = resp.ContentLength
+			}
+		}
+	}
+
+	header, err := json.Marshal(streamResp)
+	if err != nil {
+		return
+	}
+
+	postReq, err := http.NewRequestWithContext(ctx, http.MethodPost, m.getRoomsApiUrl()+"/"+room.ID+"/stream/"+payload.RequestID, body)
+	if err != nil {
+		m.logger.Error().Err(err).Msg("nakama: Failed to create relayed stream response")
+		return
+	}
+	if body != http.NoBody {
+		postReq.ContentLength = contentLength
+	}
+	postReq.Header.Set(relay.RoomPasswordHeader, room.Password)
+	postReq.Header.Set(relay.StreamResponseHeader, string(header))
+
+	postResp, err := relayStreamClient.Do(postReq)
+	if err != nil {
+		// The peer stopped reading, e.g. when seeking
+		m.logger.Debug().Err(err).Str("endpoint", payload.Endpoint).Msg("nakama: Relayed stream ended")
+		return
+	}
+	_ = postResp.Body.Close()
+}
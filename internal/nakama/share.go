@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"seanime/internal/api/anilist"
 	"seanime/internal/api/metadata_provider"
 	"seanime/internal/customsource"
@@ -143,8 +146,59 @@ func (m *Manager) GetHostAnimeLibrary(ctx context.Context) (ac *NakamaAnimeLibra
 	return entryResponse.Data, true
 }
 
-func (m *Manager) PlayHostAnimeLibraryFile(path string, userAgent string, clientId string, media *anilist.BaseAnime, aniDBEpisode string, forcePlaybackMethod string) error {
+// HostAnimeLibraryDownloadEndpoint is the endpoint from which peers copy the files of the host's anime library.
+const HostAnimeLibraryDownloadEndpoint = "/api/v1/nakama/host/anime/library/download"
+
+// hostAnimeLibraryDownloadTokenTTL is the lifetime of a download token, peers generate a token for each request.
+const hostAnimeLibraryDownloadTokenTTL = 5 * time.Minute
+
+// getHostAnimeLibraryDownloadTokenEndpoint returns the endpoint a download token is signed for, so that the token is bound to the file.
+func getHostAnimeLibraryDownloadTokenEndpoint(encodedPath string) string {
+	return HostAnimeLibraryDownloadEndpoint + "?path=" + encodedPath
+}
+
+// ValidateHostAnimeLibraryDownloadToken checks that the token was signed with the host password for the file.
+func ValidateHostAnimeLibraryDownloadToken(hostPassword string, token string, encodedPath string) error {
+	hmacAuth := util.NewHMACAuth(hostPassword, hostAnimeLibraryDownloadTokenTTL)
+	claims, err := hmacAuth.ValidateQueryParam(token, getHostAnimeLibraryDownloadTokenEndpoint(encodedPath))
+	if err != nil {
+		return err
+	}
+	// The expiration is set by the peer, tokens that live longer are rejected
+	if claims.ExpiresAt-claims.IssuedAt > int64(hostAnimeLibraryDownloadTokenTTL.Seconds()) {
+		return errors.New("token lifetime is too long")
+	}
+	return nil
+}
+
+// NewHostAnimeLibraryDownloadRequest creates an authenticated request to download a file of the host's anime library.
+func (m *Manager) NewHostAnimeLibraryDownloadRequest(ctx context.Context, path string) (*http.Request, error) {
 	if !m.settings.Enabled || !m.IsConnectedToHost() || m.IsRoomConnection() {
+		return nil, errors.New("not connected to host")
+	}
+
+	encodedPath := base64.StdEncoding.EncodeToString([]byte(path))
+	hmacAuth := util.NewHMACAuth(m.settings.RemoteServerPassword, hostAnimeLibraryDownloadTokenTTL)
+	token, err := hmacAuth.GenerateToken(getHostAnimeLibraryDownloadTokenEndpoint(encodedPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("path", encodedPath)
+	query.Set("token", token)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.GetHostBaseServerURL()+HostAnimeLibraryDownloadEndpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Seanime-Nakama-Token", m.settings.RemoteServerPassword)
+
+	return req, nil
+}
+
+func (m *Manager) PlayHostAnimeLibraryFile(path string, userAgent string, clientId string, media *anilist.BaseAnime, aniDBEpisode string, forcePlaybackMethod string) error {
+	if !m.settings.Enabled || !m.IsConnectedToHost() {
 		return errors.New("not connected to host")
 	}
 
@@ -156,17 +210,19 @@ func (m *Manager) PlayHostAnimeLibraryFile(path string, userAgent string, client
 
 	// Send a HTTP request to the host to get the anime library
 	// If we can access it then the host is sharing its anime library
-	response, err := m.reqClient.R().
-		SetHeader("X-Seanime-Nakama-Token", m.settings.RemoteServerPassword).
-		Get(m.GetHostBaseServerURL() + "/api/v1/nakama/host/anime/library/shared")
+	req, err := m.NewHostRequest(context.Background(), http.MethodGet, "/api/v1/nakama/host/anime/library/shared")
 	if err != nil {
 		return fmt.Errorf("cannot access host's anime library: %w", err)
 	}
+	response, err := m.reqClient.GetClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot access host's anime library: %w", err)
+	}
+	defer response.Body.Close()
 
-	if !response.IsSuccessState() {
-		body := response.Bytes()
-		code := response.StatusCode
-		return fmt.Errorf("cannot access host's anime library: %d, %s", code, string(body))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("cannot access host's anime library: %d, %s", response.StatusCode, string(body))
 	}
 
 	host := m.serverHost
@@ -0,0 +1,32 @@
+package nakama
+
+import (
+	"encoding/base64"
+	"seanime/internal/util"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateHostAnimeLibraryDownloadToken(t *testing.T) {
+	encodedPath := base64.StdEncoding.EncodeToString([]byte("/library/Show/Show - 01.mkv"))
+	otherPath := base64.StdEncoding.EncodeToString([]byte("/library/Show/Show - 02.mkv"))
+
+	token, err := util.NewHMACAuth("secret", hostAnimeLibraryDownloadTokenTTL).GenerateToken(getHostAnimeLibraryDownloadTokenEndpoint(encodedPath))
+	require.NoError(t, err)
+
+	require.NoError(t, ValidateHostAnimeLibraryDownloadToken("secret", token, encodedPath))
+	// The token is bound to the file
+	require.Error(t, ValidateHostAnimeLibraryDownloadToken("secret", token, otherPath))
+	require.Error(t, ValidateHostAnimeLibraryDownloadToken("other", token, encodedPath))
+	require.Error(t, ValidateHostAnimeLibraryDownloadToken("secret", "", encodedPath))
+
+	// Tokens that are not bound to a file or live longer are rejected
+	token, err = util.NewHMACAuth("secret", 24*time.Hour).GenerateToken(HostAnimeLibraryDownloadEndpoint)
+	require.NoError(t, err)
+	require.Error(t, ValidateHostAnimeLibraryDownloadToken("secret", token, encodedPath))
+	token, err = util.NewHMACAuth("secret", 24*time.Hour).GenerateToken(getHostAnimeLibraryDownloadTokenEndpoint(encodedPath))
+	require.NoError(t, err)
+	require.Error(t, ValidateHostAnimeLibraryDownloadToken("secret", token, encodedPath))
+}
@@ -129,6 +129,12 @@ type WatchPartyManager struct {
 
 	// Peer
 	peerPlaybackListener *WatchPartyPlaybackSubscriber // Listener for playback status changes (can be nil)
+
+	// Queue and history (host only)
+	queueMu          sync.Mutex                 // Mutex for queue and history state
+	queueAdvancing   bool                       // Whether the next queue item is being started
+	episodeStartedAt time.Time                  // When the current episode started
+	history          *watchPartyHistoryRecorder // Recorder for the current session (can be nil)
 }
 
 type WatchPartySession struct {
@@ -137,6 +143,7 @@ type WatchPartySession struct {
 	Settings         *WatchPartySessionSettings               `json:"settings"`
 	CreatedAt        time.Time                                `json:"createdAt"`
 	CurrentMediaInfo *WatchPartySessionMediaInfo              `json:"currentMediaInfo"` // can be nil if not set
+	Queue            []*WatchPartyQueueItem                   `json:"queue"`            // Episodes to play next, including unapproved proposals
 	// Whether this session is in relay mode
 	// In this case, the host will act as a relay server and relay status from the origin (a chosen peer) to all other peers
 	IsRelayMode bool `json:"isRelayMode"`
@@ -162,6 +169,8 @@ type WatchPartySessionParticipant struct {
 	PlaybackStatus *WatchPartyPlaybackStatus `json:"playbackStatus,omitempty"` // Current playback status
 	// Relay mode
 	IsRelayOrigin bool `json:"isRelayOrigin"` // Whether this peer is the origin for relay mode
+	// Queue
+	HasCompleted bool `json:"hasCompleted"` // Whether the participant finished the current episode
 }
 
 type WatchPartyStreamType string
@@ -450,6 +459,15 @@ func (wpm *WatchPartyManager) handleMessage(message *Message, senderID string) e
 			return err
 		}
 		wpm.handleWatchPartyChatMessageEvent(&payload)
+
+	case MessageTypeWatchPartyQueueProposal:
+		wpm.logger.Debug().Msg("nakama: Received watch party queue proposal message")
+		var payload WatchPartyQueueProposalPayload
+		err := json.Unmarshal(marshaledPayload, &payload)
+		if err != nil {
+			return err
+		}
+		wpm.handleWatchPartyQueueProposalEvent(&payload)
 	}
 
 	return nil
@@ -508,6 +526,9 @@ func (wpm *WatchPartyManager) SendChatMessage(message string) error {
 	if wpm.manager.IsHost() {
 		// Host broadcasts to all peers
 		_ = wpm.manager.SendMessage(MessageTypeWatchPartyChatMessage, payload)
+		if history := wpm.getHistoryRecorder(); history != nil {
+			history.addChatMessage(&payload)
+		}
 		// Send local event since SendMessage doesn't send to self
 		wpm.manager.wsEventManager.SendEvent(events.NakamaWatchPartyChatMessage, &payload)
 	} else {
@@ -0,0 +1,284 @@
+package nakama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"seanime/internal/database/models"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// HostWatchPartyHistoryEndpoint is the endpoint from which peers fetch the watch party history of the host.
+	HostWatchPartyHistoryEndpoint = "/api/v1/nakama/host/watch-party/history"
+
+	maxHistoryChatMessages = 1000 // Maximum number of chat messages recorded per session
+)
+
+type (
+	// WatchPartyHistoryEntry is a finished watch party session.
+	WatchPartyHistoryEntry struct {
+		ID           uint                            `json:"id"`
+		SessionId    string                          `json:"sessionId"`
+		StartedAt    time.Time                       `json:"startedAt"`
+		EndedAt      time.Time                       `json:"endedAt"`
+		Participants []*WatchPartyHistoryParticipant `json:"participants"`
+		Episodes     []*WatchPartyHistoryEpisode     `json:"episodes"`
+		ChatLog      []*WatchPartyChatMessagePayload `json:"chatLog"`
+	}
+
+	WatchPartyHistoryParticipant struct {
+		PeerId   string `json:"peerId"`
+		Username string `json:"username"`
+		IsHost   bool   `json:"isHost"`
+	}
+
+	WatchPartyHistoryEpisode struct {
+		MediaId       int                  `json:"mediaId"`
+		EpisodeNumber int                  `json:"episodeNumber"`
+		AniDBEpisode  string               `json:"aniDbEpisode"`
+		StreamType    WatchPartyStreamType `json:"streamType"`
+		StartedAt     time.Time            `json:"startedAt"`
+		Completed     bool                 `json:"completed"` // Whether every participant finished the episode
+	}
+
+	// watchPartyHistoryRecorder records the active session on the host.
+	// The session is saved when an episode starts or is completed and when it ends, so that it's not lost if the app exits.
+	watchPartyHistoryRecorder struct {
+		mu    sync.Mutex
+		entry *WatchPartyHistoryEntry
+		// id is the ID of the saved session, 0 until it's first saved
+		id     uint
+		saveMu sync.Mutex // Serializes the saves so that the session is only inserted once
+	}
+)
+
+func newWatchPartyHistoryRecorder(sessionId string) *watchPartyHistoryRecorder {
+	return &watchPartyHistoryRecorder{
+		entry: &WatchPartyHistoryEntry{
+			SessionId:    sessionId,
+			StartedAt:    time.Now(),
+			Participants: make([]*WatchPartyHistoryParticipant, 0),
+			Episodes:     make([]*WatchPartyHistoryEpisode, 0),
+			ChatLog:      make([]*WatchPartyChatMessagePayload, 0),
+		},
+	}
+}
+
+func (r *watchPartyHistoryRecorder) addParticipant(peerId string, username string, isHost bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if slices.ContainsFunc(r.entry.Participants, func(p *WatchPartyHistoryParticipant) bool { return p.PeerId == peerId }) {
+		return
+	}
+	r.entry.Participants = append(r.entry.Participants, &WatchPartyHistoryParticipant{
+		PeerId:   peerId,
+		Username: username,
+		IsHost:   isHost,
+	})
+}
+
+// addEpisode records a new episode, unless it's the episode that was last recorded.
+// It returns true if the episode was recorded.
+func (r *watchPartyHistoryRecorder) addEpisode(mediaInfo *WatchPartySessionMediaInfo) bool {
+	if mediaInfo == nil || mediaInfo.MediaId == 0 {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.entry.Episodes) > 0 {
+		last := r.entry.Episodes[len(r.entry.Episodes)-1]
+		if last.MediaId == mediaInfo.MediaId && last.EpisodeNumber == mediaInfo.EpisodeNumber {
+			return false
+		}
+	}
+	r.entry.Episodes = append(r.entry.Episodes, &WatchPartyHistoryEpisode{
+		MediaId:       mediaInfo.MediaId,
+		EpisodeNumber: mediaInfo.EpisodeNumber,
+		AniDBEpisode:  mediaInfo.AniDBEpisode,
+		StreamType:    mediaInfo.StreamType,
+		StartedAt:     time.Now(),
+	})
+	return true
+}
+
+// markLastEpisodeCompleted returns true if the last episode wasn't already completed.
+func (r *watchPartyHistoryRecorder) markLastEpisodeCompleted() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.entry.Episodes) == 0 || r.entry.Episodes[len(r.entry.Episodes)-1].Completed {
+		return false
+	}
+	r.entry.Episodes[len(r.entry.Episodes)-1].Completed = true
+	return true
+}
+
+func (r *watchPartyHistoryRecorder) addChatMessage(payload *WatchPartyChatMessagePayload) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.entry.ChatLog) >= maxHistoryChatMessages {
+		return
+	}
+	msg := *payload
+	r.entry.ChatLog = append(r.entry.ChatLog, &msg)
+}
+
+// toModel returns the database model of the session, or nil if no episodes were played.
+func (r *watchPartyHistoryRecorder) toModel() (*models.WatchPartyHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.entry.Episodes) == 0 {
+		return nil, nil
+	}
+
+	participants, err := json.Marshal(r.entry.Participants)
+	if err != nil {
+		return nil, err
+	}
+	episodes, err := json.Marshal(r.entry.Episodes)
+	if err != nil {
+		return nil, err
+	}
+	chatLog, err := json.Marshal(r.entry.ChatLog)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &models.WatchPartyHistory{
+		SessionId:    r.entry.SessionId,
+		StartedAt:    r.entry.StartedAt,
+		EndedAt:      time.Now(),
+		Participants: participants,
+		Episodes:     episodes,
+		ChatLog:      chatLog,
+	}
+	history.ID = r.id
+	return history, nil
+}
+
+func newWatchPartyHistoryEntry(history *models.WatchPartyHistory) (*WatchPartyHistoryEntry, error) {
+	entry := &WatchPartyHistoryEntry{
+		ID:        history.ID,
+		SessionId: history.SessionId,
+		StartedAt: history.StartedAt,
+		EndedAt:   history.EndedAt,
+	}
+	if err := json.Unmarshal(history.Participants, &entry.Participants); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(history.Episodes, &entry.Episodes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(history.ChatLog, &entry.ChatLog); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (wpm *WatchPartyManager) getHistoryRecorder() *watchPartyHistoryRecorder {
+	wpm.queueMu.Lock()
+	defer wpm.queueMu.Unlock()
+	return wpm.history
+}
+
+// saveHistory saves the recorded session to the database (host only).
+// The session is updated if it was already saved.
+func (wpm *WatchPartyManager) saveHistory(recorder *watchPartyHistoryRecorder) {
+	if recorder == nil || wpm.manager.database == nil {
+		return
+	}
+
+	recorder.saveMu.Lock()
+	defer recorder.saveMu.Unlock()
+
+	history, err := recorder.toModel()
+	if err != nil {
+		wpm.logger.Error().Err(err).Msg("nakama: Failed to encode watch party history")
+		return
+	}
+	if history == nil {
+		return
+	}
+
+	if err := wpm.manager.database.SaveWatchPartyHistory(history); err != nil {
+		wpm.logger.Error().Err(err).Msg("nakama: Failed to save watch party history")
+		return
+	}
+
+	recorder.mu.Lock()
+	recorder.id = history.ID
+	recorder.mu.Unlock()
+
+	wpm.logger.Debug().Str("sessionId", history.SessionId).Msg("nakama: Saved watch party history")
+}
+
+// GetWatchPartyHistory returns the finished watch party sessions, most recent first.
+// Peers fetch the history of the host.
+func (m *Manager) GetWatchPartyHistory(ctx context.Context) ([]*WatchPartyHistoryEntry, error) {
+	if m.IsHost() {
+		if m.database == nil {
+			return nil, errors.New("database not available")
+		}
+		histories, err := m.database.GetWatchPartyHistory()
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]*WatchPartyHistoryEntry, 0, len(histories))
+		for _, history := range histories {
+			entry, err := newWatchPartyHistoryEntry(history)
+			if err != nil {
+				m.logger.Warn().Err(err).Uint("id", history.ID).Msg("nakama: Failed to decode watch party history")
+				continue
+			}
+			ret = append(ret, entry)
+		}
+		return ret, nil
+	}
+
+	if !m.settings.Enabled || !m.IsConnectedToHost() || m.IsRoomConnection() {
+		return nil, errors.New("not connected to host")
+	}
+
+	response, err := m.reqClient.R().
+		SetContext(ctx).
+		SetHeader("X-Seanime-Nakama-Token", m.settings.RemoteServerPassword).
+		Get(m.GetHostBaseServerURL() + HostWatchPartyHistoryEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	if !response.IsSuccessState() {
+		return nil, fmt.Errorf("host responded with status %d", response.StatusCode)
+	}
+
+	var historyResponse struct {
+		Data []*WatchPartyHistoryEntry `json:"data"`
+	}
+	if err := json.Unmarshal(response.Bytes(), &historyResponse); err != nil {
+		return nil, err
+	}
+	if historyResponse.Data == nil {
+		return make([]*WatchPartyHistoryEntry, 0), nil
+	}
+
+	return historyResponse.Data, nil
+}
+
+// DeleteWatchPartyHistory deletes a finished session from the history (host only).
+func (m *Manager) DeleteWatchPartyHistory(id uint) error {
+	if !m.IsHost() {
+		return errors.New("only the host can delete the watch party history")
+	}
+	if m.database == nil {
+		return errors.New("database not available")
+	}
+	return m.database.DeleteWatchPartyHistory(id)
+}
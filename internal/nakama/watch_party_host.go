@@ -51,6 +51,7 @@ func (wpm *WatchPartyManager) CreateWatchParty(options *CreateWatchOptions) (*Wa
 		ID:               sessionID,
 		Participants:     make(map[string]*WatchPartySessionParticipant),
 		CurrentMediaInfo: nil,
+		Queue:            make([]*WatchPartyQueueItem, 0),
 		Settings:         options.Settings,
 		CreatedAt:        time.Now(),
 	}
@@ -69,6 +70,13 @@ func (wpm *WatchPartyManager) CreateWatchParty(options *CreateWatchOptions) (*Wa
 
 	wpm.currentSession = mo.Some(session)
 
+	// Start recording the session
+	wpm.queueMu.Lock()
+	wpm.queueAdvancing = false
+	wpm.history = newWatchPartyHistoryRecorder(sessionID)
+	wpm.history.addParticipant("host", wpm.manager.username, true)
+	wpm.queueMu.Unlock()
+
 	// Reset sequence numbers for new session
 	wpm.sequenceMu.Lock()
 	wpm.sendSequence = 0
@@ -170,6 +178,13 @@ func (wpm *WatchPartyManager) StopWatchParty() {
 	// Broadcast the stop event to all peers
 	_ = wpm.manager.SendMessage(MessageTypeWatchPartyStopped, nil)
 
+	// Save the recorded session
+	wpm.queueMu.Lock()
+	history := wpm.history
+	wpm.history = nil
+	wpm.queueMu.Unlock()
+	wpm.saveHistory(history)
+
 	if wpm.sessionCtxCancel != nil {
 		wpm.sessionCtxCancel()
 		wpm.sessionCtx = nil
@@ -246,6 +261,12 @@ func (wpm *WatchPartyManager) hostPlaybackHandleStatus(opts hostPlaybackHandleSt
 	if session.CurrentMediaInfo.Equals(newCurrentMediaInfo) && opts.mediaId != 0 {
 		wpm.mu.Unlock()
 
+		// Check if the host finished the episode
+		if isPlaybackCompleted(&WatchPartyPlaybackStatus{CurrentTime: opts.currentTime, Duration: opts.duration}) &&
+			wpm.markParticipantCompleted(session, "host") {
+			go wpm.checkQueueAutoAdvance()
+		}
+
 		// Get next sequence number for message ordering
 		wpm.sequenceMu.Lock()
 		wpm.sendSequence++
@@ -268,6 +289,10 @@ func (wpm *WatchPartyManager) hostPlaybackHandleStatus(opts hostPlaybackHandleSt
 		// For new playback, update the session
 		wpm.logger.Debug().Msgf("nakama: Playback changed or started: %s", localFilePath)
 		session.CurrentMediaInfo = newCurrentMediaInfo
+		wpm.resetQueueCompletion(session)
+		if history := wpm.getHistoryRecorder(); history != nil && history.addEpisode(newCurrentMediaInfo) {
+			go wpm.saveHistory(history)
+		}
 		wpm.mu.Unlock()
 
 		// Pause immediately and wait for peers to be ready
@@ -479,6 +504,10 @@ func (wpm *WatchPartyManager) handleWatchPartyPeerJoinedEvent(payload *WatchPart
 	}
 	session.mu.Unlock()
 
+	if history := wpm.getHistoryRecorder(); history != nil {
+		history.addParticipant(payload.PeerId, payload.Username, false)
+	}
+
 	// Send session state
 	go wpm.broadcastSessionStateToPeers()
 
@@ -506,6 +535,9 @@ func (wpm *WatchPartyManager) handleWatchPartyPeerLeftEvent(payload *WatchPartyL
 	// Remove the peer from the session
 	delete(session.Participants, payload.PeerId)
 
+	// The remaining participants may have finished the episode
+	go wpm.checkQueueAutoAdvance()
+
 	// Send session state
 	go wpm.broadcastSessionStateToPeers()
 
@@ -538,6 +570,9 @@ func (wpm *WatchPartyManager) HandlePeerDisconnected(peerID string) {
 	// Remove the peer from the session
 	delete(session.Participants, peerID)
 
+	// The remaining participants may have finished the episode
+	go wpm.checkQueueAutoAdvance()
+
 	// Send session state to remaining peers
 	go wpm.broadcastSessionStateToPeers()
 
@@ -560,6 +595,9 @@ func (wpm *WatchPartyManager) handleWatchPartyPeerStatusEvent(payload *WatchPart
 		return
 	}
 
+	// Check if the peer finished the episode
+	completed := isPlaybackCompleted(payload.PlaybackStatus) && wpm.markParticipantCompleted(session, payload.PeerId)
+
 	// Update peer status
 	if participant, exists := session.Participants[payload.PeerId]; exists {
 		participant.PlaybackStatus = payload.PlaybackStatus
@@ -583,6 +621,11 @@ func (wpm *WatchPartyManager) handleWatchPartyPeerStatusEvent(payload *WatchPart
 	// Run this asynchronously to avoid blocking the event processing
 	go wpm.checkAndManageBuffering()
 
+	// Play the next queue item if everyone finished the episode
+	if completed {
+		go wpm.checkQueueAutoAdvance()
+	}
+
 	// Send session state to client to update the UI
 	wpm.sendSessionStateToClient()
 }
@@ -883,6 +926,10 @@ func (wpm *WatchPartyManager) handleWatchPartyRelayModeOriginStreamStartedEvent(
 
 	// Video playback has started, send the media info to the peers
 	session.CurrentMediaInfo = newCurrentMediaInfo
+	wpm.resetQueueCompletion(session)
+	if history := wpm.getHistoryRecorder(); history != nil && history.addEpisode(newCurrentMediaInfo) {
+		go wpm.saveHistory(history)
+	}
 
 	// Pause immediately and wait for peers to be ready
 	wpm.manager.genericPlayer.Pause()
@@ -980,6 +1027,9 @@ func (wpm *WatchPartyManager) handleWatchPartyChatMessageEvent(payload *WatchPar
 	// If we're the host, broadcast the chat message to all participants (including sender)
 	if wpm.manager.IsHost() {
 		_ = wpm.manager.SendMessage(MessageTypeWatchPartyChatMessage, payload)
+		if history := wpm.getHistoryRecorder(); history != nil {
+			history.addChatMessage(payload)
+		}
 	}
 
 	// Always send to local client (both host and peer receive their own messages)
@@ -0,0 +1,423 @@
+package nakama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seanime/internal/database/db_bridge"
+	debrid_client "seanime/internal/debrid/client"
+	"seanime/internal/directstream"
+	"seanime/internal/events"
+	"seanime/internal/library/anime"
+	"seanime/internal/library/playbackmanager"
+	"seanime/internal/torrentstream"
+	"seanime/internal/util"
+	"seanime/internal/videocore"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Peer -> Host
+	MessageTypeWatchPartyQueueProposal = "watch_party_queue_proposal" // Peer proposes an episode to add to the queue
+)
+
+const (
+	EpisodeCompletedThreshold  = 0.95             // Fraction of the duration after which a participant has finished the episode
+	QueueCompletionGracePeriod = 10 * time.Second // Completion reports are ignored after an episode starts, they can be stale reports of the previous episode
+)
+
+// WatchPartyQueueItem is an episode waiting to be played in the watch party.
+// The params of the stream type are used by the host to start the stream once the item is played.
+type WatchPartyQueueItem struct {
+	ID                  string                            `json:"id"`
+	MediaId             int                               `json:"mediaId"`
+	EpisodeNumber       int                               `json:"episodeNumber"`
+	AniDBEpisode        string                            `json:"aniDbEpisode"`
+	StreamType          WatchPartyStreamType              `json:"streamType"`
+	LocalFilePath       string                            `json:"localFilePath,omitempty"` // Path of the file on the host if StreamType is file
+	TorrentStreamParams *torrentstream.StartStreamOptions `json:"torrentStreamParams,omitempty"`
+	DebridStreamParams  *debrid_client.StartStreamOptions `json:"debridStreamParams,omitempty"`
+	OnlinestreamParams  *videocore.OnlinestreamParams     `json:"onlinestreamParams,omitempty"`
+	ProposedBy          string                            `json:"proposedBy"` // PeerID of the participant who added the item, "host" for the host
+	ProposedByUsername  string                            `json:"proposedByUsername"`
+	Approved            bool                              `json:"approved"` // Only approved items are played, items added by the host are approved
+	AddedAt             time.Time                         `json:"addedAt"`
+}
+
+type WatchPartyQueueProposalPayload struct {
+	PeerId string               `json:"peerId"`
+	Item   *WatchPartyQueueItem `json:"item"`
+}
+
+func (item *WatchPartyQueueItem) validate() error {
+	if item == nil {
+		return errors.New("no item provided")
+	}
+	if item.MediaId == 0 {
+		return errors.New("media id is required")
+	}
+
+	switch item.StreamType {
+	case WatchPartyStreamTypeFile:
+		if item.LocalFilePath == "" {
+			return errors.New("local file path is required")
+		}
+	case WatchPartyStreamTypeTorrent:
+		if item.TorrentStreamParams == nil {
+			return errors.New("torrent stream params are required")
+		}
+	case WatchPartyStreamTypeDebrid:
+		if item.DebridStreamParams == nil {
+			return errors.New("debrid stream params are required")
+		}
+	case WatchPartyStreamTypeOnlinestream:
+		if item.OnlinestreamParams == nil {
+			return errors.New("onlinestream params are required")
+		}
+	default:
+		return fmt.Errorf("invalid stream type: %s", item.StreamType)
+	}
+	return nil
+}
+
+// isPlaybackCompleted returns true if the playback status is past EpisodeCompletedThreshold.
+func isPlaybackCompleted(status *WatchPartyPlaybackStatus) bool {
+	return status != nil && status.Duration > 0 && status.CurrentTime/status.Duration >= EpisodeCompletedThreshold
+}
+
+// AddToQueue adds an episode to the watch party queue.
+// Items added by the host are approved, peers send a proposal to the host instead.
+func (wpm *WatchPartyManager) AddToQueue(item *WatchPartyQueueItem) error {
+	if err := item.validate(); err != nil {
+		return err
+	}
+
+	wpm.mu.RLock()
+	session, ok := wpm.currentSession.Get()
+	wpm.mu.RUnlock()
+	if !ok {
+		return errors.New("no active watch party session")
+	}
+
+	if !wpm.manager.IsHost() {
+		hostConn, ok := wpm.manager.GetHostConnection()
+		if !ok {
+			return errors.New("no host connection")
+		}
+
+		session.mu.RLock()
+		_, isParticipant := session.Participants[hostConn.PeerId]
+		session.mu.RUnlock()
+		if !isParticipant {
+			return errors.New("not a participant of the watch party")
+		}
+
+		return wpm.manager.SendMessageToHost(MessageTypeWatchPartyQueueProposal, &WatchPartyQueueProposalPayload{
+			PeerId: hostConn.PeerId,
+			Item:   item,
+		})
+	}
+
+	item.ID = uuid.New().String()
+	item.ProposedBy = "host"
+	item.ProposedByUsername = wpm.manager.username
+	item.Approved = true
+	item.AddedAt = time.Now()
+
+	session.mu.Lock()
+	session.Queue = append(session.Queue, item)
+	session.mu.Unlock()
+
+	wpm.logger.Debug().Str("itemId", item.ID).Int("mediaId", item.MediaId).Msg("nakama: Added item to watch party queue")
+
+	go wpm.broadcastSessionStateToPeers()
+	wpm.sendSessionStateToClient()
+
+	return nil
+}
+
+// handleWatchPartyQueueProposalEvent is called when a peer proposes an episode (host only).
+// The item is added to the queue and has to be approved by the host.
+func (wpm *WatchPartyManager) handleWatchPartyQueueProposalEvent(payload *WatchPartyQueueProposalPayload) {
+	if !wpm.manager.IsHost() {
+		return
+	}
+
+	if err := payload.Item.validate(); err != nil {
+		wpm.logger.Warn().Err(err).Str("peerId", payload.PeerId).Msg("nakama: Received invalid watch party queue proposal")
+		return
+	}
+
+	wpm.mu.RLock()
+	session, ok := wpm.currentSession.Get()
+	wpm.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	session.mu.Lock()
+	participant, isParticipant := session.Participants[payload.PeerId]
+	if !isParticipant {
+		session.mu.Unlock()
+		wpm.logger.Warn().Str("peerId", payload.PeerId).Msg("nakama: Received queue proposal from non-participant")
+		return
+	}
+
+	item := payload.Item
+	item.ID = uuid.New().String()
+	item.ProposedBy = participant.ID
+	item.ProposedByUsername = participant.Username
+	item.Approved = false
+	item.AddedAt = time.Now()
+	session.Queue = append(session.Queue, item)
+	session.mu.Unlock()
+
+	wpm.logger.Debug().Str("peerId", payload.PeerId).Str("itemId", item.ID).Msg("nakama: Peer proposed an item for the watch party queue")
+
+	wpm.manager.wsEventManager.SendEvent(events.InfoToast, fmt.Sprintf("Watch party: %s proposed an episode", item.ProposedByUsername))
+
+	go wpm.broadcastSessionStateToPeers()
+	wpm.sendSessionStateToClient()
+}
+
+// ApproveQueueItem approves an item proposed by a peer (host only).
+func (wpm *WatchPartyManager) ApproveQueueItem(id string) error {
+	return wpm.updateQueue(func(session *WatchPartySession) error {
+		idx := slices.IndexFunc(session.Queue, func(item *WatchPartyQueueItem) bool { return item.ID == id })
+		if idx == -1 {
+			return errors.New("queue item not found")
+		}
+		session.Queue[idx].Approved = true
+		return nil
+	})
+}
+
+// RemoveQueueItem removes an item from the queue (host only).
+// This is also used to reject proposals.
+func (wpm *WatchPartyManager) RemoveQueueItem(id string) error {
+	return wpm.updateQueue(func(session *WatchPartySession) error {
+		idx := slices.IndexFunc(session.Queue, func(item *WatchPartyQueueItem) bool { return item.ID == id })
+		if idx == -1 {
+			return errors.New("queue item not found")
+		}
+		session.Queue = slices.Delete(session.Queue, idx, idx+1)
+		return nil
+	})
+}
+
+// PlayNextQueueItem removes the first approved item from the queue and plays it on the host (host only).
+// Peers start the same stream once the host's playback starts.
+func (wpm *WatchPartyManager) PlayNextQueueItem() error {
+	var next *WatchPartyQueueItem
+	err := wpm.updateQueue(func(session *WatchPartySession) error {
+		if session.IsRelayMode {
+			return errors.New("the queue cannot be played in relay mode")
+		}
+		idx := slices.IndexFunc(session.Queue, func(item *WatchPartyQueueItem) bool { return item.Approved })
+		if idx == -1 {
+			return errors.New("no approved items in the queue")
+		}
+		next = session.Queue[idx]
+		session.Queue = slices.Delete(session.Queue, idx, idx+1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	wpm.logger.Debug().Str("itemId", next.ID).Int("mediaId", next.MediaId).Int("episode", next.EpisodeNumber).Msg("nakama: Playing next watch party queue item")
+
+	return wpm.playQueueItem(next)
+}
+
+// updateQueue applies fn to the session and sends the new state to the peers if it succeeds (host only).
+func (wpm *WatchPartyManager) updateQueue(fn func(session *WatchPartySession) error) error {
+	if !wpm.manager.IsHost() {
+		return errors.New("only the host can manage the queue")
+	}
+
+	wpm.mu.RLock()
+	session, ok := wpm.currentSession.Get()
+	wpm.mu.RUnlock()
+	if !ok {
+		return errors.New("no active watch party session")
+	}
+
+	session.mu.Lock()
+	err := fn(session)
+	session.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	go wpm.broadcastSessionStateToPeers()
+	wpm.sendSessionStateToClient()
+
+	return nil
+}
+
+// playQueueItem starts the stream of the item on the host.
+func (wpm *WatchPartyManager) playQueueItem(item *WatchPartyQueueItem) (err error) {
+	defer util.HandlePanicInModuleWithError("nakama/playQueueItem", &err)
+
+	useDenshiPlayer := wpm.manager.GetUseDenshiPlayer()
+
+	switch item.StreamType {
+	case WatchPartyStreamTypeFile:
+		if wpm.manager.database == nil {
+			return errors.New("database not available")
+		}
+		lfs, _, err := db_bridge.GetLocalFiles(wpm.manager.database)
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(lfs, func(lf *anime.LocalFile) bool {
+			return util.NormalizePath(lf.Path) == util.NormalizePath(item.LocalFilePath)
+		}) {
+			return errors.New("file not found in the library")
+		}
+		if useDenshiPlayer {
+			return wpm.manager.directstreamManager.PlayLocalFile(context.Background(), directstream.PlayLocalFileOptions{
+				Path:       item.LocalFilePath,
+				LocalFiles: lfs,
+			})
+		}
+		return wpm.manager.playbackManager.StartPlayingUsingMediaPlayer(&playbackmanager.StartPlayingOptions{
+			Payload: item.LocalFilePath,
+		})
+
+	case WatchPartyStreamTypeTorrent:
+		if !wpm.manager.torrentstreamRepository.IsEnabled() {
+			return errors.New("torrent streaming is not enabled")
+		}
+		options := *item.TorrentStreamParams
+		options.ClientId = ""
+		options.PlaybackType = torrentstream.PlaybackTypeExternal
+		if useDenshiPlayer {
+			options.PlaybackType = torrentstream.PlaybackTypeNativePlayer
+		}
+		return wpm.manager.torrentstreamRepository.StartStream(context.Background(), &options)
+
+	case WatchPartyStreamTypeDebrid:
+		options := *item.DebridStreamParams
+		options.ClientId = ""
+		options.PlaybackType = debrid_client.PlaybackTypeDefault
+		if useDenshiPlayer {
+			options.PlaybackType = debrid_client.PlaybackTypeNativePlayer
+		}
+		return wpm.manager.debridClientRepository.StartStream(context.Background(), &options)
+
+	case WatchPartyStreamTypeOnlinestream:
+		// Online streams are only played by the video core
+		wpm.manager.genericPlayer.SetType(WatchPartyVideoCore)
+		wpm.manager.videoCore.StartOnlinestreamWatchParty(item.OnlinestreamParams)
+	}
+
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Auto-advance
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// resetQueueCompletion is called by the host when a new episode starts.
+// NOTE: This function should be called while holding wpm.mu.
+func (wpm *WatchPartyManager) resetQueueCompletion(session *WatchPartySession) {
+	session.mu.Lock()
+	for _, participant := range session.Participants {
+		participant.HasCompleted = false
+	}
+	session.mu.Unlock()
+
+	wpm.queueMu.Lock()
+	wpm.queueAdvancing = false
+	wpm.episodeStartedAt = time.Now()
+	wpm.queueMu.Unlock()
+}
+
+// markParticipantCompleted marks that a participant finished the current episode (host only).
+// It returns true if the participant hadn't finished it before.
+func (wpm *WatchPartyManager) markParticipantCompleted(session *WatchPartySession, peerId string) bool {
+	wpm.queueMu.Lock()
+	inGracePeriod := time.Since(wpm.episodeStartedAt) < QueueCompletionGracePeriod
+	wpm.queueMu.Unlock()
+	if inGracePeriod {
+		return false
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	participant, ok := session.Participants[peerId]
+	if !ok || participant.HasCompleted {
+		return false
+	}
+	participant.HasCompleted = true
+	return true
+}
+
+// checkQueueAutoAdvance plays the next approved item once every participant finished the current episode (host only).
+// NOTE: This function should NOT be called while holding wpm.mu.
+func (wpm *WatchPartyManager) checkQueueAutoAdvance() {
+	if !wpm.manager.IsHost() {
+		return
+	}
+
+	wpm.mu.RLock()
+	session, ok := wpm.currentSession.Get()
+	wpm.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	session.mu.RLock()
+	isRelayMode := session.IsRelayMode
+	allCompleted := len(session.Participants) > 0
+	for _, participant := range session.Participants {
+		// In relay mode, the host doesn't play the episode
+		if participant.IsHost && isRelayMode {
+			continue
+		}
+		if !participant.HasCompleted {
+			allCompleted = false
+			break
+		}
+	}
+	hasNext := slices.ContainsFunc(session.Queue, func(item *WatchPartyQueueItem) bool { return item.Approved })
+	session.mu.RUnlock()
+
+	if !allCompleted {
+		return
+	}
+
+	if history := wpm.getHistoryRecorder(); history != nil && history.markLastEpisodeCompleted() {
+		go wpm.saveHistory(history)
+	}
+
+	// In relay mode, the origin starts the streams
+	if !hasNext || isRelayMode {
+		return
+	}
+
+	wpm.queueMu.Lock()
+	if wpm.queueAdvancing {
+		wpm.queueMu.Unlock()
+		return
+	}
+	wpm.queueAdvancing = true
+	wpm.queueMu.Unlock()
+
+	wpm.logger.Debug().Msg("nakama: All participants finished the episode, playing the next queue item")
+
+	if err := wpm.PlayNextQueueItem(); err != nil {
+		wpm.logger.Error().Err(err).Msg("nakama: Failed to play the next watch party queue item")
+		wpm.manager.wsEventManager.SendEvent(events.ErrorToast, fmt.Sprintf("Watch party: Failed to play the next episode: %s", err.Error()))
+
+		wpm.queueMu.Lock()
+		wpm.queueAdvancing = false
+		wpm.queueMu.Unlock()
+	}
+}
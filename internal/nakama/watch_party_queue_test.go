@@ -0,0 +1,173 @@
+package nakama
+
+import (
+	"seanime/internal/database/db"
+	"seanime/internal/database/models"
+	"seanime/internal/events"
+	"seanime/internal/util"
+	"seanime/internal/videocore"
+	"testing"
+	"time"
+
+	"github.com/samber/mo"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestHostWatchParty returns a host manager with an active session joined by "peer1".
+func newTestHostWatchParty(t *testing.T) (*Manager, *WatchPartySession) {
+	logger := util.NewLogger()
+	database, err := db.NewDatabase(t.TempDir(), "test", logger)
+	require.NoError(t, err)
+
+	wsEventManager := events.NewMockWSEventManager(logger)
+	m := NewManager(&NewManagerOptions{
+		Logger:         logger,
+		Database:       database,
+		WSEventManager: wsEventManager,
+		VideoCore: videocore.New(videocore.NewVideoCoreOptions{
+			WsEventManager: wsEventManager,
+			Logger:         logger,
+			IsOfflineRef:   util.NewRef(false),
+		}),
+		IsOfflineRef: util.NewRef(false),
+	})
+	m.settings = &models.NakamaSettings{Enabled: true, IsHost: true}
+	m.username = "host"
+
+	session := &WatchPartySession{
+		ID: "session",
+		Participants: map[string]*WatchPartySessionParticipant{
+			"host":  {ID: "host", Username: "host", IsHost: true},
+			"peer1": {ID: "peer1", Username: "peer"},
+		},
+		Settings: &WatchPartySessionSettings{},
+		Queue:    make([]*WatchPartyQueueItem, 0),
+	}
+	m.watchPartyManager.currentSession = mo.Some(session)
+	m.watchPartyManager.history = newWatchPartyHistoryRecorder(session.ID)
+
+	return m, session
+}
+
+func newTestQueueItem(episode int) *WatchPartyQueueItem {
+	return &WatchPartyQueueItem{
+		MediaId:            21,
+		EpisodeNumber:      episode,
+		StreamType:         WatchPartyStreamTypeOnlinestream,
+		OnlinestreamParams: &videocore.OnlinestreamParams{MediaId: 21, EpisodeNumber: episode},
+	}
+}
+
+func TestWatchPartyQueue(t *testing.T) {
+	m, session := newTestHostWatchParty(t)
+	wpm := m.watchPartyManager
+
+	require.Error(t, wpm.AddToQueue(&WatchPartyQueueItem{MediaId: 21, StreamType: WatchPartyStreamTypeTorrent}))
+
+	// Proposals from non-participants are ignored
+	wpm.handleWatchPartyQueueProposalEvent(&WatchPartyQueueProposalPayload{PeerId: "peer2", Item: newTestQueueItem(2)})
+	require.Empty(t, session.Queue)
+
+	wpm.handleWatchPartyQueueProposalEvent(&WatchPartyQueueProposalPayload{PeerId: "peer1", Item: newTestQueueItem(2)})
+	require.Len(t, session.Queue, 1)
+	require.False(t, session.Queue[0].Approved)
+	require.Equal(t, "peer", session.Queue[0].ProposedByUsername)
+
+	// Proposals aren't played until approved
+	require.Error(t, wpm.PlayNextQueueItem())
+
+	require.NoError(t, wpm.AddToQueue(newTestQueueItem(3)))
+	require.Len(t, session.Queue, 2)
+	require.True(t, session.Queue[1].Approved)
+	require.Equal(t, "host", session.Queue[1].ProposedBy)
+
+	require.NoError(t, wpm.ApproveQueueItem(session.Queue[0].ID))
+	require.Error(t, wpm.RemoveQueueItem("unknown"))
+
+	// Episode 1 starts
+	mediaInfo := &WatchPartySessionMediaInfo{MediaId: 21, EpisodeNumber: 1, StreamType: WatchPartyStreamTypeOnlinestream}
+	session.CurrentMediaInfo = mediaInfo
+	wpm.resetQueueCompletion(session)
+	wpm.history.addEpisode(mediaInfo)
+
+	// Completion reports right after the episode started are ignored
+	require.False(t, wpm.markParticipantCompleted(session, "peer1"))
+	wpm.episodeStartedAt = time.Now().Add(-time.Minute)
+
+	require.True(t, wpm.markParticipantCompleted(session, "peer1"))
+	require.False(t, wpm.markParticipantCompleted(session, "peer1"))
+	wpm.checkQueueAutoAdvance()
+	require.Len(t, session.Queue, 2)
+
+	// Everyone finished, the next approved item is played
+	require.True(t, wpm.markParticipantCompleted(session, "host"))
+	wpm.checkQueueAutoAdvance()
+	require.Len(t, session.Queue, 1)
+	require.Equal(t, 3, session.Queue[0].EpisodeNumber)
+	require.True(t, wpm.queueAdvancing)
+	require.True(t, wpm.history.entry.Episodes[0].Completed)
+
+	// The flags are reset when the next episode starts
+	wpm.resetQueueCompletion(session)
+	require.False(t, wpm.queueAdvancing)
+	require.False(t, session.Participants["host"].HasCompleted)
+	require.False(t, session.Participants["peer1"].HasCompleted)
+
+	require.NoError(t, wpm.RemoveQueueItem(session.Queue[0].ID))
+	require.Empty(t, session.Queue)
+}
+
+func TestIsPlaybackCompleted(t *testing.T) {
+	require.False(t, isPlaybackCompleted(nil))
+	require.False(t, isPlaybackCompleted(&WatchPartyPlaybackStatus{CurrentTime: 10, Duration: 0}))
+	require.False(t, isPlaybackCompleted(&WatchPartyPlaybackStatus{CurrentTime: 1000, Duration: 1440}))
+	require.True(t, isPlaybackCompleted(&WatchPartyPlaybackStatus{CurrentTime: 1380, Duration: 1440}))
+}
+
+func TestWatchPartyHistory(t *testing.T) {
+	m, _ := newTestHostWatchParty(t)
+	wpm := m.watchPartyManager
+
+	recorder := newWatchPartyHistoryRecorder("session")
+	recorder.addParticipant("host", "host", true)
+	recorder.addParticipant("peer1", "peer", false)
+	recorder.addParticipant("peer1", "peer", false)
+
+	// Sessions without episodes aren't saved
+	history, err := recorder.toModel()
+	require.NoError(t, err)
+	require.Nil(t, history)
+
+	recorder.addEpisode(&WatchPartySessionMediaInfo{MediaId: 21, EpisodeNumber: 1})
+	recorder.addEpisode(&WatchPartySessionMediaInfo{MediaId: 21, EpisodeNumber: 1})
+	recorder.markLastEpisodeCompleted()
+	recorder.addEpisode(&WatchPartySessionMediaInfo{MediaId: 21, EpisodeNumber: 2})
+	recorder.addChatMessage(&WatchPartyChatMessagePayload{PeerId: "peer1", Username: "peer", Message: "hi"})
+
+	wpm.saveHistory(recorder)
+
+	entries, err := m.GetWatchPartyHistory(t.Context())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "session", entries[0].SessionId)
+	require.Len(t, entries[0].Participants, 2)
+	require.Len(t, entries[0].Episodes, 2)
+	require.True(t, entries[0].Episodes[0].Completed)
+	require.False(t, entries[0].Episodes[1].Completed)
+	require.Len(t, entries[0].ChatLog, 1)
+	require.Equal(t, "hi", entries[0].ChatLog[0].Message)
+
+	// Later saves update the session
+	require.True(t, recorder.addEpisode(&WatchPartySessionMediaInfo{MediaId: 21, EpisodeNumber: 3}))
+	wpm.saveHistory(recorder)
+
+	entries, err = m.GetWatchPartyHistory(t.Context())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Len(t, entries[0].Episodes, 3)
+
+	require.NoError(t, m.DeleteWatchPartyHistory(entries[0].ID))
+	entries, err = m.GetWatchPartyHistory(t.Context())
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
@@ -0,0 +1,624 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"seanime/internal/api/anilist"
+	"seanime/internal/database/db"
+	"seanime/internal/database/models"
+	"seanime/internal/events"
+	hibikeonlinestream "seanime/internal/extension/hibike/onlinestream"
+	"seanime/internal/onlinestream"
+	"seanime/internal/util"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// DEVNOTE: Episodes are downloaded to a work directory in the cache, then moved to a library directory
+// as "<Title>/<Title> - <Episode>.<ext>" so that the next scan matches them like any other file.
+// The queue is stored in the database and the segments of HLS streams are kept until the episode is complete,
+// so downloads resume where they stopped after a restart.
+
+const (
+	StatusQueued      = "queued"
+	StatusDownloading = "downloading"
+	StatusCompleted   = "completed"
+	StatusFailed      = "failed"
+	StatusCancelled   = "cancelled"
+)
+
+var (
+	ErrNoLibraryPath = errors.New("onlinestream downloader: No library path set")
+	ErrNotFound      = errors.New("onlinestream downloader: Download not found")
+)
+
+type (
+	// SourceResolver resolves the video sources of an episode, implemented by onlinestream.Repository.
+	SourceResolver interface {
+		GetMedia(ctx context.Context, mId int) (*anilist.BaseAnime, error)
+		GetEpisodeSources(ctx context.Context, provider string, mId int, number int, dubbed bool, year int) (*onlinestream.EpisodeSource, error)
+	}
+
+	// Manager downloads online-stream episodes one at a time in a background worker.
+	Manager struct {
+		logger         *zerolog.Logger
+		database       *db.Database
+		wsEventManager events.WSEventManagerInterface
+		resolver       SourceResolver
+		workDir        string
+		httpClient     *http.Client
+		ffmpegPath     string
+
+		mu       sync.Mutex
+		queue    []uint
+		current  uint
+		cancel   context.CancelFunc
+		progress map[uint]*Progress
+		wakeCh   chan struct{}
+
+		progressSentAt time.Time
+	}
+
+	NewManagerOptions struct {
+		Logger         *zerolog.Logger
+		Database       *db.Database
+		WSEventManager events.WSEventManagerInterface
+		Resolver       SourceResolver
+		// WorkDir is the directory in which the episodes are downloaded before being moved to the library
+		WorkDir string
+	}
+
+	EnqueueOptions struct {
+		MediaId        int    `json:"mediaId"`
+		EpisodeNumbers []int  `json:"episodeNumbers"`
+		Provider       string `json:"provider"`
+		Dubbed         bool   `json:"dubbed"`
+		Quality        string `json:"quality"`
+		Server         string `json:"server"`
+		// Directory is the library directory in which the episodes are saved, defaults to the main library path
+		Directory string `json:"directory"`
+	}
+
+	// Progress is the progress of the episode being downloaded.
+	Progress struct {
+		// Segments of HLS streams
+		DownloadedSegments int `json:"downloadedSegments"`
+		TotalSegments      int `json:"totalSegments"`
+		// Bytes of MP4 files, TotalBytes is -1 if unknown
+		DownloadedBytes int64 `json:"downloadedBytes"`
+		TotalBytes      int64 `json:"totalBytes"`
+		// Step is "resolving", "downloading", "remuxing" or "moving"
+		Step string `json:"step"`
+	}
+
+	Download struct {
+		*models.OnlinestreamDownload
+		Progress *Progress `json:"progress,omitempty"`
+	}
+)
+
+func NewManager(opts *NewManagerOptions) *Manager {
+	return &Manager{
+		logger:         opts.Logger,
+		database:       opts.Database,
+		wsEventManager: opts.WSEventManager,
+		resolver:       opts.Resolver,
+		workDir:        opts.WorkDir,
+		httpClient:     &http.Client{},
+		ffmpegPath:     "ffmpeg",
+		queue:          make([]uint, 0),
+		progress:       make(map[uint]*Progress),
+		wakeCh:         make(chan struct{}, 1),
+	}
+}
+
+// SetFfmpegPath sets the ffmpeg binary used to remux HLS streams to MKV.
+func (m *Manager) SetFfmpegPath(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ffmpegPath = path
+}
+
+// Start resumes the unfinished downloads and starts the worker in a goroutine.
+func (m *Manager) Start() {
+	downloads, err := m.database.GetOnlinestreamDownloadsByStatus(StatusQueued, StatusDownloading)
+	if err != nil {
+		m.logger.Error().Err(err).Msg("onlinestream downloader: Failed to get unfinished downloads")
+	}
+
+	m.mu.Lock()
+	for _, d := range downloads {
+		m.queue = append(m.queue, d.ID)
+	}
+	m.mu.Unlock()
+
+	if len(downloads) > 0 {
+		m.logger.Info().Int("count", len(downloads)).Msg("onlinestream downloader: Resuming downloads")
+		m.wake()
+	}
+
+	go func() {
+		for range m.wakeCh {
+			m.processQueue()
+		}
+	}()
+}
+
+func (m *Manager) wake() {
+	select {
+	case m.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Enqueue queues the episodes. Episodes that are already queued are skipped.
+func (m *Manager) Enqueue(opts *EnqueueOptions) ([]*models.OnlinestreamDownload, error) {
+	if opts.Provider == "" {
+		return nil, errors.New("onlinestream downloader: No provider")
+	}
+
+	directory := opts.Directory
+	if directory == "" {
+		directory, _ = m.database.GetLibraryPathFromSettings()
+	}
+	if directory == "" {
+		return nil, ErrNoLibraryPath
+	}
+
+	existing, err := m.database.GetOnlinestreamDownloadsByStatus(StatusQueued, StatusDownloading)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*models.OnlinestreamDownload, 0, len(opts.EpisodeNumbers))
+	for _, episodeNumber := range opts.EpisodeNumbers {
+		if slices.ContainsFunc(existing, func(d *models.OnlinestreamDownload) bool {
+			return d.MediaId == opts.MediaId && d.EpisodeNumber == episodeNumber
+		}) {
+			continue
+		}
+
+		d := &models.OnlinestreamDownload{
+			MediaId:       opts.MediaId,
+			EpisodeNumber: episodeNumber,
+			Provider:      opts.Provider,
+			Dubbed:        opts.Dubbed,
+			Quality:       opts.Quality,
+			Server:        opts.Server,
+			Directory:     directory,
+			Status:        StatusQueued,
+		}
+		if err := m.database.SaveOnlinestreamDownload(d); err != nil {
+			return nil, err
+		}
+		ret = append(ret, d)
+	}
+
+	m.mu.Lock()
+	for _, d := range ret {
+		m.queue = append(m.queue, d.ID)
+	}
+	m.mu.Unlock()
+
+	if len(ret) > 0 {
+		m.logger.Debug().Int("mediaId", opts.MediaId).Int("count", len(ret)).Msg("onlinestream downloader: Episodes queued")
+		m.sendProgress()
+		m.wake()
+	}
+
+	return ret, nil
+}
+
+// GetDownloads returns all the downloads, with the progress of the one being downloaded.
+func (m *Manager) GetDownloads() ([]*Download, error) {
+	downloads, err := m.database.GetOnlinestreamDownloads()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret := make([]*Download, 0, len(downloads))
+	for _, d := range downloads {
+		item := &Download{OnlinestreamDownload: d}
+		if p, ok := m.progress[d.ID]; ok {
+			c := *p
+			item.Progress = &c
+		}
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
+
+// Cancel stops or dequeues the download and removes its partial files.
+func (m *Manager) Cancel(id uint) error {
+	d, err := m.database.GetOnlinestreamDownload(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	if d.Status != StatusQueued && d.Status != StatusDownloading {
+		return nil
+	}
+
+	m.mu.Lock()
+	m.queue = slices.DeleteFunc(m.queue, func(i uint) bool { return i == id })
+	isCurrent := m.current == id
+	if isCurrent && m.cancel != nil {
+		m.cancel()
+	}
+	m.mu.Unlock()
+
+	// The worker updates the status of the current download once it stops
+	if isCurrent {
+		return nil
+	}
+
+	d.Status = StatusCancelled
+	_ = os.RemoveAll(m.getJobDir(id))
+	if err := m.database.SaveOnlinestreamDownload(d); err != nil {
+		return err
+	}
+	m.sendProgress()
+	return nil
+}
+
+// Retry queues a failed or cancelled download again.
+// The segments downloaded by the previous attempt are reused.
+func (m *Manager) Retry(id uint) error {
+	d, err := m.database.GetOnlinestreamDownload(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	if d.Status != StatusFailed && d.Status != StatusCancelled {
+		return fmt.Errorf("onlinestream downloader: Download is %s", d.Status)
+	}
+
+	d.Status = StatusQueued
+	d.Error = ""
+	if err := m.database.SaveOnlinestreamDownload(d); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.queue = append(m.queue, id)
+	m.mu.Unlock()
+
+	m.sendProgress()
+	m.wake()
+	return nil
+}
+
+// Remove removes the download from the list, cancelling it if needed. The downloaded file is kept.
+func (m *Manager) Remove(id uint) error {
+	if err := m.Cancel(id); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	isCurrent := m.current == id
+	m.mu.Unlock()
+	if isCurrent {
+		return errors.New("onlinestream downloader: Download is stopping")
+	}
+
+	_ = os.RemoveAll(m.getJobDir(id))
+	if err := m.database.DeleteOnlinestreamDownload(id); err != nil {
+		return err
+	}
+	m.sendProgress()
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (m *Manager) processQueue() {
+	defer util.HandlePanicInModuleThen("onlinestream/downloader/processQueue", func() {})
+
+	for {
+		m.mu.Lock()
+		if len(m.queue) == 0 {
+			m.current = 0
+			m.mu.Unlock()
+			m.sendProgress()
+			return
+		}
+		id := m.queue[0]
+		m.queue = m.queue[1:]
+		m.current = id
+		ctx, cancel := context.WithCancel(context.Background())
+		m.cancel = cancel
+		m.progress[id] = &Progress{Step: "resolving", TotalBytes: -1}
+		m.mu.Unlock()
+
+		m.processJob(ctx, id)
+		cancel()
+
+		m.mu.Lock()
+		m.current = 0
+		m.cancel = nil
+		delete(m.progress, id)
+		m.mu.Unlock()
+		m.sendProgress()
+	}
+}
+
+func (m *Manager) processJob(ctx context.Context, id uint) {
+	d, err := m.database.GetOnlinestreamDownload(id)
+	if err != nil || (d.Status != StatusQueued && d.Status != StatusDownloading) {
+		return
+	}
+
+	d.Status = StatusDownloading
+	d.Error = ""
+	_ = m.database.SaveOnlinestreamDownload(d)
+	m.sendProgress()
+
+	m.logger.Info().Int("mediaId", d.MediaId).Int("episode", d.EpisodeNumber).Str("provider", d.Provider).Msg("onlinestream downloader: Downloading episode")
+
+	path, err := m.download(ctx, d)
+	switch {
+	case err == nil:
+		d.Status = StatusCompleted
+		d.Path = path
+		_ = os.RemoveAll(m.getJobDir(id))
+		m.logger.Info().Int("mediaId", d.MediaId).Int("episode", d.EpisodeNumber).Str("path", path).Msg("onlinestream downloader: Episode downloaded")
+		m.wsEventManager.SendEvent(events.SuccessToast, fmt.Sprintf("Episode %d downloaded", d.EpisodeNumber))
+	case ctx.Err() != nil:
+		d.Status = StatusCancelled
+		_ = os.RemoveAll(m.getJobDir(id))
+		m.logger.Debug().Int("mediaId", d.MediaId).Int("episode", d.EpisodeNumber).Msg("onlinestream downloader: Download cancelled")
+	default:
+		// The work directory is kept so that a retry resumes the download
+		d.Status = StatusFailed
+		d.Error = err.Error()
+		m.logger.Error().Err(err).Int("mediaId", d.MediaId).Int("episode", d.EpisodeNumber).Msg("onlinestream downloader: Failed to download episode")
+		m.wsEventManager.SendEvent(events.ErrorToast, fmt.Sprintf("Failed to download episode %d: %v", d.EpisodeNumber, err))
+	}
+
+	if err := m.database.SaveOnlinestreamDownload(d); err != nil {
+		m.logger.Error().Err(err).Msg("onlinestream downloader: Failed to save download")
+	}
+}
+
+// download downloads the episode and returns the path of the file in the library.
+func (m *Manager) download(ctx context.Context, d *models.OnlinestreamDownload) (string, error) {
+	media, err := m.resolver.GetMedia(ctx, d.MediaId)
+	if err != nil {
+		return "", fmt.Errorf("failed to get media: %w", err)
+	}
+
+	sources, err := m.resolver.GetEpisodeSources(ctx, d.Provider, d.MediaId, d.EpisodeNumber, d.Dubbed, media.GetStartYearSafe())
+	if err != nil {
+		return "", fmt.Errorf("failed to get episode sources: %w", err)
+	}
+	source := selectVideoSource(sources.VideoSources, d.Server, d.Quality)
+	if source == nil {
+		return "", onlinestream.ErrNoVideoSourceFound
+	}
+
+	title := util.SanitizeFilename(media.GetPreferredTitle())
+	if title == "" {
+		title = strconv.Itoa(d.MediaId)
+	}
+	basename := fmt.Sprintf("%s - %02d", title, d.EpisodeNumber)
+	destDir := filepath.Join(d.Directory, title)
+
+	jobDir := m.getJobDir(d.ID)
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		return "", err
+	}
+
+	m.setStep(d.ID, "downloading")
+
+	var videoPath string
+	if isHlsSource(source) {
+		videoPath, err = m.downloadHls(ctx, source.URL, source.Headers, d.Quality, jobDir, func(done int, total int) {
+			m.updateProgress(d.ID, func(p *Progress) {
+				p.DownloadedSegments = done
+				p.TotalSegments = total
+			})
+		})
+		if err != nil {
+			return "", err
+		}
+
+		m.setStep(d.ID, "remuxing")
+		videoPath = m.remux(ctx, videoPath)
+	} else {
+		videoPath = filepath.Join(jobDir, "video.mp4")
+		err = m.downloadFile(ctx, source.URL, source.Headers, videoPath, func(written int64, total int64) {
+			m.updateProgress(d.ID, func(p *Progress) {
+				p.DownloadedBytes = written
+				p.TotalBytes = total
+			})
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	m.setStep(d.ID, "moving")
+
+	dest := filepath.Join(destDir, basename+filepath.Ext(videoPath))
+	if err := util.MoveFile(videoPath, dest); err != nil {
+		return "", fmt.Errorf("failed to move file to library: %w", err)
+	}
+
+	// Subtitles are optional, the episode is kept if they can't be downloaded
+	for _, sub := range getSubtitleFiles(source.Subtitles, basename) {
+		data, err := m.fetchBytes(ctx, sub.url, source.Headers, 0, 0)
+		if err != nil {
+			m.logger.Warn().Err(err).Str("language", sub.language).Msg("onlinestream downloader: Failed to download subtitles")
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(destDir, sub.filename), data, 0644); err != nil {
+			m.logger.Warn().Err(err).Str("language", sub.language).Msg("onlinestream downloader: Failed to write subtitles")
+		}
+	}
+
+	return dest, nil
+}
+
+// remux remuxes the stream to MKV with ffmpeg without re-encoding.
+// The original file is returned if ffmpeg isn't available or fails, since MPEG-TS and fMP4 files can still be played.
+func (m *Manager) remux(ctx context.Context, input string) string {
+	m.mu.Lock()
+	ffmpegPath := m.ffmpegPath
+	m.mu.Unlock()
+
+	if ffmpegPath == "" {
+		return input
+	}
+	if _, err := exec.LookPath(ffmpegPath); err != nil {
+		m.logger.Debug().Str("ffmpegPath", ffmpegPath).Msg("onlinestream downloader: ffmpeg not found, skipping remux")
+		return input
+	}
+
+	output := strings.TrimSuffix(input, filepath.Ext(input)) + ".mkv"
+	_ = os.Remove(output)
+	cmd := util.NewCmdCtx(ctx, ffmpegPath, "-hide_banner", "-loglevel", "error", "-y",
+		"-i", input,
+		"-map", "0:v", "-map", "0:a?",
+		"-c", "copy",
+		output,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		m.logger.Warn().Err(err).Str("output", strings.TrimSpace(string(out))).Msg("onlinestream downloader: Failed to remux stream, keeping the original file")
+		_ = os.Remove(output)
+		return input
+	}
+
+	_ = os.Remove(input)
+	return output
+}
+
+func (m *Manager) getJobDir(id uint) string {
+	return filepath.Join(m.workDir, strconv.FormatUint(uint64(id), 10))
+}
+
+func (m *Manager) setStep(id uint, step string) {
+	m.updateProgress(id, func(p *Progress) { p.Step = step })
+	m.sendProgress()
+}
+
+// updateProgress updates the progress of the download and sends it at most once per second.
+func (m *Manager) updateProgress(id uint, f func(p *Progress)) {
+	m.mu.Lock()
+	p, ok := m.progress[id]
+	if ok {
+		f(p)
+	}
+	send := ok && time.Since(m.progressSentAt) > time.Second
+	if send {
+		m.progressSentAt = time.Now()
+	}
+	m.mu.Unlock()
+
+	if send {
+		m.sendProgress()
+	}
+}
+
+func (m *Manager) sendProgress() {
+	downloads, err := m.GetDownloads()
+	if err != nil {
+		return
+	}
+	m.wsEventManager.SendEvent(events.OnlinestreamDownloadProgress, downloads)
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func isHlsSource(source *onlinestream.VideoSource) bool {
+	if source.Type == hibikeonlinestream.VideoSourceM3U8 {
+		return true
+	}
+	return source.Type != hibikeonlinestream.VideoSourceMP4 && strings.Contains(strings.ToLower(source.URL), ".m3u8")
+}
+
+// selectVideoSource returns the source matching the server and quality.
+// If no source has the wanted quality, adaptive HLS sources are preferred since the variant is selected from the playlist.
+func selectVideoSource(sources []*onlinestream.VideoSource, server string, quality string) *onlinestream.VideoSource {
+	candidates := make([]*onlinestream.VideoSource, 0, len(sources))
+	for _, s := range sources {
+		if s != nil && s.URL != "" && (server == "" || strings.EqualFold(s.Server, server)) {
+			candidates = append(candidates, s)
+		}
+	}
+	if len(candidates) == 0 && server != "" {
+		return selectVideoSource(sources, "", quality)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	want := parseQualityHeight(quality)
+	heights := make([]int, len(candidates))
+	for i, s := range candidates {
+		heights[i] = parseQualityHeight(s.Quality)
+		if want > 0 && heights[i] == want {
+			return s
+		}
+	}
+	for i, s := range candidates {
+		if heights[i] == 0 && isHlsSource(s) {
+			return s
+		}
+	}
+	return candidates[pickByHeight(heights, want)]
+}
+
+type subtitleFile struct {
+	url      string
+	language string
+	filename string
+}
+
+// getSubtitleFiles returns the subtitle files to write beside the video, named "<basename>.<language>.<ext>".
+func getSubtitleFiles(subtitles []*onlinestream.Subtitle, basename string) []*subtitleFile {
+	ret := make([]*subtitleFile, 0, len(subtitles))
+	seen := make(map[string]int)
+	for _, sub := range subtitles {
+		if sub == nil || sub.URL == "" {
+			continue
+		}
+		language := util.SanitizeFilename(strings.ToLower(strings.TrimSpace(sub.Language)))
+		if language == "" {
+			language = "und"
+		}
+		ext := strings.ToLower(filepath.Ext(strings.SplitN(strings.SplitN(sub.URL, "?", 2)[0], "#", 2)[0]))
+		if ext != ".vtt" && ext != ".srt" && ext != ".ass" && ext != ".ssa" {
+			ext = ".vtt"
+		}
+
+		// Several tracks of the same language
+		seen[language]++
+		name := language
+		if n := seen[language]; n > 1 {
+			name = fmt.Sprintf("%s.%d", language, n)
+		}
+
+		ret = append(ret, &subtitleFile{
+			url:      sub.URL,
+			language: language,
+			filename: fmt.Sprintf("%s.%s%s", basename, name, ext),
+		})
+	}
+	return ret
+}
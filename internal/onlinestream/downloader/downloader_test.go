@@ -0,0 +1,194 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"seanime/internal/onlinestream"
+	"seanime/internal/util"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hibikeonlinestream "seanime/internal/extension/hibike/onlinestream"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	return NewManager(&NewManagerOptions{
+		Logger:  util.NewLogger(),
+		WorkDir: t.TempDir(),
+	})
+}
+
+func encryptSegment(t *testing.T, data []byte, key []byte, iv []byte) []byte {
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	data = append(data, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ret := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ret, data)
+	return ret
+}
+
+func TestDownloadHls(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	segments := [][]byte{[]byte("segment-one"), []byte("segment-two"), []byte("segment-three")}
+
+	var segmentRequests atomic.Int32
+	failSegment := atomic.Bool{}
+	failSegment.Store(true)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "#EXTM3U\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\n360/index.m3u8\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080\n1080/index.m3u8\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=1280x720\n720/index.m3u8\n")
+	})
+	mux.HandleFunc("/720/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:5\n"+
+			"#EXT-X-KEY:METHOD=AES-128,URI=\"/key\"\n"+
+			"#EXTINF:10.0,\nseg0.ts\n#EXTINF:10.0,\nseg1.ts\n#EXTINF:10.0,\nseg2.ts\n#EXT-X-ENDLIST\n")
+	})
+	mux.HandleFunc("/key", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != "https://provider.example" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write(key)
+	})
+	mux.HandleFunc("/720/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != "https://provider.example" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		i, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/720/seg"), ".ts"))
+		if err != nil || i >= len(segments) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		segmentRequests.Add(1)
+		// The last segment fails on the first attempt
+		if i == 2 && failSegment.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		iv, _ := parseIV("", uint64(5+i))
+		_, _ = w.Write(encryptSegment(t, append([]byte{}, segments[i]...), key, iv))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	m := newTestManager(t)
+	headers := map[string]string{"Referer": "https://provider.example"}
+	workDir := t.TempDir()
+
+	_, err := m.downloadHls(context.Background(), server.URL+"/master.m3u8", headers, "720p", workDir, nil)
+	require.Error(t, err)
+	require.Equal(t, int32(3), segmentRequests.Load())
+
+	// Resumed, only the failed segment is downloaded again
+	failSegment.Store(false)
+	var lastDone, lastTotal int
+	output, err := m.downloadHls(context.Background(), server.URL+"/master.m3u8", headers, "720p", workDir, func(done int, total int) {
+		lastDone, lastTotal = done, total
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(4), segmentRequests.Load())
+	require.Equal(t, 3, lastDone)
+	require.Equal(t, 3, lastTotal)
+	require.Equal(t, ".ts", filepath.Ext(output))
+
+	data, err := os.ReadFile(output)
+	require.NoError(t, err)
+	require.Equal(t, "segment-onesegment-twosegment-three", string(data))
+	require.NoDirExists(t, filepath.Join(workDir, "segments"))
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	m := newTestManager(t)
+	dest := filepath.Join(t.TempDir(), "video.mp4")
+
+	// Partial file of a previous attempt
+	require.NoError(t, os.WriteFile(dest+".part", content[:4000], 0644))
+
+	var lastWritten, lastTotal int64
+	err := m.downloadFile(context.Background(), server.URL+"/video.mp4", nil, dest, func(written int64, total int64) {
+		lastWritten, lastTotal = written, total
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), lastWritten)
+	require.Equal(t, int64(len(content)), lastTotal)
+
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+	require.NoFileExists(t, dest+".part")
+}
+
+func TestSelectVideoSource(t *testing.T) {
+	sources := []*onlinestream.VideoSource{
+		{Server: "vidstreaming", URL: "https://a/360.mp4", Quality: "360p", Type: hibikeonlinestream.VideoSourceMP4},
+		{Server: "vidstreaming", URL: "https://a/1080.mp4", Quality: "1080p", Type: hibikeonlinestream.VideoSourceMP4},
+		{Server: "gogocdn", URL: "https://b/master.m3u8", Quality: "auto", Type: hibikeonlinestream.VideoSourceM3U8},
+	}
+
+	require.Equal(t, "https://a/1080.mp4", selectVideoSource(sources, "", "1080p").URL)
+	// The adaptive stream is preferred when the quality isn't available
+	require.Equal(t, "https://b/master.m3u8", selectVideoSource(sources, "", "720p").URL)
+	require.Equal(t, "https://a/360.mp4", selectVideoSource(sources, "vidstreaming", "720p").URL)
+	require.Equal(t, "https://a/1080.mp4", selectVideoSource(sources, "vidstreaming", "").URL)
+	// Unknown server
+	require.Equal(t, "https://a/1080.mp4", selectVideoSource(sources, "other", "1080p").URL)
+	require.Nil(t, selectVideoSource(nil, "", ""))
+}
+
+func TestPickByHeight(t *testing.T) {
+	require.Equal(t, 2, pickByHeight([]int{0, 720, 1080}, 0))
+	require.Equal(t, 1, pickByHeight([]int{0, 720, 1080}, 900))
+	require.Equal(t, 0, pickByHeight([]int{1080, 2160}, 720))
+	require.Equal(t, 1, pickByHeight([]int{1080, 480}, 720))
+	require.Equal(t, 1080, parseQualityHeight("1920x1080"))
+	require.Equal(t, 720, parseQualityHeight("HD 720p"))
+	require.Equal(t, 0, parseQualityHeight("auto"))
+}
+
+func TestGetSubtitleFiles(t *testing.T) {
+	files := getSubtitleFiles([]*onlinestream.Subtitle{
+		{URL: "https://a/en.vtt?token=1", Language: "English"},
+		{URL: "https://a/en-signs.ass", Language: "English"},
+		{URL: "https://a/subs", Language: ""},
+	}, "Frieren - 01")
+
+	require.Len(t, files, 3)
+	require.Equal(t, "Frieren - 01.english.vtt", files[0].filename)
+	require.Equal(t, "Frieren - 01.english.2.ass", files[1].filename)
+	require.Equal(t, "Frieren - 01.und.vtt", files[2].filename)
+}
+
+func TestParseIV(t *testing.T) {
+	iv, err := parseIV("0x000102030405060708090A0B0C0D0E0F", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, iv)
+
+	iv, err = parseIV("", 258)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2}, iv)
+}
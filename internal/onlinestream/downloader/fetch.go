@@ -0,0 +1,257 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxAttempts    = 3
+	requestTimeout = 2 * time.Minute
+)
+
+var errNotRetryable = errors.New("not retryable")
+
+// newRequest creates a GET request with the headers required by the provider.
+func newRequest(ctx context.Context, u string, headers map[string]string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// fetchBytes downloads a small resource (playlist, key, segment, subtitle), retrying on network and server errors.
+// If limit is positive, only the given byte range is requested.
+func (m *Manager) fetchBytes(ctx context.Context, u string, headers map[string]string, offset int64, limit int64) (ret []byte, err error) {
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		ret, err = m.fetchBytesOnce(ctx, u, headers, offset, limit)
+		if err == nil || errors.Is(err, errNotRetryable) || ctx.Err() != nil {
+			break
+		}
+		m.logger.Trace().Err(err).Str("url", u).Int("attempt", attempt).Msg("onlinestream downloader: Request failed")
+		if !waitFor(ctx, time.Duration(attempt)*time.Second) {
+			return nil, ctx.Err()
+		}
+	}
+	return ret, err
+}
+
+func (m *Manager) fetchBytesOnce(ctx context.Context, u string, headers map[string]string, offset int64, limit int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := newRequest(ctx, u, headers)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNotRetryable, err)
+	}
+	if limit > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+limit-1))
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		err = fmt.Errorf("status %d", resp.StatusCode)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			err = fmt.Errorf("%w: %w", errNotRetryable, err)
+		}
+		return nil, err
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// The server ignored the range
+	if limit > 0 && resp.StatusCode == http.StatusOK && int64(len(data)) >= offset+limit {
+		data = data[offset : offset+limit]
+	}
+	return data, nil
+}
+
+// downloadFile downloads a file to dest, resuming from the partial file of a previous attempt if the server supports ranges.
+func (m *Manager) downloadFile(ctx context.Context, u string, headers map[string]string, dest string, onProgress func(written int64, total int64)) error {
+	if _, err := os.Stat(dest); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	tmp := dest + ".part"
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = m.downloadFileOnce(ctx, u, headers, tmp, onProgress)
+		if err == nil || errors.Is(err, errNotRetryable) || ctx.Err() != nil {
+			break
+		}
+		m.logger.Debug().Err(err).Str("url", u).Int("attempt", attempt).Msg("onlinestream downloader: Download interrupted")
+		if !waitFor(ctx, time.Duration(attempt)*time.Second) {
+			return ctx.Err()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+func (m *Manager) downloadFileOnce(ctx context.Context, u string, headers map[string]string, tmp string, onProgress func(written int64, total int64)) error {
+	var offset int64
+	if info, err := os.Stat(tmp); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := newRequest(ctx, u, headers)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNotRetryable, err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusOK:
+		// Start over if the server doesn't support ranges
+		offset = 0
+		flags |= os.O_TRUNC
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The partial file is already complete
+		return nil
+	default:
+		err = fmt.Errorf("status %d", resp.StatusCode)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			err = fmt.Errorf("%w: %w", errNotRetryable, err)
+		}
+		return err
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+
+	f, err := os.OpenFile(tmp, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNotRetryable, err)
+	}
+
+	written := offset
+	buf := make([]byte, 256*1024)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err = f.Write(buf[:n]); err != nil {
+				_ = f.Close()
+				return fmt.Errorf("%w: %w", errNotRetryable, err)
+			}
+			written += int64(n)
+			if onProgress != nil {
+				onProgress(written, total)
+			}
+		}
+		if readErr != nil {
+			if !errors.Is(readErr, io.EOF) {
+				err = readErr
+			}
+			break
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && total > 0 && written != total {
+		err = fmt.Errorf("incomplete download, %d of %d bytes", written, total)
+	}
+	return err
+}
+
+// resolveUrl resolves a playlist URI against the URL of the playlist.
+func resolveUrl(base string, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
+
+var qualityHeightRegex = regexp.MustCompile(`(?i)(\d{3,4})p|\d{3,4}x(\d{3,4})`)
+
+// parseQualityHeight returns the vertical resolution in a quality label or resolution (e.g. "1080p", "1920x1080"), or 0.
+func parseQualityHeight(s string) int {
+	match := qualityHeightRegex.FindStringSubmatch(s)
+	if match == nil {
+		return 0
+	}
+	h, _ := strconv.Atoi(match[1] + match[2])
+	return h
+}
+
+// pickByHeight returns the index of the item closest to the wanted height, without going over it unless nothing is lower.
+// The highest item is picked if no height is wanted. Items without a known height are picked last.
+func pickByHeight(heights []int, want int) int {
+	best := -1
+	for i, h := range heights {
+		if best == -1 {
+			best = i
+			continue
+		}
+		b := heights[best]
+		switch {
+		case want <= 0:
+			if h > b {
+				best = i
+			}
+		case h <= want && (b > want || h > b):
+			best = i
+		case h > want && b > want && h < b:
+			best = i
+		case b == 0 && h > 0:
+			best = i
+		}
+	}
+	return best
+}
+
+// waitFor sleeps for the given duration, returns false if the context is cancelled.
+func waitFor(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,393 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/5rahim/hls-m3u8/m3u8"
+)
+
+const (
+	segmentConcurrency = 4
+	hlsStateFilename   = "playlist.json"
+)
+
+type (
+	// hlsSegment is a media segment to download, with the key needed to decrypt it.
+	hlsSegment struct {
+		Index  int
+		URL    string
+		Offset int64
+		Limit  int64
+		// AES-128 key URL and IV, empty if the segment isn't encrypted
+		KeyURL string
+		IV     []byte
+	}
+
+	// hlsPlaylist is the resolved media playlist of the selected variant.
+	hlsPlaylist struct {
+		// Init is the media initialization section of fMP4 streams
+		Init     *hlsSegment
+		Segments []*hlsSegment
+	}
+
+	// hlsState is stored in the work directory to check that a resumed download uses the same playlist.
+	hlsState struct {
+		Segments int  `json:"segments"`
+		Init     bool `json:"init"`
+	}
+)
+
+// downloadHls downloads the segments of the stream in parallel and concatenates them into a single file.
+// Segments are kept in the work directory until the download is complete, so that an interrupted download can be resumed.
+// It returns the path of the concatenated file, a ".ts" file or a ".mp4" file for fMP4 streams.
+func (m *Manager) downloadHls(ctx context.Context, u string, headers map[string]string, quality string, workDir string, onProgress func(done int, total int)) (string, error) {
+	playlist, err := m.getHlsPlaylist(ctx, u, headers, quality)
+	if err != nil {
+		return "", err
+	}
+	if len(playlist.Segments) == 0 {
+		return "", errors.New("playlist has no segments")
+	}
+
+	ext := ".ts"
+	if playlist.Init != nil {
+		ext = ".mp4"
+	}
+	output := filepath.Join(workDir, "stream"+ext)
+	if _, err := os.Stat(output); err == nil {
+		return output, nil
+	}
+
+	segmentsDir := filepath.Join(workDir, "segments")
+	if err := prepareSegmentsDir(segmentsDir, &hlsState{Segments: len(playlist.Segments), Init: playlist.Init != nil}); err != nil {
+		return "", err
+	}
+
+	segments := playlist.Segments
+	if playlist.Init != nil {
+		segments = append([]*hlsSegment{playlist.Init}, segments...)
+	}
+
+	keys := &keyCache{m: m, headers: headers, keys: make(map[string][]byte)}
+
+	// Stop dispatching segments after an error, the segments being downloaded are completed so that they can be reused
+	dispatchCtx, stopDispatch := context.WithCancel(ctx)
+	defer stopDispatch()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		done     atomic.Int64
+		jobs     = make(chan *hlsSegment)
+	)
+
+	for range segmentConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for seg := range jobs {
+				if err := m.downloadSegment(ctx, seg, headers, keys, segmentPath(segmentsDir, seg.Index)); err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("segment %d: %w", seg.Index, err)
+						stopDispatch()
+					})
+					continue
+				}
+				if onProgress != nil {
+					onProgress(int(done.Add(1)), len(segments))
+				}
+			}
+		}()
+	}
+
+loop:
+	for _, seg := range segments {
+		select {
+		case jobs <- seg:
+		case <-dispatchCtx.Done():
+			break loop
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return "", firstErr
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	if err := concatSegments(segmentsDir, segments, output); err != nil {
+		return "", err
+	}
+	_ = os.RemoveAll(segmentsDir)
+
+	return output, nil
+}
+
+// getHlsPlaylist fetches the playlist and returns the media playlist of the variant matching the quality.
+func (m *Manager) getHlsPlaylist(ctx context.Context, u string, headers map[string]string, quality string) (*hlsPlaylist, error) {
+	data, err := m.fetchBytes(ctx, u, headers, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch playlist: %w", err)
+	}
+
+	playlist, listType, err := m3u8.Decode(*bytes.NewBuffer(data), false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode playlist: %w", err)
+	}
+
+	if listType == m3u8.MASTER {
+		variantUrl, err := selectVariant(playlist.(*m3u8.MasterPlaylist), u, quality)
+		if err != nil {
+			return nil, err
+		}
+		m.logger.Debug().Str("variant", variantUrl).Msg("onlinestream downloader: Selected variant")
+		return m.getHlsPlaylist(ctx, variantUrl, headers, "")
+	}
+
+	return newHlsPlaylist(playlist.(*m3u8.MediaPlaylist), u)
+}
+
+// selectVariant returns the URL of the variant closest to the quality, or of the best variant.
+func selectVariant(master *m3u8.MasterPlaylist, baseUrl string, quality string) (string, error) {
+	variants := make([]*m3u8.Variant, 0, len(master.Variants))
+	for _, v := range master.Variants {
+		if v != nil && !v.Iframe && v.URI != "" {
+			variants = append(variants, v)
+		}
+	}
+	if len(variants) == 0 {
+		return "", errors.New("playlist has no variants")
+	}
+
+	heights := make([]int, len(variants))
+	for i, v := range variants {
+		heights[i] = parseQualityHeight(v.Resolution)
+	}
+	idx := pickByHeight(heights, parseQualityHeight(quality))
+
+	// Use the bandwidth if the resolutions are unknown
+	if heights[idx] == 0 {
+		for i, v := range variants {
+			if v.Bandwidth > variants[idx].Bandwidth {
+				idx = i
+			}
+		}
+	}
+
+	return resolveUrl(baseUrl, variants[idx].URI)
+}
+
+func newHlsPlaylist(pl *m3u8.MediaPlaylist, baseUrl string) (*hlsPlaylist, error) {
+	ret := &hlsPlaylist{Segments: make([]*hlsSegment, 0)}
+
+	var key *m3u8.Key
+	if len(pl.Keys) > 0 {
+		key = &pl.Keys[0]
+	}
+
+	initMap := pl.Map
+	for i, seg := range pl.GetAllSegments() {
+		if seg == nil {
+			continue
+		}
+		if len(seg.Keys) > 0 {
+			key = &seg.Keys[0]
+		}
+		if initMap == nil && seg.Map != nil {
+			initMap = seg.Map
+		}
+
+		segUrl, err := resolveUrl(baseUrl, seg.URI)
+		if err != nil {
+			return nil, err
+		}
+		s := &hlsSegment{
+			Index:  len(ret.Segments) + 1,
+			URL:    segUrl,
+			Offset: seg.Offset,
+			Limit:  seg.Limit,
+		}
+
+		if key != nil && !strings.EqualFold(key.Method, "NONE") && key.Method != "" {
+			if !strings.EqualFold(key.Method, "AES-128") {
+				return nil, fmt.Errorf("unsupported encryption method %s", key.Method)
+			}
+			if s.KeyURL, err = resolveUrl(baseUrl, key.URI); err != nil {
+				return nil, err
+			}
+			if s.IV, err = parseIV(key.IV, pl.SeqNo+uint64(i)); err != nil {
+				return nil, err
+			}
+		}
+		ret.Segments = append(ret.Segments, s)
+	}
+
+	if initMap != nil && initMap.URI != "" {
+		initUrl, err := resolveUrl(baseUrl, initMap.URI)
+		if err != nil {
+			return nil, err
+		}
+		ret.Init = &hlsSegment{Index: 0, URL: initUrl, Offset: initMap.Offset, Limit: initMap.Limit}
+	}
+
+	return ret, nil
+}
+
+// parseIV returns the IV of the key, or the media sequence number of the segment if the key doesn't have one.
+func parseIV(iv string, seqNo uint64) ([]byte, error) {
+	if iv == "" {
+		ret := make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(ret[8:], seqNo)
+		return ret, nil
+	}
+	iv = strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X")
+	ret, err := hex.DecodeString(fmt.Sprintf("%032s", iv))
+	if err != nil || len(ret) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid IV %s", iv)
+	}
+	return ret, nil
+}
+
+func (m *Manager) downloadSegment(ctx context.Context, seg *hlsSegment, headers map[string]string, keys *keyCache, dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		return nil
+	}
+
+	data, err := m.fetchBytes(ctx, seg.URL, headers, seg.Offset, seg.Limit)
+	if err != nil {
+		return err
+	}
+
+	if seg.KeyURL != "" {
+		key, err := keys.get(ctx, seg.KeyURL)
+		if err != nil {
+			return err
+		}
+		if data, err = decryptSegment(data, key, seg.IV); err != nil {
+			return err
+		}
+	}
+
+	tmp := dest + ".part"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// decryptSegment decrypts an AES-128 segment and removes its PKCS#7 padding.
+func decryptSegment(data []byte, key []byte, iv []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("encrypted segment is not a multiple of the block size")
+	}
+	ret := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(ret, data)
+
+	padding := int(ret[len(ret)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(ret) {
+		return nil, errors.New("invalid padding, wrong key")
+	}
+	return ret[:len(ret)-padding], nil
+}
+
+type keyCache struct {
+	m       *Manager
+	headers map[string]string
+	mu      sync.Mutex
+	keys    map[string][]byte
+}
+
+func (c *keyCache) get(ctx context.Context, u string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[u]; ok {
+		return key, nil
+	}
+	key, err := c.m.fetchBytes(ctx, u, c.headers, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch key: %w", err)
+	}
+	if len(key) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid key length %d", len(key))
+	}
+	c.keys[u] = key
+	return key, nil
+}
+
+// prepareSegmentsDir creates the directory of the segments.
+// Segments of a previous attempt are removed if the playlist changed.
+func prepareSegmentsDir(dir string, state *hlsState) error {
+	statePath := filepath.Join(dir, hlsStateFilename)
+	if data, err := os.ReadFile(statePath); err == nil {
+		var previous hlsState
+		if json.Unmarshal(data, &previous) == nil && previous == *state {
+			return nil
+		}
+	}
+
+	_ = os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, _ := json.Marshal(state)
+	return os.WriteFile(statePath, data, 0644)
+}
+
+func segmentPath(dir string, index int) string {
+	return filepath.Join(dir, fmt.Sprintf("%05d.seg", index))
+}
+
+func concatSegments(dir string, segments []*hlsSegment, output string) error {
+	tmp := output + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	for _, seg := range segments {
+		if err = appendFile(out, segmentPath(dir, seg.Index)); err != nil {
+			break
+		}
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to concatenate segments: %w", err)
+	}
+	return os.Rename(tmp, output)
+}
+
+func appendFile(out io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(out, f)
+	return err
+}
@@ -0,0 +1,309 @@
+package onlinestream
+
+import (
+	"cmp"
+	"errors"
+	"seanime/internal/extension"
+	hibikeonlinestream "seanime/internal/extension/hibike/onlinestream"
+	"seanime/internal/util"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ProviderHealthy  ProviderHealthStatus = "healthy"
+	ProviderDegraded ProviderHealthStatus = "degraded"
+	ProviderDown     ProviderHealthStatus = "down"
+	ProviderUnknown  ProviderHealthStatus = "unknown"
+)
+
+const (
+	// healthCheckInterval is the time between two probes of the providers
+	healthCheckInterval = 30 * time.Minute
+	// healthCheckTimeout is the time after which a probe is considered failed
+	healthCheckTimeout = 30 * time.Second
+	// healthSampleSize is the number of recent requests used to compute the error rate and latency
+	healthSampleSize = 20
+	// downAfterFailures is the number of consecutive failures after which a provider is considered down
+	downAfterFailures = 3
+	// maxFallbackProviders is the number of providers tried after the requested one fails
+	maxFallbackProviders = 2
+	// canaryQuery is searched to probe the providers, it should be available on every provider
+	canaryQuery = "One Piece"
+)
+
+var ErrHealthCheckTimeout = errors.New("provider did not respond in time")
+
+type (
+	ProviderHealthStatus string
+
+	// ProviderHealth is the health of an online-stream provider, computed from the probes and the recent requests.
+	ProviderHealth struct {
+		Provider string               `json:"provider"`
+		Name     string               `json:"name"`
+		Status   ProviderHealthStatus `json:"status"`
+		// Rank is the position of the provider when falling back, starting at 1
+		Rank int `json:"rank"`
+		// LatencyMs is the average latency of the recent successful requests
+		LatencyMs int64 `json:"latencyMs"`
+		// ErrorRate is the ratio of failed requests among the recent ones
+		ErrorRate           float64    `json:"errorRate"`
+		Requests            int        `json:"requests"`
+		ConsecutiveFailures int        `json:"consecutiveFailures"`
+		LastError           string     `json:"lastError,omitempty"`
+		LastCheckedAt       *time.Time `json:"lastCheckedAt,omitempty"`
+	}
+
+	healthMonitor struct {
+		mu       sync.Mutex
+		records  map[string]*healthRecord
+		enabled  atomic.Bool
+		checking atomic.Bool
+	}
+
+	healthRecord struct {
+		samples             []healthSample
+		consecutiveFailures int
+		lastError           string
+		lastCheckedAt       time.Time
+	}
+
+	healthSample struct {
+		ok      bool
+		latency time.Duration
+	}
+)
+
+func newHealthMonitor() *healthMonitor {
+	return &healthMonitor{
+		records: make(map[string]*healthRecord),
+	}
+}
+
+// record adds the outcome of a request made to the provider.
+func (h *healthMonitor) record(provider string, latency time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rec, ok := h.records[provider]
+	if !ok {
+		rec = &healthRecord{}
+		h.records[provider] = rec
+	}
+
+	rec.samples = append(rec.samples, healthSample{ok: err == nil, latency: latency})
+	if len(rec.samples) > healthSampleSize {
+		rec.samples = rec.samples[len(rec.samples)-healthSampleSize:]
+	}
+	rec.lastCheckedAt = time.Now()
+	if err != nil {
+		rec.consecutiveFailures++
+		rec.lastError = err.Error()
+	} else {
+		rec.consecutiveFailures = 0
+		rec.lastError = ""
+	}
+}
+
+// get returns the health of the provider, without its rank.
+func (h *healthMonitor) get(provider string) *ProviderHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ret := &ProviderHealth{
+		Provider: provider,
+		Status:   ProviderUnknown,
+	}
+
+	rec, ok := h.records[provider]
+	if !ok || len(rec.samples) == 0 {
+		return ret
+	}
+
+	var failures, successes int
+	var latency time.Duration
+	for _, s := range rec.samples {
+		if s.ok {
+			successes++
+			latency += s.latency
+		} else {
+			failures++
+		}
+	}
+
+	lastCheckedAt := rec.lastCheckedAt
+	ret.Requests = len(rec.samples)
+	ret.ErrorRate = float64(failures) / float64(len(rec.samples))
+	ret.ConsecutiveFailures = rec.consecutiveFailures
+	ret.LastError = rec.lastError
+	ret.LastCheckedAt = &lastCheckedAt
+	if successes > 0 {
+		ret.LatencyMs = (latency / time.Duration(successes)).Milliseconds()
+	}
+
+	switch {
+	case rec.consecutiveFailures >= downAfterFailures:
+		ret.Status = ProviderDown
+	case rec.consecutiveFailures > 0 || ret.ErrorRate >= 0.5:
+		ret.Status = ProviderDegraded
+	default:
+		ret.Status = ProviderHealthy
+	}
+
+	return ret
+}
+
+// rankProviderHealth sorts the providers from the most to the least reliable and sets their rank.
+func rankProviderHealth(health []*ProviderHealth) {
+	statusOrder := map[ProviderHealthStatus]int{
+		ProviderHealthy:  0,
+		ProviderDegraded: 1,
+		ProviderUnknown:  2,
+		ProviderDown:     3,
+	}
+	slices.SortStableFunc(health, func(a, b *ProviderHealth) int {
+		return cmp.Or(
+			cmp.Compare(statusOrder[a.Status], statusOrder[b.Status]),
+			cmp.Compare(a.ErrorRate, b.ErrorRate),
+			cmp.Compare(a.LatencyMs, b.LatencyMs),
+			cmp.Compare(a.Provider, b.Provider),
+		)
+	})
+	for i, p := range health {
+		p.Rank = i + 1
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// SetHealthChecksEnabled enables the periodic probes of the providers, they're disabled when online streaming is.
+func (r *Repository) SetHealthChecksEnabled(enabled bool) {
+	r.health.enabled.Store(enabled)
+}
+
+// StartHealthChecks probes the providers periodically.
+func (r *Repository) StartHealthChecks() {
+	go func() {
+		// Wait for the extensions to be loaded
+		time.Sleep(time.Minute)
+
+		ticker := time.NewTicker(healthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			if r.health.enabled.Load() {
+				r.CheckProvidersHealth()
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// CheckProvidersHealth probes every installed provider with a canary search and returns their health.
+func (r *Repository) CheckProvidersHealth() []*ProviderHealth {
+	if !r.health.checking.CompareAndSwap(false, true) {
+		return r.GetProvidersHealth()
+	}
+	defer r.health.checking.Store(false)
+
+	r.logger.Debug().Msg("onlinestream: Checking providers health")
+
+	var wg sync.WaitGroup
+	extension.RangeExtensions(r.extensionBankRef.Get(), func(id string, ext extension.OnlinestreamProviderExtension) bool {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := probeProvider(ext.GetProvider())
+			r.health.record(id, time.Since(start), err)
+			if err != nil {
+				r.logger.Warn().Err(err).Str("provider", id).Msg("onlinestream: Provider health check failed")
+			}
+		}()
+		return true
+	})
+	wg.Wait()
+
+	return r.GetProvidersHealth()
+}
+
+// GetProvidersHealth returns the health of the installed providers, ranked from the most to the least reliable.
+func (r *Repository) GetProvidersHealth() []*ProviderHealth {
+	ret := make([]*ProviderHealth, 0)
+	extension.RangeExtensions(r.extensionBankRef.Get(), func(id string, ext extension.OnlinestreamProviderExtension) bool {
+		h := r.health.get(id)
+		h.Name = ext.GetName()
+		ret = append(ret, h)
+		return true
+	})
+	rankProviderHealth(ret)
+	return ret
+}
+
+// probeProvider searches the canary query. The provider is considered healthy if it returns results in time.
+func probeProvider(provider hibikeonlinestream.Provider) error {
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		defer func() { done <- err }()
+		defer util.HandlePanicInModuleWithError("onlinestream/probeProvider", &err)
+
+		var res []*hibikeonlinestream.SearchResult
+		res, err = provider.Search(hibikeonlinestream.SearchOptions{Query: canaryQuery})
+		if err == nil && len(res) == 0 {
+			err = errors.New("search returned no results")
+		}
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(healthCheckTimeout):
+		return ErrHealthCheckTimeout
+	}
+}
+
+// getFallbackProviders returns the healthy providers to try after the given provider failed, from the most reliable.
+// Providers that don't support dubs are skipped if dubbed is true.
+func (r *Repository) getFallbackProviders(provider string, dubbed bool) []string {
+	ret := make([]string, 0, maxFallbackProviders)
+	for _, h := range r.GetProvidersHealth() {
+		if len(ret) == maxFallbackProviders {
+			break
+		}
+		if h.Provider == provider || h.Status != ProviderHealthy {
+			continue
+		}
+		if dubbed {
+			ext, ok := extension.GetExtension[extension.OnlinestreamProviderExtension](r.extensionBankRef.Get(), h.Provider)
+			if !ok || !ext.GetProvider().GetSettings().SupportsDub {
+				continue
+			}
+		}
+		ret = append(ret, h.Provider)
+	}
+	return ret
+}
+
+// withFallback calls f with the provider, then with the fallback providers if it fails.
+// It returns the provider that succeeded.
+func withFallback[T any](r *Repository, provider string, dubbed bool, f func(provider string) (T, error)) (ret T, usedProvider string, err error) {
+	ret, err = f(provider)
+	if err == nil {
+		return ret, provider, nil
+	}
+
+	for _, fallback := range r.getFallbackProviders(provider, dubbed) {
+		r.logger.Warn().Err(err).Str("provider", provider).Str("fallback", fallback).Msg("onlinestream: Provider failed, falling back")
+
+		res, fallbackErr := f(fallback)
+		if fallbackErr == nil {
+			return res, fallback, nil
+		}
+		r.logger.Debug().Err(fallbackErr).Str("provider", fallback).Msg("onlinestream: Fallback provider failed")
+	}
+
+	return ret, provider, err
+}
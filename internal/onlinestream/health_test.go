@@ -0,0 +1,135 @@
+package onlinestream
+
+import (
+	"errors"
+	"seanime/internal/extension"
+	hibikeonlinestream "seanime/internal/extension/hibike/onlinestream"
+	"seanime/internal/util"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	searchErr   error
+	supportsDub bool
+}
+
+func (p *fakeProvider) Search(opts hibikeonlinestream.SearchOptions) ([]*hibikeonlinestream.SearchResult, error) {
+	if p.searchErr != nil {
+		return nil, p.searchErr
+	}
+	return []*hibikeonlinestream.SearchResult{{ID: "one-piece", Title: opts.Query}}, nil
+}
+
+func (p *fakeProvider) FindEpisodes(id string) ([]*hibikeonlinestream.EpisodeDetails, error) {
+	return nil, nil
+}
+
+func (p *fakeProvider) FindEpisodeServer(episode *hibikeonlinestream.EpisodeDetails, server string) (*hibikeonlinestream.EpisodeServer, error) {
+	return nil, nil
+}
+
+func (p *fakeProvider) GetSettings() hibikeonlinestream.Settings {
+	return hibikeonlinestream.Settings{SupportsDub: p.supportsDub}
+}
+
+func newHealthTestRepository(providers map[string]*fakeProvider) *Repository {
+	bank := extension.NewUnifiedBank()
+	for id, p := range providers {
+		bank.Set(id, extension.NewOnlinestreamProviderExtension(&extension.Extension{ID: id, Name: id}, p))
+	}
+	return NewRepository(&NewRepositoryOptions{
+		Logger:           util.NewLogger(),
+		ExtensionBankRef: util.NewRef(bank),
+	})
+}
+
+func TestProviderHealthStatus(t *testing.T) {
+	h := newHealthMonitor()
+
+	require.Equal(t, ProviderUnknown, h.get("a").Status)
+
+	h.record("a", 100*time.Millisecond, nil)
+	h.record("a", 300*time.Millisecond, nil)
+	health := h.get("a")
+	require.Equal(t, ProviderHealthy, health.Status)
+	require.Equal(t, int64(200), health.LatencyMs)
+	require.Equal(t, 0.0, health.ErrorRate)
+
+	h.record("a", time.Second, errors.New("timeout"))
+	health = h.get("a")
+	require.Equal(t, ProviderDegraded, health.Status)
+	require.Equal(t, "timeout", health.LastError)
+	require.InDelta(t, 1.0/3, health.ErrorRate, 0.001)
+
+	h.record("a", time.Second, errors.New("timeout"))
+	h.record("a", time.Second, errors.New("timeout"))
+	require.Equal(t, ProviderDown, h.get("a").Status)
+
+	// Recovers after a success
+	h.record("a", 100*time.Millisecond, nil)
+	require.Equal(t, ProviderDegraded, h.get("a").Status)
+
+	for range healthSampleSize {
+		h.record("a", 100*time.Millisecond, nil)
+	}
+	health = h.get("a")
+	require.Equal(t, ProviderHealthy, health.Status)
+	require.Equal(t, healthSampleSize, health.Requests)
+}
+
+func TestCheckProvidersHealth(t *testing.T) {
+	repo := newHealthTestRepository(map[string]*fakeProvider{
+		"broken": {searchErr: errors.New("cloudflare")},
+		"slow":   {},
+		"fast":   {},
+	})
+	repo.health.record("slow", 5*time.Second, nil)
+
+	health := repo.CheckProvidersHealth()
+	require.Len(t, health, 3)
+
+	require.Equal(t, "fast", health[0].Provider)
+	require.Equal(t, 1, health[0].Rank)
+	require.Equal(t, "slow", health[1].Provider)
+	require.Equal(t, "broken", health[2].Provider)
+	require.Equal(t, ProviderDegraded, health[2].Status)
+	require.Equal(t, "cloudflare", health[2].LastError)
+}
+
+func TestWithFallback(t *testing.T) {
+	repo := newHealthTestRepository(map[string]*fakeProvider{
+		"a":      {supportsDub: true},
+		"b":      {supportsDub: true},
+		"sub":    {},
+		"broken": {searchErr: errors.New("cloudflare")},
+	})
+	repo.CheckProvidersHealth()
+	repo.health.record("b", time.Second, nil)
+
+	var tried []string
+	res, provider, err := withFallback(repo, "a", true, func(provider string) (string, error) {
+		tried = append(tried, provider)
+		if provider == "a" {
+			return "", errors.New("no episodes found")
+		}
+		return "episodes from " + provider, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "b", provider)
+	require.Equal(t, "episodes from b", res)
+	// The provider without dubs isn't tried
+	require.Equal(t, []string{"a", "b"}, tried)
+
+	// Unhealthy providers aren't tried
+	tried = nil
+	_, provider, err = withFallback(repo, "sub", false, func(provider string) (string, error) {
+		tried = append(tried, provider)
+		return "", errors.New("no episodes found")
+	})
+	require.Error(t, err)
+	require.Equal(t, "sub", provider)
+	require.Equal(t, []string{"sub", "a", "b"}, tried)
+}
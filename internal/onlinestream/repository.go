@@ -30,6 +30,7 @@ type (
 		platformRef           *util.Ref[platform.Platform]
 		anilistBaseAnimeCache *anilist.BaseAnimeCache
 		db                    *db.Database
+		health                *healthMonitor
 	}
 )
 
@@ -50,6 +51,8 @@ type (
 	EpisodeSource struct {
 		Number       int            `json:"number"`
 		VideoSources []*VideoSource `json:"videoSources"`
+		// Provider is the provider of the sources, it differs from the requested provider if it failed
+		Provider string `json:"provider"`
 	}
 
 	VideoSource struct {
@@ -65,6 +68,8 @@ type (
 	EpisodeListResponse struct {
 		Episodes []*Episode         `json:"episodes"`
 		Media    *anilist.BaseAnime `json:"media"`
+		// Provider is the provider of the episodes, it differs from the requested provider if it failed
+		Provider string `json:"provider,omitempty"`
 	}
 
 	Subtitle struct {
@@ -93,6 +98,7 @@ func NewRepository(opts *NewRepositoryOptions) *Repository {
 		anilistBaseAnimeCache: anilist.NewBaseAnimeCache(),
 		platformRef:           opts.PlatformRef,
 		db:                    opts.Database,
+		health:                newHealthMonitor(),
 	}
 }
 
@@ -143,11 +149,13 @@ func (r *Repository) EmptyCache(mediaId int) error {
 	return nil
 }
 
-func (r *Repository) GetMediaEpisodes(provider string, media *anilist.BaseAnime, dubbed bool) ([]*Episode, error) {
+// GetMediaEpisodes returns the episode list of the media from the provider, or from the most reliable provider if it fails.
+// It returns the provider of the episodes.
+func (r *Repository) GetMediaEpisodes(provider string, media *anilist.BaseAnime, dubbed bool) ([]*Episode, string, error) {
 	episodes := make([]*Episode, 0)
 
 	if provider == "" {
-		return episodes, nil
+		return episodes, provider, nil
 	}
 
 	// +---------------------+
@@ -172,9 +180,11 @@ func (r *Repository) GetMediaEpisodes(provider string, media *anilist.BaseAnime,
 
 	// Fetch the episode list from the provider
 	// "from" and "to" are set to 0 in order not to fetch episode servers
-	ec, err := r.getEpisodeContainer(provider, media, 0, 0, dubbed, media.GetStartYearSafe())
+	ec, provider, err := withFallback(r, provider, dubbed, func(provider string) (*episodeContainer, error) {
+		return r.getEpisodeContainer(provider, media, 0, 0, dubbed, media.GetStartYearSafe())
+	})
 	if err != nil {
-		return nil, err
+		return nil, provider, err
 	}
 
 	for _, episodeDetails := range ec.ProviderEpisodeList {
@@ -226,9 +236,10 @@ func (r *Repository) GetMediaEpisodes(provider string, media *anilist.BaseAnime,
 		return item != nil
 	})
 
-	return episodes, nil
+	return episodes, provider, nil
 }
 
+// GetEpisodeSources returns the video sources of the episode from the provider, or from the most reliable provider if it fails.
 func (r *Repository) GetEpisodeSources(ctx context.Context, provider string, mId int, number int, dubbed bool, year int) (*EpisodeSource, error) {
 
 	// +---------------------+
@@ -244,6 +255,17 @@ func (r *Repository) GetEpisodeSources(ctx context.Context, provider string, mId
 	// |   Episode servers   |
 	// +---------------------+
 
+	sources, _, err := withFallback(r, provider, dubbed, func(provider string) (*EpisodeSource, error) {
+		return r.getEpisodeSource(provider, media, number, dubbed, year)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sources, nil
+}
+
+func (r *Repository) getEpisodeSource(provider string, media *anilist.BaseAnime, number int, dubbed bool, year int) (*EpisodeSource, error) {
 	ec, err := r.getEpisodeContainer(provider, media, number, number, dubbed, year)
 	if err != nil {
 		return nil, err
@@ -255,6 +277,7 @@ func (r *Repository) GetEpisodeSources(ctx context.Context, provider string, mId
 			s := &EpisodeSource{
 				Number:       ep.Number,
 				VideoSources: make([]*VideoSource, 0),
+				Provider:     provider,
 			}
 			for _, es := range ep.Servers {
 
@@ -9,6 +9,7 @@ import (
 	onlinestream_providers "seanime/internal/onlinestream/providers"
 	"seanime/internal/util/comparison"
 	"strings"
+	"time"
 )
 
 var (
@@ -182,6 +183,7 @@ func (r *Repository) getProviderEpisodeServers(provider string, episodeDetails *
 		return nil, fmt.Errorf("provider extension '%s' not found", provider)
 	}
 
+	start := time.Now()
 	for _, episodeServer := range providerExtension.GetProvider().GetSettings().EpisodeServers {
 		res, err := providerExtension.GetProvider().FindEpisodeServer(episodeDetails, episodeServer)
 		if err == nil {
@@ -191,8 +193,10 @@ func (r *Repository) getProviderEpisodeServers(provider string, episodeDetails *
 	}
 
 	if len(providerServers) == 0 {
+		r.health.record(provider, time.Since(start), errNoEpisodeSourceFound)
 		return nil, errNoEpisodeSourceFound
 	}
+	r.health.record(provider, time.Since(start), nil)
 
 	return providerServers, nil
 }
@@ -311,7 +315,9 @@ func (r *Repository) getProviderEpisodeList(provider string, media *anilist.Base
 	}
 
 	// Fetch episodes.
+	start := time.Now()
 	ret, err := providerExtension.GetProvider().FindEpisodes(matchId)
+	r.health.record(provider, time.Since(start), err)
 	if err != nil {
 		return nil, fmt.Errorf("provider returned an error: %w", err)
 	}
@@ -256,6 +256,7 @@ func (c *CacheLayer) CustomQuery(body []byte, logger *zerolog.Logger, token ...s
 		c.checkAndUpdateWorkingState(err)
 
 		if err == nil {
+			cacheRequestsCounter.With(CustomQueryBucket, cacheResultNetwork).Inc()
 			go func() {
 				if !ShouldCache.Load() {
 					return
@@ -294,11 +295,14 @@ func (c *CacheLayer) CustomQuery(body []byte, logger *zerolog.Logger, token ...s
 	var cached interface{}
 	found, err := c.fileCacher.GetPerm(bucket, cacheKey, &cached)
 	if err != nil {
+		cacheRequestsCounter.With(CustomQueryBucket, cacheResultMiss).Inc()
 		return nil, fmt.Errorf("cache lookup failed: %w", err)
 	}
 	if !found {
+		cacheRequestsCounter.With(CustomQueryBucket, cacheResultMiss).Inc()
 		return nil, fmt.Errorf("no cached data available")
 	}
+	cacheRequestsCounter.With(CustomQueryBucket, cacheResultHit).Inc()
 
 	c.logger.Debug().Str("bucket", CustomQueryBucket).Str("key", cacheKey).Msg("anilist cache: Serving custom query from cache")
 	return cached, nil
@@ -459,6 +463,7 @@ func networkFirstGet[T any](c *CacheLayer, bucketName string, cacheKey string, n
 		c.checkAndUpdateWorkingState(err)
 
 		if err == nil && result != nil {
+			cacheRequestsCounter.With(bucketName, cacheResultNetwork).Inc()
 			// Cache the successful result
 			if err := c.fileCacher.SetPerm(bucket, cacheKey, result); err != nil {
 				c.logger.Warn().Err(err).Msg("anilist cache: Failed to cache result")
@@ -483,11 +488,14 @@ func networkFirstGet[T any](c *CacheLayer, bucketName string, cacheKey string, n
 	var cached T
 	found, err := c.fileCacher.GetPerm(bucket, cacheKey, &cached)
 	if err != nil {
+		cacheRequestsCounter.With(bucketName, cacheResultMiss).Inc()
 		return nil, fmt.Errorf("cache lookup failed: %w", err)
 	}
 	if !found {
+		cacheRequestsCounter.With(bucketName, cacheResultMiss).Inc()
 		return nil, fmt.Errorf("no cached data available")
 	}
+	cacheRequestsCounter.With(bucketName, cacheResultHit).Inc()
 
 	c.logger.Debug().Str("bucket", bucketName).Str("key", cacheKey).Msg("anilist cache: Serving from cache")
 	return &cached, nil
@@ -718,6 +726,7 @@ func networkFirstGetWithBoundedCache[T any](c *CacheLayer, bucketName string, ca
 		c.checkAndUpdateWorkingState(err)
 
 		if err == nil && result != nil {
+			cacheRequestsCounter.With(bucketName, cacheResultNetwork).Inc()
 			// Cache the successful result with bounded size
 			go func() {
 				// For list/search results, always apply bounded caching
@@ -755,11 +764,14 @@ func networkFirstGetWithBoundedCache[T any](c *CacheLayer, bucketName string, ca
 	var cached T
 	found, err := c.fileCacher.GetPerm(bucket, cacheKey, &cached)
 	if err != nil {
+		cacheRequestsCounter.With(bucketName, cacheResultMiss).Inc()
 		return nil, fmt.Errorf("cache lookup failed: %w", err)
 	}
 	if !found {
+		cacheRequestsCounter.With(bucketName, cacheResultMiss).Inc()
 		return nil, fmt.Errorf("no cached data available")
 	}
+	cacheRequestsCounter.With(bucketName, cacheResultHit).Inc()
 
 	c.logger.Debug().Str("bucket", bucketName).Str("key", cacheKey).Msg("anilist cache: Serving bounded result from cache")
 	return &cached, nil
@@ -0,0 +1,19 @@
+package shared_platform
+
+import (
+	"seanime/internal/metrics"
+)
+
+const (
+	cacheResultNetwork = "network"
+	cacheResultHit     = "hit"
+	cacheResultMiss    = "miss"
+)
+
+// cacheRequestsCounter counts the requests handled by the cache layer.
+// The cache layer is network-first, a hit means that the cached data was served because the AniList API failed or is unavailable.
+var cacheRequestsCounter = metrics.NewCounterVec(
+	"anilist_cache_requests_total",
+	"Number of AniList requests handled by the cache layer, by bucket and result.",
+	"bucket", "result",
+)
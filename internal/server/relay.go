@@ -0,0 +1,64 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"seanime/internal/core"
+	"seanime/internal/nakama/relay"
+	"seanime/internal/util"
+	"syscall"
+	"time"
+)
+
+// runRelay runs the Nakama rooms relay server until the process is interrupted.
+// The relay doesn't use the data directory, it only keeps the rooms in memory.
+func runRelay(flags core.SeanimeFlags) {
+	logger := util.NewLogger()
+
+	host := cmp.Or(flags.Host, "0.0.0.0")
+	port := cmp.Or(flags.Port, 43211)
+
+	relayServer := relay.NewServer(&relay.NewServerOptions{
+		Logger:    logger,
+		PublicURL: flags.RelayURL,
+		MaxRooms:  flags.RelayMaxRooms,
+		Password:  flags.RelayPassword,
+	})
+	relayServer.Start()
+
+	if flags.RelayPassword == "" {
+		logger.Warn().Msg("relay: Anyone can create rooms, use --relay-password to require a password")
+	}
+
+	// Same path as the Seanime Rooms API, so that clients can use https://<relay>/api/rooms
+	mux := http.NewServeMux()
+	mux.Handle("/api/rooms/", http.StripPrefix("/api/rooms", relayServer))
+	mux.Handle("/api/rooms", http.StripPrefix("/api/rooms", relayServer))
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", host, port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.Info().Str("address", srv.Addr).Msg("relay: Nakama rooms relay listening on /api/rooms")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal().Err(err).Msg("relay: Failed to start the server")
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	<-sigCh
+
+	logger.Info().Msg("relay: Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = srv.Shutdown(ctx)
+}
@@ -24,6 +24,12 @@ func startApp(embeddedLogo []byte) (*core.App, core.SeanimeFlags, *updater.SelfU
 	// Get the flags
 	flags := core.GetSeanimeFlags()
 
+	// Run the Nakama rooms relay instead of the app
+	if flags.Relay {
+		runRelay(flags)
+		os.Exit(0)
+	}
+
 	selfupdater := updater.NewSelfUpdater()
 
 	// Create the app instance
@@ -96,6 +102,9 @@ appLoop:
 			// Run the server
 			core.RunEchoServer(app, echoApp)
 
+			// Restore the previous release if an update that was just installed doesn't respond
+			go selfupdater.VerifyStartup(app.Config.GetServerURI("127.0.0.1") + "/api/v1/status")
+
 			// Run the jobs in the background
 			cron.RunJobs(app)
 
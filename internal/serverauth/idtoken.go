@@ -0,0 +1,304 @@
+package serverauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+const (
+	// clockSkew is the tolerated difference between the clocks of the server and the identity provider
+	clockSkew = 2 * time.Minute
+	// keysRefreshInterval is the minimum duration between two fetches of the signing keys
+	keysRefreshInterval = time.Minute
+)
+
+type (
+	claims map[string]interface{}
+
+	jwtHeader struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	jsonWebKey struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+
+	// keySet caches the signing keys of the identity provider.
+	keySet struct {
+		uri        string
+		httpClient *http.Client
+
+		mu          sync.Mutex
+		keys        []jsonWebKey
+		lastFetched time.Time
+	}
+)
+
+func newKeySet(uri string, httpClient *http.Client) *keySet {
+	return &keySet{uri: uri, httpClient: httpClient}
+}
+
+func (c claims) getString(key string) string {
+	if v, ok := c[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// getBool returns the boolean claim, some providers send booleans as strings.
+func (c claims) getBool(key string) bool {
+	switch v := c[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// verifyIDToken checks the signature and the claims of the ID token and returns its claims.
+func (p *oidcProvider) verifyIDToken(ctx context.Context, rawToken string, nonce string) (claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed header: %w", err)
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("malformed header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	key, err := p.keys.get(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed payload: %w", err)
+	}
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, fmt.Errorf("malformed payload: %w", err)
+	}
+
+	if strings.TrimSuffix(c.getString("iss"), "/") != p.opts.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", c.getString("iss"))
+	}
+
+	var audiences []string
+	switch aud := c["aud"].(type) {
+	case string:
+		audiences = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+	if !slices.Contains(audiences, p.opts.ClientID) {
+		return nil, errors.New("token was not issued for this client")
+	}
+	if azp := c.getString("azp"); azp != "" && azp != p.opts.ClientID {
+		return nil, errors.New("token was not issued for this client")
+	}
+
+	now := time.Now()
+	exp, ok := c["exp"].(float64)
+	if !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return nil, errors.New("token has expired")
+	}
+	if iat, ok := c["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(clockSkew)) {
+		return nil, errors.New("token was issued in the future")
+	}
+
+	if c.getString("nonce") != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	if c.getString("sub") == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	return c, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// get returns the public key matching the key ID.
+// The keys are fetched again if the key is unknown, identity providers rotate their keys.
+func (ks *keySet) get(ctx context.Context, kid string, alg string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if key := ks.find(kid, alg); key != nil {
+		return key.publicKey()
+	}
+
+	if time.Since(ks.lastFetched) < keysRefreshInterval {
+		return nil, fmt.Errorf("no signing key found for key ID %q", kid)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, ks.httpClient, ks.uri, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	ks.keys = jwks.Keys
+	ks.lastFetched = time.Now()
+
+	if key := ks.find(kid, alg); key != nil {
+		return key.publicKey()
+	}
+	return nil, fmt.Errorf("no signing key found for key ID %q", kid)
+}
+
+func (ks *keySet) find(kid string, alg string) *jsonWebKey {
+	for i, key := range ks.keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if key.Alg != "" && key.Alg != alg {
+			continue
+		}
+		// Tokens without key ID are accepted if the provider has a single key
+		if key.Kid == kid || (kid == "" && len(ks.keys) == 1) {
+			return &ks.keys[i]
+		}
+	}
+	return nil
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA key: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA key: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("invalid EC key")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// verifySignature verifies the JWS signature, only asymmetric algorithms are accepted.
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	invalidSignature := errors.New("invalid signature")
+
+	switch alg[:2] {
+	case "RS", "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key type does not match the signing algorithm")
+		}
+		var err error
+		if alg[:2] == "RS" {
+			err = rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+		} else {
+			err = rsa.VerifyPSS(rsaKey, hash, digest, signature, nil)
+		}
+		if err != nil {
+			return invalidSignature
+		}
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("key type does not match the signing algorithm")
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return invalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return invalidSignature
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,379 @@
+package serverauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+const (
+	// LoginStateTTL is the time the user has to complete the sign-in at the identity provider
+	LoginStateTTL = 10 * time.Minute
+	// maxLoginStates limits the number of sign-ins in progress
+	maxLoginStates = 1000
+	// maxResponseSize limits the size of the responses of the identity provider
+	maxResponseSize = 1 << 20
+)
+
+var (
+	ErrInvalidState       = errors.New("invalid or expired login state")
+	ErrTooManyLoginStates = errors.New("too many sign-ins in progress, try again later")
+)
+
+type (
+	OIDCOptions struct {
+		Issuer       string
+		ClientID     string
+		ClientSecret string
+		Scopes       []string
+		// UsernameClaim is the claim used as the username, defaults to preferred_username
+		UsernameClaim string
+	}
+
+	oidcProvider struct {
+		opts       *OIDCOptions
+		httpClient *http.Client
+
+		discoveryMu sync.Mutex
+		discovery   *oidcDiscovery
+		keys        *keySet
+
+		statesMu sync.Mutex
+		states   map[string]*loginState
+	}
+
+	// oidcDiscovery is the subset of the provider metadata used for the authorization code flow.
+	oidcDiscovery struct {
+		Issuer                            string   `json:"issuer"`
+		AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+		TokenEndpoint                     string   `json:"token_endpoint"`
+		UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+		JwksURI                           string   `json:"jwks_uri"`
+		TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+		CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	}
+
+	// loginState is stored between the redirection to the identity provider and the callback.
+	loginState struct {
+		nonce        string
+		codeVerifier string
+		redirectURL  string
+		expiresAt    time.Time
+	}
+
+	tokenResponse struct {
+		AccessToken      string `json:"access_token"`
+		IDToken          string `json:"id_token"`
+		TokenType        string `json:"token_type"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+)
+
+func newOIDCProvider(opts *OIDCOptions, httpClient *http.Client) *oidcProvider {
+	o := *opts
+	o.Issuer = strings.TrimSuffix(strings.TrimSpace(o.Issuer), "/")
+	if len(o.Scopes) == 0 {
+		o.Scopes = []string{"openid", "profile", "email"}
+	}
+	if !slices.Contains(o.Scopes, "openid") {
+		o.Scopes = append([]string{"openid"}, o.Scopes...)
+	}
+	if o.UsernameClaim == "" {
+		o.UsernameClaim = "preferred_username"
+	}
+
+	return &oidcProvider{
+		opts:       &o,
+		httpClient: httpClient,
+		states:     make(map[string]*loginState),
+	}
+}
+
+// OIDCLoginURL returns the URL of the identity provider the user should be redirected to, and the state of the sign-in.
+// redirectURL is the callback URL registered at the identity provider.
+// The state should be stored in the browser so that the callback can only be completed by the browser that started the sign-in.
+func (m *Manager) OIDCLoginURL(ctx context.Context, redirectURL string) (string, string, error) {
+	if m.oidc == nil {
+		return "", "", errors.New("OpenID Connect is disabled")
+	}
+	p := m.oidc
+
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	codeVerifier, err := randomString(48)
+	if err != nil {
+		return "", "", err
+	}
+
+	p.statesMu.Lock()
+	now := time.Now()
+	for k, s := range p.states {
+		if now.After(s.expiresAt) {
+			delete(p.states, k)
+		}
+	}
+	if len(p.states) >= maxLoginStates {
+		p.statesMu.Unlock()
+		return "", "", ErrTooManyLoginStates
+	}
+	p.states[state] = &loginState{
+		nonce:        nonce,
+		codeVerifier: codeVerifier,
+		redirectURL:  redirectURL,
+		expiresAt:    now.Add(LoginStateTTL),
+	}
+	p.statesMu.Unlock()
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	q := authURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.opts.ClientID)
+	q.Set("redirect_uri", redirectURL)
+	q.Set("scope", strings.Join(p.opts.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallengeS256(codeVerifier))
+	q.Set("code_challenge_method", "S256")
+	authURL.RawQuery = q.Encode()
+
+	return authURL.String(), state, nil
+}
+
+// OIDCCallback exchanges the authorization code and returns the identity from the validated ID token.
+// browserState is the state stored in the browser by OIDCLoginURL, it must match the state returned by the identity provider.
+func (m *Manager) OIDCCallback(ctx context.Context, state string, browserState string, code string) (*Identity, error) {
+	if m.oidc == nil {
+		return nil, errors.New("OpenID Connect is disabled")
+	}
+	p := m.oidc
+
+	p.statesMu.Lock()
+	ls, ok := p.states[state]
+	if !ok || state == "" {
+		p.statesMu.Unlock()
+		return nil, ErrInvalidState
+	}
+	if time.Now().After(ls.expiresAt) {
+		delete(p.states, state)
+		p.statesMu.Unlock()
+		return nil, ErrInvalidState
+	}
+	// The state is kept if the browser doesn't match, so that a forged callback can't cancel the sign-in
+	if subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		p.statesMu.Unlock()
+		return nil, ErrInvalidState
+	}
+	delete(p.states, state) // A state can only be used once
+	p.statesMu.Unlock()
+	if code == "" {
+		return nil, errors.New("missing authorization code")
+	}
+
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.exchangeCode(ctx, discovery, code, ls)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenClaims, err := p.verifyIDToken(ctx, token.IDToken, ls.nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	// Some providers only return the profile claims from the userinfo endpoint
+	if tokenClaims.getString(p.opts.UsernameClaim) == "" && discovery.UserinfoEndpoint != "" && token.AccessToken != "" {
+		userinfo, err := p.fetchUserinfo(ctx, discovery.UserinfoEndpoint, token.AccessToken)
+		if err != nil {
+			m.logger.Warn().Err(err).Msg("serverauth: Failed to fetch the OIDC userinfo")
+		} else if userinfo.getString("sub") == tokenClaims.getString("sub") {
+			for k, v := range userinfo {
+				if _, ok := tokenClaims[k]; !ok {
+					tokenClaims[k] = v
+				}
+			}
+		}
+	}
+
+	// Unverified emails could be set to the email of an allowed user, they are also ignored when used as the username claim
+	if !tokenClaims.getBool("email_verified") {
+		delete(tokenClaims, "email")
+	}
+
+	identity := &Identity{
+		Subject:  tokenClaims.getString("sub"),
+		Username: tokenClaims.getString(p.opts.UsernameClaim),
+		Email:    tokenClaims.getString("email"),
+	}
+	if identity.Username == "" {
+		identity.Username = identity.Email
+	}
+	if identity.Username == "" {
+		identity.Username = identity.Subject
+	}
+
+	return identity, nil
+}
+
+func (p *oidcProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.discoveryMu.Lock()
+	defer p.discoveryMu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := getJSON(ctx, p.httpClient, p.opts.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC discovery document: %w", err)
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.opts.Issuer {
+		return nil, fmt.Errorf("issuer mismatch, expected %q, got %q", p.opts.Issuer, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, errors.New("OIDC discovery document is missing required endpoints")
+	}
+	if len(discovery.CodeChallengeMethodsSupported) > 0 && !slices.Contains(discovery.CodeChallengeMethodsSupported, "S256") {
+		return nil, errors.New("identity provider does not support PKCE with S256")
+	}
+
+	p.discovery = &discovery
+	p.keys = newKeySet(discovery.JwksURI, p.httpClient)
+
+	return p.discovery, nil
+}
+
+func (p *oidcProvider) exchangeCode(ctx context.Context, discovery *oidcDiscovery, code string, ls *loginState) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", ls.redirectURL)
+	form.Set("code_verifier", ls.codeVerifier)
+	form.Set("client_id", p.opts.ClientID)
+
+	// Use client_secret_basic unless the provider only supports client_secret_post
+	useBasicAuth := p.opts.ClientSecret != "" &&
+		(len(discovery.TokenEndpointAuthMethodsSupported) == 0 || slices.Contains(discovery.TokenEndpointAuthMethodsSupported, "client_secret_basic"))
+	if p.opts.ClientSecret != "" && !useBasicAuth {
+		form.Set("client_secret", p.opts.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasicAuth {
+		req.SetBasicAuth(url.QueryEscape(p.opts.ClientID), url.QueryEscape(p.opts.ClientSecret))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("failed to parse token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token request failed (status %d): %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no ID token")
+	}
+
+	return &token, nil
+}
+
+func (p *oidcProvider) fetchUserinfo(ctx context.Context, endpoint string, accessToken string) (claims, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo request failed with status %d", resp.StatusCode)
+	}
+	// Signed userinfo responses are not supported
+	if ct := resp.Header.Get("Content-Type"); strings.HasPrefix(ct, "application/jwt") {
+		return nil, errors.New("signed userinfo responses are not supported")
+	}
+
+	var ret claims
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&ret); err != nil {
+		return nil, fmt.Errorf("failed to parse userinfo response: %w", err)
+	}
+	return ret, nil
+}
+
+func getJSON(ctx context.Context, httpClient *http.Client, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, u)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+func codeChallengeS256(codeVerifier string) string {
+	h := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
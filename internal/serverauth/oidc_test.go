@@ -0,0 +1,371 @@
+package serverauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"seanime/internal/util"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testClientID     = "seanime"
+	testClientSecret = "secret"
+	testRedirectURL  = "http://localhost:43211/api/v1/auth/oidc/callback"
+)
+
+// mockIdP is a minimal OpenID Connect provider issuing RS256 ID tokens.
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]*mockAuthorization
+
+	// modifyClaims is called before signing the ID token
+	modifyClaims func(c map[string]interface{})
+	// signingKey overrides the key used to sign the ID token
+	signingKey *rsa.PrivateKey
+	userinfo   map[string]interface{}
+}
+
+type mockAuthorization struct {
+	codeChallenge string
+	nonce         string
+	redirectURI   string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	idp := &mockIdP{t: t, key: key, codes: make(map[string]*mockAuthorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"userinfo_endpoint":                     idp.server.URL + "/userinfo",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"token_endpoint_auth_methods_supported": []string{"client_secret_basic"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.handleToken)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, idp.userinfo)
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+// authorize simulates the user signing in at the identity provider and returns the callback parameters.
+func (idp *mockIdP) authorize(loginURL string) (state string, code string) {
+	u, err := url.Parse(loginURL)
+	require.NoError(idp.t, err)
+	q := u.Query()
+
+	require.Equal(idp.t, idp.server.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	require.Equal(idp.t, "code", q.Get("response_type"))
+	require.Equal(idp.t, testClientID, q.Get("client_id"))
+	require.Equal(idp.t, "S256", q.Get("code_challenge_method"))
+	require.Contains(idp.t, q.Get("scope"), "openid")
+
+	code, err = randomString(16)
+	require.NoError(idp.t, err)
+
+	idp.mu.Lock()
+	idp.codes[code] = &mockAuthorization{
+		codeChallenge: q.Get("code_challenge"),
+		nonce:         q.Get("nonce"),
+		redirectURI:   q.Get("redirect_uri"),
+	}
+	idp.mu.Unlock()
+
+	return q.Get("state"), code
+}
+
+func (idp *mockIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != testClientID || clientSecret != testClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	_ = r.ParseForm()
+	idp.mu.Lock()
+	auth, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	verifierHash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok ||
+		r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("redirect_uri") != auth.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(verifierHash[:]) != auth.codeChallenge {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	c := map[string]interface{}{
+		"iss":                idp.server.URL,
+		"sub":                "user-1",
+		"aud":                testClientID,
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              auth.nonce,
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+	}
+	if idp.modifyClaims != nil {
+		idp.modifyClaims(c)
+	}
+
+	writeJSON(w, map[string]string{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"id_token":     idp.sign(c),
+	})
+}
+
+func (idp *mockIdP) sign(c map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(c)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	key := idp.key
+	if idp.signingKey != nil {
+		key = idp.signingKey
+	}
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(idp.t, err)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestOIDCManager(t *testing.T, idp *mockIdP, allowedUsers ...string) *Manager {
+	m, err := NewManager(&NewManagerOptions{
+		Logger: util.NewLogger(),
+		OIDC: &OIDCOptions{
+			Issuer:       idp.server.URL,
+			ClientID:     testClientID,
+			ClientSecret: testClientSecret,
+		},
+		AllowedUsers: allowedUsers,
+	})
+	require.NoError(t, err)
+	return m
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	m := newTestOIDCManager(t, idp)
+
+	loginURL, browserState, err := m.OIDCLoginURL(context.Background(), testRedirectURL)
+	require.NoError(t, err)
+
+	state, code := idp.authorize(loginURL)
+	identity, err := m.OIDCCallback(context.Background(), state, browserState, code)
+	require.NoError(t, err)
+	require.Equal(t, "user-1", identity.Subject)
+	require.Equal(t, "alice", identity.Username)
+	require.Equal(t, "alice@example.com", identity.Email)
+
+	token, session, err := m.CreateSession(identity, MethodOIDC)
+	require.NoError(t, err)
+	require.True(t, IsSessionToken(token))
+	require.Equal(t, "alice", session.Username)
+	require.NotNil(t, m.GetSession(token))
+
+	// The state cannot be used twice
+	_, err = m.OIDCCallback(context.Background(), state, browserState, code)
+	require.ErrorIs(t, err, ErrInvalidState)
+}
+
+func TestOIDCLogin_Userinfo(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.modifyClaims = func(c map[string]interface{}) {
+		delete(c, "preferred_username")
+		delete(c, "email")
+	}
+	idp.userinfo = map[string]interface{}{"sub": "user-1", "preferred_username": "bob"}
+	m := newTestOIDCManager(t, idp)
+
+	loginURL, browserState, err := m.OIDCLoginURL(context.Background(), testRedirectURL)
+	require.NoError(t, err)
+
+	state, code := idp.authorize(loginURL)
+	identity, err := m.OIDCCallback(context.Background(), state, browserState, code)
+	require.NoError(t, err)
+	require.Equal(t, "bob", identity.Username)
+}
+
+func TestOIDCLogin_InvalidIDToken(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		modifyClaims func(c map[string]interface{})
+		signingKey   *rsa.PrivateKey
+	}{
+		{name: "wrong signing key", signingKey: otherKey},
+		{name: "wrong audience", modifyClaims: func(c map[string]interface{}) { c["aud"] = "other-client" }},
+		{name: "wrong issuer", modifyClaims: func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }},
+		{name: "expired", modifyClaims: func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "wrong nonce", modifyClaims: func(c map[string]interface{}) { c["nonce"] = "replayed" }},
+		{name: "missing subject", modifyClaims: func(c map[string]interface{}) { delete(c, "sub") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.modifyClaims = tt.modifyClaims
+			idp.signingKey = tt.signingKey
+			m := newTestOIDCManager(t, idp)
+
+			loginURL, browserState, err := m.OIDCLoginURL(context.Background(), testRedirectURL)
+			require.NoError(t, err)
+
+			state, code := idp.authorize(loginURL)
+			_, err = m.OIDCCallback(context.Background(), state, browserState, code)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestOIDCLogin_AllowedUsers(t *testing.T) {
+	idp := newMockIdP(t)
+	m := newTestOIDCManager(t, idp, "carol", "Alice@Example.com")
+
+	loginURL, browserState, err := m.OIDCLoginURL(context.Background(), testRedirectURL)
+	require.NoError(t, err)
+
+	state, code := idp.authorize(loginURL)
+	identity, err := m.OIDCCallback(context.Background(), state, browserState, code)
+	require.NoError(t, err)
+
+	// Allowed by email
+	_, _, err = m.CreateSession(identity, MethodOIDC)
+	require.NoError(t, err)
+
+	_, _, err = m.CreateSession(&Identity{Subject: "user-2", Username: "mallory"}, MethodOIDC)
+	require.ErrorIs(t, err, ErrUserNotAllowed)
+}
+
+func TestOIDCLogin_BrowserState(t *testing.T) {
+	idp := newMockIdP(t)
+	m := newTestOIDCManager(t, idp)
+
+	loginURL, browserState, err := m.OIDCLoginURL(context.Background(), testRedirectURL)
+	require.NoError(t, err)
+
+	// The callback is opened in a browser that didn't start the sign-in
+	state, code := idp.authorize(loginURL)
+	_, err = m.OIDCCallback(context.Background(), state, "", code)
+	require.ErrorIs(t, err, ErrInvalidState)
+
+	// The browser stored the state of another sign-in
+	otherLoginURL, otherBrowserState, err := m.OIDCLoginURL(context.Background(), testRedirectURL)
+	require.NoError(t, err)
+	otherState, otherCode := idp.authorize(otherLoginURL)
+	_, err = m.OIDCCallback(context.Background(), otherState, state, otherCode)
+	require.ErrorIs(t, err, ErrInvalidState)
+
+	// The failed attempts don't cancel the sign-ins of the browsers that started them
+	identity, err := m.OIDCCallback(context.Background(), state, browserState, code)
+	require.NoError(t, err)
+	require.Equal(t, "alice", identity.Username)
+	_, err = m.OIDCCallback(context.Background(), otherState, otherBrowserState, otherCode)
+	require.NoError(t, err)
+
+	// A state can only be used once
+	_, err = m.OIDCCallback(context.Background(), state, browserState, code)
+	require.ErrorIs(t, err, ErrInvalidState)
+}
+
+func TestOIDCLogin_UnverifiedEmail(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.modifyClaims = func(c map[string]interface{}) {
+		c["email"] = "carol@example.com"
+		c["email_verified"] = false
+	}
+	m := newTestOIDCManager(t, idp, "carol@example.com")
+
+	loginURL, browserState, err := m.OIDCLoginURL(context.Background(), testRedirectURL)
+	require.NoError(t, err)
+
+	state, code := idp.authorize(loginURL)
+	identity, err := m.OIDCCallback(context.Background(), state, browserState, code)
+	require.NoError(t, err)
+	require.Empty(t, identity.Email)
+	require.Equal(t, "alice", identity.Username)
+
+	_, _, err = m.CreateSession(identity, MethodOIDC)
+	require.ErrorIs(t, err, ErrUserNotAllowed)
+}
+
+func TestOIDCLogin_MaxLoginStates(t *testing.T) {
+	idp := newMockIdP(t)
+	m := newTestOIDCManager(t, idp)
+
+	for i := 0; i < maxLoginStates; i++ {
+		_, _, err := m.OIDCLoginURL(context.Background(), testRedirectURL)
+		require.NoError(t, err)
+	}
+	_, _, err := m.OIDCLoginURL(context.Background(), testRedirectURL)
+	require.ErrorIs(t, err, ErrTooManyLoginStates)
+
+	// Expired states are removed
+	m.oidc.statesMu.Lock()
+	for _, s := range m.oidc.states {
+		s.expiresAt = time.Now().Add(-time.Minute)
+	}
+	m.oidc.statesMu.Unlock()
+	_, _, err = m.OIDCLoginURL(context.Background(), testRedirectURL)
+	require.NoError(t, err)
+}
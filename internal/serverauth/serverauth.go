@@ -0,0 +1,243 @@
+package serverauth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"seanime/internal/util"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// SessionTokenPrefix is the prefix of the session tokens issued after signing in with OIDC or the trusted proxy.
+	SessionTokenPrefix = "seas_"
+	// sessionTTL is the lifetime of a session, the client has to sign in again after that
+	sessionTTL = 7 * 24 * time.Hour
+	// hmacTokenTTL matches the lifetime of the HMAC tokens signed with the server password
+	hmacTokenTTL = 24 * time.Hour
+)
+
+const (
+	MethodOIDC         = "oidc"
+	MethodTrustedProxy = "trusted-proxy"
+)
+
+var ErrUserNotAllowed = errors.New("user is not allowed to access this server")
+
+type (
+	// Manager handles the sign-in methods that don't rely on the server password, OpenID Connect and trusted reverse-proxy headers.
+	// Both map the identity of the user to a server session, the session token is then used by the client in place of the password hash.
+	Manager struct {
+		logger       *zerolog.Logger
+		allowedUsers map[string]struct{}
+		oidc         *oidcProvider
+		trustedProxy *trustedProxy
+		secret       string // Random secret used when the server has no password
+
+		sessionsMu sync.RWMutex
+		sessions   map[string]*Session
+	}
+
+	NewManagerOptions struct {
+		Logger *zerolog.Logger
+		// OIDC is nil if OpenID Connect is disabled
+		OIDC *OIDCOptions
+		// TrustedProxy is nil if the trusted proxy mode is disabled
+		TrustedProxy *TrustedProxyOptions
+		// AllowedUsers lists the usernames or emails allowed to sign in, everyone is allowed if empty
+		AllowedUsers []string
+		// HTTPClient is used for requests to the identity provider
+		HTTPClient *http.Client
+	}
+
+	// Identity is the user authenticated by the identity provider or the reverse proxy.
+	Identity struct {
+		Subject  string
+		Username string
+		Email    string
+	}
+
+	Session struct {
+		Username  string    `json:"username"`
+		Method    string    `json:"method"`
+		CreatedAt time.Time `json:"createdAt"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+)
+
+func NewManager(opts *NewManagerOptions) (*Manager, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &Manager{
+		logger:       opts.Logger,
+		allowedUsers: make(map[string]struct{}),
+		secret:       secret,
+		sessions:     make(map[string]*Session),
+	}
+
+	for _, u := range opts.AllowedUsers {
+		if u = strings.ToLower(strings.TrimSpace(u)); u != "" {
+			ret.allowedUsers[u] = struct{}{}
+		}
+	}
+
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 15 * time.Second}
+	}
+
+	if opts.OIDC != nil {
+		ret.oidc = newOIDCProvider(opts.OIDC, httpClient)
+	}
+
+	if opts.TrustedProxy != nil {
+		ret.trustedProxy, err = newTrustedProxy(opts.TrustedProxy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// IsEnabled returns true if at least one sign-in method is enabled.
+func (m *Manager) IsEnabled() bool {
+	return m.OIDCEnabled() || m.TrustedProxyEnabled()
+}
+
+func (m *Manager) OIDCEnabled() bool {
+	return m.oidc != nil
+}
+
+func (m *Manager) TrustedProxyEnabled() bool {
+	return m.trustedProxy != nil
+}
+
+// Secret returns a random secret generated at startup.
+// It is used to sign URLs when the server has no password.
+func (m *Manager) Secret() string {
+	return m.secret
+}
+
+// IsAllowed returns true if the identity is in the list of allowed users, or if the list is empty.
+func (m *Manager) IsAllowed(identity *Identity) bool {
+	if len(m.allowedUsers) == 0 {
+		return true
+	}
+	for _, v := range []string{identity.Username, identity.Email} {
+		if _, ok := m.allowedUsers[strings.ToLower(v)]; ok && v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// IsSessionToken returns true if the value has the format of a session token.
+func IsSessionToken(value string) bool {
+	return strings.HasPrefix(value, SessionTokenPrefix)
+}
+
+// CreateSession creates a session for the identity if it is allowed to access the server.
+func (m *Manager) CreateSession(identity *Identity, method string) (string, *Session, error) {
+	if identity.Username == "" {
+		return "", nil, errors.New("identity has no username")
+	}
+	if !m.IsAllowed(identity) {
+		m.logger.Warn().Str("username", identity.Username).Str("method", method).Msg("serverauth: Rejected user not in the allowed users")
+		return "", nil, ErrUserNotAllowed
+	}
+
+	token, err := randomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+	token = SessionTokenPrefix + token
+
+	now := time.Now()
+	session := &Session{
+		Username:  identity.Username,
+		Method:    method,
+		CreatedAt: now,
+		ExpiresAt: now.Add(sessionTTL),
+	}
+
+	m.sessionsMu.Lock()
+	for t, s := range m.sessions {
+		if now.After(s.ExpiresAt) {
+			delete(m.sessions, t)
+		}
+	}
+	m.sessions[token] = session
+	m.sessionsMu.Unlock()
+
+	m.logger.Info().Str("username", identity.Username).Str("method", method).Msg("serverauth: Created session")
+
+	return token, session, nil
+}
+
+// GetSession returns the session matching the token, or nil if it doesn't exist or has expired.
+func (m *Manager) GetSession(token string) *Session {
+	if !IsSessionToken(token) {
+		return nil
+	}
+
+	m.sessionsMu.RLock()
+	session, ok := m.sessions[token]
+	m.sessionsMu.RUnlock()
+	if !ok || time.Now().After(session.ExpiresAt) {
+		return nil
+	}
+	return session
+}
+
+func (m *Manager) RevokeSession(token string) {
+	m.sessionsMu.Lock()
+	session, ok := m.sessions[token]
+	delete(m.sessions, token)
+	m.sessionsMu.Unlock()
+
+	if ok {
+		m.logger.Info().Str("username", session.Username).Msg("serverauth: Revoked session")
+	}
+}
+
+// ValidateHMACToken returns true if the HMAC token was signed with an active session token for one of the endpoints.
+// Clients signed in with a session use their session token as the HMAC secret.
+func (m *Manager) ValidateHMACToken(token string, endpoints ...string) bool {
+	now := time.Now()
+
+	m.sessionsMu.RLock()
+	defer m.sessionsMu.RUnlock()
+
+	for sessionToken, session := range m.sessions {
+		if now.After(session.ExpiresAt) {
+			continue
+		}
+		hmacAuth := util.NewHMACAuth(sessionToken, hmacTokenTTL)
+		for _, endpoint := range endpoints {
+			if _, err := hmacAuth.ValidateToken(token, endpoint); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
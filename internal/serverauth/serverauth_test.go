@@ -0,0 +1,150 @@
+package serverauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"seanime/internal/util"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedProxy(t *testing.T) {
+	m, err := NewManager(&NewManagerOptions{
+		Logger: util.NewLogger(),
+		TrustedProxy: &TrustedProxyOptions{
+			AllowedCIDRs: []string{"172.18.0.0/16", "::1"},
+		},
+		AllowedUsers: []string{"alice"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		username   string
+		expected   string
+		expectErr  error
+	}{
+		{name: "trusted proxy", remoteAddr: "172.18.0.3:51234", username: "alice", expected: "alice"},
+		{name: "trusted IPv6 proxy", remoteAddr: "[::1]:51234", username: "alice", expected: "alice"},
+		{name: "untrusted address", remoteAddr: "192.168.1.20:51234", username: "alice", expectErr: ErrUntrustedProxy},
+		{name: "user not allowed", remoteAddr: "172.18.0.3:51234", username: "mallory", expectErr: ErrUserNotAllowed},
+		{name: "no header", remoteAddr: "172.18.0.3:51234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/status", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.username != "" {
+				r.Header.Set("Remote-User", tt.username)
+			}
+
+			identity, err := m.AuthenticateProxyRequest(r)
+			if tt.expectErr != nil {
+				require.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.expected == "" {
+				require.Nil(t, identity)
+				return
+			}
+			require.Equal(t, tt.expected, identity.Username)
+		})
+	}
+}
+
+func TestTrustedProxy_Headers(t *testing.T) {
+	newRequest := func(header http.Header) *http.Request {
+		r := httptest.NewRequest("GET", "/api/v1/status", nil)
+		r.RemoteAddr = "172.18.0.3:51234"
+		r.Header = header
+		return r
+	}
+
+	// Authelia
+	m, err := NewManager(&NewManagerOptions{
+		Logger:       util.NewLogger(),
+		TrustedProxy: &TrustedProxyOptions{AllowedCIDRs: []string{"172.18.0.0/16"}},
+	})
+	require.NoError(t, err)
+	identity, err := m.AuthenticateProxyRequest(newRequest(http.Header{"Remote-User": {"alice"}, "Remote-Email": {"alice@example.com"}}))
+	require.NoError(t, err)
+	require.Equal(t, "alice", identity.Username)
+	require.Equal(t, "alice@example.com", identity.Email)
+
+	// oauth2-proxy
+	m, err = NewManager(&NewManagerOptions{
+		Logger: util.NewLogger(),
+		TrustedProxy: &TrustedProxyOptions{
+			Header:       "X-Forwarded-User",
+			EmailHeader:  "x-forwarded-email",
+			AllowedCIDRs: []string{"172.18.0.0/16"},
+		},
+	})
+	require.NoError(t, err)
+	identity, err = m.AuthenticateProxyRequest(newRequest(http.Header{"X-Forwarded-User": {"alice"}, "X-Forwarded-Email": {"alice@example.com"}}))
+	require.NoError(t, err)
+	require.Equal(t, "alice", identity.Username)
+	require.Equal(t, "alice@example.com", identity.Email)
+
+	// The default headers are ignored
+	identity, err = m.AuthenticateProxyRequest(newRequest(http.Header{"Remote-User": {"alice"}}))
+	require.NoError(t, err)
+	require.Nil(t, identity)
+	identity, err = m.AuthenticateProxyRequest(newRequest(http.Header{"X-Forwarded-User": {"alice"}, "Remote-Email": {"alice@example.com"}}))
+	require.NoError(t, err)
+	require.Empty(t, identity.Email)
+}
+
+func TestParseCIDRs(t *testing.T) {
+	prefixes, err := ParseCIDRs([]string{"10.0.0.5", "192.168.1.7/24", " fd00::/8 "})
+	require.NoError(t, err)
+	require.Len(t, prefixes, 3)
+	require.Equal(t, "10.0.0.5/32", prefixes[0].String())
+	require.Equal(t, "192.168.1.0/24", prefixes[1].String())
+
+	_, err = ParseCIDRs([]string{"not-an-ip"})
+	require.Error(t, err)
+}
+
+func TestIsFromCIDRs(t *testing.T) {
+	prefixes, err := ParseCIDRs([]string{"172.18.0.0/16", "::1"})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/api/v1/status", nil)
+	r.Header.Set("X-Forwarded-For", "172.18.0.3")
+
+	r.RemoteAddr = "172.18.0.3:51234"
+	require.True(t, IsFromCIDRs(r, prefixes))
+	r.RemoteAddr = "[::1]:51234"
+	require.True(t, IsFromCIDRs(r, prefixes))
+	// Forwarding headers are ignored
+	r.RemoteAddr = "192.168.1.20:51234"
+	require.False(t, IsFromCIDRs(r, prefixes))
+	r.RemoteAddr = "172.18.0.3:51234"
+	require.False(t, IsFromCIDRs(r, nil))
+}
+
+func TestSessions(t *testing.T) {
+	m, err := NewManager(&NewManagerOptions{Logger: util.NewLogger()})
+	require.NoError(t, err)
+
+	token, _, err := m.CreateSession(&Identity{Username: "alice"}, MethodTrustedProxy)
+	require.NoError(t, err)
+	require.NotNil(t, m.GetSession(token))
+	require.Nil(t, m.GetSession(SessionTokenPrefix+"unknown"))
+
+	// The client signs URLs with its session token
+	hmacToken, err := util.NewHMACAuth(token, time.Hour).GenerateToken("/api/v1/mediastream/file")
+	require.NoError(t, err)
+	require.True(t, m.ValidateHMACToken(hmacToken, "/api/v1/mediastream/file"))
+	require.False(t, m.ValidateHMACToken(hmacToken, "/api/v1/other"))
+
+	m.RevokeSession(token)
+	require.Nil(t, m.GetSession(token))
+	require.False(t, m.ValidateHMACToken(hmacToken, "/api/v1/mediastream/file"))
+}
@@ -0,0 +1,139 @@
+package serverauth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	DefaultTrustedProxyHeader      = "Remote-User"
+	DefaultTrustedProxyEmailHeader = "Remote-Email"
+)
+
+var ErrUntrustedProxy = errors.New("request did not come from a trusted proxy")
+
+type (
+	TrustedProxyOptions struct {
+		// Header is the header containing the username set by the proxy, e.g. Remote-User
+		Header string
+		// EmailHeader is the header containing the email set by the proxy, e.g. Remote-Email
+		EmailHeader string
+		// AllowedCIDRs lists the addresses of the proxies, e.g. 172.18.0.0/16 or 10.0.0.5
+		AllowedCIDRs []string
+	}
+
+	trustedProxy struct {
+		header      string
+		emailHeader string
+		prefixes    []netip.Prefix
+	}
+)
+
+func newTrustedProxy(opts *TrustedProxyOptions) (*trustedProxy, error) {
+	prefixes, err := ParseCIDRs(opts.AllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	if len(prefixes) == 0 {
+		return nil, errors.New("trusted proxy requires at least one allowed CIDR")
+	}
+
+	header := strings.TrimSpace(opts.Header)
+	if header == "" {
+		header = DefaultTrustedProxyHeader
+	}
+
+	emailHeader := strings.TrimSpace(opts.EmailHeader)
+	if emailHeader == "" {
+		emailHeader = DefaultTrustedProxyEmailHeader
+	}
+
+	return &trustedProxy{
+		header:      http.CanonicalHeaderKey(header),
+		emailHeader: http.CanonicalHeaderKey(emailHeader),
+		prefixes:    prefixes,
+	}, nil
+}
+
+// ParseCIDRs parses a list of CIDRs, single addresses are treated as /32 or /128 prefixes.
+func ParseCIDRs(values []string) ([]netip.Prefix, error) {
+	ret := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", v, err)
+			}
+			ret = append(ret, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", v, err)
+		}
+		ret = append(ret, prefix.Masked())
+	}
+	return ret, nil
+}
+
+// isTrusted returns true if the request comes directly from one of the allowed addresses.
+func (p *trustedProxy) isTrusted(r *http.Request) bool {
+	return IsFromCIDRs(r, p.prefixes)
+}
+
+// IsFromCIDRs returns true if the request comes directly from an address in one of the prefixes.
+// The remote address of the connection is used, X-Forwarded-For can be forged by the client.
+func IsFromCIDRs(r *http.Request, prefixes []netip.Prefix) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateProxyRequest returns the identity set by the trusted proxy.
+// Returns nil without error if the request has no identity header.
+func (m *Manager) AuthenticateProxyRequest(r *http.Request) (*Identity, error) {
+	if m.trustedProxy == nil {
+		return nil, errors.New("trusted proxy authentication is disabled")
+	}
+
+	username := strings.TrimSpace(r.Header.Get(m.trustedProxy.header))
+	if username == "" {
+		return nil, nil
+	}
+
+	if !m.trustedProxy.isTrusted(r) {
+		m.logger.Warn().Str("remoteAddr", r.RemoteAddr).Msgf("serverauth: Ignored %s header from untrusted address", m.trustedProxy.header)
+		return nil, ErrUntrustedProxy
+	}
+
+	identity := &Identity{
+		Subject:  username,
+		Username: username,
+		Email:    strings.TrimSpace(r.Header.Get(m.trustedProxy.emailHeader)),
+	}
+	if !m.IsAllowed(identity) {
+		return nil, ErrUserNotAllowed
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,94 @@
+package torrent_client
+
+import (
+	"errors"
+	"path/filepath"
+	"seanime/internal/util"
+	"strings"
+)
+
+// FindTorrentsForFiles returns the torrents containing the files, keyed by file path.
+// Files that don't belong to any torrent are not in the map.
+// Only the torrents whose save directory contains one of the files are inspected.
+func (r *Repository) FindTorrentsForFiles(paths []string) (map[string]*Torrent, error) {
+	ret := make(map[string]*Torrent)
+	if len(paths) == 0 {
+		return ret, nil
+	}
+
+	torrents, err := r.GetList(&GetListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	normalizedPaths := make(map[string]string, len(paths))
+	for _, p := range paths {
+		normalizedPaths[util.NormalizePath(p)] = p
+	}
+
+	for _, t := range torrents {
+		baseDir := r.getTorrentBaseDir(t)
+		if baseDir == "" {
+			continue
+		}
+		normalizedBaseDir := strings.TrimSuffix(util.NormalizePath(baseDir), "/") + "/"
+
+		hasCandidate := false
+		for np := range normalizedPaths {
+			if strings.HasPrefix(np, normalizedBaseDir) {
+				hasCandidate = true
+				break
+			}
+		}
+		if !hasCandidate {
+			continue
+		}
+
+		files, err := r.GetFiles(t.Hash)
+		if err != nil {
+			continue
+		}
+		for _, name := range files {
+			if p, ok := normalizedPaths[util.NormalizePath(filepath.Join(baseDir, name))]; ok {
+				ret[p] = t
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// GetTorrentFilePaths returns the paths of the files of the torrent on disk.
+func (r *Repository) GetTorrentFilePaths(t *Torrent) ([]string, error) {
+	baseDir := r.getTorrentBaseDir(t)
+	if baseDir == "" {
+		return nil, errors.New("torrent client: Unknown content path")
+	}
+
+	files, err := r.GetFiles(t.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(files))
+	for _, name := range files {
+		ret = append(ret, filepath.Join(baseDir, name))
+	}
+	return ret, nil
+}
+
+// getTorrentBaseDir returns the directory the file names of the torrent are relative to.
+func (r *Repository) getTorrentBaseDir(t *Torrent) string {
+	if t.ContentPath == "" {
+		return ""
+	}
+	switch r.provider {
+	case QbittorrentClient:
+		// The content path is the root folder or the file
+		return filepath.Dir(t.ContentPath)
+	case TransmissionClient:
+		// The content path is the download directory
+		return t.ContentPath
+	}
+	return ""
+}
@@ -410,6 +410,31 @@ func (r *Repository) ResumeTorrents(hashes []string) error {
 	return nil
 }
 
+// RecheckTorrents verifies the downloaded data of the torrents.
+// The client downloads the pieces that fail the check again.
+func (r *Repository) RecheckTorrents(hashes []string) error {
+	r.logger.Trace().Msg("torrent client: Rechecking torrents")
+
+	var err error
+	switch r.provider {
+	case QbittorrentClient:
+		err = r.qBittorrentClient.Torrent.RecheckTorrents(hashes)
+	case TransmissionClient:
+		err = r.transmission.Client.TorrentVerifyHashes(context.Background(), hashes)
+	case NoneClient:
+		return errors.New("torrent client: No torrent client selected")
+	}
+
+	if err != nil {
+		r.logger.Err(err).Msg("torrent client: Error while rechecking torrents")
+		return err
+	}
+
+	r.logger.Debug().Any("hashes", hashes).Msg("torrent client: Rechecking torrents")
+
+	return nil
+}
+
 func (r *Repository) DeselectFiles(hash string, indices []int) error {
 
 	var err error
@@ -262,7 +262,7 @@ func (c *Client) GetExternalPlayerStreamingUrl() string {
 		return ""
 	}
 
-	ret := fmt.Sprintf("{{SCHEME}}://{{HOST}}/api/v1/torrentstream/stream/%s", url.PathEscape(c.currentFile.MustGet().DisplayPath()))
+	ret := fmt.Sprintf("{{SCHEME}}://{{HOST}}%s/api/v1/torrentstream/stream/%s", c.repository.basePath, url.PathEscape(c.currentFile.MustGet().DisplayPath()))
 
 	return ret
 }
@@ -421,15 +421,21 @@ func (c *Client) dropTorrents() {
 	c.repository.logger.Trace().Msg("torrentstream: Dropping all torrents")
 
 	for _, t := range c.torrentClient.MustGet().Torrents() {
+		// Keep the torrents whose files are being downloaded for offline use
+		if c.repository.isDownloadingOffline(t.InfoHash().HexString()) {
+			c.repository.logger.Debug().Msgf("torrentstream: Not dropping torrent %s as a file is being downloaded for offline use", t.InfoHash().HexString())
+			continue
+		}
 		t.Drop()
 	}
 
 	if c.repository.settings.IsPresent() {
 		// Delete all torrents
+		// e.g. /path/to/temp/seanime/torrentstream/{infohash}
 		fe, err := os.ReadDir(c.repository.settings.MustGet().DownloadDir)
 		if err == nil {
 			for _, f := range fe {
-				if f.IsDir() {
+				if f.IsDir() && !c.repository.isDownloadingOffline(f.Name()) {
 					_ = os.RemoveAll(path.Join(c.repository.settings.MustGet().DownloadDir, f.Name()))
 				}
 			}
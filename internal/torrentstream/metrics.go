@@ -0,0 +1,49 @@
+package torrentstream
+
+import (
+	"seanime/internal/metrics"
+
+	"github.com/anacrolix/torrent"
+)
+
+// registerMetrics exposes the state of the torrent client.
+// The values are read when the metrics are scraped, the latest repository replaces the previous one.
+func (r *Repository) registerMetrics() {
+	metrics.NewGaugeFunc("torrentstream_torrents", "Number of torrents in the torrent streaming client.", func() float64 {
+		client, ok := r.getTorrentClient()
+		if !ok {
+			return 0
+		}
+		return float64(len(client.Torrents()))
+	})
+
+	metrics.NewGaugeVecFunc("torrentstream_peers", "Number of peers of the torrent streaming client by state.", []string{"state"}, func(emit func(value float64, labelValues ...string)) {
+		client, ok := r.getTorrentClient()
+		if !ok {
+			return
+		}
+		stats := client.Stats()
+		emit(float64(stats.TotalPeers), "total")
+		emit(float64(stats.ActivePeers), "active")
+		emit(float64(stats.PendingPeers), "pending")
+		emit(float64(stats.HalfOpenPeers), "half_open")
+		emit(float64(stats.ConnectedSeeders), "connected_seeders")
+	})
+
+	metrics.NewCounterVecFunc("torrentstream_data_bytes_total", "Bytes of torrent data transferred by the torrent streaming client.", []string{"direction"}, func(emit func(value float64, labelValues ...string)) {
+		client, ok := r.getTorrentClient()
+		if !ok {
+			return
+		}
+		stats := client.Stats()
+		emit(float64(stats.BytesReadData.Int64()), "download")
+		emit(float64(stats.BytesWrittenData.Int64()), "upload")
+	})
+}
+
+func (r *Repository) getTorrentClient() (*torrent.Client, bool) {
+	if r.client == nil {
+		return nil, false
+	}
+	return r.client.torrentClient.Get()
+}
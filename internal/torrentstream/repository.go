@@ -22,6 +22,7 @@ import (
 	"seanime/internal/torrents/torrent"
 	"seanime/internal/util"
 	"seanime/internal/util/result"
+	"sync"
 	"sync/atomic"
 
 	itorrent "github.com/anacrolix/torrent"
@@ -54,12 +55,15 @@ type (
 		nativePlayer                    *nativeplayer.NativePlayer
 		logger                          *zerolog.Logger
 		db                              *db.Database
+		basePath                        string // Base path of the server, prefixed to external player URLs
 
 		onEpisodeCollectionChanged func(ec *anime.EpisodeCollection)
 
 		previousStreamOptions mo.Option[*StartStreamOptions]
 		preloadedStream       mo.Option[*preloadedStream]
-		shouldPreloadStream   atomic.Bool // Flag on whether the client should prepare a stream
+		shouldPreloadStream   atomic.Bool    // Flag on whether the client should prepare a stream
+		offlineDownloads      map[string]int // Info hash -> Number of files being downloaded for offline use, see [OpenCurrentFile]
+		offlineDownloadsMu    sync.Mutex
 	}
 
 	Settings struct {
@@ -87,6 +91,7 @@ type (
 		Database            *db.Database
 		DirectStreamManager *directstream.Manager
 		NativePlayer        *nativeplayer.NativePlayer
+		BasePath            string
 	}
 )
 
@@ -97,6 +102,7 @@ func NewRepository(opts *NewRepositoryOptions) *Repository {
 		handler:                         nil,
 		settings:                        mo.Option[Settings]{},
 		selectionHistoryMap:             result.NewMap[int, *hibiketorrent.AnimeTorrent](),
+		offlineDownloads:                make(map[string]int),
 		torrentRepository:               opts.TorrentRepository,
 		baseAnimeCache:                  opts.BaseAnimeCache,
 		completeAnimeCache:              opts.CompleteAnimeCache,
@@ -110,6 +116,7 @@ func NewRepository(opts *NewRepositoryOptions) *Repository {
 		db:                              opts.Database,
 		directStreamManager:             opts.DirectStreamManager,
 		nativePlayer:                    opts.NativePlayer,
+		basePath:                        opts.BasePath,
 		previousStreamOptions:           mo.None[*StartStreamOptions](),
 		preloadedStream:                 mo.None[*preloadedStream](),
 	}
@@ -123,6 +130,7 @@ func NewRepository(opts *NewRepositoryOptions) *Repository {
 
 	ret.client = NewClient(ret)
 	ret.handler = newHandler(ret)
+	ret.registerMetrics()
 	return ret
 }
 
@@ -2,7 +2,10 @@ package torrentstream
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"path"
 	"seanime/internal/api/anilist"
 	"seanime/internal/api/metadata"
 	"seanime/internal/directstream"
@@ -12,12 +15,15 @@ import (
 	"seanime/internal/library/playbackmanager"
 	"seanime/internal/util"
 	"seanime/internal/videocore"
+	"sync"
 	"time"
 
 	"github.com/anacrolix/torrent"
 	"github.com/samber/mo"
 )
 
+var ErrOfflineDownloadInProgress = errors.New("torrentstream: An episode is being downloaded for offline use, wait for it to finish or cancel it")
+
 type PlaybackType string
 
 const (
@@ -47,6 +53,11 @@ func (r *Repository) StartStream(ctx context.Context, opts *StartStreamOptions)
 	// DEVNOTE: Do not
 	//r.Shutdown()
 
+	// Starting another stream would replace the torrent being downloaded
+	if r.hasOfflineDownloads() {
+		return ErrOfflineDownloadInProgress
+	}
+
 	r.previousStreamOptions = mo.Some(opts)
 
 	r.logger.Info().
@@ -361,6 +372,12 @@ func (r *Repository) StopStream(fromNativePlayer ...bool) error {
 		currentTorrent := r.client.currentTorrent.MustGet()
 		shouldDrop := r.client.currentTorrentStatus.ProgressPercentage < 70
 
+		// Don't drop if the file is being downloaded for offline use
+		if r.isDownloadingOffline(currentTorrent.InfoHash().HexString()) {
+			r.client.repository.logger.Debug().Msg("torrentstream: Not dropping torrent as a file is being downloaded for offline use")
+			shouldDrop = false
+		}
+
 		// Don't drop if this is the prepared torrent
 		if r.preloadedStream.IsPresent() {
 			prepared := r.preloadedStream.MustGet()
@@ -396,6 +413,59 @@ func (r *Repository) StopStream(fromNativePlayer ...bool) error {
 	return nil
 }
 
+// OpenCurrentFile returns a reader of the file being streamed, used to download it for offline use.
+// Reading the file downloads it entirely. The torrent is not dropped when the stream stops until the reader is closed.
+func (r *Repository) OpenCurrentFile() (reader io.ReadCloser, name string, size int64, err error) {
+	r.client.mu.Lock()
+	defer r.client.mu.Unlock()
+
+	file, ok := r.client.currentFile.Get()
+	if !ok {
+		return nil, "", 0, errors.New("torrentstream: No file is being streamed")
+	}
+
+	infoHash := file.Torrent().InfoHash().HexString()
+
+	r.offlineDownloadsMu.Lock()
+	r.offlineDownloads[infoHash]++
+	r.offlineDownloadsMu.Unlock()
+
+	return &offlineFileReader{
+		Reader: file.NewReader(),
+		done: sync.OnceFunc(func() {
+			r.offlineDownloadsMu.Lock()
+			defer r.offlineDownloadsMu.Unlock()
+			if r.offlineDownloads[infoHash]--; r.offlineDownloads[infoHash] <= 0 {
+				delete(r.offlineDownloads, infoHash)
+			}
+		}),
+	}, path.Base(file.DisplayPath()), file.Length(), nil
+}
+
+// hasOfflineDownloads returns true if a file is being downloaded for offline use.
+func (r *Repository) hasOfflineDownloads() bool {
+	r.offlineDownloadsMu.Lock()
+	defer r.offlineDownloadsMu.Unlock()
+	return len(r.offlineDownloads) > 0
+}
+
+// isDownloadingOffline returns true if a file of the torrent is being downloaded for offline use.
+func (r *Repository) isDownloadingOffline(infoHash string) bool {
+	r.offlineDownloadsMu.Lock()
+	defer r.offlineDownloadsMu.Unlock()
+	return r.offlineDownloads[infoHash] > 0
+}
+
+type offlineFileReader struct {
+	torrent.Reader
+	done func()
+}
+
+func (o *offlineFileReader) Close() error {
+	o.done()
+	return o.Reader.Close()
+}
+
 func (r *Repository) DropTorrent() error {
 	r.logger.Info().Msg("torrentstream: Dropping last torrent")
 
@@ -470,6 +540,10 @@ func streamOptionsMatch(a, b *StartStreamOptions) bool {
 func (r *Repository) PreloadStream(ctx context.Context, opts *StartStreamOptions) (err error) {
 	defer util.HandlePanicInModuleWithError("torrentstream/stream/PreloadStream", &err)
 
+	if r.hasOfflineDownloads() {
+		return ErrOfflineDownloadInProgress
+	}
+
 	r.logger.Info().
 		Int("mediaId", opts.MediaId).
 		Int("episodeNumber", opts.EpisodeNumber).
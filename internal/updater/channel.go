@@ -0,0 +1,162 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/goccy/go-json"
+)
+
+const (
+	ChannelStable = "stable" // Latest release
+	ChannelBeta   = "beta"   // Latest release, including pre-releases
+	ChannelPinned = "pinned" // Specific version, can be older than the current version
+)
+
+const PinnedRelease = "pinned"
+
+var (
+	githubReleasesUrl     = "https://api.github.com/repos/5rahim/seanime/releases?per_page=30"
+	githubReleaseByTagUrl = "https://api.github.com/repos/5rahim/seanime/releases/tags/"
+)
+
+// SetChannel sets the release channel used to find updates.
+// An empty channel defaults to the stable channel.
+func (u *Updater) SetChannel(channel string, pinnedVersion string) {
+	if channel == "" {
+		channel = ChannelStable
+	}
+	pinnedVersion = strings.TrimPrefix(strings.TrimSpace(pinnedVersion), "v")
+
+	if u.channel == channel && u.pinnedVersion == pinnedVersion {
+		return
+	}
+
+	u.channel = channel
+	u.pinnedVersion = pinnedVersion
+	u.hasCheckedForUpdate = false
+	u.LatestRelease = nil
+}
+
+func (u *Updater) GetChannel() string {
+	if u.channel == "" {
+		return ChannelStable
+	}
+	return u.channel
+}
+
+// fetchChannelRelease fetches the release to update to according to the channel.
+func (u *Updater) fetchChannelRelease() (*Release, error) {
+	switch u.GetChannel() {
+	case ChannelBeta:
+		return u.fetchLatestBetaRelease()
+	case ChannelPinned:
+		if u.pinnedVersion == "" {
+			return nil, errors.New("no pinned version set")
+		}
+		return u.fetchReleaseByVersion(u.pinnedVersion)
+	default:
+		return u.fetchLatestRelease()
+	}
+}
+
+// fetchLatestBetaRelease returns the highest version among the published releases and pre-releases.
+func (u *Updater) fetchLatestBetaRelease() (*Release, error) {
+	var res []*GitHubResponse
+	if err := u.getGitHubJSON(githubReleasesUrl, &res); err != nil {
+		return nil, err
+	}
+
+	var latest *GitHubResponse
+	var latestVersion *semver.Version
+	for _, r := range res {
+		if r.Draft {
+			continue
+		}
+		v, err := semver.NewVersion(strings.TrimPrefix(r.TagName, "v"))
+		if err != nil {
+			continue
+		}
+		if latestVersion == nil || v.GreaterThan(latestVersion) {
+			latest = r
+			latestVersion = v
+		}
+	}
+	if latest == nil {
+		return nil, errors.New("no release found")
+	}
+
+	return newReleaseFromGitHub(latest, true), nil
+}
+
+// fetchReleaseByVersion returns the release of the given version.
+func (u *Updater) fetchReleaseByVersion(version string) (*Release, error) {
+	var res GitHubResponse
+	if err := u.getGitHubJSON(githubReleaseByTagUrl+"v"+version, &res); err != nil {
+		return nil, err
+	}
+	if res.Draft {
+		return nil, fmt.Errorf("release %s is not published", version)
+	}
+
+	return newReleaseFromGitHub(&res, true), nil
+}
+
+func (u *Updater) getGitHubJSON(url string, v interface{}) error {
+	response, err := u.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return errors.New("release not found")
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("http error code: %d", response.StatusCode)
+	}
+
+	byteArr, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+
+	return json.Unmarshal(byteArr, v)
+}
+
+// newReleaseFromGitHub converts a GitHub release.
+// If allowPrerelease is true, pre-releases are considered released.
+func newReleaseFromGitHub(res *GitHubResponse, allowPrerelease bool) *Release {
+	release := &Release{
+		Url:         res.Url,
+		HtmlUrl:     res.HtmlUrl,
+		NodeId:      res.NodeID,
+		TagName:     res.TagName,
+		Name:        res.Name,
+		Body:        res.Body,
+		PublishedAt: res.PublishedAt,
+		Released:    (allowPrerelease || !res.Prerelease) && !res.Draft,
+		Prerelease:  res.Prerelease,
+		Version:     strings.TrimPrefix(res.TagName, "v"),
+		Assets:      make([]ReleaseAsset, len(res.Assets)),
+	}
+
+	for i, asset := range res.Assets {
+		release.Assets[i] = ReleaseAsset{
+			Url:                asset.Url,
+			Id:                 asset.ID,
+			NodeId:             asset.NodeID,
+			Name:               asset.Name,
+			ContentType:        asset.ContentType,
+			Uploaded:           asset.State == "uploaded",
+			Size:               asset.Size,
+			BrowserDownloadUrl: asset.BrowserDownloadURL,
+		}
+	}
+
+	return release
+}
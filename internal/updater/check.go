@@ -64,6 +64,7 @@ type (
 		Body        string         `json:"body"`
 		PublishedAt string         `json:"published_at"`
 		Released    bool           `json:"released"`
+		Prerelease  bool           `json:"prerelease"`
 		Version     string         `json:"version"`
 		Assets      []ReleaseAsset `json:"assets"`
 	}
@@ -144,33 +145,7 @@ func (u *Updater) fetchLatestReleaseFromGitHub() (*Release, error) {
 		return nil, err
 	}
 
-	release := &Release{
-		Url:         res.Url,
-		HtmlUrl:     res.HtmlUrl,
-		NodeId:      res.NodeID,
-		TagName:     res.TagName,
-		Name:        res.Name,
-		Body:        res.Body,
-		PublishedAt: res.PublishedAt,
-		Released:    !res.Prerelease && !res.Draft,
-		Version:     strings.TrimPrefix(res.TagName, "v"),
-		Assets:      make([]ReleaseAsset, len(res.Assets)),
-	}
-
-	for i, asset := range res.Assets {
-		release.Assets[i] = ReleaseAsset{
-			Url:                asset.Url,
-			Id:                 asset.ID,
-			NodeId:             asset.NodeID,
-			Name:               asset.Name,
-			ContentType:        asset.ContentType,
-			Uploaded:           asset.State == "uploaded",
-			Size:               asset.Size,
-			BrowserDownloadUrl: asset.BrowserDownloadURL,
-		}
-	}
-
-	return release, nil
+	return newReleaseFromGitHub(&res, false), nil
 }
 
 func (u *Updater) fetchLatestReleaseFromDocs() (*Release, error) {
@@ -1,8 +1,11 @@
 package updater
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -14,6 +17,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/goccy/go-json"
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
 	"github.com/samber/mo"
@@ -21,7 +25,14 @@ import (
 
 const (
 	tempReleaseDir = "seanime_new_release"
-	backupDirName  = "backup_restore_if_failed"
+	// previousReleaseDir keeps the files of the release that was replaced by the last update
+	previousReleaseDir  = "seanime_previous_release"
+	updateStateFileName = "seanime_update_state.json"
+
+	// The previous release is restored if the update fails to start this many times
+	maxStartupAttempts = 3
+	// The previous release is restored if the update's server doesn't respond within this duration
+	startupHealthCheckTimeout = 2 * time.Minute
 )
 
 type (
@@ -31,9 +42,19 @@ type (
 		originalExePath mo.Option[string]
 		updater         *Updater
 		fallbackDest    string
+		pendingUpdate   *updateState // Update that was just installed and isn't verified yet (can be nil)
 
 		tmpExecutableName string
 	}
+
+	// updateState is written next to the executable when an update is installed.
+	// It is removed once the new release passes the startup health check.
+	updateState struct {
+		PreviousVersion string    `json:"previousVersion"`
+		Version         string    `json:"version"`
+		Attempts        int       `json:"attempts"` // Number of times the new release was started
+		InstalledAt     time.Time `json:"installedAt"`
+	}
 )
 
 func NewSelfUpdater() *SelfUpdater {
@@ -53,6 +74,8 @@ func NewSelfUpdater() *SelfUpdater {
 		ret.tmpExecutableName = "seanime.old"
 	}
 
+	ret.checkPendingUpdate()
+
 	go func() {
 		// Delete all files with the .old extension
 		exePath := getExePath()
@@ -76,6 +99,11 @@ func (su *SelfUpdater) Started() <-chan struct{} {
 	return su.breakLoopCh
 }
 
+// SetChannel sets the release channel installed by the self-updater.
+func (su *SelfUpdater) SetChannel(channel string, pinnedVersion string) {
+	su.updater.SetChannel(channel, pinnedVersion)
+}
+
 func (su *SelfUpdater) StartSelfUpdate(fallbackDestination string) {
 	su.fallbackDest = fallbackDestination
 	close(su.breakLoopCh)
@@ -117,20 +145,7 @@ func (su *SelfUpdater) Run() error {
 
 	exeDir := filepath.Dir(exePath) // /path/to
 
-	var files []string
-
-	switch runtime.GOOS {
-	case "windows":
-		files = []string{
-			"seanime.exe",
-			"LICENSE",
-		}
-	default:
-		files = []string{
-			"seanime",
-			"LICENSE",
-		}
-	}
+	files := releaseFiles()
 
 	// Get the new assets
 	su.logger.Info().Msg("selfupdate: Fetching latest release info")
@@ -149,33 +164,34 @@ func (su *SelfUpdater) Run() error {
 	})
 	if !ok {
 		su.logger.Error().Msg("selfupdate: Asset not found")
-		return err
+		return fmt.Errorf("asset %s not found", assetName)
 	}
 
-	su.logger.Info().Msg("selfupdate: Downloading latest release")
+	su.logger.Info().Str("channel", su.updater.GetChannel()).Str("version", release.Version).Msg("selfupdate: Downloading release")
 
-	// Download the asset to exeDir/seanime_tmp
-	newReleaseDir, err := su.updater.DownloadLatestReleaseN(asset.BrowserDownloadUrl, exeDir, tempReleaseDir)
+	// Download and verify the asset, then extract it to exeDir/seanime_new_release
+	// Nothing is replaced if the verification fails
+	newReleaseDir, err := su.updater.DownloadVerifiedRelease(release, asset, exeDir, tempReleaseDir)
 	if err != nil {
-		su.logger.Error().Err(err).Msg("selfupdate: Failed to download latest release")
+		su.logger.Error().Err(err).Msg("selfupdate: Failed to download release")
+		_ = os.RemoveAll(filepath.Join(exeDir, tempReleaseDir))
 		return err
 	}
 
 	// DEVNOTE: Past this point, the application will be broken
 	// Use "recover" to attempt to recover the application
 
-	su.logger.Info().Msg("selfupdate: Creating backup")
+	su.logger.Info().Msg("selfupdate: Keeping the current release")
 
-	// Delete the backup directory if it exists
-	_ = os.RemoveAll(filepath.Join(exeDir, backupDirName))
-	// Create the backup directory
-	backupDir := filepath.Join(exeDir, backupDirName)
+	// Replace the previous release with the current one
+	backupDir := filepath.Join(exeDir, previousReleaseDir)
+	_ = os.RemoveAll(backupDir)
 	_ = os.MkdirAll(backupDir, 0755)
 
-	// Backup the current assets
-	// Copy the files to the backup directory
-	// seanime.exe + /backup_restore_if_failed/seanime.exe
-	// LICENSE + /backup_restore_if_failed/LICENSE
+	// Copy the current assets
+	// The previous release is restored if the update fails the startup health check
+	// seanime.exe + /seanime_previous_release/seanime.exe
+	// LICENSE + /seanime_previous_release/LICENSE
 	for _, file := range files {
 		// We don't check for errors here because we don't want to stop the update process if LICENSE is not found for example
 		_ = copyFile(filepath.Join(exeDir, file), filepath.Join(backupDir, file))
@@ -235,18 +251,22 @@ func (su *SelfUpdater) Run() error {
 	// Delete the new release directory
 	_ = os.RemoveAll(newReleaseDir)
 
+	// The new release has to pass the startup health check
+	err = writeUpdateState(exeDir, &updateState{
+		PreviousVersion: su.updater.CurrentVersion,
+		Version:         release.Version,
+		InstalledAt:     time.Now(),
+	})
+	if err != nil {
+		su.logger.Error().Err(err).Msg("selfupdate: Failed to write update state, the update won't be rolled back if it fails")
+	}
+
 	// Start the new executable
 	su.logger.Info().Msg("selfupdate: Starting new executable")
 
-	switch runtime.GOOS {
-	case "windows":
-		err = openWindows(su.originalExePath.MustGet())
-	case "darwin":
-		err = openMacOS(su.originalExePath.MustGet())
-	case "linux":
-		err = openLinux(su.originalExePath.MustGet())
-	default:
-		su.logger.Fatal().Msg("selfupdate: Unsupported platform")
+	err = startExecutable(su.originalExePath.MustGet())
+	if err != nil {
+		su.logger.Error().Err(err).Msg("selfupdate: Failed to start new executable")
 	}
 
 	// Remove .old files (will fail on Windows for executable)
@@ -255,13 +275,39 @@ func (su *SelfUpdater) Run() error {
 		_ = os.RemoveAll(filepath.Join(exeDir, file+".old"))
 	}
 
-	// Remove the backup directory
-	_ = os.RemoveAll(backupDir)
-
 	os.Exit(0)
 	return nil
 }
 
+// releaseFiles returns the files replaced by an update, the executable comes first.
+func releaseFiles() []string {
+	switch runtime.GOOS {
+	case "windows":
+		return []string{
+			"seanime.exe",
+			"LICENSE",
+		}
+	default:
+		return []string{
+			"seanime",
+			"LICENSE",
+		}
+	}
+}
+
+func startExecutable(path string) error {
+	switch runtime.GOOS {
+	case "windows":
+		return openWindows(path)
+	case "darwin":
+		return openMacOS(path)
+	case "linux":
+		return openLinux(path)
+	default:
+		return fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+	}
+}
+
 func openWindows(path string) error {
 	cmd := util.NewCmd("cmd", "/c", "start", "cmd", "/k", path)
 	return cmd.Start()
@@ -285,6 +331,186 @@ func openLinux(path string) error {
 	return syscall.Exec(path, filteredArgs, os.Environ())
 }
 
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Rollback
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// checkPendingUpdate counts the startup attempts of an update that was just installed.
+// The previous release is restored if the update keeps failing before passing the health check.
+func (su *SelfUpdater) checkPendingUpdate() {
+	exeDir := filepath.Dir(getExePath())
+
+	state, err := readUpdateState(exeDir)
+	if err != nil || state == nil {
+		return
+	}
+
+	// The running version isn't the installed update, e.g. it was replaced manually
+	if state.Version != su.updater.CurrentVersion {
+		_ = removeUpdateState(exeDir)
+		return
+	}
+
+	state.Attempts++
+	if state.Attempts > maxStartupAttempts {
+		su.logger.Error().Str("version", state.Version).Msgf("selfupdate: Update failed to start %d times", maxStartupAttempts)
+		su.rollback(exeDir, state)
+		return
+	}
+
+	if err := writeUpdateState(exeDir, state); err != nil {
+		su.logger.Error().Err(err).Msg("selfupdate: Failed to write update state")
+	}
+	su.pendingUpdate = state
+}
+
+// VerifyStartup checks that the server of an update that was just installed responds.
+// The previous release is restored if it doesn't respond within startupHealthCheckTimeout.
+func (su *SelfUpdater) VerifyStartup(healthCheckUrl string) {
+	if su.pendingUpdate == nil {
+		return
+	}
+
+	exeDir := filepath.Dir(getExePath())
+
+	if err := waitForHealthy(healthCheckUrl, startupHealthCheckTimeout); err != nil {
+		su.logger.Error().Err(err).Str("version", su.pendingUpdate.Version).Msg("selfupdate: Update failed the startup health check")
+		su.rollback(exeDir, su.pendingUpdate)
+		return
+	}
+
+	_ = removeUpdateState(exeDir)
+	su.logger.Info().Str("version", su.pendingUpdate.Version).Msg("selfupdate: Update passed the startup health check")
+	su.pendingUpdate = nil
+}
+
+// rollback restores the previous release and restarts the app.
+func (su *SelfUpdater) rollback(exeDir string, state *updateState) {
+	// Remove the state first so that a failed rollback doesn't loop
+	_ = removeUpdateState(exeDir)
+
+	if err := restorePreviousRelease(exeDir, releaseFiles()); err != nil {
+		su.logger.Error().Err(err).Msg("selfupdate: Failed to restore the previous release")
+		return
+	}
+
+	su.logger.Warn().Str("version", state.PreviousVersion).Msg("selfupdate: Restored the previous release, restarting")
+
+	if err := startExecutable(filepath.Join(exeDir, releaseFiles()[0])); err != nil {
+		su.logger.Error().Err(err).Msg("selfupdate: Failed to start the previous release")
+		return
+	}
+
+	os.Exit(0)
+}
+
+// restorePreviousRelease copies the files kept by the last update back to exeDir.
+// The current files are renamed to .old since the running executable can't be overwritten on Windows.
+func restorePreviousRelease(exeDir string, files []string) error {
+	prevDir := filepath.Join(exeDir, previousReleaseDir)
+
+	if _, err := os.Stat(filepath.Join(prevDir, files[0])); err != nil {
+		return fmt.Errorf("previous release not found: %w", err)
+	}
+
+	for _, file := range files {
+		src := filepath.Join(prevDir, file)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		dst := filepath.Join(exeDir, file)
+
+		_ = os.RemoveAll(dst + ".old")
+		if err := os.Rename(dst, dst+".old"); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rename %s: %w", file, err)
+		}
+		if err := copyFile(src, dst); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", file, err)
+		}
+		_ = os.Chmod(dst, 0755)
+	}
+
+	return nil
+}
+
+// waitForHealthy polls the status endpoint until the server responds with a valid status.
+func waitForHealthy(url string, timeout time.Duration) error {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			// The server is reached on the loopback address, its certificate won't match
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		lastErr = checkStatus(client, url)
+		if lastErr == nil {
+			return nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+
+	return fmt.Errorf("server did not respond: %w", lastErr)
+}
+
+// checkStatus checks that the status endpoint returns the status of the server.
+func checkStatus(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data *struct {
+			Version string `json:"version"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 10<<20)).Decode(&body); err != nil {
+		return fmt.Errorf("invalid status: %w", err)
+	}
+	if body.Data == nil || body.Data.Version == "" {
+		return errors.New("invalid status: missing version")
+	}
+
+	return nil
+}
+
+func readUpdateState(exeDir string) (*updateState, error) {
+	data, err := os.ReadFile(filepath.Join(exeDir, updateStateFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var state updateState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func writeUpdateState(exeDir string, state *updateState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(exeDir, updateStateFileName), data, 0644)
+}
+
+func removeUpdateState(exeDir string) error {
+	return os.Remove(filepath.Join(exeDir, updateStateFileName))
+}
+
 // moveContents moves contents of newReleaseDir to exeDir without deleting existing files
 func moveContents(newReleaseDir, exeDir string) error {
 	// Ensure exeDir exists
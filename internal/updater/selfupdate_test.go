@@ -0,0 +1,98 @@
+package updater
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateState(t *testing.T) {
+	dir := t.TempDir()
+
+	state, err := readUpdateState(dir)
+	require.NoError(t, err)
+	require.Nil(t, state)
+
+	require.NoError(t, writeUpdateState(dir, &updateState{PreviousVersion: "2.9.0", Version: "3.0.0", Attempts: 1}))
+
+	state, err = readUpdateState(dir)
+	require.NoError(t, err)
+	require.Equal(t, "2.9.0", state.PreviousVersion)
+	require.Equal(t, "3.0.0", state.Version)
+	require.Equal(t, 1, state.Attempts)
+
+	require.NoError(t, removeUpdateState(dir))
+	state, err = readUpdateState(dir)
+	require.NoError(t, err)
+	require.Nil(t, state)
+}
+
+func TestRestorePreviousRelease(t *testing.T) {
+	exeDir := t.TempDir()
+	files := []string{"seanime", "LICENSE"}
+
+	require.NoError(t, os.WriteFile(filepath.Join(exeDir, "seanime"), []byte("new"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(exeDir, "LICENSE"), []byte("license"), 0644))
+
+	// Nothing to restore
+	require.Error(t, restorePreviousRelease(exeDir, files))
+
+	prevDir := filepath.Join(exeDir, previousReleaseDir)
+	require.NoError(t, os.MkdirAll(prevDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(prevDir, "seanime"), []byte("previous"), 0755))
+
+	require.NoError(t, restorePreviousRelease(exeDir, files))
+
+	data, err := os.ReadFile(filepath.Join(exeDir, "seanime"))
+	require.NoError(t, err)
+	require.Equal(t, "previous", string(data))
+
+	// The replaced executable is kept until the next startup
+	data, err = os.ReadFile(filepath.Join(exeDir, "seanime.old"))
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+
+	// Files missing from the previous release are left untouched
+	data, err = os.ReadFile(filepath.Join(exeDir, "LICENSE"))
+	require.NoError(t, err)
+	require.Equal(t, "license", string(data))
+}
+
+func TestCheckStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		expectErr  bool
+	}{
+		{"Valid status", http.StatusOK, `{"data":{"version":"3.0.0","os":"linux"}}`, false},
+		{"Unauthorized", http.StatusUnauthorized, `{"error":"unauthorized"}`, true},
+		{"Not found", http.StatusNotFound, `404 page not found`, true},
+		{"Server error", http.StatusInternalServerError, `{"error":"internal error"}`, true},
+		{"Not JSON", http.StatusOK, `<html></html>`, true},
+		{"Missing version", http.StatusOK, `{"data":{}}`, true},
+		{"Missing data", http.StatusOK, `{"error":"failed"}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			err := checkStatus(server.Client(), server.URL+"/api/v1/status")
+			if tt.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
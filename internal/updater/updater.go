@@ -27,6 +27,9 @@ type (
 		client              *http.Client
 		wsEventManager      mo.Option[events.WSEventManagerInterface]
 		announcements       []Announcement
+		channel             string // Release channel, defaults to ChannelStable
+		pinnedVersion       string // Version installed by the pinned channel
+		releasePublicKey    string // Base64 Ed25519 key used to verify the checksums of the release assets
 	}
 
 	Update struct {
@@ -45,7 +48,9 @@ func New(currVersion string, logger *zerolog.Logger, wsEventManager events.WSEve
 		client: &http.Client{
 			Timeout: time.Second * 10,
 		},
-		wsEventManager: mo.None[events.WSEventManagerInterface](),
+		wsEventManager:   mo.None[events.WSEventManagerInterface](),
+		channel:          ChannelStable,
+		releasePublicKey: releasePublicKey,
 	}
 
 	if wsEventManager != nil {
@@ -75,6 +80,14 @@ func (u *Updater) GetLatestUpdate() (*Update, error) {
 
 	newV := strings.TrimPrefix(rl.TagName, "v")
 	updateTypeI, shouldUpdate := util.CompareVersion(u.CurrentVersion, newV)
+	if u.GetChannel() == ChannelPinned && newV != u.CurrentVersion && !shouldUpdate {
+		// The pinned version can be older than the current version
+		return &Update{
+			Release:        rl,
+			CurrentVersion: u.CurrentVersion,
+			Type:           PinnedRelease,
+		}, nil
+	}
 	if !shouldUpdate {
 		return nil, nil
 	}
@@ -110,13 +123,13 @@ func (u *Updater) SetEnabled(checkForUpdate bool) {
 
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
-// GetLatestRelease returns the latest release from the GitHub repository.
+// GetLatestRelease returns the release to update to according to the channel.
 func (u *Updater) GetLatestRelease() (*Release, error) {
 	if u.hasCheckedForUpdate {
 		return u.LatestRelease, nil
 	}
 
-	release, err := u.fetchLatestRelease()
+	release, err := u.fetchChannelRelease()
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,173 @@
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+const (
+	// ChecksumsAssetName is the release asset listing the SHA-256 checksums of the other assets, in the sha256sum format.
+	ChecksumsAssetName = "checksums.txt"
+	// ChecksumsSignatureAssetName is the release asset holding the base64 Ed25519 signature of ChecksumsAssetName.
+	ChecksumsSignatureAssetName = "checksums.txt.sig"
+
+	maxChecksumsSize = 1 << 20
+)
+
+// releasePublicKey is the base64 Ed25519 public key of the release signing key.
+// It is set at build time with -ldflags "-X seanime/internal/updater.releasePublicKey=<key>".
+// Builds without a key refuse to install updates.
+var releasePublicKey = ""
+
+var ErrReleaseKeyNotConfigured = errors.New("this build has no release signing key, updates cannot be verified")
+
+// DownloadVerifiedRelease downloads the release asset, verifies it against the signed checksums of the release and extracts it.
+// The downloaded archive is deleted if the verification fails.
+func (u *Updater) DownloadVerifiedRelease(release *Release, asset ReleaseAsset, dest string, folderName string) (string, error) {
+	u.logger.Debug().Str("asset", asset.Name).Str("dest", dest).Msg("updater: Downloading release")
+
+	fpath, err := u.downloadAsset(asset.BrowserDownloadUrl, dest)
+	if err != nil {
+		return "", err
+	}
+
+	if err := u.verifyReleaseAsset(release, asset.Name, fpath); err != nil {
+		_ = os.Remove(fpath)
+		return "", fmt.Errorf("could not verify %s: %w", asset.Name, err)
+	}
+
+	u.logger.Info().Str("asset", asset.Name).Msg("updater: Verified release asset")
+
+	extracted, err := u.decompressAsset(fpath, folderName)
+	if err != nil {
+		u.logger.Error().Err(err).Msg("updater: Failed to decompress release assets")
+		return extracted, err
+	}
+
+	return extracted, nil
+}
+
+// verifyReleaseAsset checks the signature of the release checksums and compares the checksum of the file at path.
+func (u *Updater) verifyReleaseAsset(release *Release, assetName string, path string) error {
+	publicKey, err := parsePublicKey(u.releasePublicKey)
+	if err != nil {
+		return err
+	}
+
+	checksumsAsset, ok := lo.Find(release.Assets, func(a ReleaseAsset) bool { return a.Name == ChecksumsAssetName })
+	if !ok {
+		return errors.New("release has no checksums")
+	}
+	signatureAsset, ok := lo.Find(release.Assets, func(a ReleaseAsset) bool { return a.Name == ChecksumsSignatureAssetName })
+	if !ok {
+		return errors.New("release checksums are not signed")
+	}
+
+	checksums, err := u.fetchSmallAsset(checksumsAsset.BrowserDownloadUrl)
+	if err != nil {
+		return fmt.Errorf("failed to download checksums: %w", err)
+	}
+	signature, err := u.fetchSmallAsset(signatureAsset.BrowserDownloadUrl)
+	if err != nil {
+		return fmt.Errorf("failed to download checksums signature: %w", err)
+	}
+
+	if err := verifySignature(publicKey, checksums, signature); err != nil {
+		return err
+	}
+
+	expected, ok := parseChecksums(checksums)[assetName]
+	if !ok {
+		return errors.New("asset is not listed in the checksums")
+	}
+
+	actual, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return errors.New("checksum mismatch")
+	}
+
+	return nil
+}
+
+func (u *Updater) fetchSmallAsset(url string) ([]byte, error) {
+	response, err := u.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("http error code: %d", response.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(response.Body, maxChecksumsSize))
+}
+
+func parsePublicKey(key string) (ed25519.PublicKey, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil, ErrReleaseKeyNotConfigured
+	}
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(decoded) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid release signing key")
+	}
+	return decoded, nil
+}
+
+// verifySignature verifies the base64 Ed25519 signature of the checksums.
+func verifySignature(publicKey ed25519.PublicKey, checksums []byte, signature []byte) error {
+	decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature)))
+	if err != nil || len(decoded) != ed25519.SignatureSize {
+		return errors.New("invalid checksums signature")
+	}
+	if !ed25519.Verify(publicKey, checksums, decoded) {
+		return errors.New("checksums signature does not match the release signing key")
+	}
+	return nil
+}
+
+// parseChecksums parses a sha256sum manifest, "<hex>  <filename>" per line.
+func parseChecksums(data []byte) map[string]string {
+	ret := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// The filename is prefixed with '*' in binary mode
+		name := filepath.Base(strings.TrimPrefix(fields[1], "*"))
+		ret[name] = strings.ToLower(fields[0])
+	}
+	return ret
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,130 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"seanime/internal/util"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdater_verifyReleaseAsset(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	content := []byte("release archive")
+	sum := sha256.Sum256(content)
+	checksums := []byte(fmt.Sprintf("%s  seanime-3.0.0_Linux_x86_64.tar.gz\n", hex.EncodeToString(sum[:])))
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, checksums))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + ChecksumsAssetName:
+			_, _ = w.Write(checksums)
+		case "/" + ChecksumsSignatureAssetName:
+			_, _ = w.Write([]byte(signature))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	release := &Release{
+		Version: "3.0.0",
+		Assets: []ReleaseAsset{
+			{Name: ChecksumsAssetName, BrowserDownloadUrl: server.URL + "/" + ChecksumsAssetName},
+			{Name: ChecksumsSignatureAssetName, BrowserDownloadUrl: server.URL + "/" + ChecksumsSignatureAssetName},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "archive")
+	require.NoError(t, os.WriteFile(path, content, 0644))
+
+	u := New("2.0.0", util.NewLogger(), nil)
+
+	// Builds without a key refuse to verify
+	u.releasePublicKey = ""
+	require.ErrorIs(t, u.verifyReleaseAsset(release, "seanime-3.0.0_Linux_x86_64.tar.gz", path), ErrReleaseKeyNotConfigured)
+
+	u.releasePublicKey = base64.StdEncoding.EncodeToString(publicKey)
+	require.NoError(t, u.verifyReleaseAsset(release, "seanime-3.0.0_Linux_x86_64.tar.gz", path))
+
+	// Asset not listed in the checksums
+	require.Error(t, u.verifyReleaseAsset(release, "seanime-3.0.0_Windows_x86_64.zip", path))
+
+	// Tampered asset
+	require.NoError(t, os.WriteFile(path, []byte("tampered archive"), 0644))
+	require.Error(t, u.verifyReleaseAsset(release, "seanime-3.0.0_Linux_x86_64.tar.gz", path))
+
+	// Checksums signed with another key
+	otherPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, content, 0644))
+	u.releasePublicKey = base64.StdEncoding.EncodeToString(otherPublicKey)
+	require.Error(t, u.verifyReleaseAsset(release, "seanime-3.0.0_Linux_x86_64.tar.gz", path))
+}
+
+func TestParseChecksums(t *testing.T) {
+	checksums := parseChecksums([]byte("ABC123  seanime.zip\ndef456 *dist/seanime.tar.gz\ninvalid line here\n\n"))
+	require.Equal(t, map[string]string{
+		"seanime.zip":    "abc123",
+		"seanime.tar.gz": "def456",
+	}, checksums)
+}
+
+func TestUpdater_fetchChannelRelease(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases":
+			_, _ = w.Write([]byte(`[
+				{"tag_name": "v3.1.0", "draft": true},
+				{"tag_name": "v3.0.0-beta.2", "prerelease": true},
+				{"tag_name": "v2.9.0"}
+			]`))
+		case "/releases/tags/v2.8.0":
+			_, _ = w.Write([]byte(`{"tag_name": "v2.8.0"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	prevReleasesUrl, prevReleaseByTagUrl := githubReleasesUrl, githubReleaseByTagUrl
+	githubReleasesUrl = server.URL + "/releases"
+	githubReleaseByTagUrl = server.URL + "/releases/tags/"
+	defer func() {
+		githubReleasesUrl, githubReleaseByTagUrl = prevReleasesUrl, prevReleaseByTagUrl
+	}()
+
+	u := New("2.9.0", util.NewLogger(), nil)
+
+	// Drafts are skipped, pre-releases are included
+	u.SetChannel(ChannelBeta, "")
+	release, err := u.fetchChannelRelease()
+	require.NoError(t, err)
+	require.Equal(t, "3.0.0-beta.2", release.Version)
+	require.True(t, release.Released)
+	require.True(t, release.Prerelease)
+
+	u.SetChannel(ChannelPinned, "v2.8.0")
+	release, err = u.fetchChannelRelease()
+	require.NoError(t, err)
+	require.Equal(t, "2.8.0", release.Version)
+
+	u.SetChannel(ChannelPinned, "2.7.0")
+	_, err = u.fetchChannelRelease()
+	require.Error(t, err)
+
+	u.SetChannel(ChannelPinned, "")
+	_, err = u.fetchChannelRelease()
+	require.Error(t, err)
+}
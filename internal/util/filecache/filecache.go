@@ -2,6 +2,7 @@ package filecache
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -352,6 +353,38 @@ func (c *Cacher) RemovePerm(bucketName string) error {
 	return c.Remove(bucketName)
 }
 
+// ListBuckets returns the names of all the buckets stored in the cache directory.
+func (c *Cacher) ListBuckets() ([]string, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".cache") {
+			continue
+		}
+		ret = append(ret, strings.TrimSuffix(e.Name(), ".cache"))
+	}
+	return ret, nil
+}
+
+// WriteBucket writes a consistent copy of the bucket file to w.
+func (c *Cacher) WriteBucket(name string, w io.Writer) error {
+	store, err := c.getStore(name)
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if err := json.NewEncoder(w).Encode(store.data); err != nil {
+		return fmt.Errorf("filecache: failed to encode cache data: %w", err)
+	}
+	return nil
+}
+
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 func (cs *CacheStore) loadFromFile() error {
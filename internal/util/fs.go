@@ -287,6 +287,48 @@ func MoveToDestination(src, dest string) error {
 	return nil
 }
 
+// MoveFile moves a file to the destination path, copying it if the destination is on another volume.
+// It fails if the destination already exists.
+//
+//	Example:
+//	MoveFile("/path/to/src/Ep1.mkv", "/path/to/dest/Anime/Ep1.mkv") // -> "/path/to/dest/Anime/Ep1.mkv"
+func MoveFile(src string, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("destination already exists: %s", dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst + ".part")
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst + ".part")
+		return err
+	}
+	if err = out.Close(); err != nil {
+		_ = os.Remove(dst + ".part")
+		return err
+	}
+	if err = os.Rename(dst+".part", dst); err != nil {
+		return err
+	}
+	_ = in.Close()
+	return os.Remove(src)
+}
+
 // UnwrapAndMove moves the last subfolder containing the files to the destination.
 // If there is a single file, it will move that file only.
 //
@@ -269,6 +269,20 @@ func FileExt(str string) string {
 	return str[lastDotIndex:]
 }
 
+// SanitizeFilename removes the characters that are invalid in file names on common file systems.
+//
+//	Example:
+//	SanitizeFilename(`Show: "Part 1"?`) // -> "Show Part 1"
+func SanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	return strings.Trim(strings.TrimSpace(name), ".")
+}
+
 func HashSHA256Hex(s string) string {
 	h := sha256.New()
 	h.Write([]byte(s))
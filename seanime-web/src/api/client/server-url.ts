@@ -5,6 +5,12 @@ function devOrProd(dev: string, prod: string): string {
     return import.meta.env.MODE === "development" ? dev : prod
 }
 
+// Path prefix of the server when it's behind a reverse proxy, e.g. "/anime"
+// Injected in index.html by the server
+export function getServerBasePath(): string {
+    return typeof window !== "undefined" ? (window.__SEANIME_BASE_PATH__ ?? "") : ""
+}
+
 export function getServerBaseUrl(removeProtocol: boolean = false): string {
     if (__isDesktop__) {
         let ret = devOrProd(`http://127.0.0.1:${__DEV_SERVER_PORT}`, "http://127.0.0.1:43211")
@@ -33,7 +39,7 @@ export function getServerBaseUrl(removeProtocol: boolean = false): string {
     }
 
     let ret = typeof window !== "undefined"
-        ? (`${window?.location?.protocol}//` + devOrProd(`${window?.location?.hostname}:${__DEV_SERVER_PORT}`, window?.location?.host))
+        ? (`${window?.location?.protocol}//` + devOrProd(`${window?.location?.hostname}:${__DEV_SERVER_PORT}`, window?.location?.host) + getServerBasePath())
         : ""
     if (removeProtocol) {
         ret = ret.replace("http://", "").replace("https://", "")
@@ -800,6 +800,10 @@ export type FetchExternalExtensionData_Variables = {
  */
 export type InstallExternalExtension_Variables = {
     manifestUri: string
+    /**
+     *  Optional, the marketplace the extension is installed from, empty for the default marketplace
+     */
+    marketplaceUrl?: string
 }
 
 /**
@@ -906,6 +910,34 @@ export type SaveExtensionUserConfig_Variables = {
     values: Record<string, string>
 }
 
+/**
+ * - Filepath: internal/handlers/extensions.go
+ * - Filename: extensions.go
+ * - Endpoint: /api/v1/extensions/trust/marketplace-keys
+ * @description
+ * Route pins the publisher keys trusted for a marketplace.
+ * Extensions installed from the marketplace must be signed by one of the keys.
+ * An empty list removes the pin.
+ */
+export type SetMarketplaceTrustedKeys_Variables = {
+    marketplaceUrl: string
+    publicKeys?: Array<string>
+}
+
+/**
+ * - Filepath: internal/handlers/extensions.go
+ * - Filename: extensions.go
+ * - Endpoint: /api/v1/extensions/trust/approve
+ * @description
+ * Route approves a new publisher key for the extension with the given ID.
+ * This allows the next install or update to be signed by the given key.
+ * An empty key allows an unsigned payload, e.g. when editing the code of a signed extension.
+ */
+export type ApproveExtensionPublisherKey_Variables = {
+    id: string
+    publicKey: string
+}
+
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 // filecache
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -326,6 +326,48 @@ export const API_ENDPOINTS = {
             methods: ["POST"],
             endpoint: "/api/v1/auth/logout",
         },
+        /**
+         *  @description
+         *  Route redirects the user to the OpenID Connect provider.
+         *  The provider redirects the user back to /api/v1/auth/oidc/callback after signing in.
+         */
+        OIDCLogin: {
+            key: "AUTH-oidc-login",
+            methods: ["GET"],
+            endpoint: "/api/v1/auth/oidc/login",
+        },
+        /**
+         *  @description
+         *  Route creates a server session after signing in with the OpenID Connect provider.
+         *  The ID token is validated and the user is checked against the allowed users.
+         *  The user is redirected to the auth page with the session token in the URL fragment, the client stores it in place of the password hash.
+         */
+        OIDCCallback: {
+            key: "AUTH-oidc-callback",
+            methods: ["GET"],
+            endpoint: "/api/v1/auth/oidc/callback",
+        },
+        /**
+         *  @description
+         *  Route creates a server session for the user authenticated by the trusted reverse proxy.
+         *  The username is read from the configured header, e.g. Remote-User, only if the request comes from an allowed address.
+         *  The client stores the returned token in place of the password hash.
+         */
+        TrustedProxyLogin: {
+            key: "AUTH-trusted-proxy-login",
+            methods: ["POST"],
+            endpoint: "/api/v1/auth/proxy",
+        },
+        /**
+         *  @description
+         *  Route revokes the server session of the client.
+         *  This does nothing for clients authenticated with the server password.
+         */
+        ServerLogout: {
+            key: "AUTH-server-logout",
+            methods: ["DELETE"],
+            endpoint: "/api/v1/auth/session",
+        },
     },
     AUTO_DOWNLOADER: {
         /**
@@ -840,6 +882,33 @@ export const API_ENDPOINTS = {
             methods: ["GET"],
             endpoint: "/api/v1/extensions/marketplace",
         },
+        GetExtensionTrustData: {
+            key: "EXTENSIONS-get-extension-trust-data",
+            methods: ["GET"],
+            endpoint: "/api/v1/extensions/trust",
+        },
+        /**
+         *  @description
+         *  Route pins the publisher keys trusted for a marketplace.
+         *  Extensions installed from the marketplace must be signed by one of the keys.
+         *  An empty list removes the pin.
+         */
+        SetMarketplaceTrustedKeys: {
+            key: "EXTENSIONS-set-marketplace-trusted-keys",
+            methods: ["POST"],
+            endpoint: "/api/v1/extensions/trust/marketplace-keys",
+        },
+        /**
+         *  @description
+         *  Route approves a new publisher key for the extension with the given ID.
+         *  This allows the next install or update to be signed by the given key.
+         *  An empty key allows an unsigned payload, e.g. when editing the code of a signed extension.
+         */
+        ApproveExtensionPublisherKey: {
+            key: "EXTENSIONS-approve-extension-publisher-key",
+            methods: ["POST"],
+            endpoint: "/api/v1/extensions/trust/approve",
+        },
     },
     FILECACHE: {
         /**
@@ -1480,6 +1549,19 @@ export const API_ENDPOINTS = {
             endpoint: "/api/v1/metadata/parent",
         },
     },
+    METRICS: {
+        /**
+         *  @description
+         *  Route returns the metrics in the Prometheus text format.
+         *  When the server is protected, scrapers can authenticate with the metrics token set in the config, an API token with the ViewMetrics scope or the server password.
+         *  The token is sent with the "Authorization: Bearer <token>" header.
+         */
+        GetMetrics: {
+            key: "METRICS-get-metrics",
+            methods: ["GET"],
+            endpoint: "/api/v1/metrics",
+        },
+    },
     NAKAMA: {
         /**
          *  @description
@@ -407,6 +407,7 @@ export type AL_BaseAnime = {
     meanScore?: number
     description?: string
     genres?: Array<string>
+    tags?: Array<AL_BaseAnime_Tags>
     duration?: number
     trailer?: AL_BaseAnime_Trailer
     title?: AL_BaseAnime_Title
@@ -461,6 +462,16 @@ export type AL_BaseAnime_StartDate = {
     day?: number
 }
 
+/**
+ * - Filepath: internal/api/anilist/client_gen.go
+ * - Filename: client_gen.go
+ * - Package: anilist
+ */
+export type AL_BaseAnime_Tags = {
+    name: string
+    rank?: number
+}
+
 /**
  * - Filepath: internal/api/anilist/client_gen.go
  * - Filename: client_gen.go
@@ -2001,6 +2012,7 @@ export type INTERNAL_FeatureKey = "ManageOfflineMode" |
     "ViewAutoDownloader" |
     "ManageAutoDownloader" |
     "ViewScanSummaries" |
+    "ViewMetrics" |
     "ViewExtensions" |
     "ManageExtensions" |
     "ManageHomeScreen" |
@@ -2576,6 +2588,30 @@ export type ExtensionRepo_RepositoryInstallResponse = {
     message: string
 }
 
+/**
+ * - Filepath: internal/extension_repo/trust.go
+ * - Filename: trust.go
+ * - Package: extension_repo
+ */
+export type ExtensionRepo_StoredExtensionTrustData = {
+    /**
+     * Marketplace URL -> Trusted publisher keys
+     */
+    pinnedKeys?: Record<string, Array<string>>
+    /**
+     * Extension ID -> Publisher key at install time, empty if unsigned
+     */
+    installedKeys?: Record<string, string>
+    /**
+     * Extension ID -> Marketplace URL it was installed from
+     */
+    marketplaces?: Record<string, string>
+    /**
+     * Extension ID -> Publisher key approved for the next install/update
+     */
+    approvedKeys?: Record<string, string>
+}
+
 /**
  * - Filepath: internal/extension_repo/external_plugin.go
  * - Filename: external_plugin.go
@@ -2883,10 +2919,37 @@ export type Status = {
     featureFlags?: INTERNAL_FeatureFlags
     disabledFeatures?: Array<INTERNAL_FeatureKey>
     serverReady: boolean
+    /**
+     * Clients have to authenticate, with the password, OIDC or the trusted proxy
+     */
     serverHasPassword: boolean
+    serverAuthMethods: ServerAuthMethods
     showChangelogTour: string
 }
 
+/**
+ * - Filepath: internal/handlers/status.go
+ * - Filename: status.go
+ * - Package: handlers
+ * @description
+ *  ServerAuthMethods lists the enabled ways for clients to authenticate.
+ */
+export type ServerAuthMethods = {
+    password: boolean
+    oidc: boolean
+    trustedProxy: boolean
+}
+
+/**
+ * - Filepath: internal/handlers/server_auth.go
+ * - Filename: server_auth.go
+ * - Package: handlers
+ */
+export type ServerSessionResponse = {
+    token: string
+    session?: Serverauth_Session
+}
+
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 // Hibikecustomsource
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -4658,6 +4721,22 @@ export type Report_WebSocketLog = {
     timestamp?: string
 }
 
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Serverauth
+//////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+/**
+ * - Filepath: internal/serverauth/serverauth.go
+ * - Filename: serverauth.go
+ * - Package: serverauth
+ */
+export type Serverauth_Session = {
+    username: string
+    method: string
+    createdAt?: string
+    expiresAt?: string
+}
+
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 // Summary
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
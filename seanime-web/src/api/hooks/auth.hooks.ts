@@ -1,7 +1,7 @@
 import { useServerMutation } from "@/api/client/requests"
 import { Login_Variables } from "@/api/generated/endpoint.types"
 import { API_ENDPOINTS } from "@/api/generated/endpoints"
-import { Status } from "@/api/generated/types"
+import { ServerSessionResponse, Status } from "@/api/generated/types"
 import { useSetServerStatus } from "@/app/(main)/_hooks/use-server-status"
 import { useRouter } from "@/lib/navigation"
 import { useQueryClient } from "@tanstack/react-query"
@@ -59,3 +59,14 @@ export function useLogout() {
         },
     })
 }
+
+// Signs in with the identity set by the trusted reverse proxy, e.g. Authelia or Authentik
+export function useTrustedProxyLogin() {
+    return useServerMutation<ServerSessionResponse>({
+        endpoint: API_ENDPOINTS.AUTH.TrustedProxyLogin.endpoint,
+        method: API_ENDPOINTS.AUTH.TrustedProxyLogin.methods[0],
+        mutationKey: [API_ENDPOINTS.AUTH.TrustedProxyLogin.key],
+        // Errors are expected when the request didn't go through the proxy, the other methods are shown instead
+        onError: () => {},
+    })
+}
@@ -1,3 +1,4 @@
+import { getServerBasePath } from "@/api/client/server-url"
 import { Status } from "@/api/generated/types"
 import { useGettingStarted } from "@/api/hooks/settings.hooks"
 import { useSetServerStatus } from "@/app/(main)/_hooks/use-server-status"
@@ -734,7 +735,7 @@ export function GettingStartedPage({ status }: { status: Status }) {
             <div className="fixed h-100vh w-100vw inset-0 ">
                 <div className="fixed h-100vh w-100vw bg-gray-950/20 z-[1] backdrop-blur-sm firefox:backdrop-blur-none inset-0"></div>
                 <Image
-                    src="/background.jpeg"
+                    src={getServerBasePath() + "/background.jpeg"}
                     alt="bg"
                     fill
                     sizes="100vw"
@@ -1,3 +1,4 @@
+import { getServerBasePath } from "@/api/client/server-url"
 import { AL_BaseAnime } from "@/api/generated/types"
 import { useAnilistListAnime } from "@/api/hooks/anilist.hooks"
 import { useMediaPreviewModal } from "@/app/(main)/_features/media/_containers/media-preview-modal"
@@ -97,7 +98,7 @@ export function SeaCommandSearch() {
                                 className="h-[10rem] w-[10rem] mx-auto flex-none rounded-[--radius-md] object-cover object-center relative overflow-hidden"
                             >
                                 <SeaImage
-                                    src="/luffy-01.png"
+                                    src={getServerBasePath() + "/luffy-01.png"}
                                     alt={""}
                                     fill
                                     quality={100}
@@ -1,4 +1,4 @@
-import { getServerBaseUrl } from "@/api/client/server-url"
+import { getServerBasePath, getServerBaseUrl } from "@/api/client/server-url"
 import { MKVParser_SubtitleEvent, MKVParser_TrackInfo } from "@/api/generated/types"
 import { VideoCorePgsRenderer } from "@/app/(main)/_features/video-core/video-core-pgs-renderer"
 import { vc_getSubtitleStyle } from "@/app/(main)/_features/video-core/video-core-settings-menu"
@@ -10,9 +10,9 @@ import JASSUB from "jassub"
 import type { ASSEvent } from "jassub/dist/worker/util"
 import { toast } from "sonner"
 
-const modernWasmUrl = "/jassub/jassub-worker-modern.wasm"
-const wasmUrl = "/jassub/jassub-worker.wasm"
-const workerUrl = "/jassub/jassub-worker.js"
+const modernWasmUrl = getServerBasePath() + "/jassub/jassub-worker-modern.wasm"
+const wasmUrl = getServerBasePath() + "/jassub/jassub-worker.wasm"
+const workerUrl = getServerBasePath() + "/jassub/jassub-worker.js"
 
 const subtitleLog = logger("VIDEO CORE SUBTITLES")
 
@@ -228,7 +228,7 @@ Style: Default, Roboto Medium,24,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,0,0
 
                 subtitleLog.info("Initializing libass renderer")
 
-                const defaultFontUrl = "/fonts/Roboto-Medium.ttf"
+                const defaultFontUrl = getServerBasePath() + "/fonts/Roboto-Medium.ttf"
 
                 console.warn(workerUrl)
 
@@ -381,6 +381,7 @@ export function MarketplaceExtensions(props: MarketplaceExtensionsProps) {
                                 key={extension.id}
                                 extension={extension}
                                 isInstalled={isExtensionInstalled(extension.id)}
+                                marketplaceUrl={marketplaceUrl}
                             />
                         ))}
                     </div>
@@ -398,6 +399,7 @@ export function MarketplaceExtensions(props: MarketplaceExtensionsProps) {
                                 key={extension.id}
                                 extension={extension}
                                 isInstalled={isExtensionInstalled(extension.id)}
+                                marketplaceUrl={marketplaceUrl}
                             />
                         ))}
                     </div>
@@ -413,6 +415,7 @@ export function MarketplaceExtensions(props: MarketplaceExtensionsProps) {
                                 key={extension.id}
                                 extension={extension}
                                 isInstalled={isExtensionInstalled(extension.id)}
+                                marketplaceUrl={marketplaceUrl}
                             />
                         ))}
                     </div>
@@ -439,6 +442,7 @@ export function MarketplaceExtensions(props: MarketplaceExtensionsProps) {
                                 key={extension.id}
                                 extension={extension}
                                 isInstalled={isExtensionInstalled(extension.id)}
+                                marketplaceUrl={marketplaceUrl}
                             />
                         ))}
                     </div>
@@ -454,6 +458,8 @@ type MarketplaceExtensionCardProps = {
     isInstalled: boolean
     hideInstallButton?: boolean
     showType?: boolean
+    // Marketplace the extension is listed in, the publisher keys pinned for it are checked on install
+    marketplaceUrl?: string
 }
 
 export function MarketplaceExtensionCard(props: MarketplaceExtensionCardProps) {
@@ -464,6 +470,7 @@ export function MarketplaceExtensionCard(props: MarketplaceExtensionCardProps) {
         isInstalled,
         hideInstallButton,
         showType,
+        marketplaceUrl,
         ...rest
     } = props
 
@@ -499,7 +506,7 @@ export function MarketplaceExtensionCard(props: MarketplaceExtensionCardProps) {
                         intent="primary-subtle"
                         icon={<LuDownload />}
                         loading={isInstalling}
-                        onClick={() => installExtension({ manifestUri: extension.manifestURI })}
+                        onClick={() => installExtension({ manifestUri: extension.manifestURI, marketplaceUrl })}
                     /> : <IconButton
                         size="sm"
                         disabled
@@ -1,3 +1,4 @@
+import { getServerBasePath } from "@/api/client/server-url"
 import { useGetStatus } from "@/api/hooks/status.hooks"
 import { serverAuthTokenAtom } from "@/app/(main)/_atoms/server-status.atoms"
 import { GettingStartedPage } from "@/app/(main)/_features/getting-started/getting-started-page"
@@ -57,7 +58,7 @@ export function ServerDataWrapper(props: ServerDataWrapperProps) {
     React.useEffect(() => {
         if (serverStatus) {
             if (serverStatus?.serverHasPassword && !password && pathname !== "/public/auth") {
-                window.location.href = "/public/auth"
+                window.location.href = getServerBasePath() + "/public/auth"
                 setAuthenticated(false)
                 console.warn("Redirecting to auth")
             } else {
@@ -1,4 +1,9 @@
+import { getServerBasePath, getServerBaseUrl } from "@/api/client/server-url"
+import { API_ENDPOINTS } from "@/api/generated/endpoints"
+import { useTrustedProxyLogin } from "@/api/hooks/auth.hooks"
+import { useGetStatus } from "@/api/hooks/status.hooks"
 import { serverAuthTokenAtom } from "@/app/(main)/_atoms/server-status.atoms"
+import { Button } from "@/components/ui/button"
 import { defineSchema, Field, Form } from "@/components/ui/form"
 import { Modal } from "@/components/ui/modal"
 import { useAtom } from "jotai"
@@ -9,10 +14,48 @@ export function ServerAuth() {
 
     const [, setAuthToken] = useAtom(serverAuthTokenAtom)
     const [loading, setLoading] = useState(false)
+    const [error, setError] = useState<string | null>(null)
+
+    const { data: status } = useGetStatus()
+    const authMethods = status?.serverAuthMethods
+
+    const { mutate: trustedProxyLogin, isPending: isTrustedProxyLoginPending } = useTrustedProxyLogin()
+
+    function onAuthenticated(token: string) {
+        setAuthToken(token)
+        React.startTransition(() => {
+            window.location.href = getServerBasePath() + "/"
+        })
+    }
+
+    // The session token or the error is passed in the URL fragment after signing in with OIDC
+    React.useEffect(() => {
+        const params = new URLSearchParams(window.location.hash.slice(1))
+        const session = params.get("session")
+        const err = params.get("error")
+        if (!session && !err) return
+
+        window.history.replaceState(null, "", window.location.pathname)
+        if (session) {
+            onAuthenticated(session)
+        } else {
+            setError(err)
+        }
+    }, [])
+
+    // Sign in automatically when the server trusts the reverse proxy
+    React.useEffect(() => {
+        if (!authMethods?.trustedProxy || window.location.hash.includes("session=")) return
+        trustedProxyLogin(undefined, {
+            onSuccess: data => {
+                if (data?.token) onAuthenticated(data.token)
+            },
+        })
+    }, [authMethods?.trustedProxy])
 
     return (<>
         <Modal
-            title="Password required"
+            title={authMethods?.password ? "Password required" : "Sign in required"}
             description="This Kōtei server requires authentication."
             open={true}
             onOpenChange={(v) => { }}
@@ -20,7 +63,23 @@ export function ServerAuth() {
             contentClass="border focus:outline-none focus-visible:outline-none outline-none"
             hideCloseButton
         >
-            <Form
+            {!!error && <p className="text-red-300 text-sm">{error}</p>}
+
+            {authMethods?.oidc && (
+                <Button
+                    intent="white"
+                    className="w-full"
+                    loading={loading || isTrustedProxyLoginPending}
+                    onClick={() => {
+                        setLoading(true)
+                        window.location.href = getServerBaseUrl() + API_ENDPOINTS.AUTH.OIDCLogin.endpoint
+                    }}
+                >
+                    Sign in with SSO
+                </Button>
+            )}
+
+            {(!authMethods || authMethods.password) && <Form
                 schema={defineSchema(({ z }) => z.object({
                     password: z.string().min(1, "Password is required"),
                 }))}
@@ -29,7 +88,7 @@ export function ServerAuth() {
                     const hash = sha256(data.password)
                     setAuthToken(hash)
                     React.startTransition(() => {
-                        window.location.href = "/"
+                        window.location.href = getServerBasePath() + "/"
                         setLoading(false)
                     })
                 }}
@@ -41,7 +100,13 @@ export function ServerAuth() {
                     fieldClass=""
                 />
                 <Field.Submit showLoadingOverlayOnSuccess loading={loading}>Continue</Field.Submit>
-            </Form>
+            </Form>}
+
+            {!!authMethods?.trustedProxy && !authMethods.oidc && !authMethods.password && !isTrustedProxyLoginPending && (
+                <p className="text-[--muted] text-sm">
+                    Sign in through your authentication proxy to access this server.
+                </p>
+            )}
         </Modal>
     </>)
 }
@@ -1,3 +1,4 @@
+import { getServerBasePath } from "@/api/client/server-url"
 import { SeaImage } from "@/components/shared/sea-image"
 import { Button } from "@/components/ui/button/button"
 import { cn } from "@/components/ui/core/styling"
@@ -30,7 +31,7 @@ export const LuffyError: React.FC<LuffyErrorProps> = (props) => {
                 >
                     <SeaImage
                         data-luffy-error-image
-                        src="/luffy-01.png"
+                        src={getServerBasePath() + "/luffy-01.png"}
                         alt={""}
                         fill
                         priority
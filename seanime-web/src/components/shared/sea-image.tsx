@@ -1,3 +1,4 @@
+import { getServerBasePath } from "@/api/client/server-url"
 import { HIDE_IMAGES } from "@/types/constants"
 import React, { forwardRef, useEffect, useState } from "react"
 
@@ -24,7 +25,7 @@ export const SeaImage = forwardRef<HTMLImageElement, ImageProps & { isExternal?:
             return <Image
                 ref={ref}
                 {...props}
-                src="/no-cover.png"
+                src={getServerBasePath() + "/no-cover.png"}
                 className={props.className}
                 alt={props.alt || "cover"}
                 fill={fill}
@@ -41,7 +42,7 @@ export const SeaImage = forwardRef<HTMLImageElement, ImageProps & { isExternal?:
             || (allowGif && props.src.endsWith(".gif"))
         )
 
-        const effectiveOverride = (blocked || hasError) ? "/no-cover.png" : props.overrideSrc
+        const effectiveOverride = (blocked || hasError) ? getServerBasePath() + "/no-cover.png" : props.overrideSrc
 
         function handleError() {
             setHasError(true)
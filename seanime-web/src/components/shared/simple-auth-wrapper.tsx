@@ -1,3 +1,4 @@
+import { getServerBasePath } from "@/api/client/server-url"
 import { useGetSettings } from "@/api/hooks/settings.hooks"
 import { useGetStatus } from "@/api/hooks/status.hooks"
 import { serverAuthTokenAtom } from "@/app/(main)/_atoms/server-status.atoms"
@@ -30,7 +31,7 @@ export function SimpleAuthWrapper({ children }: SimpleAuthWrapperProps) {
         if (serverStatus) {
             if (serverStatus.serverHasPassword && !password) {
                 setRedirecting(true)
-                window.location.href = "/public/auth"
+                window.location.href = getServerBasePath() + "/public/auth"
             }
         }
     }, [serverStatus, password])
@@ -1,3 +1,5 @@
+import "./public-path"
+import { getServerBasePath } from "@/api/client/server-url"
 import { ClientProviders, queryClient, store } from "@/app/client-providers"
 import "./app/globals.css"
 import { createRouter, RouterProvider } from "@tanstack/react-router"
@@ -8,6 +10,7 @@ import "@fontsource-variable/inter"
 
 const router = createRouter({
     routeTree,
+    basepath: getServerBasePath() || undefined,
     // defaultPreload: import.meta.env.PROD ? "intent" : false,
     defaultPreload: false, // anilist rate limits
     context: {
@@ -0,0 +1,9 @@
+// Load the async chunks from the base path when the server is behind a reverse proxy
+// Must be imported before any other module
+declare let __webpack_public_path__: string
+
+if (window.__SEANIME_BASE_PATH__) {
+    __webpack_public_path__ = window.__SEANIME_BASE_PATH__ + "/"
+}
+
+export {}
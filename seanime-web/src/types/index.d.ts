@@ -25,6 +25,7 @@ declare global {
     }
 
     interface Window {
+        __SEANIME_BASE_PATH__?: string;
         electron?: {
             window: {
                 minimize: () => void;